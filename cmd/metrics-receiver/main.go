@@ -4,9 +4,12 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"time"
+
+	"github.com/taniwha3/tidewatch/internal/uploader"
 )
 
 var (
@@ -44,11 +47,13 @@ func main() {
 	}
 
 	http.HandleFunc("/api/metrics", handleMetrics)
+	http.HandleFunc("/api/v1/write", handleRemoteWrite)
 	http.HandleFunc("/health", handleHealth)
 
 	addr := fmt.Sprintf(":%d", *port)
 	log.Printf("Metrics receiver starting on %s", addr)
 	log.Printf("POST metrics to http://localhost%s/api/metrics", addr)
+	log.Printf("POST remote_write to http://localhost%s/api/v1/write", addr)
 	log.Printf("Verbose logging: %t", *verbose)
 
 	if err := http.ListenAndServe(addr, nil); err != nil {
@@ -93,6 +98,55 @@ func handleMetrics(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleRemoteWrite accepts Prometheus remote_write requests (protobuf + snappy)
+func handleRemoteWrite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get("Content-Encoding") != "snappy" {
+		http.Error(w, "Content-Encoding must be snappy", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 10*1024*1024))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	series, err := uploader.DecodeRemoteWrite(body)
+	if err != nil {
+		log.Printf("Failed to decode remote_write request: %v", err)
+		http.Error(w, fmt.Sprintf("Invalid remote_write request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	samples := 0
+	for _, ts := range series {
+		samples += len(ts.Samples)
+	}
+
+	now := time.Now().Format("15:04:05")
+	log.Printf("[%s] Received remote_write: %d series, %d samples from %s (version %s)",
+		now, len(series), samples, r.Header.Get("X-Device-ID"), r.Header.Get("X-Prometheus-Remote-Write-Version"))
+
+	if *verbose {
+		for _, ts := range series {
+			labels := ""
+			for _, l := range ts.Labels {
+				labels += fmt.Sprintf("%s=%q ", l.Name, l.Value)
+			}
+			for _, s := range ts.Samples {
+				log.Printf("  {%s} = %g @ %d", labels, s.Value, s.Timestamp)
+			}
+		}
+	}
+
+	// remote_write receivers respond with 2xx and an empty body
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/config"
+	"github.com/taniwha3/tidewatch/internal/exposition"
+	"github.com/taniwha3/tidewatch/internal/models"
+	"github.com/taniwha3/tidewatch/internal/storage"
+	"github.com/taniwha3/tidewatch/internal/uploader"
+)
+
+// Subcommands read the local database without starting the daemon. The database is opened
+// read-only through WAL, so they need no process lock and are safe next to a running daemon.
+
+// subcommand runs a CLI subcommand and returns the process exit code
+type subcommand func(args []string, stdout, stderr io.Writer) int
+
+var subcommands = map[string]subcommand{
+	"series": runSeriesCommand,
+	"query":  runQueryCommand,
+	"export": runExportCommand,
+}
+
+// vmBatchSize is the number of samples encoded per BuildVMJSONL call during export
+const vmBatchSize = 1000
+
+// queryFlags are the database and filter flags shared by every subcommand
+type queryFlags struct {
+	config string
+	db     string
+	metric string
+	device string
+	start  string
+	end    string
+	tags   tagFlags
+	limit  int
+}
+
+func (q *queryFlags) register(fs *flag.FlagSet, defaultLimit int) {
+	q.tags = tagFlags{}
+	fs.StringVar(&q.config, "config", "/etc/tidewatch/config.yaml", "Path to config file (for storage.path)")
+	fs.StringVar(&q.db, "db", "", "Path to the database (overrides storage.path from -config)")
+	fs.StringVar(&q.metric, "metric", "", "Only this metric name")
+	fs.StringVar(&q.device, "device", "", "Only this device ID")
+	fs.StringVar(&q.start, "start", "", "Start time: RFC3339, YYYY-MM-DD, Unix milliseconds or a duration ago (e.g., 6h)")
+	fs.StringVar(&q.end, "end", "", "End time, same formats as -start")
+	fs.Var(&q.tags, "tag", "Only series with this tag, as key=value (repeatable)")
+	fs.IntVar(&q.limit, "limit", defaultLimit, "Maximum number of results (0 = no limit)")
+}
+
+// options converts the filter flags into storage query options
+func (q *queryFlags) options(now time.Time) (storage.QueryOptions, error) {
+	startMs, err := parseTimeFlag(q.start, now)
+	if err != nil {
+		return storage.QueryOptions{}, fmt.Errorf("invalid -start: %w", err)
+	}
+	endMs, err := parseTimeFlag(q.end, now)
+	if err != nil {
+		return storage.QueryOptions{}, fmt.Errorf("invalid -end: %w", err)
+	}
+	if startMs > 0 && endMs > 0 && endMs < startMs {
+		return storage.QueryOptions{}, fmt.Errorf("-end is before -start")
+	}
+	if q.limit < 0 {
+		return storage.QueryOptions{}, fmt.Errorf("-limit must not be negative")
+	}
+	return storage.QueryOptions{
+		StartMs:    startMs,
+		EndMs:      endMs,
+		DeviceID:   q.device,
+		MetricName: q.metric,
+		Tags:       q.tags,
+		Limit:      q.limit,
+	}, nil
+}
+
+// open opens the database named by -db, or storage.path from -config, read-only
+func (q *queryFlags) open() (*storage.SQLiteStorage, error) {
+	path := q.db
+	if path == "" {
+		cfg, err := config.Load(q.config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config (use -db to name the database directly): %w", err)
+		}
+		path = cfg.Storage.Path
+	}
+	if path == "" {
+		return nil, fmt.Errorf("storage.path is not set in %s", q.config)
+	}
+	return storage.OpenReadOnly(path)
+}
+
+// tagFlags collects repeated -tag key=value flags
+type tagFlags map[string]string
+
+func (t tagFlags) String() string {
+	return formatTags(t)
+}
+
+func (t tagFlags) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	t[key] = val
+	return nil
+}
+
+// parseTimeFlag parses a time flag into Unix milliseconds (0 for an empty value)
+// Accepts RFC3339, a date, Unix milliseconds or a duration before now
+func parseTimeFlag(value string, now time.Time) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if d, err := time.ParseDuration(strings.TrimPrefix(value, "-")); err == nil {
+		return now.Add(-d).UnixMilli(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UnixMilli(), nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t.UnixMilli(), nil
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil && ms > 0 {
+		return ms, nil
+	}
+	return 0, fmt.Errorf("%q is not a time, date, Unix milliseconds or duration", value)
+}
+
+// newFlagSet creates a subcommand flag set that reports errors instead of exiting
+func newFlagSet(name, usage string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: tidewatch %s [flags]\n\n%s\n\nFlags:\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// runSeriesCommand lists the stored series with their sample counts and time range
+func runSeriesCommand(args []string, stdout, stderr io.Writer) int {
+	var q queryFlags
+	fs := newFlagSet("series", "List stored series with sample counts and time ranges.", stderr)
+	q.register(fs, 0)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	opts, err := q.options(time.Now())
+	if err != nil {
+		fmt.Fprintf(stderr, "tidewatch series: %v\n", err)
+		return 2
+	}
+	store, err := q.open()
+	if err != nil {
+		fmt.Fprintf(stderr, "tidewatch series: %v\n", err)
+		return 1
+	}
+	defer store.Close()
+
+	series, err := store.ListSeries(context.Background(), opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "tidewatch series: %v\n", err)
+		return 1
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "METRIC\tDEVICE\tTAGS\tSAMPLES\tFIRST\tLAST")
+	for _, s := range series {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n",
+			s.Name, s.DeviceID, formatTags(s.Tags), s.Count, formatMs(s.FirstMs), formatMs(s.LastMs))
+	}
+	tw.Flush()
+	return 0
+}
+
+// runQueryCommand prints samples matching the filters
+func runQueryCommand(args []string, stdout, stderr io.Writer) int {
+	var q queryFlags
+	fs := newFlagSet("query", "Print stored samples, oldest first.", stderr)
+	q.register(fs, 1000)
+	format := fs.String("format", "table", "Output format: table, csv, jsonl or openmetrics")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	return runSamples("query", &q, *format, stdout, stderr)
+}
+
+// runExportCommand writes samples matching the filters to a file in a replayable format
+func runExportCommand(args []string, stdout, stderr io.Writer) int {
+	var q queryFlags
+	fs := newFlagSet("export", "Export stored samples as CSV, VictoriaMetrics JSONL (POST to /api/v1/import) or OpenMetrics.", stderr)
+	q.register(fs, 0)
+	format := fs.String("format", "jsonl", "Output format: csv, jsonl or openmetrics")
+	output := fs.String("o", "-", "Output file (- = stdout)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *format == "table" {
+		fmt.Fprintln(stderr, "tidewatch export: table is not an export format, use tidewatch query")
+		return 2
+	}
+
+	if *output == "-" {
+		return runSamples("export", &q, *format, stdout, stderr)
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintf(stderr, "tidewatch export: %v\n", err)
+		return 1
+	}
+	code := runSamples("export", &q, *format, f, stderr)
+	if err := f.Close(); err != nil && code == 0 {
+		fmt.Fprintf(stderr, "tidewatch export: %v\n", err)
+		code = 1
+	}
+	if code != 0 {
+		os.Remove(*output) // Don't leave a truncated export behind
+	}
+	return code
+}
+
+// runSamples streams the samples selected by q to out in the given format
+func runSamples(name string, q *queryFlags, format string, out, stderr io.Writer) int {
+	opts, err := q.options(time.Now())
+	if err != nil {
+		fmt.Fprintf(stderr, "tidewatch %s: %v\n", name, err)
+		return 2
+	}
+	writer, err := newSampleWriter(format, out)
+	if err != nil {
+		fmt.Fprintf(stderr, "tidewatch %s: %v\n", name, err)
+		return 2
+	}
+	// OpenMetrics families must not interleave
+	opts.OrderBySeries = format == "openmetrics"
+
+	store, err := q.open()
+	if err != nil {
+		fmt.Fprintf(stderr, "tidewatch %s: %v\n", name, err)
+		return 1
+	}
+	defer store.Close()
+
+	var count, stringCount int64
+	err = store.QueryEach(context.Background(), opts, func(m *models.Metric) error {
+		count++
+		if m.ValueType == models.ValueTypeString {
+			stringCount++
+		}
+		return writer.Write(m)
+	})
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "tidewatch %s: %v\n", name, err)
+		return 1
+	}
+
+	if name == "export" {
+		fmt.Fprintf(stderr, "Exported %d samples\n", count)
+		if stringCount > 0 && (format == "jsonl" || format == "openmetrics") {
+			fmt.Fprintf(stderr, "Skipped %d string samples (%s is numeric only)\n", stringCount, format)
+		}
+	}
+	if h, ok := writer.(*exposition.HistoryWriter); ok && h.Skipped > 0 {
+		fmt.Fprintf(stderr, "Skipped %d samples whose names collide after sanitizing\n", h.Skipped)
+	}
+	return 0
+}
+
+// sampleWriter encodes a stream of samples
+type sampleWriter interface {
+	Write(m *models.Metric) error
+	Close() error
+}
+
+// newSampleWriter returns the writer for an output format
+func newSampleWriter(format string, w io.Writer) (sampleWriter, error) {
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "TIMESTAMP\tMETRIC\tDEVICE\tVALUE\tTAGS")
+		return &tableWriter{tw: tw}, nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"timestamp_ms", "timestamp", "metric", "device_id", "value", "tags"}); err != nil {
+			return nil, err
+		}
+		return &csvWriter{cw: cw}, nil
+	case "jsonl":
+		return &vmWriter{w: w}, nil
+	case "openmetrics":
+		return exposition.NewHistoryWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q (valid: table, csv, jsonl, openmetrics)", format)
+	}
+}
+
+// tableWriter prints aligned columns for people
+type tableWriter struct {
+	tw *tabwriter.Writer
+}
+
+func (t *tableWriter) Write(m *models.Metric) error {
+	_, err := fmt.Fprintf(t.tw, "%s\t%s\t%s\t%s\t%s\n",
+		formatMs(m.TimestampMs), m.Name, m.DeviceID, formatSampleValue(m), formatTags(m.Tags))
+	return err
+}
+
+func (t *tableWriter) Close() error {
+	return t.tw.Flush()
+}
+
+// csvWriter writes one row per sample; tags are a JSON object so any key survives
+type csvWriter struct {
+	cw *csv.Writer
+}
+
+func (c *csvWriter) Write(m *models.Metric) error {
+	tags := ""
+	if len(m.Tags) > 0 {
+		data, err := json.Marshal(m.Tags)
+		if err != nil {
+			return fmt.Errorf("failed to encode tags: %w", err)
+		}
+		tags = string(data)
+	}
+	return c.cw.Write([]string{
+		strconv.FormatInt(m.TimestampMs, 10),
+		time.UnixMilli(m.TimestampMs).UTC().Format(time.RFC3339Nano),
+		m.Name,
+		m.DeviceID,
+		formatSampleValue(m),
+		tags,
+	})
+}
+
+func (c *csvWriter) Close() error {
+	c.cw.Flush()
+	return c.cw.Error()
+}
+
+// vmWriter writes VictoriaMetrics import JSONL with the same encoding as uploads,
+// so replaying an export produces the series the device would have uploaded
+type vmWriter struct {
+	w     io.Writer
+	batch []*models.Metric
+}
+
+func (v *vmWriter) Write(m *models.Metric) error {
+	v.batch = append(v.batch, m)
+	if len(v.batch) >= vmBatchSize {
+		return v.flush()
+	}
+	return nil
+}
+
+func (v *vmWriter) flush() error {
+	data, _, err := uploader.BuildVMJSONL(v.batch)
+	if err != nil {
+		return err
+	}
+	v.batch = v.batch[:0]
+	_, err = v.w.Write(data)
+	return err
+}
+
+func (v *vmWriter) Close() error {
+	return v.flush()
+}
+
+// formatSampleValue formats a numeric value or returns the text of a string metric
+func formatSampleValue(m *models.Metric) string {
+	if m.ValueType == models.ValueTypeString {
+		return m.ValueText
+	}
+	return strconv.FormatFloat(m.Value, 'g', -1, 64)
+}
+
+// formatTags renders tags as sorted key=value pairs
+func formatTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + tags[k]
+	}
+	return strings.Join(pairs, ",")
+}
+
+// formatMs formats a Unix millisecond timestamp as RFC3339 in UTC
+func formatMs(ms int64) string {
+	return time.UnixMilli(ms).UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+	"github.com/taniwha3/tidewatch/internal/storage"
+	"github.com/taniwha3/tidewatch/internal/uploader"
+)
+
+// cliFixture creates a database with a few samples and leaves it open, like a running daemon
+func cliFixture(t *testing.T) string {
+	t.Helper()
+
+	dbPath := filepath.Join(t.TempDir(), "metrics.db")
+	store, err := storage.NewSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	metrics := []*models.Metric{
+		models.NewMetric("cpu.usage", 12.5, "device-001").WithTimestamp(base),
+		models.NewMetric("cpu.usage", 14, "device-001").WithTimestamp(base.Add(time.Minute)),
+		models.NewMetric("network.rx_bytes", 1024, "device-001").WithTimestamp(base).WithTag("interface", "eth0"),
+		models.NewMetric("network.rx_bytes", 2048, "device-001").WithTimestamp(base).WithTag("interface", "wwan0"),
+		models.NewStringMetric("modem.state", "connected", "device-001").WithTimestamp(base),
+	}
+	if err := store.StoreBatch(context.Background(), metrics); err != nil {
+		t.Fatalf("Failed to store metrics: %v", err)
+	}
+	return dbPath
+}
+
+// runCLI runs a subcommand and returns its exit code, stdout and stderr
+func runCLI(t *testing.T, name string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := subcommands[name](args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestParseTimeFlag(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{"", 0},
+		{"6h", now.Add(-6 * time.Hour).UnixMilli()},
+		{"-30m", now.Add(-30 * time.Minute).UnixMilli()},
+		{"2026-02-28T08:00:00Z", time.Date(2026, 2, 28, 8, 0, 0, 0, time.UTC).UnixMilli()},
+		{"2026-02-28", time.Date(2026, 2, 28, 0, 0, 0, 0, time.UTC).UnixMilli()},
+		{"1772359200000", 1772359200000},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeFlag(tt.value, now)
+		if err != nil {
+			t.Errorf("parseTimeFlag(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseTimeFlag(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+
+	if _, err := parseTimeFlag("yesterday", now); err == nil {
+		t.Error("Expected an error for an unknown time format")
+	}
+}
+
+func TestTagFlags(t *testing.T) {
+	tags := tagFlags{}
+	if err := tags.Set("interface=eth0"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := tags.Set("path=/a=b"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if tags["interface"] != "eth0" || tags["path"] != "/a=b" {
+		t.Errorf("Unexpected tags %v", tags)
+	}
+	if err := tags.Set("novalue"); err == nil {
+		t.Error("Expected an error without '='")
+	}
+}
+
+func TestSeriesCommand(t *testing.T) {
+	dbPath := cliFixture(t)
+
+	code, out, errOut := runCLI(t, "series", "-db", dbPath, "-metric", "network.rx_bytes")
+	if code != 0 {
+		t.Fatalf("series failed (%d): %s", code, errOut)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected a header and 2 series, got:\n%s", out)
+	}
+	if !strings.Contains(lines[1], "interface=eth0") || !strings.Contains(lines[2], "interface=wwan0") {
+		t.Errorf("Unexpected series output:\n%s", out)
+	}
+}
+
+func TestQueryCommand_TagFilter(t *testing.T) {
+	dbPath := cliFixture(t)
+
+	code, out, errOut := runCLI(t, "query", "-db", dbPath, "-tag", "interface=wwan0")
+	if code != 0 {
+		t.Fatalf("query failed (%d): %s", code, errOut)
+	}
+	if !strings.Contains(out, "2048") || strings.Contains(out, "1024") {
+		t.Errorf("Expected only the wwan0 sample, got:\n%s", out)
+	}
+}
+
+func TestQueryCommand_Errors(t *testing.T) {
+	dbPath := cliFixture(t)
+
+	if code, _, _ := runCLI(t, "query", "-db", dbPath, "-format", "xml"); code != 2 {
+		t.Errorf("Expected exit code 2 for an unknown format, got %d", code)
+	}
+	if code, _, _ := runCLI(t, "query", "-db", dbPath, "-start", "1h", "-end", "2h"); code != 2 {
+		t.Errorf("Expected exit code 2 for an inverted range, got %d", code)
+	}
+	if code, _, _ := runCLI(t, "query", "-db", filepath.Join(t.TempDir(), "missing.db")); code != 1 {
+		t.Errorf("Expected exit code 1 for a missing database, got %d", code)
+	}
+}
+
+func TestExportCommand_JSONL(t *testing.T) {
+	dbPath := cliFixture(t)
+	outPath := filepath.Join(t.TempDir(), "export.jsonl")
+
+	code, _, errOut := runCLI(t, "export", "-db", dbPath, "-format", "jsonl", "-o", outPath)
+	if code != 0 {
+		t.Fatalf("export failed (%d): %s", code, errOut)
+	}
+	if !strings.Contains(errOut, "Skipped 1 string samples") {
+		t.Errorf("Expected the string sample to be reported, got %q", errOut)
+	}
+
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 numeric samples, got %d lines", len(lines))
+	}
+
+	// Replayable: same encoding as the uploader
+	var first uploader.VMMetric
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("Failed to parse line: %v", err)
+	}
+	if first.Metric["__name__"] == "" || first.Metric["device_id"] != "device-001" || len(first.Timestamps) != 1 {
+		t.Errorf("Unexpected import line %s", lines[0])
+	}
+}
+
+func TestExportCommand_CSV(t *testing.T) {
+	dbPath := cliFixture(t)
+
+	code, out, errOut := runCLI(t, "export", "-db", dbPath, "-format", "csv", "-metric", "network.rx_bytes")
+	if code != 0 {
+		t.Fatalf("export failed (%d): %s", code, errOut)
+	}
+	records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected a header and 2 rows, got %d", len(records))
+	}
+	if records[1][5] != `{"interface":"eth0"}` {
+		t.Errorf("Expected tags as JSON, got %q", records[1][5])
+	}
+}
+
+func TestExportCommand_OpenMetrics(t *testing.T) {
+	dbPath := cliFixture(t)
+
+	code, out, errOut := runCLI(t, "export", "-db", dbPath, "-format", "openmetrics")
+	if code != 0 {
+		t.Fatalf("export failed (%d): %s", code, errOut)
+	}
+	if !strings.HasSuffix(out, "# EOF\n") {
+		t.Errorf("Expected exposition to end with # EOF, got:\n%s", out)
+	}
+	if strings.Count(out, "# TYPE cpu_usage gauge") != 1 {
+		t.Errorf("Expected cpu_usage samples grouped in one family, got:\n%s", out)
+	}
+	if !strings.Contains(out, `cpu_usage{device_id="device-001"} 14 1772359260.000`) {
+		t.Errorf("Expected timestamped samples, got:\n%s", out)
+	}
+}
+
+func TestExportCommand_RemovesFileOnFailure(t *testing.T) {
+	outPath := filepath.Join(t.TempDir(), "export.jsonl")
+	code, _, _ := runCLI(t, "export", "-db", filepath.Join(t.TempDir(), "missing.db"), "-o", outPath)
+	if code == 0 {
+		t.Fatal("Expected export from a missing database to fail")
+	}
+	if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		t.Error("Expected no partial export file to be left behind")
+	}
+}
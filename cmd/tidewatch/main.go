@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"log/slog"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -15,13 +16,22 @@ import (
 	"time"
 
 	"github.com/coreos/go-systemd/v22/daemon"
+	"github.com/taniwha3/tidewatch/internal/bandwidth"
 	"github.com/taniwha3/tidewatch/internal/collector"
 	"github.com/taniwha3/tidewatch/internal/config"
+	"github.com/taniwha3/tidewatch/internal/exposition"
 	"github.com/taniwha3/tidewatch/internal/health"
+	"github.com/taniwha3/tidewatch/internal/identity"
+	"github.com/taniwha3/tidewatch/internal/ingest"
 	"github.com/taniwha3/tidewatch/internal/lockfile"
 	"github.com/taniwha3/tidewatch/internal/logging"
+	"github.com/taniwha3/tidewatch/internal/models"
 	"github.com/taniwha3/tidewatch/internal/monitoring"
+	"github.com/taniwha3/tidewatch/internal/relabel"
+	"github.com/taniwha3/tidewatch/internal/session"
+	"github.com/taniwha3/tidewatch/internal/statsd"
 	"github.com/taniwha3/tidewatch/internal/storage"
+	"github.com/taniwha3/tidewatch/internal/timesync"
 	"github.com/taniwha3/tidewatch/internal/uploader"
 	"github.com/taniwha3/tidewatch/internal/watchdog"
 )
@@ -33,6 +43,17 @@ var (
 )
 
 func main() {
+	// Subcommands (series, query, export) inspect the local database instead of running the daemon
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:], os.Stdout, os.Stderr))
+		}
+	}
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: tidewatch [flags]\n       tidewatch series|query|export [flags]\n\nFlags:\n")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	if *version {
@@ -49,6 +70,15 @@ func main() {
 	if err := cfg.Validate(); err != nil {
 		log.Fatalf("Invalid config: %v", err)
 	}
+	if err := resolveDeviceID(cfg); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if err := validateCollectorOptions(cfg); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if _, err := relabel.New(relabelConfigFromConfig(&cfg.Relabel)); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
 
 	// Initialize structured logging
 	logLevel := logging.LevelInfo
@@ -74,6 +104,7 @@ func main() {
 	logger.Info("Configuration loaded",
 		slog.String("storage_path", cfg.Storage.Path),
 		slog.String("remote_url", cfg.Remote.URL),
+		slog.Int("remote_destinations", len(cfg.Remote.GetDestinations())),
 		slog.Bool("remote_enabled", cfg.Remote.Enabled),
 		slog.String("log_level", string(logLevel)),
 		slog.String("log_format", string(logFormat)),
@@ -117,6 +148,14 @@ func main() {
 	defer store.Close()
 	logger.Info("Storage initialized")
 
+	// Databases created before incremental vacuum was enabled are converted once, if there is room
+	if converted, err := store.EnableIncrementalVacuum(context.Background()); err != nil {
+		logger.Warn("Database not converted to incremental vacuum; evicted rows will not shrink the file",
+			slog.Any("error", err))
+	} else if converted {
+		logger.Info("Database converted to incremental vacuum")
+	}
+
 	// Start WAL checkpoint routine
 	// Context for WAL checkpoint routine (separate from main context for shutdown control)
 	walCtx, walCancel := context.WithCancel(context.Background())
@@ -141,6 +180,27 @@ func main() {
 	metricsCollector := monitoring.NewMetricsCollector(cfg.Device.ID)
 	logger.Info("Meta-metrics collector initialized")
 
+	// Coalesce collector batches into one transaction per flush to spare the SD card
+	var writer storage.BatchWriter = store
+	var buffer *storage.WriteBuffer
+	bufferInterval, err := cfg.Storage.Buffer.FlushInterval()
+	if err != nil {
+		// This should never happen since Validate() already checked it
+		logger.Error("Invalid buffer flush interval", slog.Any("error", err))
+		os.Exit(1)
+	}
+	if cfg.Storage.Buffer.IsEnabled() {
+		buffer = storage.NewWriteBuffer(store, storage.WriteBufferConfig{
+			MaxMetrics: cfg.Storage.Buffer.GetMaxMetrics(),
+			OnFlush:    bufferFlushRecorder(metricsCollector, logger),
+		})
+		writer = buffer
+		logger.Info("Write buffer enabled",
+			slog.Duration("flush_interval", bufferInterval),
+			slog.Int("max_metrics", cfg.Storage.Buffer.GetMaxMetrics()),
+		)
+	}
+
 	// Initialize health checker with thresholds derived from upload interval
 	uploadInterval, err := cfg.Remote.UploadInterval()
 	if err != nil {
@@ -148,149 +208,184 @@ func main() {
 		logger.Error("Invalid upload interval", slog.Any("error", err))
 		os.Exit(1)
 	}
-	healthThresholds := health.ThresholdsFromUploadInterval(uploadInterval)
-
-	// Override clock skew threshold if configured
-	if cfg.Monitoring.ClockSkewWarnThresholdMs > 0 {
-		healthThresholds.ClockSkewThresholdMs = int64(cfg.Monitoring.ClockSkewWarnThresholdMs)
+	thresholds, err := healthThresholds(cfg)
+	if err != nil {
+		// This should never happen since Validate() already checked it
+		logger.Error("Invalid upload interval", slog.Any("error", err))
+		os.Exit(1)
 	}
 
-	healthChecker := health.NewChecker(healthThresholds)
+	healthChecker := health.NewChecker(thresholds)
 	logger.Info("Health checker initialized",
 		slog.Duration("upload_interval", uploadInterval),
-		slog.Int("ok_threshold_sec", healthThresholds.UploadOKInterval),
-		slog.Int("degraded_threshold_sec", healthThresholds.UploadDegradedInterval),
-		slog.Int("error_threshold_sec", healthThresholds.UploadErrorInterval),
-		slog.Int64("clock_skew_threshold_ms", healthThresholds.ClockSkewThresholdMs),
+		slog.Int("ok_threshold_sec", thresholds.UploadOKInterval),
+		slog.Int("degraded_threshold_sec", thresholds.UploadDegradedInterval),
+		slog.Int("error_threshold_sec", thresholds.UploadErrorInterval),
+		slog.Int64("clock_skew_threshold_ms", thresholds.ClockSkewThresholdMs),
 	)
+	healthChecker.UpdateConfigStatus(*configPath, nil, time.Now())
+
+	// Serve the latest value of every series on /metrics for local scraping
+	var latest *exposition.Latest
+	if cfg.Monitoring.IsMetricsEndpointEnabled() {
+		latest = exposition.NewLatest(exposition.DefaultStaleAfter)
+		healthChecker.Handle("/metrics", exposition.Handler(latest, metricsCollector.CollectMetrics, logger))
+		logger.Info("OpenMetrics endpoint enabled", slog.String("path", "/metrics"))
+	}
 
-	// Initialize uploader (if remote enabled)
-	var upload uploader.Uploader
-	if cfg.Remote.Enabled {
-		// Build uploader config from remote settings
-		uploaderCfg := uploader.HTTPUploaderConfig{
-			URL:       cfg.Remote.URL,
-			DeviceID:  cfg.Device.ID,
-			AuthToken: cfg.Remote.AuthToken,
-			// Set timeout explicitly to avoid default logic
-			Timeout: 30 * time.Second,
-		}
-
-		// Apply retry configuration only if explicitly configured
-		// Check if retry block is configured at all (Enabled field set OR any numeric field non-zero)
-		retryConfigured := cfg.Remote.Retry.Enabled != nil ||
-			cfg.Remote.Retry.MaxAttempts > 0 ||
-			cfg.Remote.Retry.InitialBackoffStr != "" ||
-			cfg.Remote.Retry.MaxBackoffStr != "" ||
-			cfg.Remote.Retry.BackoffMultiplier > 0 ||
-			cfg.Remote.Retry.JitterPercent != nil
-
-		if retryConfigured {
-			// Retry block is configured - honor the enabled flag
-			// Default to true if Enabled is nil but other fields are set
-			enabled := cfg.Remote.Retry.Enabled == nil || *cfg.Remote.Retry.Enabled
-			if enabled {
-				// Use configured retry values, applying defaults for unset fields
-				maxAttempts := cfg.Remote.Retry.MaxAttempts
-				if maxAttempts == 0 {
-					// User enabled retries but didn't set max_attempts - use default
-					maxAttempts = 3
-				}
-				// Convert max_attempts (total attempts) to maxRetries (number of retries)
-				// max_attempts=1 → maxRetries=0 (1 attempt, no retries)
-				// max_attempts=3 → maxRetries=2 (3 attempts = initial + 2 retries)
-				maxRetries := maxAttempts - 1
-				if maxRetries < 0 {
-					maxRetries = 0
-				}
-				uploaderCfg.MaxRetries = &maxRetries
-
-				retryDelay, err := cfg.Remote.Retry.InitialBackoff()
-				if err != nil {
-					// This should never happen since Validate() already checked it
-					logger.Error("Invalid retry initial_backoff", slog.Any("error", err))
-					os.Exit(1)
-				}
-				maxBackoff, err := cfg.Remote.Retry.MaxBackoff()
-				if err != nil {
-					// This should never happen since Validate() already checked it
-					logger.Error("Invalid retry max_backoff", slog.Any("error", err))
-					os.Exit(1)
-				}
-				uploaderCfg.RetryDelay = retryDelay
-				uploaderCfg.MaxBackoff = maxBackoff
-				uploaderCfg.BackoffMultiplier = cfg.Remote.Retry.BackoffMultiplier
-
-				// JitterPercent: nil means use default (20), otherwise honor the value (even if 0)
-				if cfg.Remote.Retry.JitterPercent != nil {
-					// User explicitly set jitter_percent - honor it (even if 0)
-					uploaderCfg.JitterPercent = cfg.Remote.Retry.JitterPercent
-				} else {
-					// User enabled retries but didn't set jitter_percent - use default
-					// Critical: Without jitter, all instances retry in lockstep (thundering herd)
-					jitter := 20
-					uploaderCfg.JitterPercent = &jitter
-				}
-			} else {
-				// Explicitly disabled - set MaxRetries=0 (means 1 attempt, no retries)
-				zero := 0
-				uploaderCfg.MaxRetries = &zero
-				uploaderCfg.RetryDelay = 1 * time.Second
-				uploaderCfg.JitterPercent = &zero
-			}
-		}
-		// Otherwise: retry block not configured at all
-		// Leave MaxRetries and JitterPercent as nil (uploader will use defaults)
+	// Handle shutdown signals
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-		// Apply chunk size configuration
-		uploaderCfg.ChunkSize = cfg.Remote.GetChunkSize()
+	// SIGHUP reloads the config file (systemctl reload tidewatch)
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
 
-		upload = uploader.NewHTTPUploaderWithConfig(uploaderCfg)
-		defer upload.Close()
+	// WaitGroup for coordinating goroutine shutdown
+	var wg sync.WaitGroup
 
-		// Log uploader config
-		if retryConfigured {
-			maxRetries := 3 // default
-			if uploaderCfg.MaxRetries != nil {
-				maxRetries = *uploaderCfg.MaxRetries
-			}
-			jitterPercent := 20 // default
-			if uploaderCfg.JitterPercent != nil {
-				jitterPercent = *uploaderCfg.JitterPercent
-			}
-			logger.Info("Uploader initialized",
-				slog.Int("chunk_size", uploaderCfg.ChunkSize),
-				slog.Int("max_retries", maxRetries),
-				slog.Duration("retry_delay", uploaderCfg.RetryDelay),
-				slog.Duration("max_backoff", uploaderCfg.MaxBackoff),
-				slog.Float64("backoff_multiplier", uploaderCfg.BackoffMultiplier),
-				slog.Int("jitter_percent", jitterPercent),
-				slog.Bool("retry_configured", true),
-			)
-		} else {
-			logger.Info("Uploader initialized",
-				slog.Int("chunk_size", uploaderCfg.ChunkSize),
-				slog.String("retry_config", "using defaults (3 retries, 1s initial, 30s max, 2.0x multiplier, 20% jitter)"),
-			)
+	// Hold metrics stored before the wall clock is synchronized (boards without an RTC)
+	// Must be installed before the first collection so early rows are held
+	var clockMonitor *timesync.Monitor
+	if cfg.Monitoring.TimeSync.IsEnabled() {
+		checkInterval, err := cfg.Monitoring.TimeSync.CheckInterval()
+		if err != nil {
+			// This should never happen since Validate() already checked it
+			logger.Error("Invalid time sync check interval", slog.Any("error", err))
+			os.Exit(1)
 		}
+		maxWait, err := cfg.Monitoring.TimeSync.MaxWait()
+		if err != nil {
+			// This should never happen since Validate() already checked it
+			logger.Error("Invalid time sync max wait", slog.Any("error", err))
+			os.Exit(1)
+		}
+		// Through the buffer, so held rows still buffered are written before they are corrected
+		var heldStore timesync.Store = store
+		if buffer != nil {
+			heldStore = buffer
+		}
+		clockMonitor = timesync.New(timesync.Config{
+			CheckInterval: checkInterval,
+			MaxWait:       maxWait,
+			Logger:        logger,
+		}, heldStore)
+		store.SetClockSource(clockMonitor)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clockMonitor.Start(ctx)
+		}()
+		logger.Info("Clock sync monitor started", slog.Bool("synced", clockMonitor.Synced()))
 	}
 
-	// Initialize collectors
-	collectors := initializeCollectors(cfg, logger)
-	logger.Info("Collectors initialized", slog.Int("count", len(collectors)))
+	// Stamp metrics collected during streaming sessions and upload them first
+	// Collectors write through the session manager, in front of the write buffer
+	var sessions *session.Manager
+	if cfg.Sessions.Enabled {
+		sessionCfg, err := sessionConfigFromConfig(&cfg.Sessions, cfg.Device.ID)
+		if err != nil {
+			// This should never happen since Validate() already checked it
+			logger.Error("Invalid sessions config", slog.Any("error", err))
+			os.Exit(1)
+		}
+		sessionCfg.Logger = logger
+		sessions = session.New(sessionCfg, store, writer)
+		writer = sessions
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sessions.Start(ctx)
+		}()
+		logger.Info("Session tracking enabled",
+			slog.Int("triggers", len(sessionCfg.Triggers)),
+			slog.Bool("prioritize_uploads", sessionCfg.PrioritizeUploads),
+		)
+	}
 
-	// Handle shutdown signals
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	// Relabel rules apply to pushed metrics as well as collected ones
+	// The collector manager shares this relabeler and updates its rules in place on reload.
+	relabeler, err := relabel.New(relabelConfigFromConfig(&cfg.Relabel))
+	if err != nil {
+		// This should never happen since Validate() already checked it
+		logger.Warn("Invalid relabel rules, storing metrics unchanged", slog.Any("error", err))
+	}
 
-	// WaitGroup for coordinating goroutine shutdown
-	var wg sync.WaitGroup
+	// Aggregate metrics pushed by local applications over StatsD
+	// Flushes go through the relabel stage and the same writer as the collectors, so they are
+	// stamped with the session
+	var statsdListener *statsd.Listener
+	if cfg.StatsD.Enabled {
+		statsdCfg, err := statsdConfigFromConfig(&cfg.StatsD, cfg.Device.ID)
+		if err != nil {
+			// This should never happen since Validate() already checked it
+			logger.Error("Invalid statsd config", slog.Any("error", err))
+			os.Exit(1)
+		}
+		statsdCfg.Recorder = metricsCollector
+		statsdCfg.Logger = logger
+		statsdListener = statsd.New(statsdCfg, &relabelWriter{
+			source:           "statsd",
+			relabeler:        relabeler,
+			next:             writer,
+			metricsCollector: metricsCollector,
+			logger:           logger,
+		})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statsdListener.Start(ctx)
+		}()
+		logger.Info("StatsD listener enabled",
+			slog.String("address", statsdCfg.Address),
+			slog.Duration("flush_interval", statsdCfg.FlushInterval),
+		)
+	}
 
-	// Start health server
-	healthAddr := cfg.Monitoring.HealthAddress
-	if healthAddr == "" {
-		healthAddr = ":9100" // Default port
+	// Accept metrics pushed by other processes over HTTP, written through the same path as StatsD
+	if cfg.Ingest.Enabled {
+		ingestWriter := &relabelWriter{
+			source:           "ingest",
+			relabeler:        relabeler,
+			next:             writer,
+			metricsCollector: metricsCollector,
+			logger:           logger,
+		}
+		ingestCfg, err := ingestConfigFromConfig(&cfg.Ingest, cfg.Device.ID)
+		if err != nil {
+			// This should never happen since Validate() already checked it
+			logger.Error("Invalid ingest config", slog.Any("error", err))
+			os.Exit(1)
+		}
+		ingestCfg.Logger = logger
+		if cfg.Ingest.ServesHTTP() {
+			handler := ingest.NewHandler(ingestCfg, ingestWriter)
+			for _, path := range ingest.Paths {
+				healthChecker.Handle(path, handler)
+			}
+		}
+		if cfg.Ingest.Socket != "" {
+			// Access to the socket is controlled by its permissions instead of the token
+			socketCfg := ingestCfg
+			socketCfg.AuthToken = ""
+			handler := ingest.NewHandler(socketCfg, ingestWriter)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := ingest.ServeUnix(ctx, cfg.Ingest.Socket, handler); err != nil {
+					logger.Error("Ingest socket error", slog.String("socket", cfg.Ingest.Socket), slog.Any("error", err))
+				}
+			}()
+		}
+		logger.Info("Push ingest enabled",
+			slog.Bool("http", cfg.Ingest.ServesHTTP()),
+			slog.Bool("auth", ingestCfg.AuthToken != ""),
+			slog.String("socket", cfg.Ingest.Socket),
+		)
 	}
+
+	// Start health server, once every endpoint is registered
+	healthAddr := cfg.Monitoring.GetHealthAddress()
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -300,27 +395,29 @@ func main() {
 		}
 	}()
 
-	// Start collection loops
-	for name, coll := range collectors {
-		wg.Add(1)
-		go func(name string, c collector.Collector, interval time.Duration) {
-			defer wg.Done()
-			runCollector(ctx, name, c, interval, store, upload, healthChecker, metricsCollector, logger)
-		}(name, coll.collector, coll.interval)
+	// Start one upload loop per destination (if remote enabled)
+	// Each destination has its own queue, so a slow or failing endpoint never holds back the others.
+	// A legacy single remote.url becomes the "default" destination.
+	// Bandwidth is metered across destinations, since they share the link
+	meter := bandwidth.New(bandwidth.Config{Logger: logger}, store)
+	uploads := newUploadManager(ctx, &wg, store, meter, healthChecker, metricsCollector, logger)
+	defer uploads.stopAll()
+	if err := uploads.apply(cfg); err != nil {
+		logger.Error("Failed to start uploads", slog.Any("error", err))
+		os.Exit(1)
 	}
 
-	// Start upload loop (if remote enabled)
-	if cfg.Remote.Enabled {
-		uploadInterval, err = cfg.Remote.UploadInterval()
-		if err != nil {
-			// This should never happen since Validate() already checked it
-			logger.Error("Invalid upload interval", slog.Any("error", err))
-			os.Exit(1)
-		}
+	// Start collection loops
+	collectors := newCollectorManager(ctx, &wg, writer, relabeler, latest, healthChecker, metricsCollector, logger)
+	collectors.apply(cfg)
+	logger.Info("Collectors initialized", slog.Int("count", collectors.len()))
+
+	// Start write buffer flush loop
+	if buffer != nil {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			runUploadLoop(ctx, store, upload, uploadInterval, cfg.Remote.GetBatchSize(), healthChecker, metricsCollector, logger)
+			runWriteBufferLoop(ctx, buffer, bufferInterval, cfg.Storage.Buffer.MinAvailableBytes(), metricsCollector, logger)
 		}()
 	}
 
@@ -331,6 +428,21 @@ func main() {
 		runStorageMonitoring(ctx, store, healthChecker, metricsCollector, logger)
 	}()
 
+	// Start retention loop (if enabled)
+	if cfg.Storage.Retention.IsEnabled() {
+		retentionPolicy, retentionInterval, err := retentionPolicyFromConfig(&cfg.Storage.Retention)
+		if err != nil {
+			// This should never happen since Validate() already checked it
+			logger.Error("Invalid retention config", slog.Any("error", err))
+			os.Exit(1)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runRetentionLoop(ctx, store, retentionPolicy, retentionInterval, metricsCollector, logger)
+		}()
+	}
+
 	// Start meta-metrics collection loop
 	wg.Add(1)
 	go func() {
@@ -361,11 +473,12 @@ func main() {
 			warnThresholdMs = int64(cfg.Monitoring.ClockSkewWarnThresholdMs)
 		}
 
+		// Pass the startup config in: a reload replaces cfg, and monitoring settings need a restart anyway
 		wg.Add(1)
-		go func() {
+		go func(cfg *config.Config) {
 			defer wg.Done()
-			runClockSkewLoop(ctx, cfg, store, healthChecker, metricsCollector, clockCheckInterval, warnThresholdMs, logger)
-		}()
+			runClockSkewLoop(ctx, cfg, store, clockMonitor, healthChecker, metricsCollector, clockCheckInterval, warnThresholdMs, logger)
+		}(cfg)
 	}
 
 	// Notify systemd that service is ready (required for Type=notify)
@@ -380,8 +493,18 @@ func main() {
 	}
 	logger.Info("All collectors started. Press Ctrl+C to stop.")
 
-	// Wait for shutdown signal
-	<-sigChan
+	// Wait for shutdown signal, reloading the config on SIGHUP
+	for waiting := true; waiting; {
+		select {
+		case <-hupChan:
+			logger.Info("SIGHUP received, reloading configuration", slog.String("path", *configPath))
+			notifySystemd(logger, daemon.SdNotifyReloading)
+			cfg = reloadConfig(*configPath, cfg, collectors, uploads, healthChecker, logger)
+			notifySystemd(logger, daemon.SdNotifyReady)
+		case <-sigChan:
+			waiting = false
+		}
+	}
 	logger.Info("Shutdown signal received, stopping...")
 
 	// Notify systemd we're stopping (send even if watchdog is disabled)
@@ -400,61 +523,124 @@ func main() {
 	// Wait for all goroutines to finish
 	wg.Wait()
 
-	logger.Info("Shutdown complete")
-}
+	// Write the last StatsD interval and close a session still open, then write what the
+	// collectors buffered before they stopped
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if statsdListener != nil {
+		if err := statsdListener.Flush(flushCtx); err != nil {
+			logger.Error("Failed to flush StatsD metrics on shutdown", slog.Any("error", err))
+		}
+	}
+	if sessions != nil {
+		sessions.Close(flushCtx)
+	}
+	if err := meter.Flush(flushCtx); err != nil {
+		logger.Error("Failed to write bandwidth usage on shutdown", slog.Any("error", err))
+	}
+	if buffer != nil {
+		if err := buffer.Flush(flushCtx, storage.FlushReasonShutdown); err != nil {
+			logger.Error("Failed to flush write buffer on shutdown", slog.Any("error", err))
+		}
+	}
+	flushCancel()
 
-type collectorInfo struct {
-	collector collector.Collector
-	interval  time.Duration
+	logger.Info("Shutdown complete")
 }
 
-// initializeCollectors creates and configures all enabled collectors
-func initializeCollectors(cfg *config.Config, logger *slog.Logger) map[string]collectorInfo {
-	collectors := make(map[string]collectorInfo)
-	enabled := cfg.EnabledMetrics()
-
-	for _, mc := range enabled {
-		interval, err := mc.IntervalDuration()
-		if err != nil {
-			logger.Warn("Invalid interval, skipping collector",
-				slog.String("collector", mc.Name),
-				slog.Any("error", err),
-			)
+// validateCollectorOptions checks metrics[].options against each registered collector's schema
+// Unknown metric names are left to the collector manager, which skips them with a warning
+func validateCollectorOptions(cfg *config.Config) error {
+	for _, mc := range cfg.Metrics {
+		reg, ok := collector.Lookup(mc.Name)
+		if !ok {
+			if len(mc.Options) > 0 {
+				return fmt.Errorf("metric %s: options set for unknown collector", mc.Name)
+			}
 			continue
 		}
-
-		var coll collector.Collector
-
-		switch mc.Name {
-		case "cpu.temperature":
-			coll = collector.NewSystemCollector(cfg.Device.ID)
-		case "cpu.usage":
-			coll = collector.NewCPUCollector(cfg.Device.ID)
-		case "memory.usage":
-			coll = collector.NewMemoryCollector(cfg.Device.ID)
-		case "disk.io":
-			coll = collector.NewDiskCollector(cfg.Device.ID)
-		case "network.traffic":
-			coll = collector.NewNetworkCollector(cfg.Device.ID)
-		case "srt.packet_loss":
-			coll = collector.NewMockSRTCollector(cfg.Device.ID)
-		default:
-			logger.Warn("Unknown metric, skipping", slog.String("collector", mc.Name))
-			continue
+		if _, err := reg.ParseOptions(mc.Options); err != nil {
+			return fmt.Errorf("metric %s: %w", mc.Name, err)
 		}
+	}
+	return nil
+}
 
-		collectors[mc.Name] = collectorInfo{
-			collector: coll,
-			interval:  interval,
-		}
+// relabelConfigFromConfig converts the relabel config block into a relabel stage configuration
+func relabelConfigFromConfig(rc *config.RelabelConfig) relabel.Config {
+	cfg := relabel.Config{MaxSeriesPerMetric: rc.MaxSeriesPerMetric}
+	for _, rule := range rc.Rules {
+		cfg.Rules = append(cfg.Rules, relabel.Rule{
+			Action:       rule.Action,
+			SourceLabels: rule.SourceLabels,
+			Separator:    rule.Separator,
+			Regex:        rule.Regex,
+			TargetLabel:  rule.TargetLabel,
+			Replacement:  rule.Replacement,
+			Modulus:      rule.Modulus,
+		})
+	}
+	return cfg
+}
 
-		logger.Info("Registered collector",
-			slog.String("collector", mc.Name),
-			slog.Duration("interval", interval),
-		)
+// sessionConfigFromConfig converts the sessions config block into a session manager configuration
+func sessionConfigFromConfig(sc *config.SessionsConfig, deviceID string) (session.Config, error) {
+	checkInterval, err := sc.CheckInterval()
+	if err != nil {
+		return session.Config{}, err
+	}
+	closeAfter, err := sc.CloseAfter()
+	if err != nil {
+		return session.Config{}, err
+	}
+	cfg := session.Config{
+		CheckInterval:     checkInterval,
+		CloseAfter:        closeAfter,
+		PrioritizeUploads: sc.ShouldPrioritizeUploads(),
+		DeviceID:          deviceID,
+	}
+	for _, t := range sc.Triggers {
+		cfg.Triggers = append(cfg.Triggers, session.Trigger{
+			Process: t.Process,
+			Unit:    t.Unit,
+			Metric:  t.Metric,
+			Above:   t.Above,
+			Below:   t.Below,
+		})
 	}
+	return cfg, nil
+}
+
+// statsdConfigFromConfig converts the statsd config block into a listener configuration
+func statsdConfigFromConfig(sc *config.StatsDConfig, deviceID string) (statsd.Config, error) {
+	flushInterval, err := sc.FlushInterval()
+	if err != nil {
+		return statsd.Config{}, err
+	}
+	idleTimeout, err := sc.IdleTimeout()
+	if err != nil {
+		return statsd.Config{}, err
+	}
+	return statsd.Config{
+		Address:       sc.GetAddress(),
+		FlushInterval: flushInterval,
+		MaxSeries:     sc.GetMaxSeries(),
+		IdleTimeout:   idleTimeout,
+		DeviceID:      deviceID,
+	}, nil
+}
 
-	return collectors
+// ingestConfigFromConfig converts the ingest config block into a push handler configuration
+func ingestConfigFromConfig(ic *config.IngestConfig, deviceID string) (ingest.Config, error) {
+	priority, err := ic.GetPriority()
+	if err != nil {
+		return ingest.Config{}, err
+	}
+	return ingest.Config{
+		DeviceID:   deviceID,
+		AuthToken:  ic.AuthToken,
+		MaxMetrics: ic.GetMaxMetrics(),
+		Priority:   priority,
+	}, nil
 }
 
 // runCollector runs a single collector in a loop
@@ -463,34 +649,96 @@ func runCollector(
 	name string,
 	coll collector.Collector,
 	interval time.Duration,
-	store *storage.SQLiteStorage,
-	upload uploader.Uploader,
+	priority models.Priority,
+	relabeler *relabel.Relabeler,
+	store storage.BatchWriter,
+	latest *exposition.Latest,
 	healthChecker *health.Checker,
 	metricsCollector *monitoring.MetricsCollector,
 	logger *slog.Logger,
 ) {
+	// Streaming collectors gather in the background between ticks
+	if s, ok := coll.(collector.Streamer); ok {
+		var streamWG sync.WaitGroup
+		streamWG.Add(1)
+		go func() {
+			defer streamWG.Done()
+			s.Start(ctx)
+		}()
+		defer streamWG.Wait()
+	}
+
+	// Collectors with several sources report each one as its own health component
+	var sources *sourceHealth
+	if r, ok := coll.(collector.SourceReporter); ok && healthChecker != nil {
+		sources = &sourceHealth{collector: name, reporter: r, checker: healthChecker, reported: make(map[string]bool)}
+		defer sources.clear()
+	}
+
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	// Collect immediately on start
-	collectAndStore(ctx, name, coll, store, healthChecker, metricsCollector, logger)
+	collectAndStore(ctx, name, coll, priority, relabeler, store, latest, healthChecker, metricsCollector, logger)
+	sources.update()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			collectAndStore(ctx, name, coll, store, healthChecker, metricsCollector, logger)
+			collectAndStore(ctx, name, coll, priority, relabeler, store, latest, healthChecker, metricsCollector, logger)
+			sources.update()
+		}
+	}
+}
+
+// sourceHealth reports the sources of a collector as "collector.<name>/<source>" components
+type sourceHealth struct {
+	collector string
+	reporter  collector.SourceReporter
+	checker   *health.Checker
+	reported  map[string]bool // Components reported by the last update
+}
+
+// update reports the sources of the last Collect and removes the ones that went away
+func (s *sourceHealth) update() {
+	if s == nil {
+		return
+	}
+	current := make(map[string]bool)
+	for _, src := range s.reporter.Sources() {
+		component := s.collector + "/" + src.Name
+		s.checker.UpdateCollectorStatus(component, src.Err, src.Metrics)
+		current[component] = true
+	}
+	for component := range s.reported {
+		if !current[component] {
+			s.checker.RemoveComponent("collector." + component)
 		}
 	}
+	s.reported = current
+}
+
+// clear removes every reported source, when the collector stops
+func (s *sourceHealth) clear() {
+	for component := range s.reported {
+		s.checker.RemoveComponent("collector." + component)
+	}
+	s.reported = nil
 }
 
-// collectAndStore collects metrics and stores them
+// collectAndStore collects metrics, relabels them and stores the ones that are kept
+// A configured priority class applies to every collected metric; relabel rules may override it.
+// relabeler may be nil to store everything
 func collectAndStore(
 	ctx context.Context,
 	name string,
 	coll collector.Collector,
-	store *storage.SQLiteStorage,
+	priority models.Priority,
+	relabeler *relabel.Relabeler,
+	store storage.BatchWriter,
+	latest *exposition.Latest,
 	healthChecker *health.Checker,
 	metricsCollector *monitoring.MetricsCollector,
 	logger *slog.Logger,
@@ -525,6 +773,26 @@ func collectAndStore(
 		return
 	}
 
+	if priority != models.PriorityDefault {
+		for _, m := range metrics {
+			m.Priority = priority
+		}
+	}
+
+	// Relabel before storage so dropped series never reach the SD card
+	metrics = applyRelabel(name, relabeler, metrics, metricsCollector, logger)
+	if len(metrics) == 0 {
+		if healthChecker != nil {
+			healthChecker.UpdateCollectorStatus(name, nil, 0)
+		}
+		return
+	}
+
+	// Expose the new samples locally even if storing them fails below
+	if latest != nil {
+		latest.Observe(metrics)
+	}
+
 	// Attempt to store metrics
 	storageStartTime := time.Now()
 	if err := store.StoreBatch(ctx, metrics); err != nil {
@@ -559,13 +827,196 @@ func collectAndStore(
 	)
 }
 
-// runUploadLoop periodically uploads metrics to remote endpoint
+// applyRelabel runs the relabel stage on metrics from source and records what it dropped
+func applyRelabel(
+	source string,
+	relabeler *relabel.Relabeler,
+	metrics []*models.Metric,
+	metricsCollector *monitoring.MetricsCollector,
+	logger *slog.Logger,
+) []*models.Metric {
+	metrics, dropped := relabeler.Apply(metrics)
+	for reason, count := range dropped {
+		if metricsCollector != nil {
+			metricsCollector.RecordRelabelDrop(source, reason, count)
+		}
+		logger.Debug("Relabel dropped metrics",
+			slog.String("collector", source),
+			slog.String("reason", reason),
+			slog.Int("count", count),
+		)
+	}
+	return metrics
+}
+
+// relabelWriter runs the relabel stage on metrics pushed by local applications before they are
+// stored, as collectAndStore does for collected metrics. Drops are reported under source.
+type relabelWriter struct {
+	source           string
+	relabeler        *relabel.Relabeler
+	next             storage.BatchWriter
+	metricsCollector *monitoring.MetricsCollector
+	logger           *slog.Logger
+}
+
+// StoreBatch relabels metrics and stores the ones that are kept
+func (w *relabelWriter) StoreBatch(ctx context.Context, metrics []*models.Metric) error {
+	metrics = applyRelabel(w.source, w.relabeler, metrics, w.metricsCollector, w.logger)
+	if len(metrics) == 0 {
+		return nil
+	}
+	return w.next.StoreBatch(ctx, metrics)
+}
+
+// resolveDeviceID fills in device.id from device.id_source when no explicit ID is configured
+func resolveDeviceID(cfg *config.Config) error {
+	if cfg.Device.ID != "" {
+		return nil
+	}
+	id, err := identity.Resolve(cfg.Device.IDSource)
+	if err != nil {
+		return fmt.Errorf("failed to derive device.id: %w", err)
+	}
+	cfg.Device.ID = id
+	return nil
+}
+
+// newDestinationUploader builds an HTTP uploader from a destination's settings
+// meter paces and accounts the bytes it sends (nil = unmetered).
+func newDestinationUploader(d config.DestinationConfig, device config.DeviceConfig, meter uploader.Meter, logger *slog.Logger) (*uploader.HTTPUploader, error) {
+	uploaderCfg := uploader.HTTPUploaderConfig{
+		URL:       d.URL,
+		Protocol:  d.Protocol,
+		DeviceID:  device.ID,
+		Labels:    device.Labels,
+		AuthToken: d.AuthToken,
+		ProbeURL:  d.ProbeURL,
+		Meter:     meter,
+		// Set timeout explicitly to avoid default logic
+		Timeout: 30 * time.Second,
+	}
+
+	// Apply retry configuration only if explicitly configured
+	// Check if retry block is configured at all (Enabled field set OR any numeric field non-zero)
+	retryConfigured := d.Retry.IsConfigured()
+
+	if retryConfigured {
+		// Retry block is configured - honor the enabled flag
+		// Default to true if Enabled is nil but other fields are set
+		enabled := d.Retry.Enabled == nil || *d.Retry.Enabled
+		if enabled {
+			// Use configured retry values, applying defaults for unset fields
+			maxAttempts := d.Retry.MaxAttempts
+			if maxAttempts == 0 {
+				// User enabled retries but didn't set max_attempts - use default
+				maxAttempts = 3
+			}
+			// Convert max_attempts (total attempts) to maxRetries (number of retries)
+			// max_attempts=1 → maxRetries=0 (1 attempt, no retries)
+			// max_attempts=3 → maxRetries=2 (3 attempts = initial + 2 retries)
+			maxRetries := maxAttempts - 1
+			if maxRetries < 0 {
+				maxRetries = 0
+			}
+			uploaderCfg.MaxRetries = &maxRetries
+
+			retryDelay, err := d.Retry.InitialBackoff()
+			if err != nil {
+				return nil, fmt.Errorf("invalid retry initial_backoff: %w", err)
+			}
+			maxBackoff, err := d.Retry.MaxBackoff()
+			if err != nil {
+				return nil, fmt.Errorf("invalid retry max_backoff: %w", err)
+			}
+			uploaderCfg.RetryDelay = retryDelay
+			uploaderCfg.MaxBackoff = maxBackoff
+			uploaderCfg.BackoffMultiplier = d.Retry.BackoffMultiplier
+
+			// JitterPercent: nil means use default (20), otherwise honor the value (even if 0)
+			if d.Retry.JitterPercent != nil {
+				// User explicitly set jitter_percent - honor it (even if 0)
+				uploaderCfg.JitterPercent = d.Retry.JitterPercent
+			} else {
+				// User enabled retries but didn't set jitter_percent - use default
+				// Critical: Without jitter, all instances retry in lockstep (thundering herd)
+				jitter := 20
+				uploaderCfg.JitterPercent = &jitter
+			}
+		} else {
+			// Explicitly disabled - set MaxRetries=0 (means 1 attempt, no retries)
+			zero := 0
+			uploaderCfg.MaxRetries = &zero
+			uploaderCfg.RetryDelay = 1 * time.Second
+			uploaderCfg.JitterPercent = &zero
+		}
+	}
+	// Otherwise: retry block not configured at all
+	// Leave MaxRetries and JitterPercent as nil (uploader will use defaults)
+
+	// Apply chunk size and parallelism configuration
+	uploaderCfg.ChunkSize = d.ChunkSize
+	uploaderCfg.Concurrency = d.Concurrency
+	if uploaderCfg.Protocol == uploader.ProtocolPrometheusRemoteWrite && uploaderCfg.Concurrency > 1 {
+		logger.Warn("Ignoring concurrency for remote_write, chunks are sent one at a time to keep samples in order",
+			slog.String("destination", d.Name),
+			slog.Int("concurrency", uploaderCfg.Concurrency),
+		)
+		uploaderCfg.Concurrency = 1
+	}
+
+	upload := uploader.NewHTTPUploaderWithConfig(uploaderCfg)
+
+	// Log uploader config
+	if retryConfigured {
+		maxRetries := 3 // default
+		if uploaderCfg.MaxRetries != nil {
+			maxRetries = *uploaderCfg.MaxRetries
+		}
+		jitterPercent := 20 // default
+		if uploaderCfg.JitterPercent != nil {
+			jitterPercent = *uploaderCfg.JitterPercent
+		}
+		logger.Info("Uploader initialized",
+			slog.String("destination", d.Name),
+			slog.String("url", d.URL),
+			slog.String("protocol", uploaderCfg.Protocol),
+			slog.Int("chunk_size", uploaderCfg.ChunkSize),
+			slog.Int("concurrency", uploaderCfg.Concurrency),
+			slog.Int("max_retries", maxRetries),
+			slog.Duration("retry_delay", uploaderCfg.RetryDelay),
+			slog.Duration("max_backoff", uploaderCfg.MaxBackoff),
+			slog.Float64("backoff_multiplier", uploaderCfg.BackoffMultiplier),
+			slog.Int("jitter_percent", jitterPercent),
+			slog.Bool("retry_configured", true),
+		)
+	} else {
+		logger.Info("Uploader initialized",
+			slog.String("destination", d.Name),
+			slog.String("url", d.URL),
+			slog.String("protocol", uploaderCfg.Protocol),
+			slog.Int("chunk_size", uploaderCfg.ChunkSize),
+			slog.Int("concurrency", uploaderCfg.Concurrency),
+			slog.String("retry_config", "using defaults (3 retries, 1s initial, 30s max, 2.0x multiplier, 20% jitter)"),
+		)
+	}
+
+	return upload, nil
+}
+
+// runUploadLoop periodically uploads metrics to a remote destination
+// With a circuit breaker, cycles are skipped while it is open and the batch size ramps back up
+// after an outage. While half-open, the uploader's probe URL is checked before any rows are read.
+// With a bandwidth meter, cycles are skipped while a budget is used up and only priority classes
+// are sent over interfaces with the priority policy; paused cycles do not count as failures.
 func runUploadLoop(
 	ctx context.Context,
 	store *storage.SQLiteStorage,
+	destination string,
 	upload uploader.Uploader,
 	interval time.Duration,
 	batchSize int,
+	breaker *uploader.Breaker,
+	meter *bandwidth.Meter,
 	healthChecker *health.Checker,
 	metricsCollector *monitoring.MetricsCollector,
 	logger *slog.Logger,
@@ -574,59 +1025,231 @@ func runUploadLoop(
 	defer ticker.Stop()
 
 	logger.Info("Upload loop started",
+		slog.String("destination", destination),
 		slog.Duration("interval", interval),
 		slog.Int("batch_size", batchSize),
+		slog.Bool("circuit_breaker", breaker != nil),
 	)
 
+	if breaker != nil {
+		breaker.OnStateChange(func(from, to uploader.BreakerState) {
+			logger.Warn("Upload circuit breaker changed state",
+				slog.String("destination", destination),
+				slog.String("from", string(from)),
+				slog.String("to", string(to)),
+			)
+		})
+	}
+
 	lastUploadTime := time.Now()
 	var lastUploadErr error
+	paused := false
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			startTime := time.Now()
-			count, err := uploadMetrics(ctx, store, upload, batchSize, logger)
-			duration := time.Since(startTime)
+			decision := bandwidth.Decision{MinPriority: models.PriorityP3}
+			if meter != nil {
+				var err error
+				decision, err = meter.Check(ctx)
+				if err != nil {
+					logger.Warn("Failed to check bandwidth usage",
+						slog.String("destination", destination),
+						slog.Any("error", err),
+					)
+				}
+				updateBandwidthStatus(meter, healthChecker, metricsCollector)
+				if decision.Paused != paused {
+					if decision.Paused {
+						logger.Warn("Uploads paused by bandwidth budget",
+							slog.String("destination", destination),
+							slog.String("interface", decision.Interface),
+							slog.String("reason", decision.Reason),
+						)
+					} else {
+						logger.Info("Uploads resumed within bandwidth budget",
+							slog.String("destination", destination),
+							slog.String("interface", decision.Interface),
+						)
+					}
+					paused = decision.Paused
+				}
+			}
 
-			if err == nil {
-				lastUploadTime = time.Now()
-				lastUploadErr = nil
-				if metricsCollector != nil && count > 0 {
-					metricsCollector.RecordUploadSuccess(count, duration)
+			// Offline: skip the query and chunk encoding until the next probe
+			// Over budget: skip without touching the breaker, nothing failed
+			if !decision.Paused && (breaker == nil || breaker.Allow()) {
+				size := batchSize
+				if breaker != nil {
+					size = breaker.BatchSize(batchSize)
 				}
-			} else {
-				lastUploadErr = err
-				if metricsCollector != nil {
-					metricsCollector.RecordUploadFailure()
+
+				startTime := time.Now()
+				var count int
+				var err error
+				if httpUploader, ok := upload.(*uploader.HTTPUploader); ok && breaker != nil && breaker.State() == uploader.BreakerHalfOpen {
+					err = httpUploader.Probe(ctx)
 				}
+				if err == nil {
+					count, err = uploadMetrics(ctx, store, destination, upload, size, decision.MinPriority, metricsCollector, logger)
+				}
+				duration := time.Since(startTime)
+
+				if err == nil {
+					lastUploadTime = time.Now()
+					lastUploadErr = nil
+					if metricsCollector != nil && count > 0 {
+						metricsCollector.RecordUploadSuccess(count, duration)
+					}
+				} else {
+					lastUploadErr = err
+					if metricsCollector != nil {
+						metricsCollector.RecordUploadFailure()
+					}
+				}
+
+				if breaker != nil {
+					if err == nil {
+						breaker.Success()
+					} else {
+						breaker.Failure()
+					}
+				}
+			}
+
+			if breaker != nil && metricsCollector != nil {
+				metricsCollector.UpdateBreakerState(destination, breaker.State().Value(), breaker.Opens())
 			}
 
 			// Update health status
+			// The default destination keeps the legacy "uploader" component name
 			if healthChecker != nil {
-				pendingCount, _ := store.GetPendingCount(ctx)
-				healthChecker.UpdateUploaderStatus(lastUploadTime, lastUploadErr, pendingCount)
+				pendingCount, _ := store.GetPendingCountFor(ctx, destination)
+				if destination == storage.DefaultDestination {
+					healthChecker.UpdateUploaderStatus(lastUploadTime, lastUploadErr, pendingCount)
+				} else {
+					healthChecker.UpdateDestinationStatus(destination, lastUploadTime, lastUploadErr, pendingCount)
+				}
+				if breaker != nil {
+					healthChecker.SetBreakerStatus(destinationComponent(destination), health.BreakerStatus{
+						State:     string(breaker.State()),
+						Failures:  breaker.Failures(),
+						NextProbe: breaker.NextProbe(),
+					})
+				}
+			}
+		}
+	}
+}
+
+// updateBandwidthStatus reports the meter's policy and usage to health and meta-metrics
+func updateBandwidthStatus(meter *bandwidth.Meter, healthChecker *health.Checker, metricsCollector *monitoring.MetricsCollector) {
+	st := meter.Status()
+	today := make(map[string]int64, len(st.Interfaces))
+	month := make(map[string]int64, len(st.Interfaces))
+	for iface, u := range st.Interfaces {
+		today[iface] = u.Today
+		month[iface] = u.Month
+	}
+
+	if healthChecker != nil {
+		healthChecker.UpdateBandwidthStatus(health.BandwidthStatus{
+			Interface:        st.Interface,
+			Policy:           string(st.Policy),
+			MinPriority:      string(st.MinPriority),
+			Paused:           st.Paused,
+			Reason:           st.Reason,
+			TodayBytes:       st.Today,
+			MonthBytes:       st.Month,
+			DailyBudget:      st.DailyBudget,
+			MonthlyBudget:    st.MonthlyBudget,
+			TodayByInterface: today,
+			MonthByInterface: month,
+		})
+	}
+
+	if metricsCollector != nil {
+		remaining := make(map[string]int64)
+		if st.DailyBudget > 0 {
+			remaining["daily"] = max(st.DailyBudget-st.Today, 0)
+		}
+		if st.MonthlyBudget > 0 {
+			remaining["monthly"] = max(st.MonthlyBudget-st.Month, 0)
+		}
+		metricsCollector.UpdateBandwidth(monitoring.BandwidthMetrics{
+			Today:     today,
+			Month:     month,
+			Remaining: remaining,
+			Paused:    st.Paused,
+		})
+	}
+}
+
+// bandwidthConfigFromConfig maps the bandwidth config to the bandwidth package
+func bandwidthConfigFromConfig(bc *config.BandwidthConfig) (bandwidth.Config, error) {
+	cfg := bandwidth.Config{
+		DailyBudget:   bc.DailyBudgetBytes(),
+		MonthlyBudget: bc.MonthlyBudgetBytes(),
+		RateLimit:     int64(bc.RateLimitBytesPerSec),
+	}
+	for _, i := range bc.Interfaces {
+		rule := bandwidth.Rule{Match: i.Match, Policy: bandwidth.Policy(i.Policy)}
+		if rule.Policy == bandwidth.PolicyPriority {
+			minPriority, err := i.GetMinPriority()
+			if err != nil {
+				return bandwidth.Config{}, err
 			}
+			rule.MinPriority = minPriority
 		}
+		cfg.Rules = append(cfg.Rules, rule)
+	}
+	return cfg, nil
+}
+
+// breakerConfigFromConfig maps the circuit breaker config to the uploader package (nil = disabled)
+func breakerConfigFromConfig(bc *config.CircuitBreakerConfig) (*uploader.BreakerConfig, error) {
+	if !bc.IsEnabled() {
+		return nil, nil
+	}
+	openTimeout, err := bc.OpenTimeout()
+	if err != nil {
+		return nil, err
+	}
+	maxOpenTimeout, err := bc.MaxOpenTimeout()
+	if err != nil {
+		return nil, err
 	}
+	return &uploader.BreakerConfig{
+		FailureThreshold: bc.GetFailureThreshold(),
+		OpenTimeout:      openTimeout,
+		MaxOpenTimeout:   maxOpenTimeout,
+	}, nil
 }
 
-// uploadMetrics queries unuploaded metrics and uploads them
+// uploadMetrics queries metrics queued for a destination and uploads them
+// Only rows of minPriority or a higher class are sent (P3 = everything).
 // Returns the number of metrics actually sent to VictoriaMetrics (numeric only) and any error
 // Note: String metrics are processed and marked as uploaded but not counted in the return value
 func uploadMetrics(
 	ctx context.Context,
 	store *storage.SQLiteStorage,
+	destination string,
 	upload uploader.Uploader,
 	batchSize int,
+	minPriority models.Priority,
+	metricsCollector *monitoring.MetricsCollector,
 	logger *slog.Logger,
 ) (int, error) {
-	// Query unuploaded metrics (limit to configured batch size)
-	metrics, err := store.QueryUnuploaded(ctx, batchSize)
+	// Query metrics queued for this destination (limit to configured batch size)
+	metrics, err := store.QueryUnuploadedAtLeast(ctx, destination, minPriority, batchSize)
 
 	if err != nil {
-		logger.Error("Failed to query unuploaded metrics", slog.Any("error", err))
+		logger.Error("Failed to query unuploaded metrics",
+			slog.String("destination", destination),
+			slog.Any("error", err),
+		)
 		return 0, err
 	}
 
@@ -634,47 +1257,38 @@ func uploadMetrics(
 		return 0, nil
 	}
 
-	// Upload metrics and collect IDs of metrics actually sent to VictoriaMetrics
-	var uploadedIDs []int64
-
-	// Try to use UploadAndGetIDs if available (for HTTPUploader)
+	// HTTPUploader checkpoints and marks every chunk as soon as it uploads
 	if httpUploader, ok := upload.(*uploader.HTTPUploader); ok {
-		var err error
-		uploadedIDs, err = httpUploader.UploadAndGetIDs(ctx, metrics)
-		if err != nil {
-			logger.Error("Upload failed",
-				slog.Int("count", len(metrics)),
-				slog.Any("error", err),
-			)
-			return 0, err
-		}
-	} else {
-		// Fallback for other uploaders (e.g., mocks): upload and extract IDs manually
-		if err := upload.Upload(ctx, metrics); err != nil {
-			logger.Error("Upload failed",
-				slog.Int("count", len(metrics)),
-				slog.Any("error", err),
-			)
-			return 0, err
-		}
+		return uploadWithCheckpoints(ctx, store, destination, httpUploader, metrics, metricsCollector, logger)
+	}
 
-		// Extract IDs from all metrics in the batch (already filtered to numeric only by QueryUnuploaded)
-		for _, m := range metrics {
-			if idStr, ok := m.Tags["_storage_id"]; ok {
-				var id int64
-				if _, err := fmt.Sscanf(idStr, "%d", &id); err == nil {
-					uploadedIDs = append(uploadedIDs, id)
-				}
+	// Fallback for other uploaders (e.g., mocks): upload and extract IDs manually
+	if err := upload.Upload(ctx, metrics); err != nil {
+		logger.Error("Upload failed",
+			slog.String("destination", destination),
+			slog.Int("count", len(metrics)),
+			slog.Any("error", err),
+		)
+		return 0, err
+	}
+
+	// Extract IDs from all metrics in the batch (already filtered to numeric only by QueryUnuploadedFor)
+	var uploadedIDs []int64
+	for _, m := range metrics {
+		if idStr, ok := m.Tags["_storage_id"]; ok {
+			var id int64
+			if _, err := fmt.Sscanf(idStr, "%d", &id); err == nil {
+				uploadedIDs = append(uploadedIDs, id)
 			}
 		}
 	}
 
 	// Mark only the metrics that were actually uploaded (numeric metrics only)
-	// String metrics never enter this function because QueryUnuploaded filters them out
-	// They remain in SQLite with uploaded=0 for local event processing
+	// String metrics are never queued, so they remain in SQLite with uploaded=0 for local event processing
 	if len(uploadedIDs) > 0 {
-		if err := store.MarkUploaded(ctx, uploadedIDs); err != nil {
+		if err := store.MarkUploadedFor(ctx, destination, uploadedIDs); err != nil {
 			logger.Warn("Failed to mark metrics as uploaded",
+				slog.String("destination", destination),
 				slog.Int("count", len(uploadedIDs)),
 				slog.Any("error", err),
 			)
@@ -683,6 +1297,7 @@ func uploadMetrics(
 	}
 
 	logger.Info("Upload completed",
+		slog.String("destination", destination),
 		slog.Int("count", len(uploadedIDs)),
 	)
 
@@ -691,6 +1306,125 @@ func uploadMetrics(
 	return len(uploadedIDs), nil
 }
 
+// uploadWithCheckpoints uploads one cycle's metrics as a checkpointed batch
+// Each chunk is recorded in upload_checkpoints and marked uploaded as soon as it succeeds, so a
+// failed chunk only leaves itself and the chunks after it queued. The next cycle queries the queue
+// again and records its chunks under the same batch ID, numbered after the recorded ones.
+// A chunk the receiver rejected for good is dropped from the queue and counted instead of retried,
+// and does not fail the cycle on its own.
+// Returns the number of metrics uploaded and marked, even when a later chunk failed.
+func uploadWithCheckpoints(
+	ctx context.Context,
+	store *storage.SQLiteStorage,
+	destination string,
+	upload *uploader.HTTPUploader,
+	metrics []*models.Metric,
+	metricsCollector *monitoring.MetricsCollector,
+	logger *slog.Logger,
+) (int, error) {
+	checkpoint, err := store.ContinueBatch(ctx, destination, time.Now())
+	if err != nil {
+		logger.Error("Failed to read upload checkpoint",
+			slog.String("destination", destination),
+			slog.Any("error", err),
+		)
+		return 0, err
+	}
+
+	var mu sync.Mutex
+	uploaded := 0
+	failed := false
+	_, uploadErr := upload.UploadChunks(ctx, metrics, func(index int, ids []int64, err error) {
+		chunkIndex := checkpoint.NextChunk + index
+		if uploader.IsRejected(err) {
+			// Sending the chunk again would only be rejected again and block everything queued behind it
+			logger.Warn("Receiver rejected chunk, dropping it",
+				slog.String("destination", destination),
+				slog.String("batch_id", checkpoint.BatchID),
+				slog.Int("chunk", chunkIndex),
+				slog.Int("count", len(ids)),
+				slog.Any("error", err),
+			)
+			if err := store.DropChunk(ctx, destination, checkpoint.BatchID, chunkIndex, ids, time.Now()); err != nil {
+				logger.Warn("Failed to drop rejected chunk",
+					slog.String("destination", destination),
+					slog.String("batch_id", checkpoint.BatchID),
+					slog.Int("chunk", chunkIndex),
+					slog.Any("error", err),
+				)
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+				return
+			}
+			if metricsCollector != nil {
+				metricsCollector.RecordUploadRejected(destination, len(ids))
+			}
+			return
+		}
+		if err != nil {
+			mu.Lock()
+			failed = true
+			mu.Unlock()
+			if err := store.RecordChunkFailure(ctx, checkpoint.BatchID, chunkIndex, len(ids), time.Now()); err != nil {
+				logger.Warn("Failed to record failed chunk",
+					slog.String("destination", destination),
+					slog.String("batch_id", checkpoint.BatchID),
+					slog.Int("chunk", chunkIndex),
+					slog.Any("error", err),
+				)
+			}
+			return
+		}
+		if err := store.RecordChunk(ctx, destination, checkpoint.BatchID, chunkIndex, ids, time.Now()); err != nil {
+			// The chunk was sent but stays queued, so the next cycle sends it again
+			logger.Warn("Failed to mark uploaded chunk",
+				slog.String("destination", destination),
+				slog.String("batch_id", checkpoint.BatchID),
+				slog.Int("chunk", chunkIndex),
+				slog.Int("count", len(ids)),
+				slog.Any("error", err),
+			)
+			return
+		}
+		mu.Lock()
+		uploaded += len(ids)
+		mu.Unlock()
+	})
+
+	// Chunks skipped after a cancelled context were never reported, so they still count as a failure
+	if uploadErr != nil && (failed || ctx.Err() != nil) {
+		logger.Error("Upload failed",
+			slog.String("destination", destination),
+			slog.String("batch_id", checkpoint.BatchID),
+			slog.Int("count", len(metrics)),
+			slog.Int("uploaded", uploaded),
+			slog.Any("error", uploadErr),
+		)
+		return uploaded, uploadErr
+	}
+
+	if checkpoint.Continued {
+		if err := store.CompleteBatch(ctx, checkpoint.BatchID); err != nil {
+			logger.Warn("Failed to complete upload batch",
+				slog.String("destination", destination),
+				slog.String("batch_id", checkpoint.BatchID),
+				slog.Any("error", err),
+			)
+		}
+	}
+
+	logger.Info("Upload completed",
+		slog.String("destination", destination),
+		slog.String("batch_id", checkpoint.BatchID),
+		slog.Bool("continued", checkpoint.Continued),
+		slog.Int("count", uploaded),
+	)
+
+	// Only numeric metrics are sent, so meta-metrics count exactly what was uploaded
+	return uploaded, nil
+}
+
 // runStorageMonitoring periodically updates storage health metrics
 func runStorageMonitoring(
 	ctx context.Context,
@@ -735,15 +1469,20 @@ func updateStorageHealth(
 		walSize = 0
 	}
 
-	pendingCount, err := store.GetPendingCount(ctx)
+	byPriority, err := store.GetPendingCountByPriority(ctx)
 	if err != nil {
 		logger.Error("Failed to get pending count", slog.Any("error", err))
-		pendingCount = 0
+	}
+	var pendingCount int64
+	pendingByPriority := make(map[string]int64, len(models.Priorities))
+	for _, p := range models.Priorities {
+		pendingByPriority[string(p)] = byPriority[p]
+		pendingCount += byPriority[p]
 	}
 
 	// Update health checker
 	if healthChecker != nil {
-		healthChecker.UpdateStorageStatus(dbSize, walSize, pendingCount)
+		healthChecker.UpdateStorageStatusByPriority(dbSize, walSize, pendingByPriority)
 	}
 
 	// Update meta-metrics collector
@@ -752,6 +1491,192 @@ func updateStorageHealth(
 	}
 }
 
+// bufferFlushRecorder records write buffer flushes in meta-metrics and logs failures
+func bufferFlushRecorder(metricsCollector *monitoring.MetricsCollector, logger *slog.Logger) func(storage.FlushResult) {
+	return func(r storage.FlushResult) {
+		metricsCollector.RecordBufferFlush(r.Reason, r.Duration, r.Dropped, r.Err)
+		if r.Err != nil {
+			logger.Error("Write buffer flush failed",
+				slog.String("reason", r.Reason),
+				slog.Int("count", r.Count),
+				slog.Int("dropped", r.Dropped),
+				slog.Any("error", r.Err),
+			)
+			return
+		}
+		logger.Debug("Write buffer flushed",
+			slog.String("reason", r.Reason),
+			slog.Int("count", r.Count),
+			slog.Int64("duration_ms", r.Duration.Milliseconds()),
+		)
+	}
+}
+
+// runWriteBufferLoop flushes the write buffer every interval, and early when available memory drops below minAvailable
+// The final flush happens in main once the collectors have stopped.
+func runWriteBufferLoop(
+	ctx context.Context,
+	buffer *storage.WriteBuffer,
+	interval time.Duration,
+	minAvailable uint64,
+	metricsCollector *monitoring.MetricsCollector,
+	logger *slog.Logger,
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Memory is checked (and the depth sampled) more often than the buffer is flushed
+	pressureTicker := time.NewTicker(time.Second)
+	defer pressureTicker.Stop()
+
+	logger.Info("Write buffer loop started",
+		slog.Duration("interval", interval),
+		slog.Uint64("min_available_mb", minAvailable/(1024*1024)),
+	)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Errors are logged by the flush recorder; the metrics stay buffered for the next tick
+			_ = buffer.Flush(ctx, storage.FlushReasonInterval)
+		case <-pressureTicker.C:
+			depth := buffer.Len()
+			metricsCollector.UpdateBufferDepth(depth)
+			if depth == 0 {
+				continue
+			}
+			available, err := collector.AvailableMemory()
+			if err != nil || available >= minAvailable {
+				continue
+			}
+			logger.Warn("Low memory, flushing write buffer",
+				slog.Uint64("available_mb", available/(1024*1024)),
+				slog.Int("buffered", depth),
+			)
+			_ = buffer.Flush(ctx, storage.FlushReasonMemoryPressure)
+		}
+	}
+}
+
+// retentionPolicyFromConfig converts the retention config block into a storage policy and check interval
+func retentionPolicyFromConfig(rc *config.RetentionConfig) (storage.RetentionPolicy, time.Duration, error) {
+	uploadedMaxAge, err := rc.UploadedMaxAge()
+	if err != nil {
+		return storage.RetentionPolicy{}, 0, err
+	}
+	pendingMaxAge, err := rc.PendingMaxAge()
+	if err != nil {
+		return storage.RetentionPolicy{}, 0, err
+	}
+	interval, err := rc.CheckInterval()
+	if err != nil {
+		return storage.RetentionPolicy{}, 0, err
+	}
+	policy := storage.RetentionPolicy{
+		UploadedMaxAge:   uploadedMaxAge,
+		PendingMaxAge:    pendingMaxAge,
+		MaxSizeBytes:     rc.MaxSizeBytes(),
+		CheckpointMaxAge: storage.DefaultCheckpointMaxAge,
+	}
+	if rc.Rollup.Enabled {
+		after, err := rc.Rollup.After()
+		if err != nil {
+			return storage.RetentionPolicy{}, 0, err
+		}
+		resolution, err := rc.Rollup.Resolution()
+		if err != nil {
+			return storage.RetentionPolicy{}, 0, err
+		}
+		policy.Rollup = storage.RollupPolicy{MinAge: after, Resolution: resolution}
+	}
+	return policy, interval, nil
+}
+
+// runRetentionLoop periodically evicts expired rows and enforces the database size cap
+func runRetentionLoop(
+	ctx context.Context,
+	store *storage.SQLiteStorage,
+	policy storage.RetentionPolicy,
+	interval time.Duration,
+	metricsCollector *monitoring.MetricsCollector,
+	logger *slog.Logger,
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logger.Info("Retention loop started",
+		slog.Duration("interval", interval),
+		slog.Duration("uploaded_max_age", policy.UploadedMaxAge),
+		slog.Duration("pending_max_age", policy.PendingMaxAge),
+		slog.Int64("max_size_mb", policy.MaxSizeBytes/(1024*1024)),
+		slog.Duration("rollup_after", policy.Rollup.MinAge),
+		slog.Duration("rollup_resolution", policy.Rollup.Resolution),
+	)
+
+	// Apply immediately on start (the device may have been offline for a long time)
+	applyRetention(ctx, store, policy, metricsCollector, logger)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			applyRetention(ctx, store, policy, metricsCollector, logger)
+		}
+	}
+}
+
+// applyRetention performs a single retention pass and records evictions in meta-metrics
+func applyRetention(
+	ctx context.Context,
+	store *storage.SQLiteStorage,
+	policy storage.RetentionPolicy,
+	metricsCollector *monitoring.MetricsCollector,
+	logger *slog.Logger,
+) {
+	startTime := time.Now()
+	result, err := store.ApplyRetention(ctx, policy, startTime)
+
+	// Record whatever was evicted, even if a later step failed
+	if metricsCollector != nil {
+		metricsCollector.RecordRetentionEviction("rollup", result.RolledUp)
+		metricsCollector.RecordRetentionEviction("uploaded_age", result.UploadedExpired)
+		metricsCollector.RecordRetentionEviction("pending_age", result.PendingExpired)
+		metricsCollector.RecordRetentionEviction("uploaded_size", result.UploadedEvicted)
+		metricsCollector.RecordRetentionEviction("pending_size", result.PendingEvicted)
+	}
+
+	if err != nil {
+		logger.Error("Retention failed", slog.Any("error", err))
+		return
+	}
+
+	if result.PendingExpired > 0 || result.PendingEvicted > 0 {
+		// Pending rows never reached the remote - this is data loss
+		logger.Warn("Retention evicted pending metrics",
+			slog.Int64("pending_age", result.PendingExpired),
+			slog.Int64("pending_size", result.PendingEvicted),
+		)
+	}
+
+	if result.Total() > 0 {
+		logger.Info("Retention completed",
+			slog.Int64("rolled_up", result.RolledUp),
+			slog.Int64("rollups_created", result.RollupsCreated),
+			slog.Int64("uploaded_age", result.UploadedExpired),
+			slog.Int64("pending_age", result.PendingExpired),
+			slog.Int64("uploaded_size", result.UploadedEvicted),
+			slog.Int64("pending_size", result.PendingEvicted),
+			slog.Int64("pages_vacuumed", result.PagesVacuumed),
+			slog.Int64("duration_ms", time.Since(startTime).Milliseconds()),
+		)
+	} else {
+		logger.Debug("Retention completed, nothing to evict")
+	}
+}
+
 // runMetaMetricsLoop periodically collects and stores meta-metrics
 func runMetaMetricsLoop(
 	ctx context.Context,
@@ -802,6 +1727,7 @@ func runClockSkewLoop(
 	ctx context.Context,
 	cfg *config.Config,
 	store *storage.SQLiteStorage,
+	clockMonitor *timesync.Monitor,
 	healthChecker *health.Checker,
 	metricsCollector *monitoring.MetricsCollector,
 	interval time.Duration,
@@ -818,26 +1744,43 @@ func runClockSkewLoop(
 	)
 
 	// Create clock skew collector
-	// Note: Reuse auth token from remote config since clock skew endpoint
-	// typically shares the same auth requirements as ingestion endpoint
+	// Note: Reuse the auth token of an upload destination since the clock skew endpoint
+	// typically shares the same auth requirements as the ingestion endpoint
 	clockCollector := collector.NewClockSkewCollector(collector.ClockSkewCollectorConfig{
 		DeviceID:        cfg.Device.ID,
 		ClockSkewURL:    cfg.Monitoring.ClockSkewURL,
-		AuthToken:       cfg.Remote.AuthToken, // Reuse auth token from remote config
+		AuthToken:       clockSkewAuthToken(cfg),
 		WarnThresholdMs: warnThresholdMs,
 	})
 
 	// Check immediately on start
-	checkClockSkew(ctx, clockCollector, store, healthChecker, metricsCollector, logger)
+	checkClockSkew(ctx, clockCollector, store, clockMonitor, warnThresholdMs, healthChecker, metricsCollector, logger)
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			checkClockSkew(ctx, clockCollector, store, healthChecker, metricsCollector, logger)
+			checkClockSkew(ctx, clockCollector, store, clockMonitor, warnThresholdMs, healthChecker, metricsCollector, logger)
+		}
+	}
+}
+
+// clockSkewAuthToken returns the auth token of the destination on the same host as the clock
+// skew URL, or of the first destination if none matches
+func clockSkewAuthToken(cfg *config.Config) string {
+	dests := cfg.Remote.GetDestinations()
+	if len(dests) == 0 {
+		return ""
+	}
+	if probe, err := url.Parse(cfg.Monitoring.ClockSkewURL); err == nil {
+		for _, d := range dests {
+			if u, err := url.Parse(d.URL); err == nil && u.Scheme == probe.Scheme && u.Host == probe.Host {
+				return d.AuthToken
+			}
 		}
 	}
+	return dests[0].AuthToken
 }
 
 // checkClockSkew performs a single clock skew check
@@ -845,6 +1788,8 @@ func checkClockSkew(
 	ctx context.Context,
 	clockCollector collector.Collector,
 	store *storage.SQLiteStorage,
+	clockMonitor *timesync.Monitor,
+	warnThresholdMs int64,
 	healthChecker *health.Checker,
 	metricsCollector *monitoring.MetricsCollector,
 	logger *slog.Logger,
@@ -875,6 +1820,11 @@ func checkClockSkew(
 		}
 	}
 
+	// A server agreeing with the local clock also means held metrics can be corrected
+	if clockMonitor != nil {
+		clockMonitor.ReportSkew(skewMs, warnThresholdMs)
+	}
+
 	// Update health status
 	if healthChecker != nil {
 		healthChecker.UpdateClockSkewStatus(skewMs, nil)
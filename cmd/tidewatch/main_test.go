@@ -10,12 +10,19 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/taniwha3/tidewatch/internal/bandwidth"
+	"github.com/taniwha3/tidewatch/internal/collector"
 	"github.com/taniwha3/tidewatch/internal/config"
+	"github.com/taniwha3/tidewatch/internal/exposition"
+	"github.com/taniwha3/tidewatch/internal/health"
 	"github.com/taniwha3/tidewatch/internal/logging"
 	"github.com/taniwha3/tidewatch/internal/models"
+	"github.com/taniwha3/tidewatch/internal/monitoring"
+	"github.com/taniwha3/tidewatch/internal/relabel"
 	"github.com/taniwha3/tidewatch/internal/storage"
 	"github.com/taniwha3/tidewatch/internal/uploader"
 )
@@ -117,7 +124,7 @@ func TestUploadMetrics_MarksMetricsAsUploaded(t *testing.T) {
 
 	// Upload metrics
 	logger := testLogger()
-	if _, err := uploadMetrics(ctx, store, mockUpload, 2500, logger); err != nil {
+	if _, err := uploadMetrics(ctx, store, storage.DefaultDestination, mockUpload, 2500, models.PriorityP3, nil, logger); err != nil {
 		t.Fatalf("Upload failed: %v", err)
 	}
 
@@ -137,7 +144,7 @@ func TestUploadMetrics_MarksMetricsAsUploaded(t *testing.T) {
 
 	// Verify second upload attempt returns no metrics
 	mockUpload.uploadedMetrics = nil
-	if _, err := uploadMetrics(ctx, store, mockUpload, 2500, logger); err != nil {
+	if _, err := uploadMetrics(ctx, store, storage.DefaultDestination, mockUpload, 2500, models.PriorityP3, nil, logger); err != nil {
 		t.Fatalf("Second upload failed: %v", err)
 	}
 	if len(mockUpload.uploadedMetrics) != 0 {
@@ -177,7 +184,7 @@ func TestUploadMetrics_DoesNotMarkOnFailure(t *testing.T) {
 
 	// Attempt upload (should fail)
 	logger := testLogger()
-	if _, err := uploadMetrics(ctx, store, mockUpload, 2500, logger); err == nil {
+	if _, err := uploadMetrics(ctx, store, storage.DefaultDestination, mockUpload, 2500, models.PriorityP3, nil, logger); err == nil {
 		t.Fatal("Expected upload to fail, but it succeeded")
 	}
 
@@ -191,6 +198,209 @@ func TestUploadMetrics_DoesNotMarkOnFailure(t *testing.T) {
 	}
 }
 
+// TestUploadMetrics_MarksUploadedChunksOnPartialFailure verifies chunks that uploaded before a failure
+// are checkpointed and not resent, and the next cycle resumes the batch
+func TestUploadMetrics_MarksUploadedChunksOnPartialFailure(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	now := time.Now()
+	var testMetrics []*models.Metric
+	for i := 0; i < 6; i++ {
+		testMetrics = append(testMetrics, models.NewMetric("test.metric", float64(i), "test-device").WithTimestamp(now.Add(time.Duration(i)*time.Second)))
+	}
+	if err := store.StoreBatch(ctx, testMetrics); err != nil {
+		t.Fatalf("Failed to store metrics: %v", err)
+	}
+
+	// The second chunk is rejected on the first cycle
+	var requests atomic.Int32
+	var reject atomic.Bool
+	reject.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if reject.Load() && r.Header.Get("X-Chunk-Index") == "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	zero := 0
+	up := uploader.NewHTTPUploaderWithConfig(uploader.HTTPUploaderConfig{
+		URL:        server.URL,
+		DeviceID:   "test-device",
+		ChunkSize:  2,
+		MaxRetries: &zero,
+	})
+	defer up.Close()
+
+	count, err := uploadMetrics(ctx, store, storage.DefaultDestination, up, 2500, models.PriorityP3, nil, testLogger())
+	if err == nil {
+		t.Fatal("Expected the upload to fail")
+	}
+	if count != 2 {
+		t.Errorf("Expected the first chunk counted as uploaded, got %d", count)
+	}
+
+	pending, err := store.GetPendingCount(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get pending count: %v", err)
+	}
+	if pending != 4 {
+		t.Errorf("Expected only the failed and skipped chunks pending, got %d", pending)
+	}
+
+	// The next cycle continues the batch with the four metrics still queued
+	reject.Store(false)
+	requests.Store(0)
+	count, err = uploadMetrics(ctx, store, storage.DefaultDestination, up, 2500, models.PriorityP3, nil, testLogger())
+	if err != nil {
+		t.Fatalf("Continued upload failed: %v", err)
+	}
+	if count != 4 || requests.Load() != 2 {
+		t.Errorf("Expected 4 metrics in 2 chunks, got %d in %d", count, requests.Load())
+	}
+
+	checkpoint, err := store.ContinueBatch(ctx, storage.DefaultDestination, time.Now())
+	if err != nil {
+		t.Fatalf("ContinueBatch failed: %v", err)
+	}
+	if checkpoint.Continued {
+		t.Errorf("Expected the batch completed, got %+v", checkpoint)
+	}
+}
+
+// TestUploadMetrics_DropsRejectedRemoteWriteChunk verifies a chunk a remote_write receiver rejects
+// is dropped and counted instead of blocking the queue, and later cycles still upload
+func TestUploadMetrics_DropsRejectedRemoteWriteChunk(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	now := time.Now()
+	var testMetrics []*models.Metric
+	for i := 0; i < 6; i++ {
+		testMetrics = append(testMetrics, models.NewMetric("test.metric", float64(i), "test-device").WithTimestamp(now.Add(time.Duration(i)*time.Second)))
+	}
+	if err := store.StoreBatch(ctx, testMetrics); err != nil {
+		t.Fatalf("Failed to store metrics: %v", err)
+	}
+
+	// The receiver rejects the first request, as Prometheus does for out-of-order samples
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			http.Error(w, "out of order sample", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	zero := 0
+	up := uploader.NewHTTPUploaderWithConfig(uploader.HTTPUploaderConfig{
+		URL:        server.URL,
+		Protocol:   uploader.ProtocolPrometheusRemoteWrite,
+		DeviceID:   "test-device",
+		ChunkSize:  2,
+		MaxRetries: &zero,
+	})
+	defer up.Close()
+
+	mc := monitoring.NewMetricsCollector("test-device")
+	count, err := uploadMetrics(ctx, store, storage.DefaultDestination, up, 2500, models.PriorityP3, mc, testLogger())
+	if err != nil {
+		t.Fatalf("Expected a rejected chunk not to fail the cycle, got %v", err)
+	}
+	if count != 4 {
+		t.Errorf("Expected the other two chunks uploaded, got %d", count)
+	}
+
+	pending, err := store.GetPendingCount(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get pending count: %v", err)
+	}
+	if pending != 0 {
+		t.Errorf("Expected the rejected chunk dropped from the queue, got %d pending", pending)
+	}
+
+	meta, err := mc.CollectMetrics(ctx)
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+	var rejected float64
+	for _, m := range meta {
+		if m.Name == "uploader.rejected_total" && m.Tags["destination"] == storage.DefaultDestination {
+			rejected = m.Value
+		}
+	}
+	if rejected != 2 {
+		t.Errorf("Expected 2 rejected metrics counted, got %v", rejected)
+	}
+
+	// Later cycles upload new metrics
+	if err := store.Store(ctx, models.NewMetric("test.metric", 6, "test-device").WithTimestamp(now.Add(10*time.Second))); err != nil {
+		t.Fatalf("Failed to store metric: %v", err)
+	}
+	count, err = uploadMetrics(ctx, store, storage.DefaultDestination, up, 2500, models.PriorityP3, mc, testLogger())
+	if err != nil || count != 1 {
+		t.Errorf("Expected the next cycle to upload 1 metric, got %d, %v", count, err)
+	}
+}
+
+func TestUploadMetrics_TextfileWithNaN(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	// Go clients report NaN quantiles for summaries without observations
+	metrics, err := collector.ParseTextfile("# TYPE x summary\nx{quantile=\"0.5\"} NaN\nx_count 0\n", "test-device", time.Now())
+	if err != nil {
+		t.Fatalf("ParseTextfile failed: %v", err)
+	}
+	if err := store.StoreBatch(ctx, metrics); err != nil {
+		t.Fatalf("Failed to store metrics: %v", err)
+	}
+
+	var body atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		buf.ReadFrom(r.Body)
+		body.Store(buf.String())
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	up := uploader.NewHTTPUploaderWithConfig(uploader.HTTPUploaderConfig{
+		URL:      server.URL,
+		DeviceID: "test-device",
+	})
+	defer up.Close()
+
+	count, err := uploadMetrics(ctx, store, storage.DefaultDestination, up, 2500, models.PriorityP3, nil, testLogger())
+	if err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected only x_count uploaded, got %d", count)
+	}
+	if sent, _ := body.Load().(string); strings.Contains(sent, "NaN") || !strings.Contains(sent, "x_count") {
+		t.Errorf("Expected x_count without NaN in the upload, got %q", sent)
+	}
+}
+
 func TestUploadMetrics_BatchLimit(t *testing.T) {
 	// Create temporary database
 	dbPath := t.TempDir() + "/test.db"
@@ -233,7 +443,7 @@ func TestUploadMetrics_BatchLimit(t *testing.T) {
 
 	// First upload should only upload 2500 (batch limit)
 	logger := testLogger()
-	if _, err := uploadMetrics(ctx, store, mockUpload, 2500, logger); err != nil {
+	if _, err := uploadMetrics(ctx, store, storage.DefaultDestination, mockUpload, 2500, models.PriorityP3, nil, logger); err != nil {
 		t.Fatalf("Upload failed: %v", err)
 	}
 
@@ -252,7 +462,7 @@ func TestUploadMetrics_BatchLimit(t *testing.T) {
 
 	// Second upload should upload remaining 500
 	mockUpload.uploadedMetrics = nil
-	if _, err := uploadMetrics(ctx, store, mockUpload, 2500, logger); err != nil {
+	if _, err := uploadMetrics(ctx, store, storage.DefaultDestination, mockUpload, 2500, models.PriorityP3, nil, logger); err != nil {
 		t.Fatalf("Second upload failed: %v", err)
 	}
 
@@ -328,7 +538,7 @@ func TestUploadMetrics_StringMetricsRemainInStorage(t *testing.T) {
 
 	// Upload should only process 100 numeric metrics (string metrics filtered by QueryUnuploaded)
 	logger := testLogger()
-	count, err := uploadMetrics(ctx, store, mockUpload, 2500, logger)
+	count, err := uploadMetrics(ctx, store, storage.DefaultDestination, mockUpload, 2500, models.PriorityP3, nil, logger)
 	if err != nil {
 		t.Fatalf("Upload failed: %v", err)
 	}
@@ -363,7 +573,7 @@ func TestUploadMetrics_StringMetricsRemainInStorage(t *testing.T) {
 
 	// Verify second upload finds no numeric metrics (but string metrics still present)
 	mockUpload.uploadedMetrics = nil
-	count2, err := uploadMetrics(ctx, store, mockUpload, 2500, logger)
+	count2, err := uploadMetrics(ctx, store, storage.DefaultDestination, mockUpload, 2500, models.PriorityP3, nil, logger)
 	if err != nil {
 		t.Fatalf("Second upload failed: %v", err)
 	}
@@ -427,7 +637,7 @@ func TestConfigWiring_BatchSize(t *testing.T) {
 			// Upload with configured batch size
 			mockUpload := &mockUploader{}
 			logger := testLogger()
-			_, err = uploadMetrics(ctx, store, mockUpload, tt.configBatchSize, logger)
+			_, err = uploadMetrics(ctx, store, storage.DefaultDestination, mockUpload, tt.configBatchSize, models.PriorityP3, nil, logger)
 			if err != nil {
 				t.Fatalf("Upload failed: %v", err)
 			}
@@ -473,7 +683,7 @@ func TestConfigWiring_CustomBatchSizeVsDefault(t *testing.T) {
 
 	// Test 1: Default batch size (2500)
 	mockUpload1 := &mockUploader{}
-	_, err = uploadMetrics(ctx, store, mockUpload1, 2500, logger)
+	_, err = uploadMetrics(ctx, store, storage.DefaultDestination, mockUpload1, 2500, models.PriorityP3, nil, logger)
 	if err != nil {
 		t.Fatalf("Upload with default batch size failed: %v", err)
 	}
@@ -483,7 +693,7 @@ func TestConfigWiring_CustomBatchSizeVsDefault(t *testing.T) {
 
 	// Test 2: Custom batch size (5000 - upload all remaining)
 	mockUpload2 := &mockUploader{}
-	_, err = uploadMetrics(ctx, store, mockUpload2, 5000, logger)
+	_, err = uploadMetrics(ctx, store, storage.DefaultDestination, mockUpload2, 5000, models.PriorityP3, nil, logger)
 	if err != nil {
 		t.Fatalf("Upload with custom batch size failed: %v", err)
 	}
@@ -493,6 +703,75 @@ func TestConfigWiring_CustomBatchSizeVsDefault(t *testing.T) {
 	}
 }
 
+// TestUploadMetrics_DestinationsAreIndependent verifies that a failing destination keeps its
+// backlog while another destination uploads and clears its own queue
+func TestUploadMetrics_DestinationsAreIndependent(t *testing.T) {
+	dbPath := t.TempDir() + "/test.db"
+	store, err := storage.NewSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if err := store.SetDestinations(ctx, []string{"primary", "archive"}); err != nil {
+		t.Fatalf("Failed to set destinations: %v", err)
+	}
+
+	now := time.Now()
+	var testMetrics []*models.Metric
+	for i := 0; i < 10; i++ {
+		testMetrics = append(testMetrics, models.NewMetric("test.metric", float64(i), "test-device").
+			WithTimestamp(now.Add(time.Duration(i)*time.Second)))
+	}
+	if err := store.StoreBatch(ctx, testMetrics); err != nil {
+		t.Fatalf("Failed to store metrics: %v", err)
+	}
+
+	logger := testLogger()
+
+	// Archive is down: nothing is dequeued for it
+	archive := &mockUploader{shouldFail: true}
+	if _, err := uploadMetrics(ctx, store, "archive", archive, 2500, models.PriorityP3, nil, logger); err == nil {
+		t.Fatal("Expected archive upload to fail")
+	}
+
+	// Primary succeeds
+	primary := &mockUploader{}
+	count, err := uploadMetrics(ctx, store, "primary", primary, 2500, models.PriorityP3, nil, logger)
+	if err != nil {
+		t.Fatalf("Primary upload failed: %v", err)
+	}
+	if count != 10 {
+		t.Errorf("Expected 10 metrics uploaded to primary, got %d", count)
+	}
+
+	primaryPending, _ := store.GetPendingCountFor(ctx, "primary")
+	archivePending, _ := store.GetPendingCountFor(ctx, "archive")
+	if primaryPending != 0 {
+		t.Errorf("Expected primary queue empty, got %d", primaryPending)
+	}
+	if archivePending != 10 {
+		t.Errorf("Expected archive to keep 10 pending, got %d", archivePending)
+	}
+
+	// Rows are only uploaded once every destination has them
+	if pending, _ := store.GetPendingCount(ctx); pending != 10 {
+		t.Errorf("Expected 10 rows still pending overall, got %d", pending)
+	}
+
+	archive.shouldFail = false
+	if _, err := uploadMetrics(ctx, store, "archive", archive, 2500, models.PriorityP3, nil, logger); err != nil {
+		t.Fatalf("Archive upload failed after recovery: %v", err)
+	}
+	if len(archive.uploadedMetrics) != 10 {
+		t.Errorf("Expected archive to receive its full backlog, got %d", len(archive.uploadedMetrics))
+	}
+	if pending, _ := store.GetPendingCount(ctx); pending != 0 {
+		t.Errorf("Expected no rows pending after both destinations uploaded, got %d", pending)
+	}
+}
+
 // TestNormalizeStoragePath_UNCPaths tests that UNC network paths are preserved
 func TestNormalizeStoragePath_UNCPaths(t *testing.T) {
 	tests := []struct {
@@ -1464,6 +1743,34 @@ func TestConfigWiring_ClockSkewIntervalDefault(t *testing.T) {
 
 // TestConfigWiring_RetryExplicitZeroJitter tests P2 fix:
 // When user explicitly sets jitter_percent: 0 (to disable jitter), it should be respected
+func TestClockSkewAuthToken(t *testing.T) {
+	cfg := &config.Config{
+		Remote: config.RemoteConfig{Destinations: []config.DestinationConfig{
+			{Name: "primary", URL: "https://vm.example.com/api/v1/import", AuthToken: "primary-token"},
+			{Name: "backup", URL: "https://backup.example.com/api/v1/import", AuthToken: "backup-token"},
+		}},
+		Monitoring: config.MonitoringConfig{ClockSkewURL: "https://backup.example.com/health"},
+	}
+	if got := clockSkewAuthToken(cfg); got != "backup-token" {
+		t.Errorf("Expected the token of the destination on the probed host, got %q", got)
+	}
+
+	cfg.Monitoring.ClockSkewURL = "https://time.example.com/health"
+	if got := clockSkewAuthToken(cfg); got != "primary-token" {
+		t.Errorf("Expected the first destination's token, got %q", got)
+	}
+
+	cfg.Remote = config.RemoteConfig{URL: "https://vm.example.com/api/v1/import", AuthToken: "legacy-token"}
+	if got := clockSkewAuthToken(cfg); got != "legacy-token" {
+		t.Errorf("Expected the remote.auth_token, got %q", got)
+	}
+
+	cfg.Remote = config.RemoteConfig{}
+	if got := clockSkewAuthToken(cfg); got != "" {
+		t.Errorf("Expected no token without destinations, got %q", got)
+	}
+}
+
 func TestConfigWiring_RetryExplicitZeroJitter(t *testing.T) {
 	// Create temp config with explicit jitter_percent: 0
 	configYAML := `
@@ -1610,3 +1917,682 @@ metrics:
 		}
 	}
 }
+
+// TestConfigWiring_RetentionPolicy tests that storage.retention is wired into the retention policy
+func TestConfigWiring_RetentionPolicy(t *testing.T) {
+	rc := &config.RetentionConfig{
+		UploadedMaxAgeStr: "12h",
+		PendingMaxAgeStr:  "720h",
+		MaxSizeMB:         512,
+		CheckIntervalStr:  "15m",
+	}
+
+	policy, interval, err := retentionPolicyFromConfig(rc)
+	if err != nil {
+		t.Fatalf("retentionPolicyFromConfig failed: %v", err)
+	}
+	if policy.UploadedMaxAge != 12*time.Hour {
+		t.Errorf("Expected uploaded max age 12h, got %v", policy.UploadedMaxAge)
+	}
+	if policy.PendingMaxAge != 720*time.Hour {
+		t.Errorf("Expected pending max age 720h, got %v", policy.PendingMaxAge)
+	}
+	if policy.MaxSizeBytes != 512*1024*1024 {
+		t.Errorf("Expected max size 512 MB, got %d", policy.MaxSizeBytes)
+	}
+	if interval != 15*time.Minute {
+		t.Errorf("Expected interval 15m, got %v", interval)
+	}
+	if policy.Rollup.MinAge != 0 {
+		t.Errorf("Expected rollups disabled by default, got %+v", policy.Rollup)
+	}
+
+	rc.Rollup = config.RollupConfig{Enabled: true, AfterStr: "12h", ResolutionStr: "1m"}
+	policy, _, err = retentionPolicyFromConfig(rc)
+	if err != nil {
+		t.Fatalf("retentionPolicyFromConfig failed: %v", err)
+	}
+	if policy.Rollup.MinAge != 12*time.Hour || policy.Rollup.Resolution != time.Minute {
+		t.Errorf("Expected rollup after 12h at 1m, got %+v", policy.Rollup)
+	}
+}
+
+// TestApplyRetention_RecordsEvictions tests that a retention pass records evictions in meta-metrics
+func TestApplyRetention_RecordsEvictions(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := storage.NewSQLiteStorage(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	old := time.Now().Add(-48 * time.Hour)
+	metrics := []*models.Metric{
+		models.NewMetric("test.metric", 1, "device-001").WithTimestamp(old),
+		models.NewMetric("test.metric", 2, "device-001").WithTimestamp(old.Add(time.Second)),
+		models.NewMetric("test.metric", 3, "device-001"),
+	}
+	if err := store.StoreBatch(ctx, metrics); err != nil {
+		t.Fatalf("Failed to store metrics: %v", err)
+	}
+
+	mc := monitoring.NewMetricsCollector("device-001")
+	policy := storage.RetentionPolicy{PendingMaxAge: 24 * time.Hour}
+	applyRetention(ctx, store, policy, mc, testLogger())
+
+	evicted := mc.GetCollectorStats()["evicted"].(map[string]int64)
+	if evicted["pending_age"] != 2 {
+		t.Errorf("Expected 2 pending_age evictions, got %d", evicted["pending_age"])
+	}
+
+	count, err := store.GetPendingCount(ctx)
+	if err != nil {
+		t.Fatalf("GetPendingCount failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 pending metric left, got %d", count)
+	}
+}
+
+// TestValidateCollectorOptions verifies that metrics[].options are checked against the collector registry
+func TestValidateCollectorOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		metrics []config.MetricConfig
+		wantErr string
+	}{
+		{
+			name: "valid options",
+			metrics: []config.MetricConfig{
+				{Name: "network.traffic", Interval: "10s", Enabled: true, Options: map[string]interface{}{
+					"include_pattern": "^eth",
+					"max_interfaces":  8,
+				}},
+			},
+		},
+		{
+			name: "unknown option",
+			metrics: []config.MetricConfig{
+				{Name: "disk.io", Interval: "10s", Enabled: true, Options: map[string]interface{}{"pattern": "^sd"}},
+			},
+			wantErr: "unknown option",
+		},
+		{
+			name: "disabled metric still validated",
+			metrics: []config.MetricConfig{
+				{Name: "network.traffic", Interval: "10s", Enabled: false, Options: map[string]interface{}{"max_interfaces": "many"}},
+			},
+			wantErr: "max_interfaces",
+		},
+		{
+			name: "options on unknown collector",
+			metrics: []config.MetricConfig{
+				{Name: "gpu.temperature", Interval: "10s", Enabled: true, Options: map[string]interface{}{"index": 0}},
+			},
+			wantErr: "unknown collector",
+		},
+		{
+			name: "unknown collector without options",
+			metrics: []config.MetricConfig{
+				{Name: "gpu.temperature", Interval: "10s", Enabled: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Metrics: tt.metrics}
+			err := validateCollectorOptions(cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// staticCollector returns a fixed set of metrics
+type staticCollector struct {
+	metrics []*models.Metric
+}
+
+func (c *staticCollector) Name() string { return "static" }
+func (c *staticCollector) Collect(ctx context.Context) ([]*models.Metric, error) {
+	return c.metrics, nil
+}
+
+// TestCollectAndStore_ObservesLatest verifies collected samples are exposed on /metrics
+func TestCollectAndStore_ObservesLatest(t *testing.T) {
+	dbPath := t.TempDir() + "/test.db"
+	store, err := storage.NewSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer store.Close()
+
+	latest := exposition.NewLatest(0)
+	coll := &staticCollector{metrics: []*models.Metric{
+		models.NewMetric("memory.used_bytes", 2048, "test-device"),
+	}}
+
+	collectAndStore(context.Background(), "memory.usage", coll, models.PriorityDefault, nil, store, latest, nil, nil, testLogger())
+
+	rec := httptest.NewRecorder()
+	exposition.Handler(latest, nil, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), `memory_used_bytes{device_id="test-device"} 2048`) {
+		t.Errorf("Expected collected sample on /metrics, got:\n%s", rec.Body.String())
+	}
+}
+
+// TestCollectAndStore_Relabel verifies dropped metrics never reach storage and are counted
+func TestCollectAndStore_Relabel(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer store.Close()
+
+	rename := "net.$1"
+	cfg := &config.RelabelConfig{Rules: []config.RelabelRuleConfig{
+		{Action: "drop", SourceLabels: []string{"interface"}, Regex: "veth.*"},
+		{SourceLabels: []string{"__name__"}, Regex: "network\\.(.*)", TargetLabel: "__name__", Replacement: &rename},
+	}}
+	relabeler, err := relabel.New(relabelConfigFromConfig(cfg))
+	if err != nil {
+		t.Fatalf("relabel.New failed: %v", err)
+	}
+
+	coll := &staticCollector{metrics: []*models.Metric{
+		models.NewMetric("network.rx_bytes_total", 1, "test-device").WithTag("interface", "eth0"),
+		models.NewMetric("network.rx_bytes_total", 2, "test-device").WithTag("interface", "veth0"),
+	}}
+	metricsCollector := monitoring.NewMetricsCollector("test-device")
+	collectAndStore(context.Background(), "network", coll, models.PriorityDefault, relabeler, store, nil, nil, metricsCollector, testLogger())
+
+	stored, err := store.Query(context.Background(), storage.QueryOptions{})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(stored) != 1 || stored[0].Name != "net.rx_bytes_total" || stored[0].Tags["interface"] != "eth0" {
+		t.Fatalf("Expected only the renamed eth0 sample stored, got %+v", stored)
+	}
+
+	meta, _ := metricsCollector.CollectMetrics(context.Background())
+	found := false
+	for _, m := range meta {
+		if m.Name == "relabel.dropped_total" && m.Tags["collector"] == "network" && m.Tags["reason"] == "rule" && m.Value == 1 {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected the dropped sample in relabel.dropped_total")
+	}
+}
+
+// memWriter records the last stored batch
+type memWriter struct {
+	batch []*models.Metric
+}
+
+func (w *memWriter) StoreBatch(ctx context.Context, metrics []*models.Metric) error {
+	w.batch = metrics
+	return nil
+}
+
+func TestRelabelWriter(t *testing.T) {
+	p0 := "P0"
+	relabeler, err := relabel.New(relabelConfigFromConfig(&config.RelabelConfig{
+		MaxSeriesPerMetric: 2,
+		Rules: []config.RelabelRuleConfig{
+			{Action: "drop", SourceLabels: []string{"__name__"}, Regex: "debug\\..*"},
+			{SourceLabels: []string{"__name__"}, Regex: "encoder\\.restarts", TargetLabel: "__priority__", Replacement: &p0},
+		},
+	}))
+	if err != nil {
+		t.Fatalf("relabel.New failed: %v", err)
+	}
+	next := &memWriter{}
+	metricsCollector := monitoring.NewMetricsCollector("test-device")
+	w := &relabelWriter{source: "statsd", relabeler: relabeler, next: next, metricsCollector: metricsCollector, logger: testLogger()}
+
+	err = w.StoreBatch(context.Background(), []*models.Metric{
+		models.NewMetric("encoder.restarts", 1, "test-device"),
+		models.NewMetric("debug.queue", 1, "test-device"),
+		models.NewMetric("encoder.fps", 30, "test-device").WithTag("pipeline", "a"),
+		models.NewMetric("encoder.fps", 30, "test-device").WithTag("pipeline", "b"),
+		models.NewMetric("encoder.fps", 30, "test-device").WithTag("pipeline", "c"),
+	})
+	if err != nil {
+		t.Fatalf("StoreBatch failed: %v", err)
+	}
+	if len(next.batch) != 3 || next.batch[0].Priority != models.PriorityP0 {
+		t.Fatalf("Expected the prioritized counter and two fps series stored, got %+v", next.batch)
+	}
+
+	meta, _ := metricsCollector.CollectMetrics(context.Background())
+	drops := make(map[string]float64)
+	for _, m := range meta {
+		if m.Name == "relabel.dropped_total" && m.Tags["collector"] == "statsd" {
+			drops[m.Tags["reason"]] = m.Value
+		}
+	}
+	if drops[relabel.ReasonRule] != 1 || drops[relabel.ReasonSeriesLimit] != 1 {
+		t.Errorf("Expected one rule and one series limit drop for statsd, got %v", drops)
+	}
+
+	// A batch dropped entirely is not written
+	next.batch = nil
+	if err := w.StoreBatch(context.Background(), []*models.Metric{models.NewMetric("debug.queue", 2, "test-device")}); err != nil || next.batch != nil {
+		t.Errorf("Expected nothing written, got %v (err: %v)", next.batch, err)
+	}
+}
+
+// TestSessionConfigFromConfig verifies the sessions block maps onto the session manager config
+func TestSessionConfigFromConfig(t *testing.T) {
+	above := 100000.0
+	off := false
+	sc := &config.SessionsConfig{
+		Enabled:           true,
+		CloseAfterStr:     "1m",
+		PrioritizeUploads: &off,
+		Triggers: []config.SessionTriggerConfig{
+			{Unit: "srt-stream.service"},
+			{Metric: "srt.bitrate_bps", Above: &above},
+		},
+	}
+	cfg, err := sessionConfigFromConfig(sc, "test-device")
+	if err != nil {
+		t.Fatalf("sessionConfigFromConfig failed: %v", err)
+	}
+	if cfg.CheckInterval != 5*time.Second || cfg.CloseAfter != time.Minute || cfg.PrioritizeUploads || cfg.DeviceID != "test-device" {
+		t.Errorf("Unexpected session config %+v", cfg)
+	}
+	if len(cfg.Triggers) != 2 || cfg.Triggers[0].String() != "unit:srt-stream.service" || cfg.Triggers[1].String() != "metric:srt.bitrate_bps>100000" {
+		t.Errorf("Unexpected triggers %+v", cfg.Triggers)
+	}
+}
+
+func TestStatsDConfigFromConfig(t *testing.T) {
+	cfg, err := statsdConfigFromConfig(&config.StatsDConfig{Enabled: true, FlushIntervalStr: "30s"}, "test-device")
+	if err != nil {
+		t.Fatalf("statsdConfigFromConfig failed: %v", err)
+	}
+	if cfg.Address != "127.0.0.1:8125" || cfg.FlushInterval != 30*time.Second || cfg.MaxSeries != 10000 || cfg.IdleTimeout != time.Hour || cfg.DeviceID != "test-device" {
+		t.Errorf("Unexpected statsd config %+v", cfg)
+	}
+}
+
+func TestIngestConfigFromConfig(t *testing.T) {
+	cfg, err := ingestConfigFromConfig(&config.IngestConfig{Enabled: true, AuthToken: "secret", Priority: "p1"}, "test-device")
+	if err != nil {
+		t.Fatalf("ingestConfigFromConfig failed: %v", err)
+	}
+	if cfg.DeviceID != "test-device" || cfg.AuthToken != "secret" || cfg.MaxMetrics != 10000 || cfg.Priority != models.PriorityP1 {
+		t.Errorf("Unexpected ingest config %+v", cfg)
+	}
+}
+
+// TestCollectAndStore_Priority verifies the configured class is stored and relabel rules can override it
+func TestCollectAndStore_Priority(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer store.Close()
+
+	demote := "P3"
+	relabeler, err := relabel.New(relabelConfigFromConfig(&config.RelabelConfig{Rules: []config.RelabelRuleConfig{
+		{SourceLabels: []string{"interface"}, Regex: "veth.*", TargetLabel: relabel.PriorityLabel, Replacement: &demote},
+	}}))
+	if err != nil {
+		t.Fatalf("relabel.New failed: %v", err)
+	}
+
+	coll := &staticCollector{metrics: []*models.Metric{
+		models.NewMetric("network.rx_bytes_total", 1, "test-device").WithTag("interface", "eth0"),
+		models.NewMetric("network.rx_bytes_total", 2, "test-device").WithTag("interface", "veth0"),
+	}}
+	collectAndStore(context.Background(), "network", coll, models.PriorityP1, relabeler, store, nil, nil, nil, testLogger())
+
+	counts, err := store.GetPendingCountByPriority(context.Background())
+	if err != nil {
+		t.Fatalf("GetPendingCountByPriority failed: %v", err)
+	}
+	if counts[models.PriorityP1] != 1 || counts[models.PriorityP3] != 1 {
+		t.Errorf("Expected one P1 and one demoted P3 row, got %v", counts)
+	}
+}
+
+// TestRunCollector_ReportsSources verifies each textfile shows up in health on its own and
+// disappears with its file or when the collector stops
+func TestRunCollector_ReportsSources(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer store.Close()
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"modem.prom":  "modem_signal_rssi_dbm -71\n",
+		"broken.prom": "modem_signal_rssi_dbm{modem=wwan0} -71\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	coll := collector.NewTextfileCollector(collector.TextfileCollectorConfig{DeviceID: "test-device", Directory: dir})
+	healthChecker := health.NewChecker(health.DefaultThresholds())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runCollector(ctx, "textfile", coll, 10*time.Millisecond, models.PriorityDefault, nil, store, nil, healthChecker, nil, testLogger())
+	}()
+
+	waitFor := func(what string, cond func(map[string]health.ComponentStatus) bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond(healthChecker.GetReport().Components) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s: %+v", what, healthChecker.GetReport().Components)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitFor("per-file components", func(c map[string]health.ComponentStatus) bool {
+		return c["collector.textfile/modem.prom"].Status == health.StatusOK &&
+			c["collector.textfile/broken.prom"].Status == health.StatusError &&
+			c["collector.textfile"].Status == health.StatusOK
+	})
+	if msg := healthChecker.GetReport().Components["collector.textfile/broken.prom"].Message; !strings.Contains(msg, "line 1") {
+		t.Errorf("Expected the parse error in the component message, got %q", msg)
+	}
+
+	os.Remove(filepath.Join(dir, "broken.prom"))
+	waitFor("the removed file to go away", func(c map[string]health.ComponentStatus) bool {
+		_, ok := c["collector.textfile/broken.prom"]
+		return !ok
+	})
+
+	cancel()
+	<-done
+	if _, ok := healthChecker.GetReport().Components["collector.textfile/modem.prom"]; ok {
+		t.Error("Expected per-file components removed when the collector stops")
+	}
+}
+
+// TestRunUploadLoop_CircuitBreaker verifies an unreachable remote stops being hit, then a probe
+// and a small batch bring uploads back
+func TestRunUploadLoop_CircuitBreaker(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer store.Close()
+
+	now := time.Now()
+	var testMetrics []*models.Metric
+	for i := 0; i < 16; i++ {
+		testMetrics = append(testMetrics, models.NewMetric("test.metric", float64(i), "test-device").WithTimestamp(now.Add(time.Duration(i)*time.Second)))
+	}
+	if err := store.StoreBatch(context.Background(), testMetrics); err != nil {
+		t.Fatalf("Failed to store metrics: %v", err)
+	}
+
+	var down atomic.Bool
+	down.Store(true)
+	var uploads, probes atomic.Int32
+	var firstBatch atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			probes.Add(1)
+		} else {
+			uploads.Add(1)
+		}
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path != "/health" {
+			firstBatch.CompareAndSwap(nil, r.Header.Get("X-Chunk-Metrics"))
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	zero := 0
+	up := uploader.NewHTTPUploaderWithConfig(uploader.HTTPUploaderConfig{
+		URL:        server.URL + "/api/v1/import",
+		ProbeURL:   server.URL + "/health",
+		DeviceID:   "test-device",
+		MaxRetries: &zero,
+	})
+	defer up.Close()
+
+	breaker := uploader.NewBreaker(uploader.BreakerConfig{FailureThreshold: 2, OpenTimeout: 300 * time.Millisecond})
+	healthChecker := health.NewChecker(health.DefaultThresholds())
+	metricsCollector := monitoring.NewMetricsCollector("test-device")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runUploadLoop(ctx, store, storage.DefaultDestination, up, 10*time.Millisecond, 16, breaker, nil, healthChecker, metricsCollector, testLogger())
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Two failed cycles open the breaker; later ticks do not touch the remote
+	time.Sleep(150 * time.Millisecond)
+	if got := uploads.Load(); got != 2 {
+		t.Errorf("Expected 2 upload attempts before the breaker opened, got %d", got)
+	}
+	status := healthChecker.GetReport().Components["uploader"]
+	if status.Details["breaker_state"] != "open" || status.Status != health.StatusError {
+		t.Errorf("Expected the uploader reported offline, got %s %+v", status.Status, status.Details)
+	}
+
+	down.Store(false)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pending, err := store.GetPendingCount(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to get pending count: %v", err)
+		}
+		if pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the backlog to drain after recovery, %d pending", pending)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if probes.Load() == 0 {
+		t.Error("Expected the probe URL checked before uploads resumed")
+	}
+	// The first batch after the outage is an eighth of batch_size
+	if got := firstBatch.Load(); got != "2" {
+		t.Errorf("Expected a 2-metric probe batch, got %v", got)
+	}
+	if breaker.State() != uploader.BreakerClosed {
+		t.Errorf("Expected the breaker closed, got %s", breaker.State())
+	}
+}
+
+func TestBreakerConfigFromConfig(t *testing.T) {
+	disabled := false
+	if bc, err := breakerConfigFromConfig(&config.CircuitBreakerConfig{Enabled: &disabled}); err != nil || bc != nil {
+		t.Errorf("Expected no breaker when disabled, got %+v (err: %v)", bc, err)
+	}
+
+	bc, err := breakerConfigFromConfig(&config.CircuitBreakerConfig{FailureThreshold: 5, OpenTimeoutStr: "30s"})
+	if err != nil {
+		t.Fatalf("breakerConfigFromConfig failed: %v", err)
+	}
+	if bc.FailureThreshold != 5 || bc.OpenTimeout != 30*time.Second || bc.MaxOpenTimeout != 10*time.Minute {
+		t.Errorf("Unexpected breaker config %+v", bc)
+	}
+}
+
+func TestRunUploadLoop_Bandwidth(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	now := time.Now()
+	var testMetrics []*models.Metric
+	for i := 0; i < 8; i++ {
+		m := models.NewMetric("test.metric", float64(i), "test-device").WithTimestamp(now.Add(time.Duration(i) * time.Second))
+		m.Priority = models.PriorityP3
+		if i%2 == 0 {
+			m.Priority = models.PriorityP0
+		}
+		testMetrics = append(testMetrics, m)
+	}
+	if err := store.StoreBatch(ctx, testMetrics); err != nil {
+		t.Fatalf("Failed to store metrics: %v", err)
+	}
+
+	// The default route goes over the cellular modem
+	procRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(procRoot, "net"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	setRoute := func(iface string) {
+		t.Helper()
+		route := "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+			iface + "\t00000000\t0100000A\t0003\t0\t0\t100\t00000000\t0\t0\t0\n"
+		if err := os.WriteFile(filepath.Join(procRoot, "net", "route"), []byte(route), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setRoute("wwan0")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	rules := []bandwidth.Rule{
+		{Match: "eth*", Policy: bandwidth.PolicyUnmetered},
+		{Match: "wwan*", Policy: bandwidth.PolicyPriority},
+	}
+	meter := bandwidth.New(bandwidth.Config{Rules: rules, ProcRoot: procRoot, Logger: testLogger()}, store)
+	up, err := newDestinationUploader(config.DestinationConfig{Name: storage.DefaultDestination, URL: server.URL}, config.DeviceConfig{ID: "test-device"}, meter, testLogger())
+	if err != nil {
+		t.Fatalf("newDestinationUploader failed: %v", err)
+	}
+	defer up.Close()
+
+	breaker := uploader.NewBreaker(uploader.BreakerConfig{FailureThreshold: 1})
+	healthChecker := health.NewChecker(health.DefaultThresholds())
+	metricsCollector := monitoring.NewMetricsCollector("test-device")
+
+	loopCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runUploadLoop(loopCtx, store, storage.DefaultDestination, up, 10*time.Millisecond, 100, breaker, meter, healthChecker, metricsCollector, testLogger())
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitPending := func(want int64) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			pending, err := store.GetPendingCountFor(ctx, storage.DefaultDestination)
+			if err != nil {
+				t.Fatalf("Failed to get pending count: %v", err)
+			}
+			if pending == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %d pending, got %d", want, pending)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Over wwan0 only the P0 rows go out
+	waitPending(4)
+	time.Sleep(50 * time.Millisecond)
+	waitPending(4)
+	status := healthChecker.GetReport().Components["bandwidth"]
+	if status.Details["interface"] != "wwan0" || status.Details["policy"] != "priority" || status.Details["today_bytes"].(int64) == 0 {
+		t.Errorf("Expected priority uploads over wwan0 accounted, got %+v", status.Details)
+	}
+
+	// A used-up budget pauses uploads without opening the breaker
+	meter.Configure(bandwidth.Config{DailyBudget: 1, Rules: []bandwidth.Rule{{Match: "eth*", Policy: bandwidth.PolicyUnmetered}}})
+	time.Sleep(50 * time.Millisecond)
+	waitPending(4)
+	status = healthChecker.GetReport().Components["bandwidth"]
+	if status.Status != health.StatusDegraded || !strings.HasPrefix(status.Message, "uploads paused: daily budget exhausted") {
+		t.Errorf("Expected paused uploads reported, got %s: %s", status.Status, status.Message)
+	}
+	if breaker.State() != uploader.BreakerClosed {
+		t.Errorf("Expected the breaker to stay closed while paused, got %s", breaker.State())
+	}
+
+	// Back on ethernet the rest goes out regardless of the budget
+	setRoute("eth0")
+	waitPending(0)
+
+	usage, err := store.BandwidthUsage(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("BandwidthUsage failed: %v", err)
+	}
+	if usage["wwan0"].Today == 0 {
+		t.Errorf("Expected the wwan0 bytes written to storage, got %+v", usage)
+	}
+}
+
+func TestBandwidthConfigFromConfig(t *testing.T) {
+	cfg, err := bandwidthConfigFromConfig(&config.BandwidthConfig{
+		DailyBudgetMB:        2,
+		RateLimitBytesPerSec: 4096,
+		Interfaces: []config.InterfacePolicyConfig{
+			{Match: "eth0", Policy: "unmetered"},
+			{Match: "wwan*", Policy: "priority", MinPriority: "P0"},
+			{Match: "usb*", Policy: "priority"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("bandwidthConfigFromConfig failed: %v", err)
+	}
+	if cfg.DailyBudget != 2*1024*1024 || cfg.MonthlyBudget != 0 || cfg.RateLimit != 4096 {
+		t.Errorf("Unexpected budgets %+v", cfg)
+	}
+	want := []bandwidth.Rule{
+		{Match: "eth0", Policy: bandwidth.PolicyUnmetered},
+		{Match: "wwan*", Policy: bandwidth.PolicyPriority, MinPriority: models.PriorityP0},
+		{Match: "usb*", Policy: bandwidth.PolicyPriority, MinPriority: models.PriorityP1},
+	}
+	if len(cfg.Rules) != len(want) {
+		t.Fatalf("Expected rules %+v, got %+v", want, cfg.Rules)
+	}
+	for i := range want {
+		if cfg.Rules[i] != want[i] {
+			t.Errorf("Rule %d: expected %+v, got %+v", i, want[i], cfg.Rules[i])
+		}
+	}
+}
@@ -0,0 +1,539 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+	"github.com/taniwha3/tidewatch/internal/bandwidth"
+	"github.com/taniwha3/tidewatch/internal/collector"
+	"github.com/taniwha3/tidewatch/internal/config"
+	"github.com/taniwha3/tidewatch/internal/exposition"
+	"github.com/taniwha3/tidewatch/internal/health"
+	"github.com/taniwha3/tidewatch/internal/models"
+	"github.com/taniwha3/tidewatch/internal/monitoring"
+	"github.com/taniwha3/tidewatch/internal/relabel"
+	"github.com/taniwha3/tidewatch/internal/storage"
+	"github.com/taniwha3/tidewatch/internal/uploader"
+	"github.com/taniwha3/tidewatch/internal/watchdog"
+)
+
+// Config hot-reload
+// On SIGHUP the config file is loaded and validated again. A valid config is diffed against the
+// running one: collectors are started, stopped or re-timed and changed destinations get a fresh
+// uploader. An invalid config is rejected as a whole and the daemon keeps running on the old one.
+
+// loadConfig loads and fully validates a config file
+func loadConfig(path string) (*config.Config, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if err := resolveDeviceID(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateCollectorOptions(cfg); err != nil {
+		return nil, err
+	}
+	if _, err := relabel.New(relabelConfigFromConfig(&cfg.Relabel)); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// healthThresholds derives health thresholds from the upload interval and monitoring settings
+func healthThresholds(cfg *config.Config) (health.Thresholds, error) {
+	uploadInterval, err := cfg.Remote.UploadInterval()
+	if err != nil {
+		return health.Thresholds{}, err
+	}
+	thresholds := health.ThresholdsFromUploadInterval(uploadInterval)
+
+	// Override clock skew threshold if configured
+	if cfg.Monitoring.ClockSkewWarnThresholdMs > 0 {
+		thresholds.ClockSkewThresholdMs = int64(cfg.Monitoring.ClockSkewWarnThresholdMs)
+	}
+	return thresholds, nil
+}
+
+// restartRequired lists the changed settings that only take effect after a restart
+func restartRequired(old, updated *config.Config) []string {
+	var changed []string
+	if old.Device.ID != updated.Device.ID {
+		changed = append(changed, "device.id")
+	}
+	if !reflect.DeepEqual(old.Storage, updated.Storage) {
+		changed = append(changed, "storage")
+	}
+	if !reflect.DeepEqual(old.Logging, updated.Logging) {
+		changed = append(changed, "logging")
+	}
+	if !reflect.DeepEqual(old.Monitoring, updated.Monitoring) {
+		changed = append(changed, "monitoring")
+	}
+	if !reflect.DeepEqual(old.Sessions, updated.Sessions) {
+		changed = append(changed, "sessions")
+	}
+	if !reflect.DeepEqual(old.StatsD, updated.StatsD) {
+		changed = append(changed, "statsd")
+	}
+	if !reflect.DeepEqual(old.Ingest, updated.Ingest) {
+		changed = append(changed, "ingest")
+	}
+	return changed
+}
+
+// reloadConfig applies the config at path to the running collectors and uploaders
+// Returns the config now in effect: the new one on success, current on failure.
+func reloadConfig(
+	path string,
+	current *config.Config,
+	collectors *collectorManager,
+	uploads *uploadManager,
+	healthChecker *health.Checker,
+	logger *slog.Logger,
+) *config.Config {
+	updated, err := loadConfig(path)
+	if err != nil {
+		logger.Error("Config reload failed, keeping previous config",
+			slog.String("path", path),
+			slog.Any("error", err),
+		)
+		healthChecker.UpdateConfigStatus(path, err, time.Now())
+		return current
+	}
+
+	thresholds, err := healthThresholds(updated)
+	if err != nil {
+		// This should never happen since Validate() already checked it
+		healthChecker.UpdateConfigStatus(path, err, time.Now())
+		return current
+	}
+
+	// Uploads first: they are the only step that can fail, and a failure must leave everything untouched
+	if err := uploads.apply(updated); err != nil {
+		logger.Error("Config reload failed, keeping previous config",
+			slog.String("path", path),
+			slog.Any("error", err),
+		)
+		healthChecker.UpdateConfigStatus(path, err, time.Now())
+		return current
+	}
+	collectors.apply(updated)
+	healthChecker.SetThresholds(thresholds)
+
+	if changed := restartRequired(current, updated); len(changed) > 0 {
+		logger.Warn("Some config changes take effect only after a restart",
+			slog.Any("sections", changed),
+		)
+	}
+
+	healthChecker.UpdateConfigStatus(path, nil, time.Now())
+	logger.Info("Configuration reloaded",
+		slog.String("path", path),
+		slog.Int("collectors", collectors.len()),
+		slog.Int("remote_destinations", uploads.len()),
+	)
+	return updated
+}
+
+// notifySystemd sends a state change (e.g., RELOADING=1) when running under systemd
+func notifySystemd(logger *slog.Logger, state string) {
+	if !watchdog.IsRunningUnderSystemd() {
+		return
+	}
+	if _, err := daemon.SdNotify(false, state); err != nil {
+		logger.Warn("Failed to notify systemd", slog.String("state", state), slog.Any("error", err))
+	}
+}
+
+// collectorManager owns the collector goroutines so a reload can change them individually
+type collectorManager struct {
+	ctx              context.Context
+	wg               *sync.WaitGroup
+	store            storage.BatchWriter
+	latest           *exposition.Latest
+	healthChecker    *health.Checker
+	metricsCollector *monitoring.MetricsCollector
+	logger           *slog.Logger
+
+	// Shared by every collector loop and the push listeners; rules are swapped in place on reload
+	relabeler *relabel.Relabeler
+
+	running map[string]*runningCollector
+}
+
+// runningCollector is a collector loop started by the manager
+type runningCollector struct {
+	collector collector.Collector
+	interval  time.Duration
+	priority  models.Priority
+	options   map[string]interface{}
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+func newCollectorManager(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	store storage.BatchWriter,
+	relabeler *relabel.Relabeler,
+	latest *exposition.Latest,
+	healthChecker *health.Checker,
+	metricsCollector *monitoring.MetricsCollector,
+	logger *slog.Logger,
+) *collectorManager {
+	return &collectorManager{
+		ctx:              ctx,
+		wg:               wg,
+		store:            store,
+		relabeler:        relabeler,
+		latest:           latest,
+		healthChecker:    healthChecker,
+		metricsCollector: metricsCollector,
+		logger:           logger,
+		running:          make(map[string]*runningCollector),
+	}
+}
+
+// apply brings the running collectors and relabel rules in line with cfg
+// Removed or disabled collectors are stopped, collectors with new options are rebuilt,
+// collectors with only a new interval or priority keep their instance (and state, e.g. counters) and are restarted.
+func (m *collectorManager) apply(cfg *config.Config) {
+	env := collector.Env{
+		DeviceID: cfg.Device.ID,
+		Logger:   m.logger,
+	}
+
+	// loadConfig already validated the rules; a failure keeps the previous ones
+	relabelCfg := relabelConfigFromConfig(&cfg.Relabel)
+	if m.relabeler == nil {
+		relabeler, err := relabel.New(relabelCfg)
+		if err != nil {
+			m.logger.Warn("Invalid relabel rules, storing metrics unchanged", slog.Any("error", err))
+		}
+		m.relabeler = relabeler
+	} else if err := m.relabeler.Update(relabelCfg); err != nil {
+		m.logger.Warn("Invalid relabel rules, keeping previous rules", slog.Any("error", err))
+	}
+
+	wanted := make(map[string]bool)
+	for _, mc := range cfg.EnabledMetrics() {
+		wanted[mc.Name] = true
+	}
+	for name := range m.running {
+		if !wanted[name] {
+			m.stop(name)
+			m.healthChecker.RemoveComponent("collector." + name)
+			m.logger.Info("Stopped collector", slog.String("collector", name))
+		}
+	}
+
+	for _, mc := range cfg.EnabledMetrics() {
+		interval, err := mc.IntervalDuration()
+		if err != nil {
+			m.logger.Warn("Invalid interval, skipping collector",
+				slog.String("collector", mc.Name),
+				slog.Any("error", err),
+			)
+			continue
+		}
+
+		priority, err := mc.GetPriority()
+		if err != nil {
+			m.logger.Warn("Invalid priority, skipping collector",
+				slog.String("collector", mc.Name),
+				slog.Any("error", err),
+			)
+			continue
+		}
+
+		current, ok := m.running[mc.Name]
+		if ok && reflect.DeepEqual(current.options, mc.Options) {
+			if current.interval != interval || current.priority != priority {
+				m.stop(mc.Name)
+				m.start(mc.Name, current.collector, interval, priority, mc.Options)
+				m.logger.Info("Re-timed collector",
+					slog.String("collector", mc.Name),
+					slog.Duration("old_interval", current.interval),
+					slog.Duration("interval", interval),
+					slog.String("priority", string(priority)),
+				)
+			}
+			continue
+		}
+
+		reg, found := collector.Lookup(mc.Name)
+		if !found {
+			m.logger.Warn("Unknown metric, skipping",
+				slog.String("collector", mc.Name),
+				slog.Any("available", collector.Registered()),
+			)
+			continue
+		}
+
+		// Build before stopping the old instance so a factory error keeps the collector running
+		coll, err := reg.Build(env, mc.Options)
+		if err != nil {
+			m.logger.Warn("Failed to create collector, skipping",
+				slog.String("collector", mc.Name),
+				slog.Any("error", err),
+			)
+			continue
+		}
+		if ok {
+			m.stop(mc.Name)
+		}
+		m.start(mc.Name, coll, interval, priority, mc.Options)
+		m.logger.Info("Registered collector",
+			slog.String("collector", mc.Name),
+			slog.Duration("interval", interval),
+		)
+	}
+}
+
+// start launches a collector loop under its own context
+func (m *collectorManager) start(name string, coll collector.Collector, interval time.Duration, priority models.Priority, options map[string]interface{}) {
+	ctx, cancel := context.WithCancel(m.ctx)
+	rc := &runningCollector{
+		collector: coll,
+		interval:  interval,
+		priority:  priority,
+		options:   options,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	m.running[name] = rc
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer close(rc.done)
+		runCollector(ctx, name, coll, interval, priority, m.relabeler, m.store, m.latest, m.healthChecker, m.metricsCollector, m.logger)
+	}()
+}
+
+// stop cancels a collector loop and waits for it to return
+func (m *collectorManager) stop(name string) {
+	rc, ok := m.running[name]
+	if !ok {
+		return
+	}
+	rc.cancel()
+	<-rc.done
+	delete(m.running, name)
+}
+
+func (m *collectorManager) len() int {
+	return len(m.running)
+}
+
+// uploadManager owns one upload loop and HTTPUploader per destination
+type uploadManager struct {
+	ctx              context.Context
+	wg               *sync.WaitGroup
+	store            *storage.SQLiteStorage
+	meter            *bandwidth.Meter // Shared by every destination (nil = unmetered)
+	healthChecker    *health.Checker
+	metricsCollector *monitoring.MetricsCollector
+	logger           *slog.Logger
+
+	running map[string]*runningUpload
+}
+
+// runningUpload is an upload loop started by the manager
+type runningUpload struct {
+	dest      config.DestinationConfig
+	device    config.DeviceConfig
+	interval  time.Duration
+	batchSize int
+	breaker   *uploader.BreakerConfig // nil = no circuit breaker
+	upload    *uploader.HTTPUploader
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+func newUploadManager(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	store *storage.SQLiteStorage,
+	meter *bandwidth.Meter,
+	healthChecker *health.Checker,
+	metricsCollector *monitoring.MetricsCollector,
+	logger *slog.Logger,
+) *uploadManager {
+	return &uploadManager{
+		ctx:              ctx,
+		wg:               wg,
+		store:            store,
+		meter:            meter,
+		healthChecker:    healthChecker,
+		metricsCollector: metricsCollector,
+		logger:           logger,
+		running:          make(map[string]*runningUpload),
+	}
+}
+
+// apply brings the running upload loops in line with cfg
+// A destination whose settings changed (URL, protocol, auth token, retry, upload interval,
+// batch size, circuit breaker or device labels) gets a new uploader; its loop restarts and picks
+// up its queue where it left off. Bandwidth budgets and interface rules apply to the running
+// loops from their next cycle.
+func (m *uploadManager) apply(cfg *config.Config) error {
+	var dests []config.DestinationConfig
+	if cfg.Remote.Enabled {
+		dests = cfg.Remote.GetDestinations()
+	}
+	interval, err := cfg.Remote.UploadInterval()
+	if err != nil {
+		return fmt.Errorf("invalid upload interval: %w", err)
+	}
+	batchSize := cfg.Remote.GetBatchSize()
+	breaker, err := breakerConfigFromConfig(&cfg.Remote.CircuitBreaker)
+	if err != nil {
+		return fmt.Errorf("invalid circuit breaker: %w", err)
+	}
+	bandwidthCfg, err := bandwidthConfigFromConfig(&cfg.Remote.Bandwidth)
+	if err != nil {
+		return fmt.Errorf("invalid bandwidth: %w", err)
+	}
+	// Avoid a typed nil in the interface when unmetered
+	var meter uploader.Meter
+	if m.meter != nil {
+		meter = m.meter
+	}
+
+	// A single remote.url probes the clock skew URL (usually the same server) unless it has its own
+	if len(dests) == 1 && len(cfg.Remote.Destinations) == 0 && dests[0].ProbeURL == "" {
+		dests[0].ProbeURL = cfg.Monitoring.ClockSkewURL
+	}
+
+	// Build every new uploader up front so an error leaves the running loops untouched
+	changed := make(map[string]*runningUpload)
+	for _, d := range dests {
+		current, ok := m.running[d.Name]
+		if ok && reflect.DeepEqual(current.dest, d) && reflect.DeepEqual(current.device, cfg.Device) &&
+			current.interval == interval && current.batchSize == batchSize && reflect.DeepEqual(current.breaker, breaker) {
+			continue
+		}
+		upload, err := newDestinationUploader(d, cfg.Device, meter, m.logger)
+		if err != nil {
+			for _, ru := range changed {
+				ru.upload.Close()
+			}
+			return fmt.Errorf("destination %s: %w", d.Name, err)
+		}
+		changed[d.Name] = &runningUpload{
+			dest:      d,
+			device:    cfg.Device,
+			interval:  interval,
+			batchSize: batchSize,
+			breaker:   breaker,
+			upload:    upload,
+		}
+	}
+
+	// Reconcile per-destination upload queues with the configured destinations
+	// When remote is disabled the queues are kept so re-enabling it resumes the backlog
+	if len(dests) > 0 {
+		names := make([]string, 0, len(dests))
+		for _, d := range dests {
+			names = append(names, d.Name)
+		}
+		if err := m.store.SetDestinations(m.ctx, names); err != nil {
+			for _, ru := range changed {
+				ru.upload.Close()
+			}
+			return fmt.Errorf("failed to register upload destinations: %w", err)
+		}
+	}
+
+	if m.meter != nil {
+		m.meter.Configure(bandwidthCfg)
+	}
+
+	wanted := make(map[string]bool, len(dests))
+	for _, d := range dests {
+		wanted[d.Name] = true
+	}
+	for name := range m.running {
+		if !wanted[name] {
+			m.stop(name)
+			m.healthChecker.RemoveComponent(destinationComponent(name))
+			m.logger.Info("Stopped uploads", slog.String("destination", name))
+		}
+	}
+
+	for _, d := range dests {
+		ru, ok := changed[d.Name]
+		if !ok {
+			continue
+		}
+		_, restarting := m.running[d.Name]
+		m.stop(d.Name)
+		m.start(d.Name, ru)
+		m.logger.Info("Started uploads",
+			slog.String("destination", d.Name),
+			slog.String("url", d.URL),
+			slog.Bool("restarted", restarting),
+		)
+	}
+	return nil
+}
+
+// start launches an upload loop under its own context
+func (m *uploadManager) start(name string, ru *runningUpload) {
+	ctx, cancel := context.WithCancel(m.ctx)
+	ru.cancel = cancel
+	ru.done = make(chan struct{})
+	m.running[name] = ru
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer close(ru.done)
+		var breaker *uploader.Breaker
+		if ru.breaker != nil {
+			breaker = uploader.NewBreaker(*ru.breaker)
+		}
+		runUploadLoop(ctx, m.store, name, ru.upload, ru.interval, ru.batchSize, breaker, m.meter, m.healthChecker, m.metricsCollector, m.logger)
+	}()
+}
+
+// stop cancels an upload loop, waits for it to return and closes its uploader
+func (m *uploadManager) stop(name string) {
+	ru, ok := m.running[name]
+	if !ok {
+		return
+	}
+	ru.cancel()
+	<-ru.done
+	ru.upload.Close()
+	delete(m.running, name)
+}
+
+// stopAll stops every upload loop (used at shutdown)
+func (m *uploadManager) stopAll() {
+	for name := range m.running {
+		m.stop(name)
+	}
+}
+
+func (m *uploadManager) len() int {
+	return len(m.running)
+}
+
+// destinationComponent returns the health component name used for a destination
+func destinationComponent(name string) string {
+	if name == storage.DefaultDestination {
+		return "uploader"
+	}
+	return "uploader." + name
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/config"
+	"github.com/taniwha3/tidewatch/internal/health"
+	"github.com/taniwha3/tidewatch/internal/models"
+	"github.com/taniwha3/tidewatch/internal/monitoring"
+	"github.com/taniwha3/tidewatch/internal/storage"
+)
+
+// reloadHarness wires collector and upload managers to a temporary store
+type reloadHarness struct {
+	store      *storage.SQLiteStorage
+	health     *health.Checker
+	collectors *collectorManager
+	uploads    *uploadManager
+	cancel     context.CancelFunc
+	wg         *sync.WaitGroup
+}
+
+func newReloadHarness(t *testing.T) *reloadHarness {
+	t.Helper()
+
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	checker := health.NewChecker(health.DefaultThresholds())
+	metricsCollector := monitoring.NewMetricsCollector("test-device")
+	logger := testLogger()
+
+	h := &reloadHarness{
+		store:      store,
+		health:     checker,
+		collectors: newCollectorManager(ctx, wg, store, nil, nil, checker, metricsCollector, logger),
+		uploads:    newUploadManager(ctx, wg, store, nil, checker, metricsCollector, logger),
+		cancel:     cancel,
+		wg:         wg,
+	}
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+		h.uploads.stopAll()
+		store.Close()
+	})
+	return h
+}
+
+// writeConfig writes a config file and returns its path
+func writeConfig(t *testing.T, path, content string) string {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestCollectorManager_UsesRegistry(t *testing.T) {
+	h := newReloadHarness(t)
+	cfg := &config.Config{
+		Device: config.DeviceConfig{ID: "test-device"},
+		Metrics: []config.MetricConfig{
+			{Name: "memory.usage", Interval: "10s", Enabled: true},
+			{Name: "network.traffic", Interval: "5s", Enabled: true, Options: map[string]interface{}{"max_interfaces": 2}},
+			{Name: "disk.io", Interval: "10s", Enabled: false},
+			{Name: "gpu.temperature", Interval: "10s", Enabled: true},
+		},
+	}
+
+	h.collectors.apply(cfg)
+
+	if h.collectors.len() != 2 {
+		t.Fatalf("Expected 2 collectors (disabled and unknown skipped), got %d", h.collectors.len())
+	}
+	if _, ok := h.collectors.running["memory.usage"]; !ok {
+		t.Error("Expected memory.usage collector")
+	}
+	network, ok := h.collectors.running["network.traffic"]
+	if !ok {
+		t.Fatal("Expected network.traffic collector")
+	}
+	if network.interval != 5*time.Second {
+		t.Errorf("Expected network interval 5s, got %v", network.interval)
+	}
+	if network.collector.Name() != "network" {
+		t.Errorf("Expected network collector, got %s", network.collector.Name())
+	}
+}
+
+func TestCollectorManager_ApplyDiff(t *testing.T) {
+	h := newReloadHarness(t)
+	h.collectors.apply(&config.Config{
+		Device: config.DeviceConfig{ID: "test-device"},
+		Metrics: []config.MetricConfig{
+			{Name: "memory.usage", Interval: "10s", Enabled: true},
+			{Name: "cpu.usage", Interval: "10s", Enabled: true},
+			{Name: "network.traffic", Interval: "10s", Enabled: true, Options: map[string]interface{}{"max_interfaces": 2}},
+		},
+	})
+
+	memory := h.collectors.running["memory.usage"]
+	network := h.collectors.running["network.traffic"]
+
+	// Wait for the immediate first collection so the health component exists
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := h.health.GetReport().Components["collector.cpu.usage"]; ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for cpu.usage to report")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	h.collectors.apply(&config.Config{
+		Device: config.DeviceConfig{ID: "test-device"},
+		Metrics: []config.MetricConfig{
+			{Name: "memory.usage", Interval: "5s", Enabled: true},
+			{Name: "cpu.usage", Interval: "10s", Enabled: false},
+			{Name: "network.traffic", Interval: "10s", Enabled: true, Options: map[string]interface{}{"max_interfaces": 4}},
+			{Name: "disk.io", Interval: "10s", Enabled: true},
+		},
+	})
+
+	if h.collectors.len() != 3 {
+		t.Fatalf("Expected 3 collectors after reload, got %d", h.collectors.len())
+	}
+
+	retimed := h.collectors.running["memory.usage"]
+	if retimed.interval != 5*time.Second {
+		t.Errorf("Expected memory.usage re-timed to 5s, got %v", retimed.interval)
+	}
+	if retimed.collector != memory.collector {
+		t.Error("Expected an interval change to keep the collector instance")
+	}
+
+	if h.collectors.running["network.traffic"].collector == network.collector {
+		t.Error("Expected an options change to rebuild the collector")
+	}
+
+	if _, ok := h.collectors.running["cpu.usage"]; ok {
+		t.Error("Expected disabled cpu.usage to be stopped")
+	}
+	if _, ok := h.health.GetReport().Components["collector.cpu.usage"]; ok {
+		t.Error("Expected stopped collector to be removed from health")
+	}
+
+	if _, ok := h.collectors.running["disk.io"]; !ok {
+		t.Error("Expected new disk.io collector to be started")
+	}
+}
+
+func TestUploadManager_ApplyRebuildsChangedDestinations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	h := newReloadHarness(t)
+	cfg := &config.Config{
+		Device: config.DeviceConfig{ID: "test-device"},
+		Remote: config.RemoteConfig{
+			Enabled:           true,
+			URL:               server.URL,
+			AuthToken:         "old-token",
+			UploadIntervalStr: "30s",
+		},
+	}
+	if err := h.uploads.apply(cfg); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	first := h.uploads.running[storage.DefaultDestination]
+	if first == nil {
+		t.Fatal("Expected default destination to be running")
+	}
+
+	// An identical config keeps the running uploader
+	if err := h.uploads.apply(cfg); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if h.uploads.running[storage.DefaultDestination] != first {
+		t.Error("Expected an unchanged destination to keep its uploader")
+	}
+
+	// A new token rebuilds the uploader
+	rotated := *cfg
+	rotated.Remote.AuthToken = "new-token"
+	if err := h.uploads.apply(&rotated); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	second := h.uploads.running[storage.DefaultDestination]
+	if second == first {
+		t.Fatal("Expected a token change to rebuild the uploader")
+	}
+	if second.dest.AuthToken != "new-token" {
+		t.Errorf("Expected new token, got %q", second.dest.AuthToken)
+	}
+
+	// New device labels rebuild the uploader too
+	labeled := rotated
+	labeled.Device.Labels = map[string]string{"site": "depot"}
+	if err := h.uploads.apply(&labeled); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if third := h.uploads.running[storage.DefaultDestination]; third == second || third.device.Labels["site"] != "depot" {
+		t.Error("Expected a device label change to rebuild the uploader")
+	}
+
+	// Disabling remote stops every upload loop and clears its health component
+	h.health.UpdateUploaderStatus(time.Now(), nil, 0)
+	disabled := rotated
+	disabled.Remote.Enabled = false
+	if err := h.uploads.apply(&disabled); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if h.uploads.len() != 0 {
+		t.Errorf("Expected no upload loops with remote disabled, got %d", h.uploads.len())
+	}
+	if _, ok := h.health.GetReport().Components["uploader"]; ok {
+		t.Error("Expected uploader component to be removed")
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	dir := t.TempDir()
+	tokenPath := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenPath, []byte("token-1\n"), 0600); err != nil {
+		t.Fatalf("Failed to write token: %v", err)
+	}
+
+	base := `
+device:
+  id: test-device
+storage:
+  path: ` + filepath.Join(dir, "metrics.db") + `
+remote:
+  enabled: true
+  url: http://127.0.0.1:1/api/v1/import
+  auth_token_file: ` + tokenPath + `
+  upload_interval: 30s
+metrics:
+  - name: memory.usage
+    interval: INTERVAL
+    enabled: true
+`
+	configPath := writeConfig(t, filepath.Join(dir, "config.yaml"), strings.Replace(base, "INTERVAL", "10s", 1))
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+
+	h := newReloadHarness(t)
+	if err := h.uploads.apply(cfg); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	h.collectors.apply(cfg)
+	logger := testLogger()
+
+	// An invalid config is rejected and reported, the running config stays in place
+	writeConfig(t, configPath, strings.Replace(base, "INTERVAL", "soon", 1))
+	got := reloadConfig(configPath, cfg, h.collectors, h.uploads, h.health, logger)
+	if got != cfg {
+		t.Error("Expected failed reload to keep the previous config")
+	}
+	status := h.health.GetReport().Components["config"]
+	if status.Status != health.StatusDegraded || !strings.Contains(status.Message, "keeping previous config") {
+		t.Errorf("Expected degraded config status, got %+v", status)
+	}
+	if h.collectors.running["memory.usage"].interval != 10*time.Second {
+		t.Error("Expected collectors to be untouched by a failed reload")
+	}
+
+	// A valid config with a new interval and a rotated token file is applied
+	if err := os.WriteFile(tokenPath, []byte("token-2\n"), 0600); err != nil {
+		t.Fatalf("Failed to rotate token: %v", err)
+	}
+	writeConfig(t, configPath, strings.Replace(base, "INTERVAL", "5s", 1))
+	got = reloadConfig(configPath, cfg, h.collectors, h.uploads, h.health, logger)
+	if got == cfg {
+		t.Fatal("Expected successful reload to return the new config")
+	}
+	if status := h.health.GetReport().Components["config"]; status.Status != health.StatusOK {
+		t.Errorf("Expected config status OK after a good reload, got %+v", status)
+	}
+	if h.collectors.running["memory.usage"].interval != 5*time.Second {
+		t.Error("Expected collector to be re-timed")
+	}
+	if token := h.uploads.running[storage.DefaultDestination].dest.AuthToken; token != "token-2" {
+		t.Errorf("Expected uploader rebuilt with the rotated token, got %q", token)
+	}
+}
+
+func TestReloadConfig_RelabelRules(t *testing.T) {
+	dir := t.TempDir()
+	base := `
+device:
+  id: test-device
+storage:
+  path: ` + filepath.Join(dir, "metrics.db") + `
+metrics:
+  - name: memory.usage
+    interval: 1h
+    enabled: true
+relabel:
+  rules:
+    - action: ACTION
+      source_labels: [__name__]
+      regex: 'memory\..*'
+`
+	configPath := writeConfig(t, filepath.Join(dir, "config.yaml"), strings.Replace(base, "ACTION", "keep", 1))
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+
+	h := newReloadHarness(t)
+	h.collectors.apply(cfg)
+	relabeler := h.collectors.relabeler
+	sample := func() int {
+		kept, _ := relabeler.Apply([]*models.Metric{models.NewMetric("memory.used_bytes", 1, "test-device")})
+		return len(kept)
+	}
+	if sample() != 1 {
+		t.Fatal("Expected memory metrics kept by the initial rules")
+	}
+
+	// Invalid rules are rejected with the rest of the config
+	writeConfig(t, configPath, strings.Replace(base, "ACTION", "explode", 1))
+	if got := reloadConfig(configPath, cfg, h.collectors, h.uploads, h.health, testLogger()); got != cfg {
+		t.Error("Expected invalid relabel rules to keep the previous config")
+	}
+
+	// New rules take effect in the running collectors without a restart
+	writeConfig(t, configPath, strings.Replace(base, "ACTION", "drop", 1))
+	if got := reloadConfig(configPath, cfg, h.collectors, h.uploads, h.health, testLogger()); got == cfg {
+		t.Fatal("Expected the reload to succeed")
+	}
+	if h.collectors.relabeler != relabeler {
+		t.Error("Expected the running relabeler to be updated in place")
+	}
+	if sample() != 0 {
+		t.Error("Expected memory metrics dropped after the reload")
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	old := &config.Config{
+		Device:  config.DeviceConfig{ID: "a"},
+		Storage: config.StorageConfig{Path: "/var/lib/tidewatch/metrics.db"},
+	}
+	updated := *old
+	if changed := restartRequired(old, &updated); len(changed) != 0 {
+		t.Errorf("Expected no restart-only changes, got %v", changed)
+	}
+
+	updated.Device.ID = "b"
+	updated.Storage.Path = "/tmp/metrics.db"
+	changed := restartRequired(old, &updated)
+	if len(changed) != 2 || changed[0] != "device.id" || changed[1] != "storage" {
+		t.Errorf("Expected [device.id storage], got %v", changed)
+	}
+}
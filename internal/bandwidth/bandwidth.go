@@ -0,0 +1,361 @@
+// Package bandwidth keeps uploads within the limits of metered links. It detects the interface
+// carrying the default route, applies the policy configured for it (upload everything, or only
+// priority classes), accounts the bytes sent per interface and day, pauses uploads once a daily or
+// monthly budget is used up and paces requests to a rate limit.
+package bandwidth
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+	"github.com/taniwha3/tidewatch/internal/storage"
+)
+
+// Policy is how uploads use a network interface
+type Policy string
+
+const (
+	PolicyUnmetered Policy = "unmetered" // Upload everything, no budgets or rate limit (e.g., eth0, wlan0)
+	PolicyMetered   Policy = "metered"   // Upload everything within the budgets and rate limit
+	PolicyPriority  Policy = "priority"  // Upload only priority classes, within the budgets and rate limit (e.g., wwan*)
+)
+
+// UnknownInterface is the name usage is accounted under when no default route is found
+const UnknownInterface = "unknown"
+
+// Rule sets the policy of the interfaces whose name matches a glob
+type Rule struct {
+	Match       string          // Interface name glob, e.g. "wwan*"
+	Policy      Policy          // Default: metered
+	MinPriority models.Priority // PolicyPriority: lowest class uploaded (default: P1, i.e. P0 and P1)
+}
+
+// Store accounts bandwidth usage
+type Store interface {
+	AddBandwidth(ctx context.Context, iface string, bytes int64, now time.Time) error
+	BandwidthUsage(ctx context.Context, now time.Time) (map[string]storage.InterfaceUsage, error)
+}
+
+// Config configures a Meter
+type Config struct {
+	DailyBudget   int64  // Bytes per local day over metered interfaces (0 = unlimited)
+	MonthlyBudget int64  // Bytes per calendar month over metered interfaces (0 = unlimited)
+	RateLimit     int64  // Bytes per second over metered interfaces (0 = unlimited)
+	Rules         []Rule // First match wins; interfaces matching no rule are metered
+	ProcRoot      string // Default: /proc
+	Logger        *slog.Logger
+}
+
+// Decision is what an upload cycle may send
+type Decision struct {
+	Interface   string
+	Policy      Policy
+	MinPriority models.Priority // Lowest class to upload (P3 = everything)
+	Paused      bool            // A budget is used up: skip the cycle
+	Reason      string          // Why uploads are paused
+}
+
+// Status is the current policy and usage, for health and meta-metrics
+type Status struct {
+	Decision
+	Today         int64 // Bytes sent today over metered interfaces
+	Month         int64 // Bytes sent this month over metered interfaces
+	DailyBudget   int64
+	MonthlyBudget int64
+	Interfaces    map[string]storage.InterfaceUsage // Usage of every interface, metered or not
+}
+
+// Meter decides what uploads may send and accounts what they sent
+// It implements uploader.Meter; one Meter is shared by every destination, since they share the link.
+// Bytes are buffered in memory and written to the store on the next Check or Flush.
+type Meter struct {
+	store  Store
+	logger *slog.Logger
+
+	// System access, replaced in tests
+	now            func() time.Time
+	routeInterface func() (string, error)
+
+	mu       sync.Mutex
+	cfg      Config
+	decision Decision
+	usage    map[string]storage.InterfaceUsage
+	pending  map[pendingKey]int64
+	next     time.Time // When the rate limit lets the next request go
+	routeErr string    // Last route lookup error, so repeats are not logged every cycle
+}
+
+// pendingKey identifies bytes not yet written to the store
+type pendingKey struct {
+	iface string
+	day   time.Time // Local midnight
+}
+
+// New creates a meter; until the first Check uploads are accounted to UnknownInterface
+func New(cfg Config, store Store) *Meter {
+	m := &Meter{
+		store:    store,
+		logger:   cfg.Logger,
+		now:      time.Now,
+		usage:    make(map[string]storage.InterfaceUsage),
+		pending:  make(map[pendingKey]int64),
+		decision: Decision{Interface: UnknownInterface, Policy: PolicyMetered, MinPriority: models.PriorityP3},
+	}
+	if m.logger == nil {
+		m.logger = slog.Default()
+	}
+	procRoot := cfg.ProcRoot
+	if procRoot == "" {
+		procRoot = "/proc"
+	}
+	m.routeInterface = func() (string, error) { return defaultRouteInterface(procRoot) }
+	m.cfg = cfg
+	return m
+}
+
+// Configure replaces budgets, rate limit and rules (e.g., on config reload); usage is kept
+func (m *Meter) Configure(cfg Config) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cfg.DailyBudget = cfg.DailyBudget
+	m.cfg.MonthlyBudget = cfg.MonthlyBudget
+	m.cfg.RateLimit = cfg.RateLimit
+	m.cfg.Rules = cfg.Rules
+}
+
+// Check detects the uploading interface, writes buffered usage and decides what the next cycle may send
+// A cycle that starts within the budgets runs to completion, so a budget can be exceeded by one batch.
+func (m *Meter) Check(ctx context.Context) (Decision, error) {
+	iface, err := m.routeInterface()
+	m.mu.Lock()
+	if err != nil {
+		if msg := err.Error(); msg != m.routeErr {
+			m.logger.Warn("Failed to find the default route interface, accounting uploads as unknown",
+				slog.Any("error", err),
+			)
+			m.routeErr = msg
+		}
+		iface = UnknownInterface
+	} else {
+		m.routeErr = ""
+	}
+	m.mu.Unlock()
+
+	if err := m.Flush(ctx); err != nil {
+		return m.Decision(), err
+	}
+	now := m.now()
+	usage, err := m.store.BandwidthUsage(ctx, now)
+	if err != nil {
+		return m.Decision(), err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Bytes sent since the flush are not in the query yet
+	for key, bytes := range m.pending {
+		u := usage[key.iface]
+		u.Month += bytes
+		if key.day.Equal(midnight(now)) {
+			u.Today += bytes
+		}
+		usage[key.iface] = u
+	}
+	m.usage = usage
+
+	rule := m.match(iface)
+	d := Decision{Interface: iface, Policy: rule.Policy, MinPriority: models.PriorityP3}
+	if rule.Policy == PolicyPriority {
+		d.MinPriority = rule.MinPriority
+	}
+	if rule.Policy != PolicyUnmetered {
+		today, month := m.meteredUsage()
+		switch {
+		case m.cfg.DailyBudget > 0 && today >= m.cfg.DailyBudget:
+			d.Paused = true
+			d.Reason = fmt.Sprintf("daily budget exhausted (%d of %d bytes)", today, m.cfg.DailyBudget)
+		case m.cfg.MonthlyBudget > 0 && month >= m.cfg.MonthlyBudget:
+			d.Paused = true
+			d.Reason = fmt.Sprintf("monthly budget exhausted (%d of %d bytes)", month, m.cfg.MonthlyBudget)
+		}
+	}
+	m.decision = d
+	return d, nil
+}
+
+// Decision returns the result of the last Check
+func (m *Meter) Decision() Decision {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.decision
+}
+
+// Status returns the last decision with the usage it was based on
+func (m *Meter) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	today, month := m.meteredUsage()
+	interfaces := make(map[string]storage.InterfaceUsage, len(m.usage))
+	for iface, u := range m.usage {
+		interfaces[iface] = u
+	}
+	return Status{
+		Decision:      m.decision,
+		Today:         today,
+		Month:         month,
+		DailyBudget:   m.cfg.DailyBudget,
+		MonthlyBudget: m.cfg.MonthlyBudget,
+		Interfaces:    interfaces,
+	}
+}
+
+// Wait blocks until n bytes may be sent under the rate limit of the current interface
+// Requests are paced one after another: each starts once the previous ones' bytes have had time to go out.
+func (m *Meter) Wait(ctx context.Context, n int) error {
+	m.mu.Lock()
+	if m.cfg.RateLimit <= 0 || m.decision.Policy == PolicyUnmetered {
+		m.mu.Unlock()
+		return nil
+	}
+	now := m.now()
+	if m.next.Before(now) {
+		m.next = now
+	}
+	wait := m.next.Sub(now)
+	m.next = m.next.Add(time.Duration(float64(n) / float64(m.cfg.RateLimit) * float64(time.Second)))
+	m.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Sent accounts n bytes to the current interface
+func (m *Meter) Sent(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	iface := m.decision.Interface
+	m.pending[pendingKey{iface: iface, day: midnight(now)}] += int64(n)
+	u := m.usage[iface]
+	u.Today += int64(n)
+	u.Month += int64(n)
+	m.usage[iface] = u
+}
+
+// Flush writes buffered usage to the store
+func (m *Meter) Flush(ctx context.Context) error {
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = make(map[pendingKey]int64)
+	m.mu.Unlock()
+
+	for key, bytes := range pending {
+		if err := m.store.AddBandwidth(ctx, key.iface, bytes, key.day); err != nil {
+			// Keep what was not written for the next flush
+			m.mu.Lock()
+			for k, b := range pending {
+				m.pending[k] += b
+			}
+			m.mu.Unlock()
+			return err
+		}
+		delete(pending, key)
+	}
+	return nil
+}
+
+// match returns the rule for an interface with defaults applied; m.mu must be held
+func (m *Meter) match(iface string) Rule {
+	rule := Rule{Match: "*", Policy: PolicyMetered}
+	for _, r := range m.cfg.Rules {
+		if ok, _ := path.Match(r.Match, iface); ok {
+			rule = r
+			break
+		}
+	}
+	if rule.Policy == "" {
+		rule.Policy = PolicyMetered
+	}
+	if rule.Policy == PolicyPriority && rule.MinPriority == models.PriorityDefault {
+		rule.MinPriority = models.PriorityP1
+	}
+	return rule
+}
+
+// meteredUsage sums today's and this month's bytes over interfaces that are not unmetered; m.mu must be held
+func (m *Meter) meteredUsage() (today, month int64) {
+	for iface, u := range m.usage {
+		if m.match(iface).Policy == PolicyUnmetered {
+			continue
+		}
+		today += u.Today
+		month += u.Month
+	}
+	return today, month
+}
+
+// midnight returns the start of t's local day
+func midnight(t time.Time) time.Time {
+	y, mo, d := t.Date()
+	return time.Date(y, mo, d, 0, 0, 0, 0, t.Location())
+}
+
+// defaultRouteInterface returns the interface of the IPv4 default route with the lowest metric
+func defaultRouteInterface(procRoot string) (string, error) {
+	f, err := os.Open(filepath.Join(procRoot, "net", "route"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	best, bestMetric := "", -1
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // Header
+	for scanner.Scan() {
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil || flags&0x1 == 0 { // RTF_UP
+			continue
+		}
+		metric, err := strconv.Atoi(fields[6])
+		if err != nil {
+			continue
+		}
+		if bestMetric < 0 || metric < bestMetric {
+			best, bestMetric = fields[0], metric
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if best == "" {
+		return "", fmt.Errorf("no default route")
+	}
+	return best, nil
+}
@@ -0,0 +1,247 @@
+package bandwidth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+	"github.com/taniwha3/tidewatch/internal/storage"
+)
+
+// fakeStore keeps usage per interface for the current day only
+type fakeStore struct {
+	usage map[string]storage.InterfaceUsage
+	err   error
+}
+
+func (s *fakeStore) AddBandwidth(ctx context.Context, iface string, bytes int64, now time.Time) error {
+	if s.err != nil {
+		return s.err
+	}
+	u := s.usage[iface]
+	u.Today += bytes
+	u.Month += bytes
+	s.usage[iface] = u
+	return nil
+}
+
+func (s *fakeStore) BandwidthUsage(ctx context.Context, now time.Time) (map[string]storage.InterfaceUsage, error) {
+	usage := make(map[string]storage.InterfaceUsage, len(s.usage))
+	for iface, u := range s.usage {
+		usage[iface] = u
+	}
+	return usage, s.err
+}
+
+// newTestMeter builds a meter on a fake clock routing through *iface
+func newTestMeter(cfg Config, store *fakeStore, now *time.Time, iface *string) *Meter {
+	cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	m := New(cfg, store)
+	m.now = func() time.Time { return *now }
+	m.routeInterface = func() (string, error) {
+		if *iface == "" {
+			return "", errors.New("no default route")
+		}
+		return *iface, nil
+	}
+	return m
+}
+
+func TestMeter_Policies(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	iface := "eth0"
+	st := &fakeStore{usage: map[string]storage.InterfaceUsage{}}
+	m := newTestMeter(Config{
+		DailyBudget: 1000,
+		Rules: []Rule{
+			{Match: "eth*", Policy: PolicyUnmetered},
+			{Match: "wlan0", Policy: PolicyUnmetered},
+			{Match: "wwan*", Policy: PolicyPriority},
+			{Match: "usb*", Policy: PolicyPriority, MinPriority: models.PriorityP0},
+		},
+	}, st, &now, &iface)
+
+	tests := []struct {
+		iface       string
+		policy      Policy
+		minPriority models.Priority
+	}{
+		{"eth0", PolicyUnmetered, models.PriorityP3},
+		{"wlan0", PolicyUnmetered, models.PriorityP3},
+		{"wwan0", PolicyPriority, models.PriorityP1},
+		{"usb0", PolicyPriority, models.PriorityP0},
+		{"ppp0", PolicyMetered, models.PriorityP3}, // No rule
+		{"", PolicyMetered, models.PriorityP3},     // No default route
+	}
+	for _, tt := range tests {
+		iface = tt.iface
+		d, err := m.Check(ctx)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		wantIface := tt.iface
+		if wantIface == "" {
+			wantIface = UnknownInterface
+		}
+		if d.Interface != wantIface || d.Policy != tt.policy || d.MinPriority != tt.minPriority || d.Paused {
+			t.Errorf("%q: expected %s/%s, got %+v", tt.iface, tt.policy, tt.minPriority, d)
+		}
+	}
+}
+
+func TestMeter_Budgets(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	iface := "wwan0"
+	st := &fakeStore{usage: map[string]storage.InterfaceUsage{
+		"eth0":  {Today: 50000, Month: 50000}, // Unmetered traffic never counts
+		"wwan0": {Today: 400, Month: 9000},
+	}}
+	m := newTestMeter(Config{
+		DailyBudget:   1000,
+		MonthlyBudget: 10000,
+		Rules:         []Rule{{Match: "eth0", Policy: PolicyUnmetered}},
+	}, st, &now, &iface)
+
+	if d, _ := m.Check(ctx); d.Paused {
+		t.Fatalf("Expected uploads within budget, got %+v", d)
+	}
+
+	// Bytes sent during the cycle count at the next check, before they are written
+	m.Sent(700)
+	if got := m.Status(); got.Today != 1100 || got.Interfaces["wwan0"].Today != 1100 {
+		t.Errorf("Expected sent bytes in the status right away, got %+v", got)
+	}
+	d, err := m.Check(ctx)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if !d.Paused || d.Reason != "daily budget exhausted (1100 of 1000 bytes)" {
+		t.Errorf("Expected the daily budget to pause uploads, got %+v", d)
+	}
+	if st.usage["wwan0"].Today != 1100 {
+		t.Errorf("Expected the sent bytes written by Check, got %+v", st.usage["wwan0"])
+	}
+
+	// A new day only lifts the daily budget
+	st.usage["wwan0"] = storage.InterfaceUsage{Today: 0, Month: 10100}
+	if d, _ := m.Check(ctx); !d.Paused || d.Reason != "monthly budget exhausted (10100 of 10000 bytes)" {
+		t.Errorf("Expected the monthly budget to pause uploads, got %+v", d)
+	}
+
+	// Over an unmetered link budgets do not apply
+	iface = "eth0"
+	if d, _ := m.Check(ctx); d.Paused {
+		t.Errorf("Expected uploads over eth0 regardless of budgets, got %+v", d)
+	}
+
+	// Raising the budget on reload resumes uploads
+	iface = "wwan0"
+	m.Configure(Config{MonthlyBudget: 20000, Rules: []Rule{{Match: "eth0", Policy: PolicyUnmetered}}})
+	if d, _ := m.Check(ctx); d.Paused {
+		t.Errorf("Expected uploads after raising the budget, got %+v", d)
+	}
+}
+
+func TestMeter_FlushKeepsUsageOnError(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	iface := "wwan0"
+	st := &fakeStore{usage: map[string]storage.InterfaceUsage{}}
+	m := newTestMeter(Config{}, st, &now, &iface)
+
+	m.Check(ctx)
+	m.Sent(300)
+	st.err = errors.New("database is locked")
+	if err := m.Flush(ctx); err == nil {
+		t.Fatal("Expected the store error")
+	}
+
+	st.err = nil
+	m.Sent(200)
+	if err := m.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if st.usage["wwan0"].Today != 500 {
+		t.Errorf("Expected 500 bytes written after the retry, got %+v", st.usage["wwan0"])
+	}
+}
+
+func TestMeter_RateLimit(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	iface := "wwan0"
+	st := &fakeStore{usage: map[string]storage.InterfaceUsage{}}
+	m := newTestMeter(Config{
+		RateLimit: 1000,
+		Rules:     []Rule{{Match: "eth0", Policy: PolicyUnmetered}},
+	}, st, &now, &iface)
+	m.Check(ctx)
+
+	// The first request goes right away, the next waits for the first one's bytes
+	if err := m.Wait(ctx, 50); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	start := time.Now()
+	if err := m.Wait(ctx, 50); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if waited := time.Since(start); waited < 40*time.Millisecond {
+		t.Errorf("Expected about 50ms of pacing at 1000 B/s, waited %v", waited)
+	}
+
+	// A cancelled context stops the wait
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := m.Wait(cancelled, 5000); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	// Unmetered interfaces are not paced
+	iface = "eth0"
+	m.Check(ctx)
+	start = time.Now()
+	if err := m.Wait(ctx, 1000000); err != nil || time.Since(start) > 20*time.Millisecond {
+		t.Errorf("Expected no pacing over eth0 (err: %v)", err)
+	}
+}
+
+func TestDefaultRouteInterface(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "net"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(root, "net", "route"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	header := "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n"
+
+	// The default route with the lowest metric wins; down routes and subnets are skipped
+	write(header +
+		"wwan0\t00000000\t0100000A\t0003\t0\t0\t700\t00000000\t0\t0\t0\n" +
+		"eth0\t0001A8C0\t00000000\t0001\t0\t0\t100\t00FFFFFF\t0\t0\t0\n" +
+		"wlan0\t00000000\t0101A8C0\t0002\t0\t0\t50\t00000000\t0\t0\t0\n" +
+		"usb0\t00000000\t012AA8C0\t0003\t0\t0\t600\t00000000\t0\t0\t0\n")
+	if got, err := defaultRouteInterface(root); err != nil || got != "usb0" {
+		t.Errorf("Expected usb0, got %q (err: %v)", got, err)
+	}
+
+	write(header + "eth0\t0001A8C0\t00000000\t0001\t0\t0\t100\t00FFFFFF\t0\t0\t0\n")
+	if _, err := defaultRouteInterface(root); err == nil {
+		t.Error("Expected an error without a default route")
+	}
+
+	if _, err := defaultRouteInterface(filepath.Join(root, "missing")); err == nil {
+		t.Error("Expected an error without /proc/net/route")
+	}
+}
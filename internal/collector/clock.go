@@ -135,7 +135,7 @@ func (c *ClockSkewCollector) Collect(ctx context.Context) ([]*models.Metric, err
 	c.lastSkewMs = skewMs
 
 	// Emit metric
-	metric := models.NewMetric("time.skew_ms", float64(skewMs), c.deviceID)
+	metric := models.NewMetric("time.skew_ms", float64(skewMs), c.deviceID).AsGauge("ms")
 
 	return []*models.Metric{metric}, nil
 }
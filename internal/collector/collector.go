@@ -14,3 +14,24 @@ type Collector interface {
 	// Collect gathers metrics and returns them
 	Collect(ctx context.Context) ([]*models.Metric, error)
 }
+
+// Streamer is implemented by collectors that gather data continuously in the background
+// Start is called once before the first Collect and must return when ctx is cancelled;
+// Collect then returns what was gathered since the previous call
+type Streamer interface {
+	Start(ctx context.Context)
+}
+
+// SourceReporter is implemented by collectors that read several independent sources (e.g., files)
+// Sources returns the outcome of each source in the last Collect, so one bad source shows up in
+// health on its own instead of failing the whole collector
+type SourceReporter interface {
+	Sources() []SourceStatus
+}
+
+// SourceStatus is the outcome of one source in the last Collect
+type SourceStatus struct {
+	Name    string
+	Metrics int
+	Err     error
+}
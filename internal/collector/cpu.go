@@ -49,6 +49,15 @@ func NewCPUCollector(deviceID string) *CPUCollector {
 	}
 }
 
+func init() {
+	Register(Registration{
+		Name: "cpu.usage",
+		New: func(env Env, _ Options) (Collector, error) {
+			return NewCPUCollector(env.DeviceID), nil
+		},
+	})
+}
+
 // Name returns the collector name
 func (c *CPUCollector) Name() string {
 	return "cpu"
@@ -77,13 +86,13 @@ func (c *CPUCollector) collectMock() []*models.Metric {
 	// Per-core metrics (4 cores)
 	for i := 0; i < 4; i++ {
 		usage := 45.2 + float64(i)*5.0 // Different usage per core
-		m := models.NewMetric("cpu.core_usage_percent", usage, c.deviceID).
+		m := models.NewMetric("cpu.core_usage_percent", usage, c.deviceID).AsGauge("percent").
 			WithTag("core", fmt.Sprintf("%d", i))
 		metrics = append(metrics, m)
 	}
 
 	// Overall CPU usage (no tags)
-	overallMetric := models.NewMetric("cpu.usage_percent", 52.5, c.deviceID)
+	overallMetric := models.NewMetric("cpu.usage_percent", 52.5, c.deviceID).AsGauge("percent")
 	metrics = append(metrics, overallMetric)
 
 	return metrics
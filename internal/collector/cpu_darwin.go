@@ -29,7 +29,7 @@ func (c *CPUCollector) collect(ctx context.Context) ([]*models.Metric, error) {
 		totalUsage += corePercent
 
 		// Per-core metric
-		m := models.NewMetric("cpu.core_usage_percent", corePercent, c.deviceID).
+		m := models.NewMetric("cpu.core_usage_percent", corePercent, c.deviceID).AsGauge("percent").
 			WithTag("core", strconv.Itoa(i))
 		metrics = append(metrics, m)
 	}
@@ -37,7 +37,7 @@ func (c *CPUCollector) collect(ctx context.Context) ([]*models.Metric, error) {
 	// Overall CPU usage (average across all cores)
 	if len(perCorePercents) > 0 {
 		avgUsage := totalUsage / float64(len(perCorePercents))
-		m := models.NewMetric("cpu.usage_percent", avgUsage, c.deviceID)
+		m := models.NewMetric("cpu.usage_percent", avgUsage, c.deviceID).AsGauge("percent")
 		metrics = append(metrics, m)
 	}
 
@@ -63,12 +63,12 @@ func (c *CPUCollector) collect(ctx context.Context) ([]*models.Metric, error) {
 		// Create metric
 		if coreName == "cpu" {
 			// Aggregate "all" cores metric
-			m := models.NewMetric("cpu.usage_percent", usagePercent, c.deviceID)
+			m := models.NewMetric("cpu.usage_percent", usagePercent, c.deviceID).AsGauge("percent")
 			metrics = append(metrics, m)
 		} else {
 			// Per-core metric
 			coreNum := strings.TrimPrefix(coreName, "cpu")
-			m := models.NewMetric("cpu.core_usage_percent", usagePercent, c.deviceID).
+			m := models.NewMetric("cpu.core_usage_percent", usagePercent, c.deviceID).AsGauge("percent").
 				WithTag("core", coreNum)
 			metrics = append(metrics, m)
 		}
@@ -56,6 +56,21 @@ func NewDiskCollectorWithConfig(cfg DiskCollectorConfig) *DiskCollector {
 	return c
 }
 
+func init() {
+	Register(Registration{
+		Name: "disk.io",
+		Options: []OptionSpec{
+			{Name: "allowed_pattern", Type: OptionRegex, Description: "Regex of block devices to report (default: physical disks and partitions)"},
+		},
+		New: func(env Env, opts Options) (Collector, error) {
+			return NewDiskCollectorWithConfig(DiskCollectorConfig{
+				DeviceID:       env.DeviceID,
+				AllowedPattern: opts.String("allowed_pattern"),
+			}), nil
+		},
+	})
+}
+
 // Name returns the collector name
 func (c *DiskCollector) Name() string {
 	return "disk"
@@ -96,7 +111,7 @@ func (c *DiskCollector) Collect(ctx context.Context) ([]*models.Metric, error) {
 		// Reads completed (field 3)
 		readsCompleted, _ := strconv.ParseUint(fields[3], 10, 64)
 		metrics = append(metrics,
-			models.NewMetric("disk.read_ops_total", float64(readsCompleted), c.deviceID).
+			models.NewMetric("disk.read_ops_total", float64(readsCompleted), c.deviceID).AsCounter("").
 				WithTag("device", device))
 
 		// Sectors read (field 5) -> convert to bytes
@@ -104,13 +119,13 @@ func (c *DiskCollector) Collect(ctx context.Context) ([]*models.Metric, error) {
 		sectorsRead, _ := strconv.ParseUint(fields[5], 10, 64)
 		readBytes := sectorsRead * 512
 		metrics = append(metrics,
-			models.NewMetric("disk.read_bytes_total", float64(readBytes), c.deviceID).
+			models.NewMetric("disk.read_bytes_total", float64(readBytes), c.deviceID).AsCounter("bytes").
 				WithTag("device", device))
 
 		// Writes completed (field 7)
 		writesCompleted, _ := strconv.ParseUint(fields[7], 10, 64)
 		metrics = append(metrics,
-			models.NewMetric("disk.write_ops_total", float64(writesCompleted), c.deviceID).
+			models.NewMetric("disk.write_ops_total", float64(writesCompleted), c.deviceID).AsCounter("").
 				WithTag("device", device))
 
 		// Sectors written (field 9) -> convert to bytes
@@ -118,32 +133,32 @@ func (c *DiskCollector) Collect(ctx context.Context) ([]*models.Metric, error) {
 		sectorsWritten, _ := strconv.ParseUint(fields[9], 10, 64)
 		writeBytes := sectorsWritten * 512
 		metrics = append(metrics,
-			models.NewMetric("disk.write_bytes_total", float64(writeBytes), c.deviceID).
+			models.NewMetric("disk.write_bytes_total", float64(writeBytes), c.deviceID).AsCounter("bytes").
 				WithTag("device", device))
 
 		// Time spent reading (field 6, in milliseconds)
 		timeReading, _ := strconv.ParseUint(fields[6], 10, 64)
 		metrics = append(metrics,
-			models.NewMetric("disk.read_time_ms_total", float64(timeReading), c.deviceID).
+			models.NewMetric("disk.read_time_ms_total", float64(timeReading), c.deviceID).AsCounter("ms").
 				WithTag("device", device))
 
 		// Time spent writing (field 10, in milliseconds)
 		timeWriting, _ := strconv.ParseUint(fields[10], 10, 64)
 		metrics = append(metrics,
-			models.NewMetric("disk.write_time_ms_total", float64(timeWriting), c.deviceID).
+			models.NewMetric("disk.write_time_ms_total", float64(timeWriting), c.deviceID).AsCounter("ms").
 				WithTag("device", device))
 
 		// IOs currently in progress (field 11, gauge not counter)
 		iosInProgress, _ := strconv.ParseUint(fields[11], 10, 64)
 		metrics = append(metrics,
-			models.NewMetric("disk.io_in_progress", float64(iosInProgress), c.deviceID).
+			models.NewMetric("disk.io_in_progress", float64(iosInProgress), c.deviceID).AsGauge("").
 				WithTag("device", device))
 
 		// Weighted time doing I/O (field 13, in milliseconds)
 		// This accounts for parallel operations
 		weightedTime, _ := strconv.ParseUint(fields[13], 10, 64)
 		metrics = append(metrics,
-			models.NewMetric("disk.io_time_weighted_ms_total", float64(weightedTime), c.deviceID).
+			models.NewMetric("disk.io_time_weighted_ms_total", float64(weightedTime), c.deviceID).AsCounter("ms").
 				WithTag("device", device))
 	}
 
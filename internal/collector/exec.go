@@ -0,0 +1,579 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+const (
+	// DefaultExecTimeout is how long a command may run before its process group is killed
+	DefaultExecTimeout = 10 * time.Second
+
+	// DefaultExecMaxOutput caps the stdout read from a command
+	DefaultExecMaxOutput = 64 * 1024
+
+	// execStderrLimit caps the stderr kept for error messages
+	execStderrLimit = 1024
+
+	// execWaitDelay is how long to wait for output pipes after the process group is killed
+	execWaitDelay = time.Second
+)
+
+// ExecParser selects how command output is turned into metrics
+type ExecParser string
+
+const (
+	ExecParserPrometheus  ExecParser = "prometheus"  // Prometheus text, millisecond timestamps (default)
+	ExecParserOpenMetrics ExecParser = "openmetrics" // OpenMetrics text, second timestamps
+	ExecParserJSON        ExecParser = "json"        // Values picked from a JSON document by path
+	ExecParserRegex       ExecParser = "regex"       // Capture groups, with the journal rule format
+)
+
+// JSONPathRule turns the value at a path of a JSON document into a metric
+// The path is dot-separated; numeric segments index arrays (e.g., "bearers.0.stats.rx_bytes").
+type JSONPathRule struct {
+	Metric string
+	Path   string
+	String bool        // Emit the value as a string metric instead of a number
+	Kind   models.Kind // Kind of numeric metrics (default: gauge)
+	Unit   string      // Unit of numeric metrics (e.g., "bytes")
+}
+
+// ExecCommand is one command run by the exec collector
+type ExecCommand struct {
+	Name      string   // Reported in the command tag and health component
+	Args      []string // Program and arguments; no shell is involved
+	Timeout   time.Duration
+	MaxOutput int    // Stdout bytes; larger output fails the run
+	User      string // Run as this user (requires root), empty = the daemon's user
+	Parser    ExecParser
+	Rules     []JournalRule  // Regex parser
+	Paths     []JSONPathRule // JSON parser
+}
+
+// ParseExecCommands converts commands from metrics[].options into ExecCommands
+// Each command needs name and command (a list of program and arguments). parser is prometheus
+// (default), openmetrics, json (with paths: metric, path, type, kind, unit) or regex (with rules in
+// the journal collector's format). timeout, max_output_bytes and user are optional.
+func ParseExecCommands(raw []map[string]interface{}) ([]ExecCommand, error) {
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("commands: at least one command is required")
+	}
+
+	commands := make([]ExecCommand, 0, len(raw))
+	seen := make(map[string]bool)
+	for i, r := range raw {
+		for key := range r {
+			switch key {
+			case "name", "command", "timeout", "max_output_bytes", "user", "parser", "rules", "paths":
+			default:
+				return nil, fmt.Errorf("commands[%d]: unknown key %q (valid keys: name, command, timeout, max_output_bytes, user, parser, rules, paths)", i, key)
+			}
+		}
+
+		name, _ := r["name"].(string)
+		if name == "" || strings.ContainsAny(name, "/ ") {
+			return nil, fmt.Errorf("commands[%d]: name is required and must not contain spaces or slashes", i)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("commands[%d]: duplicate name %q", i, name)
+		}
+		seen[name] = true
+
+		args, err := stringList(r["command"])
+		if err != nil || len(args) == 0 || args[0] == "" {
+			return nil, fmt.Errorf("command %s: command must be a list of program and arguments", name)
+		}
+		cmd := ExecCommand{Name: name, Args: args, Timeout: DefaultExecTimeout, MaxOutput: DefaultExecMaxOutput}
+
+		if v, ok := r["timeout"]; ok {
+			s, _ := v.(string)
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("command %s: timeout must be a positive duration, got %v", name, v)
+			}
+			cmd.Timeout = d
+		}
+		if v, ok := r["max_output_bytes"]; ok {
+			n, ok := v.(int)
+			if !ok || n <= 0 {
+				return nil, fmt.Errorf("command %s: max_output_bytes must be a positive integer, got %v", name, v)
+			}
+			cmd.MaxOutput = n
+		}
+		if v, ok := r["user"]; ok {
+			cmd.User, _ = v.(string)
+			if cmd.User == "" {
+				return nil, fmt.Errorf("command %s: user must be a non-empty string, got %v", name, v)
+			}
+		}
+
+		switch parser, _ := r["parser"].(string); ExecParser(parser) {
+		case "", ExecParserPrometheus:
+			cmd.Parser = ExecParserPrometheus
+		case ExecParserOpenMetrics:
+			cmd.Parser = ExecParserOpenMetrics
+		case ExecParserJSON:
+			cmd.Parser = ExecParserJSON
+		case ExecParserRegex:
+			cmd.Parser = ExecParserRegex
+		default:
+			return nil, fmt.Errorf("command %s: parser must be prometheus, openmetrics, json or regex, got %v", name, r["parser"])
+		}
+
+		rules, err := mapList(r["rules"])
+		if err != nil {
+			return nil, fmt.Errorf("command %s: rules: %w", name, err)
+		}
+		paths, err := mapList(r["paths"])
+		if err != nil {
+			return nil, fmt.Errorf("command %s: paths: %w", name, err)
+		}
+		switch cmd.Parser {
+		case ExecParserRegex:
+			if len(rules) == 0 || len(paths) > 0 {
+				return nil, fmt.Errorf("command %s: the regex parser needs rules (and no paths)", name)
+			}
+			if cmd.Rules, err = ParseJournalRules(rules); err != nil {
+				return nil, fmt.Errorf("command %s: %w", name, err)
+			}
+		case ExecParserJSON:
+			if len(paths) == 0 || len(rules) > 0 {
+				return nil, fmt.Errorf("command %s: the json parser needs paths (and no rules)", name)
+			}
+			if cmd.Paths, err = ParseJSONPathRules(paths); err != nil {
+				return nil, fmt.Errorf("command %s: %w", name, err)
+			}
+		default:
+			if len(rules) > 0 || len(paths) > 0 {
+				return nil, fmt.Errorf("command %s: rules and paths need the regex or json parser", name)
+			}
+		}
+		commands = append(commands, cmd)
+	}
+	return commands, nil
+}
+
+// ParseJSONPathRules converts the paths of a json command into JSONPathRules
+func ParseJSONPathRules(raw []map[string]interface{}) ([]JSONPathRule, error) {
+	rules := make([]JSONPathRule, 0, len(raw))
+	for i, r := range raw {
+		for key := range r {
+			switch key {
+			case "metric", "path", "type", "kind", "unit":
+			default:
+				return nil, fmt.Errorf("paths[%d]: unknown key %q (valid keys: metric, path, type, kind, unit)", i, key)
+			}
+		}
+
+		rule := JSONPathRule{Kind: models.KindGauge}
+		rule.Metric, _ = r["metric"].(string)
+		if rule.Metric == "" {
+			return nil, fmt.Errorf("paths[%d]: metric is required", i)
+		}
+		rule.Path, _ = r["path"].(string)
+		if rule.Path == "" {
+			return nil, fmt.Errorf("paths[%d]: path is required", i)
+		}
+		switch r["type"] {
+		case nil, "numeric":
+		case "string":
+			rule.String = true
+		default:
+			return nil, fmt.Errorf("paths[%d]: type must be numeric or string, got %v", i, r["type"])
+		}
+		switch r["kind"] {
+		case nil, "gauge":
+		case "counter":
+			rule.Kind = models.KindCounter
+		default:
+			return nil, fmt.Errorf("paths[%d]: kind must be gauge or counter, got %v", i, r["kind"])
+		}
+		if unit, ok := r["unit"]; ok {
+			rule.Unit, _ = unit.(string)
+			if rule.Unit == "" {
+				return nil, fmt.Errorf("paths[%d]: unit must be a non-empty string, got %v", i, unit)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// mapList accepts a missing value or a YAML sequence of maps
+func mapList(value interface{}) ([]map[string]interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a list of maps, got %T", value)
+	}
+	list := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("element %d: expected map, got %T", i, item)
+		}
+		list[i] = m
+	}
+	return list, nil
+}
+
+func init() {
+	Register(Registration{
+		Name: "exec",
+		Options: []OptionSpec{
+			{Name: "commands", Type: OptionMapList, Description: "Commands to run: name, command, parser (prometheus, openmetrics, json, regex), rules or paths, timeout, max_output_bytes, user"},
+		},
+		Validate: func(opts Options) error {
+			_, err := ParseExecCommands(opts.MapList("commands"))
+			return err
+		},
+		New: func(env Env, opts Options) (Collector, error) {
+			commands, err := ParseExecCommands(opts.MapList("commands"))
+			if err != nil {
+				return nil, err
+			}
+			return NewExecCollector(ExecCollectorConfig{
+				DeviceID: env.DeviceID,
+				Commands: commands,
+				Logger:   env.Logger,
+			})
+		},
+	})
+}
+
+// ExecCollectorConfig configures the exec collector
+type ExecCollectorConfig struct {
+	DeviceID string
+	Commands []ExecCommand
+	Logger   *slog.Logger
+}
+
+// ExecCollector runs external commands every interval and parses their output
+// Commands run in parallel, each in its own process group: on timeout the whole group is killed,
+// and so is anything a finished command left running. A failed run is reported as an exec.error
+// string metric and in the command's health component; metrics of other commands are unaffected.
+type ExecCollector struct {
+	deviceID string
+	commands []ExecCommand
+	creds    []*syscall.Credential // Per command, nil = run as the daemon's user
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	sources []SourceStatus // Outcome of each command in the last Collect
+}
+
+// NewExecCollector creates a new exec collector, resolving the users commands run as
+func NewExecCollector(cfg ExecCollectorConfig) (*ExecCollector, error) {
+	c := &ExecCollector{
+		deviceID: cfg.DeviceID,
+		commands: cfg.Commands,
+		creds:    make([]*syscall.Credential, len(cfg.Commands)),
+		logger:   cfg.Logger,
+	}
+	if c.logger == nil {
+		c.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	for i, cmd := range c.commands {
+		if cmd.User == "" {
+			continue
+		}
+		cred, err := lookupCredential(cmd.User)
+		if err != nil {
+			return nil, fmt.Errorf("command %s: %w", cmd.Name, err)
+		}
+		c.creds[i] = cred
+	}
+	return c, nil
+}
+
+// lookupCredential resolves a user name to the IDs a command runs with
+// The daemon's own user needs no credential, so running as it works without root.
+func lookupCredential(name string) (*syscall.Credential, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown user %q: %w", name, err)
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q: invalid uid %q", name, u.Uid)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q: invalid gid %q", name, u.Gid)
+	}
+	if int(uid) == os.Getuid() {
+		return nil, nil
+	}
+
+	cred := &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	if groups, err := u.GroupIds(); err == nil {
+		for _, g := range groups {
+			if id, err := strconv.ParseUint(g, 10, 32); err == nil {
+				cred.Groups = append(cred.Groups, uint32(id))
+			}
+		}
+	}
+	return cred, nil
+}
+
+// Name returns the collector name
+func (c *ExecCollector) Name() string {
+	return "exec"
+}
+
+// Collect runs every command and returns their metrics, with the run status of each command
+func (c *ExecCollector) Collect(ctx context.Context) ([]*models.Metric, error) {
+	results := make([][]*models.Metric, len(c.commands))
+	sources := make([]SourceStatus, len(c.commands))
+
+	var wg sync.WaitGroup
+	for i := range c.commands {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cmd := &c.commands[i]
+
+			start := time.Now()
+			output, err := c.run(ctx, cmd, c.creds[i])
+			var metrics []*models.Metric
+			if err == nil {
+				metrics, err = c.parse(cmd, output)
+			}
+			duration := time.Since(start)
+
+			success := 1.0
+			if err != nil {
+				success = 0
+				c.logger.Warn("Exec command failed",
+					slog.String("command", cmd.Name),
+					slog.Any("error", err),
+				)
+				metrics = []*models.Metric{models.NewStringMetric("exec.error", err.Error(), c.deviceID).WithTag("command", cmd.Name)}
+			}
+			metrics = append(metrics,
+				models.NewMetric("exec.success", success, c.deviceID).AsGauge("").WithTag("command", cmd.Name),
+				models.NewMetric("exec.duration_seconds", duration.Seconds(), c.deviceID).AsGauge("seconds").WithTag("command", cmd.Name),
+			)
+			results[i] = metrics
+			sources[i] = SourceStatus{Name: cmd.Name, Metrics: len(metrics), Err: err}
+		}(i)
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	c.sources = sources
+	c.mu.Unlock()
+
+	var metrics []*models.Metric
+	for _, r := range results {
+		metrics = append(metrics, r...)
+	}
+	return metrics, nil
+}
+
+// Sources returns the outcome of each command in the last Collect
+func (c *ExecCollector) Sources() []SourceStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]SourceStatus(nil), c.sources...)
+}
+
+// run executes a command in its own process group and returns its stdout
+func (c *ExecCollector) run(ctx context.Context, command *ExecCommand, cred *syscall.Credential) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, command.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command.Args[0], command.Args[1:]...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Credential: cred}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// Children still holding the pipes must not keep Wait from returning
+	cmd.WaitDelay = execWaitDelay
+
+	stdout := &cappedBuffer{limit: command.MaxOutput}
+	stderr := &cappedBuffer{limit: execStderrLimit, truncate: true}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", command.Args[0], err)
+	}
+	err := cmd.Wait()
+	// Anything the command left running in its group goes with it
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return nil, fmt.Errorf("timed out after %v", command.Timeout)
+	case stdout.overflow:
+		return nil, fmt.Errorf("output exceeds %d bytes", command.MaxOutput)
+	case err != nil:
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// parse turns command output into metrics with the command's parser
+func (c *ExecCollector) parse(cmd *ExecCommand, output []byte) ([]*models.Metric, error) {
+	switch cmd.Parser {
+	case ExecParserJSON:
+		return parseJSONOutput(cmd.Paths, output, c.deviceID)
+	case ExecParserRegex:
+		return parseRegexOutput(cmd.Rules, string(output), c.deviceID)
+	case ExecParserOpenMetrics:
+		return ParseOpenMetrics(string(output), c.deviceID, time.Now())
+	default:
+		return ParseTextfile(string(output), c.deviceID, time.Now())
+	}
+}
+
+// parseJSONOutput picks each rule's value out of a JSON document
+// A path that is missing or holds the wrong type fails the run, so schema changes are noticed.
+func parseJSONOutput(rules []JSONPathRule, output []byte, deviceID string) ([]*models.Metric, error) {
+	var doc interface{}
+	if err := json.Unmarshal(output, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON output: %w", err)
+	}
+
+	metrics := make([]*models.Metric, 0, len(rules))
+	for _, rule := range rules {
+		value, err := jsonPath(doc, rule.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", rule.Path, err)
+		}
+
+		if rule.String {
+			var text string
+			switch v := value.(type) {
+			case string:
+				text = v
+			case float64, bool:
+				text = fmt.Sprint(v)
+			default:
+				return nil, fmt.Errorf("%s: expected a string, got %T", rule.Path, value)
+			}
+			metrics = append(metrics, models.NewStringMetric(rule.Metric, text, deviceID))
+			continue
+		}
+
+		var number float64
+		switch v := value.(type) {
+		case float64:
+			number = v
+		case bool:
+			if v {
+				number = 1
+			}
+		case string:
+			// Tools such as mmcli print numbers as strings
+			if number, err = strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil {
+				return nil, fmt.Errorf("%s: %q is not a number", rule.Path, v)
+			}
+		default:
+			return nil, fmt.Errorf("%s: expected a number, got %T", rule.Path, value)
+		}
+		metrics = append(metrics, models.NewMetric(rule.Metric, number, deviceID).WithKind(rule.Kind).WithUnit(rule.Unit))
+	}
+	return metrics, nil
+}
+
+// jsonPath walks a decoded JSON document along a dot-separated path
+func jsonPath(doc interface{}, path string) (interface{}, error) {
+	current := doc
+	for _, segment := range strings.Split(path, ".") {
+		switch v := current.(type) {
+		case map[string]interface{}:
+			next, ok := v[segment]
+			if !ok {
+				return nil, fmt.Errorf("key %q not found", segment)
+			}
+			current = next
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("index %q out of range (length %d)", segment, len(v))
+			}
+			current = v[i]
+		default:
+			return nil, fmt.Errorf("cannot descend into %T at %q", current, segment)
+		}
+	}
+	return current, nil
+}
+
+// parseRegexOutput applies each rule to the whole output; every rule must match
+func parseRegexOutput(rules []JournalRule, output string, deviceID string) ([]*models.Metric, error) {
+	metrics := make([]*models.Metric, 0, len(rules))
+	for i := range rules {
+		rule := &rules[i]
+		raw, ok := rule.value(output)
+		if !ok {
+			return nil, fmt.Errorf("pattern %q did not match", rule.Pattern.String())
+		}
+		if rule.String {
+			metrics = append(metrics, models.NewStringMetric(rule.Metric, raw, deviceID))
+			continue
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q captured non-numeric %q", rule.Pattern.String(), raw)
+		}
+		kind := rule.Kind
+		if kind == models.KindUnknown {
+			kind = models.KindGauge
+		}
+		metrics = append(metrics, models.NewMetric(rule.Metric, value, deviceID).WithKind(kind).WithUnit(rule.Unit))
+	}
+	return metrics, nil
+}
+
+// cappedBuffer keeps at most limit bytes of a command's output
+// Past the limit it either fails the write, which closes the pipe and stops the command, or
+// silently drops the rest (truncate, for stderr).
+type cappedBuffer struct {
+	limit    int
+	truncate bool
+	overflow bool
+	buf      []byte
+}
+
+// errOutputLimit stops copying a command's output once the limit is reached
+var errOutputLimit = errors.New("output limit reached")
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	room := b.limit - len(b.buf)
+	if len(p) <= room {
+		b.buf = append(b.buf, p...)
+		return len(p), nil
+	}
+	b.buf = append(b.buf, p[:max(room, 0)]...)
+	if b.truncate {
+		return len(p), nil
+	}
+	b.overflow = true
+	return 0, errOutputLimit
+}
+
+func (b *cappedBuffer) Bytes() []byte  { return b.buf }
+func (b *cappedBuffer) String() string { return string(b.buf) }
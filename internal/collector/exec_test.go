@@ -0,0 +1,295 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+// shCommand builds an exec command running a shell script
+func shCommand(name, script string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":    name,
+		"command": []interface{}{"/bin/sh", "-c", script},
+	}
+}
+
+// newTestExecCollector parses raw commands and builds a collector from them
+func newTestExecCollector(t *testing.T, raw ...map[string]interface{}) *ExecCollector {
+	t.Helper()
+	commands, err := ParseExecCommands(raw)
+	if err != nil {
+		t.Fatalf("ParseExecCommands failed: %v", err)
+	}
+	c, err := NewExecCollector(ExecCollectorConfig{DeviceID: "test-device", Commands: commands})
+	if err != nil {
+		t.Fatalf("NewExecCollector failed: %v", err)
+	}
+	return c
+}
+
+// commandStatus returns the metrics tagged with a command, by name
+func commandStatus(metrics []*models.Metric, command string) map[string]*models.Metric {
+	byName := make(map[string]*models.Metric)
+	for _, m := range metrics {
+		if m.Tags["command"] == command {
+			byName[m.Name] = m
+		}
+	}
+	return byName
+}
+
+func TestParseExecCommands(t *testing.T) {
+	regex := shCommand("signal", "mmcli -m 0")
+	regex["parser"] = "regex"
+	regex["rules"] = []interface{}{map[string]interface{}{"metric": "modem.signal_quality", "pattern": `signal quality: (\d+)%`}}
+	regex["timeout"] = "3s"
+	regex["max_output_bytes"] = 4096
+
+	commands, err := ParseExecCommands([]map[string]interface{}{shCommand("hdmi", "v4l2-ctl --query-dv-timings"), regex})
+	if err != nil {
+		t.Fatalf("ParseExecCommands failed: %v", err)
+	}
+	if commands[0].Parser != ExecParserPrometheus || commands[0].Timeout != DefaultExecTimeout || commands[0].MaxOutput != DefaultExecMaxOutput {
+		t.Errorf("Expected defaults, got %+v", commands[0])
+	}
+	if commands[1].Parser != ExecParserRegex || commands[1].Timeout != 3*time.Second || commands[1].MaxOutput != 4096 || len(commands[1].Rules) != 1 {
+		t.Errorf("Unexpected regex command %+v", commands[1])
+	}
+
+	with := func(key string, value interface{}) map[string]interface{} {
+		c := shCommand("x", "true")
+		c[key] = value
+		return c
+	}
+	tests := []struct {
+		raw     []map[string]interface{}
+		wantErr string
+	}{
+		{nil, "at least one command"},
+		{[]map[string]interface{}{with("env", "x")}, `unknown key "env"`},
+		{[]map[string]interface{}{with("name", "a/b")}, "must not contain spaces or slashes"},
+		{[]map[string]interface{}{shCommand("x", "true"), shCommand("x", "true")}, `duplicate name "x"`},
+		{[]map[string]interface{}{with("command", []interface{}{})}, "list of program and arguments"},
+		{[]map[string]interface{}{with("timeout", "0s")}, "timeout must be a positive duration"},
+		{[]map[string]interface{}{with("max_output_bytes", -1)}, "max_output_bytes must be a positive integer"},
+		{[]map[string]interface{}{with("parser", "xml")}, "parser must be prometheus, openmetrics, json or regex"},
+		{[]map[string]interface{}{with("parser", "json")}, "json parser needs paths"},
+		{[]map[string]interface{}{with("parser", "regex")}, "regex parser needs rules"},
+		{[]map[string]interface{}{with("rules", []interface{}{map[string]interface{}{"metric": "x", "pattern": "(x)"}})}, "need the regex or json parser"},
+		{[]map[string]interface{}{with("paths", []interface{}{"x"})}, "expected map"},
+	}
+	for _, tt := range tests {
+		_, err := ParseExecCommands(tt.raw)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+		}
+	}
+
+	if _, err := ParseJSONPathRules([]map[string]interface{}{{"metric": "x"}}); err == nil || !strings.Contains(err.Error(), "path is required") {
+		t.Errorf("Expected a missing path to fail, got %v", err)
+	}
+}
+
+func TestExecCollector_Parsers(t *testing.T) {
+	prometheus := shCommand("hdmi", `printf '# TYPE hdmi_input_present gauge\nhdmi_input_present{port="1"} 1 1772359200123\n'`)
+
+	// OpenMetrics timestamps are seconds
+	openmetrics := shCommand("encoder", `printf '# TYPE encoder_bitrate gauge\nencoder_bitrate 4500 1772359200.5\n# EOF\n'`)
+	openmetrics["parser"] = "openmetrics"
+
+	json := shCommand("modem", `echo '{"modem":{"signal":{"rssi":"-71"},"state":"connected","bearers":[{"connected":true,"rx_bytes":1024}]}}'`)
+	json["parser"] = "json"
+	json["paths"] = []interface{}{
+		map[string]interface{}{"metric": "modem.rssi_dbm", "path": "modem.signal.rssi"},
+		map[string]interface{}{"metric": "modem.state", "path": "modem.state", "type": "string"},
+		map[string]interface{}{"metric": "modem.connected", "path": "modem.bearers.0.connected"},
+		map[string]interface{}{"metric": "modem.rx_bytes", "path": "modem.bearers.0.rx_bytes", "kind": "counter", "unit": "bytes"},
+	}
+
+	regex := shCommand("signal", `printf 'state: registered\nsignal quality: 67%% (recent)\n'`)
+	regex["parser"] = "regex"
+	regex["rules"] = []interface{}{
+		map[string]interface{}{"metric": "modem.signal_quality", "pattern": `signal quality: (\d+)%`, "unit": "percent"},
+		map[string]interface{}{"metric": "modem.registration", "pattern": `state: (?P<value>\w+)`, "type": "string"},
+	}
+
+	c := newTestExecCollector(t, prometheus, openmetrics, json, regex)
+	metrics, err := c.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	byName := metricsByName(metrics)
+
+	if got := byName["hdmi_input_present"]; len(got) != 1 || got[0].Value != 1 || got[0].Tags["port"] != "1" || got[0].TimestampMs != 1772359200123 {
+		t.Errorf("Unexpected prometheus samples %+v", got)
+	}
+	if got := byName["encoder_bitrate"]; len(got) != 1 || got[0].Value != 4500 || got[0].TimestampMs != 1772359200500 {
+		t.Errorf("Unexpected openmetrics samples %+v", got)
+	}
+	if got := byName["modem.rssi_dbm"]; len(got) != 1 || got[0].Value != -71 {
+		t.Errorf("Expected the numeric string parsed, got %+v", got)
+	}
+	if got := byName["modem.state"]; len(got) != 1 || got[0].ValueType != models.ValueTypeString || got[0].ValueText != "connected" {
+		t.Errorf("Unexpected string path %+v", got)
+	}
+	if got := byName["modem.connected"]; len(got) != 1 || got[0].Value != 1 {
+		t.Errorf("Expected true as 1, got %+v", got)
+	}
+	if got := byName["modem.rx_bytes"]; len(got) != 1 || got[0].Kind != models.KindCounter || got[0].Unit != "bytes" || got[0].Value != 1024 {
+		t.Errorf("Unexpected counter path %+v", got)
+	}
+	if got := byName["modem.signal_quality"]; len(got) != 1 || got[0].Value != 67 || got[0].Unit != "percent" {
+		t.Errorf("Unexpected regex capture %+v", got)
+	}
+	if got := byName["modem.registration"]; len(got) != 1 || got[0].ValueText != "registered" {
+		t.Errorf("Unexpected named capture %+v", got)
+	}
+
+	for _, name := range []string{"hdmi", "encoder", "modem", "signal"} {
+		status := commandStatus(metrics, name)
+		if status["exec.success"] == nil || status["exec.success"].Value != 1 || status["exec.duration_seconds"] == nil || status["exec.error"] != nil {
+			t.Errorf("%s: expected a successful run, got %v", name, status)
+		}
+	}
+	for _, s := range c.Sources() {
+		if s.Err != nil {
+			t.Errorf("%s: unexpected error %v", s.Name, s.Err)
+		}
+	}
+}
+
+func TestExecCollector_Failures(t *testing.T) {
+	missingPath := shCommand("missing", `echo '{"a":1}'`)
+	missingPath["parser"] = "json"
+	missingPath["paths"] = []interface{}{map[string]interface{}{"metric": "x", "path": "a.b"}}
+
+	c := newTestExecCollector(t,
+		shCommand("ok", "echo up 1"),
+		shCommand("exit", "echo 'modem not found' >&2; exit 3"),
+		shCommand("garbage", "echo 'not metrics'"),
+		missingPath,
+	)
+	c.commands = append(c.commands, ExecCommand{Name: "nobinary", Args: []string{"/nonexistent/tool"}, Timeout: time.Second, MaxOutput: 1024})
+	c.creds = append(c.creds, nil)
+
+	metrics, err := c.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Expected failures reported as metrics, got %v", err)
+	}
+	if got := metricsByName(metrics)["up"]; len(got) != 1 {
+		t.Errorf("Expected the working command's metrics, got %+v", got)
+	}
+
+	wantErr := map[string]string{
+		"exit":     "exit status 3: modem not found",
+		"garbage":  "line 1",
+		"missing":  "a.b: cannot descend",
+		"nobinary": "failed to start /nonexistent/tool",
+	}
+	for name, want := range wantErr {
+		status := commandStatus(metrics, name)
+		if status["exec.success"] == nil || status["exec.success"].Value != 0 {
+			t.Errorf("%s: expected exec.success 0, got %v", name, status["exec.success"])
+		}
+		errMetric := status["exec.error"]
+		if errMetric == nil || errMetric.ValueType != models.ValueTypeString || !strings.Contains(errMetric.ValueText, want) {
+			t.Errorf("%s: expected an exec.error string containing %q, got %+v", name, want, errMetric)
+		}
+	}
+
+	sources := c.Sources()
+	if len(sources) != 5 || sources[0].Name != "ok" || sources[0].Err != nil {
+		t.Fatalf("Expected one source per command in order, got %+v", sources)
+	}
+	for _, s := range sources[1:] {
+		if s.Err == nil || !strings.Contains(s.Err.Error(), wantErr[s.Name]) {
+			t.Errorf("%s: expected the error in the source status, got %v", s.Name, s.Err)
+		}
+	}
+}
+
+func TestExecCollector_KillsProcessGroupOnTimeout(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+	hang := shCommand("hang", "sleep 30 & echo $! > "+pidFile+"; wait")
+	hang["timeout"] = "200ms"
+	c := newTestExecCollector(t, hang)
+
+	start := time.Now()
+	metrics, _ := c.Collect(context.Background())
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected the timeout to stop the command, took %v", elapsed)
+	}
+	if errMetric := commandStatus(metrics, "hang")["exec.error"]; errMetric == nil || errMetric.ValueText != "timed out after 200ms" {
+		t.Errorf("Expected a timeout error, got %+v", errMetric)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("Failed to read child pid: %v", err)
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	deadline := time.Now().Add(2 * time.Second)
+	for processAlive(pid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the background child %d killed with the process group", pid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// processAlive reports whether a process exists and is not a zombie waiting to be reaped
+func processAlive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return true
+	}
+	// pid (comm) state ...
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
+
+func TestExecCollector_CapsOutput(t *testing.T) {
+	flood := shCommand("flood", "yes up 1")
+	flood["max_output_bytes"] = 1024
+	c := newTestExecCollector(t, flood)
+
+	start := time.Now()
+	metrics, _ := c.Collect(context.Background())
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected the command stopped at the output cap, took %v", elapsed)
+	}
+	if errMetric := commandStatus(metrics, "flood")["exec.error"]; errMetric == nil || errMetric.ValueText != "output exceeds 1024 bytes" {
+		t.Errorf("Expected an output cap error, got %+v", errMetric)
+	}
+	if got := metricsByName(metrics)["up"]; len(got) != 0 {
+		t.Errorf("Expected no metrics from truncated output, got %d", len(got))
+	}
+}
+
+func TestLookupCredential(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skipf("No current user: %v", err)
+	}
+	if cred, err := lookupCredential(current.Username); err != nil || cred != nil {
+		t.Errorf("Expected no credential switch for the daemon's own user, got %+v (err: %v)", cred, err)
+	}
+	if _, err := lookupCredential("no-such-user-tidewatch"); err == nil {
+		t.Error("Expected an unknown user to fail")
+	}
+	if _, err := NewExecCollector(ExecCollectorConfig{Commands: []ExecCommand{{Name: "x", Args: []string{"true"}, User: "no-such-user-tidewatch"}}}); err == nil {
+		t.Error("Expected NewExecCollector to fail for an unknown user")
+	}
+}
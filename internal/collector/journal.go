@@ -0,0 +1,508 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+const (
+	// DefaultJournalMaxBuffered caps entries held between collections; the oldest are dropped first
+	DefaultJournalMaxBuffered = 10000
+
+	// DefaultJournalRestartDelay is how long to wait before restarting journalctl after it exits
+	DefaultJournalRestartDelay = 5 * time.Second
+)
+
+// DefaultJournalRules extract encoder stats from belacoder log lines
+// See docs/belabox-integration.md for the message formats
+var DefaultJournalRules = []JournalRule{
+	{Metric: "encoder.fps", Pattern: regexp.MustCompile(`current: ([0-9.]+) fps`)},
+	{Metric: "encoder.dropped_frames", Pattern: regexp.MustCompile(`dropped: ([0-9]+) frames`)},
+	{Metric: "encoder.bitrate_kbps", Pattern: regexp.MustCompile(`bitrate: ([0-9.]+) kbps`)},
+}
+
+// JournalRule turns matching journal messages into a metric
+// The value is the capture group named "value", or the first capture group
+type JournalRule struct {
+	Metric  string
+	Pattern *regexp.Regexp
+	String  bool        // Emit the captured text as a string metric instead of parsing a number
+	Kind    models.Kind // Kind of numeric metrics (default: gauge)
+	Unit    string      // Unit of numeric metrics (e.g., "bytes")
+}
+
+// value extracts the rule's capture from a message
+func (r *JournalRule) value(message string) (string, bool) {
+	match := r.Pattern.FindStringSubmatch(message)
+	if match == nil {
+		return "", false
+	}
+	if idx := r.Pattern.SubexpIndex("value"); idx > 0 {
+		return match[idx], true
+	}
+	return match[1], true
+}
+
+// ParseJournalRules converts rules from metrics[].options into JournalRules
+// Each rule needs metric and pattern (with at least one capture group); type is numeric (default) or string.
+// Numeric rules may declare kind (gauge or counter, default gauge) and unit.
+func ParseJournalRules(raw []map[string]interface{}) ([]JournalRule, error) {
+	rules := make([]JournalRule, 0, len(raw))
+	for i, r := range raw {
+		for key := range r {
+			switch key {
+			case "metric", "pattern", "type", "kind", "unit":
+			default:
+				return nil, fmt.Errorf("rules[%d]: unknown key %q (valid keys: metric, pattern, type, kind, unit)", i, key)
+			}
+		}
+
+		metric, _ := r["metric"].(string)
+		if metric == "" {
+			return nil, fmt.Errorf("rules[%d]: metric is required", i)
+		}
+		pattern, _ := r["pattern"].(string)
+		if pattern == "" {
+			return nil, fmt.Errorf("rules[%d]: pattern is required", i)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rules[%d]: invalid pattern %q: %w", i, pattern, err)
+		}
+		if re.NumSubexp() == 0 {
+			return nil, fmt.Errorf("rules[%d]: pattern %q needs a capture group for the value", i, pattern)
+		}
+
+		rule := JournalRule{Metric: metric, Pattern: re}
+		switch r["type"] {
+		case nil, "numeric":
+		case "string":
+			rule.String = true
+		default:
+			return nil, fmt.Errorf("rules[%d]: type must be numeric or string, got %v", i, r["type"])
+		}
+		switch r["kind"] {
+		case nil, "gauge":
+			rule.Kind = models.KindGauge
+		case "counter":
+			rule.Kind = models.KindCounter
+		default:
+			return nil, fmt.Errorf("rules[%d]: kind must be gauge or counter, got %v", i, r["kind"])
+		}
+		if unit, ok := r["unit"]; ok {
+			rule.Unit, _ = unit.(string)
+			if rule.Unit == "" {
+				return nil, fmt.Errorf("rules[%d]: unit must be a non-empty string, got %v", i, unit)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func init() {
+	Register(Registration{
+		Name: "journal",
+		Options: []OptionSpec{
+			{Name: "units", Type: OptionStringList, Description: "Systemd units to follow (default: belacoder)"},
+			{Name: "rules", Type: OptionMapList, Description: "Extraction rules: metric, pattern, type, kind, unit (default: belacoder encoder stats)"},
+			{Name: "cursor_file", Type: OptionString, Description: "File used to resume after restarts (default: start at the end of the journal)"},
+			{Name: "journalctl_path", Type: OptionString, Description: "journalctl binary (default: journalctl from PATH)"},
+		},
+		Validate: func(opts Options) error {
+			_, err := ParseJournalRules(opts.MapList("rules"))
+			return err
+		},
+		New: func(env Env, opts Options) (Collector, error) {
+			rules, err := ParseJournalRules(opts.MapList("rules"))
+			if err != nil {
+				return nil, err
+			}
+			return NewJournalCollector(JournalCollectorConfig{
+				DeviceID:       env.DeviceID,
+				Units:          opts.StringList("units"),
+				Rules:          rules,
+				CursorFile:     opts.String("cursor_file"),
+				JournalctlPath: opts.String("journalctl_path"),
+				Logger:         env.Logger,
+			}), nil
+		},
+	})
+}
+
+// JournalCollectorConfig configures the journal collector
+type JournalCollectorConfig struct {
+	DeviceID       string
+	Units          []string      // Units to follow (default: belacoder)
+	Rules          []JournalRule // Extraction rules (default: DefaultJournalRules)
+	CursorFile     string        // Where to persist the journal cursor (empty = don't persist)
+	JournalctlPath string        // journalctl binary (default: "journalctl")
+	MaxBuffered    int           // Max metrics held between collections (default: 10000)
+	RestartDelay   time.Duration // Delay before restarting journalctl (default: 5s)
+	Logger         *slog.Logger
+}
+
+// JournalCollector follows systemd units' journals and extracts metrics from log messages
+// journalctl runs in the background (see Start); Collect drains what was parsed since the last call
+type JournalCollector struct {
+	deviceID       string
+	units          []string
+	rules          []JournalRule
+	cursorFile     string
+	journalctlPath string
+	maxBuffered    int
+	restartDelay   time.Duration
+	logger         *slog.Logger
+
+	mu           sync.Mutex
+	pending      []*models.Metric
+	dropped      int64             // Metrics dropped because the buffer was full
+	cursor       string            // Cursor of the last entry read
+	savedCursor  string            // Cursor last written to cursorFile
+	invocations  map[string]string // unit -> last seen _SYSTEMD_INVOCATION_ID
+	unitRestarts map[string]int64  // unit -> restarts seen since start
+	lastErr      error             // Last journalctl failure, cleared when entries arrive
+}
+
+// NewJournalCollector creates a new journal collector
+func NewJournalCollector(cfg JournalCollectorConfig) *JournalCollector {
+	c := &JournalCollector{
+		deviceID:       cfg.DeviceID,
+		units:          cfg.Units,
+		rules:          cfg.Rules,
+		cursorFile:     cfg.CursorFile,
+		journalctlPath: cfg.JournalctlPath,
+		maxBuffered:    cfg.MaxBuffered,
+		restartDelay:   cfg.RestartDelay,
+		logger:         cfg.Logger,
+		invocations:    make(map[string]string),
+		unitRestarts:   make(map[string]int64),
+	}
+
+	if len(c.units) == 0 {
+		c.units = []string{"belacoder"}
+	}
+	if len(c.rules) == 0 {
+		c.rules = DefaultJournalRules
+	}
+	if c.journalctlPath == "" {
+		c.journalctlPath = "journalctl"
+	}
+	if c.maxBuffered <= 0 {
+		c.maxBuffered = DefaultJournalMaxBuffered
+	}
+	if c.restartDelay <= 0 {
+		c.restartDelay = DefaultJournalRestartDelay
+	}
+	if c.logger == nil {
+		c.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	c.loadCursor()
+	return c
+}
+
+// Name returns the collector name
+func (c *JournalCollector) Name() string {
+	return "journal"
+}
+
+// Start follows the journal until ctx is cancelled, restarting journalctl whenever it exits
+func (c *JournalCollector) Start(ctx context.Context) {
+	for {
+		err := c.follow(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		c.mu.Lock()
+		c.lastErr = err
+		c.mu.Unlock()
+
+		c.logger.Warn("journalctl exited, restarting",
+			slog.Any("units", c.units),
+			slog.Any("error", err),
+			slog.Duration("delay", c.restartDelay),
+		)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.restartDelay):
+		}
+	}
+}
+
+// follow runs one journalctl process and consumes its output until it exits
+func (c *JournalCollector) follow(ctx context.Context) error {
+	c.mu.Lock()
+	cursor := c.cursor
+	c.mu.Unlock()
+
+	cmd := exec.CommandContext(ctx, c.journalctlPath, c.args(cursor)...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open journalctl output: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start journalctl: %w", err)
+	}
+
+	entries, consumeErr := c.consume(stdout)
+	waitErr := cmd.Wait()
+
+	// A cursor from a rotated-away or different journal makes journalctl fail immediately;
+	// forget it so the next run starts at the end instead of failing forever
+	if cursor != "" && entries == 0 && waitErr != nil {
+		c.logger.Warn("journalctl failed to resume from saved cursor, starting at the end of the journal",
+			slog.String("stderr", strings.TrimSpace(stderr.String())),
+		)
+		c.mu.Lock()
+		if c.cursor == cursor {
+			c.cursor = ""
+		}
+		c.mu.Unlock()
+	}
+
+	if consumeErr != nil {
+		return consumeErr
+	}
+	if waitErr != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("journalctl failed: %w: %s", waitErr, msg)
+		}
+		return fmt.Errorf("journalctl failed: %w", waitErr)
+	}
+	return errors.New("journalctl exited")
+}
+
+// args builds the journalctl command line
+func (c *JournalCollector) args(cursor string) []string {
+	args := []string{"--follow", "--output=json", "--no-pager"}
+	for _, unit := range c.units {
+		args = append(args, "--unit="+unit)
+	}
+	if cursor != "" {
+		args = append(args, "--after-cursor="+cursor)
+	} else {
+		// No saved position: only new entries, rather than replaying the whole journal
+		args = append(args, "--lines=0")
+	}
+	return args
+}
+
+// consume reads JSON export lines from r and returns the number of entries read
+func (c *JournalCollector) consume(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	entries := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		if err := c.handleEntry(line); err != nil {
+			c.logger.Debug("Skipping malformed journal entry", slog.Any("error", err))
+			continue
+		}
+		entries++
+	}
+	if err := scanner.Err(); err != nil {
+		return entries, fmt.Errorf("failed to read journal: %w", err)
+	}
+	return entries, nil
+}
+
+// journalEntry holds the journal fields the collector uses
+// MESSAGE is a string, or an array of bytes when the message is not valid UTF-8
+type journalEntry struct {
+	Cursor       string          `json:"__CURSOR"`
+	RealtimeUsec string          `json:"__REALTIME_TIMESTAMP"`
+	Unit         string          `json:"_SYSTEMD_UNIT"`
+	InvocationID string          `json:"_SYSTEMD_INVOCATION_ID"`
+	Message      json.RawMessage `json:"MESSAGE"`
+}
+
+// message decodes MESSAGE in either of its export forms
+func (e *journalEntry) message() string {
+	var s string
+	if err := json.Unmarshal(e.Message, &s); err == nil {
+		return s
+	}
+	var raw []int
+	if err := json.Unmarshal(e.Message, &raw); err != nil {
+		return ""
+	}
+	b := make([]byte, len(raw))
+	for i, v := range raw {
+		b[i] = byte(v)
+	}
+	return string(b)
+}
+
+// handleEntry applies the rules to a single JSON export line
+func (c *JournalCollector) handleEntry(line []byte) error {
+	var entry journalEntry
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return err
+	}
+
+	ts := time.Now()
+	if usec, err := strconv.ParseInt(entry.RealtimeUsec, 10, 64); err == nil {
+		ts = time.UnixMicro(usec)
+	}
+	unit := strings.TrimSuffix(entry.Unit, ".service")
+	message := entry.message()
+
+	var metrics []*models.Metric
+	for i := range c.rules {
+		rule := &c.rules[i]
+		raw, ok := rule.value(message)
+		if !ok {
+			continue
+		}
+
+		var m *models.Metric
+		if rule.String {
+			m = models.NewStringMetric(rule.Metric, raw, c.deviceID)
+		} else {
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				c.logger.Debug("Journal rule matched a non-numeric value",
+					slog.String("metric", rule.Metric),
+					slog.String("value", raw),
+				)
+				continue
+			}
+			kind := rule.Kind
+			if kind == models.KindUnknown {
+				kind = models.KindGauge
+			}
+			m = models.NewMetric(rule.Metric, value, c.deviceID).WithKind(kind).WithUnit(rule.Unit)
+		}
+		m.WithTimestamp(ts)
+		if unit != "" {
+			m.WithTag("unit", unit)
+		}
+		metrics = append(metrics, m)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry.Cursor != "" {
+		c.cursor = entry.Cursor
+	}
+	c.lastErr = nil
+
+	// A new invocation ID means the unit restarted; encoder counters start over
+	if unit != "" && entry.InvocationID != "" {
+		if prev, ok := c.invocations[unit]; ok && prev != entry.InvocationID {
+			c.unitRestarts[unit]++
+			c.logger.Info("Journal unit restarted", slog.String("unit", unit))
+		}
+		c.invocations[unit] = entry.InvocationID
+	}
+
+	c.pending = append(c.pending, metrics...)
+	if over := len(c.pending) - c.maxBuffered; over > 0 {
+		c.pending = c.pending[over:]
+		c.dropped += int64(over)
+	}
+	return nil
+}
+
+// Collect returns the metrics parsed since the last call and saves the journal cursor
+func (c *JournalCollector) Collect(ctx context.Context) ([]*models.Metric, error) {
+	c.mu.Lock()
+	metrics := c.pending
+	c.pending = nil
+	cursor := c.cursor
+	lastErr := c.lastErr
+
+	units := make([]string, 0, len(c.unitRestarts))
+	for unit := range c.unitRestarts {
+		units = append(units, unit)
+	}
+	sort.Strings(units)
+	for _, unit := range units {
+		metrics = append(metrics, models.NewMetric("journal.unit_restarts_total", float64(c.unitRestarts[unit]), c.deviceID).AsCounter("").
+			WithTag("unit", unit))
+	}
+	if c.dropped > 0 {
+		metrics = append(metrics, models.NewMetric("journal.dropped_total", float64(c.dropped), c.deviceID).AsCounter(""))
+	}
+	c.mu.Unlock()
+
+	if err := c.saveCursor(cursor); err != nil {
+		c.logger.Warn("Failed to save journal cursor", slog.Any("error", err))
+	}
+
+	// Only surface journalctl failures when there is nothing to report, so buffered data is not lost
+	if len(metrics) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return metrics, nil
+}
+
+// loadCursor reads the saved cursor, if any
+func (c *JournalCollector) loadCursor() {
+	if c.cursorFile == "" {
+		return
+	}
+	data, err := os.ReadFile(c.cursorFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			c.logger.Warn("Failed to read journal cursor", slog.Any("error", err))
+		}
+		return
+	}
+	c.cursor = strings.TrimSpace(string(data))
+	c.savedCursor = c.cursor
+}
+
+// saveCursor writes the cursor atomically if it changed since the last save
+func (c *JournalCollector) saveCursor(cursor string) error {
+	if c.cursorFile == "" || cursor == "" || cursor == c.savedCursor {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.cursorFile), ".journal-cursor-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp cursor file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(cursor + "\n"); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cursor: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close cursor file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.cursorFile); err != nil {
+		return fmt.Errorf("failed to replace cursor file: %w", err)
+	}
+
+	c.savedCursor = cursor
+	return nil
+}
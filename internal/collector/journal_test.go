@@ -0,0 +1,316 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+// consumeFixture feeds the belacoder fixture through the collector's parser
+func consumeFixture(t *testing.T, c *JournalCollector) int {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", "belacoder.journal.json"))
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	entries, err := c.consume(f)
+	if err != nil {
+		t.Fatalf("consume failed: %v", err)
+	}
+	return entries
+}
+
+// metricsByName groups collected metrics by name
+func metricsByName(metrics []*models.Metric) map[string][]*models.Metric {
+	byName := make(map[string][]*models.Metric)
+	for _, m := range metrics {
+		byName[m.Name] = append(byName[m.Name], m)
+	}
+	return byName
+}
+
+func TestJournalCollector_DefaultRulesFromFixture(t *testing.T) {
+	c := NewJournalCollector(JournalCollectorConfig{DeviceID: "test-device"})
+
+	if entries := consumeFixture(t, c); entries != 6 {
+		t.Errorf("Expected 6 entries (malformed line skipped), got %d", entries)
+	}
+
+	metrics, err := c.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	byName := metricsByName(metrics)
+
+	fps := byName["encoder.fps"]
+	if len(fps) != 2 {
+		t.Fatalf("Expected 2 encoder.fps samples, got %d", len(fps))
+	}
+	if fps[0].Value != 29.97 {
+		t.Errorf("Expected first fps 29.97, got %v", fps[0].Value)
+	}
+	if fps[0].TimestampMs != 1735689601000 {
+		t.Errorf("Expected journal timestamp 1735689601000, got %d", fps[0].TimestampMs)
+	}
+	if fps[0].Tags["unit"] != "belacoder" {
+		t.Errorf("Expected unit tag belacoder, got %q", fps[0].Tags["unit"])
+	}
+	if fps[1].Value != 25.0 {
+		t.Errorf("Expected byte-array MESSAGE to decode to 25.0 fps, got %v", fps[1].Value)
+	}
+
+	if dropped := byName["encoder.dropped_frames"]; len(dropped) != 2 || dropped[0].Value != 5 {
+		t.Errorf("Expected dropped frames [5 0], got %v", dropped)
+	}
+	if bitrate := byName["encoder.bitrate_kbps"]; len(bitrate) != 1 || bitrate[0].Value != 8000 {
+		t.Errorf("Expected bitrate 8000, got %v", bitrate)
+	}
+
+	// The invocation ID changed from inv-1 to inv-2
+	restarts := byName["journal.unit_restarts_total"]
+	if len(restarts) != 1 || restarts[0].Value != 1 || restarts[0].Tags["unit"] != "belacoder" {
+		t.Errorf("Expected 1 belacoder restart, got %v", restarts)
+	}
+
+	// Drained: the next collection only carries the restart counter
+	metrics, _ = c.Collect(context.Background())
+	if len(metrics) != 1 || metrics[0].Name != "journal.unit_restarts_total" {
+		t.Errorf("Expected only the restart counter after draining, got %d metrics", len(metrics))
+	}
+}
+
+func TestJournalCollector_CustomRules(t *testing.T) {
+	rules, err := ParseJournalRules([]map[string]interface{}{
+		{"metric": "encoder.state", "pattern": `pipeline: (\w+)`, "type": "string"},
+		{"metric": "encoder.avg_fps", "pattern": `current: [0-9.]+ fps, average: (?P<value>[0-9.]+) fps`},
+		{"metric": "encoder.frames_dropped", "pattern": `dropped: ([0-9]+) frames`, "kind": "counter", "unit": "frames"},
+	})
+	if err != nil {
+		t.Fatalf("ParseJournalRules failed: %v", err)
+	}
+
+	c := NewJournalCollector(JournalCollectorConfig{DeviceID: "test-device", Rules: rules})
+	consumeFixture(t, c)
+
+	metrics, err := c.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	byName := metricsByName(metrics)
+
+	state := byName["encoder.state"]
+	if len(state) != 1 || state[0].ValueType != models.ValueTypeString || state[0].ValueText != "PLAYING" {
+		t.Errorf("Expected string metric PLAYING, got %+v", state)
+	}
+	avg := byName["encoder.avg_fps"]
+	if len(avg) != 1 || avg[0].Value != 29.98 {
+		t.Errorf("Expected named group value 29.98, got %+v", avg)
+	}
+	if avg[0].Kind != models.KindGauge {
+		t.Errorf("Expected numeric rules to default to gauges, got %q", avg[0].Kind)
+	}
+	dropped := byName["encoder.frames_dropped"]
+	if len(dropped) == 0 {
+		t.Fatal("Expected encoder.frames_dropped samples")
+	}
+	for _, m := range dropped {
+		if m.Kind != models.KindCounter || m.Unit != "frames" {
+			t.Errorf("Expected declared counter in frames, got %q/%q", m.Kind, m.Unit)
+		}
+	}
+	if len(byName["encoder.fps"]) != 0 {
+		t.Error("Expected custom rules to replace the defaults")
+	}
+}
+
+func TestParseJournalRules_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    map[string]interface{}
+		wantErr string
+	}{
+		{"missing metric", map[string]interface{}{"pattern": `(\d+)`}, "metric is required"},
+		{"missing pattern", map[string]interface{}{"metric": "x"}, "pattern is required"},
+		{"bad regex", map[string]interface{}{"metric": "x", "pattern": `(\d+`}, "invalid pattern"},
+		{"no capture group", map[string]interface{}{"metric": "x", "pattern": `\d+`}, "capture group"},
+		{"bad type", map[string]interface{}{"metric": "x", "pattern": `(\d+)`, "type": "gauge"}, "numeric or string"},
+		{"unknown key", map[string]interface{}{"metric": "x", "pattern": `(\d+)`, "scale": 2}, "unknown key"},
+		{"bad kind", map[string]interface{}{"metric": "x", "pattern": `(\d+)`, "kind": "summary"}, "gauge or counter"},
+		{"empty unit", map[string]interface{}{"metric": "x", "pattern": `(\d+)`, "unit": ""}, "unit must be"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseJournalRules([]map[string]interface{}{tt.rule})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	// Rule errors surface through registry validation
+	reg, _ := Lookup("journal")
+	_, err := reg.ParseOptions(map[string]interface{}{
+		"rules": []interface{}{map[string]interface{}{"metric": "x"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "pattern is required") {
+		t.Errorf("Expected registry validation to reject bad rules, got %v", err)
+	}
+}
+
+func TestJournalCollector_CursorPersistence(t *testing.T) {
+	cursorFile := filepath.Join(t.TempDir(), "journal.cursor")
+
+	c := NewJournalCollector(JournalCollectorConfig{DeviceID: "test-device", CursorFile: cursorFile})
+	if args := strings.Join(c.args(c.cursor), " "); !strings.Contains(args, "--lines=0") {
+		t.Errorf("Expected a fresh collector to start at the end of the journal, got %s", args)
+	}
+
+	consumeFixture(t, c)
+	if _, err := c.Collect(context.Background()); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	data, err := os.ReadFile(cursorFile)
+	if err != nil {
+		t.Fatalf("Expected cursor file to be written: %v", err)
+	}
+	if strings.TrimSpace(string(data)) != "s=abc;i=6" {
+		t.Errorf("Expected last cursor saved, got %q", data)
+	}
+
+	// A new collector (e.g., after a tidewatch restart) resumes after the saved cursor
+	c2 := NewJournalCollector(JournalCollectorConfig{DeviceID: "test-device", CursorFile: cursorFile, Units: []string{"belacoder", "srtla_send"}})
+	args := c2.args(c2.cursor)
+	joined := strings.Join(args, " ")
+	if !strings.Contains(joined, "--after-cursor=s=abc;i=6") {
+		t.Errorf("Expected resume from saved cursor, got %s", joined)
+	}
+	if !strings.Contains(joined, "--unit=belacoder") || !strings.Contains(joined, "--unit=srtla_send") {
+		t.Errorf("Expected every unit to be followed, got %s", joined)
+	}
+}
+
+func TestJournalCollector_BufferCap(t *testing.T) {
+	c := NewJournalCollector(JournalCollectorConfig{DeviceID: "test-device", MaxBuffered: 2})
+	consumeFixture(t, c)
+
+	metrics, err := c.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	byName := metricsByName(metrics)
+
+	// 5 rule matches, cap of 2: the 3 oldest are dropped
+	if dropped := byName["journal.dropped_total"]; len(dropped) != 1 || dropped[0].Value != 3 {
+		t.Errorf("Expected 3 dropped, got %v", dropped)
+	}
+	if fps := byName["encoder.fps"]; len(fps) != 1 || fps[0].Value != 25.0 {
+		t.Errorf("Expected newest fps sample kept, got %v", fps)
+	}
+}
+
+// writeFakeJournalctl creates a journalctl stand-in that records its arguments and prints the fixture
+func writeFakeJournalctl(t *testing.T, dir string) (string, string) {
+	t.Helper()
+
+	fixture, err := filepath.Abs(filepath.Join("testdata", "belacoder.journal.json"))
+	if err != nil {
+		t.Fatalf("Failed to resolve fixture: %v", err)
+	}
+	argsFile := filepath.Join(dir, "args")
+	script := filepath.Join(dir, "journalctl")
+	content := "#!/bin/sh\necho \"$@\" >> " + argsFile + "\ncat " + fixture + "\nexit 1\n"
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatalf("Failed to write fake journalctl: %v", err)
+	}
+	return script, argsFile
+}
+
+func TestJournalCollector_FollowsFakeJournalctl(t *testing.T) {
+	dir := t.TempDir()
+	script, argsFile := writeFakeJournalctl(t, dir)
+
+	c := NewJournalCollector(JournalCollectorConfig{
+		DeviceID:       "test-device",
+		JournalctlPath: script,
+		RestartDelay:   10 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Start(ctx)
+		close(done)
+	}()
+
+	// Wait until journalctl has been restarted at least once
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(argsFile)
+		if strings.Count(string(data), "\n") >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for journalctl restart")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	data, _ := os.ReadFile(argsFile)
+	runs := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if !strings.Contains(runs[0], "--lines=0") || !strings.Contains(runs[0], "--output=json") {
+		t.Errorf("Expected first run to start at the end in JSON, got %q", runs[0])
+	}
+	if !strings.Contains(runs[1], "--after-cursor=s=abc;i=6") {
+		t.Errorf("Expected restart to resume after the last cursor, got %q", runs[1])
+	}
+
+	metrics, err := c.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if len(metricsByName(metrics)["encoder.fps"]) < 2 {
+		t.Errorf("Expected fps samples from the fake journal, got %d metrics", len(metrics))
+	}
+}
+
+func TestJournalCollector_ReportsMissingJournalctl(t *testing.T) {
+	c := NewJournalCollector(JournalCollectorConfig{
+		DeviceID:       "test-device",
+		JournalctlPath: filepath.Join(t.TempDir(), "does-not-exist"),
+		RestartDelay:   time.Hour,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Start(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	var err error
+	for time.Now().Before(deadline) {
+		if _, err = c.Collect(context.Background()); err != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if err == nil || !strings.Contains(err.Error(), "failed to start journalctl") {
+		t.Errorf("Expected Collect to report the journalctl failure, got %v", err)
+	}
+}
@@ -18,6 +18,15 @@ func NewMemoryCollector(deviceID string) *MemoryCollector {
 	}
 }
 
+func init() {
+	Register(Registration{
+		Name: "memory.usage",
+		New: func(env Env, _ Options) (Collector, error) {
+			return NewMemoryCollector(env.DeviceID), nil
+		},
+	})
+}
+
 // Name returns the collector name
 func (c *MemoryCollector) Name() string {
 	return "memory"
@@ -42,11 +51,11 @@ func (c *MemoryCollector) collectMock() []*models.Metric {
 	)
 
 	metrics := []*models.Metric{
-		models.NewMetric("memory.used_bytes", float64(usedBytes), c.deviceID),
-		models.NewMetric("memory.available_bytes", float64(availableBytes), c.deviceID),
-		models.NewMetric("memory.total_bytes", float64(totalBytes), c.deviceID),
-		models.NewMetric("memory.swap_used_bytes", float64(swapUsed), c.deviceID),
-		models.NewMetric("memory.swap_total_bytes", float64(swapTotal), c.deviceID),
+		models.NewMetric("memory.used_bytes", float64(usedBytes), c.deviceID).AsGauge("bytes"),
+		models.NewMetric("memory.available_bytes", float64(availableBytes), c.deviceID).AsGauge("bytes"),
+		models.NewMetric("memory.total_bytes", float64(totalBytes), c.deviceID).AsGauge("bytes"),
+		models.NewMetric("memory.swap_used_bytes", float64(swapUsed), c.deviceID).AsGauge("bytes"),
+		models.NewMetric("memory.swap_total_bytes", float64(swapTotal), c.deviceID).AsGauge("bytes"),
 	}
 
 	return metrics
@@ -26,14 +26,23 @@ func (c *MemoryCollector) collect(ctx context.Context) ([]*models.Metric, error)
 
 	metrics := []*models.Metric{
 		// Memory metrics in bytes
-		models.NewMetric("memory.used_bytes", float64(vmStat.Used), c.deviceID),
-		models.NewMetric("memory.available_bytes", float64(vmStat.Available), c.deviceID),
-		models.NewMetric("memory.total_bytes", float64(vmStat.Total), c.deviceID),
+		models.NewMetric("memory.used_bytes", float64(vmStat.Used), c.deviceID).AsGauge("bytes"),
+		models.NewMetric("memory.available_bytes", float64(vmStat.Available), c.deviceID).AsGauge("bytes"),
+		models.NewMetric("memory.total_bytes", float64(vmStat.Total), c.deviceID).AsGauge("bytes"),
 
 		// Swap metrics in bytes
-		models.NewMetric("memory.swap_used_bytes", float64(swapStat.Used), c.deviceID),
-		models.NewMetric("memory.swap_total_bytes", float64(swapStat.Total), c.deviceID),
+		models.NewMetric("memory.swap_used_bytes", float64(swapStat.Used), c.deviceID).AsGauge("bytes"),
+		models.NewMetric("memory.swap_total_bytes", float64(swapStat.Total), c.deviceID).AsGauge("bytes"),
 	}
 
 	return metrics, nil
 }
+
+// AvailableMemory returns the available memory reported by gopsutil, e.g. to detect memory pressure
+func AvailableMemory() (uint64, error) {
+	vmStat, err := mem.VirtualMemory()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get virtual memory stats: %w", err)
+	}
+	return vmStat.Available, nil
+}
@@ -28,13 +28,13 @@ func (c *MemoryCollector) collect(ctx context.Context) ([]*models.Metric, error)
 
 	metrics := []*models.Metric{
 		// Memory metrics in bytes
-		models.NewMetric("memory.used_bytes", float64(memUsed), c.deviceID),
-		models.NewMetric("memory.available_bytes", float64(meminfo.MemAvailable), c.deviceID),
-		models.NewMetric("memory.total_bytes", float64(meminfo.MemTotal), c.deviceID),
+		models.NewMetric("memory.used_bytes", float64(memUsed), c.deviceID).AsGauge("bytes"),
+		models.NewMetric("memory.available_bytes", float64(meminfo.MemAvailable), c.deviceID).AsGauge("bytes"),
+		models.NewMetric("memory.total_bytes", float64(meminfo.MemTotal), c.deviceID).AsGauge("bytes"),
 
 		// Swap metrics in bytes
-		models.NewMetric("memory.swap_used_bytes", float64(swapUsed), c.deviceID),
-		models.NewMetric("memory.swap_total_bytes", float64(meminfo.SwapTotal), c.deviceID),
+		models.NewMetric("memory.swap_used_bytes", float64(swapUsed), c.deviceID).AsGauge("bytes"),
+		models.NewMetric("memory.swap_total_bytes", float64(meminfo.SwapTotal), c.deviceID).AsGauge("bytes"),
 	}
 
 	return metrics, nil
@@ -84,3 +84,12 @@ func (c *MemoryCollector) parseMeminfo() (*Meminfo, error) {
 
 	return meminfo, nil
 }
+
+// AvailableMemory returns MemAvailable from /proc/meminfo, e.g. to detect memory pressure
+func AvailableMemory() (uint64, error) {
+	meminfo, err := (&MemoryCollector{}).parseMeminfo()
+	if err != nil {
+		return 0, err
+	}
+	return meminfo.MemAvailable, nil
+}
@@ -22,6 +22,15 @@ func NewMockSRTCollector(deviceID string) *MockSRTCollector {
 	}
 }
 
+func init() {
+	Register(Registration{
+		Name: "srt.packet_loss",
+		New: func(env Env, _ Options) (Collector, error) {
+			return NewMockSRTCollector(env.DeviceID), nil
+		},
+	})
+}
+
 // Name returns the collector name
 func (c *MockSRTCollector) Name() string {
 	return "mock_srt"
@@ -35,7 +44,7 @@ func (c *MockSRTCollector) Collect(ctx context.Context) ([]*models.Metric, error
 		packetLoss = c.rng.Float64() * 5.0 // 0-5% loss
 	}
 
-	m := models.NewMetric("srt.packet_loss_pct", packetLoss, c.deviceID)
+	m := models.NewMetric("srt.packet_loss_pct", packetLoss, c.deviceID).AsGauge("")
 
 	return []*models.Metric{m}, nil
 }
@@ -2,6 +2,7 @@ package collector
 
 import (
 	"context"
+	"fmt"
 	"regexp"
 	"sync"
 
@@ -92,6 +93,31 @@ func NewNetworkCollectorWithConfig(cfg NetworkCollectorConfig) *NetworkCollector
 	return c
 }
 
+func init() {
+	Register(Registration{
+		Name: "network.traffic",
+		Options: []OptionSpec{
+			{Name: "exclude_patterns", Type: OptionRegexList, Description: "Regexes of interfaces to skip (replaces the defaults)"},
+			{Name: "include_pattern", Type: OptionRegex, Description: "Regex of interfaces to report (default: all)"},
+			{Name: "max_interfaces", Type: OptionInt, Description: "Hard cap on reported interfaces (default: 32)"},
+		},
+		Validate: func(opts Options) error {
+			if opts.Has("max_interfaces") && opts.Int("max_interfaces") <= 0 {
+				return fmt.Errorf("max_interfaces must be positive (got %d)", opts.Int("max_interfaces"))
+			}
+			return nil
+		},
+		New: func(env Env, opts Options) (Collector, error) {
+			return NewNetworkCollectorWithConfig(NetworkCollectorConfig{
+				DeviceID:        env.DeviceID,
+				ExcludePatterns: opts.StringList("exclude_patterns"),
+				IncludePattern:  opts.String("include_pattern"),
+				MaxInterfaces:   opts.Int("max_interfaces"),
+			}), nil
+		},
+	})
+}
+
 // Name returns the collector name
 func (c *NetworkCollector) Name() string {
 	return "network"
@@ -133,17 +159,17 @@ func (c *NetworkCollector) collectMock() []*models.Metric {
 
 	for _, iface := range interfaces {
 		metrics = append(metrics,
-			models.NewMetric("network.rx_bytes_total", float64(iface.rxBytes), c.deviceID).
+			models.NewMetric("network.rx_bytes_total", float64(iface.rxBytes), c.deviceID).AsCounter("bytes").
 				WithTag("interface", iface.name),
-			models.NewMetric("network.rx_packets_total", float64(iface.rxPkts), c.deviceID).
+			models.NewMetric("network.rx_packets_total", float64(iface.rxPkts), c.deviceID).AsCounter("").
 				WithTag("interface", iface.name),
-			models.NewMetric("network.rx_errors_total", float64(iface.rxErrs), c.deviceID).
+			models.NewMetric("network.rx_errors_total", float64(iface.rxErrs), c.deviceID).AsCounter("").
 				WithTag("interface", iface.name),
-			models.NewMetric("network.tx_bytes_total", float64(iface.txBytes), c.deviceID).
+			models.NewMetric("network.tx_bytes_total", float64(iface.txBytes), c.deviceID).AsCounter("bytes").
 				WithTag("interface", iface.name),
-			models.NewMetric("network.tx_packets_total", float64(iface.txPkts), c.deviceID).
+			models.NewMetric("network.tx_packets_total", float64(iface.txPkts), c.deviceID).AsCounter("").
 				WithTag("interface", iface.name),
-			models.NewMetric("network.tx_errors_total", float64(iface.txErrs), c.deviceID).
+			models.NewMetric("network.tx_errors_total", float64(iface.txErrs), c.deviceID).AsCounter("").
 				WithTag("interface", iface.name),
 		)
 	}
@@ -83,32 +83,32 @@ func (c *NetworkCollector) collect(ctx context.Context) ([]*models.Metric, error
 
 		// RX bytes (counter)
 		metrics = append(metrics,
-			models.NewMetric("network.rx_bytes_total", float64(current.RxBytes), c.deviceID).
+			models.NewMetric("network.rx_bytes_total", float64(current.RxBytes), c.deviceID).AsCounter("bytes").
 				WithTag("interface", iface))
 
 		// TX bytes (counter)
 		metrics = append(metrics,
-			models.NewMetric("network.tx_bytes_total", float64(current.TxBytes), c.deviceID).
+			models.NewMetric("network.tx_bytes_total", float64(current.TxBytes), c.deviceID).AsCounter("bytes").
 				WithTag("interface", iface))
 
 		// RX packets (counter)
 		metrics = append(metrics,
-			models.NewMetric("network.rx_packets_total", float64(current.RxPackets), c.deviceID).
+			models.NewMetric("network.rx_packets_total", float64(current.RxPackets), c.deviceID).AsCounter("").
 				WithTag("interface", iface))
 
 		// TX packets (counter)
 		metrics = append(metrics,
-			models.NewMetric("network.tx_packets_total", float64(current.TxPackets), c.deviceID).
+			models.NewMetric("network.tx_packets_total", float64(current.TxPackets), c.deviceID).AsCounter("").
 				WithTag("interface", iface))
 
 		// RX errors (counter)
 		metrics = append(metrics,
-			models.NewMetric("network.rx_errors_total", float64(current.RxErrors), c.deviceID).
+			models.NewMetric("network.rx_errors_total", float64(current.RxErrors), c.deviceID).AsCounter("").
 				WithTag("interface", iface))
 
 		// TX errors (counter)
 		metrics = append(metrics,
-			models.NewMetric("network.tx_errors_total", float64(current.TxErrors), c.deviceID).
+			models.NewMetric("network.tx_errors_total", float64(current.TxErrors), c.deviceID).AsCounter("").
 				WithTag("interface", iface))
 	}
 
@@ -116,7 +116,7 @@ func (c *NetworkCollector) collect(ctx context.Context) ([]*models.Metric, error
 	droppedTotal := atomic.LoadUint64(&c.interfacesDroppedTotal)
 	if droppedTotal > 0 {
 		metrics = append(metrics,
-			models.NewMetric("network.interfaces_dropped_total", float64(droppedTotal), c.deviceID))
+			models.NewMetric("network.interfaces_dropped_total", float64(droppedTotal), c.deviceID).AsCounter(""))
 	}
 
 	// Update cache for next collection
@@ -0,0 +1,340 @@
+package collector
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OptionType is the type of a collector option value
+type OptionType int
+
+const (
+	OptionString     OptionType = iota // Plain string
+	OptionInt                          // Integer
+	OptionBool                         // true/false
+	OptionDuration                     // Positive Go duration string (e.g., "30s")
+	OptionRegex                        // String that must compile as a regular expression
+	OptionStringList                   // List of strings (a single string is accepted as a one-element list)
+	OptionRegexList                    // List of regular expressions
+	OptionMapList                      // List of maps; the collector's Validate checks the keys
+)
+
+// String returns the option type name used in error messages
+func (t OptionType) String() string {
+	switch t {
+	case OptionString:
+		return "string"
+	case OptionInt:
+		return "int"
+	case OptionBool:
+		return "bool"
+	case OptionDuration:
+		return "duration"
+	case OptionRegex:
+		return "regex"
+	case OptionStringList:
+		return "string list"
+	case OptionRegexList:
+		return "regex list"
+	case OptionMapList:
+		return "list of maps"
+	default:
+		return "unknown"
+	}
+}
+
+// OptionSpec describes one option accepted by a collector
+type OptionSpec struct {
+	Name        string
+	Type        OptionType
+	Description string
+}
+
+// Env carries the process-wide values every collector factory may need
+type Env struct {
+	DeviceID string
+	Logger   *slog.Logger
+}
+
+// Factory creates a collector from its environment and validated options
+type Factory func(env Env, opts Options) (Collector, error)
+
+// Registration describes a collector that can be enabled from the metrics config
+type Registration struct {
+	Name    string       // Metric name used in config (e.g., "disk.io")
+	Options []OptionSpec // Options accepted under metrics[].options
+	New     Factory
+
+	// Validate optionally checks option values beyond their type (e.g., ranges)
+	Validate func(opts Options) error
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Registration)
+)
+
+// Register adds a collector to the registry
+// Collectors call this from init(); registering the same name twice panics
+func Register(r Registration) {
+	if r.Name == "" || r.New == nil {
+		panic("collector: Register requires a name and a factory")
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, exists := registry[r.Name]; exists {
+		panic(fmt.Sprintf("collector: %s registered twice", r.Name))
+	}
+	registry[r.Name] = r
+}
+
+// Lookup returns the registration for a collector name
+func Lookup(name string) (Registration, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	r, ok := registry[name]
+	return r, ok
+}
+
+// Registered returns the names of all registered collectors in sorted order
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseOptions validates raw config options against the collector's schema
+// Unknown options and values of the wrong type are errors
+func (r Registration) ParseOptions(raw map[string]interface{}) (Options, error) {
+	specs := make(map[string]OptionSpec, len(r.Options))
+	for _, spec := range r.Options {
+		specs[spec.Name] = spec
+	}
+
+	opts := make(Options, len(raw))
+	for name, value := range raw {
+		spec, ok := specs[name]
+		if !ok {
+			return nil, fmt.Errorf("collector %s: unknown option %q%s", r.Name, name, r.knownOptions())
+		}
+		parsed, err := parseOption(spec, value)
+		if err != nil {
+			return nil, fmt.Errorf("collector %s: option %s: %w", r.Name, name, err)
+		}
+		opts[name] = parsed
+	}
+
+	if r.Validate != nil {
+		if err := r.Validate(opts); err != nil {
+			return nil, fmt.Errorf("collector %s: %w", r.Name, err)
+		}
+	}
+	return opts, nil
+}
+
+// Build validates raw options and creates the collector
+func (r Registration) Build(env Env, raw map[string]interface{}) (Collector, error) {
+	opts, err := r.ParseOptions(raw)
+	if err != nil {
+		return nil, err
+	}
+	coll, err := r.New(env, opts)
+	if err != nil {
+		return nil, fmt.Errorf("collector %s: %w", r.Name, err)
+	}
+	return coll, nil
+}
+
+// knownOptions formats the accepted option names for error messages
+func (r Registration) knownOptions() string {
+	if len(r.Options) == 0 {
+		return " (collector takes no options)"
+	}
+	names := make([]string, len(r.Options))
+	for i, spec := range r.Options {
+		names[i] = spec.Name
+	}
+	sort.Strings(names)
+	return " (valid options: " + strings.Join(names, ", ") + ")"
+}
+
+// parseOption converts a YAML-decoded value into the option's Go type
+func parseOption(spec OptionSpec, value interface{}) (interface{}, error) {
+	switch spec.Type {
+	case OptionString:
+		s, ok := value.(string)
+		if !ok {
+			return nil, typeError(spec, value)
+		}
+		return s, nil
+
+	case OptionInt:
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case int64:
+			return int(v), nil
+		case uint64:
+			return int(v), nil
+		case float64:
+			if v != float64(int(v)) {
+				return nil, typeError(spec, value)
+			}
+			return int(v), nil
+		default:
+			return nil, typeError(spec, value)
+		}
+
+	case OptionBool:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, typeError(spec, value)
+		}
+		return b, nil
+
+	case OptionDuration:
+		s, ok := value.(string)
+		if !ok {
+			return nil, typeError(spec, value)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q: %w", s, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("duration must be positive (got %v)", d)
+		}
+		return d, nil
+
+	case OptionRegex:
+		s, ok := value.(string)
+		if !ok {
+			return nil, typeError(spec, value)
+		}
+		if _, err := regexp.Compile(s); err != nil {
+			return nil, fmt.Errorf("invalid regex %q: %w", s, err)
+		}
+		return s, nil
+
+	case OptionStringList, OptionRegexList:
+		list, err := stringList(value)
+		if err != nil {
+			return nil, typeError(spec, value)
+		}
+		if spec.Type == OptionRegexList {
+			for _, s := range list {
+				if _, err := regexp.Compile(s); err != nil {
+					return nil, fmt.Errorf("invalid regex %q: %w", s, err)
+				}
+			}
+		}
+		return list, nil
+
+	case OptionMapList:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, typeError(spec, value)
+		}
+		list := make([]map[string]interface{}, len(items))
+		for i, item := range items {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("element %d: expected map, got %T", i, item)
+			}
+			list[i] = m
+		}
+		return list, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported option type %v", spec.Type)
+	}
+}
+
+// stringList accepts a single string or a YAML sequence of strings
+func stringList(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		list := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("element %d is not a string", i)
+			}
+			list[i] = s
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("not a list")
+	}
+}
+
+func typeError(spec OptionSpec, value interface{}) error {
+	return fmt.Errorf("expected %s, got %T", spec.Type, value)
+}
+
+// Options holds validated option values keyed by option name
+// Getters return the zero value for options that were not set
+type Options map[string]interface{}
+
+// Has reports whether an option was set
+func (o Options) Has(name string) bool {
+	_, ok := o[name]
+	return ok
+}
+
+// String returns a string or regex option
+func (o Options) String(name string) string {
+	s, _ := o[name].(string)
+	return s
+}
+
+// Int returns an int option
+func (o Options) Int(name string) int {
+	i, _ := o[name].(int)
+	return i
+}
+
+// Bool returns a bool option, or def if it was not set
+func (o Options) Bool(name string, def bool) bool {
+	b, ok := o[name].(bool)
+	if !ok {
+		return def
+	}
+	return b
+}
+
+// Duration returns a duration option
+func (o Options) Duration(name string) time.Duration {
+	d, _ := o[name].(time.Duration)
+	return d
+}
+
+// StringList returns a string list or regex list option
+func (o Options) StringList(name string) []string {
+	list, _ := o[name].([]string)
+	return list
+}
+
+// MapList returns a list of maps option
+func (o Options) MapList(name string) []map[string]interface{} {
+	list, _ := o[name].([]map[string]interface{})
+	return list
+}
@@ -0,0 +1,223 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+func TestRegistry_BuiltinCollectorsRegistered(t *testing.T) {
+	expected := []string{
+		"cpu.temperature",
+		"cpu.usage",
+		"disk.io",
+		"journal",
+		"memory.usage",
+		"network.traffic",
+		"srt.packet_loss",
+	}
+
+	for _, name := range expected {
+		reg, ok := Lookup(name)
+		if !ok {
+			t.Errorf("Expected collector %s to be registered", name)
+			continue
+		}
+		coll, err := reg.Build(Env{DeviceID: "test-device"}, nil)
+		if err != nil {
+			t.Errorf("Failed to build %s with no options: %v", name, err)
+			continue
+		}
+		if coll == nil {
+			t.Errorf("Expected %s factory to return a collector", name)
+		}
+	}
+
+	names := Registered()
+	for i := 1; i < len(names); i++ {
+		if names[i-1] >= names[i] {
+			t.Errorf("Expected Registered() to be sorted, got %v", names)
+			break
+		}
+	}
+}
+
+func TestRegistry_DuplicateRegistrationPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected duplicate registration to panic")
+		}
+	}()
+
+	Register(Registration{
+		Name: "cpu.usage",
+		New: func(env Env, _ Options) (Collector, error) {
+			return NewCPUCollector(env.DeviceID), nil
+		},
+	})
+}
+
+func TestRegistry_UnknownOptionRejected(t *testing.T) {
+	reg, _ := Lookup("disk.io")
+
+	_, err := reg.ParseOptions(map[string]interface{}{"allowed_patern": "^sd[a-z]$"})
+	if err == nil {
+		t.Fatal("Expected unknown option to be rejected")
+	}
+	if !strings.Contains(err.Error(), "unknown option") || !strings.Contains(err.Error(), "allowed_pattern") {
+		t.Errorf("Expected error naming the valid options, got %v", err)
+	}
+
+	reg, _ = Lookup("memory.usage")
+	if _, err := reg.ParseOptions(map[string]interface{}{"anything": true}); err == nil {
+		t.Error("Expected options on a collector without options to be rejected")
+	}
+}
+
+func TestRegistry_OptionTypes(t *testing.T) {
+	reg := Registration{
+		Name: "test.options",
+		Options: []OptionSpec{
+			{Name: "str", Type: OptionString},
+			{Name: "num", Type: OptionInt},
+			{Name: "flag", Type: OptionBool},
+			{Name: "every", Type: OptionDuration},
+			{Name: "match", Type: OptionRegex},
+			{Name: "names", Type: OptionStringList},
+			{Name: "skip", Type: OptionRegexList},
+		},
+		New: func(env Env, _ Options) (Collector, error) { return nil, nil },
+	}
+
+	opts, err := reg.ParseOptions(map[string]interface{}{
+		"str":   "hello",
+		"num":   7,
+		"flag":  true,
+		"every": "15s",
+		"match": "^eth",
+		"names": []interface{}{"a", "b"},
+		"skip":  "^lo$",
+	})
+	if err != nil {
+		t.Fatalf("ParseOptions failed: %v", err)
+	}
+
+	if opts.String("str") != "hello" {
+		t.Errorf("Expected str=hello, got %q", opts.String("str"))
+	}
+	if opts.Int("num") != 7 {
+		t.Errorf("Expected num=7, got %d", opts.Int("num"))
+	}
+	if !opts.Bool("flag", false) {
+		t.Error("Expected flag=true")
+	}
+	if opts.Duration("every") != 15*time.Second {
+		t.Errorf("Expected every=15s, got %v", opts.Duration("every"))
+	}
+	if opts.String("match") != "^eth" {
+		t.Errorf("Expected match=^eth, got %q", opts.String("match"))
+	}
+	if got := opts.StringList("names"); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("Expected names=[a b], got %v", got)
+	}
+	if got := opts.StringList("skip"); len(got) != 1 || got[0] != "^lo$" {
+		t.Errorf("Expected a single string to become a one-element list, got %v", got)
+	}
+	if opts.Has("missing") || opts.Bool("missing", true) != true {
+		t.Error("Expected unset options to report defaults")
+	}
+
+	invalid := []struct {
+		name  string
+		value interface{}
+	}{
+		{"str", 12},
+		{"num", "seven"},
+		{"num", 1.5},
+		{"flag", "yes"},
+		{"every", "soon"},
+		{"every", "-1s"},
+		{"match", "("},
+		{"names", []interface{}{"a", 1}},
+		{"skip", []interface{}{"[invalid"}},
+	}
+	for _, tt := range invalid {
+		if _, err := reg.ParseOptions(map[string]interface{}{tt.name: tt.value}); err == nil {
+			t.Errorf("Expected %s=%v to be rejected", tt.name, tt.value)
+		}
+	}
+}
+
+func TestRegistry_NetworkOptions(t *testing.T) {
+	reg, _ := Lookup("network.traffic")
+
+	coll, err := reg.Build(Env{DeviceID: "test-device"}, map[string]interface{}{
+		"exclude_patterns": []interface{}{"^lo$"},
+		"include_pattern":  "^(eth|wlan)",
+		"max_interfaces":   4,
+	})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	nc := coll.(*NetworkCollector)
+	if nc.maxInterfaces != 4 {
+		t.Errorf("Expected max_interfaces=4, got %d", nc.maxInterfaces)
+	}
+	if !nc.isExcluded("lo") || nc.isExcluded("docker0") {
+		t.Error("Expected exclude_patterns to replace the default exclusions")
+	}
+	if nc.includePattern == nil || !nc.includePattern.MatchString("eth0") || nc.includePattern.MatchString("usb0") {
+		t.Error("Expected include_pattern to be applied")
+	}
+
+	if _, err := reg.ParseOptions(map[string]interface{}{"max_interfaces": 0}); err == nil {
+		t.Error("Expected max_interfaces=0 to be rejected")
+	}
+}
+
+func TestRegistry_DiskOptions(t *testing.T) {
+	reg, _ := Lookup("disk.io")
+
+	coll, err := reg.Build(Env{DeviceID: "test-device"}, map[string]interface{}{
+		"allowed_pattern": "^nvme[0-9]+n[0-9]+$",
+	})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	dc := coll.(*DiskCollector)
+	if !dc.allowedDevs.MatchString("nvme0n1") || dc.allowedDevs.MatchString("sda") {
+		t.Errorf("Expected allowed_pattern to be applied, got %s", dc.allowedDevs)
+	}
+}
+
+type factoryErrorCollector struct{}
+
+func (factoryErrorCollector) Name() string { return "factory_error" }
+func (factoryErrorCollector) Collect(ctx context.Context) ([]*models.Metric, error) {
+	return nil, nil
+}
+
+func TestRegistry_BuildWrapsFactoryError(t *testing.T) {
+	reg := Registration{
+		Name: "test.factory_error",
+		New: func(env Env, _ Options) (Collector, error) {
+			if env.DeviceID == "" {
+				return nil, errors.New("device id required")
+			}
+			return factoryErrorCollector{}, nil
+		},
+	}
+
+	if _, err := reg.Build(Env{}, nil); err == nil || !strings.Contains(err.Error(), "test.factory_error") {
+		t.Errorf("Expected factory error prefixed with collector name, got %v", err)
+	}
+	if _, err := reg.Build(Env{DeviceID: "dev"}, nil); err != nil {
+		t.Errorf("Expected build to succeed, got %v", err)
+	}
+}
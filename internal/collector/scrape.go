@@ -0,0 +1,328 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+const (
+	// DefaultScrapeTimeout is how long a scrape may take
+	DefaultScrapeTimeout = 5 * time.Second
+
+	// DefaultScrapeSampleLimit caps the samples stored per target and scrape
+	DefaultScrapeSampleLimit = 10000
+
+	// scrapeMaxBody caps a response body, so a broken target cannot exhaust memory
+	scrapeMaxBody = 8 << 20
+
+	// scrapeAccept prefers the Prometheus text format and also takes OpenMetrics
+	scrapeAccept = "text/plain;version=0.0.4;q=1,application/openmetrics-text;version=1.0.0;q=0.5,*/*;q=0.1"
+
+	// openMetricsType is the content type of OpenMetrics, parsed with ParseOpenMetrics
+	openMetricsType = "application/openmetrics-text"
+)
+
+// ScrapeTarget is a local /metrics endpoint scraped by the scrape collector
+type ScrapeTarget struct {
+	Name        string            // Set as the target tag and used in the health component
+	URL         string            // http(s) URL on localhost
+	Labels      map[string]string // Added to every sample, overriding scraped labels
+	Timeout     time.Duration     // 0 = collector default
+	SampleLimit int               // 0 = collector default; more samples fail the scrape
+}
+
+// ParseScrapeTargets converts targets from metrics[].options into ScrapeTargets
+// Each target needs name and url (on localhost); labels, timeout and sample_limit are optional.
+func ParseScrapeTargets(raw []map[string]interface{}) ([]ScrapeTarget, error) {
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("targets: at least one target is required")
+	}
+
+	targets := make([]ScrapeTarget, 0, len(raw))
+	seen := make(map[string]bool)
+	for i, r := range raw {
+		for key := range r {
+			switch key {
+			case "name", "url", "labels", "timeout", "sample_limit":
+			default:
+				return nil, fmt.Errorf("targets[%d]: unknown key %q (valid keys: name, url, labels, timeout, sample_limit)", i, key)
+			}
+		}
+
+		name, _ := r["name"].(string)
+		if name == "" || strings.ContainsAny(name, "/ ") {
+			return nil, fmt.Errorf("targets[%d]: name is required and must not contain spaces or slashes", i)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("targets[%d]: duplicate name %q", i, name)
+		}
+		seen[name] = true
+
+		rawURL, _ := r["url"].(string)
+		if err := validateScrapeURL(rawURL); err != nil {
+			return nil, fmt.Errorf("target %s: %w", name, err)
+		}
+		target := ScrapeTarget{Name: name, URL: rawURL}
+
+		if v, ok := r["labels"]; ok {
+			labels, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("target %s: labels must be a map, got %T", name, v)
+			}
+			target.Labels = make(map[string]string, len(labels))
+			for key, value := range labels {
+				s, ok := value.(string)
+				if !ok || key == "" {
+					return nil, fmt.Errorf("target %s: label %q must have a string value, got %v", name, key, value)
+				}
+				target.Labels[key] = s
+			}
+		}
+		if v, ok := r["timeout"]; ok {
+			s, _ := v.(string)
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("target %s: timeout must be a positive duration, got %v", name, v)
+			}
+			target.Timeout = d
+		}
+		if v, ok := r["sample_limit"]; ok {
+			n, ok := v.(int)
+			if !ok || n <= 0 {
+				return nil, fmt.Errorf("target %s: sample_limit must be a positive integer, got %v", name, v)
+			}
+			target.SampleLimit = n
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// validateScrapeURL accepts http and https URLs on a loopback host
+func validateScrapeURL(rawURL string) error {
+	if rawURL == "" {
+		return fmt.Errorf("url is required")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %w", rawURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url %q must use http or https", rawURL)
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("url %q must point at localhost", rawURL)
+	}
+	return nil
+}
+
+func init() {
+	Register(Registration{
+		Name: "scrape",
+		Options: []OptionSpec{
+			{Name: "targets", Type: OptionMapList, Description: "Local endpoints to scrape: name, url, labels, timeout, sample_limit"},
+			{Name: "timeout", Type: OptionDuration, Description: "Default scrape timeout (default: 5s)"},
+			{Name: "sample_limit", Type: OptionInt, Description: "Default samples allowed per target (default: 10000)"},
+		},
+		Validate: func(opts Options) error {
+			if opts.Has("sample_limit") && opts.Int("sample_limit") <= 0 {
+				return fmt.Errorf("sample_limit must be positive, got %d", opts.Int("sample_limit"))
+			}
+			_, err := ParseScrapeTargets(opts.MapList("targets"))
+			return err
+		},
+		New: func(env Env, opts Options) (Collector, error) {
+			targets, err := ParseScrapeTargets(opts.MapList("targets"))
+			if err != nil {
+				return nil, err
+			}
+			return NewScrapeCollector(ScrapeCollectorConfig{
+				DeviceID:    env.DeviceID,
+				Targets:     targets,
+				Timeout:     opts.Duration("timeout"),
+				SampleLimit: opts.Int("sample_limit"),
+				Logger:      env.Logger,
+			}), nil
+		},
+	})
+}
+
+// ScrapeCollectorConfig configures the scrape collector
+type ScrapeCollectorConfig struct {
+	DeviceID    string
+	Targets     []ScrapeTarget
+	Timeout     time.Duration // Default per target (default: 5s)
+	SampleLimit int           // Default per target (default: 10000)
+	Logger      *slog.Logger
+}
+
+// ScrapeCollector scrapes Prometheus text endpoints of other services on the device
+// Scraped samples go through the normal storage path, so they are buffered while offline and
+// uploaded like any other metric. Targets are scraped in parallel; a failed scrape (connection
+// error, non-200 status, parse error or too many samples) stores nothing for that target.
+type ScrapeCollector struct {
+	deviceID string
+	targets  []ScrapeTarget
+	client   *http.Client
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	sources []SourceStatus // Outcome of each target in the last Collect
+}
+
+// NewScrapeCollector creates a new scrape collector
+func NewScrapeCollector(cfg ScrapeCollectorConfig) *ScrapeCollector {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultScrapeTimeout
+	}
+	sampleLimit := cfg.SampleLimit
+	if sampleLimit <= 0 {
+		sampleLimit = DefaultScrapeSampleLimit
+	}
+
+	c := &ScrapeCollector{
+		deviceID: cfg.DeviceID,
+		targets:  make([]ScrapeTarget, len(cfg.Targets)),
+		// Targets are local: never go through a proxy from the environment
+		client: &http.Client{Transport: &http.Transport{Proxy: nil}},
+		logger: cfg.Logger,
+	}
+	for i, t := range cfg.Targets {
+		if t.Timeout <= 0 {
+			t.Timeout = timeout
+		}
+		if t.SampleLimit <= 0 {
+			t.SampleLimit = sampleLimit
+		}
+		c.targets[i] = t
+	}
+	if c.logger == nil {
+		c.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return c
+}
+
+// Name returns the collector name
+func (c *ScrapeCollector) Name() string {
+	return "scrape"
+}
+
+// Collect scrapes every target and returns their samples with scrape.up, scrape.duration_seconds
+// and scrape.samples for each target
+func (c *ScrapeCollector) Collect(ctx context.Context) ([]*models.Metric, error) {
+	results := make([][]*models.Metric, len(c.targets))
+	sources := make([]SourceStatus, len(c.targets))
+
+	var wg sync.WaitGroup
+	for i := range c.targets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			target := &c.targets[i]
+
+			start := time.Now()
+			metrics, err := c.scrape(ctx, target)
+			duration := time.Since(start)
+
+			up := 1.0
+			if err != nil {
+				up = 0
+				metrics = nil
+				c.logger.Warn("Scrape failed",
+					slog.String("target", target.Name),
+					slog.String("url", target.URL),
+					slog.Any("error", err),
+				)
+			}
+			samples := len(metrics)
+			metrics = append(metrics,
+				models.NewMetric("scrape.up", up, c.deviceID).AsGauge("").WithTag("target", target.Name),
+				models.NewMetric("scrape.duration_seconds", duration.Seconds(), c.deviceID).AsGauge("seconds").WithTag("target", target.Name),
+				models.NewMetric("scrape.samples", float64(samples), c.deviceID).AsGauge("").WithTag("target", target.Name),
+			)
+			results[i] = metrics
+			sources[i] = SourceStatus{Name: target.Name, Metrics: samples, Err: err}
+		}(i)
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	c.sources = sources
+	c.mu.Unlock()
+
+	var metrics []*models.Metric
+	for _, r := range results {
+		metrics = append(metrics, r...)
+	}
+	return metrics, nil
+}
+
+// Sources returns the outcome of each target in the last Collect
+func (c *ScrapeCollector) Sources() []SourceStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]SourceStatus(nil), c.sources...)
+}
+
+// scrape fetches and parses one target, tagging its samples
+func (c *ScrapeCollector) scrape(ctx context.Context, target *ScrapeTarget) ([]*models.Metric, error) {
+	ctx, cancel := context.WithTimeout(ctx, target.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", scrapeAccept)
+
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, scrapeMaxBody+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if len(body) > scrapeMaxBody {
+		return nil, fmt.Errorf("response exceeds %d bytes", scrapeMaxBody)
+	}
+
+	// OpenMetrics timestamps are seconds instead of milliseconds
+	parse := ParseTextfile
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == openMetricsType {
+		parse = ParseOpenMetrics
+	}
+	metrics, err := parse(string(body), c.deviceID, start)
+	if err != nil {
+		return nil, err
+	}
+	if len(metrics) > target.SampleLimit {
+		return nil, fmt.Errorf("sample limit exceeded (%d samples, limit %d)", len(metrics), target.SampleLimit)
+	}
+	for _, m := range metrics {
+		m.WithTag("target", target.Name)
+		for key, value := range target.Labels {
+			m.WithTag(key, value)
+		}
+	}
+	return metrics, nil
+}
@@ -0,0 +1,169 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+// targetStatus returns the scrape status metrics of a target, by name
+func targetStatus(metrics []*models.Metric, target string) map[string]float64 {
+	status := make(map[string]float64)
+	for _, m := range metrics {
+		if strings.HasPrefix(m.Name, "scrape.") && m.Tags["target"] == target {
+			status[m.Name] = m.Value
+		}
+	}
+	return status
+}
+
+func TestParseScrapeTargets(t *testing.T) {
+	targets, err := ParseScrapeTargets([]map[string]interface{}{
+		{"name": "srtla", "url": "http://127.0.0.1:9101/metrics", "labels": map[string]interface{}{"link": "bonded"}, "timeout": "2s", "sample_limit": 500},
+		{"name": "webui", "url": "http://localhost/metrics"},
+		{"name": "v6", "url": "https://[::1]:8443/metrics"},
+	})
+	if err != nil {
+		t.Fatalf("ParseScrapeTargets failed: %v", err)
+	}
+	if got := targets[0]; got.Labels["link"] != "bonded" || got.Timeout != 2*time.Second || got.SampleLimit != 500 {
+		t.Errorf("Unexpected target %+v", got)
+	}
+
+	target := func(key string, value interface{}) map[string]interface{} {
+		r := map[string]interface{}{"name": "x", "url": "http://127.0.0.1/metrics"}
+		r[key] = value
+		return r
+	}
+	tests := []struct {
+		raw     []map[string]interface{}
+		wantErr string
+	}{
+		{nil, "at least one target"},
+		{[]map[string]interface{}{target("path", "/metrics")}, `unknown key "path"`},
+		{[]map[string]interface{}{target("name", "")}, "name is required"},
+		{[]map[string]interface{}{target("url", "")}, "url is required"},
+		{[]map[string]interface{}{target("url", "unix:///run/app.sock")}, "must use http or https"},
+		{[]map[string]interface{}{target("url", "http://192.168.1.10/metrics")}, "must point at localhost"},
+		{[]map[string]interface{}{target("url", "http://example.com/metrics")}, "must point at localhost"},
+		{[]map[string]interface{}{target("labels", "x")}, "labels must be a map"},
+		{[]map[string]interface{}{target("labels", map[string]interface{}{"n": 1})}, "must have a string value"},
+		{[]map[string]interface{}{target("timeout", "soon")}, "timeout must be a positive duration"},
+		{[]map[string]interface{}{target("sample_limit", 0)}, "sample_limit must be a positive integer"},
+		{[]map[string]interface{}{target("name", "x"), target("name", "x")}, `duplicate name "x"`},
+	}
+	for _, tt := range tests {
+		_, err := ParseScrapeTargets(tt.raw)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+		}
+	}
+}
+
+func TestScrapeCollector_Collect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/srtla", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Accept"), "text/plain") {
+			t.Errorf("Expected the text format requested, got Accept %q", r.Header.Get("Accept"))
+		}
+		fmt.Fprint(w, "# TYPE srtla_packets counter\nsrtla_packets_total{conn=\"wwan0\",link=\"scraped\"} 1200\nsrtla_rtt_ms{conn=\"wwan0\"} 48\n"+
+			"# TYPE srtla_ack_seconds summary\nsrtla_ack_seconds{quantile=\"0.5\"} NaN\n")
+	})
+	mux.HandleFunc("/openmetrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		fmt.Fprint(w, "# TYPE encoder_up gauge\nencoder_up 1 1772359200.123\n# EOF\n")
+	})
+	mux.HandleFunc("/webui", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "starting", http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/garbage", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html>not metrics</html>\n")
+	})
+	mux.HandleFunc("/busy", func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 20; i++ {
+			fmt.Fprintf(w, "series{i=\"%d\"} 1\n", i)
+		}
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewScrapeCollector(ScrapeCollectorConfig{
+		DeviceID: "test-device",
+		Targets: []ScrapeTarget{
+			{Name: "srtla", URL: server.URL + "/srtla", Labels: map[string]string{"link": "bonded"}},
+			{Name: "webui", URL: server.URL + "/webui"},
+			{Name: "garbage", URL: server.URL + "/garbage"},
+			{Name: "openmetrics", URL: server.URL + "/openmetrics"},
+			{Name: "busy", URL: server.URL + "/busy", SampleLimit: 10},
+			{Name: "slow", URL: server.URL + "/slow", Timeout: 100 * time.Millisecond},
+		},
+		SampleLimit: 100,
+	})
+
+	start := time.Now()
+	metrics, err := c.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the slow target cut off by its timeout, took %v", elapsed)
+	}
+
+	byName := metricsByName(metrics)
+	packets := byName["srtla_packets_total"]
+	if len(packets) != 1 || packets[0].Kind != models.KindCounter || packets[0].Value != 1200 {
+		t.Fatalf("Unexpected scraped counter %+v", packets)
+	}
+	if tags := packets[0].Tags; tags["target"] != "srtla" || tags["link"] != "bonded" || tags["conn"] != "wwan0" {
+		t.Errorf("Expected target labels over scraped labels, got %v", tags)
+	}
+	if up := byName["encoder_up"]; len(up) != 1 || up[0].Value != 1 || up[0].TimestampMs != 1772359200123 || up[0].Tags["target"] != "openmetrics" {
+		t.Errorf("Expected the OpenMetrics sample with its timestamp in milliseconds, got %+v", up)
+	}
+	if len(byName["series"]) != 0 {
+		t.Errorf("Expected nothing stored from a target over its sample limit, got %d", len(byName["series"]))
+	}
+
+	if got := targetStatus(metrics, "srtla"); got["scrape.up"] != 1 || got["scrape.samples"] != 2 {
+		t.Errorf("Expected srtla up with 2 samples and the NaN quantile dropped, got %v", got)
+	}
+	if got := targetStatus(metrics, "openmetrics"); got["scrape.up"] != 1 || got["scrape.samples"] != 1 {
+		t.Errorf("Expected openmetrics up with 1 sample, got %v", got)
+	}
+	for _, name := range []string{"webui", "garbage", "busy", "slow"} {
+		if got := targetStatus(metrics, name); got["scrape.up"] != 0 || got["scrape.samples"] != 0 {
+			t.Errorf("%s: expected down with no samples, got %v", name, got)
+		}
+	}
+
+	wantErr := map[string]string{
+		"srtla":       "",
+		"webui":       "HTTP 503",
+		"garbage":     "line 1",
+		"openmetrics": "",
+		"busy":        "sample limit exceeded (20 samples, limit 10)",
+		"slow":        "deadline exceeded",
+	}
+	sources := c.Sources()
+	if len(sources) != len(wantErr) {
+		t.Fatalf("Expected one source per target, got %+v", sources)
+	}
+	for _, s := range sources {
+		want := wantErr[s.Name]
+		if (want == "") != (s.Err == nil) || (s.Err != nil && !strings.Contains(s.Err.Error(), want)) {
+			t.Errorf("%s: expected error containing %q, got %v", s.Name, want, s.Err)
+		}
+	}
+}
@@ -23,6 +23,15 @@ func NewSystemCollector(deviceID string) *SystemCollector {
 	}
 }
 
+func init() {
+	Register(Registration{
+		Name: "cpu.temperature",
+		New: func(env Env, _ Options) (Collector, error) {
+			return NewSystemCollector(env.DeviceID), nil
+		},
+	})
+}
+
 // Name returns the collector name
 func (c *SystemCollector) Name() string {
 	return "system"
@@ -35,7 +44,7 @@ func (c *SystemCollector) Collect(ctx context.Context) ([]*models.Metric, error)
 	// CPU Temperature (real on Linux, mock on macOS)
 	temp, err := c.getCPUTemperature()
 	if err == nil {
-		m := models.NewMetric("cpu.temperature", temp, c.deviceID)
+		m := models.NewMetric("cpu.temperature", temp, c.deviceID).AsGauge("celsius")
 		metrics = append(metrics, m)
 	}
 
@@ -106,7 +115,7 @@ func (c *SystemCollector) getAllThermalZones() ([]*models.Metric, error) {
 
 		temp := float64(millideg) / 1000.0
 
-		m := models.NewMetric("thermal.zone_temp", temp, c.deviceID).
+		m := models.NewMetric("thermal.zone_temp", temp, c.deviceID).AsGauge("celsius").
 			WithTag("zone", zoneType).
 			WithTag("zone_number", entry.Name())
 
@@ -0,0 +1,430 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+const (
+	// DefaultTextfileDirectory is where on-device scripts drop their *.prom files
+	DefaultTextfileDirectory = "/var/lib/tidewatch/textfile"
+
+	// DefaultTextfileMaxAge is how long a file is used after its last write
+	DefaultTextfileMaxAge = 10 * time.Minute
+
+	// maxTextfileSize caps a single file, so a runaway script cannot exhaust memory
+	maxTextfileSize = 1 << 20
+)
+
+func init() {
+	Register(Registration{
+		Name: "textfile",
+		Options: []OptionSpec{
+			{Name: "directory", Type: OptionString, Description: "Directory scanned for *.prom files (default: /var/lib/tidewatch/textfile)"},
+			{Name: "max_age", Type: OptionDuration, Description: "Files not written for longer are ignored as stale (default: 10m)"},
+		},
+		New: func(env Env, opts Options) (Collector, error) {
+			return NewTextfileCollector(TextfileCollectorConfig{
+				DeviceID:  env.DeviceID,
+				Directory: opts.String("directory"),
+				MaxAge:    opts.Duration("max_age"),
+				Logger:    env.Logger,
+			}), nil
+		},
+	})
+}
+
+// TextfileCollectorConfig configures the textfile collector
+type TextfileCollectorConfig struct {
+	DeviceID  string
+	Directory string        // Directory scanned for *.prom files (default: /var/lib/tidewatch/textfile)
+	MaxAge    time.Duration // Files not modified for longer are stale (default: 10m)
+	Logger    *slog.Logger
+}
+
+// TextfileCollector reads metrics that other programs write in Prometheus text format
+// Scripts should write to a temporary file and rename it to *.prom. Hidden files, files still being
+// written (empty or without a trailing newline) and stale files are skipped; a file with a syntax
+// error is skipped entirely, so a half-parsed file never reaches storage.
+type TextfileCollector struct {
+	deviceID  string
+	directory string
+	maxAge    time.Duration
+	logger    *slog.Logger
+
+	// Replaced in tests
+	now func() time.Time
+
+	mu      sync.Mutex
+	sources map[string]SourceStatus // File name -> outcome of the last Collect
+}
+
+// NewTextfileCollector creates a new textfile collector
+func NewTextfileCollector(cfg TextfileCollectorConfig) *TextfileCollector {
+	c := &TextfileCollector{
+		deviceID:  cfg.DeviceID,
+		directory: cfg.Directory,
+		maxAge:    cfg.MaxAge,
+		logger:    cfg.Logger,
+		now:       time.Now,
+		sources:   make(map[string]SourceStatus),
+	}
+	if c.directory == "" {
+		c.directory = DefaultTextfileDirectory
+	}
+	if c.maxAge <= 0 {
+		c.maxAge = DefaultTextfileMaxAge
+	}
+	if c.logger == nil {
+		c.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return c
+}
+
+// Name returns the collector name
+func (c *TextfileCollector) Name() string {
+	return "textfile"
+}
+
+// errIncomplete marks a file that is still being written
+var errIncomplete = errors.New("incomplete file")
+
+// Collect parses every *.prom file in the directory
+// It fails only when the directory cannot be read or every file failed; per-file errors are
+// reported through Sources.
+func (c *TextfileCollector) Collect(ctx context.Context) ([]*models.Metric, error) {
+	if _, err := os.Stat(c.directory); err != nil {
+		return nil, fmt.Errorf("failed to read textfile directory: %w", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(c.directory, "*.prom"))
+	if err != nil {
+		return nil, err
+	}
+
+	now := c.now()
+	var metrics []*models.Metric
+	var errs []error
+	sources := make(map[string]SourceStatus, len(paths))
+
+	c.mu.Lock()
+	previous := c.sources
+	c.mu.Unlock()
+
+	for _, path := range paths {
+		name := filepath.Base(path)
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		fileMetrics, err := c.readFile(path, now)
+		if errors.Is(err, errIncomplete) {
+			// Keep the last outcome until the writer is done
+			c.logger.Debug("Skipping textfile still being written", slog.String("file", name))
+			status, ok := previous[name]
+			if !ok {
+				status = SourceStatus{Name: name}
+			}
+			sources[name] = status
+			continue
+		}
+		if err != nil {
+			c.logger.Warn("Skipping textfile",
+				slog.String("file", name),
+				slog.Any("error", err),
+			)
+			sources[name] = SourceStatus{Name: name, Err: err}
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		sources[name] = SourceStatus{Name: name, Metrics: len(fileMetrics)}
+		metrics = append(metrics, fileMetrics...)
+	}
+
+	c.mu.Lock()
+	c.sources = sources
+	c.mu.Unlock()
+
+	if len(metrics) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return metrics, nil
+}
+
+// Sources returns the outcome of each file in the last Collect, sorted by name
+func (c *TextfileCollector) Sources() []SourceStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sources := make([]SourceStatus, 0, len(c.sources))
+	for _, s := range c.sources {
+		sources = append(sources, s)
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].Name < sources[j].Name })
+	return sources
+}
+
+// readFile checks that a file is complete and fresh, then parses it
+func (c *TextfileCollector) readFile(path string, now time.Time) ([]*models.Metric, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("not a regular file")
+	}
+	if info.Size() > maxTextfileSize {
+		return nil, fmt.Errorf("file too large (%d bytes, max %d)", info.Size(), maxTextfileSize)
+	}
+	if age := now.Sub(info.ModTime()); age > c.maxAge {
+		return nil, fmt.Errorf("stale: not updated for %v (max_age %v)", age.Truncate(time.Second), c.maxAge)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// The format requires a final newline; without one the writer has not finished
+	if len(data) == 0 || data[len(data)-1] != '\n' {
+		return nil, errIncomplete
+	}
+	return ParseTextfile(string(data), c.deviceID, now)
+}
+
+// ParseTextfile parses Prometheus text exposition format into metrics
+// Labels become tags. Samples without a timestamp get now. Counters keep their kind, histogram
+// _bucket, _sum and _count samples are histogram components, and everything else (gauges,
+// summaries, untyped and the other OpenMetrics types) is stored as a gauge. Exemplars are dropped,
+// and so are NaN and infinite samples (e.g. the quantiles of an empty Go summary), which storage
+// and upload receivers cannot represent. The first malformed line fails the whole input.
+// Timestamps are milliseconds, as in the Prometheus text format.
+func ParseTextfile(data string, deviceID string, now time.Time) ([]*models.Metric, error) {
+	return parseExposition(data, deviceID, now, false)
+}
+
+// ParseOpenMetrics parses OpenMetrics text into metrics like ParseTextfile
+// Timestamps are seconds, possibly fractional, and the input ends at the "# EOF" line.
+func ParseOpenMetrics(data string, deviceID string, now time.Time) ([]*models.Metric, error) {
+	return parseExposition(data, deviceID, now, true)
+}
+
+// parseExposition parses Prometheus text (millisecond timestamps) or OpenMetrics (second timestamps)
+func parseExposition(data string, deviceID string, now time.Time, openMetrics bool) ([]*models.Metric, error) {
+	types := make(map[string]string)
+	var metrics []*models.Metric
+
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if openMetrics && line == "# EOF" {
+			break
+		}
+		if strings.HasPrefix(line, "#") {
+			// # TYPE <name> <type>; HELP and other comments are ignored
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && fields[1] == "TYPE" {
+				if len(fields) != 4 {
+					return nil, fmt.Errorf("line %d: malformed TYPE line", i+1)
+				}
+				switch fields[3] {
+				case "counter", "gauge", "histogram", "summary", "untyped",
+					"unknown", "info", "stateset", "gaugehistogram": // OpenMetrics
+				default:
+					return nil, fmt.Errorf("line %d: unknown type %q", i+1, fields[3])
+				}
+				if _, ok := types[fields[2]]; ok {
+					return nil, fmt.Errorf("line %d: second TYPE line for %s", i+1, fields[2])
+				}
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		m, err := parseSample(line, deviceID, now, openMetrics)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if math.IsNaN(m.Value) || math.IsInf(m.Value, 0) {
+			continue
+		}
+		m.Kind = sampleKind(m.Name, types)
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
+// sampleKind maps a sample to a metric kind from the TYPE of its family
+func sampleKind(name string, types map[string]string) models.Kind {
+	typ, ok := types[name]
+	if !ok {
+		for _, suffix := range []string{"_total", "_bucket", "_sum", "_count"} {
+			if family, found := strings.CutSuffix(name, suffix); found {
+				if typ, ok = types[family]; ok {
+					break
+				}
+			}
+		}
+	}
+	switch typ {
+	case "counter":
+		return models.KindCounter
+	case "histogram":
+		for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+			if strings.HasSuffix(name, suffix) {
+				return models.KindHistogram
+			}
+		}
+	}
+	return models.KindGauge
+}
+
+// parseSample parses `name{label="value",...} value [timestamp]`
+// The timestamp is in milliseconds, or in (possibly fractional) seconds with seconds set.
+func parseSample(line string, deviceID string, now time.Time, seconds bool) (*models.Metric, error) {
+	end := 0
+	for end < len(line) && isNameChar(line[end], end == 0) {
+		end++
+	}
+	if end == 0 {
+		return nil, fmt.Errorf("invalid metric name in %q", line)
+	}
+	m := models.NewMetric(line[:end], 0, deviceID).WithTimestamp(now)
+	rest := line[end:]
+
+	if strings.HasPrefix(rest, "{") {
+		var err error
+		rest, err = parseLabels(rest[1:], m)
+		if err != nil {
+			return nil, err
+		}
+	} else if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		return nil, fmt.Errorf("invalid metric name in %q", line)
+	}
+
+	// OpenMetrics exemplars follow the value and timestamp after " # "
+	rest, _, _ = strings.Cut(rest, "#")
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("expected a value and an optional timestamp after %s", m.Name)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q for %s", fields[0], m.Name)
+	}
+	m.Value = value
+	if len(fields) == 2 {
+		ms, err := parseTimestamp(fields[1], seconds)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q for %s", fields[1], m.Name)
+		}
+		m.TimestampMs = ms
+	}
+	return m, nil
+}
+
+// parseTimestamp parses a sample timestamp into Unix milliseconds
+func parseTimestamp(s string, seconds bool) (int64, error) {
+	if !seconds {
+		return strconv.ParseInt(s, 10, 64)
+	}
+	sec, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(sec) || math.IsInf(sec, 0) {
+		return 0, fmt.Errorf("timestamp %q is not finite", s)
+	}
+	return int64(math.Round(sec * 1000)), nil
+}
+
+// parseLabels parses the label pairs after "{" into tags and returns the text after "}"
+func parseLabels(s string, m *models.Metric) (string, error) {
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if strings.HasPrefix(s, "}") {
+			return s[1:], nil
+		}
+
+		end := 0
+		for end < len(s) && isNameChar(s[end], end == 0) && s[end] != ':' {
+			end++
+		}
+		if end == 0 {
+			return "", fmt.Errorf("invalid label name in %s", m.Name)
+		}
+		name := s[:end]
+		s = strings.TrimLeft(s[end:], " \t")
+		if !strings.HasPrefix(s, "=") {
+			return "", fmt.Errorf("expected = after label %s of %s", name, m.Name)
+		}
+		s = strings.TrimLeft(s[1:], " \t")
+		if !strings.HasPrefix(s, `"`) {
+			return "", fmt.Errorf("expected a quoted value for label %s of %s", name, m.Name)
+		}
+
+		var value strings.Builder
+		closed := false
+		i := 1
+		for ; i < len(s); i++ {
+			if s[i] == '"' {
+				closed = true
+				break
+			}
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				case '\\', '"':
+					value.WriteByte(s[i])
+				default:
+					return "", fmt.Errorf("invalid escape \\%c in label %s of %s", s[i], name, m.Name)
+				}
+				continue
+			}
+			value.WriteByte(s[i])
+		}
+		if !closed {
+			return "", fmt.Errorf("unterminated value for label %s of %s", name, m.Name)
+		}
+		if _, dup := m.Tags[name]; dup {
+			return "", fmt.Errorf("duplicate label %s of %s", name, m.Name)
+		}
+		m.WithTag(name, value.String())
+
+		s = strings.TrimLeft(s[i+1:], " \t")
+		switch {
+		case strings.HasPrefix(s, ","):
+			s = s[1:]
+		case strings.HasPrefix(s, "}"):
+		default:
+			return "", fmt.Errorf("expected , or } after label %s of %s", name, m.Name)
+		}
+	}
+}
+
+// isNameChar reports whether b may appear in a metric name ([a-zA-Z_:][a-zA-Z0-9_:]*)
+func isNameChar(b byte, first bool) bool {
+	switch {
+	case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b == '_', b == ':':
+		return true
+	case b >= '0' && b <= '9':
+		return !first
+	default:
+		return false
+	}
+}
@@ -0,0 +1,208 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+func TestParseTextfile(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	data := `# HELP modem_signal_rssi_dbm Received signal strength
+# TYPE modem_signal_rssi_dbm gauge
+modem_signal_rssi_dbm{modem="wwan0",band="B3"} -71
+# TYPE modem_reconnects counter
+modem_reconnects_total{modem="wwan0"} 4
+# TYPE hdmi_lock_seconds histogram
+hdmi_lock_seconds_bucket{le="0.5"} 2 # {trace_id="a#1"} 0.3
+hdmi_lock_seconds_bucket{le="+Inf"} 3
+hdmi_lock_seconds_sum 2.5
+hdmi_lock_seconds_count 3
+hdmi_input_present 1 1772359200000
+hdmi_input_name{path="C:\\in",desc="say \"hi\"\nbye",} 1
+# TYPE encoder_latency_seconds summary
+encoder_latency_seconds{quantile="0.5"} NaN
+encoder_latency_seconds{quantile="0.99"} +Inf
+encoder_latency_seconds_count 0
+`
+	metrics, err := ParseTextfile(data, "test-device", now)
+	if err != nil {
+		t.Fatalf("ParseTextfile failed: %v", err)
+	}
+	byName := metricsByName(metrics)
+	if len(metrics) != 9 {
+		t.Fatalf("Expected 9 samples, got %d", len(metrics))
+	}
+
+	rssi := byName["modem_signal_rssi_dbm"][0]
+	if rssi.Value != -71 || rssi.Kind != models.KindGauge || rssi.Tags["modem"] != "wwan0" || rssi.Tags["band"] != "B3" {
+		t.Errorf("Unexpected rssi sample %+v", rssi)
+	}
+	if rssi.DeviceID != "test-device" || rssi.TimestampMs != now.UnixMilli() {
+		t.Errorf("Expected the device ID and collection time, got %+v", rssi)
+	}
+	if got := byName["modem_reconnects_total"][0]; got.Kind != models.KindCounter || got.Value != 4 {
+		t.Errorf("Expected a counter, got %+v", got)
+	}
+	for _, name := range []string{"hdmi_lock_seconds_bucket", "hdmi_lock_seconds_sum", "hdmi_lock_seconds_count"} {
+		if got := byName[name][0]; got.Kind != models.KindHistogram {
+			t.Errorf("Expected %s to be a histogram component, got %s", name, got.Kind)
+		}
+	}
+	if got := byName["hdmi_lock_seconds_bucket"][1]; got.Tags["le"] != "+Inf" || got.Value != 3 {
+		t.Errorf("Unexpected +Inf bucket %+v", got)
+	}
+	if got := byName["hdmi_input_present"][0]; got.TimestampMs != 1772359200000 || got.Kind != models.KindGauge {
+		t.Errorf("Expected the explicit timestamp on an untyped gauge, got %+v", got)
+	}
+	name := byName["hdmi_input_name"][0]
+	if name.Tags["path"] != `C:\in` || name.Tags["desc"] != "say \"hi\"\nbye" {
+		t.Errorf("Expected unescaped labels, got %+v", name)
+	}
+	if got := byName["encoder_latency_seconds"]; len(got) != 0 {
+		t.Errorf("Expected NaN and infinite samples dropped, got %+v", got)
+	}
+}
+
+func TestParseTextfile_Errors(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		data    string
+		wantErr string
+	}{
+		{"ok 1\n9bad 1\n", "line 2: invalid metric name"},
+		{"m-x 1\n", "invalid metric name"},
+		{"m\n", "expected a value"},
+		{"m 1 2 3\n", "expected a value"},
+		{"m abc\n", `invalid value "abc"`},
+		{"m 1 1.5\n", `invalid timestamp "1.5"`},
+		{`m{a="1" 1` + "\n", "expected , or }"},
+		{`m{a=1} 1` + "\n", "expected a quoted value"},
+		{`m{a="1} 1` + "\n", "unterminated value"},
+		{`m{a="1",a="2"} 1` + "\n", "duplicate label a"},
+		{`m{a="\t"} 1` + "\n", "invalid escape"},
+		{"# TYPE m gauge\n# TYPE m counter\n", "second TYPE line"},
+		{"# TYPE m enum\n", `unknown type "enum"`},
+	}
+	for _, tt := range tests {
+		_, err := ParseTextfile(tt.data, "test-device", now)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%q: expected error containing %q, got %v", tt.data, tt.wantErr, err)
+		}
+	}
+}
+
+func TestParseOpenMetrics(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	data := `# TYPE srt_rtt_seconds gauge
+# UNIT srt_rtt_seconds seconds
+srt_rtt_seconds{link="wwan0"} 0.042 1772359200.123
+srt_rtt_seconds{link="wwan1"} 0.051 1772359200
+srt_rtt_seconds{link="eth0"} 0.003
+# EOF
+ignored 1
+`
+	metrics, err := ParseOpenMetrics(data, "test-device", now)
+	if err != nil {
+		t.Fatalf("ParseOpenMetrics failed: %v", err)
+	}
+	if len(metrics) != 3 {
+		t.Fatalf("Expected 3 samples before # EOF, got %d", len(metrics))
+	}
+	for i, want := range []int64{1772359200123, 1772359200000, now.UnixMilli()} {
+		if metrics[i].TimestampMs != want {
+			t.Errorf("Sample %d: expected timestamp %d, got %d", i, want, metrics[i].TimestampMs)
+		}
+	}
+
+	for _, data := range []string{"m 1 abc\n", "m 1 NaN\n"} {
+		if _, err := ParseOpenMetrics(data, "test-device", now); err == nil || !strings.Contains(err.Error(), "invalid timestamp") {
+			t.Errorf("%q: expected an invalid timestamp error, got %v", data, err)
+		}
+	}
+}
+
+func TestTextfileCollector_Collect(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	write := func(name, content string, age time.Duration) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("modem.prom", "modem_signal_rssi_dbm -71\nmodem_signal_snr_db 12\n", time.Minute)
+	write("hdmi.prom", "hdmi_input_present{port=\"1\"} 1\n", 0)
+	write("broken.prom", "hdmi_input_present{port=1} 1\n", 0)
+	write("old.prom", "old_value 1\n", time.Hour)
+	write("partial.prom", "partial_value 1\npartial_", 0)
+	write(".hidden.prom", "hidden_value 1\n", 0)
+	write("notes.txt", "notes_value 1\n", 0)
+
+	c := NewTextfileCollector(TextfileCollectorConfig{DeviceID: "test-device", Directory: dir})
+	c.now = func() time.Time { return now }
+
+	metrics, err := c.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	byName := metricsByName(metrics)
+	if len(metrics) != 3 || len(byName["modem_signal_rssi_dbm"]) != 1 || byName["hdmi_input_present"][0].Tags["port"] != "1" {
+		t.Errorf("Expected only the samples of complete, fresh and valid files, got %v", byName)
+	}
+
+	sources := c.Sources()
+	got := make(map[string]SourceStatus)
+	for _, s := range sources {
+		got[s.Name] = s
+	}
+	if len(sources) != 5 || sources[0].Name != "broken.prom" {
+		t.Fatalf("Expected 5 sources sorted by name, got %+v", sources)
+	}
+	if got["modem.prom"].Err != nil || got["modem.prom"].Metrics != 2 {
+		t.Errorf("Expected modem.prom ok with 2 metrics, got %+v", got["modem.prom"])
+	}
+	if err := got["broken.prom"].Err; err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("Expected the parse error of broken.prom, got %v", err)
+	}
+	if err := got["old.prom"].Err; err == nil || !strings.Contains(err.Error(), "stale") {
+		t.Errorf("Expected old.prom reported stale, got %v", err)
+	}
+	if got["partial.prom"].Err != nil || got["partial.prom"].Metrics != 0 {
+		t.Errorf("Expected the half-written file skipped without an error, got %+v", got["partial.prom"])
+	}
+
+	// A file being rewritten keeps its last outcome
+	write("modem.prom", "modem_signal_rssi_dbm -7", 0)
+	if _, err := c.Collect(context.Background()); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	for _, s := range c.Sources() {
+		if s.Name == "modem.prom" && s.Metrics != 2 {
+			t.Errorf("Expected modem.prom to keep its last outcome while incomplete, got %+v", s)
+		}
+	}
+
+	// Only failing files fail the collection
+	for _, name := range []string{"modem.prom", "hdmi.prom", "partial.prom"} {
+		os.Remove(filepath.Join(dir, name))
+	}
+	if _, err := c.Collect(context.Background()); err == nil || !strings.Contains(err.Error(), "broken.prom") {
+		t.Errorf("Expected an error naming the failed files, got %v", err)
+	}
+
+	missing := NewTextfileCollector(TextfileCollectorConfig{Directory: filepath.Join(dir, "missing")})
+	if _, err := missing.Collect(context.Background()); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+}
@@ -2,10 +2,14 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"path"
+	"regexp"
 	"strings"
 	"time"
 
+	"github.com/taniwha3/tidewatch/internal/models"
 	"gopkg.in/yaml.v3"
 )
 
@@ -17,18 +21,74 @@ type Config struct {
 	Monitoring MonitoringConfig `yaml:"monitoring"`
 	Logging    LoggingConfig    `yaml:"logging"`
 	Metrics    []MetricConfig   `yaml:"metrics"`
+	Relabel    RelabelConfig    `yaml:"relabel"`
+	Sessions   SessionsConfig   `yaml:"sessions"`
+	StatsD     StatsDConfig     `yaml:"statsd"`
+	Ingest     IngestConfig     `yaml:"ingest"`
 }
 
 // DeviceConfig contains device identification
 type DeviceConfig struct {
-	ID string `yaml:"id"`
+	ID       string            `yaml:"id"`        // Explicit device ID; takes precedence over id_source
+	IDSource string            `yaml:"id_source"` // Derive the ID from the system: machine-id, hostname, mac or serial
+	Labels   map[string]string `yaml:"labels"`    // Static labels added to every uploaded series (e.g. site, vehicle)
 }
 
 // StorageConfig contains local storage settings
 type StorageConfig struct {
-	Path                     string `yaml:"path"`
-	WALCheckpointIntervalStr string `yaml:"wal_checkpoint_interval"` // How often to checkpoint WAL (default: 1h)
-	WALCheckpointSizeMB      int    `yaml:"wal_checkpoint_size_mb"`  // Checkpoint when WAL exceeds this size (default: 64)
+	Path                     string          `yaml:"path"`
+	WALCheckpointIntervalStr string          `yaml:"wal_checkpoint_interval"` // How often to checkpoint WAL (default: 1h)
+	WALCheckpointSizeMB      int             `yaml:"wal_checkpoint_size_mb"`  // Checkpoint when WAL exceeds this size (default: 64)
+	Retention                RetentionConfig `yaml:"retention"`               // Data retention and size cap
+	Buffer                   BufferConfig    `yaml:"buffer"`                  // Write-behind buffer in front of the database
+}
+
+// BufferConfig controls the write-behind buffer that coalesces collector batches into one transaction
+// A crash loses at most one flush interval of collected metrics.
+type BufferConfig struct {
+	Enabled          *bool  `yaml:"enabled"`          // Pointer to distinguish "not set" (default: true) from "explicitly false"
+	FlushIntervalStr string `yaml:"flush_interval"`   // How often buffered metrics are written (default: 10s)
+	MaxMetrics       int    `yaml:"max_metrics"`      // Flush early once this many metrics are buffered (default: 5000)
+	MinAvailableMB   int    `yaml:"min_available_mb"` // Flush early when available system memory drops below this (default: 32)
+}
+
+// IsEnabled reports whether collector batches are buffered (default: true)
+func (b *BufferConfig) IsEnabled() bool {
+	return b.Enabled == nil || *b.Enabled
+}
+
+// FlushInterval parses the buffer flush interval
+// Returns default of 10 seconds if not configured
+// Returns error if duration string is invalid or non-positive
+func (b *BufferConfig) FlushInterval() (time.Duration, error) {
+	if b.FlushIntervalStr == "" {
+		return 10 * time.Second, nil
+	}
+	duration, err := time.ParseDuration(b.FlushIntervalStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid storage.buffer.flush_interval '%s': %w", b.FlushIntervalStr, err)
+	}
+	// Guard against non-positive intervals to prevent panic in time.NewTicker
+	if duration <= 0 {
+		return 0, fmt.Errorf("storage.buffer.flush_interval must be positive, got %v", duration)
+	}
+	return duration, nil
+}
+
+// GetMaxMetrics returns the buffered metric count that triggers an early flush
+func (b *BufferConfig) GetMaxMetrics() int {
+	if b.MaxMetrics <= 0 {
+		return 5000
+	}
+	return b.MaxMetrics
+}
+
+// MinAvailableBytes returns the available memory below which the buffer is flushed early
+func (b *BufferConfig) MinAvailableBytes() uint64 {
+	if b.MinAvailableMB <= 0 {
+		return 32 * 1024 * 1024 // Default: 32 MB
+	}
+	return uint64(b.MinAvailableMB) * 1024 * 1024
 }
 
 // WALCheckpointInterval parses the checkpoint interval string to time.Duration
@@ -58,6 +118,123 @@ func (s *StorageConfig) WALCheckpointSizeBytes() int64 {
 	return int64(s.WALCheckpointSizeMB) * 1024 * 1024
 }
 
+// RetentionConfig controls how old or excess rows are evicted from local storage
+type RetentionConfig struct {
+	Enabled           *bool        `yaml:"enabled"`          // Pointer to distinguish "not set" (default: true) from "explicitly false"
+	UploadedMaxAgeStr string       `yaml:"uploaded_max_age"` // Delete uploaded rows older than this (default: 24h)
+	PendingMaxAgeStr  string       `yaml:"pending_max_age"`  // Delete pending rows older than this (default: never)
+	MaxSizeMB         int          `yaml:"max_size_mb"`      // Evict rows while the database exceeds this size (default: 1024)
+	CheckIntervalStr  string       `yaml:"check_interval"`   // How often to apply retention (default: 10m)
+	Rollup            RollupConfig `yaml:"rollup"`           // Compact old pending rows into aggregates
+}
+
+// RollupConfig controls compaction of old pending rows into min/max/avg/count aggregates
+type RollupConfig struct {
+	Enabled       bool   `yaml:"enabled"`    // Raw points are replaced, so rollups are opt-in (default: false)
+	AfterStr      string `yaml:"after"`      // Compact pending raw rows older than this (default: 6h)
+	ResolutionStr string `yaml:"resolution"` // Aggregate bucket width (default: 5m)
+}
+
+// After parses the age at which pending raw rows are rolled up
+// Returns default of 6 hours if not configured
+// Returns error if duration string is invalid or non-positive
+func (r *RollupConfig) After() (time.Duration, error) {
+	if r.AfterStr == "" {
+		return 6 * time.Hour, nil
+	}
+	duration, err := time.ParseDuration(r.AfterStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid retention.rollup.after '%s': %w", r.AfterStr, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("retention.rollup.after must be positive, got %v", duration)
+	}
+	return duration, nil
+}
+
+// Resolution parses the rollup bucket width
+// Returns default of 5 minutes if not configured
+// Returns error if duration string is invalid or shorter than a second
+func (r *RollupConfig) Resolution() (time.Duration, error) {
+	if r.ResolutionStr == "" {
+		return 5 * time.Minute, nil
+	}
+	duration, err := time.ParseDuration(r.ResolutionStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid retention.rollup.resolution '%s': %w", r.ResolutionStr, err)
+	}
+	if duration < time.Second {
+		return 0, fmt.Errorf("retention.rollup.resolution must be at least 1s, got %v", duration)
+	}
+	return duration, nil
+}
+
+// IsEnabled reports whether the retention loop should run (default: true)
+func (r *RetentionConfig) IsEnabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+// UploadedMaxAge parses the uploaded row max age
+// Returns default of 24 hours if not configured
+// Returns error if duration string is invalid or non-positive
+func (r *RetentionConfig) UploadedMaxAge() (time.Duration, error) {
+	if r.UploadedMaxAgeStr == "" {
+		return 24 * time.Hour, nil
+	}
+	duration, err := time.ParseDuration(r.UploadedMaxAgeStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid retention.uploaded_max_age '%s': %w", r.UploadedMaxAgeStr, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("retention.uploaded_max_age must be positive, got %v", duration)
+	}
+	return duration, nil
+}
+
+// PendingMaxAge parses the pending row max age
+// Returns 0 (no age-based eviction of pending rows) if not configured
+// Returns error if duration string is invalid or non-positive
+func (r *RetentionConfig) PendingMaxAge() (time.Duration, error) {
+	if r.PendingMaxAgeStr == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(r.PendingMaxAgeStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid retention.pending_max_age '%s': %w", r.PendingMaxAgeStr, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("retention.pending_max_age must be positive, got %v", duration)
+	}
+	return duration, nil
+}
+
+// MaxSizeBytes returns the database size cap in bytes
+// Returns default of 1024 MB if not configured
+func (r *RetentionConfig) MaxSizeBytes() int64 {
+	if r.MaxSizeMB <= 0 {
+		return 1024 * 1024 * 1024 // Default: 1 GB
+	}
+	return int64(r.MaxSizeMB) * 1024 * 1024
+}
+
+// CheckInterval parses the retention check interval
+// Returns default of 10 minutes if not configured
+// Returns error if duration string is invalid or non-positive
+func (r *RetentionConfig) CheckInterval() (time.Duration, error) {
+	if r.CheckIntervalStr == "" {
+		return 10 * time.Minute, nil
+	}
+	duration, err := time.ParseDuration(r.CheckIntervalStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid retention.check_interval '%s': %w", r.CheckIntervalStr, err)
+	}
+	// Guard against non-positive intervals to prevent panic in time.NewTicker
+	if duration <= 0 {
+		return 0, fmt.Errorf("retention.check_interval must be positive, got %v", duration)
+	}
+	return duration, nil
+}
+
 // RetryConfig contains retry settings for uploads
 type RetryConfig struct {
 	Enabled           *bool   `yaml:"enabled"` // Pointer to distinguish "not set" from "explicitly false"
@@ -68,6 +245,51 @@ type RetryConfig struct {
 	JitterPercent     *int    `yaml:"jitter_percent"` // Pointer to distinguish "not set" from "explicitly 0"
 }
 
+// IsConfigured reports whether any retry field is set
+// An unconfigured retry block leaves the uploader defaults in place
+func (r *RetryConfig) IsConfigured() bool {
+	return r.Enabled != nil ||
+		r.MaxAttempts > 0 ||
+		r.InitialBackoffStr != "" ||
+		r.MaxBackoffStr != "" ||
+		r.BackoffMultiplier > 0 ||
+		r.JitterPercent != nil
+}
+
+// Validate checks retry timing values, backoff multiplier and jitter range
+func (r *RetryConfig) Validate() error {
+	// Validate retry timing values if configured
+	if r.InitialBackoffStr != "" {
+		if _, err := r.InitialBackoff(); err != nil {
+			return err
+		}
+	}
+	if r.MaxBackoffStr != "" {
+		if _, err := r.MaxBackoff(); err != nil {
+			return err
+		}
+	}
+
+	// Validate backoff_multiplier if configured
+	// Guard against ≤0 or <1 values: math.Pow yields zero/negative delays causing immediate retry hammering
+	if r.BackoffMultiplier != 0 {
+		if r.BackoffMultiplier < 1.0 {
+			return fmt.Errorf("retry.backoff_multiplier must be >= 1.0, got %v", r.BackoffMultiplier)
+		}
+	}
+
+	// Validate jitter_percent if configured
+	// Guard against out-of-range values: negative or >100 can drive backoff below zero or explode it
+	if r.JitterPercent != nil {
+		jitter := *r.JitterPercent
+		if jitter < 0 || jitter > 100 {
+			return fmt.Errorf("retry.jitter_percent must be between 0 and 100, got %d", jitter)
+		}
+	}
+
+	return nil
+}
+
 // InitialBackoff parses the initial backoff string to time.Duration
 // Returns default of 1s if not configured
 // Returns error if duration string is invalid or non-positive
@@ -107,13 +329,81 @@ func (r *RetryConfig) MaxBackoff() (time.Duration, error) {
 // RemoteConfig contains remote endpoint settings
 type RemoteConfig struct {
 	URL               string      `yaml:"url"`
+	Protocol          string      `yaml:"protocol"` // victoriametrics (default) or prometheus_remote_write
 	Enabled           bool        `yaml:"enabled"`
 	UploadIntervalStr string      `yaml:"upload_interval"`
 	AuthToken         string      `yaml:"auth_token"`      // Bearer token for authentication (inline)
 	AuthTokenFile     string      `yaml:"auth_token_file"` // Path to file containing bearer token
 	BatchSize         int         `yaml:"batch_size"`      // Max metrics per batch query (default: 2500)
 	ChunkSize         int         `yaml:"chunk_size"`      // Metrics per chunk upload (default: 50)
+	Concurrency       int         `yaml:"concurrency"`     // Chunks uploaded in parallel (default: 1)
 	Retry             RetryConfig `yaml:"retry"`           // Retry configuration
+	ProbeURL          string      `yaml:"probe_url"`       // Probed before uploads resume after an outage (default: monitoring.clock_skew_url)
+
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"` // Pause uploads while the remote is down
+	Bandwidth      BandwidthConfig      `yaml:"bandwidth"`       // Budgets and interface policies for metered links
+
+	// Destinations fans uploads out to several endpoints, each with its own backlog
+	// Mutually exclusive with url; remote.url is equivalent to a single destination named "default"
+	Destinations []DestinationConfig `yaml:"destinations"`
+}
+
+// DefaultDestinationName is the destination name used for a single remote.url
+const DefaultDestinationName = "default"
+
+// destinationNamePattern restricts names to characters safe for health component and log keys
+var destinationNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// DestinationConfig configures one upload destination
+// Unset chunk_size, concurrency and retry fall back to the remote-level settings
+type DestinationConfig struct {
+	Name          string      `yaml:"name"`
+	URL           string      `yaml:"url"`
+	Protocol      string      `yaml:"protocol"`        // victoriametrics (default) or prometheus_remote_write
+	AuthToken     string      `yaml:"auth_token"`      // Bearer token for authentication (inline)
+	AuthTokenFile string      `yaml:"auth_token_file"` // Path to file containing bearer token
+	ChunkSize     int         `yaml:"chunk_size"`      // Metrics per chunk upload (default: remote.chunk_size)
+	Concurrency   int         `yaml:"concurrency"`     // Chunks uploaded in parallel (default: remote.concurrency)
+	Retry         RetryConfig `yaml:"retry"`           // Retry configuration (default: remote.retry)
+	ProbeURL      string      `yaml:"probe_url"`       // Probed before uploads resume after an outage (optional)
+}
+
+// GetDestinations returns the effective upload destinations with defaults applied
+// A single remote.url is returned as the "default" destination
+func (r *RemoteConfig) GetDestinations() []DestinationConfig {
+	if len(r.Destinations) == 0 {
+		if r.URL == "" {
+			return nil
+		}
+		return []DestinationConfig{{
+			Name:        DefaultDestinationName,
+			URL:         r.URL,
+			Protocol:    r.GetProtocol(),
+			AuthToken:   r.AuthToken,
+			ChunkSize:   r.GetChunkSize(),
+			Concurrency: r.GetConcurrency(),
+			Retry:       r.Retry,
+			ProbeURL:    r.ProbeURL,
+		}}
+	}
+
+	dests := make([]DestinationConfig, len(r.Destinations))
+	for i, d := range r.Destinations {
+		if d.Protocol == "" {
+			d.Protocol = "victoriametrics"
+		}
+		if d.ChunkSize <= 0 {
+			d.ChunkSize = r.GetChunkSize()
+		}
+		if d.Concurrency <= 0 {
+			d.Concurrency = r.GetConcurrency()
+		}
+		if !d.Retry.IsConfigured() {
+			d.Retry = r.Retry
+		}
+		dests[i] = d
+	}
+	return dests
 }
 
 // GetBatchSize returns the batch size or default
@@ -124,6 +414,14 @@ func (r *RemoteConfig) GetBatchSize() int {
 	return r.BatchSize
 }
 
+// GetProtocol returns the upload protocol or default
+func (r *RemoteConfig) GetProtocol() string {
+	if r.Protocol == "" {
+		return "victoriametrics" // Default
+	}
+	return r.Protocol
+}
+
 // GetChunkSize returns the chunk size or default
 func (r *RemoteConfig) GetChunkSize() int {
 	if r.ChunkSize <= 0 {
@@ -132,12 +430,231 @@ func (r *RemoteConfig) GetChunkSize() int {
 	return r.ChunkSize
 }
 
+// GetConcurrency returns the number of chunks uploaded in parallel or default
+func (r *RemoteConfig) GetConcurrency() int {
+	if r.Concurrency <= 0 {
+		return 1 // Default: sequential
+	}
+	return r.Concurrency
+}
+
+// CircuitBreakerConfig controls pausing uploads while a destination is unreachable
+// After failure_threshold failed upload cycles in a row the breaker opens and cycles are skipped
+// without touching the database. After open_timeout one probe cycle is let through (half-open);
+// each failed probe doubles the wait up to max_open_timeout.
+type CircuitBreakerConfig struct {
+	Enabled           *bool  `yaml:"enabled"`           // Pointer to distinguish "not set" (default: true) from "explicitly false"
+	FailureThreshold  int    `yaml:"failure_threshold"` // Failed cycles in a row that open the breaker (default: 3)
+	OpenTimeoutStr    string `yaml:"open_timeout"`      // Wait before the first probe (default: 1m)
+	MaxOpenTimeoutStr string `yaml:"max_open_timeout"`  // Longest wait between probes (default: 10m)
+}
+
+// IsEnabled reports whether uploads are guarded by a circuit breaker (default: true)
+func (b *CircuitBreakerConfig) IsEnabled() bool {
+	return b.Enabled == nil || *b.Enabled
+}
+
+// GetFailureThreshold returns the failure threshold or default
+func (b *CircuitBreakerConfig) GetFailureThreshold() int {
+	if b.FailureThreshold <= 0 {
+		return 3 // Default
+	}
+	return b.FailureThreshold
+}
+
+// OpenTimeout parses the wait before the first probe
+// Returns default of 1 minute if not configured
+// Returns error if duration string is invalid or non-positive
+func (b *CircuitBreakerConfig) OpenTimeout() (time.Duration, error) {
+	if b.OpenTimeoutStr == "" {
+		return time.Minute, nil
+	}
+	duration, err := time.ParseDuration(b.OpenTimeoutStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid remote.circuit_breaker.open_timeout '%s': %w", b.OpenTimeoutStr, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("remote.circuit_breaker.open_timeout must be positive, got %v", duration)
+	}
+	return duration, nil
+}
+
+// MaxOpenTimeout parses the longest wait between probes
+// Returns default of 10 minutes if not configured
+// Returns error if duration string is invalid or non-positive
+func (b *CircuitBreakerConfig) MaxOpenTimeout() (time.Duration, error) {
+	if b.MaxOpenTimeoutStr == "" {
+		return 10 * time.Minute, nil
+	}
+	duration, err := time.ParseDuration(b.MaxOpenTimeoutStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid remote.circuit_breaker.max_open_timeout '%s': %w", b.MaxOpenTimeoutStr, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("remote.circuit_breaker.max_open_timeout must be positive, got %v", duration)
+	}
+	return duration, nil
+}
+
+// validate checks the breaker timing values and that the waits are ordered
+func (b *CircuitBreakerConfig) validate() error {
+	openTimeout, err := b.OpenTimeout()
+	if err != nil {
+		return err
+	}
+	maxOpenTimeout, err := b.MaxOpenTimeout()
+	if err != nil {
+		return err
+	}
+	if maxOpenTimeout < openTimeout {
+		return fmt.Errorf("remote.circuit_breaker.max_open_timeout (%v) must not be shorter than open_timeout (%v)", maxOpenTimeout, openTimeout)
+	}
+	return nil
+}
+
+// BandwidthConfig limits how much uploads send over metered links
+// Budgets and the rate limit apply to every interface that is not unmetered; interfaces matching
+// no rule are metered. Uploads pause, rather than fail, once a budget is used up.
+type BandwidthConfig struct {
+	DailyBudgetMB        int                     `yaml:"daily_budget_mb"`          // Per local day (default: 0 = unlimited)
+	MonthlyBudgetMB      int                     `yaml:"monthly_budget_mb"`        // Per calendar month (default: 0 = unlimited)
+	RateLimitBytesPerSec int                     `yaml:"rate_limit_bytes_per_sec"` // Upload rate cap (default: 0 = unlimited)
+	Interfaces           []InterfacePolicyConfig `yaml:"interfaces"`               // Policy per interface, first match wins
+}
+
+// InterfacePolicyConfig sets the upload policy of matching network interfaces
+type InterfacePolicyConfig struct {
+	Match       string `yaml:"match"`        // Interface name glob (e.g., "wwan*")
+	Policy      string `yaml:"policy"`       // unmetered, metered (default) or priority
+	MinPriority string `yaml:"min_priority"` // priority policy: lowest class uploaded (default: P1)
+}
+
+// DailyBudgetBytes returns the daily budget in bytes (0 = unlimited)
+func (b *BandwidthConfig) DailyBudgetBytes() int64 {
+	return int64(b.DailyBudgetMB) * 1024 * 1024
+}
+
+// MonthlyBudgetBytes returns the monthly budget in bytes (0 = unlimited)
+func (b *BandwidthConfig) MonthlyBudgetBytes() int64 {
+	return int64(b.MonthlyBudgetMB) * 1024 * 1024
+}
+
+// GetMinPriority parses the lowest class uploaded under the priority policy (default: P1)
+func (i *InterfacePolicyConfig) GetMinPriority() (models.Priority, error) {
+	if i.MinPriority == "" {
+		return models.PriorityP1, nil
+	}
+	p, err := models.ParsePriority(i.MinPriority)
+	if err != nil {
+		return models.PriorityDefault, fmt.Errorf("remote.bandwidth.interfaces %s: min_priority: %w", i.Match, err)
+	}
+	return p, nil
+}
+
+// validate checks budgets, the rate limit and interface rules
+func (b *BandwidthConfig) validate() error {
+	if b.DailyBudgetMB < 0 {
+		return fmt.Errorf("remote.bandwidth.daily_budget_mb must not be negative, got %d", b.DailyBudgetMB)
+	}
+	if b.MonthlyBudgetMB < 0 {
+		return fmt.Errorf("remote.bandwidth.monthly_budget_mb must not be negative, got %d", b.MonthlyBudgetMB)
+	}
+	if b.RateLimitBytesPerSec < 0 {
+		return fmt.Errorf("remote.bandwidth.rate_limit_bytes_per_sec must not be negative, got %d", b.RateLimitBytesPerSec)
+	}
+	for i, rule := range b.Interfaces {
+		if rule.Match == "" {
+			return fmt.Errorf("remote.bandwidth.interfaces[%d]: match is required", i)
+		}
+		if _, err := path.Match(rule.Match, ""); err != nil {
+			return fmt.Errorf("remote.bandwidth.interfaces[%d]: invalid match %q: %w", i, rule.Match, err)
+		}
+		switch rule.Policy {
+		case "", "unmetered", "metered":
+			if rule.MinPriority != "" {
+				return fmt.Errorf("remote.bandwidth.interfaces %s: min_priority requires policy priority", rule.Match)
+			}
+		case "priority":
+			if _, err := rule.GetMinPriority(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("remote.bandwidth.interfaces %s: policy must be unmetered, metered or priority, got %q", rule.Match, rule.Policy)
+		}
+	}
+	return nil
+}
+
 // MonitoringConfig contains monitoring and health check settings
 type MonitoringConfig struct {
 	ClockSkewURL             string `yaml:"clock_skew_url"`               // URL for clock skew detection (e.g., http://localhost:8428/health)
 	ClockSkewCheckInterval   string `yaml:"clock_skew_check_interval"`    // How often to check clock skew (default: 5m)
 	ClockSkewWarnThresholdMs int    `yaml:"clock_skew_warn_threshold_ms"` // Warn when skew exceeds this (default: 2000ms)
 	HealthAddress            string `yaml:"health_address"`               // Address for health endpoint server (e.g., ":9100")
+	MetricsEndpoint          *bool  `yaml:"metrics_endpoint"`             // Serve OpenMetrics on /metrics (default: true)
+
+	TimeSync TimeSyncConfig `yaml:"time_sync"` // Timestamp correction for devices without an RTC
+}
+
+// TimeSyncConfig controls holding metrics while the wall clock is unsynchronized
+// Rows stored before the clock is synchronized (e.g., an RTC-less board before NTP) are held back
+// from upload and their timestamps rewritten from the time since boot once it syncs.
+type TimeSyncConfig struct {
+	Enabled          *bool  `yaml:"enabled"`        // Pointer to distinguish "not set" (default: true) from "explicitly false"
+	CheckIntervalStr string `yaml:"check_interval"` // How often to check the clock sync status (default: 10s)
+	MaxWaitStr       string `yaml:"max_wait"`       // Release held rows with their original timestamps after this (default: 1h)
+}
+
+// IsEnabled reports whether unsynchronized timestamps are held and corrected (default: true)
+func (t *TimeSyncConfig) IsEnabled() bool {
+	return t.Enabled == nil || *t.Enabled
+}
+
+// CheckInterval parses the clock sync check interval
+// Returns default of 10 seconds if not configured
+// Returns error if duration string is invalid or non-positive
+func (t *TimeSyncConfig) CheckInterval() (time.Duration, error) {
+	if t.CheckIntervalStr == "" {
+		return 10 * time.Second, nil
+	}
+	duration, err := time.ParseDuration(t.CheckIntervalStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid monitoring.time_sync.check_interval '%s': %w", t.CheckIntervalStr, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("monitoring.time_sync.check_interval must be positive, got %v", duration)
+	}
+	return duration, nil
+}
+
+// MaxWait parses how long to wait for clock sync before giving up on correction
+// Returns default of 1 hour if not configured
+// Returns error if duration string is invalid or non-positive
+func (t *TimeSyncConfig) MaxWait() (time.Duration, error) {
+	if t.MaxWaitStr == "" {
+		return time.Hour, nil
+	}
+	duration, err := time.ParseDuration(t.MaxWaitStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid monitoring.time_sync.max_wait '%s': %w", t.MaxWaitStr, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("monitoring.time_sync.max_wait must be positive, got %v", duration)
+	}
+	return duration, nil
+}
+
+// IsMetricsEndpointEnabled returns whether /metrics is served on the health server (default: true)
+func (m *MonitoringConfig) IsMetricsEndpointEnabled() bool {
+	return m.MetricsEndpoint == nil || *m.MetricsEndpoint
+}
+
+// GetHealthAddress returns the health server address (default: ":9100")
+func (m *MonitoringConfig) GetHealthAddress() string {
+	if m.HealthAddress == "" {
+		return ":9100"
+	}
+	return m.HealthAddress
 }
 
 // LoggingConfig contains logging settings
@@ -169,6 +686,269 @@ type MetricConfig struct {
 	Name     string `yaml:"name"`
 	Interval string `yaml:"interval"`
 	Enabled  bool   `yaml:"enabled"`
+	Priority string `yaml:"priority"` // Upload priority class P0 (first) to P3 (last); default P2
+
+	// Options are passed to the collector; each collector validates its own option names and types
+	Options map[string]interface{} `yaml:"options"`
+}
+
+// RelabelConfig controls the relabel stage between collectors and storage
+// Rules are validated by the relabel package when the config is loaded
+type RelabelConfig struct {
+	Rules              []RelabelRuleConfig `yaml:"rules"`                 // Applied in order to every collected metric
+	MaxSeriesPerMetric int                 `yaml:"max_series_per_metric"` // Distinct series kept per metric name (default: 0 = unlimited)
+}
+
+// RelabelRuleConfig is a Prometheus-style relabel rule
+type RelabelRuleConfig struct {
+	Action       string   `yaml:"action"`        // replace (default), keep, drop, hashmod, labelmap, labeldrop, labelkeep
+	SourceLabels []string `yaml:"source_labels"` // Labels joined with separator; __name__ is the metric name
+	Separator    string   `yaml:"separator"`     // Default: ";"
+	Regex        string   `yaml:"regex"`         // Fully anchored (default: (.*))
+	TargetLabel  string   `yaml:"target_label"`  // Label written by replace and hashmod
+	Replacement  *string  `yaml:"replacement"`   // Pointer to distinguish "not set" (default: $1) from an empty replacement
+	Modulus      uint64   `yaml:"modulus"`       // Number of hashmod shards
+}
+
+// SessionsConfig controls streaming-session tracking
+// A session is open while any trigger is active; metrics collected during it are stamped with its ID.
+type SessionsConfig struct {
+	Enabled           bool                   `yaml:"enabled"`
+	CheckIntervalStr  string                 `yaml:"check_interval"`     // How often triggers are evaluated (default: 5s)
+	CloseAfterStr     string                 `yaml:"close_after"`        // Close once no trigger has been active for this long (default: 30s)
+	PrioritizeUploads *bool                  `yaml:"prioritize_uploads"` // Upload the session's data before the backlog (default: true)
+	Triggers          []SessionTriggerConfig `yaml:"triggers"`
+}
+
+// SessionTriggerConfig opens a session while it is active; set exactly one of process, unit or metric
+type SessionTriggerConfig struct {
+	Process string   `yaml:"process"` // Process name (as in /proc/<pid>/comm)
+	Unit    string   `yaml:"unit"`    // systemd unit (e.g., srt-stream.service)
+	Metric  string   `yaml:"metric"`  // Collected metric name, with above and/or below
+	Above   *float64 `yaml:"above"`   // Metric trigger: active while any series is above this
+	Below   *float64 `yaml:"below"`   // Metric trigger: active while any series is below this
+}
+
+// ShouldPrioritizeUploads reports whether session data is uploaded first (default: true)
+func (s *SessionsConfig) ShouldPrioritizeUploads() bool {
+	return s.PrioritizeUploads == nil || *s.PrioritizeUploads
+}
+
+// CheckInterval parses the trigger check interval
+// Returns default of 5 seconds if not configured
+// Returns error if duration string is invalid or non-positive
+func (s *SessionsConfig) CheckInterval() (time.Duration, error) {
+	if s.CheckIntervalStr == "" {
+		return 5 * time.Second, nil
+	}
+	duration, err := time.ParseDuration(s.CheckIntervalStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid sessions.check_interval '%s': %w", s.CheckIntervalStr, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("sessions.check_interval must be positive, got %v", duration)
+	}
+	return duration, nil
+}
+
+// CloseAfter parses how long every trigger must be inactive before a session closes
+// Returns default of 30 seconds if not configured
+// Returns error if duration string is invalid or non-positive
+func (s *SessionsConfig) CloseAfter() (time.Duration, error) {
+	if s.CloseAfterStr == "" {
+		return 30 * time.Second, nil
+	}
+	duration, err := time.ParseDuration(s.CloseAfterStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid sessions.close_after '%s': %w", s.CloseAfterStr, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("sessions.close_after must be positive, got %v", duration)
+	}
+	return duration, nil
+}
+
+// validate checks timing values and triggers
+func (s *SessionsConfig) validate() error {
+	if _, err := s.CheckInterval(); err != nil {
+		return err
+	}
+	if _, err := s.CloseAfter(); err != nil {
+		return err
+	}
+	if s.Enabled && len(s.Triggers) == 0 {
+		return fmt.Errorf("sessions.triggers is required when sessions are enabled")
+	}
+	for i, t := range s.Triggers {
+		targets := 0
+		for _, target := range []string{t.Process, t.Unit, t.Metric} {
+			if target != "" {
+				targets++
+			}
+		}
+		if targets != 1 {
+			return fmt.Errorf("sessions.triggers[%d]: set exactly one of process, unit or metric", i)
+		}
+		if t.Metric == "" {
+			if t.Above != nil || t.Below != nil {
+				return fmt.Errorf("sessions.triggers[%d]: above and below only apply to metric triggers", i)
+			}
+			continue
+		}
+		if t.Above == nil && t.Below == nil {
+			return fmt.Errorf("sessions.triggers[%d]: metric %s needs above or below", i, t.Metric)
+		}
+		if t.Above != nil && t.Below != nil && *t.Above >= *t.Below {
+			return fmt.Errorf("sessions.triggers[%d]: above (%v) must be less than below (%v)", i, *t.Above, *t.Below)
+		}
+	}
+	return nil
+}
+
+// StatsDConfig controls the StatsD listener for metrics pushed by local applications over UDP
+type StatsDConfig struct {
+	Enabled          bool   `yaml:"enabled"`
+	Address          string `yaml:"address"`        // UDP address to listen on (default: 127.0.0.1:8125)
+	FlushIntervalStr string `yaml:"flush_interval"` // How often aggregates are written to storage (default: 10s)
+	MaxSeries        int    `yaml:"max_series"`     // Series held between flushes; new series beyond it are dropped (default: 10000)
+	IdleTimeoutStr   string `yaml:"idle_timeout"`   // Stop reporting counters and gauges idle this long (default: 1h)
+}
+
+// GetAddress returns the listen address (default: 127.0.0.1:8125)
+func (s *StatsDConfig) GetAddress() string {
+	if s.Address == "" {
+		return "127.0.0.1:8125"
+	}
+	return s.Address
+}
+
+// GetMaxSeries returns the series limit (default: 10000)
+func (s *StatsDConfig) GetMaxSeries() int {
+	if s.MaxSeries <= 0 {
+		return 10000
+	}
+	return s.MaxSeries
+}
+
+// FlushInterval parses the flush interval
+// Returns default of 10 seconds if not configured
+// Returns error if duration string is invalid or non-positive
+func (s *StatsDConfig) FlushInterval() (time.Duration, error) {
+	if s.FlushIntervalStr == "" {
+		return 10 * time.Second, nil
+	}
+	duration, err := time.ParseDuration(s.FlushIntervalStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid statsd.flush_interval '%s': %w", s.FlushIntervalStr, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("statsd.flush_interval must be positive, got %v", duration)
+	}
+	return duration, nil
+}
+
+// IdleTimeout parses how long counters and gauges are reported after their last sample
+// Returns default of 1 hour if not configured
+// Returns error if duration string is invalid or non-positive
+func (s *StatsDConfig) IdleTimeout() (time.Duration, error) {
+	if s.IdleTimeoutStr == "" {
+		return time.Hour, nil
+	}
+	duration, err := time.ParseDuration(s.IdleTimeoutStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid statsd.idle_timeout '%s': %w", s.IdleTimeoutStr, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("statsd.idle_timeout must be positive, got %v", duration)
+	}
+	return duration, nil
+}
+
+// validate checks the address, limits and timing values
+func (s *StatsDConfig) validate() error {
+	if _, _, err := net.SplitHostPort(s.GetAddress()); err != nil {
+		return fmt.Errorf("invalid statsd.address '%s': %w", s.Address, err)
+	}
+	if s.MaxSeries < 0 {
+		return fmt.Errorf("statsd.max_series must not be negative, got %d", s.MaxSeries)
+	}
+	if _, err := s.FlushInterval(); err != nil {
+		return err
+	}
+	if _, err := s.IdleTimeout(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// IngestConfig controls the push API for metrics from other processes on the device
+type IngestConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	HTTP          *bool  `yaml:"http"`            // Serve on the health server (default: true)
+	AuthToken     string `yaml:"auth_token"`      // Bearer token required on the health server
+	AuthTokenFile string `yaml:"auth_token_file"` // Path to file containing bearer token
+	Socket        string `yaml:"socket"`          // Also serve on this unix socket, without a token
+	MaxMetrics    int    `yaml:"max_metrics"`     // Metrics accepted per request (default: 10000)
+	Priority      string `yaml:"priority"`        // Upload class of pushed metrics (default: P2)
+}
+
+// ServesHTTP reports whether the push API is served on the health server (default: true)
+func (i *IngestConfig) ServesHTTP() bool {
+	return i.HTTP == nil || *i.HTTP
+}
+
+// GetMaxMetrics returns the metrics accepted per request (default: 10000)
+func (i *IngestConfig) GetMaxMetrics() int {
+	if i.MaxMetrics <= 0 {
+		return 10000
+	}
+	return i.MaxMetrics
+}
+
+// GetPriority parses the upload priority class of pushed metrics (empty = default, stored as P2)
+func (i *IngestConfig) GetPriority() (models.Priority, error) {
+	if i.Priority == "" {
+		return models.PriorityDefault, nil
+	}
+	p, err := models.ParsePriority(i.Priority)
+	if err != nil {
+		return models.PriorityDefault, fmt.Errorf("ingest.priority: %w", err)
+	}
+	return p, nil
+}
+
+// validate checks the listeners and priority
+// Without a token the health server must only be reachable from the device itself.
+func (i *IngestConfig) validate(healthAddress string) error {
+	if _, err := i.GetPriority(); err != nil {
+		return err
+	}
+	if i.MaxMetrics < 0 {
+		return fmt.Errorf("ingest.max_metrics must not be negative, got %d", i.MaxMetrics)
+	}
+	if !i.Enabled {
+		return nil
+	}
+	if !i.ServesHTTP() && i.Socket == "" {
+		return fmt.Errorf("ingest.socket is required when ingest.http is false")
+	}
+	if i.ServesHTTP() && i.AuthToken == "" && !isLoopbackAddress(healthAddress) {
+		return fmt.Errorf("ingest.auth_token is required when monitoring.health_address (%q) is not a loopback address", healthAddress)
+	}
+	return nil
+}
+
+// isLoopbackAddress reports whether a listen address only accepts local connections
+func isLoopbackAddress(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
 }
 
 // IntervalDuration parses the interval string to time.Duration
@@ -176,6 +956,18 @@ func (m *MetricConfig) IntervalDuration() (time.Duration, error) {
 	return time.ParseDuration(m.Interval)
 }
 
+// GetPriority parses the upload priority class (empty = default, stored as P2)
+func (m *MetricConfig) GetPriority() (models.Priority, error) {
+	if m.Priority == "" {
+		return models.PriorityDefault, nil
+	}
+	p, err := models.ParsePriority(m.Priority)
+	if err != nil {
+		return models.PriorityDefault, fmt.Errorf("metric %s: %w", m.Name, err)
+	}
+	return p, nil
+}
+
 // Load reads and parses a YAML configuration file
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
@@ -202,6 +994,32 @@ func Load(path string) (*Config, error) {
 		cfg.Remote.AuthToken = token
 	}
 
+	// Same rules for each destination
+	for i := range cfg.Remote.Destinations {
+		d := &cfg.Remote.Destinations[i]
+		if d.AuthToken != "" && d.AuthTokenFile != "" {
+			return nil, fmt.Errorf("destination %s: cannot specify both auth_token and auth_token_file", d.Name)
+		}
+		if d.AuthTokenFile != "" {
+			token, err := loadAuthTokenFromFile(d.AuthTokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("destination %s: failed to load auth token from file: %w", d.Name, err)
+			}
+			d.AuthToken = token
+		}
+	}
+
+	if cfg.Ingest.AuthToken != "" && cfg.Ingest.AuthTokenFile != "" {
+		return nil, fmt.Errorf("cannot specify both ingest.auth_token and ingest.auth_token_file")
+	}
+	if cfg.Ingest.AuthTokenFile != "" {
+		token, err := loadAuthTokenFromFile(cfg.Ingest.AuthTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("ingest: failed to load auth token from file: %w", err)
+		}
+		cfg.Ingest.AuthToken = token
+	}
+
 	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
@@ -227,14 +1045,23 @@ func loadAuthTokenFromFile(path string) (string, error) {
 
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
-	if c.Device.ID == "" {
-		return fmt.Errorf("device.id is required")
+	if err := c.Device.validate(); err != nil {
+		return err
 	}
 	if c.Storage.Path == "" {
 		return fmt.Errorf("storage.path is required")
 	}
-	if c.Remote.Enabled && c.Remote.URL == "" {
-		return fmt.Errorf("remote.url is required when remote is enabled")
+	if c.Remote.Enabled && c.Remote.URL == "" && len(c.Remote.Destinations) == 0 {
+		return fmt.Errorf("remote.url or remote.destinations is required when remote is enabled")
+	}
+	if c.Remote.URL != "" && len(c.Remote.Destinations) > 0 {
+		return fmt.Errorf("remote.url and remote.destinations are mutually exclusive")
+	}
+	if err := validateProtocol("remote.protocol", c.Remote.Protocol); err != nil {
+		return err
+	}
+	if err := c.Remote.validateDestinations(); err != nil {
+		return err
 	}
 
 	// Validate storage timing values
@@ -242,39 +1069,64 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	if _, err := c.Storage.Buffer.FlushInterval(); err != nil {
+		return err
+	}
+
+	// Validate retention timing values (always, so a disabled block is still well-formed)
+	if _, err := c.Storage.Retention.UploadedMaxAge(); err != nil {
+		return err
+	}
+	if _, err := c.Storage.Retention.PendingMaxAge(); err != nil {
+		return err
+	}
+	if _, err := c.Storage.Retention.CheckInterval(); err != nil {
+		return err
+	}
+	if _, err := c.Storage.Retention.Rollup.After(); err != nil {
+		return err
+	}
+	if _, err := c.Storage.Retention.Rollup.Resolution(); err != nil {
+		return err
+	}
+
+	// Validate clock sync timing values
+	if _, err := c.Monitoring.TimeSync.CheckInterval(); err != nil {
+		return err
+	}
+	if _, err := c.Monitoring.TimeSync.MaxWait(); err != nil {
+		return err
+	}
+
+	if err := c.Sessions.validate(); err != nil {
+		return err
+	}
+
+	if err := c.StatsD.validate(); err != nil {
+		return err
+	}
+
+	if err := c.Ingest.validate(c.Monitoring.GetHealthAddress()); err != nil {
+		return err
+	}
+
 	// Validate remote timing values (always validate, even if remote is disabled)
 	// This prevents runtime crashes when code calls these methods before checking enabled flag
 	if _, err := c.Remote.UploadInterval(); err != nil {
 		return err
 	}
 
-	// Validate retry timing values if configured
-	if c.Remote.Retry.InitialBackoffStr != "" {
-		if _, err := c.Remote.Retry.InitialBackoff(); err != nil {
-			return err
-		}
-	}
-	if c.Remote.Retry.MaxBackoffStr != "" {
-		if _, err := c.Remote.Retry.MaxBackoff(); err != nil {
-			return err
-		}
+	// Validate retry settings
+	if err := c.Remote.Retry.Validate(); err != nil {
+		return err
 	}
 
-	// Validate backoff_multiplier if configured
-	// Guard against ≤0 or <1 values: math.Pow yields zero/negative delays causing immediate retry hammering
-	if c.Remote.Retry.BackoffMultiplier != 0 {
-		if c.Remote.Retry.BackoffMultiplier < 1.0 {
-			return fmt.Errorf("retry.backoff_multiplier must be >= 1.0, got %v", c.Remote.Retry.BackoffMultiplier)
-		}
+	if err := c.Remote.CircuitBreaker.validate(); err != nil {
+		return err
 	}
 
-	// Validate jitter_percent if configured
-	// Guard against out-of-range values: negative or >100 can drive backoff below zero or explode it
-	if c.Remote.Retry.JitterPercent != nil {
-		jitter := *c.Remote.Retry.JitterPercent
-		if jitter < 0 || jitter > 100 {
-			return fmt.Errorf("retry.jitter_percent must be between 0 and 100, got %d", jitter)
-		}
+	if err := c.Remote.Bandwidth.validate(); err != nil {
+		return err
 	}
 
 	// Validate metric intervals
@@ -288,12 +1140,81 @@ func (c *Config) Validate() error {
 			if interval <= 0 {
 				return fmt.Errorf("metric %s: interval must be positive (got %v)", m.Name, interval)
 			}
+			if _, err := m.GetPriority(); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
+// validateProtocol checks that an upload protocol is supported (empty = default)
+// validate checks the ID source and label names
+func (d *DeviceConfig) validate() error {
+	switch d.IDSource {
+	case "":
+		if d.ID == "" {
+			return fmt.Errorf("device.id or device.id_source is required")
+		}
+	case "machine-id", "hostname", "mac", "serial":
+	default:
+		return fmt.Errorf("device.id_source must be machine-id, hostname, mac or serial, got %q", d.IDSource)
+	}
+	for name, value := range d.Labels {
+		if !labelNamePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("device.labels: invalid label name %q", name)
+		}
+		if name == "device_id" {
+			return fmt.Errorf("device.labels: device_id is reserved, use device.id")
+		}
+		if value == "" {
+			return fmt.Errorf("device.labels.%s must not be empty", name)
+		}
+	}
+	return nil
+}
+
+// labelNamePattern is the Prometheus label name syntax
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func validateProtocol(field, protocol string) error {
+	switch protocol {
+	case "", "victoriametrics", "prometheus_remote_write":
+		return nil
+	default:
+		return fmt.Errorf("%s must be victoriametrics or prometheus_remote_write, got %q", field, protocol)
+	}
+}
+
+// validateDestinations checks names, URLs, protocols and retry settings of each destination
+func (r *RemoteConfig) validateDestinations() error {
+	seen := make(map[string]bool, len(r.Destinations))
+	for i, d := range r.Destinations {
+		if d.Name == "" {
+			return fmt.Errorf("remote.destinations[%d]: name is required", i)
+		}
+		if !destinationNamePattern.MatchString(d.Name) {
+			return fmt.Errorf("remote.destinations[%d]: name %q may only contain letters, digits, '_' and '-'", i, d.Name)
+		}
+		if seen[d.Name] {
+			return fmt.Errorf("remote.destinations: duplicate name %q", d.Name)
+		}
+		seen[d.Name] = true
+
+		if d.URL == "" {
+			return fmt.Errorf("destination %s: url is required", d.Name)
+		}
+		if err := validateProtocol("destination "+d.Name+": protocol", d.Protocol); err != nil {
+			return err
+		}
+		if err := d.Retry.Validate(); err != nil {
+			return fmt.Errorf("destination %s: %w", d.Name, err)
+		}
+	}
+	return nil
+}
+
 // EnabledMetrics returns only the enabled metrics
 func (c *Config) EnabledMetrics() []MetricConfig {
 	var enabled []MetricConfig
@@ -8,6 +8,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
 )
 
 // boolPtr is a helper function to create a pointer to a bool value
@@ -106,7 +108,7 @@ func TestConfigValidation(t *testing.T) {
 				Storage: StorageConfig{Path: "/tmp/test.db"},
 			},
 			expectError: true,
-			errorMsg:    "device.id is required",
+			errorMsg:    "device.id or device.id_source is required",
 		},
 		{
 			name: "missing storage path",
@@ -346,6 +348,144 @@ func TestWALCheckpointSizeBytes(t *testing.T) {
 	}
 }
 
+// TestRetentionConfigDefaults tests the defaults applied when retention is not configured
+func TestRetentionConfigDefaults(t *testing.T) {
+	var rc RetentionConfig
+
+	if !rc.IsEnabled() {
+		t.Error("Expected retention to be enabled by default")
+	}
+
+	uploadedMaxAge, err := rc.UploadedMaxAge()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if uploadedMaxAge != 24*time.Hour {
+		t.Errorf("Expected default uploaded_max_age 24h, got %v", uploadedMaxAge)
+	}
+
+	pendingMaxAge, err := rc.PendingMaxAge()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if pendingMaxAge != 0 {
+		t.Errorf("Expected pending rows kept indefinitely by default, got %v", pendingMaxAge)
+	}
+
+	if rc.MaxSizeBytes() != 1024*1024*1024 {
+		t.Errorf("Expected default max size 1 GB, got %d", rc.MaxSizeBytes())
+	}
+
+	interval, err := rc.CheckInterval()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if interval != 10*time.Minute {
+		t.Errorf("Expected default check_interval 10m, got %v", interval)
+	}
+}
+
+// TestRetentionConfigParsing tests parsing of a fully specified retention block
+func TestRetentionConfigParsing(t *testing.T) {
+	yamlContent := `
+device:
+  id: test-device
+storage:
+  path: /tmp/test.db
+  retention:
+    enabled: false
+    uploaded_max_age: 72h
+    pending_max_age: 168h
+    max_size_mb: 256
+    check_interval: 5m
+remote:
+  url: http://localhost:8428/api/v1/import
+  enabled: true
+metrics:
+  - name: cpu.usage
+    interval: 30s
+    enabled: true
+`
+
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(yamlContent), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	rc := cfg.Storage.Retention
+	if rc.IsEnabled() {
+		t.Error("Expected retention to be disabled")
+	}
+	if d, _ := rc.UploadedMaxAge(); d != 72*time.Hour {
+		t.Errorf("Expected uploaded_max_age 72h, got %v", d)
+	}
+	if d, _ := rc.PendingMaxAge(); d != 168*time.Hour {
+		t.Errorf("Expected pending_max_age 168h, got %v", d)
+	}
+	if rc.MaxSizeBytes() != 256*1024*1024 {
+		t.Errorf("Expected max size 256 MB, got %d", rc.MaxSizeBytes())
+	}
+	if d, _ := rc.CheckInterval(); d != 5*time.Minute {
+		t.Errorf("Expected check_interval 5m, got %v", d)
+	}
+}
+
+// TestRetentionConfigInvalidDurations tests that invalid retention durations fail validation
+func TestRetentionConfigInvalidDurations(t *testing.T) {
+	tests := []struct {
+		name     string
+		field    string
+		value    string
+		errorMsg string
+	}{
+		{"invalid uploaded_max_age", "uploaded_max_age", "soon", "invalid retention.uploaded_max_age"},
+		{"zero uploaded_max_age", "uploaded_max_age", "0s", "retention.uploaded_max_age must be positive"},
+		{"negative pending_max_age", "pending_max_age", "-1h", "retention.pending_max_age must be positive"},
+		{"invalid check_interval", "check_interval", "often", "invalid retention.check_interval"},
+		{"zero check_interval", "check_interval", "0s", "retention.check_interval must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			yamlContent := fmt.Sprintf(`
+device:
+  id: test-device
+storage:
+  path: /tmp/test.db
+  retention:
+    %s: %s
+remote:
+  url: http://localhost:8428/api/v1/import
+  enabled: true
+metrics:
+  - name: cpu.usage
+    interval: 30s
+    enabled: true
+`, tt.field, tt.value)
+
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+			if err := os.WriteFile(configPath, []byte(yamlContent), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			_, err := Load(configPath)
+			if err == nil {
+				t.Fatal("Expected validation error, got none")
+			}
+			if !strings.Contains(err.Error(), tt.errorMsg) {
+				t.Errorf("Expected error containing %q, got %q", tt.errorMsg, err.Error())
+			}
+		})
+	}
+}
+
 // TestRetryConfigParsing tests parsing of retry configuration
 func TestRetryConfigParsing(t *testing.T) {
 	tests := []struct {
@@ -586,6 +726,49 @@ func TestRemoteConfigChunkSize(t *testing.T) {
 	}
 }
 
+// TestRemoteConfigProtocol tests protocol defaults and validation
+func TestRemoteConfigProtocol(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+		expected string
+		wantErr  bool
+	}{
+		{name: "default", protocol: "", expected: "victoriametrics"},
+		{name: "victoriametrics", protocol: "victoriametrics", expected: "victoriametrics"},
+		{name: "remote write", protocol: "prometheus_remote_write", expected: "prometheus_remote_write"},
+		{name: "unknown", protocol: "graphite", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Device:  DeviceConfig{ID: "test-device"},
+				Storage: StorageConfig{Path: "/tmp/test.db"},
+				Remote: RemoteConfig{
+					URL:      "http://localhost:9090/api/v1/write",
+					Enabled:  true,
+					Protocol: tt.protocol,
+				},
+			}
+
+			err := cfg.Validate()
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "remote.protocol") {
+					t.Errorf("Expected remote.protocol validation error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := cfg.Remote.GetProtocol(); got != tt.expected {
+				t.Errorf("Expected protocol %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
 // TestLoadConfigWithAllFields tests loading a complete config with all M2 fields
 func TestLoadConfigWithAllFields(t *testing.T) {
 	yamlContent := `
@@ -1511,3 +1694,927 @@ metrics:
 		})
 	}
 }
+
+// loadYAML writes yamlContent to a temp config file and loads it
+func loadYAML(t *testing.T, yamlContent string) (*Config, error) {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(yamlContent), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+	return Load(configPath)
+}
+
+func TestGetDestinationsLegacyURL(t *testing.T) {
+	jitter := 5
+	r := RemoteConfig{
+		URL:       "http://localhost:8428/api/v1/import",
+		AuthToken: "secret",
+		ChunkSize: 100,
+		Retry:     RetryConfig{MaxAttempts: 7, JitterPercent: &jitter},
+	}
+
+	dests := r.GetDestinations()
+	if len(dests) != 1 {
+		t.Fatalf("Expected 1 destination, got %d", len(dests))
+	}
+	d := dests[0]
+	if d.Name != DefaultDestinationName {
+		t.Errorf("Expected name %q, got %q", DefaultDestinationName, d.Name)
+	}
+	if d.URL != r.URL || d.AuthToken != "secret" {
+		t.Errorf("Expected url and auth token copied from remote, got %+v", d)
+	}
+	if d.Protocol != "victoriametrics" {
+		t.Errorf("Expected default protocol victoriametrics, got %q", d.Protocol)
+	}
+	if d.ChunkSize != 100 {
+		t.Errorf("Expected chunk size 100, got %d", d.ChunkSize)
+	}
+	if d.Concurrency != 1 {
+		t.Errorf("Expected default concurrency 1, got %d", d.Concurrency)
+	}
+	if d.Retry.MaxAttempts != 7 {
+		t.Errorf("Expected retry copied from remote, got %+v", d.Retry)
+	}
+
+	if dests := (&RemoteConfig{}).GetDestinations(); dests != nil {
+		t.Errorf("Expected no destinations without url, got %+v", dests)
+	}
+}
+
+func TestGetDestinationsDefaults(t *testing.T) {
+	r := RemoteConfig{
+		ChunkSize:   80,
+		Concurrency: 4,
+		Retry:       RetryConfig{MaxAttempts: 4},
+		Destinations: []DestinationConfig{
+			{Name: "primary", URL: "http://vm:8428/api/v1/import"},
+			{
+				Name:        "archive",
+				URL:         "http://archive:9090/api/v1/write",
+				Protocol:    "prometheus_remote_write",
+				ChunkSize:   500,
+				Concurrency: 1,
+				Retry:       RetryConfig{Enabled: boolPtr(false)},
+			},
+		},
+	}
+
+	dests := r.GetDestinations()
+	if len(dests) != 2 {
+		t.Fatalf("Expected 2 destinations, got %d", len(dests))
+	}
+
+	primary := dests[0]
+	if primary.Protocol != "victoriametrics" {
+		t.Errorf("Expected primary protocol victoriametrics, got %q", primary.Protocol)
+	}
+	if primary.ChunkSize != 80 {
+		t.Errorf("Expected primary to inherit chunk size 80, got %d", primary.ChunkSize)
+	}
+	if primary.Concurrency != 4 {
+		t.Errorf("Expected primary to inherit concurrency 4, got %d", primary.Concurrency)
+	}
+	if primary.Retry.MaxAttempts != 4 {
+		t.Errorf("Expected primary to inherit remote retry, got %+v", primary.Retry)
+	}
+
+	archive := dests[1]
+	if archive.Protocol != "prometheus_remote_write" {
+		t.Errorf("Expected archive protocol prometheus_remote_write, got %q", archive.Protocol)
+	}
+	if archive.ChunkSize != 500 {
+		t.Errorf("Expected archive chunk size 500, got %d", archive.ChunkSize)
+	}
+	if archive.Concurrency != 1 {
+		t.Errorf("Expected archive concurrency 1, got %d", archive.Concurrency)
+	}
+	if archive.Retry.Enabled == nil || *archive.Retry.Enabled {
+		t.Errorf("Expected archive to keep its own retry block, got %+v", archive.Retry)
+	}
+	if archive.Retry.MaxAttempts != 0 {
+		t.Errorf("Expected archive retry not merged with remote retry, got %+v", archive.Retry)
+	}
+
+	// GetDestinations must not modify the configured list
+	if r.Destinations[0].ChunkSize != 0 || r.Destinations[0].Protocol != "" {
+		t.Errorf("Expected configured destinations unchanged, got %+v", r.Destinations[0])
+	}
+}
+
+func TestLoadConfigWithDestinations(t *testing.T) {
+	tokenPath := filepath.Join(t.TempDir(), "archive-token")
+	if err := os.WriteFile(tokenPath, []byte("archive-token\n"), 0600); err != nil {
+		t.Fatalf("Failed to write token file: %v", err)
+	}
+
+	cfg, err := loadYAML(t, `
+device:
+  id: test-device-001
+
+storage:
+  path: /tmp/test.db
+
+remote:
+  enabled: true
+  destinations:
+    - name: primary
+      url: http://vm:8428/api/v1/import
+      auth_token: primary-token
+    - name: archive
+      url: http://archive:9090/api/v1/write
+      protocol: prometheus_remote_write
+      auth_token_file: `+tokenPath+`
+      retry:
+        max_attempts: 10
+        initial_backoff: 5s
+        max_backoff: 5m
+
+metrics:
+  - name: cpu.usage
+    interval: 10s
+    enabled: true
+`)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	dests := cfg.Remote.GetDestinations()
+	if len(dests) != 2 {
+		t.Fatalf("Expected 2 destinations, got %d", len(dests))
+	}
+	if dests[0].AuthToken != "primary-token" {
+		t.Errorf("Expected primary auth token, got %q", dests[0].AuthToken)
+	}
+	if dests[1].AuthToken != "archive-token" {
+		t.Errorf("Expected archive token loaded from file and trimmed, got %q", dests[1].AuthToken)
+	}
+	if dests[1].Retry.MaxAttempts != 10 {
+		t.Errorf("Expected archive max_attempts 10, got %d", dests[1].Retry.MaxAttempts)
+	}
+	backoff, err := dests[1].Retry.MaxBackoff()
+	if err != nil || backoff != 5*time.Minute {
+		t.Errorf("Expected archive max_backoff 5m, got %v (err=%v)", backoff, err)
+	}
+}
+
+func TestDestinationsValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		remote      string
+		errContains string
+	}{
+		{
+			name: "url and destinations",
+			remote: `
+  url: http://vm:8428/api/v1/import
+  destinations:
+    - name: primary
+      url: http://vm:8428/api/v1/import`,
+			errContains: "mutually exclusive",
+		},
+		{
+			name: "missing name",
+			remote: `
+  destinations:
+    - url: http://vm:8428/api/v1/import`,
+			errContains: "name is required",
+		},
+		{
+			name: "invalid name",
+			remote: `
+  destinations:
+    - name: "prim ary"
+      url: http://vm:8428/api/v1/import`,
+			errContains: "may only contain",
+		},
+		{
+			name: "duplicate name",
+			remote: `
+  destinations:
+    - name: primary
+      url: http://vm:8428/api/v1/import
+    - name: primary
+      url: http://archive:8428/api/v1/import`,
+			errContains: "duplicate name",
+		},
+		{
+			name: "missing url",
+			remote: `
+  destinations:
+    - name: primary`,
+			errContains: "url is required",
+		},
+		{
+			name: "invalid protocol",
+			remote: `
+  destinations:
+    - name: primary
+      url: http://vm:8428/api/v1/import
+      protocol: influx`,
+			errContains: "protocol",
+		},
+		{
+			name: "invalid retry",
+			remote: `
+  destinations:
+    - name: archive
+      url: http://archive:8428/api/v1/import
+      retry:
+        max_backoff: 0s`,
+			errContains: "destination archive",
+		},
+		{
+			name: "both auth token and file",
+			remote: `
+  destinations:
+    - name: archive
+      url: http://archive:8428/api/v1/import
+      auth_token: inline
+      auth_token_file: /nonexistent`,
+			errContains: "cannot specify both",
+		},
+		{
+			name:        "no url or destinations",
+			remote:      "",
+			errContains: "url",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadYAML(t, `
+device:
+  id: test-device-001
+
+storage:
+  path: /tmp/test.db
+
+remote:
+  enabled: true`+tt.remote+`
+
+metrics:
+  - name: cpu.usage
+    interval: 10s
+    enabled: true
+`)
+			if err == nil {
+				t.Fatal("Expected validation error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.errContains) {
+				t.Errorf("Expected error containing %q, got %v", tt.errContains, err)
+			}
+		})
+	}
+}
+
+func TestMetricConfigOptions(t *testing.T) {
+	cfg, err := loadYAML(t, `
+device:
+  id: test-device-001
+
+storage:
+  path: /tmp/test.db
+
+metrics:
+  - name: network.traffic
+    interval: 10s
+    enabled: true
+    options:
+      include_pattern: "^(eth|wlan)"
+      exclude_patterns: ["^lo$", "^docker"]
+      max_interfaces: 8
+  - name: cpu.usage
+    interval: 10s
+    enabled: true
+`)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	opts := cfg.Metrics[0].Options
+	if opts["include_pattern"] != "^(eth|wlan)" {
+		t.Errorf("Expected include_pattern option, got %v", opts["include_pattern"])
+	}
+	if opts["max_interfaces"] != 8 {
+		t.Errorf("Expected max_interfaces=8, got %v (%T)", opts["max_interfaces"], opts["max_interfaces"])
+	}
+	if list, ok := opts["exclude_patterns"].([]interface{}); !ok || len(list) != 2 {
+		t.Errorf("Expected exclude_patterns list of 2, got %v", opts["exclude_patterns"])
+	}
+	if cfg.Metrics[1].Options != nil {
+		t.Errorf("Expected nil options when not set, got %v", cfg.Metrics[1].Options)
+	}
+}
+
+func TestMetricsEndpointDefault(t *testing.T) {
+	m := MonitoringConfig{}
+	if !m.IsMetricsEndpointEnabled() {
+		t.Error("Expected /metrics enabled by default")
+	}
+
+	m.MetricsEndpoint = boolPtr(false)
+	if m.IsMetricsEndpointEnabled() {
+		t.Error("Expected /metrics disabled when metrics_endpoint: false")
+	}
+}
+
+func TestTimeSyncConfig(t *testing.T) {
+	var ts TimeSyncConfig
+	if !ts.IsEnabled() {
+		t.Error("Expected time sync hold to be enabled by default")
+	}
+	if interval, err := ts.CheckInterval(); err != nil || interval != 10*time.Second {
+		t.Errorf("Expected default check_interval 10s, got %v (err: %v)", interval, err)
+	}
+	if maxWait, err := ts.MaxWait(); err != nil || maxWait != time.Hour {
+		t.Errorf("Expected default max_wait 1h, got %v (err: %v)", maxWait, err)
+	}
+
+	cfg, err := loadYAML(t, `
+device:
+  id: test-device
+storage:
+  path: /tmp/test.db
+monitoring:
+  time_sync:
+    enabled: false
+    check_interval: 5s
+    max_wait: 30m
+metrics:
+  - name: cpu.usage
+    interval: 30s
+    enabled: true
+`)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	ts = cfg.Monitoring.TimeSync
+	if ts.IsEnabled() {
+		t.Error("Expected time sync hold to be disabled")
+	}
+	if interval, _ := ts.CheckInterval(); interval != 5*time.Second {
+		t.Errorf("Expected check_interval 5s, got %v", interval)
+	}
+	if maxWait, _ := ts.MaxWait(); maxWait != 30*time.Minute {
+		t.Errorf("Expected max_wait 30m, got %v", maxWait)
+	}
+
+	for _, bad := range []string{"check_interval: 0s", "check_interval: soon", "max_wait: -1m"} {
+		_, err := loadYAML(t, `
+device:
+  id: test-device
+storage:
+  path: /tmp/test.db
+monitoring:
+  time_sync:
+    `+bad+`
+metrics:
+  - name: cpu.usage
+    interval: 30s
+    enabled: true
+`)
+		if err == nil || !strings.Contains(err.Error(), "time_sync") {
+			t.Errorf("Expected %q to be rejected, got %v", bad, err)
+		}
+	}
+}
+
+func TestRollupConfig(t *testing.T) {
+	var rc RollupConfig
+	if rc.Enabled {
+		t.Error("Expected rollups to be disabled by default")
+	}
+	if after, err := rc.After(); err != nil || after != 6*time.Hour {
+		t.Errorf("Expected default after 6h, got %v (err: %v)", after, err)
+	}
+	if resolution, err := rc.Resolution(); err != nil || resolution != 5*time.Minute {
+		t.Errorf("Expected default resolution 5m, got %v (err: %v)", resolution, err)
+	}
+
+	cfg, err := loadYAML(t, `
+device:
+  id: test-device
+storage:
+  path: /tmp/test.db
+  retention:
+    rollup:
+      enabled: true
+      after: 24h
+      resolution: 1m
+metrics:
+  - name: cpu.usage
+    interval: 30s
+    enabled: true
+`)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	rc = cfg.Storage.Retention.Rollup
+	if !rc.Enabled {
+		t.Error("Expected rollups to be enabled")
+	}
+	if after, _ := rc.After(); after != 24*time.Hour {
+		t.Errorf("Expected after 24h, got %v", after)
+	}
+	if resolution, _ := rc.Resolution(); resolution != time.Minute {
+		t.Errorf("Expected resolution 1m, got %v", resolution)
+	}
+
+	for _, bad := range []string{"after: 0s", "after: later", "resolution: 500ms", "resolution: wide"} {
+		_, err := loadYAML(t, `
+device:
+  id: test-device
+storage:
+  path: /tmp/test.db
+  retention:
+    rollup:
+      `+bad+`
+metrics:
+  - name: cpu.usage
+    interval: 30s
+    enabled: true
+`)
+		if err == nil || !strings.Contains(err.Error(), "retention.rollup") {
+			t.Errorf("Expected %q to be rejected, got %v", bad, err)
+		}
+	}
+}
+
+func TestRelabelConfig(t *testing.T) {
+	cfg, err := loadYAML(t, `
+device:
+  id: test-device
+storage:
+  path: /tmp/test.db
+metrics:
+  - name: network.traffic
+    interval: 30s
+    enabled: true
+relabel:
+  max_series_per_metric: 64
+  rules:
+    - action: drop
+      source_labels: [interface]
+      regex: 'veth.*'
+    - source_labels: [session]
+      target_label: session
+      replacement: ""
+`)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	rc := cfg.Relabel
+	if rc.MaxSeriesPerMetric != 64 {
+		t.Errorf("Expected max_series_per_metric 64, got %d", rc.MaxSeriesPerMetric)
+	}
+	if len(rc.Rules) != 2 {
+		t.Fatalf("Expected 2 rules, got %d", len(rc.Rules))
+	}
+	drop := rc.Rules[0]
+	if drop.Action != "drop" || len(drop.SourceLabels) != 1 || drop.SourceLabels[0] != "interface" || drop.Regex != "veth.*" {
+		t.Errorf("Unexpected drop rule %+v", drop)
+	}
+	if drop.Replacement != nil {
+		t.Error("Expected an unset replacement to stay nil so the default applies")
+	}
+	if r := rc.Rules[1].Replacement; r == nil || *r != "" {
+		t.Errorf("Expected an explicit empty replacement, got %v", r)
+	}
+}
+
+func TestDeviceConfig(t *testing.T) {
+	cfg, err := loadYAML(t, `
+device:
+  id_source: machine-id
+  labels:
+    site: wellington
+    vehicle: van-3
+storage:
+  path: /tmp/test.db
+`)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Device.ID != "" || cfg.Device.IDSource != "machine-id" {
+		t.Errorf("Expected id_source machine-id without an id, got %+v", cfg.Device)
+	}
+	if len(cfg.Device.Labels) != 2 || cfg.Device.Labels["site"] != "wellington" {
+		t.Errorf("Unexpected labels %v", cfg.Device.Labels)
+	}
+
+	tests := []struct {
+		name    string
+		device  DeviceConfig
+		wantErr string
+	}{
+		{"unknown id source", DeviceConfig{IDSource: "uuid"}, "device.id_source must be"},
+		{"invalid label name", DeviceConfig{ID: "d", Labels: map[string]string{"fleet-name": "x"}}, "invalid label name"},
+		{"reserved label prefix", DeviceConfig{ID: "d", Labels: map[string]string{"__name__": "x"}}, "invalid label name"},
+		{"device_id label", DeviceConfig{ID: "d", Labels: map[string]string{"device_id": "x"}}, "device_id is reserved"},
+		{"empty label value", DeviceConfig{ID: "d", Labels: map[string]string{"site": ""}}, "must not be empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{Device: tt.device, Storage: StorageConfig{Path: "/tmp/test.db"}}
+			err := c.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestBufferConfig(t *testing.T) {
+	var b BufferConfig
+	if !b.IsEnabled() {
+		t.Error("Expected the write buffer enabled by default")
+	}
+	if d, err := b.FlushInterval(); err != nil || d != 10*time.Second {
+		t.Errorf("Expected default flush interval 10s, got %v (err: %v)", d, err)
+	}
+	if b.GetMaxMetrics() != 5000 || b.MinAvailableBytes() != 32*1024*1024 {
+		t.Errorf("Unexpected defaults: max_metrics %d, min_available %d", b.GetMaxMetrics(), b.MinAvailableBytes())
+	}
+
+	cfg, err := loadYAML(t, `
+device:
+  id: test-device
+storage:
+  path: /tmp/test.db
+  buffer:
+    enabled: false
+    flush_interval: 30s
+    max_metrics: 1000
+    min_available_mb: 64
+`)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	b = cfg.Storage.Buffer
+	if b.IsEnabled() {
+		t.Error("Expected an explicit false to disable the buffer")
+	}
+	if d, _ := b.FlushInterval(); d != 30*time.Second {
+		t.Errorf("Expected flush interval 30s, got %v", d)
+	}
+	if b.GetMaxMetrics() != 1000 || b.MinAvailableBytes() != 64*1024*1024 {
+		t.Errorf("Unexpected values: max_metrics %d, min_available %d", b.GetMaxMetrics(), b.MinAvailableBytes())
+	}
+
+	invalid := Config{
+		Device:  DeviceConfig{ID: "d"},
+		Storage: StorageConfig{Path: "/tmp/test.db", Buffer: BufferConfig{FlushIntervalStr: "0s"}},
+	}
+	if err := invalid.Validate(); err == nil || !strings.Contains(err.Error(), "storage.buffer.flush_interval must be positive") {
+		t.Errorf("Expected a non-positive flush interval to fail, got %v", err)
+	}
+}
+
+func TestSessionsConfig(t *testing.T) {
+	var s SessionsConfig
+	if !s.ShouldPrioritizeUploads() {
+		t.Error("Expected session uploads prioritized by default")
+	}
+	if d, err := s.CheckInterval(); err != nil || d != 5*time.Second {
+		t.Errorf("Expected default check interval 5s, got %v (err: %v)", d, err)
+	}
+	if d, err := s.CloseAfter(); err != nil || d != 30*time.Second {
+		t.Errorf("Expected default close_after 30s, got %v (err: %v)", d, err)
+	}
+
+	cfg, err := loadYAML(t, `
+device:
+  id: test-device
+storage:
+  path: /tmp/test.db
+sessions:
+  enabled: true
+  close_after: 2m
+  prioritize_uploads: false
+  triggers:
+    - process: ffmpeg
+    - unit: srt-stream.service
+    - metric: srt.bitrate_bps
+      above: 100000
+`)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	s = cfg.Sessions
+	if !s.Enabled || s.ShouldPrioritizeUploads() || len(s.Triggers) != 3 {
+		t.Errorf("Unexpected sessions config %+v", s)
+	}
+	if d, _ := s.CloseAfter(); d != 2*time.Minute {
+		t.Errorf("Expected close_after 2m, got %v", d)
+	}
+	if s.Triggers[2].Metric != "srt.bitrate_bps" || s.Triggers[2].Above == nil || *s.Triggers[2].Above != 100000 {
+		t.Errorf("Unexpected metric trigger %+v", s.Triggers[2])
+	}
+
+	low, high := 10.0, 5.0
+	tests := []struct {
+		name     string
+		sessions SessionsConfig
+		wantErr  string
+	}{
+		{"enabled without triggers", SessionsConfig{Enabled: true}, "sessions.triggers is required"},
+		{"no target", SessionsConfig{Triggers: []SessionTriggerConfig{{}}}, "exactly one of process, unit or metric"},
+		{"two targets", SessionsConfig{Triggers: []SessionTriggerConfig{{Process: "ffmpeg", Unit: "srt.service"}}}, "exactly one of"},
+		{"metric without threshold", SessionsConfig{Triggers: []SessionTriggerConfig{{Metric: "srt.bitrate_bps"}}}, "needs above or below"},
+		{"threshold on process", SessionsConfig{Triggers: []SessionTriggerConfig{{Process: "ffmpeg", Above: &low}}}, "only apply to metric triggers"},
+		{"empty range", SessionsConfig{Triggers: []SessionTriggerConfig{{Metric: "m", Above: &low, Below: &high}}}, "must be less than below"},
+		{"invalid close_after", SessionsConfig{CloseAfterStr: "-1s"}, "sessions.close_after must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{Device: DeviceConfig{ID: "d"}, Storage: StorageConfig{Path: "/tmp/test.db"}, Sessions: tt.sessions}
+			err := c.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestStatsDConfig(t *testing.T) {
+	var s StatsDConfig
+	if s.GetAddress() != "127.0.0.1:8125" || s.GetMaxSeries() != 10000 {
+		t.Errorf("Unexpected defaults: address %s, max_series %d", s.GetAddress(), s.GetMaxSeries())
+	}
+	if d, err := s.FlushInterval(); err != nil || d != 10*time.Second {
+		t.Errorf("Expected default flush interval 10s, got %v (err: %v)", d, err)
+	}
+	if d, err := s.IdleTimeout(); err != nil || d != time.Hour {
+		t.Errorf("Expected default idle timeout 1h, got %v (err: %v)", d, err)
+	}
+
+	cfg, err := loadYAML(t, `
+device:
+  id: test-device
+storage:
+  path: /tmp/test.db
+statsd:
+  enabled: true
+  address: "[::1]:9125"
+  flush_interval: 30s
+  max_series: 500
+`)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	s = cfg.StatsD
+	if !s.Enabled || s.GetAddress() != "[::1]:9125" || s.GetMaxSeries() != 500 {
+		t.Errorf("Unexpected statsd config %+v", s)
+	}
+	if d, _ := s.FlushInterval(); d != 30*time.Second {
+		t.Errorf("Expected flush_interval 30s, got %v", d)
+	}
+
+	tests := []struct {
+		name    string
+		statsd  StatsDConfig
+		wantErr string
+	}{
+		{"address without port", StatsDConfig{Address: "localhost"}, "invalid statsd.address"},
+		{"negative max_series", StatsDConfig{MaxSeries: -1}, "statsd.max_series must not be negative"},
+		{"invalid flush_interval", StatsDConfig{FlushIntervalStr: "soon"}, "invalid statsd.flush_interval"},
+		{"zero idle_timeout", StatsDConfig{IdleTimeoutStr: "0s"}, "statsd.idle_timeout must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{Device: DeviceConfig{ID: "d"}, Storage: StorageConfig{Path: "/tmp/test.db"}, StatsD: tt.statsd}
+			err := c.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestIngestConfig(t *testing.T) {
+	var i IngestConfig
+	if !i.ServesHTTP() || i.GetMaxMetrics() != 10000 {
+		t.Errorf("Unexpected defaults: http %v, max_metrics %d", i.ServesHTTP(), i.GetMaxMetrics())
+	}
+
+	tokenPath := filepath.Join(t.TempDir(), "ingest-token")
+	if err := os.WriteFile(tokenPath, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadYAML(t, `
+device:
+  id: test-device
+storage:
+  path: /tmp/test.db
+ingest:
+  enabled: true
+  auth_token_file: `+tokenPath+`
+  socket: /run/tidewatch/ingest.sock
+  priority: P1
+`)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	i = cfg.Ingest
+	if i.AuthToken != "secret" || i.Socket != "/run/tidewatch/ingest.sock" {
+		t.Errorf("Unexpected ingest config %+v", i)
+	}
+	if p, _ := i.GetPriority(); p != models.PriorityP1 {
+		t.Errorf("Expected priority P1, got %q", p)
+	}
+
+	off := false
+	tests := []struct {
+		name    string
+		ingest  IngestConfig
+		health  string
+		wantErr string
+	}{
+		{"no token on all interfaces", IngestConfig{Enabled: true}, "", "ingest.auth_token is required"},
+		{"no token on a LAN address", IngestConfig{Enabled: true}, "192.168.1.10:9100", "ingest.auth_token is required"},
+		{"no listener", IngestConfig{Enabled: true, HTTP: &off}, "", "ingest.socket is required"},
+		{"invalid priority", IngestConfig{Priority: "urgent"}, "", "ingest.priority"},
+		{"negative max_metrics", IngestConfig{MaxMetrics: -1}, "", "ingest.max_metrics must not be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{Device: DeviceConfig{ID: "d"}, Storage: StorageConfig{Path: "/tmp/test.db"}, Ingest: tt.ingest}
+			c.Monitoring.HealthAddress = tt.health
+			err := c.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	for _, valid := range []IngestConfig{
+		{Enabled: true, AuthToken: "secret"},
+		{Enabled: true, HTTP: &off, Socket: "/run/tidewatch/ingest.sock"},
+	} {
+		c := Config{Device: DeviceConfig{ID: "d"}, Storage: StorageConfig{Path: "/tmp/test.db"}, Ingest: valid}
+		if err := c.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", valid, err)
+		}
+	}
+	for _, addr := range []string{"127.0.0.1:9100", "localhost:9100", "[::1]:9100"} {
+		c := Config{Device: DeviceConfig{ID: "d"}, Storage: StorageConfig{Path: "/tmp/test.db"}, Ingest: IngestConfig{Enabled: true}}
+		c.Monitoring.HealthAddress = addr
+		if err := c.Validate(); err != nil {
+			t.Errorf("Expected no token needed on %s, got %v", addr, err)
+		}
+	}
+}
+
+func TestMetricConfigPriority(t *testing.T) {
+	cfg, err := loadYAML(t, `
+device:
+  id: test-device
+storage:
+  path: /tmp/test.db
+metrics:
+  - name: srt.packet_loss
+    interval: 5s
+    enabled: true
+    priority: p0
+  - name: disk.io
+    interval: 30s
+    enabled: true
+`)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if p, err := cfg.Metrics[0].GetPriority(); err != nil || p != models.PriorityP0 {
+		t.Errorf("Expected P0, got %q (err: %v)", p, err)
+	}
+	if p, err := cfg.Metrics[1].GetPriority(); err != nil || p != models.PriorityDefault {
+		t.Errorf("Expected the default priority, got %q (err: %v)", p, err)
+	}
+
+	invalid := Config{
+		Device:  DeviceConfig{ID: "d"},
+		Storage: StorageConfig{Path: "/tmp/test.db"},
+		Metrics: []MetricConfig{{Name: "disk.io", Interval: "30s", Enabled: true, Priority: "urgent"}},
+	}
+	if err := invalid.Validate(); err == nil || !strings.Contains(err.Error(), "metric disk.io: priority must be") {
+		t.Errorf("Expected an invalid priority to fail, got %v", err)
+	}
+}
+
+func TestCircuitBreakerConfig(t *testing.T) {
+	var b CircuitBreakerConfig
+	if !b.IsEnabled() || b.GetFailureThreshold() != 3 {
+		t.Errorf("Expected an enabled breaker with threshold 3 by default, got %+v", b)
+	}
+	if d, err := b.OpenTimeout(); err != nil || d != time.Minute {
+		t.Errorf("Expected default open_timeout 1m, got %v (err: %v)", d, err)
+	}
+	if d, err := b.MaxOpenTimeout(); err != nil || d != 10*time.Minute {
+		t.Errorf("Expected default max_open_timeout 10m, got %v (err: %v)", d, err)
+	}
+
+	cfg, err := loadYAML(t, `
+device:
+  id: test-device
+storage:
+  path: /tmp/test.db
+remote:
+  enabled: true
+  url: http://localhost:8428/api/v1/import
+  probe_url: http://localhost:8428/health
+  circuit_breaker:
+    failure_threshold: 5
+    open_timeout: 30s
+    max_open_timeout: 5m
+`)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	b = cfg.Remote.CircuitBreaker
+	if b.GetFailureThreshold() != 5 {
+		t.Errorf("Expected threshold 5, got %d", b.GetFailureThreshold())
+	}
+	if d, _ := b.OpenTimeout(); d != 30*time.Second {
+		t.Errorf("Expected open_timeout 30s, got %v", d)
+	}
+	if dests := cfg.Remote.GetDestinations(); dests[0].ProbeURL != "http://localhost:8428/health" {
+		t.Errorf("Expected remote.probe_url on the default destination, got %q", dests[0].ProbeURL)
+	}
+
+	tests := map[string]CircuitBreakerConfig{
+		"invalid remote.circuit_breaker.open_timeout":  {OpenTimeoutStr: "soon"},
+		"open_timeout must be positive":                {OpenTimeoutStr: "0s"},
+		"max_open_timeout must be positive":            {MaxOpenTimeoutStr: "-1m"},
+		"must not be shorter than open_timeout (5m0s)": {OpenTimeoutStr: "5m", MaxOpenTimeoutStr: "1m"},
+	}
+	for want, b := range tests {
+		c := Config{Device: DeviceConfig{ID: "d"}, Storage: StorageConfig{Path: "/tmp/test.db"}, Remote: RemoteConfig{CircuitBreaker: b}}
+		if err := c.Validate(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error containing %q, got %v", want, err)
+		}
+	}
+}
+
+func TestBandwidthConfig(t *testing.T) {
+	cfg, err := loadYAML(t, `
+device:
+  id: test-device
+storage:
+  path: /tmp/test.db
+remote:
+  enabled: true
+  url: http://localhost:8428/api/v1/import
+  bandwidth:
+    daily_budget_mb: 20
+    monthly_budget_mb: 500
+    rate_limit_bytes_per_sec: 32768
+    interfaces:
+      - match: eth0
+        policy: unmetered
+      - match: "wwan*"
+        policy: priority
+      - match: "usb*"
+        policy: priority
+        min_priority: p0
+`)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	b := cfg.Remote.Bandwidth
+	if b.DailyBudgetBytes() != 20*1024*1024 || b.MonthlyBudgetBytes() != 500*1024*1024 || b.RateLimitBytesPerSec != 32768 {
+		t.Errorf("Unexpected budgets %+v", b)
+	}
+	if len(b.Interfaces) != 3 {
+		t.Fatalf("Expected 3 interface rules, got %d", len(b.Interfaces))
+	}
+	if p, err := b.Interfaces[1].GetMinPriority(); err != nil || p != models.PriorityP1 {
+		t.Errorf("Expected min_priority to default to P1, got %s (err: %v)", p, err)
+	}
+	if p, _ := b.Interfaces[2].GetMinPriority(); p != models.PriorityP0 {
+		t.Errorf("Expected min_priority P0, got %s", p)
+	}
+
+	var empty BandwidthConfig
+	if empty.DailyBudgetBytes() != 0 || empty.MonthlyBudgetBytes() != 0 {
+		t.Error("Expected unlimited budgets by default")
+	}
+
+	tests := map[string]BandwidthConfig{
+		"daily_budget_mb must not be negative":          {DailyBudgetMB: -1},
+		"monthly_budget_mb must not be negative":        {MonthlyBudgetMB: -1},
+		"rate_limit_bytes_per_sec must not be negative": {RateLimitBytesPerSec: -1},
+		"interfaces[0]: match is required":              {Interfaces: []InterfacePolicyConfig{{Policy: "metered"}}},
+		"invalid match":                                 {Interfaces: []InterfacePolicyConfig{{Match: "wwan["}}},
+		"policy must be unmetered, metered or priority": {Interfaces: []InterfacePolicyConfig{{Match: "eth0", Policy: "free"}}},
+		"min_priority requires policy priority":         {Interfaces: []InterfacePolicyConfig{{Match: "eth0", MinPriority: "P1"}}},
+		"min_priority: priority must be P0":             {Interfaces: []InterfacePolicyConfig{{Match: "wwan0", Policy: "priority", MinPriority: "P9"}}},
+	}
+	for want, b := range tests {
+		c := Config{Device: DeviceConfig{ID: "d"}, Storage: StorageConfig{Path: "/tmp/test.db"}, Remote: RemoteConfig{Bandwidth: b}}
+		if err := c.Validate(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error containing %q, got %v", want, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package exposition
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+	"github.com/taniwha3/tidewatch/internal/uploader"
+)
+
+// HistoryWriter streams stored samples in OpenMetrics text format, with timestamps
+// Unlike WriteOpenMetrics it keeps every sample, so the output can be backfilled into a TSDB
+// (e.g., promtool tsdb create-blocks-from openmetrics). Samples must arrive grouped by series
+// and oldest first (storage.QueryOptions.OrderBySeries). Families must not interleave, so
+// samples of a family that already ended are skipped and counted in Skipped.
+type HistoryWriter struct {
+	bw      *bufio.Writer
+	family  string      // Current family name
+	kind    models.Kind // Current family kind
+	ended   map[string]bool
+	Skipped int64
+}
+
+// NewHistoryWriter creates a writer; Close must be called to terminate the exposition
+func NewHistoryWriter(w io.Writer) *HistoryWriter {
+	return &HistoryWriter{
+		bw:    bufio.NewWriter(w),
+		ended: make(map[string]bool),
+	}
+}
+
+// Write appends one sample; string metrics are ignored
+func (h *HistoryWriter) Write(m *models.Metric) error {
+	if m == nil || m.ValueType == models.ValueTypeString {
+		return nil
+	}
+
+	name := uploader.SeriesName(m)
+	familyName, kind := uploader.Family(m)
+
+	if familyName != h.family {
+		if h.ended[familyName] {
+			h.Skipped++
+			return nil
+		}
+		if h.family != "" {
+			h.ended[h.family] = true
+		}
+		h.family, h.kind = familyName, kind
+		writeMetadata(h.bw, familyName, kind, familyUnit(familyName, m))
+	} else if kind != h.kind {
+		// A gauge "x" and a counter "x_total" would share a family; keep the first kind
+		h.Skipped++
+		return nil
+	}
+
+	h.bw.WriteString(name)
+	h.bw.WriteString(renderLabels(m))
+	h.bw.WriteByte(' ')
+	h.bw.WriteString(formatValue(m.Value))
+	h.bw.WriteByte(' ')
+	// OpenMetrics timestamps are in seconds
+	h.bw.WriteString(strconv.FormatFloat(float64(m.TimestampMs)/1000, 'f', 3, 64))
+	_, err := h.bw.WriteString("\n")
+	return err
+}
+
+// Close terminates the exposition with # EOF and flushes it
+func (h *HistoryWriter) Close() error {
+	h.bw.WriteString("# EOF\n")
+	return h.bw.Flush()
+}
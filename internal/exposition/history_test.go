@@ -0,0 +1,62 @@
+package exposition
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+func TestHistoryWriter_Format(t *testing.T) {
+	ts := time.UnixMilli(1700000000123)
+	metrics := []*models.Metric{
+		models.NewMetric("cpu.usage", 12.5, "dev-1").WithTimestamp(ts),
+		models.NewMetric("cpu.usage", 13, "dev-1").WithTimestamp(ts.Add(time.Second)),
+		models.NewMetric("cpu.usage", 80, "dev-1").WithTimestamp(ts).
+			WithTag(models.TagRollupResolution, "5m").
+			WithTag(models.TagRollupAgg, "max"),
+		models.NewMetric("network.rx_bytes", 1024, "dev-1").WithTimestamp(ts).WithTag("interface", "eth0"),
+		models.NewStringMetric("cpu.state", "ok", "dev-1").WithTimestamp(ts),
+	}
+
+	var buf bytes.Buffer
+	w := NewHistoryWriter(&buf)
+	for _, m := range metrics {
+		if err := w.Write(m); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	want := `# TYPE cpu_usage gauge
+cpu_usage{device_id="dev-1"} 12.5 1700000000.123
+cpu_usage{device_id="dev-1"} 13 1700000001.123
+# TYPE cpu_usage:max_5m gauge
+cpu_usage:max_5m{device_id="dev-1"} 80 1700000000.123
+# TYPE network_rx_bytes counter
+network_rx_bytes_total{device_id="dev-1",interface="eth0"} 1024 1700000000.123
+# EOF
+`
+	if buf.String() != want {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestHistoryWriter_SkipsInterleavedFamilies(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewHistoryWriter(&buf)
+	w.Write(models.NewMetric("cpu.usage", 1, "dev-1"))
+	w.Write(models.NewMetric("memory.usage", 2, "dev-1"))
+	w.Write(models.NewMetric("cpu.usage", 3, "dev-1"))
+	w.Close()
+
+	if w.Skipped != 1 {
+		t.Errorf("Expected 1 skipped sample, got %d", w.Skipped)
+	}
+	if bytes.Count(buf.Bytes(), []byte("# TYPE cpu_usage ")) != 1 {
+		t.Errorf("Expected the cpu_usage family once, got:\n%s", buf.String())
+	}
+}
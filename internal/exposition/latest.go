@@ -0,0 +1,85 @@
+package exposition
+
+import (
+	"sync"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+// DefaultStaleAfter is how long a series is exposed after its last sample
+const DefaultStaleAfter = 10 * time.Minute
+
+// Latest keeps the most recent sample of every numeric series for local scraping
+// Series that stop reporting (e.g., a removed network interface) expire after StaleAfter
+type Latest struct {
+	mu         sync.RWMutex
+	series     map[string]*models.Metric // series key -> latest sample
+	staleAfter time.Duration
+	now        func() time.Time
+}
+
+// NewLatest creates an empty latest-value cache
+// A non-positive staleAfter uses DefaultStaleAfter
+func NewLatest(staleAfter time.Duration) *Latest {
+	if staleAfter <= 0 {
+		staleAfter = DefaultStaleAfter
+	}
+	return &Latest{
+		series:     make(map[string]*models.Metric),
+		staleAfter: staleAfter,
+		now:        time.Now,
+	}
+}
+
+// Observe records samples, keeping only the newest per series
+// String metrics are ignored as OpenMetrics samples are numeric
+func (l *Latest) Observe(metrics []*models.Metric) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, m := range metrics {
+		if m == nil || m.ValueType == models.ValueTypeString {
+			continue
+		}
+		key := m.Name + "\xff" + m.DeviceID + "\xff" + models.SeriesKey(m.Tags)
+		if prev, ok := l.series[key]; ok && prev.TimestampMs > m.TimestampMs {
+			continue
+		}
+		l.series[key] = copyMetric(m)
+	}
+}
+
+// Snapshot returns the current samples, dropping series older than StaleAfter
+func (l *Latest) Snapshot() []*models.Metric {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := l.now().Add(-l.staleAfter).UnixMilli()
+	metrics := make([]*models.Metric, 0, len(l.series))
+	for key, m := range l.series {
+		if m.TimestampMs < cutoff {
+			delete(l.series, key)
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+// Len returns the number of cached series
+func (l *Latest) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.series)
+}
+
+// copyMetric copies a metric so later changes by the caller don't leak into the cache
+func copyMetric(m *models.Metric) *models.Metric {
+	c := *m
+	c.Tags = make(map[string]string, len(m.Tags))
+	for k, v := range m.Tags {
+		c.Tags[k] = v
+	}
+	return &c
+}
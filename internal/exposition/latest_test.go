@@ -0,0 +1,73 @@
+package exposition
+
+import (
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+func TestLatest_KeepsNewestPerSeries(t *testing.T) {
+	l := NewLatest(0)
+	now := time.Now()
+
+	l.Observe([]*models.Metric{
+		models.NewMetric("cpu.usage_percent", 10, "dev").WithTimestamp(now),
+		models.NewMetric("cpu.core_usage_percent", 5, "dev").WithTag("core", "0").WithTimestamp(now),
+		models.NewMetric("cpu.core_usage_percent", 6, "dev").WithTag("core", "1").WithTimestamp(now),
+		models.NewStringMetric("system.state", "ok", "dev"),
+	})
+	l.Observe([]*models.Metric{
+		models.NewMetric("cpu.usage_percent", 20, "dev").WithTimestamp(now.Add(time.Second)),
+		// Out-of-order sample must not replace the newer one
+		models.NewMetric("cpu.core_usage_percent", 99, "dev").WithTag("core", "0").WithTimestamp(now.Add(-time.Second)),
+	})
+
+	if l.Len() != 3 {
+		t.Fatalf("Expected 3 numeric series, got %d", l.Len())
+	}
+
+	values := make(map[string]float64)
+	for _, m := range l.Snapshot() {
+		values[m.Name+"/"+m.Tags["core"]] = m.Value
+	}
+	if values["cpu.usage_percent/"] != 20 {
+		t.Errorf("Expected newest cpu.usage_percent 20, got %v", values["cpu.usage_percent/"])
+	}
+	if values["cpu.core_usage_percent/0"] != 5 {
+		t.Errorf("Expected out-of-order sample ignored, got %v", values["cpu.core_usage_percent/0"])
+	}
+}
+
+func TestLatest_ExpiresStaleSeries(t *testing.T) {
+	l := NewLatest(time.Minute)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	l.Observe([]*models.Metric{
+		models.NewMetric("network.rx_bytes_total", 1, "dev").WithTag("interface", "usb0").WithTimestamp(now.Add(-2 * time.Minute)),
+		models.NewMetric("network.rx_bytes_total", 2, "dev").WithTag("interface", "eth0").WithTimestamp(now),
+	})
+
+	snapshot := l.Snapshot()
+	if len(snapshot) != 1 || snapshot[0].Tags["interface"] != "eth0" {
+		t.Errorf("Expected only the fresh eth0 series, got %v", snapshot)
+	}
+	if l.Len() != 1 {
+		t.Errorf("Expected stale series removed from the cache, got %d", l.Len())
+	}
+}
+
+func TestLatest_CopiesMetrics(t *testing.T) {
+	l := NewLatest(0)
+	m := models.NewMetric("memory.used_bytes", 1, "dev").WithTag("host", "a")
+	l.Observe([]*models.Metric{m})
+
+	m.Value = 2
+	m.Tags["host"] = "b"
+
+	snapshot := l.Snapshot()
+	if snapshot[0].Value != 1 || snapshot[0].Tags["host"] != "a" {
+		t.Errorf("Expected cached sample unaffected by caller changes, got %+v", snapshot[0])
+	}
+}
@@ -0,0 +1,210 @@
+package exposition
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+	"github.com/taniwha3/tidewatch/internal/uploader"
+)
+
+// OpenMetrics text format implementation
+// See: https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md
+
+// ContentType is the OpenMetrics 1.0 text exposition content type
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// family groups the samples that share a metric name
+type family struct {
+	name    string      // Family name (sample name without _total, _bucket, _sum or _count)
+	kind    models.Kind // Never KindUnknown
+	unit    string
+	samples []sample
+}
+
+type sample struct {
+	name   string
+	labels string // Pre-rendered {..} block, sorted by label name
+	value  float64
+}
+
+// WriteOpenMetrics writes numeric metrics in OpenMetrics text format, terminated by # EOF
+// Names and labels are sanitized the same way as for uploads, so scraped series match the remote.
+// Families are typed from the declared metric kind and unit (see uploader.Family). Samples carry no
+// timestamps: the scraper's clock is authoritative, which avoids rejected samples on skewed devices.
+func WriteOpenMetrics(w io.Writer, metrics []*models.Metric) error {
+	families := make(map[string]*family)
+	seen := make(map[string]bool)
+
+	for _, m := range metrics {
+		if m == nil || m.ValueType == models.ValueTypeString {
+			continue
+		}
+
+		name := uploader.MetricName(m)
+		familyName, kind := uploader.Family(m)
+		fam, ok := families[familyName]
+		if !ok {
+			fam = &family{name: familyName, kind: kind, unit: familyUnit(familyName, m)}
+			families[familyName] = fam
+		} else if fam.kind != kind {
+			// A gauge "x" and a counter "x_total" would share a family; keep the first kind
+			continue
+		}
+
+		labels := renderLabels(m)
+		// Sanitizing can map two series onto one; the first wins so the output stays valid
+		if seen[name+labels] {
+			continue
+		}
+		seen[name+labels] = true
+
+		fam.samples = append(fam.samples, sample{name: name, labels: labels, value: m.Value})
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		fam := families[name]
+		sort.Slice(fam.samples, func(i, j int) bool {
+			if fam.samples[i].name != fam.samples[j].name {
+				return fam.samples[i].name < fam.samples[j].name
+			}
+			return fam.samples[i].labels < fam.samples[j].labels
+		})
+
+		writeMetadata(bw, fam.name, fam.kind, fam.unit)
+		for _, s := range fam.samples {
+			bw.WriteString(s.name)
+			bw.WriteString(s.labels)
+			bw.WriteByte(' ')
+			bw.WriteString(formatValue(s.value))
+			bw.WriteByte('\n')
+		}
+	}
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+// familyUnit returns the unit a family declares in its # UNIT line
+// OpenMetrics requires the family name to end in the unit, so other units are left out
+func familyUnit(familyName string, m *models.Metric) string {
+	if m.Unit == "" || m.IsRollup() || !strings.HasSuffix(familyName, "_"+m.Unit) {
+		return ""
+	}
+	return m.Unit
+}
+
+// writeMetadata writes the # TYPE and # UNIT lines of a family
+func writeMetadata(bw *bufio.Writer, name string, kind models.Kind, unit string) {
+	bw.WriteString("# TYPE " + name + " " + string(kind) + "\n")
+	if unit != "" {
+		bw.WriteString("# UNIT " + name + " " + unit + "\n")
+	}
+}
+
+// renderLabels renders device_id and tags as a sorted label block
+// Internal tags (leading underscore, e.g. _storage_id) and empty values are skipped
+func renderLabels(m *models.Metric) string {
+	labels := make(map[string]string, len(m.Tags)+1)
+	if m.DeviceID != "" {
+		labels["device_id"] = m.DeviceID
+	}
+	for k, v := range m.Tags {
+		if strings.HasPrefix(k, "_") || v == "" {
+			continue
+		}
+		labels[uploader.SanitizeLabelName(k)] = v
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(labels[k]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+// formatValue formats a sample value, spelling out the special floats as OpenMetrics requires
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// MetaSource returns tidewatch's own meta-metrics at scrape time
+type MetaSource func(ctx context.Context) ([]*models.Metric, error)
+
+// Handler serves the latest collected samples plus meta-metrics in OpenMetrics format
+// meta may be nil; a failing meta source is logged and the collected samples are still served
+func Handler(latest *Latest, meta MetaSource, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		metrics := latest.Snapshot()
+		if meta != nil {
+			metaMetrics, err := meta(r.Context())
+			if err != nil {
+				if logger != nil {
+					logger.Warn("Failed to collect meta-metrics for /metrics", slog.Any("error", err))
+				}
+			} else {
+				metrics = append(metrics, metaMetrics...)
+			}
+		}
+
+		w.Header().Set("Content-Type", ContentType)
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodHead {
+			return
+		}
+		if err := WriteOpenMetrics(w, metrics); err != nil && logger != nil {
+			logger.Debug("Failed to write /metrics response", slog.Any("error", err))
+		}
+	})
+}
@@ -0,0 +1,169 @@
+package exposition
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+func TestWriteOpenMetrics_Format(t *testing.T) {
+	metrics := []*models.Metric{
+		models.NewMetric("cpu.usage_percent", 12.5, "device-001"),
+		models.NewMetric("cpu.core_usage_percent", 30, "device-001").WithTag("core", "1"),
+		models.NewMetric("cpu.core_usage_percent", 20, "device-001").WithTag("core", "0"),
+		models.NewMetric("network.rx_bytes_total", 1024, "device-001").WithTag("interface", "eth0").WithTag("_storage_id", "42"),
+		models.NewStringMetric("system.state", "ok", "device-001"),
+	}
+
+	var buf bytes.Buffer
+	if err := WriteOpenMetrics(&buf, metrics); err != nil {
+		t.Fatalf("WriteOpenMetrics failed: %v", err)
+	}
+
+	expected := `# TYPE cpu_core_usage_percent gauge
+cpu_core_usage_percent{core="0",device_id="device-001"} 20
+cpu_core_usage_percent{core="1",device_id="device-001"} 30
+# TYPE cpu_usage_percent gauge
+cpu_usage_percent{device_id="device-001"} 12.5
+# TYPE network_rx_bytes counter
+network_rx_bytes_total{device_id="device-001",interface="eth0"} 1024
+# EOF
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteOpenMetrics_EscapingAndSpecialValues(t *testing.T) {
+	metrics := []*models.Metric{
+		models.NewMetric("test.gauge", math.NaN(), "").WithTag("path", `C:\dir "x"`+"\n"),
+		models.NewMetric("test.inf", math.Inf(1), ""),
+		models.NewMetric("test.neg_inf", math.Inf(-1), "").WithTag("empty", ""),
+	}
+
+	var buf bytes.Buffer
+	if err := WriteOpenMetrics(&buf, metrics); err != nil {
+		t.Fatalf("WriteOpenMetrics failed: %v", err)
+	}
+	out := buf.String()
+
+	if !strings.Contains(out, `test_gauge{path="C:\\dir \"x\"\n"} NaN`) {
+		t.Errorf("Expected escaped label value and NaN, got:\n%s", out)
+	}
+	if !strings.Contains(out, "test_inf +Inf\n") {
+		t.Errorf("Expected +Inf, got:\n%s", out)
+	}
+	if !strings.Contains(out, "test_neg_inf -Inf\n") {
+		t.Errorf("Expected -Inf without empty labels, got:\n%s", out)
+	}
+}
+
+func TestWriteOpenMetrics_DeclaredKinds(t *testing.T) {
+	metrics := []*models.Metric{
+		// Counter keywords in the name no longer make it a counter
+		models.NewMetric("http.requests_in_flight", 3, "device-001").AsGauge(""),
+		models.NewMetric("network.rx_errors", 2, "device-001").AsCounter(""),
+		models.NewMetric("memory.used", 1000, "device-001").AsGauge("bytes"),
+		models.NewMetric("upload.latency_bucket", 4, "device-001").WithKind(models.KindHistogram).WithUnit("seconds").WithTag("le", "+Inf"),
+		models.NewMetric("upload.latency_count", 4, "device-001").WithKind(models.KindHistogram).WithUnit("seconds"),
+	}
+
+	var buf bytes.Buffer
+	if err := WriteOpenMetrics(&buf, metrics); err != nil {
+		t.Fatalf("WriteOpenMetrics failed: %v", err)
+	}
+
+	expected := `# TYPE http_requests_in_flight gauge
+http_requests_in_flight{device_id="device-001"} 3
+# TYPE memory_used_bytes gauge
+# UNIT memory_used_bytes bytes
+memory_used_bytes{device_id="device-001"} 1000
+# TYPE network_rx_errors counter
+network_rx_errors_total{device_id="device-001"} 2
+# TYPE upload_latency_seconds histogram
+# UNIT upload_latency_seconds seconds
+upload_latency_seconds_bucket{device_id="device-001",le="+Inf"} 4
+upload_latency_seconds_count{device_id="device-001"} 4
+# EOF
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteOpenMetrics_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteOpenMetrics(&buf, nil); err != nil {
+		t.Fatalf("WriteOpenMetrics failed: %v", err)
+	}
+	if buf.String() != "# EOF\n" {
+		t.Errorf("Expected only # EOF, got %q", buf.String())
+	}
+}
+
+func TestHandler_ServesLatestAndMeta(t *testing.T) {
+	latest := NewLatest(0)
+	latest.Observe([]*models.Metric{models.NewMetric("memory.used_bytes", 1000, "device-001")})
+
+	meta := func(ctx context.Context) ([]*models.Metric, error) {
+		return []*models.Metric{models.NewMetric("uploader.upload_failures_total", 3, "device-001")}, nil
+	}
+
+	server := httptest.NewServer(Handler(latest, meta, nil))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != ContentType {
+		t.Errorf("Expected OpenMetrics content type, got %q", ct)
+	}
+
+	var body bytes.Buffer
+	body.ReadFrom(resp.Body)
+	out := body.String()
+	if !strings.Contains(out, `memory_used_bytes{device_id="device-001"} 1000`) {
+		t.Errorf("Expected collected series, got:\n%s", out)
+	}
+	if !strings.Contains(out, `uploader_upload_failures_total{device_id="device-001"} 3`) {
+		t.Errorf("Expected meta-metric, got:\n%s", out)
+	}
+}
+
+func TestHandler_MetaFailureStillServesCollected(t *testing.T) {
+	latest := NewLatest(0)
+	latest.Observe([]*models.Metric{models.NewMetric("memory.used_bytes", 1000, "device-001")})
+
+	meta := func(ctx context.Context) ([]*models.Metric, error) {
+		return nil, errors.New("meta unavailable")
+	}
+
+	rec := httptest.NewRecorder()
+	Handler(latest, meta, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "memory_used_bytes") {
+		t.Errorf("Expected collected series despite meta failure, got:\n%s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	Handler(latest, nil, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", rec.Code)
+	}
+}
@@ -39,6 +39,7 @@ type Checker struct {
 	components map[string]ComponentStatus
 	startTime  time.Time
 	thresholds Thresholds
+	handlers   map[string]http.Handler // Extra endpoints served next to /health
 }
 
 // Thresholds defines health status thresholds
@@ -118,9 +119,18 @@ func NewChecker(thresholds Thresholds) *Checker {
 		components: make(map[string]ComponentStatus),
 		startTime:  time.Now(),
 		thresholds: thresholds,
+		handlers:   make(map[string]http.Handler),
 	}
 }
 
+// Handle registers an extra endpoint (e.g., /metrics) on the health server
+// Must be called before StartHTTPServer
+func (c *Checker) Handle(pattern string, handler http.Handler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[pattern] = handler
+}
+
 // UpdateComponent updates the status of a specific component
 func (c *Checker) UpdateComponent(name string, status ComponentStatus) {
 	c.mu.Lock()
@@ -130,6 +140,28 @@ func (c *Checker) UpdateComponent(name string, status ComponentStatus) {
 	c.components[name] = status
 }
 
+// RemoveComponent drops a component from health reports
+// Used when a config reload stops a collector or removes a destination
+func (c *Checker) RemoveComponent(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.components, name)
+}
+
+// SetThresholds replaces the health thresholds (e.g., after the upload interval is reloaded)
+func (c *Checker) SetThresholds(thresholds Thresholds) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.thresholds = thresholds
+}
+
+// getThresholds returns the current thresholds under the read lock
+func (c *Checker) getThresholds() Thresholds {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.thresholds
+}
+
 // UpdateCollectorStatus updates the health status of a collector
 func (c *Checker) UpdateCollectorStatus(collectorName string, err error, metricsCollected int) {
 	status := ComponentStatus{
@@ -152,6 +184,110 @@ func (c *Checker) UpdateCollectorStatus(collectorName string, err error, metrics
 
 // UpdateUploaderStatus updates the health status of the uploader
 func (c *Checker) UpdateUploaderStatus(lastUploadTime time.Time, lastUploadErr error, pendingCount int64) {
+	c.UpdateComponent("uploader", c.uploaderStatus(lastUploadTime, lastUploadErr, pendingCount))
+}
+
+// UpdateDestinationStatus updates the health status of a single upload destination
+// Each destination is reported as its own "uploader.<destination>" component with its own pending count
+func (c *Checker) UpdateDestinationStatus(destination string, lastUploadTime time.Time, lastUploadErr error, pendingCount int64) {
+	status := c.uploaderStatus(lastUploadTime, lastUploadErr, pendingCount)
+	status.Details["destination"] = destination
+	c.UpdateComponent("uploader."+destination, status)
+}
+
+// BreakerStatus describes the circuit breaker guarding an uploader
+type BreakerStatus struct {
+	State     string    // closed, open or half_open
+	Failures  int       // Failed upload cycles in a row
+	NextProbe time.Time // When an open breaker lets the next probe through
+}
+
+// SetBreakerStatus adds circuit breaker details to an uploader component
+// Call after UpdateUploaderStatus or UpdateDestinationStatus. An open breaker means uploads are
+// paused, so the component is reported as error whatever the upload timing says.
+func (c *Checker) SetBreakerStatus(component string, breaker BreakerStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status, ok := c.components[component]
+	if !ok {
+		return
+	}
+	details := make(map[string]interface{}, len(status.Details)+3)
+	for k, v := range status.Details {
+		details[k] = v
+	}
+	details["breaker_state"] = breaker.State
+	details["breaker_failures"] = breaker.Failures
+	if !breaker.NextProbe.IsZero() {
+		details["breaker_next_probe_time"] = breaker.NextProbe.Format(time.RFC3339)
+	}
+	status.Details = details
+
+	if breaker.State == "open" {
+		message := "offline: circuit breaker open"
+		if status.Message != "" {
+			message += " (" + status.Message + ")"
+		}
+		status.Status = StatusError
+		status.Message = message
+	}
+	c.components[component] = status
+}
+
+// BandwidthStatus describes the upload policy of the current network interface and its usage
+type BandwidthStatus struct {
+	Interface        string
+	Policy           string // unmetered, metered or priority
+	MinPriority      string // Lowest priority class uploaded
+	Paused           bool   // A budget is used up
+	Reason           string // Why uploads are paused
+	TodayBytes       int64  // Sent today over metered interfaces
+	MonthBytes       int64  // Sent this month over metered interfaces
+	DailyBudget      int64  // 0 = unlimited
+	MonthlyBudget    int64  // 0 = unlimited
+	TodayByInterface map[string]int64
+	MonthByInterface map[string]int64
+}
+
+// UpdateBandwidthStatus updates the "bandwidth" component
+// Paused uploads are degraded rather than error: data is kept and sent once the budget resets.
+func (c *Checker) UpdateBandwidthStatus(bw BandwidthStatus) {
+	status := ComponentStatus{
+		Status:    StatusOK,
+		Timestamp: time.Now(),
+		Details: map[string]interface{}{
+			"interface":          bw.Interface,
+			"policy":             bw.Policy,
+			"today_bytes":        bw.TodayBytes,
+			"month_bytes":        bw.MonthBytes,
+			"today_by_interface": bw.TodayByInterface,
+			"month_by_interface": bw.MonthByInterface,
+		},
+	}
+	if bw.DailyBudget > 0 {
+		status.Details["daily_budget_bytes"] = bw.DailyBudget
+	}
+	if bw.MonthlyBudget > 0 {
+		status.Details["monthly_budget_bytes"] = bw.MonthlyBudget
+	}
+
+	switch {
+	case bw.Paused:
+		status.Status = StatusDegraded
+		status.Message = "uploads paused: " + bw.Reason
+	case bw.Policy == "priority":
+		status.Details["min_priority"] = bw.MinPriority
+		status.Message = "uploading " + bw.MinPriority + " and higher priority data over " + bw.Interface
+	default:
+		status.Message = "uploading over " + bw.Interface
+	}
+
+	c.UpdateComponent("bandwidth", status)
+}
+
+// uploaderStatus derives an uploader component status from upload timing and backlog
+func (c *Checker) uploaderStatus(lastUploadTime time.Time, lastUploadErr error, pendingCount int64) ComponentStatus {
 	status := ComponentStatus{
 		Timestamp: time.Now(),
 		Details: map[string]interface{}{
@@ -161,25 +297,26 @@ func (c *Checker) UpdateUploaderStatus(lastUploadTime time.Time, lastUploadErr e
 	}
 
 	timeSinceUpload := time.Since(lastUploadTime).Seconds()
+	thresholds := c.getThresholds()
 
 	// Calculate status based on thresholds
 	if lastUploadErr != nil {
 		status.Status = StatusError
 		status.Message = lastUploadErr.Error()
-	} else if timeSinceUpload > float64(c.thresholds.UploadErrorInterval) && pendingCount > c.thresholds.PendingErrorLimit {
+	} else if timeSinceUpload > float64(thresholds.UploadErrorInterval) && pendingCount > thresholds.PendingErrorLimit {
 		status.Status = StatusError
 		status.Message = "no successful upload in over 10 minutes and high pending count"
-	} else if timeSinceUpload > float64(c.thresholds.UploadDegradedInterval) {
+	} else if timeSinceUpload > float64(thresholds.UploadDegradedInterval) {
 		status.Status = StatusDegraded
 		status.Message = "no upload within 10× interval threshold"
-	} else if timeSinceUpload > float64(c.thresholds.UploadOKInterval) {
+	} else if timeSinceUpload > float64(thresholds.UploadOKInterval) {
 		// Degraded when time exceeds 2× interval (but less than 10× handled above)
 		status.Status = StatusDegraded
 		status.Message = "no upload within 2× interval threshold"
-	} else if pendingCount >= c.thresholds.PendingDegradedLimit {
+	} else if pendingCount >= thresholds.PendingDegradedLimit {
 		status.Status = StatusDegraded
 		status.Message = "high pending metric count"
-	} else if pendingCount >= c.thresholds.PendingOKLimit {
+	} else if pendingCount >= thresholds.PendingOKLimit {
 		status.Status = StatusDegraded
 		status.Message = "elevated pending metric count"
 	} else {
@@ -189,11 +326,29 @@ func (c *Checker) UpdateUploaderStatus(lastUploadTime time.Time, lastUploadErr e
 
 	status.Details["time_since_upload_seconds"] = int64(timeSinceUpload)
 
-	c.UpdateComponent("uploader", status)
+	return status
 }
 
 // UpdateStorageStatus updates the health status of storage
 func (c *Checker) UpdateStorageStatus(dbSize int64, walSize int64, pendingCount int64) {
+	c.UpdateComponent("storage", storageStatus(dbSize, walSize, pendingCount))
+}
+
+// UpdateStorageStatusByPriority updates the health status of storage with pending counts per priority class
+// pending_count is the sum of the classes.
+func (c *Checker) UpdateStorageStatusByPriority(dbSize int64, walSize int64, pendingByPriority map[string]int64) {
+	var pendingCount int64
+	byPriority := make(map[string]int64, len(pendingByPriority))
+	for class, count := range pendingByPriority {
+		pendingCount += count
+		byPriority[class] = count
+	}
+	status := storageStatus(dbSize, walSize, pendingCount)
+	status.Details["pending_by_priority"] = byPriority
+	c.UpdateComponent("storage", status)
+}
+
+func storageStatus(dbSize int64, walSize int64, pendingCount int64) ComponentStatus {
 	status := ComponentStatus{
 		Status:    StatusOK,
 		Message:   "storage operational",
@@ -210,8 +365,7 @@ func (c *Checker) UpdateStorageStatus(dbSize int64, walSize int64, pendingCount
 		status.Status = StatusDegraded
 		status.Message = "WAL size exceeds threshold"
 	}
-
-	c.UpdateComponent("storage", status)
+	return status
 }
 
 // UpdateClockSkewStatus updates the health status of time synchronization
@@ -224,7 +378,7 @@ func (c *Checker) UpdateClockSkewStatus(skewMs int64, err error) {
 	}
 
 	// Get threshold from config (default: 2000ms)
-	threshold := c.thresholds.ClockSkewThresholdMs
+	threshold := c.getThresholds().ClockSkewThresholdMs
 	if threshold == 0 {
 		threshold = 2000 // Fallback to default if not set
 	}
@@ -243,6 +397,28 @@ func (c *Checker) UpdateClockSkewStatus(skewMs int64, err error) {
 	c.UpdateComponent("time", status)
 }
 
+// UpdateConfigStatus reports the outcome of the last configuration reload
+// A failed reload is degraded rather than error: the daemon keeps running on the previous config
+func (c *Checker) UpdateConfigStatus(path string, reloadErr error, reloadedAt time.Time) {
+	status := ComponentStatus{
+		Timestamp: time.Now(),
+		Details: map[string]interface{}{
+			"path":             path,
+			"last_reload_time": reloadedAt.Unix(),
+		},
+	}
+
+	if reloadErr != nil {
+		status.Status = StatusDegraded
+		status.Message = "reload failed, keeping previous config: " + reloadErr.Error()
+	} else {
+		status.Status = StatusOK
+		status.Message = "config loaded"
+	}
+
+	c.UpdateComponent("config", status)
+}
+
 // GetReport generates a complete health report
 func (c *Checker) GetReport() HealthReport {
 	c.mu.RLock()
@@ -385,6 +561,12 @@ func (c *Checker) StartHTTPServer(ctx context.Context, addr string) error {
 	mux.HandleFunc("/health/live", c.LivenessHandler())
 	mux.HandleFunc("/health/ready", c.ReadinessHandler())
 
+	c.mu.RLock()
+	for pattern, handler := range c.handlers {
+		mux.Handle(pattern, handler)
+	}
+	c.mu.RUnlock()
+
 	server := &http.Server{
 		Addr:    addr,
 		Handler: mux,
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -200,6 +201,115 @@ func TestUpdateUploaderStatus(t *testing.T) {
 	}
 }
 
+func TestUpdateDestinationStatus(t *testing.T) {
+	checker := NewChecker(DefaultThresholds())
+	now := time.Now()
+
+	checker.UpdateDestinationStatus("primary", now.Add(-10*time.Second), nil, 100)
+	checker.UpdateDestinationStatus("archive", now.Add(-10*time.Second), errors.New("connection refused"), 7000)
+
+	report := checker.GetReport()
+
+	primary, ok := report.Components["uploader.primary"]
+	if !ok {
+		t.Fatal("uploader.primary component not found")
+	}
+	if primary.Status != StatusOK {
+		t.Errorf("Expected primary OK, got %s (message: %s)", primary.Status, primary.Message)
+	}
+	if primary.Details["pending_count"] != int64(100) {
+		t.Errorf("Expected primary pending_count=100, got %v", primary.Details["pending_count"])
+	}
+	if primary.Details["destination"] != "primary" {
+		t.Errorf("Expected destination detail 'primary', got %v", primary.Details["destination"])
+	}
+
+	archive, ok := report.Components["uploader.archive"]
+	if !ok {
+		t.Fatal("uploader.archive component not found")
+	}
+	if archive.Status != StatusError {
+		t.Errorf("Expected archive error, got %s", archive.Status)
+	}
+	if archive.Details["pending_count"] != int64(7000) {
+		t.Errorf("Expected archive pending_count=7000, got %v", archive.Details["pending_count"])
+	}
+
+	if _, ok := report.Components["uploader"]; ok {
+		t.Error("Per-destination updates should not create the single uploader component")
+	}
+
+	// A failing destination fails the overall status like the single uploader does
+	if report.Status != StatusError {
+		t.Errorf("Expected overall error with a failing destination, got %s", report.Status)
+	}
+}
+func TestUpdateConfigStatus(t *testing.T) {
+	checker := NewChecker(DefaultThresholds())
+	reloadedAt := time.Now()
+
+	checker.UpdateConfigStatus("/etc/tidewatch/config.yaml", nil, reloadedAt)
+	status := checker.GetReport().Components["config"]
+	if status.Status != StatusOK {
+		t.Errorf("Expected config OK, got %s", status.Status)
+	}
+	if status.Details["path"] != "/etc/tidewatch/config.yaml" {
+		t.Errorf("Expected path detail, got %v", status.Details["path"])
+	}
+	if status.Details["last_reload_time"] != reloadedAt.Unix() {
+		t.Errorf("Expected last_reload_time %d, got %v", reloadedAt.Unix(), status.Details["last_reload_time"])
+	}
+
+	// A failed reload degrades the service but does not fail it
+	checker.UpdateConfigStatus("/etc/tidewatch/config.yaml", errors.New("invalid interval"), reloadedAt)
+	report := checker.GetReport()
+	status = report.Components["config"]
+	if status.Status != StatusDegraded {
+		t.Errorf("Expected config degraded after failed reload, got %s", status.Status)
+	}
+	if !strings.Contains(status.Message, "invalid interval") {
+		t.Errorf("Expected message to carry the reload error, got %q", status.Message)
+	}
+	if report.Status != StatusDegraded {
+		t.Errorf("Expected overall degraded, got %s", report.Status)
+	}
+}
+
+func TestRemoveComponent(t *testing.T) {
+	checker := NewChecker(DefaultThresholds())
+	checker.UpdateCollectorStatus("cpu.usage", errors.New("failed"), 0)
+	checker.UpdateCollectorStatus("memory.usage", nil, 5)
+
+	checker.RemoveComponent("collector.cpu.usage")
+	checker.RemoveComponent("collector.missing")
+
+	report := checker.GetReport()
+	if _, ok := report.Components["collector.cpu.usage"]; ok {
+		t.Error("Expected removed component to be gone")
+	}
+	if report.Status != StatusOK {
+		t.Errorf("Expected removed failing collector to stop degrading status, got %s", report.Status)
+	}
+}
+
+func TestSetThresholds(t *testing.T) {
+	checker := NewChecker(ThresholdsFromUploadInterval(30 * time.Second))
+	lastUpload := time.Now().Add(-90 * time.Second)
+
+	// 90s without upload is degraded at a 30s interval (OK threshold 60s)
+	checker.UpdateUploaderStatus(lastUpload, nil, 0)
+	if status := checker.GetReport().Components["uploader"].Status; status != StatusDegraded {
+		t.Errorf("Expected degraded at 30s interval, got %s", status)
+	}
+
+	// After reloading a 60s interval (OK threshold 120s) the same upload age is OK
+	checker.SetThresholds(ThresholdsFromUploadInterval(60 * time.Second))
+	checker.UpdateUploaderStatus(lastUpload, nil, 0)
+	if status := checker.GetReport().Components["uploader"].Status; status != StatusOK {
+		t.Errorf("Expected OK at 60s interval, got %s", status)
+	}
+}
+
 func TestUpdateStorageStatus(t *testing.T) {
 	checker := NewChecker(DefaultThresholds())
 
@@ -252,6 +362,20 @@ func TestUpdateStorageStatus(t *testing.T) {
 	}
 }
 
+func TestUpdateStorageStatusByPriority(t *testing.T) {
+	checker := NewChecker(DefaultThresholds())
+	checker.UpdateStorageStatusByPriority(1024, 1024, map[string]int64{"P0": 12, "P3": 4000})
+
+	component := checker.GetReport().Components["storage"]
+	if component.Details["pending_count"] != int64(4012) {
+		t.Errorf("Expected pending_count=4012, got %v", component.Details["pending_count"])
+	}
+	byPriority, ok := component.Details["pending_by_priority"].(map[string]int64)
+	if !ok || byPriority["P0"] != 12 || byPriority["P3"] != 4000 {
+		t.Errorf("Unexpected pending_by_priority %v", component.Details["pending_by_priority"])
+	}
+}
+
 func TestUpdateClockSkewStatus(t *testing.T) {
 	checker := NewChecker(DefaultThresholds())
 
@@ -696,6 +820,55 @@ func TestStartHTTPServer(t *testing.T) {
 	}
 }
 
+func TestStartHTTPServer_ExtraHandlers(t *testing.T) {
+	checker := NewChecker(DefaultThresholds())
+	checker.Handle("/metrics", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("# EOF\n"))
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- checker.StartHTTPServer(ctx, ":19101")
+	}()
+
+	// Give server time to start
+	time.Sleep(100 * time.Millisecond)
+
+	resp, err := http.Get("http://localhost:19101/metrics")
+	if err != nil {
+		t.Fatalf("Failed to connect to metrics endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "# EOF\n" {
+		t.Errorf("Expected registered handler to serve /metrics, got %d %q", resp.StatusCode, body)
+	}
+
+	// Built-in endpoints are still served
+	resp, err = http.Get("http://localhost:19101/health/live")
+	if err != nil {
+		t.Fatalf("Failed to connect to liveness endpoint: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected liveness status 200, got %d", resp.StatusCode)
+	}
+
+	cancel()
+	select {
+	case err := <-errChan:
+		if err != nil {
+			t.Errorf("Server returned unexpected error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Server did not stop within timeout")
+	}
+}
+
 func TestConcurrentAccess(t *testing.T) {
 	checker := NewChecker(DefaultThresholds())
 
@@ -1156,3 +1329,76 @@ func containsHelper(s, substr string) bool {
 	}
 	return false
 }
+
+func TestSetBreakerStatus(t *testing.T) {
+	checker := NewChecker(DefaultThresholds())
+
+	// Unknown components are ignored
+	checker.SetBreakerStatus("uploader", BreakerStatus{State: "open"})
+	if _, ok := checker.GetReport().Components["uploader"]; ok {
+		t.Fatal("Expected no component to be created")
+	}
+
+	checker.UpdateUploaderStatus(time.Now(), nil, 10)
+	checker.SetBreakerStatus("uploader", BreakerStatus{State: "closed"})
+	status := checker.GetReport().Components["uploader"]
+	if status.Status != StatusOK || status.Details["breaker_state"] != "closed" || status.Details["pending_count"] != int64(10) {
+		t.Errorf("Expected a closed breaker added to the uploader details, got %+v", status)
+	}
+	if _, ok := status.Details["breaker_next_probe_time"]; ok {
+		t.Error("Expected no next probe time while closed")
+	}
+
+	nextProbe := time.Now().Add(time.Minute)
+	checker.UpdateDestinationStatus("archive", time.Now(), errors.New("connection refused"), 500)
+	checker.SetBreakerStatus("uploader.archive", BreakerStatus{State: "open", Failures: 3, NextProbe: nextProbe})
+	status = checker.GetReport().Components["uploader.archive"]
+	if status.Status != StatusError || status.Message != "offline: circuit breaker open (connection refused)" {
+		t.Errorf("Expected an open breaker reported as error, got %s: %s", status.Status, status.Message)
+	}
+	if status.Details["breaker_failures"] != 3 || status.Details["breaker_next_probe_time"] != nextProbe.Format(time.RFC3339) {
+		t.Errorf("Unexpected breaker details %+v", status.Details)
+	}
+	if status.Details["destination"] != "archive" {
+		t.Errorf("Expected the destination details kept, got %+v", status.Details)
+	}
+}
+
+func TestUpdateBandwidthStatus(t *testing.T) {
+	checker := NewChecker(DefaultThresholds())
+
+	checker.UpdateBandwidthStatus(BandwidthStatus{
+		Interface:        "wwan0",
+		Policy:           "priority",
+		MinPriority:      "P1",
+		TodayBytes:       1000,
+		MonthBytes:       30000,
+		DailyBudget:      20 * 1024 * 1024,
+		TodayByInterface: map[string]int64{"wwan0": 1000},
+		MonthByInterface: map[string]int64{"wwan0": 30000, "eth0": 90000},
+	})
+	status := checker.GetReport().Components["bandwidth"]
+	if status.Status != StatusOK || status.Message != "uploading P1 and higher priority data over wwan0" {
+		t.Errorf("Expected priority-only uploads reported as ok, got %s: %s", status.Status, status.Message)
+	}
+	if status.Details["daily_budget_bytes"] != int64(20*1024*1024) || status.Details["month_bytes"] != int64(30000) {
+		t.Errorf("Unexpected bandwidth details %+v", status.Details)
+	}
+	if _, ok := status.Details["monthly_budget_bytes"]; ok {
+		t.Error("Expected no monthly budget when unlimited")
+	}
+
+	checker.UpdateBandwidthStatus(BandwidthStatus{
+		Interface: "wwan0",
+		Policy:    "metered",
+		Paused:    true,
+		Reason:    "daily budget exhausted (20971520 of 20971520 bytes)",
+	})
+	status = checker.GetReport().Components["bandwidth"]
+	if status.Status != StatusDegraded || status.Message != "uploads paused: daily budget exhausted (20971520 of 20971520 bytes)" {
+		t.Errorf("Expected paused uploads reported as degraded, got %s: %s", status.Status, status.Message)
+	}
+	if report := checker.GetReport(); report.Status != StatusDegraded {
+		t.Errorf("Expected a paused budget to degrade overall health, got %s", report.Status)
+	}
+}
@@ -0,0 +1,206 @@
+package identity
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Derives a stable device ID from the system, so one packaged config can be deployed to a whole fleet
+
+// Sources
+const (
+	SourceMachineID = "machine-id" // systemd machine ID (/etc/machine-id)
+	SourceHostname  = "hostname"   // Kernel hostname
+	SourceMAC       = "mac"        // MAC of the primary network interface
+	SourceSerial    = "serial"     // SoC serial from /proc/cpuinfo or the device tree
+)
+
+// Sources lists the valid device.id_source values
+var Sources = []string{SourceMachineID, SourceHostname, SourceMAC, SourceSerial}
+
+// ValidSource reports whether source is a known ID source
+func ValidSource(source string) bool {
+	for _, s := range Sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolver reads ID sources; the zero value reads the running system
+type Resolver struct {
+	Root       string                          // Filesystem root (default: /)
+	Hostname   func() (string, error)          // Default: os.Hostname
+	Interfaces func() ([]net.Interface, error) // Default: net.Interfaces
+}
+
+// Resolve returns the device ID from source on the running system
+func Resolve(source string) (string, error) {
+	return Resolver{}.Resolve(source)
+}
+
+// Resolve returns the device ID from source, lowercased and trimmed
+func (r Resolver) Resolve(source string) (string, error) {
+	var id string
+	var err error
+	switch source {
+	case SourceMachineID:
+		id, err = r.machineID()
+	case SourceHostname:
+		id, err = r.hostname()
+	case SourceMAC:
+		id, err = r.primaryMAC()
+	case SourceSerial:
+		id, err = r.serial()
+	default:
+		return "", fmt.Errorf("unknown id source %q (valid: %s)", source, strings.Join(Sources, ", "))
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", source, err)
+	}
+	return strings.ToLower(strings.TrimSpace(id)), nil
+}
+
+// machineID reads the systemd machine ID, falling back to the D-Bus copy on older images
+func (r Resolver) machineID() (string, error) {
+	var lastErr error
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		data, err := os.ReadFile(r.path(path))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		id := strings.TrimSpace(string(data))
+		// systemd writes "uninitialized" until first boot completes
+		if id == "" || id == "uninitialized" {
+			lastErr = fmt.Errorf("%s is not initialized", path)
+			continue
+		}
+		return id, nil
+	}
+	return "", lastErr
+}
+
+func (r Resolver) hostname() (string, error) {
+	hostname := r.Hostname
+	if hostname == nil {
+		hostname = os.Hostname
+	}
+	name, err := hostname()
+	if err != nil {
+		return "", err
+	}
+	// Image defaults are the same on every device
+	if name == "" || name == "localhost" {
+		return "", fmt.Errorf("hostname %q is not unique", name)
+	}
+	return name, nil
+}
+
+// primaryMAC returns the MAC of the interface carrying the default route
+// Without a default route (e.g. modem not up yet) it falls back to the first physical interface by name,
+// so the ID does not change with connectivity.
+func (r Resolver) primaryMAC() (string, error) {
+	interfaces := r.Interfaces
+	if interfaces == nil {
+		interfaces = net.Interfaces
+	}
+	ifaces, err := interfaces()
+	if err != nil {
+		return "", err
+	}
+
+	byName := make(map[string]net.Interface, len(ifaces))
+	var physical []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) == 0 {
+			continue
+		}
+		byName[iface.Name] = iface
+		if _, err := os.Stat(r.path(filepath.Join("/sys/class/net", iface.Name, "device"))); err == nil {
+			physical = append(physical, iface.Name)
+		}
+	}
+
+	if name := r.defaultRouteInterface(); name != "" {
+		if iface, ok := byName[name]; ok {
+			return formatMAC(iface.HardwareAddr), nil
+		}
+	}
+	if len(physical) == 0 {
+		return "", errors.New("no physical network interface with a MAC address")
+	}
+	sort.Strings(physical)
+	return formatMAC(byName[physical[0]].HardwareAddr), nil
+}
+
+// defaultRouteInterface returns the interface of the IPv4 default route, or "" if there is none
+func (r Resolver) defaultRouteInterface() string {
+	f, err := os.Open(r.path("/proc/net/route"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // Header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 1 && fields[1] == "00000000" {
+			return fields[0]
+		}
+	}
+	return ""
+}
+
+// serial reads the SoC serial from /proc/cpuinfo (Raspberry Pi) or the device tree (most other ARM boards)
+func (r Resolver) serial() (string, error) {
+	if data, err := os.ReadFile(r.path("/proc/cpuinfo")); err == nil {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			key, value, ok := strings.Cut(scanner.Text(), ":")
+			if ok && strings.TrimSpace(key) == "Serial" {
+				if serial := strings.TrimSpace(value); validSerial(serial) {
+					return serial, nil
+				}
+			}
+		}
+	}
+
+	for _, path := range []string{"/proc/device-tree/serial-number", "/sys/firmware/devicetree/base/serial-number"} {
+		data, err := os.ReadFile(r.path(path))
+		if err != nil {
+			continue
+		}
+		// Device tree strings are NUL-terminated
+		if serial := strings.TrimSpace(strings.TrimRight(string(data), "\x00")); validSerial(serial) {
+			return serial, nil
+		}
+	}
+	return "", errors.New("no SoC serial in /proc/cpuinfo or the device tree")
+}
+
+// validSerial rejects the all-zero serial some boards and VMs report
+func validSerial(serial string) bool {
+	return strings.Trim(serial, "0") != ""
+}
+
+// formatMAC renders a MAC as 12 lowercase hex digits
+func formatMAC(mac net.HardwareAddr) string {
+	return strings.ReplaceAll(mac.String(), ":", "")
+}
+
+func (r Resolver) path(p string) string {
+	if r.Root == "" {
+		return p
+	}
+	return filepath.Join(r.Root, p)
+}
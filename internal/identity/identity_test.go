@@ -0,0 +1,121 @@
+package identity
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile creates a file under root, including its directories
+func writeFile(t *testing.T, root, path, content string) {
+	t.Helper()
+	full := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func mustMAC(t *testing.T, s string) net.HardwareAddr {
+	t.Helper()
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		t.Fatalf("Invalid MAC %s: %v", s, err)
+	}
+	return mac
+}
+
+func TestResolve_MachineID(t *testing.T) {
+	root := t.TempDir()
+	r := Resolver{Root: root}
+
+	if _, err := r.Resolve(SourceMachineID); err == nil {
+		t.Error("Expected an error without a machine ID")
+	}
+
+	// Falls back to the D-Bus copy while /etc/machine-id is not initialized
+	writeFile(t, root, "/etc/machine-id", "uninitialized\n")
+	writeFile(t, root, "/var/lib/dbus/machine-id", "0123456789ABCDEF0123456789abcdef\n")
+	id, err := r.Resolve(SourceMachineID)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if id != "0123456789abcdef0123456789abcdef" {
+		t.Errorf("Expected the lowercased D-Bus machine ID, got %q", id)
+	}
+}
+
+func TestResolve_Hostname(t *testing.T) {
+	r := Resolver{Hostname: func() (string, error) { return "Van-03\n", nil }}
+	if id, err := r.Resolve(SourceHostname); err != nil || id != "van-03" {
+		t.Errorf("Expected van-03, got %q (err: %v)", id, err)
+	}
+
+	r.Hostname = func() (string, error) { return "localhost", nil }
+	if _, err := r.Resolve(SourceHostname); err == nil {
+		t.Error("Expected an image default hostname to be rejected")
+	}
+}
+
+func TestResolve_MAC(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "/sys/class/net/eth0/device/uevent", "")
+	writeFile(t, root, "/sys/class/net/wwan0/device/uevent", "")
+
+	ifaces := []net.Interface{
+		{Name: "lo", Flags: net.FlagLoopback},
+		{Name: "docker0", HardwareAddr: mustMAC(t, "02:42:ac:11:00:01")},
+		{Name: "wwan0", HardwareAddr: mustMAC(t, "0e:aa:bb:cc:dd:ee")},
+		{Name: "eth0", HardwareAddr: mustMAC(t, "D8:3A:DD:12:34:56")},
+	}
+	r := Resolver{Root: root, Interfaces: func() ([]net.Interface, error) { return ifaces, nil }}
+
+	// No default route: first physical interface by name, skipping the bridge
+	id, err := r.Resolve(SourceMAC)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if id != "d83add123456" {
+		t.Errorf("Expected eth0's MAC, got %q", id)
+	}
+
+	// The default route interface wins
+	writeFile(t, root, "/proc/net/route",
+		"Iface\tDestination\tGateway\tFlags\tRefCnt\tUse\tMetric\tMask\n"+
+			"wwan0\t0000A8C0\t00000000\t0001\t0\t0\t0\t00FFFFFF\n"+
+			"wwan0\t00000000\t0100A8C0\t0003\t0\t0\t0\t00000000\n")
+	if id, _ := r.Resolve(SourceMAC); id != "0eaabbccddee" {
+		t.Errorf("Expected wwan0's MAC, got %q", id)
+	}
+}
+
+func TestResolve_Serial(t *testing.T) {
+	root := t.TempDir()
+	r := Resolver{Root: root}
+
+	// An all-zero serial in /proc/cpuinfo falls through to the device tree
+	writeFile(t, root, "/proc/cpuinfo", "processor\t: 0\nHardware\t: BCM2835\nSerial\t\t: 0000000000000000\n")
+	writeFile(t, root, "/proc/device-tree/serial-number", "a1b2c3d4e5f6\x00")
+	if id, err := r.Resolve(SourceSerial); err != nil || id != "a1b2c3d4e5f6" {
+		t.Errorf("Expected the device tree serial, got %q (err: %v)", id, err)
+	}
+
+	writeFile(t, root, "/proc/cpuinfo", "processor\t: 0\nSerial\t\t: 10000000ABCDEF01\n")
+	if id, err := r.Resolve(SourceSerial); err != nil || id != "10000000abcdef01" {
+		t.Errorf("Expected the cpuinfo serial, got %q (err: %v)", id, err)
+	}
+}
+
+func TestResolve_UnknownSource(t *testing.T) {
+	_, err := Resolver{}.Resolve("uuid")
+	if err == nil || !strings.Contains(err.Error(), "unknown id source") {
+		t.Errorf("Expected an unknown source error, got %v", err)
+	}
+	if ValidSource("uuid") || !ValidSource(SourceSerial) {
+		t.Error("ValidSource disagrees with Sources")
+	}
+}
@@ -0,0 +1,369 @@
+// Package ingest accepts metrics pushed over HTTP by other processes on the device and writes them
+// to storage, so they are buffered offline and uploaded like collected metrics. It mirrors the
+// VictoriaMetrics import paths, so clients already pointed at VictoriaMetrics can push unchanged.
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/collector"
+	"github.com/taniwha3/tidewatch/internal/models"
+	"github.com/taniwha3/tidewatch/internal/storage"
+	"github.com/taniwha3/tidewatch/internal/uploader"
+)
+
+// Paths served by the handler
+const (
+	PathPush             = "/api/v1/push"              // JSON: one metric object or an array of them
+	PathImport           = "/api/v1/import"            // VictoriaMetrics JSONL
+	PathImportPrometheus = "/api/v1/import/prometheus" // Prometheus text format
+)
+
+// Paths lists every path the handler serves
+var Paths = []string{PathPush, PathImport, PathImportPrometheus}
+
+const (
+	// DefaultMaxMetrics caps the metrics accepted per request
+	DefaultMaxMetrics = 10000
+
+	// maxBodyBytes caps a request body
+	maxBodyBytes = 8 << 20
+)
+
+// Config configures a Handler
+type Config struct {
+	DeviceID   string          // Pushed metrics always belong to this device
+	AuthToken  string          // Bearer token required on every request; empty = no auth
+	MaxMetrics int             // Default: 10000
+	Priority   models.Priority // Upload class of pushed metrics
+	Logger     *slog.Logger
+}
+
+// Handler validates pushed metrics and writes each request as one batch
+// A request is accepted or rejected as a whole: any invalid metric fails it with 400 and the
+// position of the problem, so clients never have to guess what was stored.
+type Handler struct {
+	deviceID   string
+	authToken  string
+	maxMetrics int
+	priority   models.Priority
+	writer     storage.BatchWriter
+	logger     *slog.Logger
+	now        func() time.Time
+}
+
+// NewHandler creates a handler that writes pushed metrics to writer
+func NewHandler(cfg Config, writer storage.BatchWriter) *Handler {
+	h := &Handler{
+		deviceID:   cfg.DeviceID,
+		authToken:  cfg.AuthToken,
+		maxMetrics: cfg.MaxMetrics,
+		priority:   cfg.Priority,
+		writer:     writer,
+		logger:     cfg.Logger,
+		now:        time.Now,
+	}
+	if h.maxMetrics <= 0 {
+		h.maxMetrics = DefaultMaxMetrics
+	}
+	if h.logger == nil {
+		h.logger = slog.Default()
+	}
+	return h
+}
+
+// ServeHTTP handles a push; successful requests get 204 No Content like VictoriaMetrics
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodyBytes+1))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxBodyBytes {
+		http.Error(w, fmt.Sprintf("body exceeds %d bytes", maxBodyBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	now := h.now()
+	var metrics []*models.Metric
+	switch r.URL.Path {
+	case PathPush:
+		metrics, err = parseJSON(body, now)
+	case PathImport:
+		metrics, err = parseJSONL(body)
+	case PathImportPrometheus:
+		metrics, err = collector.ParseTextfile(string(body), h.deviceID, now)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err == nil {
+		err = h.validate(metrics)
+	}
+	if err != nil {
+		h.logger.Debug("Rejected pushed metrics", slog.String("path", r.URL.Path), slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, m := range metrics {
+		m.DeviceID = h.deviceID
+		m.Priority = h.priority
+		delete(m.Tags, "device_id")
+	}
+	if err := h.writer.StoreBatch(r.Context(), metrics); err != nil {
+		h.logger.Error("Failed to store pushed metrics",
+			slog.String("path", r.URL.Path),
+			slog.Int("count", len(metrics)),
+			slog.Any("error", err),
+		)
+		http.Error(w, "failed to store metrics", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorized checks the bearer token, if one is configured
+func (h *Handler) authorized(r *http.Request) bool {
+	if h.authToken == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(h.authToken)) == 1
+}
+
+// validate checks the request size and the names, values, units and tags of every metric
+// Prometheus text samples that are NaN or infinite never get here: ParseTextfile drops them.
+func (h *Handler) validate(metrics []*models.Metric) error {
+	if len(metrics) == 0 {
+		return fmt.Errorf("no metrics in request")
+	}
+	if len(metrics) > h.maxMetrics {
+		return fmt.Errorf("too many metrics (%d, limit %d)", len(metrics), h.maxMetrics)
+	}
+	for i, m := range metrics {
+		if !validName(m.Name, true) {
+			return fmt.Errorf("metric %d: invalid name %q", i, m.Name)
+		}
+		if m.ValueType == models.ValueTypeNumeric && (math.IsNaN(m.Value) || math.IsInf(m.Value, 0)) {
+			return fmt.Errorf("metric %d (%s): value must be finite, got %v", i, m.Name, m.Value)
+		}
+		if m.Unit != "" && !validName(m.Unit, false) {
+			return fmt.Errorf("metric %d (%s): invalid unit %q", i, m.Name, m.Unit)
+		}
+		for key := range m.Tags {
+			if !validName(key, false) || strings.HasPrefix(key, "_") {
+				return fmt.Errorf("metric %d (%s): invalid tag %q", i, m.Name, key)
+			}
+		}
+	}
+	return nil
+}
+
+// validName reports whether s is a metric name (dots allowed) or a tag name
+func validName(s string, dots bool) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		case r >= '0' && r <= '9', dots && r == '.':
+			if i == 0 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// pushMetric is one metric of a JSON push
+type pushMetric struct {
+	Name        string            `json:"name"`
+	Value       json.RawMessage   `json:"value"`        // Number, or string for a string metric
+	TimestampMs int64             `json:"timestamp_ms"` // Default: time of the request
+	Tags        map[string]string `json:"tags"`
+	Kind        string            `json:"kind"` // gauge (default) or counter
+	Unit        string            `json:"unit"`
+}
+
+// parseJSON parses a JSON push: one metric object or an array of them
+func parseJSON(body []byte, now time.Time) ([]*models.Metric, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] != '[' {
+		body = append(append([]byte("["), body...), ']')
+	}
+
+	var pushed []pushMetric
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&pushed); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	metrics := make([]*models.Metric, 0, len(pushed))
+	for i, p := range pushed {
+		m := &models.Metric{
+			Name:        p.Name,
+			TimestampMs: p.TimestampMs,
+			Tags:        p.Tags,
+			Unit:        p.Unit,
+		}
+		if m.TimestampMs == 0 {
+			m.TimestampMs = now.UnixMilli()
+		}
+		if m.TimestampMs < 0 {
+			return nil, fmt.Errorf("metric %d (%s): invalid timestamp_ms %d", i, p.Name, p.TimestampMs)
+		}
+
+		var text string
+		switch {
+		case len(p.Value) == 0, string(p.Value) == "null":
+			return nil, fmt.Errorf("metric %d (%s): value is required", i, p.Name)
+		case json.Unmarshal(p.Value, &m.Value) == nil:
+			m.ValueType = models.ValueTypeNumeric
+		case json.Unmarshal(p.Value, &text) == nil:
+			m.ValueType = models.ValueTypeString
+			m.ValueText = text
+		default:
+			return nil, fmt.Errorf("metric %d (%s): value must be a number or a string, got %s", i, p.Name, p.Value)
+		}
+
+		switch models.Kind(p.Kind) {
+		case models.KindUnknown, models.KindGauge:
+			m.Kind = models.KindGauge
+		case models.KindCounter:
+			m.Kind = models.KindCounter
+		default:
+			return nil, fmt.Errorf("metric %d (%s): kind must be gauge or counter, got %q", i, p.Name, p.Kind)
+		}
+		if m.ValueType == models.ValueTypeString {
+			// String metrics carry no kind, like the ones collectors emit
+			m.Kind = models.KindUnknown
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
+// parseJSONL parses VictoriaMetrics JSONL, as written by the uploader and /api/v1/export
+// Names are kept as they are; names ending in _total are counters, everything else gauges.
+func parseJSONL(body []byte) ([]*models.Metric, error) {
+	var metrics []*models.Metric
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBodyBytes)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var vm uploader.VMMetric
+		if err := json.Unmarshal(text, &vm); err != nil {
+			return nil, fmt.Errorf("line %d: invalid JSON: %w", line, err)
+		}
+		name := vm.Metric["__name__"]
+		if name == "" {
+			return nil, fmt.Errorf("line %d: metric.__name__ is required", line)
+		}
+		if len(vm.Values) == 0 || len(vm.Values) != len(vm.Timestamps) {
+			return nil, fmt.Errorf("line %d (%s): values and timestamps must be non-empty and of equal length", line, name)
+		}
+
+		kind := models.KindGauge
+		if strings.HasSuffix(name, "_total") {
+			kind = models.KindCounter
+		}
+		for i, v := range vm.Values {
+			if vm.Timestamps[i] <= 0 {
+				return nil, fmt.Errorf("line %d (%s): invalid timestamp %d", line, name, vm.Timestamps[i])
+			}
+			m := &models.Metric{
+				Name:        name,
+				TimestampMs: vm.Timestamps[i],
+				Value:       v,
+				ValueType:   models.ValueTypeNumeric,
+				Kind:        kind,
+				Tags:        make(map[string]string, len(vm.Metric)),
+			}
+			for key, value := range vm.Metric {
+				if key != "__name__" {
+					m.Tags[key] = value
+				}
+			}
+			metrics = append(metrics, m)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("line %d: %w", line+1, err)
+	}
+	return metrics, nil
+}
+
+// ServeUnix serves the handler's paths on a unix socket at path until ctx is done
+// A stale socket file from a previous run is replaced. The socket is created with mode 0660, so
+// access is controlled by the owner and group of the daemon. Requests in flight are finished
+// before it returns.
+func ServeUnix(ctx context.Context, path string, h *Handler) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	for _, p := range Paths {
+		mux.Handle(p, h)
+	}
+	server := &http.Server{Handler: mux}
+
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	<-shutdown
+	return nil
+}
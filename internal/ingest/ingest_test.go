@@ -0,0 +1,224 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+// memWriter records the last stored batch
+type memWriter struct {
+	batch []*models.Metric
+	err   error
+}
+
+func (w *memWriter) StoreBatch(ctx context.Context, metrics []*models.Metric) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.batch = metrics
+	return nil
+}
+
+// push sends body to path and returns the response status and body
+func push(t *testing.T, h http.Handler, path, token, body string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code, rec.Body.String()
+}
+
+func TestHandler_Push(t *testing.T) {
+	writer := &memWriter{}
+	h := NewHandler(Config{DeviceID: "test-device", Priority: models.PriorityP1}, writer)
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	h.now = func() time.Time { return now }
+
+	code, body := push(t, h, PathPush, "", `[
+		{"name": "encoder.bitrate", "value": 4500000, "unit": "bps", "tags": {"pipeline": "main"}},
+		{"name": "encoder.restarts", "value": 3, "kind": "counter", "timestamp_ms": 1772359200000},
+		{"name": "encoder.state", "value": "streaming"}
+	]`)
+	if code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", code, body)
+	}
+	if len(writer.batch) != 3 {
+		t.Fatalf("Expected 3 metrics stored, got %d", len(writer.batch))
+	}
+	bitrate, restarts, state := writer.batch[0], writer.batch[1], writer.batch[2]
+	if bitrate.Value != 4500000 || bitrate.Kind != models.KindGauge || bitrate.Unit != "bps" || bitrate.Tags["pipeline"] != "main" {
+		t.Errorf("Unexpected gauge %+v", bitrate)
+	}
+	if bitrate.TimestampMs != now.UnixMilli() || bitrate.DeviceID != "test-device" || bitrate.Priority != models.PriorityP1 {
+		t.Errorf("Expected the request time, device ID and priority, got %+v", bitrate)
+	}
+	if restarts.Kind != models.KindCounter || restarts.TimestampMs != 1772359200000 {
+		t.Errorf("Unexpected counter %+v", restarts)
+	}
+	if state.ValueType != models.ValueTypeString || state.ValueText != "streaming" {
+		t.Errorf("Expected a string metric, got %+v", state)
+	}
+
+	// A single object is accepted too
+	if code, body := push(t, h, PathPush, "", `{"name": "encoder.fps", "value": 29.97}`); code != http.StatusNoContent {
+		t.Errorf("Expected 204 for a single object, got %d: %s", code, body)
+	}
+}
+
+func TestHandler_Import(t *testing.T) {
+	writer := &memWriter{}
+	h := NewHandler(Config{DeviceID: "test-device"}, writer)
+
+	code, body := push(t, h, PathImport, "",
+		`{"metric":{"__name__":"srt_packets_total","device_id":"other","link":"wwan0"},"values":[10,12],"timestamps":[1772359200000,1772359205000]}`+"\n\n"+
+			`{"metric":{"__name__":"srt_rtt_ms"},"values":[48],"timestamps":[1772359200000]}`+"\n")
+	if code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", code, body)
+	}
+	if len(writer.batch) != 3 {
+		t.Fatalf("Expected one metric per value, got %d", len(writer.batch))
+	}
+	packets := writer.batch[1]
+	if packets.Name != "srt_packets_total" || packets.Value != 12 || packets.TimestampMs != 1772359205000 || packets.Kind != models.KindCounter {
+		t.Errorf("Unexpected counter %+v", packets)
+	}
+	if packets.DeviceID != "test-device" || packets.Tags["link"] != "wwan0" || len(packets.Tags) != 1 {
+		t.Errorf("Expected the device's own ID and the remaining labels as tags, got %+v", packets)
+	}
+	if rtt := writer.batch[2]; rtt.Kind != models.KindGauge {
+		t.Errorf("Expected a gauge, got %+v", rtt)
+	}
+
+	code, body = push(t, h, PathImportPrometheus, "", "# TYPE modem_reconnects counter\nmodem_reconnects_total{modem=\"wwan0\"} 4\n")
+	if code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", code, body)
+	}
+	if len(writer.batch) != 1 || writer.batch[0].Kind != models.KindCounter || writer.batch[0].Tags["modem"] != "wwan0" {
+		t.Errorf("Unexpected Prometheus import %+v", writer.batch)
+	}
+}
+
+func TestHandler_Rejects(t *testing.T) {
+	writer := &memWriter{}
+	h := NewHandler(Config{AuthToken: "secret", MaxMetrics: 2}, writer)
+
+	tests := []struct {
+		name     string
+		path     string
+		token    string
+		body     string
+		wantCode int
+		wantErr  string
+	}{
+		{"no token", PathPush, "", `{"name":"m","value":1}`, http.StatusUnauthorized, "unauthorized"},
+		{"wrong token", PathPush, "guess", `{"name":"m","value":1}`, http.StatusUnauthorized, "unauthorized"},
+		{"empty", PathPush, "secret", `[]`, http.StatusBadRequest, "no metrics"},
+		{"too many", PathPush, "secret", `[{"name":"a","value":1},{"name":"b","value":1},{"name":"c","value":1}]`, http.StatusBadRequest, "too many metrics (3, limit 2)"},
+		{"unknown field", PathPush, "secret", `{"name":"m","value":1,"labels":{}}`, http.StatusBadRequest, "unknown field"},
+		{"missing value", PathPush, "secret", `{"name":"m"}`, http.StatusBadRequest, "value is required"},
+		{"bool value", PathPush, "secret", `{"name":"m","value":true}`, http.StatusBadRequest, "number or a string"},
+		{"bad kind", PathPush, "secret", `{"name":"m","value":1,"kind":"histogram"}`, http.StatusBadRequest, "kind must be gauge or counter"},
+		{"bad name", PathPush, "secret", `[{"name":"ok","value":1},{"name":"9lives","value":1}]`, http.StatusBadRequest, `metric 1: invalid name "9lives"`},
+		{"internal tag", PathPush, "secret", `{"name":"m","value":1,"tags":{"_storage_id":"1"}}`, http.StatusBadRequest, "invalid tag"},
+		{"bad unit", PathPush, "secret", `{"name":"m","value":1,"unit":"m/s"}`, http.StatusBadRequest, "invalid unit"},
+		{"jsonl without name", PathImport, "secret", `{"metric":{},"values":[1],"timestamps":[1]}`, http.StatusBadRequest, "line 1: metric.__name__ is required"},
+		{"jsonl length mismatch", PathImport, "secret", `{"metric":{"__name__":"m"},"values":[1,2],"timestamps":[1]}`, http.StatusBadRequest, "equal length"},
+		{"prometheus syntax", PathImportPrometheus, "secret", "m{a=1} 1\n", http.StatusBadRequest, "line 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := push(t, h, tt.path, tt.token, tt.body)
+			if code != tt.wantCode || !strings.Contains(body, tt.wantErr) {
+				t.Errorf("Expected %d containing %q, got %d: %s", tt.wantCode, tt.wantErr, code, body)
+			}
+		})
+	}
+	if writer.batch != nil {
+		t.Errorf("Expected nothing stored from rejected requests, got %v", writer.batch)
+	}
+
+	// JSON cannot encode NaN or infinities, but every path shares the check
+	for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		err := h.validate([]*models.Metric{models.NewMetric("ok", 1, ""), models.NewMetric("encoder.fps", v, "")})
+		if err == nil || !strings.Contains(err.Error(), "metric 1 (encoder.fps): value must be finite") {
+			t.Errorf("Expected %v rejected with its position, got %v", v, err)
+		}
+	}
+
+	// NaN samples in Prometheus text are dropped like in the textfile collector
+	code, body := push(t, h, PathImportPrometheus, "secret", "x{quantile=\"0.5\"} NaN\nx_count 0\n")
+	if code != http.StatusNoContent || len(writer.batch) != 1 || writer.batch[0].Name != "x_count" {
+		t.Errorf("Expected only x_count stored, got %d: %s %v", code, body, writer.batch)
+	}
+	writer.batch = nil
+
+	req := httptest.NewRequest(http.MethodGet, PathPush, nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got %d", rec.Code)
+	}
+
+	writer.err = errors.New("disk full")
+	if code, _ := push(t, h, PathPush, "secret", `{"name":"m","value":1}`); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when storing fails, got %d", code)
+	}
+}
+
+func TestServeUnix(t *testing.T) {
+	writer := &memWriter{}
+	h := NewHandler(Config{DeviceID: "test-device"}, writer)
+	path := filepath.Join(t.TempDir(), "ingest.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ServeUnix(ctx, path, h) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := client.Post("http://unix"+PathPush, "application/json", strings.NewReader(`{"name":"m","value":1}`))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNoContent {
+				t.Fatalf("Expected 204, got %d", resp.StatusCode)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Socket never accepted a request: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(writer.batch) != 1 {
+		t.Errorf("Expected the pushed metric stored, got %v", writer.batch)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ServeUnix failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServeUnix did not return after cancel")
+	}
+}
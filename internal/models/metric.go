@@ -1,6 +1,11 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
 
 // ValueType indicates the type of metric value
 type ValueType int
@@ -10,6 +15,78 @@ const (
 	ValueTypeString  ValueType = 1 // String value (for errors, states, etc.)
 )
 
+// Kind declares how a numeric metric behaves, so exporters do not have to guess from its name
+type Kind string
+
+const (
+	KindUnknown   Kind = ""          // Not declared (rows stored before kinds existed)
+	KindGauge     Kind = "gauge"     // Value that can go up and down
+	KindCounter   Kind = "counter"   // Monotonically increasing total
+	KindHistogram Kind = "histogram" // Histogram component (_bucket, _sum or _count)
+)
+
+// Priority is an upload priority class
+// After an outage higher classes drain first, and size-capped retention evicts lower classes first.
+type Priority string
+
+const (
+	PriorityDefault Priority = ""   // Not set: stored as P2
+	PriorityP0      Priority = "P0" // Critical (e.g., streaming health)
+	PriorityP1      Priority = "P1" // High
+	PriorityP2      Priority = "P2" // Normal
+	PriorityP3      Priority = "P3" // Bulk (e.g., detailed system stats)
+)
+
+// Priorities lists the classes from highest to lowest
+var Priorities = []Priority{PriorityP0, PriorityP1, PriorityP2, PriorityP3}
+
+// ParsePriority parses a priority class, case-insensitively ("p0" = "P0")
+func ParsePriority(s string) (Priority, error) {
+	p := Priority(strings.ToUpper(strings.TrimSpace(s)))
+	for _, valid := range Priorities {
+		if p == valid {
+			return p, nil
+		}
+	}
+	return PriorityDefault, fmt.Errorf("priority must be P0, P1, P2 or P3, got %q", s)
+}
+
+// Rank returns the value stored in metrics.priority: P0 = 3 down to P3 = 0
+// Rows stored before priorities existed have 1, the rank of the default class P2.
+func (p Priority) Rank() int {
+	switch p {
+	case PriorityP0:
+		return 3
+	case PriorityP1:
+		return 2
+	case PriorityP3:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// PriorityFromRank returns the class of a stored metrics.priority value
+func PriorityFromRank(rank int) Priority {
+	switch {
+	case rank >= 3:
+		return PriorityP0
+	case rank == 2:
+		return PriorityP1
+	case rank <= 0:
+		return PriorityP3
+	default:
+		return PriorityP2
+	}
+}
+
+// Tags set on rollup rows, which aggregate raw points of one series into fixed-width buckets
+// Uploaders turn them into the series name instead of sending them as labels
+const (
+	TagRollupResolution = "_rollup_resolution" // Bucket width (e.g., "5m")
+	TagRollupAgg        = "_rollup_agg"        // Aggregation: min, max, avg or count
+)
+
 // Metric represents a single metric data point
 type Metric struct {
 	TimestampMs int64             // Unix timestamp in milliseconds
@@ -19,6 +96,10 @@ type Metric struct {
 	ValueType   ValueType         // Type of value (numeric or string)
 	DeviceID    string            // Device identifier
 	Tags        map[string]string // Optional tags for dimensions
+	Kind        Kind              // Declared metric kind (empty for legacy rows)
+	Unit        string            // Base unit (e.g., "bytes", "seconds"), empty if dimensionless
+	SessionID   string            // Streaming session the metric was collected in, empty outside sessions
+	Priority    Priority          // Upload priority class (empty = P2)
 }
 
 // NewMetric creates a new numeric metric with the current timestamp
@@ -59,3 +140,50 @@ func (m *Metric) WithTag(key, value string) *Metric {
 	m.Tags[key] = value
 	return m
 }
+
+// WithKind declares the metric kind
+func (m *Metric) WithKind(kind Kind) *Metric {
+	m.Kind = kind
+	return m
+}
+
+// WithUnit declares the metric unit
+func (m *Metric) WithUnit(unit string) *Metric {
+	m.Unit = unit
+	return m
+}
+
+// AsCounter declares the metric a counter in the given unit
+func (m *Metric) AsCounter(unit string) *Metric {
+	return m.WithKind(KindCounter).WithUnit(unit)
+}
+
+// AsGauge declares the metric a gauge in the given unit
+func (m *Metric) AsGauge(unit string) *Metric {
+	return m.WithKind(KindGauge).WithUnit(unit)
+}
+
+// IsRollup reports whether the metric is an aggregate produced by storage rollups
+func (m *Metric) IsRollup() bool {
+	return m.Tags[TagRollupAgg] != ""
+}
+
+// SeriesKey identifies a series of a metric by its sorted tags
+// Names and values are each followed by 0xff, which never occurs in UTF-8 text, so tags containing
+// separators such as "," or "=" cannot make two tag sets share a key. Callers prepend the name or
+// device ID when a key must tell those apart as well.
+func SeriesKey(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte(0xff)
+		b.WriteString(tags[k])
+		b.WriteByte(0xff)
+	}
+	return b.String()
+}
@@ -69,3 +69,61 @@ func TestMetricChaining(t *testing.T) {
 		t.Error("Chaining failed: tags not set")
 	}
 }
+
+func TestMetricKindAndUnit(t *testing.T) {
+	m := NewMetric("network.rx_bytes_total", 1024, "device-001")
+	if m.Kind != KindUnknown || m.Unit != "" {
+		t.Errorf("Expected no declared kind or unit, got %q/%q", m.Kind, m.Unit)
+	}
+
+	m.AsCounter("bytes")
+	if m.Kind != KindCounter || m.Unit != "bytes" {
+		t.Errorf("Expected counter in bytes, got %q/%q", m.Kind, m.Unit)
+	}
+
+	g := NewMetric("http.requests_in_flight", 3, "device-001").AsGauge("")
+	if g.Kind != KindGauge || g.Unit != "" {
+		t.Errorf("Expected dimensionless gauge, got %q/%q", g.Kind, g.Unit)
+	}
+}
+
+func TestPriority(t *testing.T) {
+	p, err := ParsePriority("p0")
+	if err != nil || p != PriorityP0 {
+		t.Errorf("Expected P0, got %q (err: %v)", p, err)
+	}
+	if _, err := ParsePriority("P4"); err == nil {
+		t.Error("Expected P4 to be rejected")
+	}
+
+	// Higher classes rank higher; the default ranks as P2, like rows stored before priorities
+	if PriorityP0.Rank() <= PriorityP1.Rank() || PriorityP2.Rank() <= PriorityP3.Rank() {
+		t.Error("Expected ranks to decrease from P0 to P3")
+	}
+	if PriorityDefault.Rank() != 1 || PriorityP2.Rank() != 1 {
+		t.Errorf("Expected the default class to rank 1, got %d", PriorityDefault.Rank())
+	}
+	for _, p := range Priorities {
+		if got := PriorityFromRank(p.Rank()); got != p {
+			t.Errorf("PriorityFromRank(%d) = %s, want %s", p.Rank(), got, p)
+		}
+	}
+}
+
+func TestSeriesKey(t *testing.T) {
+	a := SeriesKey(map[string]string{"pipeline": "main", "link": "wwan0"})
+	b := SeriesKey(map[string]string{"link": "wwan0", "pipeline": "main"})
+	if a != b || a != "link\xffwwan0\xffpipeline\xffmain\xff" {
+		t.Errorf("Expected the same key regardless of map order, got %q and %q", a, b)
+	}
+	if got := SeriesKey(nil); got != "" {
+		t.Errorf("Expected an empty key without tags, got %q", got)
+	}
+
+	// Separators inside values must not merge different tag sets
+	c := SeriesKey(map[string]string{"a": "1,b=2"})
+	d := SeriesKey(map[string]string{"a": "1", "b": "2"})
+	if c == d {
+		t.Errorf("Expected different tag sets to get different keys, got %q for both", c)
+	}
+}
@@ -21,12 +21,31 @@ type MetricsCollector struct {
 	// Uploader metrics
 	uploaderMetricsUploaded int64
 	uploaderFailuresTotal   int64
-	uploaderDurations       []float64 // recent durations (for histogram)
+	uploaderDurations       []float64                 // recent durations (for histogram)
+	uploaderBreakers        map[string]breakerMetrics // destination -> circuit breaker state
+	uploaderRejected        map[string]int64          // destination -> metrics dropped because the receiver rejected them
+	uploaderBandwidth       *BandwidthMetrics         // nil until the first upload cycle
 
 	// Storage metrics
 	storageDatabaseSizeBytes int64
 	storageWALSizeBytes      int64
 	storagePendingUpload     int64
+	storageRetentionEvicted  map[string]int64 // eviction reason -> rows deleted
+
+	// Write buffer metrics
+	bufferDepth          int64
+	bufferFlushes        map[string]int64 // flush reason -> count
+	bufferFlushFailures  int64
+	bufferDropped        int64
+	bufferFlushDurations []float64 // recent durations (for histogram)
+
+	// Relabel metrics
+	relabelDropped map[relabelDropKey]int64 // collector and reason -> metrics dropped before storage
+
+	// StatsD listener metrics
+	statsdReporting bool             // The listener has reported at least once
+	statsdMalformed int64            // lines that failed to parse
+	statsdDropped   map[string]int64 // drop reason -> lines or metrics dropped
 
 	// Time metrics
 	timeSkewMs int64
@@ -35,6 +54,26 @@ type MetricsCollector struct {
 	histogramMaxSamples int // Maximum number of duration samples to keep
 }
 
+// breakerMetrics is the circuit breaker state of one destination
+type breakerMetrics struct {
+	state int   // 0 closed, 1 half-open, 2 open
+	opens int64 // Times the breaker opened
+}
+
+// BandwidthMetrics is the upload bandwidth usage of the current day and month
+type BandwidthMetrics struct {
+	Today     map[string]int64 // Interface -> bytes sent today
+	Month     map[string]int64 // Interface -> bytes sent this month
+	Remaining map[string]int64 // Budget period ("daily", "monthly") -> bytes left, only for configured budgets
+	Paused    bool             // Uploads paused because a budget is used up
+}
+
+// relabelDropKey identifies a relabel drop counter
+type relabelDropKey struct {
+	collector string
+	reason    string
+}
+
 // NewMetricsCollector creates a new meta-metrics collector
 func NewMetricsCollector(deviceID string) *MetricsCollector {
 	return &MetricsCollector{
@@ -42,6 +81,12 @@ func NewMetricsCollector(deviceID string) *MetricsCollector {
 		collectorMetricsCollected: make(map[string]int64),
 		collectorMetricsFailed:    make(map[string]int64),
 		collectorDurations:        make(map[string][]float64),
+		storageRetentionEvicted:   make(map[string]int64),
+		bufferFlushes:             make(map[string]int64),
+		relabelDropped:            make(map[relabelDropKey]int64),
+		statsdDropped:             make(map[string]int64),
+		uploaderBreakers:          make(map[string]breakerMetrics),
+		uploaderRejected:          make(map[string]int64),
 		uploaderDurations:         make([]float64, 0, 100),
 		histogramMaxSamples:       100, // Keep last 100 samples for histogram calculation
 	}
@@ -99,6 +144,35 @@ func (m *MetricsCollector) RecordUploadFailure() {
 	m.uploaderFailuresTotal++
 }
 
+// UpdateBreakerState records the circuit breaker state of a destination
+// state is 0 closed, 1 half-open or 2 open; opens is how many times the breaker has opened
+func (m *MetricsCollector) UpdateBreakerState(destination string, state int, opens int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.uploaderBreakers[destination] = breakerMetrics{state: state, opens: opens}
+}
+
+// RecordUploadRejected records metrics dropped because a destination rejected their chunk for good
+func (m *MetricsCollector) RecordUploadRejected(destination string, count int) {
+	if count <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.uploaderRejected[destination] += int64(count)
+}
+
+// UpdateBandwidth records upload bandwidth usage and budget state
+func (m *MetricsCollector) UpdateBandwidth(b BandwidthMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.uploaderBandwidth = &b
+}
+
 // UpdateStorageMetrics updates storage-related metrics
 func (m *MetricsCollector) UpdateStorageMetrics(dbSize, walSize, pendingCount int64) {
 	m.mu.Lock()
@@ -109,6 +183,81 @@ func (m *MetricsCollector) UpdateStorageMetrics(dbSize, walSize, pendingCount in
 	m.storagePendingUpload = pendingCount
 }
 
+// RecordRetentionEviction records rows deleted by the retention loop
+// reason identifies which rule removed them (e.g., "uploaded_age", "pending_size")
+func (m *MetricsCollector) RecordRetentionEviction(reason string, count int64) {
+	if count <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.storageRetentionEvicted[reason] += count
+}
+
+// RecordBufferFlush records a flush of the write buffer
+// dropped is the number of metrics discarded because a failed flush left the buffer full.
+func (m *MetricsCollector) RecordBufferFlush(reason string, duration time.Duration, dropped int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.bufferFlushes[reason]++
+	if err != nil {
+		m.bufferFlushFailures++
+	}
+	m.bufferDropped += int64(dropped)
+
+	m.bufferFlushDurations = append(m.bufferFlushDurations, duration.Seconds())
+	if len(m.bufferFlushDurations) > m.histogramMaxSamples {
+		m.bufferFlushDurations = m.bufferFlushDurations[len(m.bufferFlushDurations)-m.histogramMaxSamples:]
+	}
+}
+
+// UpdateBufferDepth updates the number of metrics waiting in the write buffer
+func (m *MetricsCollector) UpdateBufferDepth(depth int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.bufferDepth = int64(depth)
+}
+
+// RecordRelabelDrop records metrics dropped by the relabel stage before storage
+// reason is why they were dropped (e.g., "rule", "series_limit")
+func (m *MetricsCollector) RecordRelabelDrop(collectorName, reason string, count int) {
+	if count <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.relabelDropped[relabelDropKey{collector: collectorName, reason: reason}] += int64(count)
+}
+
+// RecordStatsDMalformed records StatsD lines that failed to parse
+func (m *MetricsCollector) RecordStatsDMalformed(count int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.statsdReporting = true
+	m.statsdMalformed += int64(count)
+}
+
+// RecordStatsDDropped records StatsD samples dropped by the listener
+// reason is why they were dropped (e.g., "series_limit", "unsupported", "store")
+func (m *MetricsCollector) RecordStatsDDropped(reason string, count int) {
+	if count <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.statsdReporting = true
+	m.statsdDropped[reason] += int64(count)
+}
+
 // UpdateTimeSkew updates the clock skew metric
 func (m *MetricsCollector) UpdateTimeSkew(skewMs int64) {
 	m.mu.Lock()
@@ -133,6 +282,7 @@ func (m *MetricsCollector) CollectMetrics(ctx context.Context) ([]*models.Metric
 			Value:       float64(count),
 			ValueType:   models.ValueTypeNumeric,
 			DeviceID:    m.deviceID,
+			Kind:        models.KindCounter,
 			Tags: map[string]string{
 				"collector": collectorName,
 			},
@@ -146,6 +296,7 @@ func (m *MetricsCollector) CollectMetrics(ctx context.Context) ([]*models.Metric
 			Value:       float64(count),
 			ValueType:   models.ValueTypeNumeric,
 			DeviceID:    m.deviceID,
+			Kind:        models.KindCounter,
 			Tags: map[string]string{
 				"collector": collectorName,
 			},
@@ -164,6 +315,8 @@ func (m *MetricsCollector) CollectMetrics(ctx context.Context) ([]*models.Metric
 					Value:       p50,
 					ValueType:   models.ValueTypeNumeric,
 					DeviceID:    m.deviceID,
+					Kind:        models.KindGauge,
+					Unit:        "seconds",
 					Tags: map[string]string{
 						"collector": collectorName,
 					},
@@ -174,6 +327,8 @@ func (m *MetricsCollector) CollectMetrics(ctx context.Context) ([]*models.Metric
 					Value:       p95,
 					ValueType:   models.ValueTypeNumeric,
 					DeviceID:    m.deviceID,
+					Kind:        models.KindGauge,
+					Unit:        "seconds",
 					Tags: map[string]string{
 						"collector": collectorName,
 					},
@@ -184,6 +339,8 @@ func (m *MetricsCollector) CollectMetrics(ctx context.Context) ([]*models.Metric
 					Value:       p99,
 					ValueType:   models.ValueTypeNumeric,
 					DeviceID:    m.deviceID,
+					Kind:        models.KindGauge,
+					Unit:        "seconds",
 					Tags: map[string]string{
 						"collector": collectorName,
 					},
@@ -200,6 +357,7 @@ func (m *MetricsCollector) CollectMetrics(ctx context.Context) ([]*models.Metric
 			Value:       float64(m.uploaderMetricsUploaded),
 			ValueType:   models.ValueTypeNumeric,
 			DeviceID:    m.deviceID,
+			Kind:        models.KindCounter,
 			Tags:        make(map[string]string),
 		},
 		&models.Metric{
@@ -208,10 +366,113 @@ func (m *MetricsCollector) CollectMetrics(ctx context.Context) ([]*models.Metric
 			Value:       float64(m.uploaderFailuresTotal),
 			ValueType:   models.ValueTypeNumeric,
 			DeviceID:    m.deviceID,
+			Kind:        models.KindCounter,
 			Tags:        make(map[string]string),
 		},
 	)
 
+	// Circuit breakers
+	for destination, b := range m.uploaderBreakers {
+		metrics = append(metrics,
+			&models.Metric{
+				Name:        "uploader.breaker_state",
+				TimestampMs: now.UnixMilli(),
+				Value:       float64(b.state),
+				ValueType:   models.ValueTypeNumeric,
+				DeviceID:    m.deviceID,
+				Kind:        models.KindGauge,
+				Tags: map[string]string{
+					"destination": destination,
+				},
+			},
+			&models.Metric{
+				Name:        "uploader.breaker_opens_total",
+				TimestampMs: now.UnixMilli(),
+				Value:       float64(b.opens),
+				ValueType:   models.ValueTypeNumeric,
+				DeviceID:    m.deviceID,
+				Kind:        models.KindCounter,
+				Tags: map[string]string{
+					"destination": destination,
+				},
+			},
+		)
+	}
+
+	// Rejected chunks
+	for destination, count := range m.uploaderRejected {
+		metrics = append(metrics, &models.Metric{
+			Name:        "uploader.rejected_total",
+			TimestampMs: now.UnixMilli(),
+			Value:       float64(count),
+			ValueType:   models.ValueTypeNumeric,
+			DeviceID:    m.deviceID,
+			Kind:        models.KindCounter,
+			Tags: map[string]string{
+				"destination": destination,
+			},
+		})
+	}
+
+	// Bandwidth usage
+	if b := m.uploaderBandwidth; b != nil {
+		paused := 0.0
+		if b.Paused {
+			paused = 1
+		}
+		metrics = append(metrics, &models.Metric{
+			Name:        "uploader.bandwidth_paused",
+			TimestampMs: now.UnixMilli(),
+			Value:       paused,
+			ValueType:   models.ValueTypeNumeric,
+			DeviceID:    m.deviceID,
+			Kind:        models.KindGauge,
+			Tags:        make(map[string]string),
+		})
+		for iface, bytes := range b.Today {
+			metrics = append(metrics, &models.Metric{
+				Name:        "uploader.bandwidth_today_bytes",
+				TimestampMs: now.UnixMilli(),
+				Value:       float64(bytes),
+				ValueType:   models.ValueTypeNumeric,
+				DeviceID:    m.deviceID,
+				Kind:        models.KindGauge,
+				Unit:        "bytes",
+				Tags: map[string]string{
+					"interface": iface,
+				},
+			})
+		}
+		for iface, bytes := range b.Month {
+			metrics = append(metrics, &models.Metric{
+				Name:        "uploader.bandwidth_month_bytes",
+				TimestampMs: now.UnixMilli(),
+				Value:       float64(bytes),
+				ValueType:   models.ValueTypeNumeric,
+				DeviceID:    m.deviceID,
+				Kind:        models.KindGauge,
+				Unit:        "bytes",
+				Tags: map[string]string{
+					"interface": iface,
+				},
+			})
+		}
+		for period, bytes := range b.Remaining {
+			metrics = append(metrics, &models.Metric{
+				Name:        "uploader.bandwidth_budget_remaining_bytes",
+				TimestampMs: now.UnixMilli(),
+				Value:       float64(bytes),
+				ValueType:   models.ValueTypeNumeric,
+				DeviceID:    m.deviceID,
+				Kind:        models.KindGauge,
+				Unit:        "bytes",
+				Tags: map[string]string{
+					"period": period,
+				},
+			})
+		}
+	}
+
 	// Uploader duration histogram
 	if len(m.uploaderDurations) > 0 {
 		p50, p95, p99 := calculatePercentiles(m.uploaderDurations)
@@ -223,6 +484,8 @@ func (m *MetricsCollector) CollectMetrics(ctx context.Context) ([]*models.Metric
 				Value:       p50,
 				ValueType:   models.ValueTypeNumeric,
 				DeviceID:    m.deviceID,
+				Kind:        models.KindGauge,
+				Unit:        "seconds",
 				Tags:        make(map[string]string),
 			},
 			&models.Metric{
@@ -231,6 +494,8 @@ func (m *MetricsCollector) CollectMetrics(ctx context.Context) ([]*models.Metric
 				Value:       p95,
 				ValueType:   models.ValueTypeNumeric,
 				DeviceID:    m.deviceID,
+				Kind:        models.KindGauge,
+				Unit:        "seconds",
 				Tags:        make(map[string]string),
 			},
 			&models.Metric{
@@ -239,6 +504,8 @@ func (m *MetricsCollector) CollectMetrics(ctx context.Context) ([]*models.Metric
 				Value:       p99,
 				ValueType:   models.ValueTypeNumeric,
 				DeviceID:    m.deviceID,
+				Kind:        models.KindGauge,
+				Unit:        "seconds",
 				Tags:        make(map[string]string),
 			},
 		)
@@ -252,6 +519,8 @@ func (m *MetricsCollector) CollectMetrics(ctx context.Context) ([]*models.Metric
 			Value:       float64(m.storageDatabaseSizeBytes),
 			ValueType:   models.ValueTypeNumeric,
 			DeviceID:    m.deviceID,
+			Kind:        models.KindGauge,
+			Unit:        "bytes",
 			Tags:        make(map[string]string),
 		},
 		&models.Metric{
@@ -260,6 +529,8 @@ func (m *MetricsCollector) CollectMetrics(ctx context.Context) ([]*models.Metric
 			Value:       float64(m.storageWALSizeBytes),
 			ValueType:   models.ValueTypeNumeric,
 			DeviceID:    m.deviceID,
+			Kind:        models.KindGauge,
+			Unit:        "bytes",
 			Tags:        make(map[string]string),
 		},
 		&models.Metric{
@@ -268,9 +539,147 @@ func (m *MetricsCollector) CollectMetrics(ctx context.Context) ([]*models.Metric
 			Value:       float64(m.storagePendingUpload),
 			ValueType:   models.ValueTypeNumeric,
 			DeviceID:    m.deviceID,
+			Kind:        models.KindGauge,
+			Tags:        make(map[string]string),
+		},
+	)
+
+	// Retention evictions (pending_* reasons are data that never reached the remote)
+	for reason, count := range m.storageRetentionEvicted {
+		metrics = append(metrics, &models.Metric{
+			Name:        "storage.retention_evicted_total",
+			TimestampMs: now.UnixMilli(),
+			Value:       float64(count),
+			ValueType:   models.ValueTypeNumeric,
+			DeviceID:    m.deviceID,
+			Kind:        models.KindCounter,
+			Tags: map[string]string{
+				"reason": reason,
+			},
+		})
+	}
+
+	// Write buffer metrics
+	metrics = append(metrics,
+		&models.Metric{
+			Name:        "storage.buffer_depth",
+			TimestampMs: now.UnixMilli(),
+			Value:       float64(m.bufferDepth),
+			ValueType:   models.ValueTypeNumeric,
+			DeviceID:    m.deviceID,
+			Kind:        models.KindGauge,
+			Tags:        make(map[string]string),
+		},
+		&models.Metric{
+			Name:        "storage.buffer_flush_failures_total",
+			TimestampMs: now.UnixMilli(),
+			Value:       float64(m.bufferFlushFailures),
+			ValueType:   models.ValueTypeNumeric,
+			DeviceID:    m.deviceID,
+			Kind:        models.KindCounter,
+			Tags:        make(map[string]string),
+		},
+		&models.Metric{
+			Name:        "storage.buffer_dropped_total",
+			TimestampMs: now.UnixMilli(),
+			Value:       float64(m.bufferDropped),
+			ValueType:   models.ValueTypeNumeric,
+			DeviceID:    m.deviceID,
+			Kind:        models.KindCounter,
 			Tags:        make(map[string]string),
 		},
 	)
+	for reason, count := range m.bufferFlushes {
+		metrics = append(metrics, &models.Metric{
+			Name:        "storage.buffer_flushes_total",
+			TimestampMs: now.UnixMilli(),
+			Value:       float64(count),
+			ValueType:   models.ValueTypeNumeric,
+			DeviceID:    m.deviceID,
+			Kind:        models.KindCounter,
+			Tags: map[string]string{
+				"reason": reason,
+			},
+		})
+	}
+
+	// Write buffer flush latency histogram
+	if len(m.bufferFlushDurations) > 0 {
+		p50, p95, p99 := calculatePercentiles(m.bufferFlushDurations)
+
+		metrics = append(metrics,
+			&models.Metric{
+				Name:        "storage.buffer_flush_duration_seconds_p50",
+				TimestampMs: now.UnixMilli(),
+				Value:       p50,
+				ValueType:   models.ValueTypeNumeric,
+				DeviceID:    m.deviceID,
+				Kind:        models.KindGauge,
+				Unit:        "seconds",
+				Tags:        make(map[string]string),
+			},
+			&models.Metric{
+				Name:        "storage.buffer_flush_duration_seconds_p95",
+				TimestampMs: now.UnixMilli(),
+				Value:       p95,
+				ValueType:   models.ValueTypeNumeric,
+				DeviceID:    m.deviceID,
+				Kind:        models.KindGauge,
+				Unit:        "seconds",
+				Tags:        make(map[string]string),
+			},
+			&models.Metric{
+				Name:        "storage.buffer_flush_duration_seconds_p99",
+				TimestampMs: now.UnixMilli(),
+				Value:       p99,
+				ValueType:   models.ValueTypeNumeric,
+				DeviceID:    m.deviceID,
+				Kind:        models.KindGauge,
+				Unit:        "seconds",
+				Tags:        make(map[string]string),
+			},
+		)
+	}
+
+	// Relabel drops
+	for key, count := range m.relabelDropped {
+		metrics = append(metrics, &models.Metric{
+			Name:        "relabel.dropped_total",
+			TimestampMs: now.UnixMilli(),
+			Value:       float64(count),
+			ValueType:   models.ValueTypeNumeric,
+			DeviceID:    m.deviceID,
+			Kind:        models.KindCounter,
+			Tags: map[string]string{
+				"collector": key.collector,
+				"reason":    key.reason,
+			},
+		})
+	}
+
+	// StatsD listener metrics, once the listener has reported
+	if m.statsdReporting {
+		metrics = append(metrics, &models.Metric{
+			Name:        "statsd.malformed_total",
+			TimestampMs: now.UnixMilli(),
+			Value:       float64(m.statsdMalformed),
+			ValueType:   models.ValueTypeNumeric,
+			DeviceID:    m.deviceID,
+			Kind:        models.KindCounter,
+			Tags:        make(map[string]string),
+		})
+	}
+	for reason, count := range m.statsdDropped {
+		metrics = append(metrics, &models.Metric{
+			Name:        "statsd.dropped_total",
+			TimestampMs: now.UnixMilli(),
+			Value:       float64(count),
+			ValueType:   models.ValueTypeNumeric,
+			DeviceID:    m.deviceID,
+			Kind:        models.KindCounter,
+			Tags:        map[string]string{"reason": reason},
+		})
+	}
 
 	// Time metrics
 	metrics = append(metrics, &models.Metric{
@@ -279,6 +688,8 @@ func (m *MetricsCollector) CollectMetrics(ctx context.Context) ([]*models.Metric
 		Value:       float64(m.timeSkewMs),
 		ValueType:   models.ValueTypeNumeric,
 		DeviceID:    m.deviceID,
+		Kind:        models.KindGauge,
+		Unit:        "ms",
 		Tags:        make(map[string]string),
 	})
 
@@ -354,6 +765,11 @@ func (m *MetricsCollector) GetCollectorStats() map[string]interface{} {
 		failedCopy[k] = v
 	}
 
+	evictedCopy := make(map[string]int64)
+	for k, v := range m.storageRetentionEvicted {
+		evictedCopy[k] = v
+	}
+
 	return map[string]interface{}{
 		"collected":       collectedCopy,
 		"failed":          failedCopy,
@@ -363,5 +779,6 @@ func (m *MetricsCollector) GetCollectorStats() map[string]interface{} {
 		"wal_size_bytes":  m.storageWALSizeBytes,
 		"pending_upload":  m.storagePendingUpload,
 		"time_skew_ms":    m.timeSkewMs,
+		"evicted":         evictedCopy,
 	}
 }
@@ -2,8 +2,12 @@ package monitoring
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
 )
 
 func TestNewMetricsCollector(t *testing.T) {
@@ -127,6 +131,255 @@ func TestUpdateStorageMetrics(t *testing.T) {
 	}
 }
 
+func TestRecordRelabelDrop(t *testing.T) {
+	mc := NewMetricsCollector("test-device")
+
+	mc.RecordRelabelDrop("network", "rule", 3)
+	mc.RecordRelabelDrop("network", "rule", 2)
+	mc.RecordRelabelDrop("network", "series_limit", 1)
+	mc.RecordRelabelDrop("disk", "rule", 0) // Ignored
+
+	metrics, err := mc.CollectMetrics(context.Background())
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+
+	got := make(map[string]float64)
+	for _, m := range metrics {
+		if m.Name != "relabel.dropped_total" {
+			continue
+		}
+		if m.Kind != models.KindCounter {
+			t.Errorf("Expected relabel.dropped_total to be a counter, got %q", m.Kind)
+		}
+		got[m.Tags["collector"]+"/"+m.Tags["reason"]] = m.Value
+	}
+	want := map[string]float64{"network/rule": 5, "network/series_limit": 1}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Expected %s = %v, got %v", k, v, got[k])
+		}
+	}
+}
+
+func TestRecordStatsD(t *testing.T) {
+	mc := NewMetricsCollector("test-device")
+
+	metrics, err := mc.CollectMetrics(context.Background())
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+	for _, m := range metrics {
+		if strings.HasPrefix(m.Name, "statsd.") {
+			t.Errorf("Expected no StatsD metrics before the listener reports, got %s", m.Name)
+		}
+	}
+
+	mc.RecordStatsDMalformed(0)
+	mc.RecordStatsDMalformed(2)
+	mc.RecordStatsDDropped("series_limit", 3)
+	mc.RecordStatsDDropped("series_limit", 1)
+	mc.RecordStatsDDropped("store", 0) // Ignored
+
+	metrics, err = mc.CollectMetrics(context.Background())
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+	got := make(map[string]float64)
+	for _, m := range metrics {
+		if !strings.HasPrefix(m.Name, "statsd.") {
+			continue
+		}
+		if m.Kind != models.KindCounter {
+			t.Errorf("Expected %s to be a counter, got %q", m.Name, m.Kind)
+		}
+		got[m.Name+"/"+m.Tags["reason"]] = m.Value
+	}
+	want := map[string]float64{"statsd.malformed_total/": 2, "statsd.dropped_total/series_limit": 4}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Expected %s = %v, got %v", k, v, got[k])
+		}
+	}
+}
+
+func TestUpdateBreakerState(t *testing.T) {
+	mc := NewMetricsCollector("test-device")
+
+	mc.UpdateBreakerState("default", 2, 1)
+	mc.UpdateBreakerState("archive", 0, 0)
+	mc.UpdateBreakerState("default", 1, 1) // Latest state wins
+
+	metrics, err := mc.CollectMetrics(context.Background())
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+
+	got := make(map[string]float64)
+	for _, m := range metrics {
+		switch m.Name {
+		case "uploader.breaker_state", "uploader.breaker_opens_total":
+			got[m.Name+"/"+m.Tags["destination"]] = m.Value
+		}
+	}
+	want := map[string]float64{
+		"uploader.breaker_state/default":       1,
+		"uploader.breaker_opens_total/default": 1,
+		"uploader.breaker_state/archive":       0,
+		"uploader.breaker_opens_total/archive": 0,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Expected %s = %v, got %v", k, v, got[k])
+		}
+	}
+}
+
+func TestUpdateBandwidth(t *testing.T) {
+	mc := NewMetricsCollector("test-device")
+
+	metrics, _ := mc.CollectMetrics(context.Background())
+	for _, m := range metrics {
+		if m.Name == "uploader.bandwidth_paused" {
+			t.Fatal("Expected no bandwidth metrics before the first update")
+		}
+	}
+
+	mc.UpdateBandwidth(BandwidthMetrics{
+		Today:     map[string]int64{"wwan0": 1000, "eth0": 5000},
+		Month:     map[string]int64{"wwan0": 30000, "eth0": 90000},
+		Remaining: map[string]int64{"daily": 0},
+		Paused:    true,
+	})
+
+	metrics, err := mc.CollectMetrics(context.Background())
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+
+	got := make(map[string]float64)
+	for _, m := range metrics {
+		switch m.Name {
+		case "uploader.bandwidth_paused":
+			got[m.Name] = m.Value
+		case "uploader.bandwidth_today_bytes", "uploader.bandwidth_month_bytes":
+			got[m.Name+"/"+m.Tags["interface"]] = m.Value
+		case "uploader.bandwidth_budget_remaining_bytes":
+			got[m.Name+"/"+m.Tags["period"]] = m.Value
+		}
+	}
+	want := map[string]float64{
+		"uploader.bandwidth_paused":                       1,
+		"uploader.bandwidth_today_bytes/wwan0":            1000,
+		"uploader.bandwidth_today_bytes/eth0":             5000,
+		"uploader.bandwidth_month_bytes/wwan0":            30000,
+		"uploader.bandwidth_month_bytes/eth0":             90000,
+		"uploader.bandwidth_budget_remaining_bytes/daily": 0,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Expected %s = %v, got %v", k, v, got[k])
+		}
+	}
+}
+
+func TestRecordBufferFlush(t *testing.T) {
+	mc := NewMetricsCollector("test-device")
+
+	mc.RecordBufferFlush("interval", 20*time.Millisecond, 0, nil)
+	mc.RecordBufferFlush("interval", 40*time.Millisecond, 0, nil)
+	mc.RecordBufferFlush("full", 10*time.Millisecond, 12, errors.New("disk I/O error"))
+	mc.UpdateBufferDepth(250)
+
+	metrics, err := mc.CollectMetrics(context.Background())
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+
+	got := make(map[string]float64)
+	for _, m := range metrics {
+		switch m.Name {
+		case "storage.buffer_flushes_total":
+			got[m.Name+"/"+m.Tags["reason"]] = m.Value
+		case "storage.buffer_depth", "storage.buffer_flush_failures_total", "storage.buffer_dropped_total",
+			"storage.buffer_flush_duration_seconds_p99":
+			got[m.Name] = m.Value
+		}
+	}
+	want := map[string]float64{
+		"storage.buffer_flushes_total/interval":     2,
+		"storage.buffer_flushes_total/full":         1,
+		"storage.buffer_depth":                      250,
+		"storage.buffer_flush_failures_total":       1,
+		"storage.buffer_dropped_total":              12,
+		"storage.buffer_flush_duration_seconds_p99": 0.04,
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Expected %s = %v, got %v", k, v, got[k])
+		}
+	}
+}
+
+func TestRecordRetentionEviction(t *testing.T) {
+	mc := NewMetricsCollector("test-device")
+
+	mc.RecordRetentionEviction("uploaded_age", 100)
+	mc.RecordRetentionEviction("uploaded_age", 50)
+	mc.RecordRetentionEviction("pending_size", 10)
+	mc.RecordRetentionEviction("pending_age", 0) // Ignored
+
+	if mc.storageRetentionEvicted["uploaded_age"] != 150 {
+		t.Errorf("Expected 150 uploaded_age evictions, got %d", mc.storageRetentionEvicted["uploaded_age"])
+	}
+	if mc.storageRetentionEvicted["pending_size"] != 10 {
+		t.Errorf("Expected 10 pending_size evictions, got %d", mc.storageRetentionEvicted["pending_size"])
+	}
+	if _, ok := mc.storageRetentionEvicted["pending_age"]; ok {
+		t.Error("Expected zero-count eviction to be ignored")
+	}
+
+	metrics, err := mc.CollectMetrics(context.Background())
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+
+	found := 0
+	for _, m := range metrics {
+		if m.Name != "storage.retention_evicted_total" {
+			continue
+		}
+		found++
+		switch m.Tags["reason"] {
+		case "uploaded_age":
+			if m.Value != 150 {
+				t.Errorf("Expected uploaded_age 150, got %f", m.Value)
+			}
+		case "pending_size":
+			if m.Value != 10 {
+				t.Errorf("Expected pending_size 10, got %f", m.Value)
+			}
+		default:
+			t.Errorf("Unexpected reason tag %q", m.Tags["reason"])
+		}
+	}
+	if found != 2 {
+		t.Errorf("Expected 2 storage.retention_evicted_total series, got %d", found)
+	}
+}
+
 func TestUpdateTimeSkew(t *testing.T) {
 	mc := NewMetricsCollector("test-device")
 
@@ -0,0 +1,351 @@
+package relabel
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+// Prometheus-style relabeling between collectors and storage
+// See: https://prometheus.io/docs/prometheus/latest/configuration/configuration/#relabel_config
+//
+// A metric's label set is its tags plus __name__ (the metric name). Rules run in order; a
+// metric that is dropped, or whose __name__ ends up empty, never reaches storage. Labels
+// starting with "__" other than __name__ are scratch space and are removed after the rules.
+// __priority__ holds the metric's upload priority class (P0-P3); a rule that sets it overrides
+// the collector's priority. The device ID is not a label and cannot be relabeled.
+
+// Actions
+const (
+	ActionReplace   = "replace"   // Set target_label to replacement when regex matches the source values
+	ActionKeep      = "keep"      // Drop metrics whose source values do not match regex
+	ActionDrop      = "drop"      // Drop metrics whose source values match regex
+	ActionHashMod   = "hashmod"   // Set target_label to a hash of the source values modulo modulus
+	ActionLabelMap  = "labelmap"  // Copy labels whose name matches regex to the name given by replacement
+	ActionLabelDrop = "labeldrop" // Remove labels whose name matches regex
+	ActionLabelKeep = "labelkeep" // Remove labels whose name does not match regex
+)
+
+// NameLabel is the label holding the metric name
+const NameLabel = "__name__"
+
+// PriorityLabel is the label holding the metric's upload priority class
+const PriorityLabel = "__priority__"
+
+// DefaultSeriesIdle is how long a series holds its slot under MaxSeriesPerMetric after its last sample
+const DefaultSeriesIdle = time.Hour
+
+// Drop reasons reported by Apply
+const (
+	ReasonRule        = "rule"         // Dropped by keep/drop or an empty __name__
+	ReasonSeriesLimit = "series_limit" // New series over MaxSeriesPerMetric
+)
+
+// Rule is a single relabel rule; empty fields take the Prometheus defaults
+type Rule struct {
+	Action       string   // Default: replace
+	SourceLabels []string // Labels whose values are joined with Separator
+	Separator    string   // Default: ";"
+	Regex        string   // Fully anchored; default: (.*)
+	TargetLabel  string   // Required for replace and hashmod
+	Replacement  *string  // Default: $1
+	Modulus      uint64   // Required for hashmod
+}
+
+// Config is a relabel stage configuration
+type Config struct {
+	Rules              []Rule
+	MaxSeriesPerMetric int // Distinct series kept per metric name (0 = unlimited)
+}
+
+// compiledRule is a validated rule with defaults applied
+type compiledRule struct {
+	action       string
+	sourceLabels []string
+	separator    string
+	regex        *regexp.Regexp
+	targetLabel  string
+	replacement  string
+	modulus      uint64
+}
+
+// Relabeler applies relabel rules and the per-metric series limit
+// It is safe for concurrent use by several collectors.
+type Relabeler struct {
+	mu        sync.Mutex
+	rules     []*compiledRule
+	maxSeries int
+	series    map[string]map[string]int64 // metric name -> series key -> last seen (ms)
+	idle      time.Duration
+	now       func() time.Time
+}
+
+// New validates cfg and creates a relabeler
+func New(cfg Config) (*Relabeler, error) {
+	rules, err := compile(cfg.Rules)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxSeriesPerMetric < 0 {
+		return nil, fmt.Errorf("max_series_per_metric must not be negative, got %d", cfg.MaxSeriesPerMetric)
+	}
+	return &Relabeler{
+		rules:     rules,
+		maxSeries: cfg.MaxSeriesPerMetric,
+		series:    make(map[string]map[string]int64),
+		idle:      DefaultSeriesIdle,
+		now:       time.Now,
+	}, nil
+}
+
+// Update replaces the rules and series limit, e.g. on config reload
+// Series slots are kept so a reload does not let a new batch of series in.
+func (r *Relabeler) Update(cfg Config) error {
+	updated, err := New(cfg)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = updated.rules
+	r.maxSeries = updated.maxSeries
+	return nil
+}
+
+// Apply relabels metrics in place and returns the ones to keep
+// dropped counts the removed metrics by reason (ReasonRule, ReasonSeriesLimit).
+// A nil Relabeler keeps everything.
+func (r *Relabeler) Apply(metrics []*models.Metric) (kept []*models.Metric, dropped map[string]int) {
+	dropped = make(map[string]int)
+	if r == nil {
+		return metrics, dropped
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept = make([]*models.Metric, 0, len(metrics))
+	nowMs := r.now().UnixMilli()
+
+	for _, m := range metrics {
+		if !r.relabel(m) {
+			dropped[ReasonRule]++
+			continue
+		}
+		if !r.admit(m, nowMs) {
+			dropped[ReasonSeriesLimit]++
+			continue
+		}
+		kept = append(kept, m)
+	}
+	return kept, dropped
+}
+
+// relabel runs the rules on one metric and reports whether it is kept
+func (r *Relabeler) relabel(m *models.Metric) bool {
+	if len(r.rules) == 0 {
+		return true
+	}
+
+	labels := make(map[string]string, len(m.Tags)+1)
+	for k, v := range m.Tags {
+		labels[k] = v
+	}
+	labels[NameLabel] = m.Name
+	if m.Priority != models.PriorityDefault {
+		labels[PriorityLabel] = string(m.Priority)
+	}
+
+	for _, rule := range r.rules {
+		if !rule.apply(labels) {
+			return false
+		}
+	}
+
+	name := labels[NameLabel]
+	if name == "" {
+		return false
+	}
+	m.Name = name
+
+	// An invalid class from a capture group leaves the priority unchanged
+	if p, err := models.ParsePriority(labels[PriorityLabel]); err == nil {
+		m.Priority = p
+	}
+
+	tags := make(map[string]string, len(labels))
+	for k, v := range labels {
+		if strings.HasPrefix(k, "__") || v == "" {
+			continue
+		}
+		tags[k] = v
+	}
+	m.Tags = tags
+	return true
+}
+
+// admit enforces the per-metric series limit
+// Known series always pass; a new series takes a free slot, or the slot of a series idle for too long.
+func (r *Relabeler) admit(m *models.Metric, nowMs int64) bool {
+	if r.maxSeries <= 0 {
+		return true
+	}
+
+	known, ok := r.series[m.Name]
+	if !ok {
+		known = make(map[string]int64)
+		r.series[m.Name] = known
+	}
+
+	key := m.DeviceID + "\xff" + models.SeriesKey(m.Tags)
+	if _, ok := known[key]; ok {
+		known[key] = nowMs
+		return true
+	}
+
+	if len(known) >= r.maxSeries {
+		cutoff := nowMs - r.idle.Milliseconds()
+		for k, lastSeen := range known {
+			if lastSeen < cutoff {
+				delete(known, k)
+			}
+		}
+		if len(known) >= r.maxSeries {
+			return false
+		}
+	}
+	known[key] = nowMs
+	return true
+}
+
+// apply runs one rule on a label set and reports whether the metric is kept
+func (c *compiledRule) apply(labels map[string]string) bool {
+	switch c.action {
+	case ActionKeep:
+		return c.regex.MatchString(c.sourceValue(labels))
+	case ActionDrop:
+		return !c.regex.MatchString(c.sourceValue(labels))
+	case ActionReplace:
+		value := c.sourceValue(labels)
+		match := c.regex.FindStringSubmatchIndex(value)
+		if match == nil {
+			return true
+		}
+		target := string(c.regex.ExpandString(nil, c.targetLabel, value, match))
+		if target == "" {
+			return true
+		}
+		result := string(c.regex.ExpandString(nil, c.replacement, value, match))
+		if result == "" {
+			delete(labels, target)
+		} else {
+			labels[target] = result
+		}
+	case ActionHashMod:
+		sum := md5.Sum([]byte(c.sourceValue(labels)))
+		labels[c.targetLabel] = fmt.Sprintf("%d", binary.BigEndian.Uint64(sum[8:])%c.modulus)
+	case ActionLabelMap:
+		for name, value := range snapshot(labels) {
+			if match := c.regex.FindStringSubmatchIndex(name); match != nil {
+				labels[string(c.regex.ExpandString(nil, c.replacement, name, match))] = value
+			}
+		}
+	case ActionLabelDrop, ActionLabelKeep:
+		for name := range snapshot(labels) {
+			if name == NameLabel {
+				continue
+			}
+			if c.regex.MatchString(name) == (c.action == ActionLabelDrop) {
+				delete(labels, name)
+			}
+		}
+	}
+	return true
+}
+
+// sourceValue joins the values of the source labels (missing labels are empty)
+func (c *compiledRule) sourceValue(labels map[string]string) string {
+	values := make([]string, len(c.sourceLabels))
+	for i, name := range c.sourceLabels {
+		values[i] = labels[name]
+	}
+	return strings.Join(values, c.separator)
+}
+
+// compile validates rules and applies their defaults
+func compile(rules []Rule) ([]*compiledRule, error) {
+	compiled := make([]*compiledRule, 0, len(rules))
+	for i, rule := range rules {
+		c := &compiledRule{
+			action:       rule.Action,
+			sourceLabels: rule.SourceLabels,
+			separator:    rule.Separator,
+			targetLabel:  rule.TargetLabel,
+			replacement:  "$1",
+			modulus:      rule.Modulus,
+		}
+		if c.action == "" {
+			c.action = ActionReplace
+		}
+		if c.separator == "" {
+			c.separator = ";"
+		}
+		if rule.Replacement != nil {
+			c.replacement = *rule.Replacement
+		}
+
+		pattern := rule.Regex
+		if pattern == "" {
+			pattern = "(.*)"
+		}
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("relabel.rules[%d]: invalid regex %q: %w", i, pattern, err)
+		}
+		c.regex = re
+
+		switch c.action {
+		case ActionReplace:
+			if c.targetLabel == "" {
+				return nil, fmt.Errorf("relabel.rules[%d]: target_label is required for %s", i, c.action)
+			}
+			if c.targetLabel == PriorityLabel && !strings.Contains(c.replacement, "$") {
+				if _, err := models.ParsePriority(c.replacement); err != nil {
+					return nil, fmt.Errorf("relabel.rules[%d]: %s %w", i, PriorityLabel, err)
+				}
+			}
+		case ActionHashMod:
+			if c.targetLabel == "" {
+				return nil, fmt.Errorf("relabel.rules[%d]: target_label is required for %s", i, c.action)
+			}
+			if c.modulus == 0 {
+				return nil, fmt.Errorf("relabel.rules[%d]: modulus must be positive for %s", i, c.action)
+			}
+		case ActionKeep, ActionDrop:
+			if len(c.sourceLabels) == 0 {
+				return nil, fmt.Errorf("relabel.rules[%d]: source_labels is required for %s", i, c.action)
+			}
+		case ActionLabelMap, ActionLabelDrop, ActionLabelKeep:
+		default:
+			return nil, fmt.Errorf("relabel.rules[%d]: unknown action %q (valid: replace, keep, drop, hashmod, labelmap, labeldrop, labelkeep)", i, c.action)
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// snapshot copies labels so a rule can change the map while iterating
+func snapshot(labels map[string]string) map[string]string {
+	c := make(map[string]string, len(labels))
+	for k, v := range labels {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,266 @@
+package relabel
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+func strPtr(s string) *string { return &s }
+
+// mustNew creates a relabeler or fails the test
+func mustNew(t *testing.T, cfg Config) *Relabeler {
+	t.Helper()
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return r
+}
+
+func TestApply_DropAndKeep(t *testing.T) {
+	r := mustNew(t, Config{Rules: []Rule{
+		{Action: ActionDrop, SourceLabels: []string{NameLabel}, Regex: `disk\..*`},
+		{Action: ActionDrop, SourceLabels: []string{"interface"}, Regex: `veth.*|docker0`},
+	}})
+
+	metrics := []*models.Metric{
+		models.NewMetric("disk.read_ops_total", 1, "dev-1"),
+		models.NewMetric("network.rx_bytes_total", 2, "dev-1").WithTag("interface", "veth12ab"),
+		models.NewMetric("network.rx_bytes_total", 3, "dev-1").WithTag("interface", "eth0"),
+		models.NewMetric("cpu.usage_percent", 4, "dev-1"),
+	}
+	kept, dropped := r.Apply(metrics)
+	if len(kept) != 2 || dropped[ReasonRule] != 2 {
+		t.Fatalf("Expected 2 kept and 2 dropped by rules, got %d kept, %v", len(kept), dropped)
+	}
+	if kept[0].Tags["interface"] != "eth0" || kept[1].Name != "cpu.usage_percent" {
+		t.Errorf("Unexpected metrics kept: %s %v, %s", kept[0].Name, kept[0].Tags, kept[1].Name)
+	}
+
+	// Keep is anchored: "cpu" alone does not match cpu.usage_percent
+	r = mustNew(t, Config{Rules: []Rule{{Action: ActionKeep, SourceLabels: []string{NameLabel}, Regex: `cpu`}}})
+	kept, _ = r.Apply([]*models.Metric{models.NewMetric("cpu.usage_percent", 1, "dev-1")})
+	if len(kept) != 0 {
+		t.Error("Expected an anchored regex to drop a partial match")
+	}
+}
+
+func TestApply_RenameAndRewriteTags(t *testing.T) {
+	r := mustNew(t, Config{Rules: []Rule{
+		// Rename a metric
+		{SourceLabels: []string{NameLabel}, Regex: `thermal\.zone_temp`, TargetLabel: NameLabel, Replacement: strPtr("thermal.zone_temperature")},
+		// Rewrite a tag with a capture group
+		{SourceLabels: []string{"interface"}, Regex: `wwan(\d+)`, TargetLabel: "interface", Replacement: strPtr("modem$1")},
+		// Add a static tag (the default regex matches the empty source)
+		{TargetLabel: "site", Replacement: strPtr("van-3")},
+		// Remove a tag through an empty replacement
+		{TargetLabel: "zone_number", Replacement: strPtr("")},
+	}})
+
+	m := models.NewMetric("thermal.zone_temp", 41, "dev-1").
+		AsGauge("celsius").
+		WithTag("zone_number", "0").
+		WithTag("interface", "wwan1")
+	kept, _ := r.Apply([]*models.Metric{m})
+	if len(kept) != 1 {
+		t.Fatalf("Expected the metric to be kept, got %d", len(kept))
+	}
+
+	got := kept[0]
+	if got.Name != "thermal.zone_temperature" {
+		t.Errorf("Expected renamed metric, got %s", got.Name)
+	}
+	if got.Kind != models.KindGauge || got.Unit != "celsius" {
+		t.Errorf("Expected kind and unit kept across a rename, got %q/%q", got.Kind, got.Unit)
+	}
+	want := map[string]string{"interface": "modem1", "site": "van-3"}
+	if len(got.Tags) != len(want) {
+		t.Errorf("Expected tags %v, got %v", want, got.Tags)
+	}
+	for k, v := range want {
+		if got.Tags[k] != v {
+			t.Errorf("Expected %s=%s, got %v", k, v, got.Tags)
+		}
+	}
+}
+
+func TestApply_PriorityOverride(t *testing.T) {
+	r := mustNew(t, Config{Rules: []Rule{
+		// Streaming metrics are critical
+		{SourceLabels: []string{NameLabel}, Regex: `srt\..*`, TargetLabel: PriorityLabel, Replacement: strPtr("P0")},
+		// Demote whatever the collector marked P1 on virtual interfaces
+		{SourceLabels: []string{PriorityLabel, "interface"}, Regex: `P1;veth.*`, TargetLabel: PriorityLabel, Replacement: strPtr("p3")},
+	}})
+
+	srt := models.NewMetric("srt.packet_loss", 0.1, "dev-1")
+	veth := models.NewMetric("network.rx_bytes_total", 1, "dev-1").WithTag("interface", "veth0")
+	veth.Priority = models.PriorityP1
+	eth := models.NewMetric("network.rx_bytes_total", 1, "dev-1").WithTag("interface", "eth0")
+	eth.Priority = models.PriorityP1
+
+	kept, _ := r.Apply([]*models.Metric{srt, veth, eth})
+	if len(kept) != 3 {
+		t.Fatalf("Expected every metric kept, got %d", len(kept))
+	}
+	if srt.Priority != models.PriorityP0 || veth.Priority != models.PriorityP3 || eth.Priority != models.PriorityP1 {
+		t.Errorf("Expected P0/P3/P1, got %s/%s/%s", srt.Priority, veth.Priority, eth.Priority)
+	}
+	if _, ok := srt.Tags[PriorityLabel]; ok {
+		t.Error("Expected __priority__ removed from the tags")
+	}
+}
+
+func TestApply_EmptyNameDrops(t *testing.T) {
+	r := mustNew(t, Config{Rules: []Rule{{TargetLabel: NameLabel, Replacement: strPtr("")}}})
+	kept, dropped := r.Apply([]*models.Metric{models.NewMetric("cpu.usage_percent", 1, "dev-1")})
+	if len(kept) != 0 || dropped[ReasonRule] != 1 {
+		t.Errorf("Expected a metric without a name to be dropped, got %d kept, %v", len(kept), dropped)
+	}
+}
+
+func TestApply_HashMod(t *testing.T) {
+	r := mustNew(t, Config{Rules: []Rule{
+		{Action: ActionHashMod, SourceLabels: []string{"session"}, Modulus: 8, TargetLabel: "__shard"},
+		{SourceLabels: []string{"__shard"}, TargetLabel: "session"},
+	}})
+
+	shards := make(map[string]string)
+	for _, session := range []string{"a1", "b2", "c3", "d4", "e5", "a1"} {
+		m := models.NewMetric("srt.packet_loss_pct", 1, "dev-1").WithTag("session", session)
+		kept, _ := r.Apply([]*models.Metric{m})
+		shard := kept[0].Tags["session"]
+		if prev, ok := shards[session]; ok && prev != shard {
+			t.Errorf("Expected session %s to always map to shard %s, got %s", session, prev, shard)
+		}
+		shards[session] = shard
+
+		if len(shard) != 1 || shard < "0" || shard > "7" {
+			t.Errorf("Expected a shard in 0..7, got %q", shard)
+		}
+		if _, ok := kept[0].Tags["__shard"]; ok {
+			t.Error("Expected scratch labels to be removed")
+		}
+	}
+}
+
+func TestApply_LabelActions(t *testing.T) {
+	r := mustNew(t, Config{Rules: []Rule{
+		{Action: ActionLabelMap, Regex: `k8s_(.+)`, Replacement: strPtr("$1")},
+		{Action: ActionLabelDrop, Regex: `k8s_.*`},
+		{Action: ActionLabelKeep, Regex: `pod|namespace`},
+	}})
+
+	m := models.NewMetric("cpu.usage_percent", 1, "dev-1").
+		WithTag("k8s_pod", "encoder-0").
+		WithTag("k8s_namespace", "media").
+		WithTag("node", "van-3")
+	kept, _ := r.Apply([]*models.Metric{m})
+	if len(kept) != 1 {
+		t.Fatalf("Expected the metric to be kept, got %d", len(kept))
+	}
+	got := kept[0]
+	if got.Name != "cpu.usage_percent" {
+		t.Errorf("Expected labelkeep to leave the name alone, got %q", got.Name)
+	}
+	if len(got.Tags) != 2 || got.Tags["pod"] != "encoder-0" || got.Tags["namespace"] != "media" {
+		t.Errorf("Expected only pod and namespace, got %v", got.Tags)
+	}
+}
+
+func TestApply_SeriesLimit(t *testing.T) {
+	r := mustNew(t, Config{MaxSeriesPerMetric: 2})
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	batch := func(ifaces ...string) []*models.Metric {
+		var metrics []*models.Metric
+		for _, iface := range ifaces {
+			metrics = append(metrics, models.NewMetric("network.rx_bytes_total", 1, "dev-1").WithTag("interface", iface))
+		}
+		return metrics
+	}
+
+	kept, dropped := r.Apply(batch("eth0", "wwan0", "wwan1"))
+	if len(kept) != 2 || dropped[ReasonSeriesLimit] != 1 {
+		t.Fatalf("Expected the third series dropped, got %d kept, %v", len(kept), dropped)
+	}
+
+	// The limit is per metric name
+	kept, _ = r.Apply([]*models.Metric{models.NewMetric("network.tx_bytes_total", 1, "dev-1").WithTag("interface", "wwan1")})
+	if len(kept) != 1 {
+		t.Error("Expected another metric to have its own limit")
+	}
+
+	// Known series keep their slot while they report; an idle one gives it up
+	now = now.Add(DefaultSeriesIdle / 2)
+	if kept, _ := r.Apply(batch("eth0")); len(kept) != 1 {
+		t.Error("Expected a known series to pass")
+	}
+	now = now.Add(DefaultSeriesIdle/2 + time.Minute)
+	kept, dropped = r.Apply(batch("wwan1"))
+	if len(kept) != 1 || len(dropped) != 0 {
+		t.Errorf("Expected wwan1 to take the idle wwan0 slot, got %d kept, %v", len(kept), dropped)
+	}
+	if kept, _ := r.Apply(batch("wwan0")); len(kept) != 0 {
+		t.Error("Expected wwan0 to be over the limit once its slot was taken")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	r := mustNew(t, Config{Rules: []Rule{{Action: ActionDrop, SourceLabels: []string{NameLabel}, Regex: `cpu\..*`}}})
+	if kept, _ := r.Apply([]*models.Metric{models.NewMetric("cpu.usage_percent", 1, "dev-1")}); len(kept) != 0 {
+		t.Fatal("Expected cpu metrics dropped")
+	}
+
+	if err := r.Update(Config{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if kept, _ := r.Apply([]*models.Metric{models.NewMetric("cpu.usage_percent", 1, "dev-1")}); len(kept) != 1 {
+		t.Error("Expected cpu metrics kept after the rules were removed")
+	}
+
+	// An invalid update keeps the current rules
+	if err := r.Update(Config{Rules: []Rule{{Action: "explode"}}}); err == nil {
+		t.Error("Expected an invalid update to fail")
+	}
+	if kept, _ := r.Apply([]*models.Metric{models.NewMetric("cpu.usage_percent", 1, "dev-1")}); len(kept) != 1 {
+		t.Error("Expected the previous rules after a failed update")
+	}
+}
+
+func TestApply_NilRelabeler(t *testing.T) {
+	var r *Relabeler
+	metrics := []*models.Metric{models.NewMetric("cpu.usage_percent", 1, "dev-1")}
+	kept, dropped := r.Apply(metrics)
+	if len(kept) != 1 || len(dropped) != 0 {
+		t.Errorf("Expected a nil relabeler to keep everything, got %d kept, %v", len(kept), dropped)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"unknown action", Config{Rules: []Rule{{Action: "explode"}}}, "unknown action"},
+		{"bad regex", Config{Rules: []Rule{{Regex: "(", TargetLabel: "x"}}}, "invalid regex"},
+		{"replace without target", Config{Rules: []Rule{{SourceLabels: []string{"a"}}}}, "target_label is required"},
+		{"hashmod without modulus", Config{Rules: []Rule{{Action: ActionHashMod, TargetLabel: "x"}}}, "modulus must be positive"},
+		{"drop without source", Config{Rules: []Rule{{Action: ActionDrop, Regex: "x"}}}, "source_labels is required"},
+		{"invalid priority", Config{Rules: []Rule{{TargetLabel: PriorityLabel, Replacement: strPtr("P5")}}}, "priority must be P0, P1, P2 or P3"},
+		{"negative limit", Config{MaxSeriesPerMetric: -1}, "must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
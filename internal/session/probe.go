@@ -0,0 +1,52 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// commLen is the length the kernel truncates process names to in /proc/<pid>/comm
+const commLen = 15
+
+// processRunning reports whether a process named name is running
+// Processes that exit while being scanned are skipped.
+func processRunning(procRoot, name string) (bool, error) {
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return false, err
+	}
+	if len(name) > commLen {
+		name = name[:commLen]
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.Trim(entry.Name(), "0123456789") != "" {
+			continue
+		}
+		comm, err := os.ReadFile(filepath.Join(procRoot, entry.Name(), "comm"))
+		if err != nil {
+			continue
+		}
+		if strings.TrimSpace(string(comm)) == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// unitActive reports whether a systemd unit is active
+// systemctl is-active exits non-zero for every state other than active.
+func unitActive(ctx context.Context, systemctl, unit string) (bool, error) {
+	err := exec.CommandContext(ctx, systemctl, "is-active", "--quiet", unit).Run()
+	if err == nil {
+		return true, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return false, nil
+	}
+	return false, err
+}
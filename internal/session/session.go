@@ -0,0 +1,383 @@
+// Package session tracks streaming sessions: periods in which a configured trigger is active, such as
+// an encoder process running, a systemd unit being active or a metric above a threshold. Metrics
+// collected during a session are stamped with its ID, a summary is stored when it closes, and its
+// rows can be uploaded ahead of the rest of the backlog.
+package session
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+	"github.com/taniwha3/tidewatch/internal/storage"
+)
+
+const (
+	// DefaultCheckInterval is how often the triggers are evaluated
+	DefaultCheckInterval = 5 * time.Second
+
+	// DefaultCloseAfter is how long every trigger must be inactive before the session closes
+	DefaultCloseAfter = 30 * time.Second
+)
+
+// Trigger types
+const (
+	TriggerProcess = "process" // A process with this name is running
+	TriggerUnit    = "unit"    // A systemd unit is active
+	TriggerMetric  = "metric"  // A collected metric is above or below a threshold
+)
+
+// Trigger opens a session while it is active; exactly one of Process, Unit or Metric is set
+type Trigger struct {
+	Process string   // Process name as in /proc/<pid>/comm
+	Unit    string   // systemd unit name (e.g., "srt-stream.service")
+	Metric  string   // Metric name; active while any of its series crosses the threshold
+	Above   *float64 // Metric trigger: active while the value is above this
+	Below   *float64 // Metric trigger: active while the value is below this
+}
+
+// Type returns the trigger type
+func (t Trigger) Type() string {
+	switch {
+	case t.Process != "":
+		return TriggerProcess
+	case t.Unit != "":
+		return TriggerUnit
+	default:
+		return TriggerMetric
+	}
+}
+
+// String describes the trigger, e.g. "process:ffmpeg" or "metric:srt.bitrate_bps>100000"
+func (t Trigger) String() string {
+	switch t.Type() {
+	case TriggerProcess:
+		return TriggerProcess + ":" + t.Process
+	case TriggerUnit:
+		return TriggerUnit + ":" + t.Unit
+	}
+	s := TriggerMetric + ":" + t.Metric
+	if t.Above != nil {
+		s += ">" + strconv.FormatFloat(*t.Above, 'g', -1, 64)
+	}
+	if t.Below != nil {
+		s += "<" + strconv.FormatFloat(*t.Below, 'g', -1, 64)
+	}
+	return s
+}
+
+// crossed reports whether a metric value satisfies the threshold
+func (t Trigger) crossed(value float64) bool {
+	if t.Above != nil && value <= *t.Above {
+		return false
+	}
+	if t.Below != nil && value >= *t.Below {
+		return false
+	}
+	return t.Above != nil || t.Below != nil
+}
+
+// Store records sessions and decides which session's rows are uploaded first
+type Store interface {
+	OpenSession(ctx context.Context, session storage.Session) error
+	CloseSession(ctx context.Context, session storage.Session) error
+	InterruptSessions(ctx context.Context) ([]storage.Session, error)
+	SetPrioritySession(id string)
+}
+
+// Config configures a Manager
+type Config struct {
+	Triggers          []Trigger
+	CheckInterval     time.Duration // Default: 5s
+	CloseAfter        time.Duration // Default: 30s
+	PrioritizeUploads bool          // Upload the current (or last) session's rows before the backlog
+	DeviceID          string        // Device ID of the summary metrics
+	ProcRoot          string        // Default: /proc
+	SystemctlPath     string        // Default: systemctl
+	Logger            *slog.Logger
+}
+
+// Manager opens and closes sessions and stamps collected metrics with the active session
+// It implements storage.BatchWriter: collectors write through it to the next writer.
+// Only one session is open at a time; it lasts while any trigger is active.
+type Manager struct {
+	store             Store
+	writer            storage.BatchWriter
+	logger            *slog.Logger
+	triggers          []Trigger
+	checkInterval     time.Duration
+	closeAfter        time.Duration
+	prioritizeUploads bool
+	deviceID          string
+
+	// System access, replaced in tests
+	now            func() time.Time
+	processRunning func(name string) (bool, error)
+	unitActive     func(ctx context.Context, unit string) (bool, error)
+
+	probeErrs map[string]string // Last probe error per trigger, so repeats are not logged every check
+
+	mu        sync.Mutex
+	active    *storage.Session              // nil outside a session
+	lastFired time.Time                     // Last check that found a trigger active
+	watched   map[string]bool               // Metric names used by metric triggers
+	values    map[string]map[string]float64 // Latest value per series of each watched metric
+}
+
+// New creates a session manager that writes collected metrics and summaries to writer
+func New(cfg Config, store Store, writer storage.BatchWriter) *Manager {
+	m := &Manager{
+		store:             store,
+		writer:            writer,
+		logger:            cfg.Logger,
+		triggers:          cfg.Triggers,
+		checkInterval:     cfg.CheckInterval,
+		closeAfter:        cfg.CloseAfter,
+		prioritizeUploads: cfg.PrioritizeUploads,
+		deviceID:          cfg.DeviceID,
+		now:               time.Now,
+		probeErrs:         make(map[string]string),
+		watched:           make(map[string]bool),
+		values:            make(map[string]map[string]float64),
+	}
+	if m.logger == nil {
+		m.logger = slog.Default()
+	}
+	if m.checkInterval <= 0 {
+		m.checkInterval = DefaultCheckInterval
+	}
+	if m.closeAfter <= 0 {
+		m.closeAfter = DefaultCloseAfter
+	}
+
+	procRoot := cfg.ProcRoot
+	if procRoot == "" {
+		procRoot = "/proc"
+	}
+	m.processRunning = func(name string) (bool, error) { return processRunning(procRoot, name) }
+
+	systemctl := cfg.SystemctlPath
+	if systemctl == "" {
+		systemctl = "systemctl"
+	}
+	m.unitActive = func(ctx context.Context, unit string) (bool, error) { return unitActive(ctx, systemctl, unit) }
+
+	for _, t := range m.triggers {
+		if t.Type() == TriggerMetric {
+			m.watched[t.Metric] = true
+		}
+	}
+	return m
+}
+
+// StoreBatch stamps metrics with the active session, feeds metric triggers and writes them
+func (m *Manager) StoreBatch(ctx context.Context, metrics []*models.Metric) error {
+	m.mu.Lock()
+	for _, metric := range metrics {
+		if m.watched[metric.Name] && metric.ValueType == models.ValueTypeNumeric {
+			series := m.values[metric.Name]
+			if series == nil {
+				series = make(map[string]float64)
+				m.values[metric.Name] = series
+			}
+			series[models.SeriesKey(metric.Tags)] = metric.Value
+		}
+	}
+	if m.active != nil {
+		for _, metric := range metrics {
+			metric.SessionID = m.active.ID
+		}
+		m.active.Samples += int64(len(metrics))
+	}
+	m.mu.Unlock()
+
+	return m.writer.StoreBatch(ctx, metrics)
+}
+
+// Active returns the open session, if any
+func (m *Manager) Active() (storage.Session, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.active == nil {
+		return storage.Session{}, false
+	}
+	return *m.active, true
+}
+
+// Start evaluates the triggers every check interval until ctx is cancelled
+// Sessions left active by a previous run are closed as interrupted first.
+// Call Close after Start returns to close a session that is still open.
+func (m *Manager) Start(ctx context.Context) {
+	interrupted, err := m.store.InterruptSessions(ctx)
+	if err != nil {
+		m.logger.Error("Failed to close sessions of a previous run", slog.Any("error", err))
+	}
+	for _, s := range interrupted {
+		m.logger.Warn("Closed session interrupted by a previous run",
+			slog.String("session_id", s.ID),
+			slog.String("trigger", s.Trigger),
+			slog.Int64("samples", s.Samples),
+		)
+		m.storeSummary(ctx, s)
+	}
+
+	ticker := time.NewTicker(m.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		m.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes the open session as interrupted, e.g. on shutdown
+func (m *Manager) Close(ctx context.Context) {
+	m.close(ctx, storage.SessionInterrupted, m.now())
+}
+
+// check opens a session when a trigger fires and closes it once none has fired for CloseAfter
+func (m *Manager) check(ctx context.Context) {
+	trigger := m.firing(ctx)
+	now := m.now()
+
+	m.mu.Lock()
+	if trigger != "" {
+		m.lastFired = now
+	}
+	open := m.active != nil
+	idle := now.Sub(m.lastFired)
+	m.mu.Unlock()
+
+	switch {
+	case trigger != "" && !open:
+		m.open(ctx, trigger, now)
+	case trigger == "" && open && idle >= m.closeAfter:
+		m.close(ctx, storage.SessionEnded, now)
+	}
+}
+
+// firing returns the first active trigger, or "" if none is
+func (m *Manager) firing(ctx context.Context) string {
+	for _, t := range m.triggers {
+		var active bool
+		var err error
+		switch t.Type() {
+		case TriggerProcess:
+			active, err = m.processRunning(t.Process)
+		case TriggerUnit:
+			active, err = m.unitActive(ctx, t.Unit)
+		case TriggerMetric:
+			active = m.metricCrossed(t)
+		}
+
+		name := t.String()
+		if err != nil {
+			if m.probeErrs[name] != err.Error() {
+				m.logger.Warn("Failed to check session trigger", slog.String("trigger", name), slog.Any("error", err))
+			}
+			m.probeErrs[name] = err.Error()
+			continue
+		}
+		delete(m.probeErrs, name)
+		if active {
+			return name
+		}
+	}
+	return ""
+}
+
+// metricCrossed reports whether any series of the trigger's metric last crossed the threshold
+func (m *Manager) metricCrossed(t Trigger) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, value := range m.values[t.Metric] {
+		if t.crossed(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) open(ctx context.Context, trigger string, now time.Time) {
+	s := storage.Session{
+		ID:      storage.NewID(now),
+		Start:   now,
+		Status:  storage.SessionActive,
+		Trigger: trigger,
+	}
+	if err := m.store.OpenSession(ctx, s); err != nil {
+		// Retried on the next check
+		m.logger.Error("Failed to open session", slog.String("trigger", trigger), slog.Any("error", err))
+		return
+	}
+
+	m.mu.Lock()
+	m.active = &s
+	m.mu.Unlock()
+
+	if m.prioritizeUploads {
+		m.store.SetPrioritySession(s.ID)
+	}
+	m.logger.Info("Session started", slog.String("session_id", s.ID), slog.String("trigger", trigger))
+}
+
+// close ends the open session and stores its summary
+// The session stays the upload priority, so the rest of its rows still go first until the next one opens.
+func (m *Manager) close(ctx context.Context, status string, now time.Time) {
+	m.mu.Lock()
+	if m.active == nil {
+		m.mu.Unlock()
+		return
+	}
+	s := *m.active
+	m.active = nil
+	m.mu.Unlock()
+
+	s.End = now
+	s.Status = status
+	if err := m.store.CloseSession(ctx, s); err != nil {
+		m.logger.Error("Failed to close session", slog.String("session_id", s.ID), slog.Any("error", err))
+	}
+	m.storeSummary(ctx, s)
+	m.logger.Info("Session ended",
+		slog.String("session_id", s.ID),
+		slog.String("status", status),
+		slog.Duration("duration", s.End.Sub(s.Start)),
+		slog.Int64("samples", s.Samples),
+	)
+}
+
+// storeSummary writes the session's duration and sample count as metrics, so they are uploaded with its data
+func (m *Manager) storeSummary(ctx context.Context, s storage.Session) {
+	summary := func(name string, value float64, unit string) *models.Metric {
+		return &models.Metric{
+			Name:        name,
+			TimestampMs: s.End.UnixMilli(),
+			Value:       value,
+			ValueType:   models.ValueTypeNumeric,
+			DeviceID:    m.deviceID,
+			Kind:        models.KindGauge,
+			Unit:        unit,
+			SessionID:   s.ID,
+			Tags: map[string]string{
+				"session_id": s.ID,
+				"trigger":    s.Trigger,
+				"status":     s.Status,
+			},
+		}
+	}
+	metrics := []*models.Metric{
+		summary("session.duration_seconds", s.End.Sub(s.Start).Seconds(), "seconds"),
+		summary("session.samples", float64(s.Samples), ""),
+	}
+	if err := m.writer.StoreBatch(ctx, metrics); err != nil {
+		m.logger.Error("Failed to store session summary", slog.String("session_id", s.ID), slog.Any("error", err))
+	}
+}
@@ -0,0 +1,270 @@
+package session
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+	"github.com/taniwha3/tidewatch/internal/storage"
+)
+
+// fakeStore records session changes
+type fakeStore struct {
+	mu          sync.Mutex
+	opened      []storage.Session
+	closed      []storage.Session
+	interrupted []storage.Session // Returned by the next InterruptSessions
+	priority    string
+}
+
+func (s *fakeStore) OpenSession(ctx context.Context, session storage.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opened = append(s.opened, session)
+	return nil
+}
+
+func (s *fakeStore) CloseSession(ctx context.Context, session storage.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = append(s.closed, session)
+	return nil
+}
+
+func (s *fakeStore) InterruptSessions(ctx context.Context) ([]storage.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := s.interrupted
+	s.interrupted = nil
+	return sessions, nil
+}
+
+func (s *fakeStore) SetPrioritySession(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.priority = id
+}
+
+// fakeWriter keeps written metrics in memory
+type fakeWriter struct {
+	metrics []*models.Metric
+}
+
+func (w *fakeWriter) StoreBatch(ctx context.Context, metrics []*models.Metric) error {
+	w.metrics = append(w.metrics, metrics...)
+	return nil
+}
+
+// newTestManager builds a manager on a fake clock with stubbed process and unit probes
+func newTestManager(cfg Config, store *fakeStore, writer *fakeWriter, now *time.Time, running map[string]bool) *Manager {
+	cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	m := New(cfg, store, writer)
+	m.now = func() time.Time { return *now }
+	m.processRunning = func(name string) (bool, error) { return running["process:"+name], nil }
+	m.unitActive = func(ctx context.Context, unit string) (bool, error) { return running["unit:"+unit], nil }
+	return m
+}
+
+func store(t *testing.T, m *Manager, metrics ...*models.Metric) {
+	t.Helper()
+	if err := m.StoreBatch(context.Background(), metrics); err != nil {
+		t.Fatalf("StoreBatch failed: %v", err)
+	}
+}
+
+func TestManager_SessionLifecycle(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	running := map[string]bool{}
+	st, w := &fakeStore{}, &fakeWriter{}
+	m := newTestManager(Config{
+		Triggers:          []Trigger{{Process: "ffmpeg"}, {Unit: "srt-stream.service"}},
+		CloseAfter:        30 * time.Second,
+		PrioritizeUploads: true,
+		DeviceID:          "device-001",
+	}, st, w, &now, running)
+
+	// Outside a session metrics are not stamped
+	m.check(ctx)
+	store(t, m, models.NewMetric("cpu.usage", 10, "device-001"))
+	if w.metrics[0].SessionID != "" {
+		t.Errorf("Expected no session ID, got %q", w.metrics[0].SessionID)
+	}
+
+	running["unit:srt-stream.service"] = true
+	m.check(ctx)
+	active, ok := m.Active()
+	if !ok || active.Trigger != "unit:srt-stream.service" || len(st.opened) != 1 {
+		t.Fatalf("Expected a session opened by the unit, got %+v (opened %d)", active, len(st.opened))
+	}
+	if st.priority != active.ID {
+		t.Errorf("Expected the session to become the upload priority, got %q", st.priority)
+	}
+
+	store(t, m, models.NewMetric("cpu.usage", 20, "device-001"), models.NewMetric("srt.bitrate_bps", 4e6, "device-001"))
+	if w.metrics[1].SessionID != active.ID || w.metrics[2].SessionID != active.ID {
+		t.Error("Expected metrics collected during the session to be stamped")
+	}
+
+	// The trigger stops: the session stays open for the grace period
+	running["unit:srt-stream.service"] = false
+	now = now.Add(20 * time.Second)
+	m.check(ctx)
+	if _, ok := m.Active(); !ok {
+		t.Fatal("Expected the session to stay open within close_after")
+	}
+
+	now = now.Add(20 * time.Second)
+	m.check(ctx)
+	if _, ok := m.Active(); ok {
+		t.Fatal("Expected the session to close after close_after")
+	}
+	if len(st.closed) != 1 {
+		t.Fatalf("Expected one closed session, got %d", len(st.closed))
+	}
+	closed := st.closed[0]
+	if closed.Status != storage.SessionEnded || closed.Samples != 2 || closed.End.Sub(closed.Start) != 40*time.Second {
+		t.Errorf("Unexpected closed session %+v", closed)
+	}
+
+	// Summary metrics carry the session ID, both as a tag and stamped
+	summary := w.metrics[len(w.metrics)-2:]
+	if summary[0].Name != "session.duration_seconds" || summary[0].Value != 40 || summary[0].Unit != "seconds" {
+		t.Errorf("Unexpected duration summary %+v", summary[0])
+	}
+	if summary[1].Name != "session.samples" || summary[1].Value != 2 {
+		t.Errorf("Unexpected samples summary %+v", summary[1])
+	}
+	for _, s := range summary {
+		if s.SessionID != closed.ID || s.Tags["session_id"] != closed.ID || s.Tags["status"] != storage.SessionEnded || s.DeviceID != "device-001" {
+			t.Errorf("Summary not tied to the session: %+v", s)
+		}
+	}
+
+	// The ended session keeps upload priority until the next one opens
+	if st.priority != closed.ID {
+		t.Errorf("Expected the ended session to keep priority, got %q", st.priority)
+	}
+}
+
+func TestManager_MetricTrigger(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	above := 100000.0
+	st, w := &fakeStore{}, &fakeWriter{}
+	m := newTestManager(Config{
+		Triggers:   []Trigger{{Metric: "srt.bitrate_bps", Above: &above}},
+		CloseAfter: time.Second,
+	}, st, w, &now, nil)
+
+	store(t, m, models.NewMetric("srt.bitrate_bps", 50000, "device-001").WithTag("stream", "a"))
+	m.check(ctx)
+	if _, ok := m.Active(); ok {
+		t.Fatal("Expected no session below the threshold")
+	}
+
+	// Any series over the threshold fires the trigger
+	store(t, m, models.NewMetric("srt.bitrate_bps", 4e6, "device-001").WithTag("stream", "b"))
+	m.check(ctx)
+	active, ok := m.Active()
+	if !ok || active.Trigger != "metric:srt.bitrate_bps>100000" {
+		t.Fatalf("Expected a session opened by the metric, got %+v", active)
+	}
+	if st.priority != "" {
+		t.Errorf("Expected no upload priority when prioritize_uploads is off, got %q", st.priority)
+	}
+
+	store(t, m, models.NewMetric("srt.bitrate_bps", 0, "device-001").WithTag("stream", "b"))
+	now = now.Add(time.Second)
+	m.check(ctx)
+	if _, ok := m.Active(); ok {
+		t.Error("Expected the session to close once every series dropped below the threshold")
+	}
+}
+
+func TestManager_InterruptedSessions(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	leftover := storage.Session{
+		ID: "20260301T090000Z-0a1b2c3d", Start: now.Add(-time.Hour), End: now.Add(-50 * time.Minute),
+		Status: storage.SessionInterrupted, Trigger: "process:ffmpeg", Samples: 600,
+	}
+	st, w := &fakeStore{interrupted: []storage.Session{leftover}}, &fakeWriter{}
+	running := map[string]bool{"process:ffmpeg": true}
+	m := newTestManager(Config{Triggers: []Trigger{{Process: "ffmpeg"}}}, st, w, &now, running)
+
+	// Start closes leftovers with a summary, then opens a new session right away
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	m.Start(ctx)
+
+	if len(w.metrics) != 2 || w.metrics[0].SessionID != leftover.ID || w.metrics[0].Value != 600 {
+		t.Fatalf("Expected a summary of the interrupted session, got %d metrics", len(w.metrics))
+	}
+	if _, ok := m.Active(); !ok {
+		t.Fatal("Expected a new session to open on the first check")
+	}
+
+	// Shutting down mid-session closes it as interrupted
+	m.Close(context.Background())
+	if len(st.closed) != 1 || st.closed[0].Status != storage.SessionInterrupted {
+		t.Errorf("Expected the session closed as interrupted, got %+v", st.closed)
+	}
+}
+
+func TestProcessRunning(t *testing.T) {
+	root := t.TempDir()
+	for pid, comm := range map[string]string{"1": "systemd", "412": "ffmpeg", "977": "gst-launch-1.0"} {
+		if err := os.MkdirAll(filepath.Join(root, pid), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, pid, "comm"), []byte(comm+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Not a process
+	if err := os.MkdirAll(filepath.Join(root, "sys"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]bool{
+		"ffmpeg":                true,
+		"ffmpe":                 false,
+		"gst-launch-1.0":        true,
+		"gst-launch-1.0-extras": false, // Truncated to "gst-launch-1.0-", which differs
+		"sys":                   false,
+	}
+	for name, want := range tests {
+		got, err := processRunning(root, name)
+		if err != nil {
+			t.Fatalf("processRunning failed: %v", err)
+		}
+		if got != want {
+			t.Errorf("processRunning(%q) = %v, want %v", name, got, want)
+		}
+	}
+
+	if _, err := processRunning(filepath.Join(root, "missing"), "ffmpeg"); err == nil {
+		t.Error("Expected an error without /proc")
+	}
+}
+
+func TestTriggerString(t *testing.T) {
+	above, below := 1e5, 0.5
+	tests := map[string]Trigger{
+		"process:ffmpeg":                {Process: "ffmpeg"},
+		"unit:srt-stream.service":       {Unit: "srt-stream.service"},
+		"metric:srt.bitrate_bps>100000": {Metric: "srt.bitrate_bps", Above: &above},
+		"metric:srt.rtt_ms<0.5":         {Metric: "srt.rtt_ms", Below: &below},
+	}
+	for want, trigger := range tests {
+		if got := trigger.String(); got != want {
+			t.Errorf("String() = %q, want %q", got, want)
+		}
+	}
+}
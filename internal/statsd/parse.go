@@ -0,0 +1,131 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Metric types of the line protocol
+const (
+	TypeCounter = "c"
+	TypeGauge   = "g"
+	TypeTimer   = "ms"
+	TypeSet     = "s"
+)
+
+// errUnsupported marks DogStatsD events and service checks, which are not metrics
+var errUnsupported = errors.New("events and service checks are not supported")
+
+// Sample is one parsed metric line
+type Sample struct {
+	Name   string
+	Type   string            // TypeCounter, TypeGauge, TypeTimer or TypeSet
+	Values []string          // Several with the DogStatsD "name:1:2:3|ms" form; set members are kept as is
+	Rate   float64           // Sample rate in (0, 1]
+	Tags   map[string]string // DogStatsD tags; a tag without a value is set to "true"
+}
+
+// ParseLine parses one line of the StatsD protocol with DogStatsD extensions:
+//
+//	<name>:<value>[:<value>...]|<type>[|@<rate>][|#<tag>:<value>,<tag>...]
+//
+// Types are c, g, ms, h, d and s; h (histogram) and d (distribution) are aggregated as timers.
+// A gauge value starting with + or - changes the current value instead of setting it.
+func ParseLine(line string) (Sample, error) {
+	if strings.HasPrefix(line, "_e{") || strings.HasPrefix(line, "_sc|") {
+		return Sample{}, errUnsupported
+	}
+
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok {
+		return Sample{}, fmt.Errorf("expected name:value")
+	}
+	name = sanitizeName(name)
+	if name == "" {
+		return Sample{}, fmt.Errorf("empty metric name")
+	}
+
+	sections := strings.Split(rest, "|")
+	if len(sections) < 2 {
+		return Sample{}, fmt.Errorf("%s: missing type", name)
+	}
+	s := Sample{Name: name, Values: strings.Split(sections[0], ":"), Rate: 1}
+
+	switch t := sections[1]; t {
+	case TypeCounter, TypeGauge, TypeSet:
+		s.Type = t
+	case TypeTimer, "h", "d":
+		s.Type = TypeTimer
+	default:
+		return Sample{}, fmt.Errorf("%s: unknown type %q", name, t)
+	}
+
+	for _, v := range s.Values {
+		if v == "" {
+			return Sample{}, fmt.Errorf("%s: empty value", name)
+		}
+		if s.Type == TypeSet {
+			continue
+		}
+		// NaN and infinities can be neither aggregated nor stored
+		if f, err := strconv.ParseFloat(v, 64); err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return Sample{}, fmt.Errorf("%s: invalid value %q", name, v)
+		}
+	}
+
+	for _, section := range sections[2:] {
+		switch {
+		case strings.HasPrefix(section, "@"):
+			rate, err := strconv.ParseFloat(section[1:], 64)
+			if err != nil || !(rate > 0 && rate <= 1) {
+				return Sample{}, fmt.Errorf("%s: invalid sample rate %q", name, section)
+			}
+			s.Rate = rate
+		case strings.HasPrefix(section, "#"):
+			tags, err := parseTags(section[1:])
+			if err != nil {
+				return Sample{}, fmt.Errorf("%s: %w", name, err)
+			}
+			s.Tags = tags
+		case strings.HasPrefix(section, "c:"), strings.HasPrefix(section, "T"):
+			// DogStatsD container ID and client timestamp: the flush time is used instead
+		default:
+			return Sample{}, fmt.Errorf("%s: unknown section %q", name, section)
+		}
+	}
+	return s, nil
+}
+
+// parseTags parses DogStatsD tags: "env:prod,canary"
+func parseTags(s string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(s, ",") {
+		if tag == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(tag, ":")
+		if key == "" {
+			return nil, fmt.Errorf("invalid tag %q", tag)
+		}
+		if !ok {
+			value = "true"
+		}
+		tags[sanitizeName(key)] = value
+	}
+	return tags, nil
+}
+
+// sanitizeName replaces characters that are not valid in metric and tag names with underscores
+func sanitizeName(name string) string {
+	name = strings.TrimSpace(name)
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, name)
+}
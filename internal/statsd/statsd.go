@@ -0,0 +1,402 @@
+// Package statsd receives application metrics pushed over UDP in the StatsD line protocol, with
+// DogStatsD tags. Samples are aggregated per flush interval and written to storage as one batch,
+// so scripts can fire-and-forget counters, gauges, timers and sets at localhost:8125.
+package statsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+	"github.com/taniwha3/tidewatch/internal/storage"
+)
+
+const (
+	// DefaultAddress only accepts packets from the device itself
+	DefaultAddress = "127.0.0.1:8125"
+
+	// DefaultFlushInterval is how often aggregates are written to storage
+	DefaultFlushInterval = 10 * time.Second
+
+	// DefaultMaxSeries caps the series held between flushes; samples of new series beyond it are dropped
+	DefaultMaxSeries = 10000
+
+	// DefaultIdleTimeout is how long counters and gauges are reported after their last sample
+	DefaultIdleTimeout = time.Hour
+
+	// maxTimerSamples caps the samples kept per timer and interval for percentiles
+	// Count, min, max and average still cover every sample.
+	maxTimerSamples = 1000
+
+	// maxPacketSize is the largest UDP payload
+	maxPacketSize = 65535
+
+	// rebindDelay is how long to wait before retrying a failed bind
+	rebindDelay = 5 * time.Second
+)
+
+// Drop reasons reported to the Recorder
+const (
+	DropSeriesLimit = "series_limit" // New series beyond MaxSeries
+	DropUnsupported = "unsupported"  // DogStatsD events and service checks
+	DropStore       = "store"        // Flushed metrics the writer failed to store
+)
+
+// Recorder receives the listener's malformed and drop counts at each flush
+// monitoring.MetricsCollector implements it.
+type Recorder interface {
+	RecordStatsDMalformed(count int)
+	RecordStatsDDropped(reason string, count int)
+}
+
+// Config configures a Listener
+type Config struct {
+	Address       string        // UDP address to listen on (default: 127.0.0.1:8125)
+	FlushInterval time.Duration // Default: 10s
+	MaxSeries     int           // Default: 10000
+	IdleTimeout   time.Duration // Default: 1h
+	DeviceID      string
+	Recorder      Recorder // Optional
+	Logger        *slog.Logger
+}
+
+// Listener aggregates StatsD samples and writes them to storage on every flush
+//
+// Each flush writes:
+//   - counters as a running total since the listener started (kind counter)
+//   - gauges as their last value
+//   - timers as <name>_count, _min, _max, _avg, _p50, _p95 and _p99 over the interval
+//   - sets as the number of unique members seen in the interval
+//
+// Counters and gauges are reported until they have been idle for IdleTimeout; timers and sets
+// only when they received samples in the interval.
+type Listener struct {
+	address       string
+	flushInterval time.Duration
+	maxSeries     int
+	idleTimeout   time.Duration
+	deviceID      string
+	recorder      Recorder
+	writer        storage.BatchWriter
+	logger        *slog.Logger
+	now           func() time.Time
+
+	mu        sync.Mutex
+	series    map[string]*aggregate // Series key -> aggregate
+	malformed int                   // Lines that failed to parse since the last flush
+	dropped   map[string]int        // Drop reason -> lines dropped since the last flush
+	addr      net.Addr              // Bound address, nil while not listening
+}
+
+// aggregate is the state of one series between flushes
+type aggregate struct {
+	name     string
+	typ      string
+	tags     map[string]string
+	lastSeen time.Time
+
+	value float64 // Counter total or gauge value
+
+	// Timers
+	count    float64 // Samples, scaled by their sample rate
+	sum      float64
+	min, max float64
+	samples  []float64
+
+	// Sets
+	members map[string]struct{}
+}
+
+// New creates a listener that writes aggregates to writer
+func New(cfg Config, writer storage.BatchWriter) *Listener {
+	l := &Listener{
+		address:       cfg.Address,
+		flushInterval: cfg.FlushInterval,
+		maxSeries:     cfg.MaxSeries,
+		idleTimeout:   cfg.IdleTimeout,
+		deviceID:      cfg.DeviceID,
+		recorder:      cfg.Recorder,
+		writer:        writer,
+		logger:        cfg.Logger,
+		now:           time.Now,
+		series:        make(map[string]*aggregate),
+		dropped:       make(map[string]int),
+	}
+	if l.address == "" {
+		l.address = DefaultAddress
+	}
+	if l.flushInterval <= 0 {
+		l.flushInterval = DefaultFlushInterval
+	}
+	if l.maxSeries <= 0 {
+		l.maxSeries = DefaultMaxSeries
+	}
+	if l.idleTimeout <= 0 {
+		l.idleTimeout = DefaultIdleTimeout
+	}
+	if l.logger == nil {
+		l.logger = slog.Default()
+	}
+	return l
+}
+
+// Addr returns the address the listener is bound to, or nil while it is not listening
+func (l *Listener) Addr() net.Addr {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.addr
+}
+
+// Start receives packets and flushes on the interval until ctx is done
+// A failed bind (e.g., the port is taken) is logged and retried. Call Flush after Start returns
+// to write the last partial interval.
+func (l *Listener) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		l.serve(ctx)
+	}()
+	defer wg.Wait()
+
+	ticker := time.NewTicker(l.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.Flush(ctx); err != nil {
+				l.logger.Error("Failed to store StatsD metrics", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// serve listens for packets until ctx is done, binding again after a failure
+func (l *Listener) serve(ctx context.Context) {
+	for {
+		err := l.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		l.logger.Error("StatsD listener failed",
+			slog.String("address", l.address),
+			slog.Any("error", err),
+		)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(rebindDelay):
+		}
+	}
+}
+
+// listen binds the socket and handles packets until reading fails or ctx is done
+func (l *Listener) listen(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", l.address)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	defer conn.Close()
+
+	l.mu.Lock()
+	l.addr = conn.LocalAddr()
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.addr = nil
+		l.mu.Unlock()
+	}()
+	l.logger.Info("StatsD listener started", slog.String("address", conn.LocalAddr().String()))
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if n > 0 {
+			l.HandlePacket(buf[:n])
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// HandlePacket aggregates the newline-separated lines of one packet
+func (l *Listener) HandlePacket(packet []byte) {
+	var samples []Sample
+	malformed, unsupported := 0, 0
+	for _, line := range strings.Split(string(packet), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+		s, err := ParseLine(line)
+		switch {
+		case errors.Is(err, errUnsupported):
+			unsupported++
+		case err != nil:
+			malformed++
+			l.logger.Debug("Malformed StatsD line", slog.String("line", line), slog.Any("error", err))
+		default:
+			samples = append(samples, s)
+		}
+	}
+
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.malformed += malformed
+	if unsupported > 0 {
+		l.dropped[DropUnsupported] += unsupported
+	}
+	for _, s := range samples {
+		l.add(s, now)
+	}
+}
+
+// add aggregates one sample; the caller holds l.mu
+func (l *Listener) add(s Sample, now time.Time) {
+	key := s.Type + "|" + s.Name + "|" + models.SeriesKey(s.Tags)
+	agg, ok := l.series[key]
+	if !ok {
+		if len(l.series) >= l.maxSeries {
+			l.dropped[DropSeriesLimit]++
+			return
+		}
+		agg = &aggregate{name: s.Name, typ: s.Type, tags: s.Tags}
+		l.series[key] = agg
+	}
+	agg.lastSeen = now
+
+	for _, v := range s.Values {
+		switch s.Type {
+		case TypeCounter:
+			f, _ := strconv.ParseFloat(v, 64)
+			agg.value += f / s.Rate
+		case TypeGauge:
+			f, _ := strconv.ParseFloat(v, 64)
+			if v[0] == '+' || v[0] == '-' {
+				agg.value += f
+			} else {
+				agg.value = f
+			}
+		case TypeTimer:
+			f, _ := strconv.ParseFloat(v, 64)
+			if agg.count == 0 || f < agg.min {
+				agg.min = f
+			}
+			if agg.count == 0 || f > agg.max {
+				agg.max = f
+			}
+			agg.count += 1 / s.Rate
+			agg.sum += f / s.Rate
+			if len(agg.samples) < maxTimerSamples {
+				agg.samples = append(agg.samples, f)
+			}
+		case TypeSet:
+			if agg.members == nil {
+				agg.members = make(map[string]struct{})
+			}
+			agg.members[v] = struct{}{}
+		}
+	}
+}
+
+// Flush writes the aggregates of the interval to storage and starts a new interval
+func (l *Listener) Flush(ctx context.Context) error {
+	now := l.now()
+
+	l.mu.Lock()
+	metrics := l.collect(now)
+	malformed := l.malformed
+	dropped := l.dropped
+	l.malformed = 0
+	l.dropped = make(map[string]int)
+	l.mu.Unlock()
+
+	var err error
+	if len(metrics) > 0 {
+		if err = l.writer.StoreBatch(ctx, metrics); err != nil {
+			dropped[DropStore] += len(metrics)
+			err = fmt.Errorf("failed to store %d metrics: %w", len(metrics), err)
+		}
+	}
+
+	if l.recorder != nil {
+		l.recorder.RecordStatsDMalformed(malformed)
+		for reason, count := range dropped {
+			l.recorder.RecordStatsDDropped(reason, count)
+		}
+	}
+	return err
+}
+
+// collect builds the metrics of every series, resets timers and sets, and forgets idle series
+// The caller holds l.mu.
+func (l *Listener) collect(now time.Time) []*models.Metric {
+	var metrics []*models.Metric
+	metric := func(agg *aggregate, name string, value float64, kind models.Kind) {
+		m := models.NewMetric(name, value, l.deviceID).WithTimestamp(now).WithKind(kind)
+		for k, v := range agg.tags {
+			m.WithTag(k, v)
+		}
+		metrics = append(metrics, m)
+	}
+
+	for key, agg := range l.series {
+		switch agg.typ {
+		case TypeCounter, TypeGauge:
+			if now.Sub(agg.lastSeen) > l.idleTimeout {
+				delete(l.series, key)
+				continue
+			}
+			kind := models.KindGauge
+			if agg.typ == TypeCounter {
+				kind = models.KindCounter
+			}
+			metric(agg, agg.name, agg.value, kind)
+		case TypeTimer:
+			p50, p95, p99 := percentiles(agg.samples)
+			metric(agg, agg.name+"_count", agg.count, models.KindGauge)
+			metric(agg, agg.name+"_min", agg.min, models.KindGauge)
+			metric(agg, agg.name+"_max", agg.max, models.KindGauge)
+			metric(agg, agg.name+"_avg", agg.sum/agg.count, models.KindGauge)
+			metric(agg, agg.name+"_p50", p50, models.KindGauge)
+			metric(agg, agg.name+"_p95", p95, models.KindGauge)
+			metric(agg, agg.name+"_p99", p99, models.KindGauge)
+			delete(l.series, key)
+		case TypeSet:
+			metric(agg, agg.name, float64(len(agg.members)), models.KindGauge)
+			delete(l.series, key)
+		}
+	}
+	return metrics
+}
+
+// percentiles returns the nearest-rank p50, p95 and p99 of values
+func percentiles(values []float64) (p50, p95, p99 float64) {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	rank := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(sorted)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return sorted[i]
+	}
+	return rank(0.50), rank(0.95), rank(0.99)
+}
@@ -0,0 +1,247 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+// memWriter records stored batches
+type memWriter struct {
+	mu      sync.Mutex
+	batches [][]*models.Metric
+	err     error
+}
+
+func (w *memWriter) StoreBatch(ctx context.Context, metrics []*models.Metric) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	w.batches = append(w.batches, metrics)
+	return nil
+}
+
+// last returns the metrics of the last batch by name and series key
+func (w *memWriter) last() map[string]*models.Metric {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	byKey := make(map[string]*models.Metric)
+	if len(w.batches) == 0 {
+		return byKey
+	}
+	for _, m := range w.batches[len(w.batches)-1] {
+		byKey[m.Name+"{"+tagList(m.Tags)+"}"] = m
+	}
+	return byKey
+}
+
+// tagList formats tags as sorted "key=value," pairs for readable lookups
+func tagList(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k + "=" + tags[k] + ",")
+	}
+	return b.String()
+}
+
+// countingRecorder records the counts reported by the listener
+type countingRecorder struct {
+	malformed int
+	dropped   map[string]int
+}
+
+func (r *countingRecorder) RecordStatsDMalformed(count int) {
+	r.malformed += count
+}
+
+func (r *countingRecorder) RecordStatsDDropped(reason string, count int) {
+	r.dropped[reason] += count
+}
+
+func TestParseLine(t *testing.T) {
+	s, err := ParseLine("encoder.frames:3|c|@0.5|#pipeline:main,canary")
+	if err != nil {
+		t.Fatalf("ParseLine failed: %v", err)
+	}
+	if s.Name != "encoder.frames" || s.Type != TypeCounter || s.Rate != 0.5 || s.Values[0] != "3" {
+		t.Errorf("Unexpected sample %+v", s)
+	}
+	if s.Tags["pipeline"] != "main" || s.Tags["canary"] != "true" {
+		t.Errorf("Unexpected tags %v", s.Tags)
+	}
+
+	s, err = ParseLine("encoder.latency-ms:12:15:9|h|c:abc123|T1772359200")
+	if err != nil {
+		t.Fatalf("ParseLine failed: %v", err)
+	}
+	if s.Name != "encoder.latency_ms" || s.Type != TypeTimer || len(s.Values) != 3 {
+		t.Errorf("Expected a sanitized timer with three values, got %+v", s)
+	}
+
+	if s, err := ParseLine("viewers:user-42|s"); err != nil || s.Values[0] != "user-42" {
+		t.Errorf("Expected a set member kept as is, got %+v, %v", s, err)
+	}
+
+	tests := []struct {
+		line    string
+		wantErr string
+	}{
+		{"frames", "expected name:value"},
+		{":1|c", "empty metric name"},
+		{"frames:1", "missing type"},
+		{"frames:1|x", `unknown type "x"`},
+		{"frames:|c", "empty value"},
+		{"frames:abc|c", `invalid value "abc"`},
+		{"queue:NaN|g", `invalid value "NaN"`},
+		{"latency:1:+Inf|ms", `invalid value "+Inf"`},
+		{"frames:1|c|@2", "invalid sample rate"},
+		{"frames:1|c|@NaN", "invalid sample rate"},
+		{"frames:1|c|#:v", "invalid tag"},
+		{"frames:1|c|x", "unknown section"},
+		{"_e{5,4}:title|text", "not supported"},
+	}
+	for _, tt := range tests {
+		_, err := ParseLine(tt.line)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%q: expected error containing %q, got %v", tt.line, tt.wantErr, err)
+		}
+	}
+}
+
+func TestListener_Flush(t *testing.T) {
+	writer := &memWriter{}
+	l := New(Config{DeviceID: "test-device"}, writer)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	l.HandlePacket([]byte("encoder.frames:10|c|#pipeline:main\n" +
+		"encoder.frames:5|c|@0.5|#pipeline:main\r\n" +
+		"encoder.queue:7|g\nencoder.queue:+3|g\nencoder.queue:-1|g\n" +
+		"encoder.latency:1:2:3:4|ms\n" +
+		"encoder.viewers:a|s\nencoder.viewers:b|s\nencoder.viewers:a|s\n"))
+	if err := l.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	got := writer.last()
+	frames := got["encoder.frames{pipeline=main,}"]
+	if frames == nil || frames.Value != 20 || frames.Kind != models.KindCounter || frames.DeviceID != "test-device" {
+		t.Errorf("Expected a counter of 20 (5 at rate 0.5 counts as 10), got %+v", frames)
+	}
+	if q := got["encoder.queue{}"]; q == nil || q.Value != 9 || q.Kind != models.KindGauge {
+		t.Errorf("Expected gauge 9 after relative changes, got %+v", q)
+	}
+	want := map[string]float64{
+		"encoder.latency_count": 4, "encoder.latency_min": 1, "encoder.latency_max": 4,
+		"encoder.latency_avg": 2.5, "encoder.latency_p50": 2, "encoder.latency_p95": 4, "encoder.latency_p99": 4,
+		"encoder.viewers": 2,
+	}
+	for name, value := range want {
+		if m := got[name+"{}"]; m == nil || m.Value != value || m.TimestampMs != now.UnixMilli() {
+			t.Errorf("Expected %s = %v at the flush time, got %+v", name, value, m)
+		}
+	}
+
+	// Counters keep their total and gauges their value; timers and sets start over
+	l.HandlePacket([]byte("encoder.frames:1|c|#pipeline:main"))
+	if err := l.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	got = writer.last()
+	if len(got) != 2 || got["encoder.frames{pipeline=main,}"].Value != 21 || got["encoder.queue{}"].Value != 9 {
+		t.Errorf("Expected the counter total and the last gauge only, got %v", got)
+	}
+
+	// Idle series are forgotten
+	now = now.Add(DefaultIdleTimeout + time.Second)
+	if err := l.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if len(writer.batches) != 2 || len(l.series) != 0 {
+		t.Errorf("Expected idle series dropped without a write, got %d batches and %d series", len(writer.batches), len(l.series))
+	}
+}
+
+func TestListener_Drops(t *testing.T) {
+	writer := &memWriter{}
+	recorder := &countingRecorder{dropped: make(map[string]int)}
+	l := New(Config{MaxSeries: 2, Recorder: recorder}, writer)
+
+	l.HandlePacket([]byte("a:1|c\nb:1|g\nc:1|c\na:1|c\nbroken\nd:x|g\ne:NaN|g\n_sc|disk|0\n"))
+	if err := l.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if recorder.malformed != 3 || recorder.dropped[DropSeriesLimit] != 1 || recorder.dropped[DropUnsupported] != 1 {
+		t.Errorf("Unexpected counts: malformed %d, dropped %v", recorder.malformed, recorder.dropped)
+	}
+	if got := writer.last(); len(got) != 2 || got["a{}"].Value != 2 {
+		t.Errorf("Expected the two series within the limit, got %v", got)
+	}
+
+	writer.err = errors.New("disk full")
+	if err := l.Flush(context.Background()); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("Expected the store error, got %v", err)
+	}
+	if recorder.dropped[DropStore] != 2 {
+		t.Errorf("Expected 2 metrics dropped by the failed store, got %v", recorder.dropped)
+	}
+}
+
+func TestListener_Start(t *testing.T) {
+	writer := &memWriter{}
+	l := New(Config{Address: "127.0.0.1:0", FlushInterval: 20 * time.Millisecond}, writer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Start(ctx)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for l.Addr() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Listener did not bind")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	conn, err := net.Dial("udp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for writer.last()["encoder.restarts{}"] == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the pushed counter to be flushed")
+		}
+		if _, err := conn.Write([]byte("encoder.restarts:1|c")); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after cancel")
+	}
+	if l.Addr() != nil {
+		t.Error("Expected the socket closed after Start returned")
+	}
+}
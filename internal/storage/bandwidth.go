@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// InterfaceUsage is the number of bytes uploads sent over one network interface
+type InterfaceUsage struct {
+	Today int64 // Since local midnight
+	Month int64 // Since the first of the month, local time
+}
+
+// AddBandwidth adds bytes sent over a network interface to the usage of now's local day
+func (s *SQLiteStorage) AddBandwidth(ctx context.Context, iface string, bytes int64, now time.Time) error {
+	if bytes <= 0 {
+		return nil
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO bandwidth_usage (day, interface, bytes) VALUES (?, ?, ?)
+		ON CONFLICT (day, interface) DO UPDATE SET bytes = bytes + excluded.bytes
+	`, now.Format("2006-01-02"), iface, bytes)
+	if err != nil {
+		return fmt.Errorf("failed to record bandwidth usage for %s: %w", iface, err)
+	}
+	return nil
+}
+
+// BandwidthUsage returns the bytes sent per network interface in now's local day and month
+func (s *SQLiteStorage) BandwidthUsage(ctx context.Context, now time.Time) (map[string]InterfaceUsage, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT interface, SUM(CASE WHEN day = ? THEN bytes ELSE 0 END), SUM(bytes)
+		FROM bandwidth_usage
+		WHERE day >= ? AND day <= ?
+		GROUP BY interface
+	`, now.Format("2006-01-02"), now.Format("2006-01")+"-01", now.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bandwidth usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := make(map[string]InterfaceUsage)
+	for rows.Next() {
+		var iface string
+		var u InterfaceUsage
+		if err := rows.Scan(&iface, &u.Today, &u.Month); err != nil {
+			return nil, fmt.Errorf("failed to scan bandwidth usage: %w", err)
+		}
+		usage[iface] = u
+	}
+	return usage, rows.Err()
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+func TestBandwidthUsage(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.Local)
+
+	adds := []struct {
+		iface string
+		bytes int64
+		at    time.Time
+	}{
+		{"wwan0", 1000, now},
+		{"wwan0", 500, now.Add(time.Hour)},     // Same day adds up
+		{"wwan0", 2000, now.AddDate(0, 0, -3)}, // Earlier this month
+		{"wwan0", 9000, now.AddDate(0, -1, 0)}, // Last month
+		{"eth0", 7000, now},
+		{"eth0", 0, now}, // Ignored
+	}
+	for _, a := range adds {
+		if err := storage.AddBandwidth(ctx, a.iface, a.bytes, a.at); err != nil {
+			t.Fatalf("AddBandwidth failed: %v", err)
+		}
+	}
+
+	usage, err := storage.BandwidthUsage(ctx, now)
+	if err != nil {
+		t.Fatalf("BandwidthUsage failed: %v", err)
+	}
+	want := map[string]InterfaceUsage{
+		"wwan0": {Today: 1500, Month: 3500},
+		"eth0":  {Today: 7000, Month: 7000},
+	}
+	if len(usage) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, usage)
+	}
+	for iface, u := range want {
+		if usage[iface] != u {
+			t.Errorf("%s: expected %+v, got %+v", iface, u, usage[iface])
+		}
+	}
+
+	// A new month starts from zero
+	usage, err = storage.BandwidthUsage(ctx, now.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("BandwidthUsage failed: %v", err)
+	}
+	if len(usage) != 0 {
+		t.Errorf("Expected no usage next month, got %v", usage)
+	}
+}
+
+func TestQueryUnuploadedAtLeast(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	now := time.Now()
+
+	var metrics []*models.Metric
+	for i, p := range []models.Priority{models.PriorityP3, models.PriorityP1, models.PriorityDefault, models.PriorityP0} {
+		m := models.NewMetric("test.metric", float64(i), "device-001").WithTimestamp(now.Add(time.Duration(i) * time.Second))
+		m.Priority = p
+		metrics = append(metrics, m)
+	}
+	if err := storage.StoreBatch(ctx, metrics); err != nil {
+		t.Fatalf("StoreBatch failed: %v", err)
+	}
+
+	tests := map[models.Priority][]float64{
+		models.PriorityP0: {3},
+		models.PriorityP1: {3, 1},
+		models.PriorityP2: {3, 1, 2},
+		models.PriorityP3: {3, 1, 2, 0},
+	}
+	for minPriority, want := range tests {
+		got, err := storage.QueryUnuploadedAtLeast(ctx, DefaultDestination, minPriority, 0)
+		if err != nil {
+			t.Fatalf("QueryUnuploadedAtLeast failed: %v", err)
+		}
+		if len(got) != len(want) {
+			t.Errorf("%s: expected %d rows, got %d", minPriority, len(want), len(got))
+			continue
+		}
+		for i := range want {
+			if got[i].Value != want[i] {
+				t.Errorf("%s: row %d expected value %v, got %v", minPriority, i, want[i], got[i].Value)
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+// BatchWriter stores batches of metrics: SQLiteStorage directly, or a WriteBuffer in front of it
+type BatchWriter interface {
+	StoreBatch(ctx context.Context, metrics []*models.Metric) error
+}
+
+// Flush reasons reported in FlushResult
+const (
+	FlushReasonInterval       = "interval"        // Periodic flush
+	FlushReasonFull           = "full"            // MaxMetrics reached
+	FlushReasonMemoryPressure = "memory_pressure" // Available system memory is low
+	FlushReasonClockSync      = "clock_sync"      // Held rows must be in the database before they are corrected
+	FlushReasonShutdown       = "shutdown"        // Final flush after the collectors stopped
+)
+
+// FlushResult describes one flush of a WriteBuffer
+type FlushResult struct {
+	Reason   string
+	Count    int           // Metrics written (or attempted, if Err is set)
+	Dropped  int           // Metrics discarded because a failed flush left the buffer over MaxMetrics
+	Duration time.Duration // Time spent in the transaction
+	Err      error
+}
+
+// WriteBufferConfig configures a WriteBuffer
+type WriteBufferConfig struct {
+	MaxMetrics int               // Flush from StoreBatch once this many metrics are buffered (default: 5000)
+	OnFlush    func(FlushResult) // Called after every flush that had metrics to write (optional)
+}
+
+// WriteBuffer coalesces batches from all collectors into one SQLite transaction per flush
+// Every transaction costs an fsync of the WAL, so fewer, larger ones reduce eMMC/SD card wear.
+// Metrics reach the database only when Flush is called, so a crash loses what was buffered
+// since the last flush. It is safe for concurrent use.
+type WriteBuffer struct {
+	store      *SQLiteStorage
+	maxMetrics int
+	onFlush    func(FlushResult)
+
+	mu      sync.Mutex
+	pending []clockedBatch
+	count   int
+
+	flushMu sync.Mutex // Serializes flushes so batches are written in the order they arrived
+}
+
+// NewWriteBuffer creates a write buffer in front of store
+func NewWriteBuffer(store *SQLiteStorage, cfg WriteBufferConfig) *WriteBuffer {
+	maxMetrics := cfg.MaxMetrics
+	if maxMetrics <= 0 {
+		maxMetrics = 5000
+	}
+	return &WriteBuffer{
+		store:      store,
+		maxMetrics: maxMetrics,
+		onFlush:    cfg.OnFlush,
+	}
+}
+
+// StoreBatch buffers metrics until the next flush
+// The clock sync state is captured now, so rows collected before the clock synchronized are
+// held even if they are written after. Once MaxMetrics are buffered the buffer is flushed
+// before returning: a full buffer slows the collectors down instead of growing.
+func (b *WriteBuffer) StoreBatch(ctx context.Context, metrics []*models.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	hold, held := b.store.clockHold()
+
+	b.mu.Lock()
+	b.pending = append(b.pending, clockedBatch{metrics: metrics, hold: hold, held: held})
+	b.count += len(metrics)
+	full := b.count >= b.maxMetrics
+	b.mu.Unlock()
+
+	if full {
+		return b.Flush(ctx, FlushReasonFull)
+	}
+	return nil
+}
+
+// Flush writes every buffered metric in a single transaction
+// On failure the metrics stay buffered for the next flush; if that leaves more than MaxMetrics
+// buffered, the oldest batches are discarded so memory stays bounded while the database is unwritable.
+func (b *WriteBuffer) Flush(ctx context.Context, reason string) error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	batches, count := b.pending, b.count
+	b.pending, b.count = nil, 0
+	b.mu.Unlock()
+
+	if count == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	err := b.store.storeBatches(ctx, batches)
+	result := FlushResult{Reason: reason, Count: count, Duration: time.Since(start), Err: err}
+	if err != nil {
+		result.Dropped = b.requeue(batches)
+	}
+	if b.onFlush != nil {
+		b.onFlush(result)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to flush %d buffered metrics: %w", count, err)
+	}
+	return nil
+}
+
+// requeue puts batches from a failed flush back in front of those buffered since
+// Returns the number of metrics discarded to stay within MaxMetrics.
+func (b *WriteBuffer) requeue(batches []clockedBatch) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pending = append(batches, b.pending...)
+	b.count = 0
+	for _, batch := range b.pending {
+		b.count += len(batch.metrics)
+	}
+
+	dropped := 0
+	for b.count > b.maxMetrics && len(b.pending) > 1 {
+		n := len(b.pending[0].metrics)
+		b.pending = b.pending[1:]
+		b.count -= n
+		dropped += n
+	}
+	return dropped
+}
+
+// Len returns the number of buffered metrics
+func (b *WriteBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.count
+}
+
+// CorrectHeld flushes the buffer, then corrects held rows (see SQLiteStorage.CorrectHeld)
+// Held rows still in the buffer would otherwise miss the correction.
+func (b *WriteBuffer) CorrectHeld(ctx context.Context, ref ClockReading) (int64, error) {
+	if err := b.Flush(ctx, FlushReasonClockSync); err != nil {
+		return 0, err
+	}
+	return b.store.CorrectHeld(ctx, ref)
+}
+
+// ReleaseHeld flushes the buffer, then releases held rows (see SQLiteStorage.ReleaseHeld)
+func (b *WriteBuffer) ReleaseHeld(ctx context.Context, keepBoot int64) (int64, error) {
+	if err := b.Flush(ctx, FlushReasonClockSync); err != nil {
+		return 0, err
+	}
+	return b.store.ReleaseHeld(ctx, keepBoot)
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+func TestWriteBuffer_CoalescesBatches(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	var flushes []FlushResult
+	buffer := NewWriteBuffer(storage, WriteBufferConfig{
+		MaxMetrics: 100,
+		OnFlush:    func(r FlushResult) { flushes = append(flushes, r) },
+	})
+
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		batch := []*models.Metric{
+			models.NewMetric("cpu.usage", float64(i), "device-001").WithTimestamp(base.Add(time.Duration(i) * time.Second)),
+			models.NewMetric("memory.used_bytes", float64(i), "device-001").WithTimestamp(base.Add(time.Duration(i) * time.Second)),
+		}
+		if err := buffer.StoreBatch(ctx, batch); err != nil {
+			t.Fatalf("StoreBatch failed: %v", err)
+		}
+	}
+
+	// Nothing reaches the database before a flush
+	if count, _ := storage.Count(ctx); count != 0 {
+		t.Fatalf("Expected no rows before a flush, got %d", count)
+	}
+	if buffer.Len() != 6 {
+		t.Errorf("Expected 6 buffered metrics, got %d", buffer.Len())
+	}
+
+	if err := buffer.Flush(ctx, FlushReasonInterval); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if count, _ := storage.Count(ctx); count != 6 {
+		t.Errorf("Expected 6 rows after a flush, got %d", count)
+	}
+	if buffer.Len() != 0 {
+		t.Errorf("Expected an empty buffer, got %d", buffer.Len())
+	}
+
+	if len(flushes) != 1 || flushes[0].Reason != FlushReasonInterval || flushes[0].Count != 6 || flushes[0].Err != nil {
+		t.Errorf("Unexpected flush results %+v", flushes)
+	}
+
+	// An empty flush is not reported
+	if err := buffer.Flush(ctx, FlushReasonInterval); err != nil || len(flushes) != 1 {
+		t.Errorf("Expected an empty flush to do nothing, got %v and %d results", err, len(flushes))
+	}
+}
+
+func TestWriteBuffer_FlushesWhenFull(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	var reasons []string
+	buffer := NewWriteBuffer(storage, WriteBufferConfig{
+		MaxMetrics: 3,
+		OnFlush:    func(r FlushResult) { reasons = append(reasons, r.Reason) },
+	})
+
+	for i := 0; i < 4; i++ {
+		if err := buffer.StoreBatch(ctx, []*models.Metric{models.NewMetric("cpu.usage", float64(i), "device-001").WithTimestamp(time.UnixMilli(int64(i)))}); err != nil {
+			t.Fatalf("StoreBatch failed: %v", err)
+		}
+	}
+	if count, _ := storage.Count(ctx); count != 3 {
+		t.Errorf("Expected the third batch to trigger a flush, got %d rows", count)
+	}
+	if buffer.Len() != 1 || len(reasons) != 1 || reasons[0] != FlushReasonFull {
+		t.Errorf("Expected one full flush and 1 buffered, got %v and %d", reasons, buffer.Len())
+	}
+}
+
+func TestWriteBuffer_FailedFlushKeepsMetrics(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	var results []FlushResult
+	buffer := NewWriteBuffer(storage, WriteBufferConfig{
+		MaxMetrics: 4,
+		OnFlush:    func(r FlushResult) { results = append(results, r) },
+	})
+	batch := func(n int) []*models.Metric {
+		var metrics []*models.Metric
+		for i := 0; i < n; i++ {
+			metrics = append(metrics, models.NewMetric("cpu.usage", float64(i), "device-001").WithTimestamp(time.UnixMilli(int64(n*100+i))))
+		}
+		return metrics
+	}
+
+	ctx := context.Background()
+	if err := buffer.StoreBatch(ctx, batch(2)); err != nil {
+		t.Fatalf("StoreBatch failed: %v", err)
+	}
+
+	// A cancelled context makes the transaction fail
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := buffer.Flush(cancelled, FlushReasonInterval); err == nil {
+		t.Fatal("Expected the flush to fail")
+	}
+	if buffer.Len() != 2 {
+		t.Errorf("Expected the metrics to stay buffered, got %d", buffer.Len())
+	}
+
+	// The next flush writes the requeued batch too
+	if err := buffer.StoreBatch(ctx, batch(3)); err != nil {
+		t.Fatalf("StoreBatch failed: %v", err)
+	}
+	if count, _ := storage.Count(ctx); count != 5 {
+		t.Fatalf("Expected the full flush to write both batches, got %d rows", count)
+	}
+
+	// A failure that leaves more than MaxMetrics buffered discards the oldest batch
+	if err := buffer.StoreBatch(ctx, batch(3)); err != nil {
+		t.Fatalf("StoreBatch failed: %v", err)
+	}
+	if err := buffer.StoreBatch(cancelled, batch(2)); err == nil {
+		t.Fatal("Expected the full flush to fail")
+	}
+	last := results[len(results)-1]
+	if last.Err == nil || last.Dropped != 3 || buffer.Len() != 2 {
+		t.Errorf("Expected the oldest batch of 3 dropped and 2 kept, got %+v with %d buffered", last, buffer.Len())
+	}
+}
+
+func TestWriteBuffer_HoldsAtCollectionTime(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	clock := &fakeClock{
+		reading: ClockReading{Boot: 42, WallMs: staleWall.UnixMilli(), UptimeMs: 30_000},
+		held:    true,
+	}
+	storage.SetClockSource(clock)
+	buffer := NewWriteBuffer(storage, WriteBufferConfig{})
+
+	if err := buffer.StoreBatch(ctx, []*models.Metric{models.NewMetric("cpu.usage", 10, "device-001").WithTimestamp(staleWall)}); err != nil {
+		t.Fatalf("StoreBatch failed: %v", err)
+	}
+
+	// The clock syncs before the flush: the row must still be held and then corrected
+	clock.held = false
+	ref := ClockReading{Boot: 42, WallMs: time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC).UnixMilli(), UptimeMs: 40_000}
+	corrected, err := buffer.CorrectHeld(ctx, ref)
+	if err != nil {
+		t.Fatalf("CorrectHeld failed: %v", err)
+	}
+	if corrected != 1 {
+		t.Errorf("Expected the buffered row to be flushed and corrected, got %d", corrected)
+	}
+	if got := countWhere(t, storage, "unsynced_boot IS NULL AND timestamp_ms = ?", ref.WallMs-10_000); got != 1 {
+		t.Errorf("Expected the corrected timestamp, got %d matching rows", got)
+	}
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// DefaultCheckpointMaxAge is how long upload checkpoints are kept before retention deletes them
+const DefaultCheckpointMaxAge = 24 * time.Hour
+
+// Checkpoint identifies the batch an upload cycle records its chunks under
+// Batch IDs are "<destination>/<start>-<random>", e.g. "default/20260301T100000Z-0a1b2c3d".
+type Checkpoint struct {
+	BatchID   string
+	NextChunk int  // Index the cycle's first chunk is recorded under
+	Continued bool // The batch was left unfinished by an earlier cycle
+}
+
+// ContinueBatch returns the checkpoint an upload cycle for destination records its chunks under
+// A batch with a failed chunk is continued, numbering new chunks after the ones already
+// recorded; otherwise a new batch is started.
+//
+// Checkpoints do not record which metrics a chunk held. What a cycle sends is decided by the
+// destination's queue, which RecordChunk dequeues every uploaded chunk from, so a continued batch
+// sends whatever is still queued: the failed and skipped chunks, plus anything queued since.
+func (s *SQLiteStorage) ContinueBatch(ctx context.Context, destination string, now time.Time) (Checkpoint, error) {
+	prefix := destination + "/"
+	var batchID string
+	var lastChunk int
+	var failed bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT batch_id, MAX(chunk_index), MIN(success) = 0
+		FROM upload_checkpoints
+		WHERE batch_id = (
+			SELECT batch_id FROM upload_checkpoints
+			WHERE substr(batch_id, 1, ?) = ?
+			ORDER BY id DESC LIMIT 1
+		)
+		GROUP BY batch_id
+	`, len(prefix), prefix).Scan(&batchID, &lastChunk, &failed)
+	if err != nil && err != sql.ErrNoRows {
+		return Checkpoint{}, fmt.Errorf("failed to query upload checkpoints for %s: %w", destination, err)
+	}
+	if err == nil && failed {
+		return Checkpoint{BatchID: batchID, NextChunk: lastChunk + 1, Continued: true}, nil
+	}
+	return Checkpoint{BatchID: prefix + NewID(now)}, nil
+}
+
+// RecordChunk checkpoints an uploaded chunk and removes its metrics from the destination's queue
+// Both happen in one transaction, so a crash never leaves a sent chunk queued for upload again.
+func (s *SQLiteStorage) RecordChunk(ctx context.Context, destination, batchID string, chunkIndex int, ids []int64, now time.Time) error {
+	return s.dequeueChunk(ctx, destination, batchID, chunkIndex, ids, true, now)
+}
+
+// DropChunk checkpoints a chunk the destination rejected for good and removes its metrics from the
+// destination's queue, so they are never sent there again. The chunk is recorded as failed.
+func (s *SQLiteStorage) DropChunk(ctx context.Context, destination, batchID string, chunkIndex int, ids []int64, now time.Time) error {
+	return s.dequeueChunk(ctx, destination, batchID, chunkIndex, ids, false, now)
+}
+
+// dequeueChunk checkpoints a chunk and removes its metrics from the destination's queue in one transaction
+func (s *SQLiteStorage) dequeueChunk(ctx context.Context, destination, batchID string, chunkIndex int, ids []int64, success bool, now time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO upload_checkpoints (batch_id, chunk_index, uploaded_at, metric_count, success) VALUES (?, ?, ?, ?, ?)",
+		batchID, chunkIndex, now.UnixMilli(), len(ids), success); err != nil {
+		return fmt.Errorf("failed to record chunk %d of batch %s: %w", chunkIndex, batchID, err)
+	}
+	if err := markUploadedTx(ctx, tx, destination, ids); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RecordChunkFailure checkpoints a chunk that could not be uploaded, leaving the batch to be continued
+func (s *SQLiteStorage) RecordChunkFailure(ctx context.Context, batchID string, chunkIndex, metricCount int, now time.Time) error {
+	if _, err := s.db.ExecContext(ctx,
+		"INSERT INTO upload_checkpoints (batch_id, chunk_index, uploaded_at, metric_count, success) VALUES (?, ?, ?, ?, 0)",
+		batchID, chunkIndex, now.UnixMilli(), metricCount); err != nil {
+		return fmt.Errorf("failed to record failed chunk %d of batch %s: %w", chunkIndex, batchID, err)
+	}
+	return nil
+}
+
+// CompleteBatch drops the failure checkpoints of a batch once a cycle uploaded all of its chunks
+// The next cycle then starts a new batch.
+func (s *SQLiteStorage) CompleteBatch(ctx context.Context, batchID string) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM upload_checkpoints WHERE batch_id = ? AND success = 0", batchID); err != nil {
+		return fmt.Errorf("failed to complete batch %s: %w", batchID, err)
+	}
+	return nil
+}
+
+// PruneCheckpoints deletes upload checkpoints recorded before the cutoff
+func (s *SQLiteStorage) PruneCheckpoints(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM upload_checkpoints WHERE uploaded_at < ?", before.UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune upload checkpoints: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// NewID combines a start time with random bits, e.g. "20260301T100000Z-0a1b2c3d"
+// Used for upload batch and session IDs, which sort by start time.
+func NewID(start time.Time) string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		// Never expected; nanoseconds still make a collision unlikely
+		return fmt.Sprintf("%s-%08x", start.UTC().Format("20060102T150405Z"), start.Nanosecond())
+	}
+	return start.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b)
+}
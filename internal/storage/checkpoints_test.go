@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+func TestCheckpoints_RecordAndContinue(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	var metrics []*models.Metric
+	for i := 0; i < 4; i++ {
+		metrics = append(metrics, models.NewMetric("cpu.usage", float64(i), "device-001").WithTimestamp(now.Add(time.Duration(i)*time.Second)))
+	}
+	if err := storage.StoreBatch(ctx, metrics); err != nil {
+		t.Fatalf("StoreBatch failed: %v", err)
+	}
+
+	cp, err := storage.ContinueBatch(ctx, DefaultDestination, now)
+	if err != nil {
+		t.Fatalf("ContinueBatch failed: %v", err)
+	}
+	if !strings.HasPrefix(cp.BatchID, "default/20260301T100000Z-") || cp.NextChunk != 0 || cp.Continued {
+		t.Fatalf("Expected a new batch, got %+v", cp)
+	}
+
+	// Chunk 0 uploads, chunk 1 fails
+	if err := storage.RecordChunk(ctx, DefaultDestination, cp.BatchID, 0, []int64{1, 2}, now); err != nil {
+		t.Fatalf("RecordChunk failed: %v", err)
+	}
+	if err := storage.RecordChunkFailure(ctx, cp.BatchID, 1, 2, now); err != nil {
+		t.Fatalf("RecordChunkFailure failed: %v", err)
+	}
+	if pending, _ := storage.GetPendingCountFor(ctx, DefaultDestination); pending != 2 {
+		t.Errorf("Expected the recorded chunk dequeued, got %d pending", pending)
+	}
+	if err := storage.RecordChunk(ctx, DefaultDestination, cp.BatchID, 0, []int64{3}, now); err == nil {
+		t.Error("Expected a chunk index to be recorded only once per batch")
+	}
+
+	// The next cycle continues the batch after the recorded chunks
+	continued, err := storage.ContinueBatch(ctx, DefaultDestination, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("ContinueBatch failed: %v", err)
+	}
+	if continued.BatchID != cp.BatchID || continued.NextChunk != 2 || !continued.Continued {
+		t.Fatalf("Expected the batch continued at chunk 2, got %+v", continued)
+	}
+
+	// Other destinations are not affected
+	other, err := storage.ContinueBatch(ctx, "default-archive", now)
+	if err != nil || other.Continued || !strings.HasPrefix(other.BatchID, "default-archive/") {
+		t.Errorf("Expected a new batch for another destination, got %+v (err: %v)", other, err)
+	}
+
+	if err := storage.RecordChunk(ctx, DefaultDestination, continued.BatchID, 2, []int64{3, 4}, now); err != nil {
+		t.Fatalf("RecordChunk failed: %v", err)
+	}
+	if err := storage.CompleteBatch(ctx, continued.BatchID); err != nil {
+		t.Fatalf("CompleteBatch failed: %v", err)
+	}
+	next, err := storage.ContinueBatch(ctx, DefaultDestination, now.Add(2*time.Minute))
+	if err != nil {
+		t.Fatalf("ContinueBatch failed: %v", err)
+	}
+	if next.BatchID == cp.BatchID || next.Continued {
+		t.Errorf("Expected a new batch after completion, got %+v", next)
+	}
+
+	var chunks int
+	if err := storage.db.QueryRow("SELECT COUNT(*) FROM upload_checkpoints WHERE batch_id = ? AND success = 1", cp.BatchID).Scan(&chunks); err != nil || chunks != 2 {
+		t.Errorf("Expected both uploaded chunks kept, got %d (err: %v)", chunks, err)
+	}
+}
+
+func TestApplyRetention_PrunesCheckpoints(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+
+	if err := storage.RecordChunk(ctx, DefaultDestination, "default/old", 0, nil, now.Add(-25*time.Hour)); err != nil {
+		t.Fatalf("RecordChunk failed: %v", err)
+	}
+	if err := storage.RecordChunk(ctx, DefaultDestination, "default/new", 0, nil, now.Add(-time.Hour)); err != nil {
+		t.Fatalf("RecordChunk failed: %v", err)
+	}
+
+	result, err := storage.ApplyRetention(ctx, RetentionPolicy{CheckpointMaxAge: DefaultCheckpointMaxAge}, now)
+	if err != nil {
+		t.Fatalf("ApplyRetention failed: %v", err)
+	}
+	if result.CheckpointsPruned != 1 || result.Total() != 0 {
+		t.Errorf("Expected one checkpoint pruned and no metrics, got %+v", result)
+	}
+
+	var batch string
+	if err := storage.db.QueryRow("SELECT batch_id FROM upload_checkpoints").Scan(&batch); err != nil || batch != "default/new" {
+		t.Errorf("Expected the recent checkpoint kept, got %q (err: %v)", batch, err)
+	}
+}
+
+func TestNewID(t *testing.T) {
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	a, b := NewID(start), NewID(start)
+	if !strings.HasPrefix(a, "20260301T100000Z-") || len(a) != len("20260301T100000Z-0a1b2c3d") {
+		t.Errorf("Unexpected ID format %q", a)
+	}
+	if a == b {
+		t.Errorf("Expected distinct IDs for the same start time, got %q twice", a)
+	}
+}
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+// Boards without an RTC boot with a wall clock stuck in 1970 or at the last shutdown time.
+// Rows stored before the clock is synchronized are held back from upload with their time since
+// boot, and their timestamps are rewritten from a trusted reading once the clock syncs.
+
+// correctBatchSize is the number of held rows rewritten per transaction
+const correctBatchSize = 1000
+
+// ClockReading pairs a wall clock reading with the time since boot at the same instant
+type ClockReading struct {
+	Boot     int64 // Identifies the boot; uptime is only comparable within one boot
+	WallMs   int64 // Wall clock time in milliseconds
+	UptimeMs int64 // Time since boot in milliseconds
+}
+
+// ClockSource decides whether new rows must be held until the wall clock is synchronized
+type ClockSource interface {
+	// Hold returns the current reading and true while the wall clock cannot be trusted
+	Hold() (ClockReading, bool)
+}
+
+// SetClockSource installs the clock sync state consulted by StoreBatch (nil = always trusted)
+func (s *SQLiteStorage) SetClockSource(clock ClockSource) {
+	s.clockMu.Lock()
+	defer s.clockMu.Unlock()
+	s.clock = clock
+}
+
+// clockHold returns the current reading if new rows must be held
+func (s *SQLiteStorage) clockHold() (ClockReading, bool) {
+	s.clockMu.RLock()
+	clock := s.clock
+	s.clockMu.RUnlock()
+
+	if clock == nil {
+		return ClockReading{}, false
+	}
+	return clock.Hold()
+}
+
+// CorrectHeld rewrites the timestamps of rows held during ref.Boot and releases them for upload
+// ref must be a trusted reading: timestamp_ms = ref.WallMs - (ref.UptimeMs - uptime_ms).
+// Dedup keys are regenerated; a corrected row that duplicates an existing one is dropped.
+// Returns the number of rows corrected.
+func (s *SQLiteStorage) CorrectHeld(ctx context.Context, ref ClockReading) (int64, error) {
+	var total int64
+	for {
+		corrected, err := s.correctHeldBatch(ctx, ref)
+		total += corrected
+		if err != nil {
+			return total, err
+		}
+		if corrected < correctBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// correctHeldBatch corrects up to correctBatchSize held rows in one transaction
+func (s *SQLiteStorage) correctHeldBatch(ctx context.Context, ref ClockReading) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, metric_name, device_id, value_type, tags_json, uptime_ms
+		FROM metrics
+		WHERE unsynced_boot = ?
+		LIMIT ?
+	`, ref.Boot, correctBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query held metrics: %w", err)
+	}
+
+	type heldRow struct {
+		id     int64
+		metric models.Metric
+	}
+	var held []heldRow
+	for rows.Next() {
+		var r heldRow
+		var tagsJSON sql.NullString
+		var valueType int
+		var uptimeMs int64
+		if err := rows.Scan(&r.id, &r.metric.Name, &r.metric.DeviceID, &valueType, &tagsJSON, &uptimeMs); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan held metric: %w", err)
+		}
+		r.metric.ValueType = models.ValueType(valueType)
+		r.metric.TimestampMs = ref.WallMs - (ref.UptimeMs - uptimeMs)
+		if tagsJSON.Valid && tagsJSON.String != "" {
+			if err := json.Unmarshal([]byte(tagsJSON.String), &r.metric.Tags); err != nil {
+				rows.Close()
+				return 0, fmt.Errorf("failed to unmarshal tags: %w", err)
+			}
+		}
+		held = append(held, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating held metrics: %w", err)
+	}
+
+	for _, r := range held {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE OR IGNORE metrics
+			SET timestamp_ms = ?, dedup_key = ?, unsynced_boot = NULL, uptime_ms = NULL
+			WHERE id = ?
+		`, r.metric.TimestampMs, generateDedupKey(&r.metric), r.id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to correct metric %d: %w", r.id, err)
+		}
+		if updated, _ := result.RowsAffected(); updated == 0 {
+			// Same series and corrected timestamp already stored: keep the existing row
+			if _, err := tx.ExecContext(ctx, "DELETE FROM metrics WHERE id = ?", r.id); err != nil {
+				return 0, fmt.Errorf("failed to drop duplicate metric %d: %w", r.id, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return int64(len(held)), nil
+}
+
+// ReleaseHeld releases held rows with their original timestamps, except those held during keepBoot
+// Used for rows from an earlier boot (their uptime cannot be related to the current clock) and
+// when the clock never syncs. keepBoot = 0 releases every held row. Returns the number released.
+func (s *SQLiteStorage) ReleaseHeld(ctx context.Context, keepBoot int64) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE metrics SET unsynced_boot = NULL, uptime_ms = NULL
+		WHERE unsynced_boot IS NOT NULL AND unsynced_boot != ?
+	`, keepBoot)
+	if err != nil {
+		return 0, fmt.Errorf("failed to release held metrics: %w", err)
+	}
+
+	released, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return released, nil
+}
+
+// GetHeldCount returns the number of rows held for an unsynchronized clock
+func (s *SQLiteStorage) GetHeldCount(ctx context.Context) (int64, error) {
+	var count int64
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM metrics WHERE unsynced_boot IS NOT NULL").Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count held metrics: %w", err)
+	}
+	return count, nil
+}
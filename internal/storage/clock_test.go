@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+// fakeClock is a ClockSource with a settable reading
+type fakeClock struct {
+	reading ClockReading
+	held    bool
+}
+
+func (c *fakeClock) Hold() (ClockReading, bool) {
+	return c.reading, c.held
+}
+
+// 2024-06-01 boot, wall clock restored from the last shutdown (1970 works the same way)
+var staleWall = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func TestClock_HeldRowsSkippedForUpload(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	clock := &fakeClock{
+		reading: ClockReading{Boot: 42, WallMs: staleWall.UnixMilli(), UptimeMs: 30_000},
+		held:    true,
+	}
+	storage.SetClockSource(clock)
+
+	held := models.NewMetric("cpu.usage", 10, "device-001").WithTimestamp(staleWall.Add(-2 * time.Second))
+	if err := storage.Store(ctx, held); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	// Uptime is derived from the row's offset to the wall clock reading
+	if got := countWhere(t, storage, "unsynced_boot = 42 AND uptime_ms = 28000"); got != 1 {
+		t.Fatalf("Expected held row with uptime 28000, got %d", got)
+	}
+
+	clock.held = false
+	if err := storage.Store(ctx, models.NewMetric("cpu.usage", 20, "device-001")); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	unuploaded, err := storage.QueryUnuploaded(ctx, 0)
+	if err != nil {
+		t.Fatalf("QueryUnuploaded failed: %v", err)
+	}
+	if len(unuploaded) != 1 || unuploaded[0].Value != 20 {
+		t.Errorf("Expected only the trusted row to be uploadable, got %d rows", len(unuploaded))
+	}
+	forDefault, err := storage.QueryUnuploadedFor(ctx, DefaultDestination, 0)
+	if err != nil {
+		t.Fatalf("QueryUnuploadedFor failed: %v", err)
+	}
+	if len(forDefault) != 1 {
+		t.Errorf("Expected held row skipped for the destination queue, got %d rows", len(forDefault))
+	}
+
+	// Held rows still count as pending
+	if pending, _ := storage.GetPendingCount(ctx); pending != 2 {
+		t.Errorf("Expected 2 pending, got %d", pending)
+	}
+	if count, _ := storage.GetHeldCount(ctx); count != 1 {
+		t.Errorf("Expected 1 held row, got %d", count)
+	}
+
+	// Age-based expiry of pending rows must not delete rows whose real age is unknown
+	if _, err := storage.ApplyRetention(ctx, RetentionPolicy{PendingMaxAge: time.Hour}, time.Now()); err != nil {
+		t.Fatalf("ApplyRetention failed: %v", err)
+	}
+	if count, _ := storage.GetHeldCount(ctx); count != 1 {
+		t.Error("Expected held row to survive pending_max_age")
+	}
+}
+
+func TestClock_CorrectHeld(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	storage.SetClockSource(&fakeClock{
+		reading: ClockReading{Boot: 42, WallMs: staleWall.UnixMilli(), UptimeMs: 30_000},
+		held:    true,
+	})
+	metrics := []*models.Metric{
+		models.NewMetric("cpu.usage", 1, "device-001").WithTimestamp(staleWall.Add(-10 * time.Second)),
+		models.NewMetric("cpu.usage", 2, "device-001").WithTimestamp(staleWall),
+	}
+	if err := storage.StoreBatch(ctx, metrics); err != nil {
+		t.Fatalf("StoreBatch failed: %v", err)
+	}
+	storage.SetClockSource(nil)
+
+	// NTP synced 60s after boot: uptime 60000 is the true wall time below
+	synced := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	corrected, err := storage.CorrectHeld(ctx, ClockReading{Boot: 42, WallMs: synced.UnixMilli(), UptimeMs: 60_000})
+	if err != nil {
+		t.Fatalf("CorrectHeld failed: %v", err)
+	}
+	if corrected != 2 {
+		t.Errorf("Expected 2 corrected rows, got %d", corrected)
+	}
+
+	unuploaded, err := storage.QueryUnuploaded(ctx, 0)
+	if err != nil {
+		t.Fatalf("QueryUnuploaded failed: %v", err)
+	}
+	if len(unuploaded) != 2 {
+		t.Fatalf("Expected corrected rows to be uploadable, got %d", len(unuploaded))
+	}
+	// uptime 20000 and 30000 -> 40s and 30s before the sync reading
+	if want := synced.Add(-40 * time.Second).UnixMilli(); unuploaded[0].TimestampMs != want {
+		t.Errorf("Expected first timestamp %d, got %d", want, unuploaded[0].TimestampMs)
+	}
+	if want := synced.Add(-30 * time.Second).UnixMilli(); unuploaded[1].TimestampMs != want {
+		t.Errorf("Expected second timestamp %d, got %d", want, unuploaded[1].TimestampMs)
+	}
+
+	// Dedup keys follow the corrected timestamp: storing the same sample again is a no-op
+	again := models.NewMetric("cpu.usage", 2, "device-001").WithTimestamp(synced.Add(-30 * time.Second))
+	if err := storage.Store(ctx, again); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	if count, _ := storage.Count(ctx); count != 2 {
+		t.Errorf("Expected duplicate of a corrected row to be ignored, got %d rows", count)
+	}
+}
+
+func TestClock_CorrectHeldDropsDuplicates(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	synced := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+
+	// A trusted row that the held row will collide with after correction
+	trusted := models.NewMetric("cpu.usage", 1, "device-001").WithTimestamp(synced.Add(-30 * time.Second))
+	if err := storage.Store(ctx, trusted); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	storage.SetClockSource(&fakeClock{
+		reading: ClockReading{Boot: 42, WallMs: staleWall.UnixMilli(), UptimeMs: 30_000},
+		held:    true,
+	})
+	if err := storage.Store(ctx, models.NewMetric("cpu.usage", 1, "device-001").WithTimestamp(staleWall)); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	if _, err := storage.CorrectHeld(ctx, ClockReading{Boot: 42, WallMs: synced.UnixMilli(), UptimeMs: 60_000}); err != nil {
+		t.Fatalf("CorrectHeld failed: %v", err)
+	}
+	if count, _ := storage.Count(ctx); count != 1 {
+		t.Errorf("Expected the colliding held row to be dropped, got %d rows", count)
+	}
+	if count, _ := storage.GetHeldCount(ctx); count != 0 {
+		t.Errorf("Expected no held rows left, got %d", count)
+	}
+}
+
+func TestClock_ReleaseHeld(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	for boot, name := range map[int64]string{1: "cpu.usage", 2: "memory.usage"} {
+		storage.SetClockSource(&fakeClock{
+			reading: ClockReading{Boot: boot, WallMs: staleWall.UnixMilli(), UptimeMs: 5_000},
+			held:    true,
+		})
+		if err := storage.Store(ctx, models.NewMetric(name, 1, "device-001").WithTimestamp(staleWall)); err != nil {
+			t.Fatalf("Store failed: %v", err)
+		}
+	}
+
+	// Release everything except the current boot's rows
+	released, err := storage.ReleaseHeld(ctx, 2)
+	if err != nil {
+		t.Fatalf("ReleaseHeld failed: %v", err)
+	}
+	if released != 1 {
+		t.Errorf("Expected 1 row from the earlier boot released, got %d", released)
+	}
+	if got := countWhere(t, storage, "unsynced_boot IS NULL AND timestamp_ms = ?", staleWall.UnixMilli()); got != 1 {
+		t.Errorf("Expected released row to keep its original timestamp, got %d", got)
+	}
+
+	// keepBoot = 0 releases everything
+	if released, _ := storage.ReleaseHeld(ctx, 0); released != 1 {
+		t.Errorf("Expected remaining row released, got %d", released)
+	}
+	if count, _ := storage.GetHeldCount(ctx); count != 0 {
+		t.Errorf("Expected no held rows, got %d", count)
+	}
+}
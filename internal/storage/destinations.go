@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+// DefaultDestination is the upload destination used when remote.url configures a single endpoint
+// Databases created before per-destination state existed are migrated onto it
+const DefaultDestination = "default"
+
+// loadDestinations reads the registered destinations into memory
+func (s *SQLiteStorage) loadDestinations() error {
+	rows, err := s.db.Query("SELECT name FROM upload_destinations ORDER BY name")
+	if err != nil {
+		return fmt.Errorf("failed to load upload destinations: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("failed to scan upload destination: %w", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating upload destinations: %w", err)
+	}
+
+	s.destMu.Lock()
+	s.destinations = names
+	s.destMu.Unlock()
+	return nil
+}
+
+// Destinations returns the registered upload destinations in name order
+func (s *SQLiteStorage) Destinations() []string {
+	s.destMu.RLock()
+	defer s.destMu.RUnlock()
+
+	names := make([]string, len(s.destinations))
+	copy(names, s.destinations)
+	return names
+}
+
+// SetDestinations reconciles the registered destinations with the configured ones
+// New destinations start with every row that is still pending somewhere (uploaded = 0),
+// so adding an archive endpoint ships the current backlog but not data already delivered.
+// Removed destinations lose their queue, and rows no other destination is waiting for
+// are marked uploaded so retention can reclaim them.
+func (s *SQLiteStorage) SetDestinations(ctx context.Context, names []string) error {
+	if len(names) == 0 {
+		return fmt.Errorf("at least one upload destination is required")
+	}
+
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name == "" {
+			return fmt.Errorf("upload destination name cannot be empty")
+		}
+		wanted[name] = true
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	existing := make(map[string]bool)
+	rows, err := tx.QueryContext(ctx, "SELECT name FROM upload_destinations")
+	if err != nil {
+		return fmt.Errorf("failed to query upload destinations: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan upload destination: %w", err)
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating upload destinations: %w", err)
+	}
+
+	// Add new destinations first so removing the last old one never marks the backlog uploaded
+	for name := range wanted {
+		if existing[name] {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO upload_destinations (name, added_at) VALUES (?, ?)",
+			name, time.Now().Unix()); err != nil {
+			return fmt.Errorf("failed to add upload destination %s: %w", name, err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO upload_queue (destination, metric_id)
+			SELECT ?, id FROM metrics WHERE uploaded = 0 AND value_type = 0
+		`, name); err != nil {
+			return fmt.Errorf("failed to queue backlog for %s: %w", name, err)
+		}
+	}
+
+	removed := false
+	for name := range existing {
+		if wanted[name] {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM upload_queue WHERE destination = ?", name); err != nil {
+			return fmt.Errorf("failed to drop queue for %s: %w", name, err)
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM upload_destinations WHERE name = ?", name); err != nil {
+			return fmt.Errorf("failed to remove upload destination %s: %w", name, err)
+		}
+		removed = true
+	}
+
+	if removed {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE metrics SET uploaded = 1
+			WHERE uploaded = 0 AND value_type = 0
+			AND NOT EXISTS (SELECT 1 FROM upload_queue q WHERE q.metric_id = metrics.id)
+		`); err != nil {
+			return fmt.Errorf("failed to update uploaded flags: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	sorted := make([]string, 0, len(wanted))
+	for name := range wanted {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	s.destMu.Lock()
+	s.destinations = sorted
+	s.destMu.Unlock()
+	return nil
+}
+
+// QueryUnuploadedFor retrieves metrics still waiting to be uploaded to a destination
+// Ordering and the unsynchronized-clock hold match QueryUnuploaded: highest priority first, then oldest first.
+// Rows of the priority session (see SetPrioritySession) go ahead of everything else.
+func (s *SQLiteStorage) QueryUnuploadedFor(ctx context.Context, destination string, limit int) ([]*models.Metric, error) {
+	return s.QueryUnuploadedAtLeast(ctx, destination, models.PriorityP3, limit)
+}
+
+// QueryUnuploadedAtLeast is QueryUnuploadedFor limited to rows of minPriority or a higher class
+// (e.g., P1 returns P0 and P1 rows), used to send only priority data over a metered link
+func (s *SQLiteStorage) QueryUnuploadedAtLeast(ctx context.Context, destination string, minPriority models.Priority, limit int) ([]*models.Metric, error) {
+	order := "m.priority DESC, m.timestamp_ms ASC"
+	args := []interface{}{destination, minPriority.Rank()}
+	if session := s.PrioritySession(); session != "" {
+		order = "(m.session_id IS ?) DESC, " + order
+		args = append(args, session)
+	}
+	query := `
+		SELECT m.id, m.timestamp_ms, m.metric_name, m.metric_value, m.value_text, m.value_type, m.device_id, m.tags_json, m.kind, m.unit
+		FROM upload_queue q
+		JOIN metrics m ON m.id = q.metric_id
+		WHERE q.destination = ? AND m.priority >= ? AND m.value_type = 0 AND m.metric_value IS NOT NULL AND m.unsynced_boot IS NULL
+		ORDER BY ` + order
+
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unuploaded metrics for %s: %w", destination, err)
+	}
+	defer rows.Close()
+
+	return scanUploadRows(rows)
+}
+
+// MarkUploadedFor removes metrics from a destination's queue
+// Rows that no destination is waiting for any more get uploaded = 1
+func (s *SQLiteStorage) MarkUploadedFor(ctx context.Context, destination string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := markUploadedTx(ctx, tx, destination, ids); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// markUploadedTx removes metrics from a destination's queue within tx
+func markUploadedTx(ctx context.Context, tx *sql.Tx, destination string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// Build placeholders for IN clause
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	inClause := strings.Join(placeholders, ",")
+
+	query := fmt.Sprintf("DELETE FROM upload_queue WHERE destination = ? AND metric_id IN (%s)", inClause)
+	if _, err := tx.ExecContext(ctx, query, append([]interface{}{destination}, args...)...); err != nil {
+		return fmt.Errorf("failed to dequeue metrics for %s: %w", destination, err)
+	}
+
+	query = fmt.Sprintf(`
+		UPDATE metrics SET uploaded = 1
+		WHERE id IN (%s)
+		AND NOT EXISTS (SELECT 1 FROM upload_queue q WHERE q.metric_id = metrics.id)
+	`, inClause)
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to mark metrics as uploaded: %w", err)
+	}
+	return nil
+}
+
+// GetPendingCountFor returns the number of metrics waiting to be uploaded to a destination
+func (s *SQLiteStorage) GetPendingCountFor(ctx context.Context, destination string) (int64, error) {
+	var count int64
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM upload_queue WHERE destination = ?", destination).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count pending metrics for %s: %w", destination, err)
+	}
+	return count, nil
+}
@@ -0,0 +1,352 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+	_ "modernc.org/sqlite"
+)
+
+// storedIDs extracts storage IDs from metrics returned by an upload query
+func storedIDs(t *testing.T, metrics []*models.Metric) []int64 {
+	t.Helper()
+
+	ids := make([]int64, 0, len(metrics))
+	for _, m := range metrics {
+		var id int64
+		if _, err := fmt.Sscanf(m.Tags["_storage_id"], "%d", &id); err != nil {
+			t.Fatalf("Metric %s has no storage ID", m.Name)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestDestinations_DefaultRegistered(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if got := storage.Destinations(); !reflect.DeepEqual(got, []string{DefaultDestination}) {
+		t.Errorf("Expected [%s], got %v", DefaultDestination, got)
+	}
+
+	ctx := context.Background()
+	storeAged(t, storage, "test.metric", time.Minute, 3)
+
+	count, err := storage.GetPendingCountFor(ctx, DefaultDestination)
+	if err != nil {
+		t.Fatalf("GetPendingCountFor failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 pending for default destination, got %d", count)
+	}
+}
+
+func TestDestinations_IndependentCursors(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := storage.SetDestinations(ctx, []string{"primary", "archive"}); err != nil {
+		t.Fatalf("SetDestinations failed: %v", err)
+	}
+	if got := storage.Destinations(); !reflect.DeepEqual(got, []string{"archive", "primary"}) {
+		t.Errorf("Expected [archive primary], got %v", got)
+	}
+
+	storeAged(t, storage, "test.metric", time.Minute, 5)
+
+	primary, err := storage.QueryUnuploadedFor(ctx, "primary", 0)
+	if err != nil {
+		t.Fatalf("QueryUnuploadedFor failed: %v", err)
+	}
+	if len(primary) != 5 {
+		t.Fatalf("Expected 5 metrics for primary, got %d", len(primary))
+	}
+
+	// Primary uploads everything, archive is still down
+	if err := storage.MarkUploadedFor(ctx, "primary", storedIDs(t, primary)); err != nil {
+		t.Fatalf("MarkUploadedFor failed: %v", err)
+	}
+
+	if count, _ := storage.GetPendingCountFor(ctx, "primary"); count != 0 {
+		t.Errorf("Expected 0 pending for primary, got %d", count)
+	}
+	if count, _ := storage.GetPendingCountFor(ctx, "archive"); count != 5 {
+		t.Errorf("Expected 5 pending for archive, got %d", count)
+	}
+
+	// Rows are not uploaded until every destination has them
+	if count, _ := storage.GetPendingCount(ctx); count != 5 {
+		t.Errorf("Expected 5 rows pending somewhere, got %d", count)
+	}
+
+	archive, err := storage.QueryUnuploadedFor(ctx, "archive", 2)
+	if err != nil {
+		t.Fatalf("QueryUnuploadedFor failed: %v", err)
+	}
+	if len(archive) != 2 {
+		t.Fatalf("Expected limit of 2 metrics for archive, got %d", len(archive))
+	}
+	if err := storage.MarkUploadedFor(ctx, "archive", storedIDs(t, archive)); err != nil {
+		t.Fatalf("MarkUploadedFor failed: %v", err)
+	}
+
+	if count, _ := storage.GetPendingCount(ctx); count != 3 {
+		t.Errorf("Expected 3 rows pending after archive caught up on 2, got %d", count)
+	}
+	if got := countWhere(t, storage, "uploaded = 1"); got != 2 {
+		t.Errorf("Expected 2 rows uploaded everywhere, got %d", got)
+	}
+}
+
+func TestDestinations_StringMetricsNotQueued(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	metrics := []*models.Metric{
+		models.NewMetric("cpu.usage", 50, "device-001"),
+		models.NewStringMetric("system.state", "ok", "device-001"),
+	}
+	if err := storage.StoreBatch(ctx, metrics); err != nil {
+		t.Fatalf("StoreBatch failed: %v", err)
+	}
+
+	count, err := storage.GetPendingCountFor(ctx, DefaultDestination)
+	if err != nil {
+		t.Fatalf("GetPendingCountFor failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected only the numeric metric queued, got %d", count)
+	}
+}
+
+func TestDestinations_DuplicatesNotQueuedTwice(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	metric := models.NewMetric("cpu.usage", 50, "device-001")
+	for i := 0; i < 3; i++ {
+		if err := storage.Store(ctx, metric); err != nil {
+			t.Fatalf("Store failed: %v", err)
+		}
+	}
+
+	if count, _ := storage.GetPendingCountFor(ctx, DefaultDestination); count != 1 {
+		t.Errorf("Expected 1 queued metric, got %d", count)
+	}
+}
+
+func TestSetDestinations_NewDestinationGetsPendingBacklog(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	storeAged(t, storage, "test.metric", time.Minute, 4)
+
+	// Two rows already delivered to the default destination
+	pending, err := storage.QueryUnuploadedFor(ctx, DefaultDestination, 2)
+	if err != nil {
+		t.Fatalf("QueryUnuploadedFor failed: %v", err)
+	}
+	if err := storage.MarkUploadedFor(ctx, DefaultDestination, storedIDs(t, pending)); err != nil {
+		t.Fatalf("MarkUploadedFor failed: %v", err)
+	}
+
+	if err := storage.SetDestinations(ctx, []string{DefaultDestination, "archive"}); err != nil {
+		t.Fatalf("SetDestinations failed: %v", err)
+	}
+
+	if count, _ := storage.GetPendingCountFor(ctx, "archive"); count != 2 {
+		t.Errorf("Expected archive to start with the 2 pending rows, got %d", count)
+	}
+	if count, _ := storage.GetPendingCountFor(ctx, DefaultDestination); count != 2 {
+		t.Errorf("Expected default destination unchanged at 2 pending, got %d", count)
+	}
+}
+
+func TestSetDestinations_RemovingDestinationReleasesRows(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := storage.SetDestinations(ctx, []string{"primary", "archive"}); err != nil {
+		t.Fatalf("SetDestinations failed: %v", err)
+	}
+	storeAged(t, storage, "test.metric", time.Minute, 3)
+
+	primary, _ := storage.QueryUnuploadedFor(ctx, "primary", 0)
+	if err := storage.MarkUploadedFor(ctx, "primary", storedIDs(t, primary)); err != nil {
+		t.Fatalf("MarkUploadedFor failed: %v", err)
+	}
+
+	// Dropping the archive means nothing is waiting for these rows any more
+	if err := storage.SetDestinations(ctx, []string{"primary"}); err != nil {
+		t.Fatalf("SetDestinations failed: %v", err)
+	}
+
+	if count, _ := storage.GetPendingCountFor(ctx, "archive"); count != 0 {
+		t.Errorf("Expected archive queue dropped, got %d", count)
+	}
+	if count, _ := storage.GetPendingCount(ctx); count != 0 {
+		t.Errorf("Expected all rows uploaded once archive is removed, got %d pending", count)
+	}
+}
+
+func TestSetDestinations_ReplaceKeepsBacklog(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	storeAged(t, storage, "test.metric", time.Minute, 3)
+
+	// Switching from remote.url to a named destination must not lose the pending rows
+	if err := storage.SetDestinations(ctx, []string{"primary"}); err != nil {
+		t.Fatalf("SetDestinations failed: %v", err)
+	}
+
+	if count, _ := storage.GetPendingCountFor(ctx, "primary"); count != 3 {
+		t.Errorf("Expected 3 rows carried over to primary, got %d", count)
+	}
+	if count, _ := storage.GetPendingCount(ctx); count != 3 {
+		t.Errorf("Expected 3 rows still pending, got %d", count)
+	}
+}
+
+func TestSetDestinations_Validation(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := storage.SetDestinations(ctx, nil); err == nil {
+		t.Error("Expected error for empty destination list")
+	}
+	if err := storage.SetDestinations(ctx, []string{""}); err == nil {
+		t.Error("Expected error for empty destination name")
+	}
+}
+
+func TestSetDestinations_PersistsAcrossReopen(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	storage, err := NewSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	if err := storage.SetDestinations(context.Background(), []string{"primary", "archive"}); err != nil {
+		t.Fatalf("SetDestinations failed: %v", err)
+	}
+	storage.Close()
+
+	storage, err = NewSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer storage.Close()
+
+	if got := storage.Destinations(); !reflect.DeepEqual(got, []string{"archive", "primary"}) {
+		t.Errorf("Expected [archive primary] after reopen, got %v", got)
+	}
+}
+
+func TestMarkUploaded_ClearsAllQueues(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := storage.SetDestinations(ctx, []string{"primary", "archive"}); err != nil {
+		t.Fatalf("SetDestinations failed: %v", err)
+	}
+	storeAged(t, storage, "test.metric", time.Minute, 2)
+
+	pending, _ := storage.QueryUnuploaded(ctx, 0)
+	if err := storage.MarkUploaded(ctx, storedIDs(t, pending)); err != nil {
+		t.Fatalf("MarkUploaded failed: %v", err)
+	}
+
+	for _, dest := range []string{"primary", "archive"} {
+		if count, _ := storage.GetPendingCountFor(ctx, dest); count != 0 {
+			t.Errorf("Expected %s queue empty, got %d", dest, count)
+		}
+	}
+}
+
+func TestDeleteBefore_RemovesQueueEntries(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	storeAged(t, storage, "old.metric", 48*time.Hour, 3)
+	storeAged(t, storage, "new.metric", time.Minute, 2)
+
+	if _, err := storage.DeleteBefore(ctx, time.Now().Add(-24*time.Hour).UnixMilli()); err != nil {
+		t.Fatalf("DeleteBefore failed: %v", err)
+	}
+
+	if count, _ := storage.GetPendingCountFor(ctx, DefaultDestination); count != 2 {
+		t.Errorf("Expected queue entries of deleted rows removed, got %d pending", count)
+	}
+}
+
+func TestSchemaMigration_V6QueuesExistingBacklog(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	// Build a v5 database by hand: two pending rows, one uploaded row, one string row
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE schema_version (version INTEGER PRIMARY KEY, applied_at INTEGER NOT NULL);
+		INSERT INTO schema_version VALUES (1, 0), (2, 0), (3, 0), (4, 0), (5, 0);
+		CREATE TABLE metrics (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			timestamp_ms INTEGER NOT NULL,
+			metric_name TEXT NOT NULL,
+			metric_value REAL,
+			device_id TEXT,
+			uploaded INTEGER NOT NULL DEFAULT 0,
+			priority INTEGER NOT NULL DEFAULT 1,
+			session_id TEXT,
+			dedup_key TEXT,
+			tags_json TEXT,
+			value_text TEXT,
+			value_type INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE UNIQUE INDEX idx_dedup_key ON metrics(dedup_key);
+		INSERT INTO metrics (timestamp_ms, metric_name, metric_value, device_id, uploaded, dedup_key, value_type)
+		VALUES
+			(1000, 'a', 1, 'dev', 0, 'k1', 0),
+			(2000, 'b', 2, 'dev', 0, 'k2', 0),
+			(3000, 'c', 3, 'dev', 1, 'k3', 0),
+			(4000, 'd', 0, 'dev', 0, 'k4', 1);
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to build v5 database: %v", err)
+	}
+
+	storage, err := NewSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to migrate storage: %v", err)
+	}
+	defer storage.Close()
+
+	count, err := storage.GetPendingCountFor(context.Background(), DefaultDestination)
+	if err != nil {
+		t.Fatalf("GetPendingCountFor failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 pending numeric rows migrated to default queue, got %d", count)
+	}
+}
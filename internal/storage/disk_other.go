@@ -0,0 +1,10 @@
+//go:build !unix
+
+package storage
+
+import "errors"
+
+// freeDiskBytes is not implemented on this platform
+func freeDiskBytes(dir string) (int64, error) {
+	return 0, errors.New("free disk space is not available on this platform")
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+// SeriesInfo summarizes the stored samples of one series
+type SeriesInfo struct {
+	Name     string
+	DeviceID string
+	Tags     map[string]string
+	Count    int64
+	FirstMs  int64 // Oldest sample timestamp
+	LastMs   int64 // Newest sample timestamp
+}
+
+// whereClause builds the WHERE clause and arguments for the filters in opts
+func (opts QueryOptions) whereClause() (string, []interface{}) {
+	where := "WHERE 1=1"
+	args := []interface{}{}
+
+	if opts.StartMs > 0 {
+		where += " AND timestamp_ms >= ?"
+		args = append(args, opts.StartMs)
+	}
+
+	if opts.EndMs > 0 {
+		where += " AND timestamp_ms <= ?"
+		args = append(args, opts.EndMs)
+	}
+
+	if opts.DeviceID != "" {
+		where += " AND device_id = ?"
+		args = append(args, opts.DeviceID)
+	}
+
+	if opts.MetricName != "" {
+		where += " AND metric_name = ?"
+		args = append(args, opts.MetricName)
+	}
+
+	// Sorted so the same filter always produces the same statement
+	keys := make([]string, 0, len(opts.Tags))
+	for k := range opts.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		// Rows without tags store an empty string, which is not valid JSON
+		where += " AND json_extract(NULLIF(tags_json, ''), ?) = ?"
+		args = append(args, tagPath(k), opts.Tags[k])
+	}
+
+	return where, args
+}
+
+// tagPath returns the JSON path of a tag key, quoted so keys may contain dots
+func tagPath(key string) string {
+	return `$."` + strings.ReplaceAll(key, `"`, `\"`) + `"`
+}
+
+// QueryEach streams the metrics matching opts to fn without loading them all into memory
+// Iteration stops at the first error returned by fn.
+func (s *SQLiteStorage) QueryEach(ctx context.Context, opts QueryOptions, fn func(*models.Metric) error) error {
+	where, args := opts.whereClause()
+	query := "SELECT timestamp_ms, metric_name, metric_value, value_text, value_type, device_id, tags_json, kind, unit FROM metrics " + where
+
+	if opts.OrderBySeries {
+		query += " ORDER BY metric_name, device_id, tags_json, timestamp_ms ASC"
+	} else {
+		query += " ORDER BY timestamp_ms ASC"
+	}
+
+	if opts.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, opts.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query metrics: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m := &models.Metric{
+			Tags: make(map[string]string),
+		}
+		var tagsJSON sql.NullString
+		var value sql.NullFloat64
+		var valueText sql.NullString
+		var deviceID sql.NullString
+		var kind, unit sql.NullString
+		var valueType int
+
+		err := rows.Scan(
+			&m.TimestampMs,
+			&m.Name,
+			&value,
+			&valueText,
+			&valueType,
+			&deviceID,
+			&tagsJSON,
+			&kind,
+			&unit,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		m.Value = nullFloat(value)
+		m.ValueText = valueText.String
+		m.ValueType = models.ValueType(valueType)
+		m.DeviceID = deviceID.String
+		m.Kind = models.Kind(kind.String)
+		m.Unit = unit.String
+
+		// Deserialize tags if present
+		if tagsJSON.Valid && tagsJSON.String != "" {
+			if err := json.Unmarshal([]byte(tagsJSON.String), &m.Tags); err != nil {
+				return fmt.Errorf("failed to unmarshal tags: %w", err)
+			}
+		}
+
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating rows: %w", err)
+	}
+	return nil
+}
+
+// ListSeries returns every series with samples matching opts, ordered by name, device and tags
+// opts.Limit caps the number of series.
+func (s *SQLiteStorage) ListSeries(ctx context.Context, opts QueryOptions) ([]SeriesInfo, error) {
+	where, args := opts.whereClause()
+	query := `
+		SELECT metric_name, device_id, tags_json, COUNT(*), MIN(timestamp_ms), MAX(timestamp_ms)
+		FROM metrics ` + where + `
+		GROUP BY metric_name, device_id, tags_json
+		ORDER BY metric_name, device_id, tags_json
+	`
+	if opts.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, opts.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list series: %w", err)
+	}
+	defer rows.Close()
+
+	var series []SeriesInfo
+	for rows.Next() {
+		var info SeriesInfo
+		var deviceID, tagsJSON sql.NullString
+		if err := rows.Scan(&info.Name, &deviceID, &tagsJSON, &info.Count, &info.FirstMs, &info.LastMs); err != nil {
+			return nil, fmt.Errorf("failed to scan series: %w", err)
+		}
+		info.DeviceID = deviceID.String
+		info.Tags = make(map[string]string)
+		if tagsJSON.Valid && tagsJSON.String != "" {
+			if err := json.Unmarshal([]byte(tagsJSON.String), &info.Tags); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal tags: %w", err)
+			}
+		}
+		series = append(series, info)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating series: %w", err)
+	}
+	return series, nil
+}
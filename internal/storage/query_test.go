@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+// storeQueryFixture stores two interfaces of network.rx_bytes and one cpu.usage series
+func storeQueryFixture(t *testing.T, s *SQLiteStorage, base time.Time) {
+	t.Helper()
+
+	var metrics []*models.Metric
+	for i := 0; i < 3; i++ {
+		ts := base.Add(time.Duration(i) * time.Minute)
+		metrics = append(metrics,
+			models.NewMetric("network.rx_bytes", float64(100+i), "device-001").WithTimestamp(ts).WithTag("interface", "eth0"),
+			models.NewMetric("network.rx_bytes", float64(200+i), "device-001").WithTimestamp(ts).WithTag("interface", "wwan0"),
+			models.NewMetric("cpu.usage", float64(i), "device-001").WithTimestamp(ts),
+		)
+	}
+	if err := s.StoreBatch(context.Background(), metrics); err != nil {
+		t.Fatalf("Failed to store metrics: %v", err)
+	}
+}
+
+func TestQuery_TagFilter(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	storeQueryFixture(t, storage, base)
+
+	metrics, err := storage.Query(ctx, QueryOptions{Tags: map[string]string{"interface": "wwan0"}})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(metrics) != 3 {
+		t.Fatalf("Expected 3 wwan0 samples, got %d", len(metrics))
+	}
+	for _, m := range metrics {
+		if m.Tags["interface"] != "wwan0" {
+			t.Errorf("Expected only wwan0, got %v", m.Tags)
+		}
+	}
+
+	// Rows without tags never match a tag filter
+	metrics, err = storage.Query(ctx, QueryOptions{MetricName: "cpu.usage", Tags: map[string]string{"interface": "eth0"}})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(metrics) != 0 {
+		t.Errorf("Expected no untagged rows, got %d", len(metrics))
+	}
+}
+
+func TestQueryEach_OrderBySeries(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	storeQueryFixture(t, storage, base)
+
+	var got []string
+	err := storage.QueryEach(context.Background(), QueryOptions{OrderBySeries: true}, func(m *models.Metric) error {
+		got = append(got, m.Name+"/"+m.Tags["interface"])
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("QueryEach failed: %v", err)
+	}
+
+	want := "cpu.usage/ cpu.usage/ cpu.usage/ network.rx_bytes/eth0 network.rx_bytes/eth0 network.rx_bytes/eth0 " +
+		"network.rx_bytes/wwan0 network.rx_bytes/wwan0 network.rx_bytes/wwan0"
+	if strings.Join(got, " ") != want {
+		t.Errorf("Expected rows grouped by series, got %v", got)
+	}
+}
+
+func TestQueryEach_StopsOnError(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	storeQueryFixture(t, storage, time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC))
+
+	stop := errors.New("stop")
+	calls := 0
+	err := storage.QueryEach(context.Background(), QueryOptions{}, func(m *models.Metric) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("Expected iteration to stop after the first error, got %v after %d calls", err, calls)
+	}
+}
+
+func TestListSeries(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	storeQueryFixture(t, storage, base)
+
+	series, err := storage.ListSeries(context.Background(), QueryOptions{MetricName: "network.rx_bytes"})
+	if err != nil {
+		t.Fatalf("ListSeries failed: %v", err)
+	}
+	if len(series) != 2 {
+		t.Fatalf("Expected 2 series, got %d", len(series))
+	}
+	eth0 := series[0]
+	if eth0.Tags["interface"] != "eth0" || eth0.Count != 3 || eth0.DeviceID != "device-001" {
+		t.Errorf("Unexpected series %+v", eth0)
+	}
+	if eth0.FirstMs != base.UnixMilli() || eth0.LastMs != base.Add(2*time.Minute).UnixMilli() {
+		t.Errorf("Expected range %d..%d, got %d..%d",
+			base.UnixMilli(), base.Add(2*time.Minute).UnixMilli(), eth0.FirstMs, eth0.LastMs)
+	}
+}
+
+func TestOpenReadOnly_WhileWriterIsOpen(t *testing.T) {
+	storage, dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	storeQueryFixture(t, storage, time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC))
+
+	reader, err := OpenReadOnly(dbPath)
+	if err != nil {
+		t.Fatalf("OpenReadOnly failed: %v", err)
+	}
+	defer reader.Close()
+
+	if count, err := reader.Count(ctx); err != nil || count != 9 {
+		t.Errorf("Expected 9 rows through the reader, got %d (err: %v)", count, err)
+	}
+
+	// The writer keeps writing while the reader is open
+	if err := storage.Store(ctx, models.NewMetric("cpu.usage", 1, "device-001")); err != nil {
+		t.Fatalf("Store failed while a reader is open: %v", err)
+	}
+	if count, _ := reader.Count(ctx); count != 10 {
+		t.Errorf("Expected the reader to see the new row, got %d", count)
+	}
+
+	if err := reader.Store(ctx, models.NewMetric("cpu.usage", 2, "device-001")); err == nil {
+		t.Error("Expected writes through a read-only connection to fail")
+	}
+}
+
+func TestOpenReadOnly_Errors(t *testing.T) {
+	if _, err := OpenReadOnly(filepath.Join(t.TempDir(), "missing.db")); err == nil {
+		t.Error("Expected an error for a missing database")
+	}
+}
@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// Default number of rows removed per DELETE statement during size-capped eviction.
+// Small batches keep each write transaction short so collectors are not blocked.
+const defaultRetentionBatchSize = 5000
+
+// RetentionPolicy describes which rows may be evicted from local storage
+type RetentionPolicy struct {
+	UploadedMaxAge time.Duration // Delete uploaded rows older than this (0 = keep)
+	PendingMaxAge  time.Duration // Delete pending rows older than this (0 = keep)
+	MaxSizeBytes   int64         // Evict rows while used database size exceeds this (0 = no cap)
+	BatchSize      int           // Rows per eviction statement (default: 5000)
+	Rollup         RollupPolicy  // Compact old pending rows into aggregates first (zero = disabled)
+
+	CheckpointMaxAge time.Duration // Delete upload checkpoints older than this (0 = keep)
+}
+
+// RetentionResult reports how many rows each retention step removed
+type RetentionResult struct {
+	RolledUp        int64 // Pending raw rows replaced by rollup aggregates
+	RollupsCreated  int64 // Rollup aggregate rows stored
+	UploadedExpired int64 // Uploaded rows older than UploadedMaxAge
+	PendingExpired  int64 // Pending rows older than PendingMaxAge
+	UploadedEvicted int64 // Uploaded rows evicted to satisfy MaxSizeBytes
+	PendingEvicted  int64 // Pending rows evicted to satisfy MaxSizeBytes (data loss)
+	PagesVacuumed   int64 // Free pages returned to the filesystem by incremental vacuum
+
+	CheckpointsPruned int64 // Upload checkpoints older than CheckpointMaxAge (not metric rows)
+}
+
+// Total returns the total number of rows removed
+func (r RetentionResult) Total() int64 {
+	return r.RolledUp + r.UploadedExpired + r.PendingExpired + r.UploadedEvicted + r.PendingEvicted
+}
+
+// ApplyRetention enforces the retention policy in the following order:
+//  1. Compact pending raw rows older than Rollup.MinAge into rollup aggregates
+//  2. Delete uploaded rows older than UploadedMaxAge
+//  3. Delete pending rows older than PendingMaxAge (rows held for clock sync are exempt)
+//  4. While the database exceeds MaxSizeBytes, evict uploaded rows, then pending rows,
+//     lowest priority class first and oldest first within a class (rows held for clock
+//     sync are exempt here too: they are resolved or released once the clock syncs)
+//  5. Run an incremental vacuum to return freed pages to the filesystem
+//
+// Upload checkpoints older than CheckpointMaxAge are deleted first.
+func (s *SQLiteStorage) ApplyRetention(ctx context.Context, policy RetentionPolicy, now time.Time) (RetentionResult, error) {
+	var result RetentionResult
+
+	batchSize := policy.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultRetentionBatchSize
+	}
+
+	if policy.CheckpointMaxAge > 0 {
+		pruned, err := s.PruneCheckpoints(ctx, now.Add(-policy.CheckpointMaxAge))
+		if err != nil {
+			return result, err
+		}
+		result.CheckpointsPruned = pruned
+	}
+
+	if policy.Rollup.MinAge > 0 {
+		rolled, err := s.Rollup(ctx, policy.Rollup, now)
+		result.RolledUp = rolled.RawCompacted
+		result.RollupsCreated = rolled.RollupsCreated
+		if err != nil {
+			return result, fmt.Errorf("failed to roll up pending metrics: %w", err)
+		}
+	}
+
+	if policy.UploadedMaxAge > 0 {
+		cutoff := now.Add(-policy.UploadedMaxAge).UnixMilli()
+		deleted, err := s.execDelete(ctx, "DELETE FROM metrics WHERE uploaded = 1 AND timestamp_ms < ?", cutoff)
+		if err != nil {
+			return result, fmt.Errorf("failed to expire uploaded metrics: %w", err)
+		}
+		result.UploadedExpired = deleted
+	}
+
+	if policy.PendingMaxAge > 0 {
+		cutoff := now.Add(-policy.PendingMaxAge).UnixMilli()
+		deleted, err := s.execDelete(ctx, "DELETE FROM metrics WHERE uploaded = 0 AND unsynced_boot IS NULL AND timestamp_ms < ?", cutoff)
+		if err != nil {
+			return result, fmt.Errorf("failed to expire pending metrics: %w", err)
+		}
+		result.PendingExpired = deleted
+	}
+
+	if policy.MaxSizeBytes > 0 {
+		// Uploaded rows are already safe upstream, so they always go first
+		evicted, err := s.evictWhileOversize(ctx, policy.MaxSizeBytes, `
+			DELETE FROM metrics WHERE id IN (
+				SELECT id FROM metrics WHERE uploaded = 1
+				ORDER BY priority ASC, timestamp_ms ASC
+				LIMIT ?
+			)`, batchSize)
+		if err != nil {
+			return result, fmt.Errorf("failed to evict uploaded metrics: %w", err)
+		}
+		result.UploadedEvicted = evicted
+
+		// Pending rows are only touched if evicting uploaded rows was not enough
+		evicted, err = s.evictWhileOversize(ctx, policy.MaxSizeBytes, `
+			DELETE FROM metrics WHERE id IN (
+				SELECT id FROM metrics WHERE uploaded = 0 AND unsynced_boot IS NULL
+				ORDER BY priority ASC, timestamp_ms ASC
+				LIMIT ?
+			)`, batchSize)
+		if err != nil {
+			return result, fmt.Errorf("failed to evict pending metrics: %w", err)
+		}
+		result.PendingEvicted = evicted
+	}
+
+	if result.Total() > 0 {
+		pages, err := s.IncrementalVacuum(ctx)
+		if err != nil {
+			return result, err
+		}
+		result.PagesVacuumed = pages
+	}
+
+	return result, nil
+}
+
+// evictWhileOversize repeatedly runs the eviction statement (which takes a LIMIT argument)
+// until the used database size drops below maxBytes or no more rows match
+func (s *SQLiteStorage) evictWhileOversize(ctx context.Context, maxBytes int64, query string, batchSize int) (int64, error) {
+	var total int64
+	for {
+		used, err := s.UsedSize()
+		if err != nil {
+			return total, err
+		}
+		if used <= maxBytes {
+			return total, nil
+		}
+
+		deleted, err := s.execDelete(ctx, query, batchSize)
+		if err != nil {
+			return total, err
+		}
+		if deleted == 0 {
+			return total, nil // Nothing left to evict in this class
+		}
+		total += deleted
+	}
+}
+
+// execDelete runs a DELETE statement and returns the number of rows affected
+func (s *SQLiteStorage) execDelete(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return deleted, nil
+}
+
+// UsedSize returns the number of bytes occupied by live pages
+// Unlike DBSize, this excludes pages on the freelist, so it drops as soon as rows are deleted
+func (s *SQLiteStorage) UsedSize() (int64, error) {
+	var pageCount, freeCount, pageSize int64
+	if err := s.db.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+		return 0, fmt.Errorf("failed to get page count: %w", err)
+	}
+	if err := s.db.QueryRow("PRAGMA freelist_count").Scan(&freeCount); err != nil {
+		return 0, fmt.Errorf("failed to get freelist count: %w", err)
+	}
+	if err := s.db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, fmt.Errorf("failed to get page size: %w", err)
+	}
+	return (pageCount - freeCount) * pageSize, nil
+}
+
+// IncrementalVacuum returns free pages to the filesystem and reports how many were released
+// It does nothing until the database uses auto_vacuum=INCREMENTAL; databases created before
+// that mode was enabled are converted by EnableIncrementalVacuum. Until then SQLite reuses
+// their free pages for new rows, so the file stops growing but does not shrink.
+func (s *SQLiteStorage) IncrementalVacuum(ctx context.Context) (int64, error) {
+	var mode int
+	if err := s.db.QueryRowContext(ctx, "PRAGMA auto_vacuum").Scan(&mode); err != nil {
+		return 0, fmt.Errorf("failed to get auto_vacuum mode: %w", err)
+	}
+	if mode != 2 { // 2 = INCREMENTAL
+		return 0, nil
+	}
+
+	var before, after int64
+	if err := s.db.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&before); err != nil {
+		return 0, fmt.Errorf("failed to get freelist count: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, "PRAGMA incremental_vacuum"); err != nil {
+		return 0, fmt.Errorf("incremental vacuum failed: %w", err)
+	}
+	if err := s.db.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&after); err != nil {
+		return 0, fmt.Errorf("failed to get freelist count: %w", err)
+	}
+	return before - after, nil
+}
+
+// EnableIncrementalVacuum converts a database created before auto_vacuum=INCREMENTAL was enabled,
+// so that IncrementalVacuum can return freed pages to the filesystem. It reports whether the
+// database was converted; databases already in incremental mode are left alone.
+//
+// Changing the mode takes a full VACUUM, which rebuilds the database in a temporary copy. It is
+// skipped with an error unless the filesystem has room for twice the current database size, so
+// an already full SD card is never pushed over the edge.
+func (s *SQLiteStorage) EnableIncrementalVacuum(ctx context.Context) (bool, error) {
+	var mode int
+	if err := s.db.QueryRowContext(ctx, "PRAGMA auto_vacuum").Scan(&mode); err != nil {
+		return false, fmt.Errorf("failed to get auto_vacuum mode: %w", err)
+	}
+	if mode == 2 { // 2 = INCREMENTAL
+		return false, nil
+	}
+
+	var seq int
+	var name, path string
+	if err := s.db.QueryRowContext(ctx, "PRAGMA database_list").Scan(&seq, &name, &path); err != nil {
+		return false, fmt.Errorf("failed to get database path: %w", err)
+	}
+	size, err := s.DBSize()
+	if err != nil {
+		return false, err
+	}
+	if path != "" { // In-memory databases have no file to check
+		free, err := freeDiskBytes(filepath.Dir(path))
+		if err != nil {
+			return false, fmt.Errorf("failed to get free disk space: %w", err)
+		}
+		if free < 2*size {
+			return false, fmt.Errorf("not enough free disk space to convert the database to incremental vacuum (need %d bytes, have %d)", 2*size, free)
+		}
+	}
+
+	if _, err := s.db.ExecContext(ctx, "PRAGMA auto_vacuum=INCREMENTAL"); err != nil {
+		return false, fmt.Errorf("failed to set auto_vacuum mode: %w", err)
+	}
+	if err := s.Vacuum(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
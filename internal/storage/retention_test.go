@@ -0,0 +1,362 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+// storeAged stores count metrics with timestamps age ago, spaced 1ms apart
+func storeAged(t *testing.T, s *SQLiteStorage, name string, age time.Duration, count int) {
+	t.Helper()
+
+	base := time.Now().Add(-age)
+	metrics := make([]*models.Metric, count)
+	for i := 0; i < count; i++ {
+		metrics[i] = models.NewMetric(name, float64(i), "device-001").
+			WithTimestamp(base.Add(time.Duration(i) * time.Millisecond))
+	}
+	if err := s.StoreBatch(context.Background(), metrics); err != nil {
+		t.Fatalf("Failed to store metrics: %v", err)
+	}
+}
+
+func countWhere(t *testing.T, s *SQLiteStorage, where string, args ...interface{}) int64 {
+	t.Helper()
+
+	var count int64
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM metrics WHERE "+where, args...).Scan(&count); err != nil {
+		t.Fatalf("Failed to count metrics: %v", err)
+	}
+	return count
+}
+
+func TestApplyRetention_ExpiresUploadedRows(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	storeAged(t, storage, "old.uploaded", 48*time.Hour, 10)
+	storeAged(t, storage, "new.uploaded", time.Hour, 10)
+	storeAged(t, storage, "old.pending", 48*time.Hour, 5)
+
+	if _, err := storage.db.Exec("UPDATE metrics SET uploaded = 1 WHERE metric_name LIKE '%.uploaded'"); err != nil {
+		t.Fatalf("Failed to mark uploaded: %v", err)
+	}
+
+	result, err := storage.ApplyRetention(ctx, RetentionPolicy{UploadedMaxAge: 24 * time.Hour}, time.Now())
+	if err != nil {
+		t.Fatalf("ApplyRetention failed: %v", err)
+	}
+
+	if result.UploadedExpired != 10 {
+		t.Errorf("Expected 10 uploaded rows expired, got %d", result.UploadedExpired)
+	}
+	if result.PendingExpired != 0 {
+		t.Errorf("Expected pending rows untouched without pending_max_age, got %d expired", result.PendingExpired)
+	}
+	if got := countWhere(t, storage, "metric_name = 'new.uploaded'"); got != 10 {
+		t.Errorf("Expected recent uploaded rows kept, got %d", got)
+	}
+	if got := countWhere(t, storage, "metric_name = 'old.pending'"); got != 5 {
+		t.Errorf("Expected old pending rows kept, got %d", got)
+	}
+}
+
+func TestApplyRetention_ExpiresPendingRows(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	storeAged(t, storage, "old.pending", 10*24*time.Hour, 7)
+	storeAged(t, storage, "new.pending", time.Hour, 3)
+
+	result, err := storage.ApplyRetention(ctx, RetentionPolicy{PendingMaxAge: 7 * 24 * time.Hour}, time.Now())
+	if err != nil {
+		t.Fatalf("ApplyRetention failed: %v", err)
+	}
+
+	if result.PendingExpired != 7 {
+		t.Errorf("Expected 7 pending rows expired, got %d", result.PendingExpired)
+	}
+	if got := countWhere(t, storage, "1=1"); got != 3 {
+		t.Errorf("Expected 3 rows remaining, got %d", got)
+	}
+}
+
+func TestApplyRetention_SizeCapEvictsUploadedFirst(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	// Fill with enough rows that the database spans many pages
+	padding := strings.Repeat("x", 200)
+	var metrics []*models.Metric
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 4000; i++ {
+		metrics = append(metrics, models.NewMetric("fill.metric", float64(i), "device-001").
+			WithTimestamp(base.Add(time.Duration(i)*time.Millisecond)).
+			WithTag("pad", padding))
+	}
+	if err := storage.StoreBatch(ctx, metrics); err != nil {
+		t.Fatalf("Failed to store metrics: %v", err)
+	}
+
+	// Oldest half is uploaded, newest half is pending
+	if _, err := storage.db.Exec("UPDATE metrics SET uploaded = 1 WHERE id <= 2000"); err != nil {
+		t.Fatalf("Failed to mark uploaded: %v", err)
+	}
+
+	used, err := storage.UsedSize()
+	if err != nil {
+		t.Fatalf("UsedSize failed: %v", err)
+	}
+
+	// Cap at roughly 75% of the current size: evicting uploaded rows alone is enough
+	result, err := storage.ApplyRetention(ctx, RetentionPolicy{
+		MaxSizeBytes: used * 3 / 4,
+		BatchSize:    200,
+	}, time.Now())
+	if err != nil {
+		t.Fatalf("ApplyRetention failed: %v", err)
+	}
+
+	if result.UploadedEvicted == 0 {
+		t.Error("Expected uploaded rows to be evicted")
+	}
+	if result.PendingEvicted != 0 {
+		t.Errorf("Expected no pending rows evicted while uploaded rows remain, got %d", result.PendingEvicted)
+	}
+	if got := countWhere(t, storage, "uploaded = 0"); got != 2000 {
+		t.Errorf("Expected all 2000 pending rows kept, got %d", got)
+	}
+
+	usedAfter, err := storage.UsedSize()
+	if err != nil {
+		t.Fatalf("UsedSize failed: %v", err)
+	}
+	if usedAfter > used*3/4 {
+		t.Errorf("Expected used size <= %d after eviction, got %d", used*3/4, usedAfter)
+	}
+}
+
+func TestApplyRetention_SizeCapEvictsLowestPriorityPending(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	// High priority rows are the oldest, so evicting them first would mean age won over priority
+	padding := strings.Repeat("x", 200)
+	var metrics []*models.Metric
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 4000; i++ {
+		name := "metric.high"
+		if i >= 2000 {
+			name = "metric.low"
+		}
+		metrics = append(metrics, models.NewMetric(name, float64(i), "device-001").
+			WithTimestamp(base.Add(time.Duration(i)*time.Millisecond)).
+			WithTag("pad", padding))
+	}
+	if err := storage.StoreBatch(ctx, metrics); err != nil {
+		t.Fatalf("Failed to store metrics: %v", err)
+	}
+
+	if _, err := storage.db.Exec("UPDATE metrics SET priority = 3 WHERE metric_name = 'metric.high'"); err != nil {
+		t.Fatalf("Failed to set priority: %v", err)
+	}
+
+	used, err := storage.UsedSize()
+	if err != nil {
+		t.Fatalf("UsedSize failed: %v", err)
+	}
+
+	result, err := storage.ApplyRetention(ctx, RetentionPolicy{
+		MaxSizeBytes: used * 3 / 4,
+		BatchSize:    200,
+	}, time.Now())
+	if err != nil {
+		t.Fatalf("ApplyRetention failed: %v", err)
+	}
+
+	if result.PendingEvicted == 0 {
+		t.Fatal("Expected pending rows to be evicted")
+	}
+	if got := countWhere(t, storage, "metric_name = 'metric.high'"); got != 2000 {
+		t.Errorf("Expected high priority rows kept, got %d of 2000", got)
+	}
+	if got := countWhere(t, storage, "metric_name = 'metric.low'"); got != 2000-result.PendingEvicted {
+		t.Errorf("Expected %d low priority rows left, got %d", 2000-result.PendingEvicted, got)
+	}
+
+	// Within a priority class, the oldest rows go first
+	var oldestLeft int64
+	if err := storage.db.QueryRow("SELECT MIN(id) FROM metrics WHERE metric_name = 'metric.low'").Scan(&oldestLeft); err != nil {
+		t.Fatalf("Failed to query oldest row: %v", err)
+	}
+	if oldestLeft != 2001+result.PendingEvicted {
+		t.Errorf("Expected oldest remaining low priority id %d, got %d", 2001+result.PendingEvicted, oldestLeft)
+	}
+}
+
+func TestApplyRetention_SizeCapKeepsClockHeldRows(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	padding := strings.Repeat("x", 200)
+	var metrics []*models.Metric
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 4000; i++ {
+		metrics = append(metrics, models.NewMetric("fill.metric", float64(i), "device-001").
+			WithTimestamp(base.Add(time.Duration(i)*time.Millisecond)).
+			WithTag("pad", padding))
+	}
+	if err := storage.StoreBatch(ctx, metrics); err != nil {
+		t.Fatalf("Failed to store metrics: %v", err)
+	}
+
+	// The oldest rows are held until the clock syncs, so they would be evicted first otherwise
+	if _, err := storage.db.Exec("UPDATE metrics SET unsynced_boot = 7, uptime_ms = 1000 WHERE id <= 1000"); err != nil {
+		t.Fatalf("Failed to hold rows: %v", err)
+	}
+
+	used, err := storage.UsedSize()
+	if err != nil {
+		t.Fatalf("UsedSize failed: %v", err)
+	}
+	result, err := storage.ApplyRetention(ctx, RetentionPolicy{
+		MaxSizeBytes: used / 2,
+		BatchSize:    200,
+	}, time.Now())
+	if err != nil {
+		t.Fatalf("ApplyRetention failed: %v", err)
+	}
+
+	if result.PendingEvicted == 0 {
+		t.Fatal("Expected pending rows to be evicted")
+	}
+	if got := countWhere(t, storage, "unsynced_boot IS NOT NULL"); got != 1000 {
+		t.Errorf("Expected all 1000 held rows kept, got %d", got)
+	}
+}
+
+func TestApplyRetention_NoCapNoAges(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	storeAged(t, storage, "old.metric", 365*24*time.Hour, 5)
+
+	result, err := storage.ApplyRetention(context.Background(), RetentionPolicy{}, time.Now())
+	if err != nil {
+		t.Fatalf("ApplyRetention failed: %v", err)
+	}
+	if result.Total() != 0 {
+		t.Errorf("Expected empty policy to evict nothing, got %+v", result)
+	}
+}
+
+func TestIncrementalVacuum_ReleasesPages(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	var mode int
+	if err := storage.db.QueryRow("PRAGMA auto_vacuum").Scan(&mode); err != nil {
+		t.Fatalf("Failed to query auto_vacuum: %v", err)
+	}
+	if mode != 2 {
+		t.Fatalf("Expected new databases to use auto_vacuum=INCREMENTAL (2), got %d", mode)
+	}
+
+	storeAged(t, storage, "bulk.metric", time.Hour, 5000)
+	sizeBefore, err := storage.DBSize()
+	if err != nil {
+		t.Fatalf("DBSize failed: %v", err)
+	}
+
+	result, err := storage.ApplyRetention(context.Background(), RetentionPolicy{PendingMaxAge: time.Minute}, time.Now())
+	if err != nil {
+		t.Fatalf("ApplyRetention failed: %v", err)
+	}
+	if result.PendingExpired != 5000 {
+		t.Fatalf("Expected 5000 rows expired, got %d", result.PendingExpired)
+	}
+	if result.PagesVacuumed == 0 {
+		t.Error("Expected incremental vacuum to release pages")
+	}
+
+	sizeAfter, err := storage.DBSize()
+	if err != nil {
+		t.Fatalf("DBSize failed: %v", err)
+	}
+	if sizeAfter >= sizeBefore {
+		t.Errorf("Expected database to shrink after vacuum: before=%d after=%d", sizeBefore, sizeAfter)
+	}
+}
+
+func TestEnableIncrementalVacuum_ConvertsOldDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "old.db")
+
+	// A database created before auto_vacuum=INCREMENTAL was set keeps its mode on open
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if _, err := db.Exec("CREATE TABLE legacy (id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	db.Close()
+
+	storage, err := NewSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	defer storage.Close()
+
+	var mode int
+	if err := storage.db.QueryRow("PRAGMA auto_vacuum").Scan(&mode); err != nil {
+		t.Fatalf("Failed to query auto_vacuum: %v", err)
+	}
+	if mode != 0 {
+		t.Fatalf("Expected the old database to keep auto_vacuum=NONE (0), got %d", mode)
+	}
+
+	ctx := context.Background()
+	storeAged(t, storage, "bulk.metric", time.Hour, 2000)
+	converted, err := storage.EnableIncrementalVacuum(ctx)
+	if err != nil {
+		t.Fatalf("EnableIncrementalVacuum failed: %v", err)
+	}
+	if !converted {
+		t.Fatal("Expected the database to be converted")
+	}
+	if err := storage.db.QueryRow("PRAGMA auto_vacuum").Scan(&mode); err != nil {
+		t.Fatalf("Failed to query auto_vacuum: %v", err)
+	}
+	if mode != 2 {
+		t.Fatalf("Expected auto_vacuum=INCREMENTAL (2) after conversion, got %d", mode)
+	}
+	if got := countWhere(t, storage, "1 = 1"); got != 2000 {
+		t.Errorf("Expected all 2000 rows kept by the conversion, got %d", got)
+	}
+
+	result, err := storage.ApplyRetention(ctx, RetentionPolicy{PendingMaxAge: time.Minute}, time.Now())
+	if err != nil {
+		t.Fatalf("ApplyRetention failed: %v", err)
+	}
+	if result.PagesVacuumed == 0 {
+		t.Error("Expected incremental vacuum to release pages after conversion")
+	}
+
+	// A second call finds the mode already set
+	if converted, err := storage.EnableIncrementalVacuum(ctx); err != nil || converted {
+		t.Errorf("Expected no conversion of an incremental database, got %v, %v", converted, err)
+	}
+}
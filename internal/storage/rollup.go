@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+// A device that is offline for days builds a backlog of millions of raw points.
+// Rollups compact old pending raw rows of each series into min/max/avg/count aggregates
+// over fixed-width buckets, so the gap uploads in minutes instead of hours.
+
+// DefaultRollupResolution is the bucket width used when RollupPolicy.Resolution is unset
+const DefaultRollupResolution = 5 * time.Minute
+
+// rollupWindowBuckets is the number of buckets compacted per transaction
+const rollupWindowBuckets = 60
+
+// rollupAggs are the aggregates stored for each series and bucket
+var rollupAggs = []string{"min", "max", "avg", "count"}
+
+// rollupEligible selects pending raw numeric rows with a value and a trusted timestamp
+// Rows without a value (SQLite stores NaN as NULL) would leave whole groups without aggregates.
+const rollupEligible = "uploaded = 0 AND value_type = 0 AND metric_value IS NOT NULL AND unsynced_boot IS NULL AND rollup_ms = 0"
+
+// RollupPolicy describes which pending rows are compacted into aggregates
+type RollupPolicy struct {
+	MinAge     time.Duration // Compact pending raw rows older than this (0 = disabled)
+	Resolution time.Duration // Bucket width of the aggregates (default: 5m)
+}
+
+// RollupResult reports what a rollup pass did
+type RollupResult struct {
+	RawCompacted   int64 // Raw rows replaced by aggregates
+	RollupsCreated int64 // Aggregate rows stored
+}
+
+// rollupGroup is one series in one bucket
+type rollupGroup struct {
+	name      string
+	deviceID  sql.NullString
+	tagsJSON  sql.NullString
+	bucketMs  int64
+	min       float64
+	max       float64
+	avg       float64
+	count     int64
+	priority  int
+	kind      sql.NullString
+	unit      sql.NullString
+	sessionID sql.NullString // Streaming session of the raw rows, if any
+}
+
+// Rollup compacts pending raw rows older than policy.MinAge into aggregate rows
+// Only whole buckets are compacted, and a group is left alone if it would not shrink
+// (fewer raw rows than aggregates) or its bucket was already rolled up. Aggregates are
+// queued for the destinations still waiting for the raw rows they replace.
+func (s *SQLiteStorage) Rollup(ctx context.Context, policy RollupPolicy, now time.Time) (RollupResult, error) {
+	var result RollupResult
+	if policy.MinAge <= 0 {
+		return result, nil
+	}
+
+	resolution := policy.Resolution
+	if resolution <= 0 {
+		resolution = DefaultRollupResolution
+	}
+	resMs := resolution.Milliseconds()
+	cutoff := alignDown(now.Add(-policy.MinAge).UnixMilli(), resMs)
+
+	from := int64(math.MinInt64)
+	for from < cutoff {
+		var oldest sql.NullInt64
+		err := s.db.QueryRowContext(ctx,
+			"SELECT MIN(timestamp_ms) FROM metrics WHERE "+rollupEligible+" AND timestamp_ms >= ? AND timestamp_ms < ?",
+			from, cutoff).Scan(&oldest)
+		if err != nil {
+			return result, fmt.Errorf("failed to find rollup candidates: %w", err)
+		}
+		if !oldest.Valid {
+			return result, nil
+		}
+
+		start := alignDown(oldest.Int64, resMs)
+		end := start + resMs*rollupWindowBuckets
+		if end > cutoff {
+			end = cutoff
+		}
+
+		compacted, created, err := s.rollupWindow(ctx, resMs, start, end)
+		result.RawCompacted += compacted
+		result.RollupsCreated += created
+		if err != nil {
+			return result, err
+		}
+		from = end
+	}
+
+	return result, nil
+}
+
+// rollupWindow compacts every eligible group in [start, end) in one transaction
+// start must be aligned to resMs
+func (s *SQLiteStorage) rollupWindow(ctx context.Context, resMs, start, end int64) (int64, int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT metric_name, device_id, tags_json, (timestamp_ms - ?) / ? AS bucket,
+			MIN(metric_value), MAX(metric_value), AVG(metric_value), COUNT(*), MAX(priority), MAX(kind), MAX(unit), MAX(session_id)
+		FROM metrics
+		WHERE `+rollupEligible+` AND timestamp_ms >= ? AND timestamp_ms < ?
+		GROUP BY metric_name, device_id, tags_json, bucket
+	`, start, resMs, start, end)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to aggregate rollup window: %w", err)
+	}
+
+	var groups []rollupGroup
+	for rows.Next() {
+		var g rollupGroup
+		var bucket int64
+		if err := rows.Scan(&g.name, &g.deviceID, &g.tagsJSON, &bucket,
+			&g.min, &g.max, &g.avg, &g.count, &g.priority, &g.kind, &g.unit, &g.sessionID); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("failed to scan rollup group: %w", err)
+		}
+		g.bucketMs = start + bucket*resMs
+		groups = append(groups, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("error iterating rollup groups: %w", err)
+	}
+
+	insertStmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO metrics (
+			timestamp_ms, metric_name, metric_value, value_type, device_id,
+			uploaded, priority, session_id, dedup_key, tags_json, rollup_ms, kind, unit
+		)
+		VALUES (?, ?, ?, 0, ?, 0, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (dedup_key) DO NOTHING
+	`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to prepare rollup insert: %w", err)
+	}
+	defer insertStmt.Close()
+
+	queueStmt, err := tx.PrepareContext(ctx, "INSERT OR IGNORE INTO upload_queue (destination, metric_id) VALUES (?, ?)")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to prepare queue statement: %w", err)
+	}
+	defer queueStmt.Close()
+
+	// Matches the raw rows of one group
+	groupWhere := rollupEligible + ` AND metric_name = ? AND device_id IS ? AND tags_json IS ?
+		AND timestamp_ms >= ? AND timestamp_ms < ?`
+
+	resolution := formatResolution(time.Duration(resMs) * time.Millisecond)
+
+	var compacted, created int64
+	for _, g := range groups {
+		if g.count <= int64(len(rollupAggs)) {
+			continue // Aggregates would take more rows than the raw points
+		}
+
+		tags := make(map[string]string)
+		if g.tagsJSON.Valid && g.tagsJSON.String != "" {
+			if err := json.Unmarshal([]byte(g.tagsJSON.String), &tags); err != nil {
+				return 0, 0, fmt.Errorf("failed to unmarshal tags for %s: %w", g.name, err)
+			}
+		}
+		tags[models.TagRollupResolution] = resolution
+
+		// Rows that reach a bucket after it was rolled up (e.g., clock corrections) stay raw
+		tags[models.TagRollupAgg] = "count"
+		var exists bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM metrics WHERE dedup_key = ?)",
+			generateDedupKey(rollupMetric(g, tags))).Scan(&exists); err != nil {
+			return 0, 0, fmt.Errorf("failed to check existing rollup: %w", err)
+		}
+		if exists {
+			continue
+		}
+
+		args := []interface{}{g.name, g.deviceID, g.tagsJSON, g.bucketMs, g.bucketMs + resMs}
+		destinations, err := queuedDestinations(ctx, tx, groupWhere, args)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		values := map[string]float64{"min": g.min, "max": g.max, "avg": g.avg, "count": float64(g.count)}
+		for _, agg := range rollupAggs {
+			tags[models.TagRollupAgg] = agg
+			m := rollupMetric(g, tags)
+			tagsJSON, err := serializeTags(tags)
+			if err != nil {
+				return 0, 0, fmt.Errorf("failed to serialize tags: %w", err)
+			}
+
+			res, err := insertStmt.ExecContext(ctx,
+				g.bucketMs, g.name, values[agg], g.deviceID, g.priority,
+				g.sessionID, generateDedupKey(m), tagsJSON, resMs, g.kind, g.unit,
+			)
+			if err != nil {
+				return 0, 0, fmt.Errorf("failed to insert rollup: %w", err)
+			}
+			if inserted, _ := res.RowsAffected(); inserted == 0 {
+				continue
+			}
+			created++
+
+			id, err := res.LastInsertId()
+			if err != nil {
+				return 0, 0, fmt.Errorf("failed to get rollup id: %w", err)
+			}
+			for _, dest := range destinations {
+				if _, err := queueStmt.ExecContext(ctx, dest, id); err != nil {
+					return 0, 0, fmt.Errorf("failed to queue rollup for %s: %w", dest, err)
+				}
+			}
+		}
+
+		res, err := tx.ExecContext(ctx, "DELETE FROM metrics WHERE "+groupWhere, args...)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to delete compacted rows: %w", err)
+		}
+		deleted, err := res.RowsAffected()
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		compacted += deleted
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return compacted, created, nil
+}
+
+// queuedDestinations returns the destinations still waiting for any row matching where
+func queuedDestinations(ctx context.Context, tx *sql.Tx, where string, args []interface{}) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT DISTINCT destination FROM upload_queue
+		WHERE metric_id IN (SELECT id FROM metrics WHERE `+where+`)
+		ORDER BY destination
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query queued destinations: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan destination: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// rollupMetric builds the metric used to derive a rollup row's dedup key
+func rollupMetric(g rollupGroup, tags map[string]string) *models.Metric {
+	return &models.Metric{
+		TimestampMs: g.bucketMs,
+		Name:        g.name,
+		DeviceID:    g.deviceID.String,
+		ValueType:   models.ValueTypeNumeric,
+		Tags:        tags,
+	}
+}
+
+// alignDown rounds ms down to a multiple of step (also for negative values)
+func alignDown(ms, step int64) int64 {
+	return ms - ((ms%step)+step)%step
+}
+
+// formatResolution renders a bucket width in the largest whole unit (5m, 1h, 30s)
+func formatResolution(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	default:
+		return fmt.Sprintf("%dms", d/time.Millisecond)
+	}
+}
@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+// rollupNow is the reference time for rollup tests; rows before 12:00 are older than 6h
+var rollupNow = time.Date(2026, 3, 1, 18, 0, 0, 0, time.UTC)
+
+// storeSeries stores count points of a series every step from start, with values 0..count-1
+func storeSeries(t *testing.T, s *SQLiteStorage, name, core string, start time.Time, step time.Duration, count int) {
+	t.Helper()
+
+	metrics := make([]*models.Metric, count)
+	for i := 0; i < count; i++ {
+		metrics[i] = models.NewMetric(name, float64(i), "device-001").
+			WithTag("core", core).
+			WithTimestamp(start.Add(time.Duration(i) * step))
+	}
+	if err := s.StoreBatch(context.Background(), metrics); err != nil {
+		t.Fatalf("Failed to store metrics: %v", err)
+	}
+}
+
+func TestRollup_CompactsOldPendingRows(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	bucket := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	storeSeries(t, storage, "cpu.usage", "0", bucket, 5*time.Second, 60)                  // One full 5m bucket
+	storeSeries(t, storage, "cpu.usage", "1", bucket, 5*time.Second, 60)                  // Separate series, same bucket
+	storeSeries(t, storage, "cpu.usage", "0", rollupNow.Add(-time.Hour), time.Second, 30) // Too recent
+
+	result, err := storage.Rollup(ctx, RollupPolicy{MinAge: 6 * time.Hour, Resolution: 5 * time.Minute}, rollupNow)
+	if err != nil {
+		t.Fatalf("Rollup failed: %v", err)
+	}
+	if result.RawCompacted != 120 {
+		t.Errorf("Expected 120 raw rows compacted, got %d", result.RawCompacted)
+	}
+	if result.RollupsCreated != 8 {
+		t.Errorf("Expected 8 rollup rows (4 per series), got %d", result.RollupsCreated)
+	}
+	if got := countWhere(t, storage, "rollup_ms = 0"); got != 30 {
+		t.Errorf("Expected recent raw rows untouched, got %d raw rows", got)
+	}
+
+	// Aggregates replace the raw rows in the upload backlog
+	pending, err := storage.QueryUnuploadedFor(ctx, DefaultDestination, 0)
+	if err != nil {
+		t.Fatalf("QueryUnuploadedFor failed: %v", err)
+	}
+	if len(pending) != 38 {
+		t.Fatalf("Expected 8 rollups and 30 raw rows pending, got %d", len(pending))
+	}
+
+	want := map[string]float64{"min": 0, "max": 59, "avg": 29.5, "count": 60}
+	found := 0
+	for _, m := range pending {
+		if !m.IsRollup() || m.Tags["core"] != "0" {
+			continue
+		}
+		found++
+		agg := m.Tags[models.TagRollupAgg]
+		if m.Value != want[agg] {
+			t.Errorf("Expected %s = %v, got %v", agg, want[agg], m.Value)
+		}
+		if m.Tags[models.TagRollupResolution] != "5m" {
+			t.Errorf("Expected resolution tag 5m, got %q", m.Tags[models.TagRollupResolution])
+		}
+		if m.TimestampMs != bucket.UnixMilli() {
+			t.Errorf("Expected rollup at bucket start %d, got %d", bucket.UnixMilli(), m.TimestampMs)
+		}
+		if m.Name != "cpu.usage" || m.DeviceID != "device-001" {
+			t.Errorf("Expected series identity kept, got %s/%s", m.Name, m.DeviceID)
+		}
+	}
+	if found != 4 {
+		t.Errorf("Expected 4 aggregates for core 0, got %d", found)
+	}
+}
+
+func TestRollup_LeavesSmallAndIneligibleGroups(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	bucket := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	storeSeries(t, storage, "disk.usage", "0", bucket, time.Minute, 3) // Would not shrink
+	storeSeries(t, storage, "cpu.usage", "0", bucket, 5*time.Second, 60)
+	storeSeries(t, storage, "memory.usage", "0", bucket, 5*time.Second, 60)
+	if _, err := storage.db.Exec("UPDATE metrics SET uploaded = 1 WHERE metric_name = 'memory.usage'"); err != nil {
+		t.Fatalf("Failed to mark uploaded: %v", err)
+	}
+	if err := storage.Store(ctx, models.NewStringMetric("cpu.state", "ok", "device-001").WithTimestamp(bucket)); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	result, err := storage.Rollup(ctx, RollupPolicy{MinAge: 6 * time.Hour}, rollupNow)
+	if err != nil {
+		t.Fatalf("Rollup failed: %v", err)
+	}
+	if result.RawCompacted != 60 {
+		t.Errorf("Expected only cpu.usage compacted, got %d rows", result.RawCompacted)
+	}
+	if got := countWhere(t, storage, "metric_name = 'disk.usage' AND rollup_ms = 0"); got != 3 {
+		t.Errorf("Expected small group left raw, got %d", got)
+	}
+	if got := countWhere(t, storage, "metric_name = 'memory.usage' AND rollup_ms = 0"); got != 60 {
+		t.Errorf("Expected uploaded rows left alone, got %d", got)
+	}
+	if got := countWhere(t, storage, "value_type = 1"); got != 1 {
+		t.Errorf("Expected string metric left alone, got %d", got)
+	}
+}
+
+func TestRollup_QueuesOnlyWaitingDestinations(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	if err := storage.SetDestinations(ctx, []string{DefaultDestination, "archive"}); err != nil {
+		t.Fatalf("SetDestinations failed: %v", err)
+	}
+	bucket := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	storeSeries(t, storage, "cpu.usage", "0", bucket, 5*time.Second, 60)
+
+	// The default destination already has the raw points
+	raw, err := storage.QueryUnuploadedFor(ctx, DefaultDestination, 0)
+	if err != nil {
+		t.Fatalf("QueryUnuploadedFor failed: %v", err)
+	}
+	if err := storage.MarkUploadedFor(ctx, DefaultDestination, storedIDs(t, raw)); err != nil {
+		t.Fatalf("MarkUploadedFor failed: %v", err)
+	}
+
+	if _, err := storage.Rollup(ctx, RollupPolicy{MinAge: 6 * time.Hour}, rollupNow); err != nil {
+		t.Fatalf("Rollup failed: %v", err)
+	}
+	if count, _ := storage.GetPendingCountFor(ctx, DefaultDestination); count != 0 {
+		t.Errorf("Expected nothing queued for default, got %d", count)
+	}
+	if count, _ := storage.GetPendingCountFor(ctx, "archive"); count != 4 {
+		t.Errorf("Expected 4 rollups queued for archive, got %d", count)
+	}
+}
+
+func TestRollup_RolledBucketsStayRolled(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	bucket := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	storeSeries(t, storage, "cpu.usage", "0", bucket, 5*time.Second, 60)
+	policy := RollupPolicy{MinAge: 6 * time.Hour}
+	if _, err := storage.Rollup(ctx, policy, rollupNow); err != nil {
+		t.Fatalf("Rollup failed: %v", err)
+	}
+
+	// A second pass finds nothing; late rows for a rolled-up bucket stay raw
+	storeSeries(t, storage, "cpu.usage", "0", bucket.Add(time.Second), 5*time.Second, 10)
+	result, err := storage.Rollup(ctx, policy, rollupNow)
+	if err != nil {
+		t.Fatalf("Rollup failed: %v", err)
+	}
+	if result.RawCompacted != 0 || result.RollupsCreated != 0 {
+		t.Errorf("Expected no changes on a rolled-up bucket, got %+v", result)
+	}
+	if got := countWhere(t, storage, "rollup_ms = 0"); got != 10 {
+		t.Errorf("Expected late rows kept raw, got %d", got)
+	}
+}
+
+func TestApplyRetention_RollsUpFirst(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	storeSeries(t, storage, "cpu.usage", "0", time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC), 5*time.Second, 60)
+
+	result, err := storage.ApplyRetention(ctx, RetentionPolicy{Rollup: RollupPolicy{MinAge: 6 * time.Hour}}, rollupNow)
+	if err != nil {
+		t.Fatalf("ApplyRetention failed: %v", err)
+	}
+	if result.RolledUp != 60 || result.RollupsCreated != 4 {
+		t.Errorf("Expected 60 rows rolled into 4, got %+v", result)
+	}
+	if count, _ := storage.Count(ctx); count != 4 {
+		t.Errorf("Expected 4 rows left, got %d", count)
+	}
+}
+
+func TestFormatResolution(t *testing.T) {
+	tests := map[time.Duration]string{
+		5 * time.Minute:         "5m",
+		time.Hour:               "1h",
+		90 * time.Second:        "90s",
+		1500 * time.Millisecond: "1500ms",
+	}
+	for d, want := range tests {
+		if got := formatResolution(d); got != want {
+			t.Errorf("formatResolution(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestRollup_KeepsKindAndUnit(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	bucket := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	metrics := make([]*models.Metric, 60)
+	for i := range metrics {
+		metrics[i] = models.NewMetric("network.rx_bytes_total", float64(i), "device-001").
+			AsCounter("bytes").
+			WithTimestamp(bucket.Add(time.Duration(i) * 5 * time.Second))
+	}
+	if err := storage.StoreBatch(ctx, metrics); err != nil {
+		t.Fatalf("Failed to store metrics: %v", err)
+	}
+
+	if _, err := storage.Rollup(ctx, RollupPolicy{MinAge: 6 * time.Hour}, rollupNow); err != nil {
+		t.Fatalf("Rollup failed: %v", err)
+	}
+	pending, err := storage.QueryUnuploadedFor(ctx, DefaultDestination, 0)
+	if err != nil {
+		t.Fatalf("QueryUnuploadedFor failed: %v", err)
+	}
+	if len(pending) != 4 {
+		t.Fatalf("Expected 4 rollups, got %d", len(pending))
+	}
+	for _, m := range pending {
+		if m.Kind != models.KindCounter || m.Unit != "bytes" {
+			t.Errorf("Expected rollup to keep counter/bytes, got %q/%q", m.Kind, m.Unit)
+		}
+	}
+}
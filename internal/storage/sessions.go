@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Session statuses stored in sessions.status
+const (
+	SessionActive      = "active"      // Trigger still firing
+	SessionEnded       = "ended"       // Trigger stopped and the close grace period passed
+	SessionInterrupted = "interrupted" // tidewatch stopped or crashed while the session was active
+)
+
+// Session is a streaming session: a period in which a configured trigger was active
+// Metrics collected during the session carry its ID in metrics.session_id.
+type Session struct {
+	ID      string
+	Start   time.Time
+	End     time.Time // Zero while active
+	Status  string
+	Trigger string // Trigger that opened the session (e.g., "unit:srt-stream.service")
+	Samples int64  // Metrics stamped with the session ID
+}
+
+// sessionMetadata is the JSON stored in sessions.metadata
+type sessionMetadata struct {
+	Trigger string `json:"trigger"`
+	Samples int64  `json:"samples"`
+}
+
+// OpenSession records a new active session
+func (s *SQLiteStorage) OpenSession(ctx context.Context, session Session) error {
+	metadata, err := json.Marshal(sessionMetadata{Trigger: session.Trigger})
+	if err != nil {
+		return fmt.Errorf("failed to encode session metadata: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx,
+		"INSERT INTO sessions (id, start_time, status, metadata) VALUES (?, ?, ?, ?)",
+		session.ID, session.Start.UnixMilli(), SessionActive, string(metadata))
+	if err != nil {
+		return fmt.Errorf("failed to open session %s: %w", session.ID, err)
+	}
+	return nil
+}
+
+// CloseSession records the end time, final status and sample count of a session
+func (s *SQLiteStorage) CloseSession(ctx context.Context, session Session) error {
+	metadata, err := json.Marshal(sessionMetadata{Trigger: session.Trigger, Samples: session.Samples})
+	if err != nil {
+		return fmt.Errorf("failed to encode session metadata: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx,
+		"UPDATE sessions SET end_time = ?, status = ?, metadata = ? WHERE id = ?",
+		session.End.UnixMilli(), session.Status, string(metadata), session.ID)
+	if err != nil {
+		return fmt.Errorf("failed to close session %s: %w", session.ID, err)
+	}
+	return nil
+}
+
+// InterruptSessions closes sessions left active by a previous run that did not shut down cleanly
+// Each ends at its newest stored metric and its sample count is taken from the metrics table.
+// Returns the sessions it closed.
+func (s *SQLiteStorage) InterruptSessions(ctx context.Context) ([]Session, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT s.id, s.start_time, s.metadata,
+			(SELECT MAX(timestamp_ms) FROM metrics WHERE session_id = s.id),
+			(SELECT COUNT(*) FROM metrics WHERE session_id = s.id)
+		FROM sessions s
+		WHERE s.status = ?
+		ORDER BY s.start_time
+	`, SessionActive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query active sessions: %w", err)
+	}
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		var startMs int64
+		var metadata sql.NullString
+		var lastMs sql.NullInt64
+		if err := rows.Scan(&session.ID, &startMs, &metadata, &lastMs, &session.Samples); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		session.Start = time.UnixMilli(startMs)
+		session.End = session.Start
+		if lastMs.Valid && lastMs.Int64 > startMs {
+			session.End = time.UnixMilli(lastMs.Int64)
+		}
+		session.Status = SessionInterrupted
+		if metadata.Valid {
+			var meta sessionMetadata
+			if err := json.Unmarshal([]byte(metadata.String), &meta); err == nil {
+				session.Trigger = meta.Trigger
+			}
+		}
+		sessions = append(sessions, session)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sessions: %w", err)
+	}
+
+	for _, session := range sessions {
+		metadata, err := json.Marshal(sessionMetadata{Trigger: session.Trigger, Samples: session.Samples})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode session metadata: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE sessions SET end_time = ?, status = ?, metadata = ? WHERE id = ?",
+			session.End.UnixMilli(), session.Status, string(metadata), session.ID); err != nil {
+			return nil, fmt.Errorf("failed to interrupt session %s: %w", session.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return sessions, nil
+}
+
+// SetPrioritySession makes QueryUnuploadedFor return the pending rows of session before any other ("" = none)
+func (s *SQLiteStorage) SetPrioritySession(id string) {
+	s.sessionMu.Lock()
+	s.prioritySession = id
+	s.sessionMu.Unlock()
+}
+
+// PrioritySession returns the session whose rows are uploaded first ("" = none)
+func (s *SQLiteStorage) PrioritySession() string {
+	s.sessionMu.RLock()
+	defer s.sessionMu.RUnlock()
+	return s.prioritySession
+}
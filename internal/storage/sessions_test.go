@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+func TestSessions_OpenAndClose(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	session := Session{ID: "20260301T100000Z-0a1b2c3d", Start: start, Trigger: "process:ffmpeg"}
+	if err := storage.OpenSession(ctx, session); err != nil {
+		t.Fatalf("OpenSession failed: %v", err)
+	}
+	if err := storage.OpenSession(ctx, session); err == nil {
+		t.Error("Expected a duplicate session ID to be rejected")
+	}
+
+	session.End = start.Add(10 * time.Minute)
+	session.Status = SessionEnded
+	session.Samples = 1200
+	if err := storage.CloseSession(ctx, session); err != nil {
+		t.Fatalf("CloseSession failed: %v", err)
+	}
+
+	var endMs int64
+	var status, metadata string
+	if err := storage.db.QueryRow("SELECT end_time, status, metadata FROM sessions WHERE id = ?", session.ID).
+		Scan(&endMs, &status, &metadata); err != nil {
+		t.Fatalf("Failed to read session: %v", err)
+	}
+	if endMs != session.End.UnixMilli() || status != SessionEnded {
+		t.Errorf("Expected the session ended at %d, got %s at %d", session.End.UnixMilli(), status, endMs)
+	}
+	if metadata != `{"trigger":"process:ffmpeg","samples":1200}` {
+		t.Errorf("Unexpected metadata %s", metadata)
+	}
+}
+
+func TestSessions_InterruptLeftoverSessions(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	ended := Session{ID: "ended", Start: start.Add(-time.Hour), End: start.Add(-30 * time.Minute), Status: SessionEnded}
+	crashed := Session{ID: "crashed", Start: start, Trigger: "unit:srt-stream.service"}
+	empty := Session{ID: "empty", Start: start.Add(time.Hour)}
+	for _, s := range []Session{ended, crashed, empty} {
+		if err := storage.OpenSession(ctx, s); err != nil {
+			t.Fatalf("OpenSession failed: %v", err)
+		}
+	}
+	if err := storage.CloseSession(ctx, ended); err != nil {
+		t.Fatalf("CloseSession failed: %v", err)
+	}
+
+	var metrics []*models.Metric
+	for i := 0; i < 3; i++ {
+		m := models.NewMetric("srt.bitrate_bps", 4e6, "device-001").WithTimestamp(start.Add(time.Duration(i) * time.Minute))
+		m.SessionID = crashed.ID
+		metrics = append(metrics, m)
+	}
+	if err := storage.StoreBatch(ctx, metrics); err != nil {
+		t.Fatalf("StoreBatch failed: %v", err)
+	}
+
+	interrupted, err := storage.InterruptSessions(ctx)
+	if err != nil {
+		t.Fatalf("InterruptSessions failed: %v", err)
+	}
+	if len(interrupted) != 2 {
+		t.Fatalf("Expected the two active sessions to be interrupted, got %+v", interrupted)
+	}
+
+	// Ends at the newest stored metric, with the samples counted from the metrics table
+	got := interrupted[0]
+	if got.ID != crashed.ID || got.Status != SessionInterrupted || got.Samples != 3 ||
+		!got.End.Equal(start.Add(2*time.Minute)) || got.Trigger != crashed.Trigger {
+		t.Errorf("Unexpected interrupted session %+v", got)
+	}
+	// Without metrics a session ends where it started
+	if got := interrupted[1]; got.ID != empty.ID || got.Samples != 0 || !got.End.Equal(empty.Start) {
+		t.Errorf("Unexpected interrupted session %+v", got)
+	}
+
+	var status string
+	if err := storage.db.QueryRow("SELECT status FROM sessions WHERE id = ?", ended.ID).Scan(&status); err != nil || status != SessionEnded {
+		t.Errorf("Expected the ended session untouched, got %q (err: %v)", status, err)
+	}
+	if again, err := storage.InterruptSessions(ctx); err != nil || len(again) != 0 {
+		t.Errorf("Expected nothing left to interrupt, got %d (err: %v)", len(again), err)
+	}
+}
+
+func TestQueryUnuploadedFor_PrioritySessionFirst(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	var metrics []*models.Metric
+	for i := 0; i < 4; i++ {
+		metrics = append(metrics, models.NewMetric("cpu.usage", float64(i), "device-001").WithTimestamp(base.Add(time.Duration(i)*time.Second)))
+	}
+	for i := 0; i < 2; i++ {
+		m := models.NewMetric("srt.bitrate_bps", float64(i), "device-001").WithTimestamp(base.Add(time.Hour + time.Duration(i)*time.Second))
+		m.SessionID = "live"
+		metrics = append(metrics, m)
+	}
+	if err := storage.StoreBatch(ctx, metrics); err != nil {
+		t.Fatalf("StoreBatch failed: %v", err)
+	}
+
+	// Without a priority session, oldest first
+	got, err := storage.QueryUnuploadedFor(ctx, DefaultDestination, 3)
+	if err != nil {
+		t.Fatalf("QueryUnuploadedFor failed: %v", err)
+	}
+	if got[0].Name != "cpu.usage" {
+		t.Errorf("Expected the oldest row first, got %s", got[0].Name)
+	}
+
+	storage.SetPrioritySession("live")
+	got, err = storage.QueryUnuploadedFor(ctx, DefaultDestination, 3)
+	if err != nil {
+		t.Fatalf("QueryUnuploadedFor failed: %v", err)
+	}
+	if len(got) != 3 || got[0].Name != "srt.bitrate_bps" || got[1].Name != "srt.bitrate_bps" || got[2].Name != "cpu.usage" {
+		t.Errorf("Expected both session rows before the backlog, got %s, %s, %s", got[0].Name, got[1].Name, got[2].Name)
+	}
+	if got[0].TimestampMs > got[1].TimestampMs {
+		t.Error("Expected session rows oldest first")
+	}
+}
@@ -8,10 +8,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/taniwha3/tidewatch/internal/models"
@@ -35,16 +37,28 @@ type Storage interface {
 
 // QueryOptions defines options for querying metrics
 type QueryOptions struct {
-	StartMs    int64  // Start timestamp in milliseconds (inclusive)
-	EndMs      int64  // End timestamp in milliseconds (inclusive)
-	DeviceID   string // Filter by device ID (empty = all devices)
-	MetricName string // Filter by metric name (empty = all metrics)
-	Limit      int    // Maximum number of results (0 = no limit)
+	StartMs       int64             // Start timestamp in milliseconds (inclusive)
+	EndMs         int64             // End timestamp in milliseconds (inclusive)
+	DeviceID      string            // Filter by device ID (empty = all devices)
+	MetricName    string            // Filter by metric name (empty = all metrics)
+	Tags          map[string]string // Only rows carrying every one of these tags (empty = no filter)
+	OrderBySeries bool              // Group rows by series (name, device, tags), then time, instead of time only
+	Limit         int               // Maximum number of results (0 = no limit)
 }
 
 // SQLiteStorage implements Storage using SQLite
 type SQLiteStorage struct {
-	db *sql.DB
+	db       *sql.DB
+	readOnly bool // Opened with OpenReadOnly: no migrations, no WAL checkpoint on close
+
+	destMu       sync.RWMutex
+	destinations []string // Registered upload destinations, new rows are queued for each
+
+	clockMu sync.RWMutex
+	clock   ClockSource // Holds rows while the wall clock is unsynchronized (nil = always trusted)
+
+	sessionMu       sync.RWMutex
+	prioritySession string // Session whose pending rows are uploaded first ("" = none)
 }
 
 // NewSQLiteStorage creates a new SQLite storage instance
@@ -72,12 +86,13 @@ func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
 
 	// Apply SQLite tuning PRAGMAs for ARM SBC
 	pragmas := []string{
-		"PRAGMA journal_mode=WAL",    // Write-ahead logging for better concurrency
-		"PRAGMA synchronous=NORMAL",  // Balance between performance and safety
-		"PRAGMA busy_timeout=10000",  // Wait up to 10s for locks
-		"PRAGMA temp_store=MEMORY",   // Use memory for temp tables
-		"PRAGMA cache_size=-64000",   // 64MB cache (negative = KB)
-		"PRAGMA mmap_size=268435456", // 256MB memory-mapped I/O
+		"PRAGMA auto_vacuum=INCREMENTAL", // Must precede table creation; lets retention return space to the filesystem
+		"PRAGMA journal_mode=WAL",        // Write-ahead logging for better concurrency
+		"PRAGMA synchronous=NORMAL",      // Balance between performance and safety
+		"PRAGMA busy_timeout=10000",      // Wait up to 10s for locks
+		"PRAGMA temp_store=MEMORY",       // Use memory for temp tables
+		"PRAGMA cache_size=-64000",       // 64MB cache (negative = KB)
+		"PRAGMA mmap_size=268435456",     // 256MB memory-mapped I/O
 	}
 
 	for _, pragma := range pragmas {
@@ -93,7 +108,67 @@ func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
 	}
 
-	return &SQLiteStorage{db: db}, nil
+	s := &SQLiteStorage{db: db}
+	if err := s.loadDestinations(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// OpenReadOnly opens an existing database for reading alongside a running daemon
+// The connection uses SQLite's read-only mode and WAL, so it needs no process lock and never
+// blocks the writer. The schema is not migrated: a database older than this binary is rejected.
+func OpenReadOnly(dbPath string) (*SQLiteStorage, error) {
+	dsn := dbPath
+	if !strings.HasPrefix(dsn, "file:") {
+		if _, err := os.Stat(dbPath); err != nil {
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
+		dsn = "file:" + dsn
+	}
+	if strings.Contains(dsn, "?") {
+		dsn += "&mode=ro"
+	} else {
+		dsn += "?mode=ro"
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+
+	pragmas := []string{
+		"PRAGMA busy_timeout=10000", // Wait for the daemon's write transactions
+		"PRAGMA query_only=1",       // Belt and braces on top of mode=ro
+	}
+	for _, pragma := range pragmas {
+		if _, err := db.Exec(pragma); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to set pragma %s: %w", pragma, err)
+		}
+	}
+
+	var version int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to get schema version (not a tidewatch database?): %w", err)
+	}
+	if version < schemaVersion {
+		db.Close()
+		return nil, fmt.Errorf("database schema v%d is older than v%d: start tidewatch once to migrate it", version, schemaVersion)
+	}
+
+	s := &SQLiteStorage{db: db, readOnly: true}
+	if err := s.loadDestinations(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
 }
 
 // initSchema creates the database tables and indexes
@@ -105,6 +180,9 @@ func initSchema(db *sql.DB) error {
 	return nil
 }
 
+// schemaVersion is the version of the last migration
+const schemaVersion = 10
+
 // migrateSchema handles schema versioning and migrations
 func migrateSchema(db *sql.DB) error {
 	// Create schema_version table if it doesn't exist
@@ -212,6 +290,83 @@ func migrateSchema(db *sql.DB) error {
 				-- NOTE: This migration is executed via migrateV5RegenerateDedupKeys() due to custom logic needs
 			`,
 		},
+		{
+			version: 6,
+			sql: `
+				-- Per-destination upload state
+				-- A row in upload_queue means the metric still has to be sent to that destination.
+				-- metrics.uploaded is kept as a derived flag: 1 once no destination is waiting for the row
+				CREATE TABLE IF NOT EXISTS upload_destinations (
+					name TEXT PRIMARY KEY,
+					added_at INTEGER NOT NULL
+				);
+
+				CREATE TABLE IF NOT EXISTS upload_queue (
+					destination TEXT NOT NULL,
+					metric_id INTEGER NOT NULL,
+					PRIMARY KEY (destination, metric_id)
+				) WITHOUT ROWID;
+
+				CREATE INDEX IF NOT EXISTS idx_upload_queue_metric ON upload_queue(metric_id);
+
+				-- Deleting a metric (retention, DeleteBefore) drops it from every queue
+				CREATE TRIGGER IF NOT EXISTS trg_metrics_delete_upload_queue
+				AFTER DELETE ON metrics
+				BEGIN
+					DELETE FROM upload_queue WHERE metric_id = OLD.id;
+				END;
+
+				-- Existing single-endpoint state becomes the "default" destination
+				INSERT OR IGNORE INTO upload_destinations (name, added_at) VALUES ('default', strftime('%s', 'now'));
+				INSERT OR IGNORE INTO upload_queue (destination, metric_id)
+					SELECT 'default', id FROM metrics WHERE uploaded = 0 AND value_type = 0;
+			`,
+		},
+		{
+			version: 7,
+			sql: `
+				-- Rows stored while the wall clock was unsynchronized (no RTC, NTP not yet synced)
+				-- unsynced_boot identifies the boot the row was held in (NULL = timestamp trusted);
+				-- uptime_ms is the time since that boot, used to rewrite timestamp_ms once the clock syncs
+				ALTER TABLE metrics ADD COLUMN unsynced_boot INTEGER;
+				ALTER TABLE metrics ADD COLUMN uptime_ms INTEGER;
+
+				CREATE INDEX IF NOT EXISTS idx_unsynced_boot ON metrics(unsynced_boot) WHERE unsynced_boot IS NOT NULL;
+			`,
+		},
+		{
+			version: 8,
+			sql: `
+				-- Rollups: min/max/avg/count aggregates that replace old pending raw rows
+				-- rollup_ms is the bucket width of an aggregate row (0 = raw row)
+				ALTER TABLE metrics ADD COLUMN rollup_ms INTEGER NOT NULL DEFAULT 0;
+			`,
+		},
+		{
+			version: 9,
+			sql: `
+				-- Declared metric kind (gauge, counter, histogram) and base unit
+				-- NULL for rows stored before collectors declared them; exporters fall back to name heuristics
+				ALTER TABLE metrics ADD COLUMN kind TEXT;
+				ALTER TABLE metrics ADD COLUMN unit TEXT;
+			`,
+		},
+		{
+			version: 10,
+			sql: `
+				-- Bytes sent by uploads per local day and network interface, for bandwidth budgets
+				CREATE TABLE IF NOT EXISTS bandwidth_usage (
+					day TEXT NOT NULL,
+					interface TEXT NOT NULL,
+					bytes INTEGER NOT NULL,
+					PRIMARY KEY (day, interface)
+				) WITHOUT ROWID;
+			`,
+		},
+	}
+
+	if migrations[len(migrations)-1].version != schemaVersion {
+		return fmt.Errorf("schemaVersion %d does not match the last migration", schemaVersion)
 	}
 
 	for _, migration := range migrations {
@@ -396,11 +551,6 @@ func migrateV3Backfill(tx *sql.Tx) error {
 	return nil
 }
 
-// generateSessionID creates a unique session identifier
-func generateSessionID() string {
-	return fmt.Sprintf("session_%d_%d", os.Getpid(), time.Now().UnixNano())
-}
-
 // generateDedupKey creates a unique deduplication key for a metric
 // Uses JSON encoding to avoid delimiter collisions
 // Format: sha256(json({name, timestamp_ms, device_id, tags, value_type}))
@@ -461,6 +611,14 @@ func serializeTags(tags map[string]string) (string, error) {
 	return string(data), nil
 }
 
+// nullIfEmpty stores undeclared kinds and units, and metrics outside a session, as NULL
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
 // Store saves a single metric with deduplication
 func (s *SQLiteStorage) Store(ctx context.Context, metric *models.Metric) error {
 	return s.StoreBatch(ctx, []*models.Metric{metric})
@@ -468,11 +626,28 @@ func (s *SQLiteStorage) Store(ctx context.Context, metric *models.Metric) error
 
 // StoreBatch saves multiple metrics in a single transaction with deduplication
 func (s *SQLiteStorage) StoreBatch(ctx context.Context, metrics []*models.Metric) error {
-	if len(metrics) == 0 {
+	hold, held := s.clockHold()
+	return s.storeBatches(ctx, []clockedBatch{{metrics: metrics, hold: hold, held: held}})
+}
+
+// clockedBatch is a batch of metrics with the clock state from when it was handed to storage
+type clockedBatch struct {
+	metrics []*models.Metric
+	hold    ClockReading
+	held    bool
+}
+
+// storeBatches saves several batches in a single transaction, each with its own clock state
+func (s *SQLiteStorage) storeBatches(ctx context.Context, batches []clockedBatch) error {
+	total := 0
+	for _, b := range batches {
+		total += len(b.metrics)
+	}
+	if total == 0 {
 		return nil
 	}
 
-	sessionID := generateSessionID()
+	destinations := s.Destinations()
 
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -483,9 +658,10 @@ func (s *SQLiteStorage) StoreBatch(ctx context.Context, metrics []*models.Metric
 	stmt, err := tx.PrepareContext(ctx, `
 		INSERT INTO metrics (
 			timestamp_ms, metric_name, metric_value, value_text, value_type,
-			device_id, uploaded, priority, session_id, dedup_key, tags_json
+			device_id, uploaded, priority, session_id, dedup_key, tags_json,
+			unsynced_boot, uptime_ms, kind, unit
 		)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT (dedup_key) DO NOTHING
 	`)
 	if err != nil {
@@ -493,28 +669,68 @@ func (s *SQLiteStorage) StoreBatch(ctx context.Context, metrics []*models.Metric
 	}
 	defer stmt.Close()
 
-	for _, metric := range metrics {
-		dedupKey := generateDedupKey(metric)
-		tagsJSON, err := serializeTags(metric.Tags)
-		if err != nil {
-			return fmt.Errorf("failed to serialize tags: %w", err)
-		}
+	queueStmt, err := tx.PrepareContext(ctx, "INSERT OR IGNORE INTO upload_queue (destination, metric_id) VALUES (?, ?)")
+	if err != nil {
+		return fmt.Errorf("failed to prepare queue statement: %w", err)
+	}
+	defer queueStmt.Close()
 
-		_, err = stmt.ExecContext(ctx,
-			metric.TimestampMs,
-			metric.Name,
-			metric.Value,
-			metric.ValueText,
-			int(metric.ValueType),
-			metric.DeviceID,
-			0, // uploaded = false
-			1, // priority = normal
-			sessionID,
-			dedupKey,
-			tagsJSON,
-		)
-		if err != nil {
-			return fmt.Errorf("failed to insert metric: %w", err)
+	for _, b := range batches {
+		for _, metric := range b.metrics {
+			dedupKey := generateDedupKey(metric)
+			tagsJSON, err := serializeTags(metric.Tags)
+			if err != nil {
+				return fmt.Errorf("failed to serialize tags: %w", err)
+			}
+
+			// While the clock is unsynchronized, remember when the row was created relative to boot
+			var unsyncedBoot, uptimeMs interface{}
+			if b.held {
+				unsyncedBoot = b.hold.Boot
+				uptimeMs = b.hold.UptimeMs - (b.hold.WallMs - metric.TimestampMs)
+			}
+
+			result, err := stmt.ExecContext(ctx,
+				metric.TimestampMs,
+				metric.Name,
+				metric.Value,
+				metric.ValueText,
+				int(metric.ValueType),
+				metric.DeviceID,
+				0, // uploaded = false
+				metric.Priority.Rank(),
+				nullIfEmpty(metric.SessionID),
+				dedupKey,
+				tagsJSON,
+				unsyncedBoot,
+				uptimeMs,
+				nullIfEmpty(string(metric.Kind)),
+				nullIfEmpty(metric.Unit),
+			)
+			if err != nil {
+				return fmt.Errorf("failed to insert metric: %w", err)
+			}
+
+			// Queue new numeric rows for every destination (duplicates and string metrics are never uploaded)
+			if metric.ValueType != models.ValueTypeNumeric || len(destinations) == 0 {
+				continue
+			}
+			inserted, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("failed to get rows affected: %w", err)
+			}
+			if inserted == 0 {
+				continue
+			}
+			id, err := result.LastInsertId()
+			if err != nil {
+				return fmt.Errorf("failed to get metric id: %w", err)
+			}
+			for _, dest := range destinations {
+				if _, err := queueStmt.ExecContext(ctx, dest, id); err != nil {
+					return fmt.Errorf("failed to queue metric for %s: %w", dest, err)
+				}
+			}
 		}
 	}
 
@@ -527,97 +743,28 @@ func (s *SQLiteStorage) StoreBatch(ctx context.Context, metrics []*models.Metric
 
 // Query retrieves metrics within a time range
 func (s *SQLiteStorage) Query(ctx context.Context, opts QueryOptions) ([]*models.Metric, error) {
-	query := "SELECT id, timestamp_ms, metric_name, metric_value, value_text, value_type, device_id, tags_json FROM metrics WHERE 1=1"
-	args := []interface{}{}
-
-	if opts.StartMs > 0 {
-		query += " AND timestamp_ms >= ?"
-		args = append(args, opts.StartMs)
-	}
-
-	if opts.EndMs > 0 {
-		query += " AND timestamp_ms <= ?"
-		args = append(args, opts.EndMs)
-	}
-
-	if opts.DeviceID != "" {
-		query += " AND device_id = ?"
-		args = append(args, opts.DeviceID)
-	}
-
-	if opts.MetricName != "" {
-		query += " AND metric_name = ?"
-		args = append(args, opts.MetricName)
-	}
-
-	query += " ORDER BY timestamp_ms ASC"
-
-	if opts.Limit > 0 {
-		query += " LIMIT ?"
-		args = append(args, opts.Limit)
-	}
-
-	rows, err := s.db.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query metrics: %w", err)
-	}
-	defer rows.Close()
-
 	var metrics []*models.Metric
-	for rows.Next() {
-		m := &models.Metric{
-			Tags: make(map[string]string),
-		}
-		var tagsJSON sql.NullString
-		var valueText sql.NullString
-		var valueType int
-		var id int64
-
-		err := rows.Scan(
-			&id,
-			&m.TimestampMs,
-			&m.Name,
-			&m.Value,
-			&valueText,
-			&valueType,
-			&m.DeviceID,
-			&tagsJSON,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
-		}
-
-		// Set value_text and value_type
-		if valueText.Valid {
-			m.ValueText = valueText.String
-		}
-		m.ValueType = models.ValueType(valueType)
-
-		// Deserialize tags if present
-		if tagsJSON.Valid && tagsJSON.String != "" {
-			if err := json.Unmarshal([]byte(tagsJSON.String), &m.Tags); err != nil {
-				return nil, fmt.Errorf("failed to unmarshal tags: %w", err)
-			}
-		}
-
+	err := s.QueryEach(ctx, opts, func(m *models.Metric) error {
 		metrics = append(metrics, m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %w", err)
-	}
-
 	return metrics, nil
 }
 
-// QueryUnuploaded retrieves metrics that haven't been uploaded yet
+// QueryUnuploaded retrieves metrics that haven't been uploaded to every destination yet
+// Use QueryUnuploadedFor to read a single destination's backlog
 // Only returns numeric metrics (value_type=0) since VictoriaMetrics doesn't accept string metrics
 // String metrics remain in SQLite for local event processing
+// Rows held for an unsynchronized clock are skipped until their timestamps are corrected
+// Rows without a value (SQLite stores NaN as NULL) are never returned, since no receiver accepts them
 func (s *SQLiteStorage) QueryUnuploaded(ctx context.Context, limit int) ([]*models.Metric, error) {
 	query := `
-		SELECT id, timestamp_ms, metric_name, metric_value, value_text, value_type, device_id, tags_json
+		SELECT id, timestamp_ms, metric_name, metric_value, value_text, value_type, device_id, tags_json, kind, unit
 		FROM metrics
-		WHERE uploaded = 0 AND value_type = 0
+		WHERE uploaded = 0 AND value_type = 0 AND metric_value IS NOT NULL AND unsynced_boot IS NULL
 		ORDER BY priority DESC, timestamp_ms ASC
 	`
 	args := []interface{}{}
@@ -633,13 +780,21 @@ func (s *SQLiteStorage) QueryUnuploaded(ctx context.Context, limit int) ([]*mode
 	}
 	defer rows.Close()
 
+	return scanUploadRows(rows)
+}
+
+// scanUploadRows scans metrics selected for upload, storing each row ID in the _storage_id tag
+// Columns: id, timestamp_ms, metric_name, metric_value, value_text, value_type, device_id, tags_json, kind, unit
+func scanUploadRows(rows *sql.Rows) ([]*models.Metric, error) {
 	var metrics []*models.Metric
 	for rows.Next() {
 		m := &models.Metric{
 			Tags: make(map[string]string),
 		}
 		var tagsJSON sql.NullString
+		var value sql.NullFloat64
 		var valueText sql.NullString
+		var kind, unit sql.NullString
 		var valueType int
 		var id int64
 
@@ -647,21 +802,28 @@ func (s *SQLiteStorage) QueryUnuploaded(ctx context.Context, limit int) ([]*mode
 			&id,
 			&m.TimestampMs,
 			&m.Name,
-			&m.Value,
+			&value,
 			&valueText,
 			&valueType,
 			&m.DeviceID,
 			&tagsJSON,
+			&kind,
+			&unit,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
+		// NaN is stored as NULL; the upload queries skip such rows, so this only guards other callers
+		m.Value = nullFloat(value)
+
 		// Set value_text and value_type
 		if valueText.Valid {
 			m.ValueText = valueText.String
 		}
 		m.ValueType = models.ValueType(valueType)
+		m.Kind = models.Kind(kind.String)
+		m.Unit = unit.String
 
 		// Store ID in tags for tracking
 		if m.Tags == nil {
@@ -690,7 +852,15 @@ func (s *SQLiteStorage) QueryUnuploaded(ctx context.Context, limit int) ([]*mode
 	return metrics, nil
 }
 
-// MarkUploaded marks metrics as uploaded
+// nullFloat returns a metric_value read from SQLite, which stores NaN as NULL
+func nullFloat(v sql.NullFloat64) float64 {
+	if !v.Valid {
+		return math.NaN()
+	}
+	return v.Float64
+}
+
+// MarkUploaded marks metrics as uploaded to every destination
 func (s *SQLiteStorage) MarkUploaded(ctx context.Context, ids []int64) error {
 	if len(ids) == 0 {
 		return nil
@@ -710,7 +880,13 @@ func (s *SQLiteStorage) MarkUploaded(ctx context.Context, ids []int64) error {
 		args[i] = id
 	}
 
-	query := fmt.Sprintf("UPDATE metrics SET uploaded = 1 WHERE id IN (%s)", strings.Join(placeholders, ","))
+	inClause := strings.Join(placeholders, ",")
+	query := fmt.Sprintf("DELETE FROM upload_queue WHERE metric_id IN (%s)", inClause)
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to dequeue uploaded metrics: %w", err)
+	}
+
+	query = fmt.Sprintf("UPDATE metrics SET uploaded = 1 WHERE id IN (%s)", inClause)
 	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
 		return fmt.Errorf("failed to mark metrics as uploaded: %w", err)
 	}
@@ -722,7 +898,7 @@ func (s *SQLiteStorage) MarkUploaded(ctx context.Context, ids []int64) error {
 	return nil
 }
 
-// GetPendingCount returns the count of unuploaded numeric metrics
+// GetPendingCount returns the count of numeric metrics not yet uploaded to every destination
 // Only counts value_type=0 (numeric) since string metrics are not uploaded to VictoriaMetrics
 // This prevents string metrics from inflating the pending count and triggering false health degradation
 func (s *SQLiteStorage) GetPendingCount(ctx context.Context) (int64, error) {
@@ -734,6 +910,30 @@ func (s *SQLiteStorage) GetPendingCount(ctx context.Context) (int64, error) {
 	return count, nil
 }
 
+// GetPendingCountByPriority returns GetPendingCount broken down by priority class
+// Classes without pending metrics are omitted.
+func (s *SQLiteStorage) GetPendingCountByPriority(ctx context.Context) (map[models.Priority]int64, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT priority, COUNT(*) FROM metrics WHERE uploaded = 0 AND value_type = 0 GROUP BY priority")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count pending metrics by priority: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[models.Priority]int64)
+	for rows.Next() {
+		var rank int
+		var count int64
+		if err := rows.Scan(&rank, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan pending count: %w", err)
+		}
+		counts[models.PriorityFromRank(rank)] += count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating pending counts: %w", err)
+	}
+	return counts, nil
+}
+
 // Count returns the total number of metrics in storage
 func (s *SQLiteStorage) Count(ctx context.Context) (int64, error) {
 	var count int64
@@ -1036,7 +1236,10 @@ func (s *SQLiteStorage) performCheckpoint(logger *slog.Logger, reason string) {
 func (s *SQLiteStorage) Close() error {
 	if s.db != nil {
 		// Checkpoint WAL before closing (using Exec as per engineering review)
-		s.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+		// A read-only connection leaves the WAL to the daemon
+		if !s.readOnly {
+			s.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+		}
 		return s.db.Close()
 	}
 	return nil
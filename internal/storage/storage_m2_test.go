@@ -80,8 +80,8 @@ func TestSchemaMigration_Idempotent(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Failed to get schema version: %v", err)
 		}
-		if version != 5 {
-			t.Errorf("Expected schema version 5, got %d", version)
+		if version != 10 {
+			t.Errorf("Expected schema version 10, got %d", version)
 		}
 
 		storage.Close()
@@ -114,22 +114,19 @@ func TestSchemaMigration_SessionIDStorage(t *testing.T) {
 	defer cleanup()
 
 	ctx := context.Background()
-	metric := models.NewMetric("cpu.temperature", 50.0, "device-001")
-	if err := storage.Store(ctx, metric); err != nil {
-		t.Fatalf("Failed to store metric: %v", err)
+	outside := models.NewMetric("cpu.temperature", 50.0, "device-001")
+	inside := models.NewMetric("cpu.temperature", 51.0, "device-001").WithTimestamp(time.UnixMilli(outside.TimestampMs + 1000))
+	inside.SessionID = "20260301T100000Z-0a1b2c3d"
+	if err := storage.StoreBatch(ctx, []*models.Metric{outside, inside}); err != nil {
+		t.Fatalf("Failed to store metrics: %v", err)
 	}
 
-	// Verify session_id is stored
-	var sessionID string
-	err := storage.db.QueryRow("SELECT session_id FROM metrics LIMIT 1").Scan(&sessionID)
-	if err != nil {
-		t.Fatalf("Failed to query session_id: %v", err)
-	}
-	if sessionID == "" {
-		t.Error("Expected non-empty session_id")
+	// Only metrics collected during a session carry a session_id
+	if got := countWhere(t, storage, "session_id IS NULL"); got != 1 {
+		t.Errorf("Expected one row outside a session, got %d", got)
 	}
-	if len(sessionID) < 10 {
-		t.Errorf("Session ID seems too short: %s", sessionID)
+	if got := countWhere(t, storage, "session_id = ?", inside.SessionID); got != 1 {
+		t.Errorf("Expected one row stamped with the session ID, got %d", got)
 	}
 }
 
@@ -3,8 +3,10 @@ package storage
 import (
 	"context"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -785,3 +787,148 @@ func TestGetWALSize_WithURIPath(t *testing.T) {
 
 	t.Logf("WAL size with URI path: %d bytes", walSize)
 }
+
+func TestStoreBatch_KindAndUnit(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	metrics := []*models.Metric{
+		models.NewMetric("network.rx_bytes_total", 1024, "device-001").AsCounter("bytes"),
+		models.NewMetric("cpu.usage_percent", 12.5, "device-001").AsGauge("percent"),
+		models.NewMetric("legacy.metric", 1, "device-001"), // Stored without a kind
+	}
+	if err := storage.StoreBatch(ctx, metrics); err != nil {
+		t.Fatalf("StoreBatch failed: %v", err)
+	}
+	if got := countWhere(t, storage, "kind IS NULL AND unit IS NULL"); got != 1 {
+		t.Errorf("Expected undeclared kind and unit stored as NULL, got %d rows", got)
+	}
+
+	want := map[string][2]string{
+		"network.rx_bytes_total": {"counter", "bytes"},
+		"cpu.usage_percent":      {"gauge", "percent"},
+		"legacy.metric":          {"", ""},
+	}
+	check := func(source string, got []*models.Metric) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("%s: expected %d metrics, got %d", source, len(want), len(got))
+		}
+		for _, m := range got {
+			if w := want[m.Name]; string(m.Kind) != w[0] || m.Unit != w[1] {
+				t.Errorf("%s: %s = %q/%q, want %q/%q", source, m.Name, m.Kind, m.Unit, w[0], w[1])
+			}
+		}
+	}
+
+	queried, err := storage.Query(ctx, QueryOptions{})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	check("Query", queried)
+
+	pending, err := storage.QueryUnuploadedFor(ctx, DefaultDestination, 0)
+	if err != nil {
+		t.Fatalf("QueryUnuploadedFor failed: %v", err)
+	}
+	check("QueryUnuploadedFor", pending)
+}
+
+func TestStoreBatch_PriorityClasses(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// Bulk rows are the oldest, so age alone would upload them first
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	var metrics []*models.Metric
+	for i, p := range []models.Priority{models.PriorityP3, models.PriorityP3, models.PriorityDefault, models.PriorityP1, models.PriorityP0} {
+		m := models.NewMetric("metric."+string(p), float64(i), "device-001").WithTimestamp(base.Add(time.Duration(i) * time.Second))
+		m.Priority = p
+		metrics = append(metrics, m)
+	}
+	if err := storage.StoreBatch(ctx, metrics); err != nil {
+		t.Fatalf("StoreBatch failed: %v", err)
+	}
+
+	pending, err := storage.QueryUnuploadedFor(ctx, DefaultDestination, 0)
+	if err != nil {
+		t.Fatalf("QueryUnuploadedFor failed: %v", err)
+	}
+	var order []string
+	for _, m := range pending {
+		order = append(order, m.Name)
+	}
+	if strings.Join(order, ",") != "metric.P0,metric.P1,metric.,metric.P3,metric.P3" {
+		t.Errorf("Expected P0 first and P3 last, got %v", order)
+	}
+
+	counts, err := storage.GetPendingCountByPriority(ctx)
+	if err != nil {
+		t.Fatalf("GetPendingCountByPriority failed: %v", err)
+	}
+	want := map[models.Priority]int64{models.PriorityP0: 1, models.PriorityP1: 1, models.PriorityP2: 1, models.PriorityP3: 2}
+	if len(counts) != len(want) {
+		t.Errorf("Expected %v, got %v", want, counts)
+	}
+	for p, n := range want {
+		if counts[p] != n {
+			t.Errorf("Expected %d pending %s, got %d", n, p, counts[p])
+		}
+	}
+}
+
+func TestStoreBatch_NaNValues(t *testing.T) {
+	storage, _, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// SQLite stores NaN as NULL; such rows must not break uploads, rollups or exports
+	bucket := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	var metrics []*models.Metric
+	for i := 0; i < 10; i++ {
+		ts := bucket.Add(time.Duration(i) * time.Second)
+		metrics = append(metrics,
+			models.NewMetric("latency.p50", math.NaN(), "device-001").WithTimestamp(ts),
+			models.NewMetric("latency.count", float64(i), "device-001").WithTimestamp(ts))
+	}
+	if err := storage.StoreBatch(ctx, metrics); err != nil {
+		t.Fatalf("StoreBatch failed: %v", err)
+	}
+
+	pending, err := storage.QueryUnuploadedFor(ctx, DefaultDestination, 0)
+	if err != nil {
+		t.Fatalf("QueryUnuploadedFor failed: %v", err)
+	}
+	if len(pending) != 10 {
+		t.Fatalf("Expected only the 10 rows with a value, got %d", len(pending))
+	}
+	for _, m := range pending {
+		if m.Name != "latency.count" {
+			t.Errorf("Expected no NaN rows for upload, got %+v", m)
+		}
+	}
+
+	result, err := storage.Rollup(ctx, RollupPolicy{MinAge: time.Hour, Resolution: 5 * time.Minute}, bucket.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("Rollup failed: %v", err)
+	}
+	if result.RawCompacted != 10 {
+		t.Errorf("Expected only the rows with a value rolled up, got %d", result.RawCompacted)
+	}
+
+	var nan int
+	err = storage.QueryEach(ctx, QueryOptions{MetricName: "latency.p50"}, func(m *models.Metric) error {
+		if math.IsNaN(m.Value) {
+			nan++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("QueryEach failed: %v", err)
+	}
+	if nan != 10 {
+		t.Errorf("Expected 10 NaN rows exported, got %d", nan)
+	}
+}
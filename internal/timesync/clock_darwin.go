@@ -0,0 +1,25 @@
+//go:build darwin
+
+package timesync
+
+import (
+	"errors"
+	"time"
+)
+
+var errUnsupported = errors.New("not supported on darwin")
+
+// kernelSynced is not available on macOS; the plausibility check decides alone
+func kernelSynced() (bool, error) {
+	return false, errUnsupported
+}
+
+// uptime returns the time since process start, as boot time is not needed for development builds
+func uptime() (time.Duration, error) {
+	return time.Since(processStart), nil
+}
+
+// bootID is not available on macOS; each process is treated as its own boot
+func bootID() (string, error) {
+	return "", errUnsupported
+}
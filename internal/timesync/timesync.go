@@ -0,0 +1,293 @@
+// Package timesync detects an unsynchronized wall clock and corrects the timestamps of metrics
+// stored before it synchronized. Orange Pi boards and similar devices have no RTC: they boot with a
+// clock stuck in 1970 or at the last shutdown time until NTP catches up.
+package timesync
+
+import (
+	"context"
+	"hash/fnv"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/storage"
+)
+
+const (
+	// DefaultCheckInterval is how often the sync status is checked
+	DefaultCheckInterval = 10 * time.Second
+
+	// DefaultMaxWait is how long to hold rows before giving up and uploading them as recorded
+	DefaultMaxWait = time.Hour
+
+	// DefaultJumpThreshold is the forward step of the wall clock (relative to uptime) taken as a sync
+	DefaultJumpThreshold = time.Minute
+)
+
+// MinValidTime is the earliest plausible wall clock time; anything before it is an unset clock
+var MinValidTime = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Store holds and corrects rows stored while the clock was unsynchronized
+type Store interface {
+	CorrectHeld(ctx context.Context, ref storage.ClockReading) (int64, error)
+	ReleaseHeld(ctx context.Context, keepBoot int64) (int64, error)
+}
+
+// Config configures a Monitor
+type Config struct {
+	CheckInterval time.Duration // Default: 10s
+	MaxWait       time.Duration // Default: 1h
+	JumpThreshold time.Duration // Default: 1m
+	Logger        *slog.Logger
+}
+
+// Monitor tracks whether the wall clock can be trusted and implements storage.ClockSource
+//
+// The clock counts as synchronized once any of these is seen with a plausible wall clock:
+//   - the kernel reports NTP sync (adjtimex)
+//   - the wall clock steps forward by more than JumpThreshold relative to uptime
+//   - the clock skew check (monitoring.clock_skew_url) reports a skew within its threshold
+//
+// Until then storage holds new rows with their uptime. On sync they are rewritten from the first
+// trusted reading; if the clock has not synced after MaxWait they are released unchanged.
+type Monitor struct {
+	store         Store
+	logger        *slog.Logger
+	checkInterval time.Duration
+	maxWait       time.Duration
+	jumpThreshold time.Duration
+	boot          int64
+
+	// Clock access, replaced in tests
+	now          func() time.Time
+	uptime       func() (time.Duration, error)
+	kernelSynced func() (bool, error)
+
+	mu      sync.Mutex
+	started time.Duration        // Uptime when the monitor was created
+	synced  bool                 // Wall clock trusted (or given up on)
+	gaveUp  bool                 // MaxWait expired without sync
+	ref     storage.ClockReading // First trusted reading
+	last    storage.ClockReading // Previous reading, for jump detection
+	skewOK  bool                 // Clock skew check agreed with the local clock
+}
+
+// New creates a monitor and evaluates the clock once, so Hold is accurate before Start
+func New(cfg Config, store Store) *Monitor {
+	m := &Monitor{
+		store:         store,
+		logger:        cfg.Logger,
+		checkInterval: cfg.CheckInterval,
+		maxWait:       cfg.MaxWait,
+		jumpThreshold: cfg.JumpThreshold,
+		now:           time.Now,
+		uptime:        uptime,
+		kernelSynced:  kernelSynced,
+	}
+	if m.logger == nil {
+		m.logger = slog.Default()
+	}
+	if m.checkInterval <= 0 {
+		m.checkInterval = DefaultCheckInterval
+	}
+	if m.maxWait <= 0 {
+		m.maxWait = DefaultMaxWait
+	}
+	if m.jumpThreshold <= 0 {
+		m.jumpThreshold = DefaultJumpThreshold
+	}
+	m.boot = currentBoot()
+	m.init()
+	return m
+}
+
+// init takes the first reading and decides whether to start holding rows
+func (m *Monitor) init() {
+	reading := m.read()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.started = time.Duration(reading.UptimeMs) * time.Millisecond
+	m.last = reading
+	if reason := m.syncEvidence(reading); reason != "" {
+		m.synced = true
+		m.ref = reading
+		return
+	}
+	m.logger.Warn("Wall clock is not synchronized, holding metrics until it is",
+		slog.Time("wall_clock", time.UnixMilli(reading.WallMs)),
+		slog.Duration("max_wait", m.maxWait),
+	)
+}
+
+// currentBoot derives a non-zero key for the current boot from the kernel boot ID
+// Without a boot ID (e.g., macOS) every process counts as its own boot
+func currentBoot() int64 {
+	id, err := bootID()
+	if err != nil || id == "" {
+		id = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	key := int64(h.Sum64() >> 1)
+	if key == 0 {
+		key = 1
+	}
+	return key
+}
+
+// read returns the current wall clock and uptime
+func (m *Monitor) read() storage.ClockReading {
+	wall := m.now()
+	up, err := m.uptime()
+	if err != nil {
+		// Fall back to the process monotonic clock; only rows from this process can be corrected
+		up = time.Since(processStart)
+	}
+	return storage.ClockReading{
+		Boot:     m.boot,
+		WallMs:   wall.UnixMilli(),
+		UptimeMs: up.Milliseconds(),
+	}
+}
+
+// processStart anchors the uptime fallback
+var processStart = time.Now()
+
+// syncEvidence returns why the wall clock can be trusted, or "" if it can't yet
+// Must be called with m.mu held.
+func (m *Monitor) syncEvidence(reading storage.ClockReading) string {
+	if reading.WallMs < MinValidTime.UnixMilli() {
+		return ""
+	}
+
+	synced, err := m.kernelSynced()
+	if err != nil {
+		// No kernel sync status on this platform: a plausible clock is the best we can do
+		return "plausible wall clock"
+	}
+	if synced {
+		return "kernel clock synchronized"
+	}
+
+	if m.last.WallMs != 0 {
+		wallDelta := reading.WallMs - m.last.WallMs
+		uptimeDelta := reading.UptimeMs - m.last.UptimeMs
+		if time.Duration(wallDelta-uptimeDelta)*time.Millisecond >= m.jumpThreshold {
+			return "wall clock stepped forward"
+		}
+	}
+
+	if m.skewOK {
+		return "clock skew check"
+	}
+	return ""
+}
+
+// Hold implements storage.ClockSource: it returns the current reading while the clock is untrusted
+func (m *Monitor) Hold() (storage.ClockReading, bool) {
+	m.mu.Lock()
+	synced := m.synced
+	m.mu.Unlock()
+
+	if synced {
+		return storage.ClockReading{}, false
+	}
+	return m.read(), true
+}
+
+// Synced reports whether the wall clock is trusted (false while rows are being held)
+func (m *Monitor) Synced() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.synced && !m.gaveUp
+}
+
+// ReportSkew feeds a clock skew measurement against a remote server into the sync decision
+func (m *Monitor) ReportSkew(skewMs, thresholdMs int64) {
+	if skewMs > thresholdMs || skewMs < -thresholdMs {
+		return
+	}
+	m.mu.Lock()
+	m.skewOK = true
+	m.mu.Unlock()
+}
+
+// Start checks the clock until it is synchronized and every held row has been corrected
+// Rows held by an earlier boot are released first: their uptime can't be related to this boot.
+func (m *Monitor) Start(ctx context.Context) {
+	if released, err := m.store.ReleaseHeld(ctx, m.boot); err != nil {
+		m.logger.Error("Failed to release metrics held by an earlier boot", slog.Any("error", err))
+	} else if released > 0 {
+		m.logger.Warn("Released metrics held by an earlier boot with their original timestamps",
+			slog.Int64("count", released),
+		)
+	}
+
+	ticker := time.NewTicker(m.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		if m.check(ctx) {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check runs one sync check and corrects or releases held rows once the clock is settled
+// Returns true when there is nothing left to do.
+func (m *Monitor) check(ctx context.Context) bool {
+	reading := m.read()
+
+	m.mu.Lock()
+	wasSynced := m.synced
+	if !m.synced {
+		if reason := m.syncEvidence(reading); reason != "" {
+			m.synced = true
+			m.ref = reading
+			m.logger.Info("Wall clock synchronized, correcting held metrics",
+				slog.String("reason", reason),
+				slog.Time("wall_clock", time.UnixMilli(reading.WallMs)),
+			)
+		} else if time.Duration(reading.UptimeMs)*time.Millisecond-m.started >= m.maxWait {
+			m.synced = true
+			m.gaveUp = true
+			m.logger.Warn("Wall clock still not synchronized, releasing held metrics with their recorded timestamps",
+				slog.Duration("max_wait", m.maxWait),
+			)
+		}
+	}
+	m.last = reading
+	synced, gaveUp, ref := m.synced, m.gaveUp, m.ref
+	m.mu.Unlock()
+
+	if !synced {
+		return false
+	}
+
+	var handled int64
+	var err error
+	if gaveUp {
+		handled, err = m.store.ReleaseHeld(ctx, 0)
+	} else {
+		handled, err = m.store.CorrectHeld(ctx, ref)
+	}
+	if err != nil {
+		m.logger.Error("Failed to correct held metrics", slog.Any("error", err))
+		return false
+	}
+	if handled > 0 && !gaveUp {
+		m.logger.Info("Corrected timestamps of held metrics", slog.Int64("count", handled))
+	}
+
+	// A store that read Hold() just before the switch may still insert a held row,
+	// so keep going until a pass after the switch finds nothing
+	return wasSynced && handled == 0
+}
@@ -0,0 +1,251 @@
+package timesync
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/storage"
+)
+
+// fakeStore records correction and release calls
+type fakeStore struct {
+	mu        sync.Mutex
+	corrected []storage.ClockReading
+	released  []int64
+	held      int64 // Rows returned by the next correction or full release
+}
+
+func (s *fakeStore) CorrectHeld(ctx context.Context, ref storage.ClockReading) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.corrected = append(s.corrected, ref)
+	n := s.held
+	s.held = 0
+	return n, nil
+}
+
+func (s *fakeStore) ReleaseHeld(ctx context.Context, keepBoot int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.released = append(s.released, keepBoot)
+	if keepBoot != 0 {
+		return 0, nil
+	}
+	n := s.held
+	s.held = 0
+	return n, nil
+}
+
+// fakeClock drives a monitor's wall clock, uptime and kernel sync status
+type fakeClock struct {
+	wall         time.Time
+	uptime       time.Duration
+	kernelSynced bool
+	kernelErr    error
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.wall = c.wall.Add(d)
+	c.uptime += d
+}
+
+// newTestMonitor builds a monitor on a fake clock
+func newTestMonitor(clock *fakeClock, store Store) *Monitor {
+	m := &Monitor{
+		store:         store,
+		logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		checkInterval: time.Second,
+		maxWait:       time.Hour,
+		jumpThreshold: time.Minute,
+		boot:          7,
+		now:           func() time.Time { return clock.wall },
+		uptime:        func() (time.Duration, error) { return clock.uptime, nil },
+		kernelSynced:  func() (bool, error) { return clock.kernelSynced, clock.kernelErr },
+	}
+	m.init()
+	return m
+}
+
+var stale = time.Date(1970, 1, 1, 0, 0, 30, 0, time.UTC)
+
+func TestMonitor_SyncedAtStart(t *testing.T) {
+	clock := &fakeClock{wall: time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC), uptime: time.Minute, kernelSynced: true}
+	m := newTestMonitor(clock, &fakeStore{})
+
+	if !m.Synced() {
+		t.Error("Expected a kernel-synchronized clock to be trusted at start")
+	}
+	if _, held := m.Hold(); held {
+		t.Error("Expected no hold when the clock is synchronized")
+	}
+}
+
+func TestMonitor_ImplausibleClockHeldEvenIfKernelSynced(t *testing.T) {
+	clock := &fakeClock{wall: stale, uptime: 30 * time.Second, kernelSynced: true}
+	m := newTestMonitor(clock, &fakeStore{})
+
+	reading, held := m.Hold()
+	if !held {
+		t.Fatal("Expected a 1970 clock to be held")
+	}
+	if reading.Boot != 7 || reading.UptimeMs != 30_000 || reading.WallMs != stale.UnixMilli() {
+		t.Errorf("Unexpected reading %+v", reading)
+	}
+}
+
+func TestMonitor_KernelSyncCorrectsHeldRows(t *testing.T) {
+	clock := &fakeClock{wall: stale, uptime: 30 * time.Second}
+	store := &fakeStore{held: 5}
+	m := newTestMonitor(clock, store)
+	ctx := context.Background()
+
+	if m.check(ctx) {
+		t.Fatal("Expected check to continue while unsynchronized")
+	}
+	if len(store.corrected) != 0 {
+		t.Fatal("Expected no correction before sync")
+	}
+
+	// NTP steps the clock and the kernel reports sync
+	clock.uptime += 10 * time.Second
+	clock.wall = time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	clock.kernelSynced = true
+
+	if m.check(ctx) {
+		t.Error("Expected one more pass after the switch")
+	}
+	if !m.Synced() {
+		t.Error("Expected monitor to be synced")
+	}
+	if len(store.corrected) != 1 {
+		t.Fatalf("Expected one correction, got %d", len(store.corrected))
+	}
+	ref := store.corrected[0]
+	if ref.WallMs != clock.wall.UnixMilli() || ref.UptimeMs != 40_000 || ref.Boot != 7 {
+		t.Errorf("Expected correction from the first trusted reading, got %+v", ref)
+	}
+
+	// The next pass uses the same reference and finishes once nothing is left
+	clock.advance(time.Second)
+	if !m.check(ctx) {
+		t.Error("Expected check to finish after a clean pass")
+	}
+	if store.corrected[1] != ref {
+		t.Errorf("Expected later passes to reuse the sync reference, got %+v", store.corrected[1])
+	}
+}
+
+func TestMonitor_ForwardJumpCountsAsSync(t *testing.T) {
+	// Last shutdown time restored by fake-hwclock: plausible, but not synchronized
+	clock := &fakeClock{wall: time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC), uptime: 20 * time.Second}
+	store := &fakeStore{}
+	m := newTestMonitor(clock, store)
+	ctx := context.Background()
+
+	clock.advance(10 * time.Second)
+	m.check(ctx)
+	if m.Synced() {
+		t.Fatal("Expected a steady unsynchronized clock to stay held")
+	}
+
+	// Wall clock jumps 50 days forward while uptime advances 10s
+	clock.uptime += 10 * time.Second
+	clock.wall = clock.wall.Add(50 * 24 * time.Hour)
+	m.check(ctx)
+	if !m.Synced() {
+		t.Error("Expected a large forward step to count as sync")
+	}
+}
+
+func TestMonitor_SkewReportCountsAsSync(t *testing.T) {
+	clock := &fakeClock{wall: time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC), uptime: 20 * time.Second}
+	m := newTestMonitor(clock, &fakeStore{})
+
+	m.ReportSkew(-50_000, 2000)
+	m.check(context.Background())
+	if m.Synced() {
+		t.Fatal("Expected a large skew to keep holding")
+	}
+
+	m.ReportSkew(150, 2000)
+	m.check(context.Background())
+	if !m.Synced() {
+		t.Error("Expected a skew within threshold to count as sync")
+	}
+}
+
+func TestMonitor_MaxWaitReleasesRows(t *testing.T) {
+	clock := &fakeClock{wall: stale, uptime: 30 * time.Second}
+	store := &fakeStore{held: 3}
+	m := newTestMonitor(clock, store)
+	ctx := context.Background()
+
+	clock.advance(59 * time.Minute)
+	m.check(ctx)
+	if len(store.released) != 0 {
+		t.Fatal("Expected rows held until max_wait")
+	}
+
+	clock.advance(time.Minute)
+	m.check(ctx)
+	if len(store.released) != 1 || store.released[0] != 0 {
+		t.Errorf("Expected every held row released after max_wait, got %v", store.released)
+	}
+	if m.Synced() {
+		t.Error("Expected Synced to stay false after giving up")
+	}
+	if _, held := m.Hold(); held {
+		t.Error("Expected new rows not to be held after giving up")
+	}
+	if len(store.corrected) != 0 {
+		t.Error("Expected no timestamp correction after giving up")
+	}
+}
+
+func TestMonitor_UnsupportedKernelStatusTrustsPlausibleClock(t *testing.T) {
+	clock := &fakeClock{
+		wall:      time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC),
+		uptime:    time.Minute,
+		kernelErr: errors.New("not supported"),
+	}
+	m := newTestMonitor(clock, &fakeStore{})
+	if !m.Synced() {
+		t.Error("Expected a plausible clock to be trusted without a kernel sync status")
+	}
+}
+
+func TestMonitor_StartReleasesEarlierBoots(t *testing.T) {
+	clock := &fakeClock{wall: time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC), uptime: time.Minute, kernelSynced: true}
+	store := &fakeStore{}
+	m := newTestMonitor(clock, store)
+
+	done := make(chan struct{})
+	go func() {
+		m.Start(context.Background())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Start to return once the clock is synced and nothing is held")
+	}
+
+	if len(store.released) != 1 || store.released[0] != 7 {
+		t.Errorf("Expected rows from other boots released, got %v", store.released)
+	}
+	if len(store.corrected) != 1 {
+		t.Errorf("Expected rows held by an earlier process in this boot to be corrected, got %d passes", len(store.corrected))
+	}
+}
+
+func TestCurrentBoot(t *testing.T) {
+	if currentBoot() == 0 {
+		t.Error("Expected a non-zero boot key")
+	}
+}
@@ -0,0 +1,193 @@
+package uploader
+
+import (
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a circuit breaker
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // Uploads run every cycle
+	BreakerOpen     BreakerState = "open"      // Remote is down, cycles are skipped
+	BreakerHalfOpen BreakerState = "half_open" // One probe cycle is allowed through
+)
+
+// Value returns the state as a gauge value: 0 closed, 1 half-open, 2 open
+func (s BreakerState) Value() int {
+	switch s {
+	case BreakerHalfOpen:
+		return 1
+	case BreakerOpen:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// BreakerConfig configures a circuit breaker
+type BreakerConfig struct {
+	FailureThreshold int           // Failed cycles in a row that open the breaker, default: 3
+	OpenTimeout      time.Duration // Wait before the first probe, default: 1m
+	MaxOpenTimeout   time.Duration // Cap for the wait, which doubles after each failed probe, default: 10m
+}
+
+// rampCycles is how many times the batch size is halved for a probe cycle
+// (e.g., 2500 rows: a 312-row probe, then 625, 1250 and 2500 once closed)
+const rampCycles = 3
+
+// Breaker pauses uploads while a remote is unreachable
+// Closed, it counts failed upload cycles; once FailureThreshold fail in a row it opens and Allow
+// returns false, so cycles skip the database query and chunk encoding entirely. When the open
+// timeout expires it lets one probe cycle through (half-open): success closes it, failure opens
+// it again with twice the timeout. After closing, BatchSize ramps back up over a few cycles
+// so a recovering link is not hit with full batches straight away.
+type Breaker struct {
+	mu             sync.Mutex
+	cfg            BreakerConfig
+	state          BreakerState
+	failures       int           // Consecutive failed cycles
+	openTimeout    time.Duration // Current wait, doubled by each failed probe
+	openUntil      time.Time
+	ramp           int   // Halvings still applied to the batch size
+	opens          int64 // Times the breaker opened
+	now            func() time.Time
+	onStateChanged func(from, to BreakerState)
+}
+
+// NewBreaker creates a closed circuit breaker
+func NewBreaker(cfg BreakerConfig) *Breaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 3
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = time.Minute
+	}
+	if cfg.MaxOpenTimeout < cfg.OpenTimeout {
+		cfg.MaxOpenTimeout = max(10*time.Minute, cfg.OpenTimeout)
+	}
+	return &Breaker{
+		cfg:         cfg,
+		state:       BreakerClosed,
+		openTimeout: cfg.OpenTimeout,
+		now:         time.Now,
+	}
+}
+
+// OnStateChange registers a callback for state transitions (e.g., for logging)
+// It is called with the breaker's lock held and must not call back into the breaker.
+func (b *Breaker) OnStateChange(fn func(from, to BreakerState)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onStateChanged = fn
+}
+
+// Allow reports whether an upload cycle may run
+// An open breaker whose timeout expired moves to half-open and allows the probe cycle.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen {
+		if b.now().Before(b.openUntil) {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+	}
+	return true
+}
+
+// Success records a successful upload cycle
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	if b.state == BreakerHalfOpen {
+		b.openTimeout = b.cfg.OpenTimeout
+		b.ramp = rampCycles
+		b.setState(BreakerClosed)
+	}
+	// The probe cycle used the smallest batch, so the first closed cycle doubles it
+	if b.ramp > 0 {
+		b.ramp--
+	}
+}
+
+// Failure records a failed upload cycle or probe
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	switch b.state {
+	case BreakerHalfOpen:
+		b.openTimeout = min(2*b.openTimeout, b.cfg.MaxOpenTimeout)
+		b.open()
+	case BreakerClosed:
+		if b.failures >= b.cfg.FailureThreshold {
+			b.open()
+		}
+	}
+}
+
+// open moves to the open state for the current timeout; b.mu must be held
+func (b *Breaker) open() {
+	b.openUntil = b.now().Add(b.openTimeout)
+	b.opens++
+	b.setState(BreakerOpen)
+}
+
+// setState changes the state and notifies the callback; b.mu must be held
+func (b *Breaker) setState(state BreakerState) {
+	from := b.state
+	b.state = state
+	if b.onStateChanged != nil && from != state {
+		b.onStateChanged(from, state)
+	}
+}
+
+// BatchSize scales a full batch size to the current ramp
+// A probe cycle uploads the smallest batch; each successful cycle after closing doubles it.
+func (b *Breaker) BatchSize(full int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	shift := b.ramp
+	if b.state == BreakerHalfOpen {
+		shift = rampCycles
+	}
+	return max(full>>shift, 1)
+}
+
+// State returns the current state
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Failures returns the number of failed cycles in a row
+func (b *Breaker) Failures() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures
+}
+
+// NextProbe returns when an open breaker lets the next probe through (zero unless open)
+func (b *Breaker) NextProbe() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != BreakerOpen {
+		return time.Time{}
+	}
+	return b.openUntil
+}
+
+// Opens returns how many times the breaker has opened
+func (b *Breaker) Opens() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.opens
+}
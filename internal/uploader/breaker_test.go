@@ -0,0 +1,160 @@
+package uploader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestBreaker returns a breaker on a fake clock
+func newTestBreaker(cfg BreakerConfig, now *time.Time) *Breaker {
+	b := NewBreaker(cfg)
+	b.now = func() time.Time { return *now }
+	return b
+}
+
+func TestBreaker_OpensAfterThreshold(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	b := newTestBreaker(BreakerConfig{FailureThreshold: 3, OpenTimeout: time.Minute, MaxOpenTimeout: 3 * time.Minute}, &now)
+
+	var transitions []BreakerState
+	b.OnStateChange(func(from, to BreakerState) { transitions = append(transitions, to) })
+
+	// A success resets the count
+	b.Failure()
+	b.Failure()
+	b.Success()
+	b.Failure()
+	b.Failure()
+	if b.State() != BreakerClosed || !b.Allow() {
+		t.Fatalf("Expected closed below the threshold, got %s", b.State())
+	}
+
+	b.Failure()
+	if b.State() != BreakerOpen || b.Allow() {
+		t.Fatalf("Expected open after 3 failures in a row, got %s", b.State())
+	}
+	if !b.NextProbe().Equal(now.Add(time.Minute)) || b.Opens() != 1 {
+		t.Errorf("Expected the next probe in 1m, got %v (opens %d)", b.NextProbe(), b.Opens())
+	}
+
+	// Each failed probe doubles the wait up to the cap
+	for i, wait := range []time.Duration{2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		now = b.NextProbe()
+		if !b.Allow() || b.State() != BreakerHalfOpen {
+			t.Fatalf("Probe %d: expected half-open once the timeout expired, got %s", i, b.State())
+		}
+		b.Failure()
+		if b.State() != BreakerOpen || !b.NextProbe().Equal(now.Add(wait)) {
+			t.Errorf("Probe %d: expected open for %v, got %s until %v", i, wait, b.State(), b.NextProbe())
+		}
+	}
+
+	now = b.NextProbe()
+	b.Allow()
+	b.Success()
+	if b.State() != BreakerClosed || b.Failures() != 0 {
+		t.Errorf("Expected a successful probe to close the breaker, got %s", b.State())
+	}
+
+	// The wait starts over after closing
+	b.Failure()
+	b.Failure()
+	b.Failure()
+	if !b.NextProbe().Equal(now.Add(time.Minute)) {
+		t.Errorf("Expected the open timeout reset to 1m, got %v", b.NextProbe().Sub(now))
+	}
+
+	want := []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerClosed, BreakerOpen}
+	if len(transitions) != len(want) {
+		t.Fatalf("Expected transitions %v, got %v", want, transitions)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Errorf("Transition %d: expected %s, got %s", i, want[i], transitions[i])
+		}
+	}
+}
+
+func TestBreaker_RampsBatchSize(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	b := newTestBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}, &now)
+
+	if got := b.BatchSize(2500); got != 2500 {
+		t.Errorf("Expected the full batch while closed, got %d", got)
+	}
+
+	b.Failure()
+	now = now.Add(time.Minute)
+	b.Allow()
+
+	// Probe with an eighth, then double every successful cycle
+	var sizes []int
+	for i := 0; i < 5; i++ {
+		sizes = append(sizes, b.BatchSize(2500))
+		b.Success()
+	}
+	want := []int{312, 625, 1250, 2500, 2500}
+	for i := range want {
+		if sizes[i] != want[i] {
+			t.Errorf("Cycle %d: expected batch size %d, got %d", i, want[i], sizes[i])
+		}
+	}
+
+	if got := b.BatchSize(0); got != 1 {
+		t.Errorf("Expected at least one row, got %d", got)
+	}
+}
+
+func TestBreakerState_Value(t *testing.T) {
+	for state, want := range map[BreakerState]int{BreakerClosed: 0, BreakerHalfOpen: 1, BreakerOpen: 2} {
+		if got := state.Value(); got != want {
+			t.Errorf("%s.Value() = %d, want %d", state, got, want)
+		}
+	}
+}
+
+func TestHTTPUploader_Probe(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/health" {
+			t.Errorf("Unexpected probe %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("Expected the upload auth token on the probe")
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	u := NewHTTPUploaderWithConfig(HTTPUploaderConfig{
+		URL:       server.URL + "/api/v1/import",
+		ProbeURL:  server.URL + "/health",
+		AuthToken: "secret",
+	})
+	ctx := context.Background()
+
+	if err := u.Probe(ctx); err != nil {
+		t.Errorf("Expected the probe to pass, got %v", err)
+	}
+	status = http.StatusNotFound
+	if err := u.Probe(ctx); err != nil {
+		t.Errorf("Expected any response below 500 to count as reachable, got %v", err)
+	}
+	status = http.StatusServiceUnavailable
+	if err := u.Probe(ctx); err == nil {
+		t.Error("Expected a 503 to fail the probe")
+	}
+
+	server.Close()
+	if err := u.Probe(ctx); err == nil {
+		t.Error("Expected an unreachable server to fail the probe")
+	}
+
+	// Without a probe URL the next upload is the probe
+	if err := NewHTTPUploader("http://127.0.0.1:1/api/v1/import", "device-001").Probe(ctx); err != nil {
+		t.Errorf("Expected no probe without a probe URL, got %v", err)
+	}
+}
@@ -0,0 +1,371 @@
+package uploader
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/golang/snappy"
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+// Prometheus remote_write 1.0 format implementation
+// See: https://prometheus.io/docs/concepts/remote_write_spec/
+//
+// The WriteRequest protobuf is encoded by hand to avoid pulling in the
+// Prometheus and gogo/protobuf dependency trees for five small messages:
+//
+//	message WriteRequest   { repeated TimeSeries timeseries = 1; repeated MetricMetadata metadata = 3; }
+//	message TimeSeries     { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label          { string name = 1; string value = 2; }
+//	message Sample         { double value = 1; int64 timestamp = 2; }
+//	message MetricMetadata { MetricType type = 1; string metric_family_name = 2; string unit = 5; }
+
+// Upload protocols supported by HTTPUploader
+const (
+	ProtocolVictoriaMetrics       = "victoriametrics"
+	ProtocolPrometheusRemoteWrite = "prometheus_remote_write"
+)
+
+// RemoteWriteVersion is sent in the X-Prometheus-Remote-Write-Version header
+const RemoteWriteVersion = "0.1.0"
+
+// Protobuf wire types used by the WriteRequest messages
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// MetricMetadata.MetricType values
+var rwMetricTypes = map[models.Kind]uint64{
+	models.KindCounter:   1,
+	models.KindGauge:     2,
+	models.KindHistogram: 3,
+}
+
+// RWMetadata is the type and unit of a metric family
+type RWMetadata struct {
+	Family string
+	Kind   models.Kind
+	Unit   string
+}
+
+// RWLabel is a single remote_write label
+type RWLabel struct {
+	Name  string
+	Value string
+}
+
+// RWSample is a single remote_write sample
+type RWSample struct {
+	Value     float64
+	Timestamp int64 // Milliseconds since epoch
+}
+
+// RWTimeSeries is a remote_write series with labels sorted by name
+type RWTimeSeries struct {
+	Labels  []RWLabel
+	Samples []RWSample
+}
+
+// SanitizeLabelName returns a valid Prometheus label name for a tag key
+func SanitizeLabelName(name string) string {
+	return sanitizeLabelName(name)
+}
+
+// sanitizeLabelName converts a tag key into a valid Prometheus label name
+// Prometheus requires [a-zA-Z_][a-zA-Z0-9_]*; VictoriaMetrics is more lenient, so this is only
+// applied to remote_write
+func sanitizeLabelName(name string) string {
+	var b strings.Builder
+	b.Grow(len(name))
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// BuildRemoteWrite converts metrics to an uncompressed remote_write WriteRequest
+// Metrics with identical labels are merged into one series, with samples in timestamp order
+// String metrics (ValueType=1) are filtered out as remote_write only accepts numeric values
+// Returns the protobuf data and a slice of storage IDs for metrics that were actually included
+func BuildRemoteWrite(metrics []*models.Metric) ([]byte, []int64, error) {
+	if len(metrics) == 0 {
+		return []byte{}, nil, nil
+	}
+
+	var series []*RWTimeSeries
+	seriesByKey := make(map[string]*RWTimeSeries)
+	var metadata []RWMetadata
+	families := make(map[string]bool)
+	var includedIDs []int64
+
+	for _, m := range metrics {
+		// Skip string metrics - remote_write only accepts numeric values
+		if m.ValueType == models.ValueTypeString {
+			continue
+		}
+
+		// Extract storage ID before filtering tags
+		var storageID int64
+		if idStr, ok := m.Tags["_storage_id"]; ok {
+			fmt.Sscanf(idStr, "%d", &storageID)
+		}
+
+		labels := map[string]string{"__name__": seriesName(m)}
+		if m.DeviceID != "" {
+			labels["device_id"] = m.DeviceID
+		}
+		for k, v := range m.Tags {
+			// Skip internal storage tags and empty values (an empty label is the same as no label)
+			if isInternalTag(k) || v == "" {
+				continue
+			}
+			labels[sanitizeLabelName(k)] = v
+		}
+
+		key := models.SeriesKey(labels)
+		ts, ok := seriesByKey[key]
+		if !ok {
+			ts = &RWTimeSeries{Labels: sortedLabels(labels)}
+			seriesByKey[key] = ts
+			series = append(series, ts)
+		}
+		ts.Samples = append(ts.Samples, RWSample{Value: m.Value, Timestamp: m.TimestampMs})
+
+		// One metadata entry per family, from its first sample
+		if family, kind := Family(m); !families[family] {
+			families[family] = true
+			unit := m.Unit
+			if m.IsRollup() {
+				unit = ""
+			}
+			metadata = append(metadata, RWMetadata{Family: family, Kind: kind, Unit: unit})
+		}
+
+		// Track this metric's storage ID
+		if storageID > 0 {
+			includedIDs = append(includedIDs, storageID)
+		}
+	}
+
+	if len(series) == 0 {
+		return []byte{}, nil, nil
+	}
+
+	var buf []byte
+	for _, ts := range series {
+		// Samples within a series must be in timestamp order
+		sort.SliceStable(ts.Samples, func(i, j int) bool {
+			return ts.Samples[i].Timestamp < ts.Samples[j].Timestamp
+		})
+		buf = appendBytesField(buf, 1, encodeTimeSeries(ts))
+	}
+	for _, md := range metadata {
+		buf = appendBytesField(buf, 3, encodeMetadata(md))
+	}
+
+	return buf, includedIDs, nil
+}
+
+// sortedLabels turns a label map into labels sorted by name, as the spec requires
+func sortedLabels(labels map[string]string) []RWLabel {
+	sorted := make([]RWLabel, 0, len(labels))
+	for name, value := range labels {
+		sorted = append(sorted, RWLabel{Name: name, Value: value})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// encodeTimeSeries encodes a TimeSeries message
+func encodeTimeSeries(ts *RWTimeSeries) []byte {
+	var buf []byte
+	for _, l := range ts.Labels {
+		var label []byte
+		label = appendBytesField(label, 1, []byte(l.Name))
+		label = appendBytesField(label, 2, []byte(l.Value))
+		buf = appendBytesField(buf, 1, label)
+	}
+	for _, s := range ts.Samples {
+		var sample []byte
+		sample = binary.AppendUvarint(sample, 1<<3|wireFixed64)
+		sample = binary.LittleEndian.AppendUint64(sample, math.Float64bits(s.Value))
+		sample = binary.AppendUvarint(sample, 2<<3|wireVarint)
+		sample = binary.AppendUvarint(sample, uint64(s.Timestamp))
+		buf = appendBytesField(buf, 2, sample)
+	}
+	return buf
+}
+
+// encodeMetadata encodes a MetricMetadata message
+func encodeMetadata(md RWMetadata) []byte {
+	var buf []byte
+	buf = binary.AppendUvarint(buf, 1<<3|wireVarint)
+	buf = binary.AppendUvarint(buf, rwMetricTypes[md.Kind])
+	buf = appendBytesField(buf, 2, []byte(md.Family))
+	if md.Unit != "" {
+		buf = appendBytesField(buf, 5, []byte(md.Unit))
+	}
+	return buf
+}
+
+// appendBytesField appends a length-delimited field
+func appendBytesField(buf []byte, field int, data []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field)<<3|wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+// CompressSnappy compresses data using snappy block format, as required by remote_write
+// Note: remote_write uses the block format, not the snappy framed/stream format
+func CompressSnappy(data []byte) []byte {
+	return snappy.Encode(nil, data)
+}
+
+// DecodeRemoteWrite decodes a snappy-compressed remote_write WriteRequest
+// Used by tests and the local metrics-receiver stand-in
+func DecodeRemoteWrite(compressed []byte) ([]RWTimeSeries, error) {
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("snappy decode failed: %w", err)
+	}
+
+	var series []RWTimeSeries
+	err = walkFields(data, func(field int, wireType int, value []byte, _ uint64) error {
+		if field != 1 || wireType != wireBytes {
+			return nil // Ignore metadata and unknown fields
+		}
+		ts, err := decodeTimeSeries(value)
+		if err != nil {
+			return err
+		}
+		series = append(series, ts)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid WriteRequest: %w", err)
+	}
+
+	return series, nil
+}
+
+// decodeTimeSeries decodes a TimeSeries message
+func decodeTimeSeries(data []byte) (RWTimeSeries, error) {
+	var ts RWTimeSeries
+	err := walkFields(data, func(field int, wireType int, value []byte, _ uint64) error {
+		if wireType != wireBytes {
+			return nil
+		}
+		switch field {
+		case 1:
+			var l RWLabel
+			err := walkFields(value, func(field int, wireType int, value []byte, _ uint64) error {
+				if wireType != wireBytes {
+					return nil
+				}
+				switch field {
+				case 1:
+					l.Name = string(value)
+				case 2:
+					l.Value = string(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.Labels = append(ts.Labels, l)
+		case 2:
+			var s RWSample
+			err := walkFields(value, func(field int, wireType int, value []byte, num uint64) error {
+				switch {
+				case field == 1 && wireType == wireFixed64:
+					s.Value = math.Float64frombits(num)
+				case field == 2 && wireType == wireVarint:
+					s.Timestamp = int64(num)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, s)
+		}
+		return nil
+	})
+	return ts, err
+}
+
+// walkFields iterates over the fields of a protobuf message
+// For length-delimited fields value holds the payload; for numeric fields num holds the raw bits
+func walkFields(data []byte, fn func(field int, wireType int, value []byte, num uint64) error) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("malformed field tag")
+		}
+		data = data[n:]
+		field, wireType := int(tag>>3), int(tag&7)
+
+		switch wireType {
+		case wireVarint:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return errors.New("malformed varint")
+			}
+			data = data[n:]
+			if err := fn(field, wireType, nil, v); err != nil {
+				return err
+			}
+		case wireFixed64:
+			if len(data) < 8 {
+				return errors.New("truncated fixed64")
+			}
+			v := binary.LittleEndian.Uint64(data)
+			data = data[8:]
+			if err := fn(field, wireType, nil, v); err != nil {
+				return err
+			}
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return errors.New("truncated length-delimited field")
+			}
+			value := data[n : n+int(length)]
+			data = data[n+int(length):]
+			if err := fn(field, wireType, value, 0); err != nil {
+				return err
+			}
+		case wireFixed32:
+			if len(data) < 4 {
+				return errors.New("truncated fixed32")
+			}
+			v := binary.LittleEndian.Uint32(data)
+			data = data[4:]
+			if err := fn(field, wireType, nil, uint64(v)); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported wire type %d", wireType)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,507 @@
+package uploader
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taniwha3/tidewatch/internal/models"
+)
+
+// labelMap converts remote_write labels to a map for assertions
+func labelMap(labels []RWLabel) map[string]string {
+	m := make(map[string]string, len(labels))
+	for _, l := range labels {
+		m[l.Name] = l.Value
+	}
+	return m
+}
+
+func TestBuildRemoteWrite_RoundTrip(t *testing.T) {
+	ts := time.UnixMilli(1700000000123)
+	metrics := []*models.Metric{
+		models.NewMetric("cpu.temperature", 45.5, "device-001").
+			WithTimestamp(ts).
+			WithTag("zone", "cpu0").
+			WithTag("_storage_id", "42"),
+	}
+
+	data, ids, err := BuildRemoteWrite(metrics)
+	if err != nil {
+		t.Fatalf("BuildRemoteWrite failed: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != 42 {
+		t.Errorf("Expected included IDs [42], got %v", ids)
+	}
+
+	series, err := DecodeRemoteWrite(CompressSnappy(data))
+	if err != nil {
+		t.Fatalf("DecodeRemoteWrite failed: %v", err)
+	}
+	if len(series) != 1 {
+		t.Fatalf("Expected 1 series, got %d", len(series))
+	}
+
+	labels := labelMap(series[0].Labels)
+	if labels["__name__"] != "cpu_temperature_celsius" {
+		t.Errorf("Expected __name__ cpu_temperature_celsius, got %q", labels["__name__"])
+	}
+	if labels["device_id"] != "device-001" {
+		t.Errorf("Expected device_id device-001, got %q", labels["device_id"])
+	}
+	if labels["zone"] != "cpu0" {
+		t.Errorf("Expected zone cpu0, got %q", labels["zone"])
+	}
+	if _, ok := labels["_storage_id"]; ok {
+		t.Error("Internal _storage_id tag should not be sent")
+	}
+
+	if len(series[0].Samples) != 1 {
+		t.Fatalf("Expected 1 sample, got %d", len(series[0].Samples))
+	}
+	if s := series[0].Samples[0]; s.Value != 45.5 || s.Timestamp != ts.UnixMilli() {
+		t.Errorf("Expected sample 45.5 @ %d, got %v @ %d", ts.UnixMilli(), s.Value, s.Timestamp)
+	}
+}
+
+func TestBuildRemoteWrite_LabelsSorted(t *testing.T) {
+	metrics := []*models.Metric{
+		models.NewMetric("network.rx_bytes", 1, "device-001").
+			WithTag("interface", "eth0").
+			WithTag("alpha", "a").
+			WithTag("zeta", "z"),
+	}
+
+	data, _, err := BuildRemoteWrite(metrics)
+	if err != nil {
+		t.Fatalf("BuildRemoteWrite failed: %v", err)
+	}
+	series, err := DecodeRemoteWrite(CompressSnappy(data))
+	if err != nil {
+		t.Fatalf("DecodeRemoteWrite failed: %v", err)
+	}
+
+	labels := series[0].Labels
+	if !sort.SliceIsSorted(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name }) {
+		t.Errorf("Expected labels sorted by name, got %v", labels)
+	}
+}
+
+func TestBuildRemoteWrite_GroupsSamplesBySeries(t *testing.T) {
+	base := time.UnixMilli(1700000000000)
+	metrics := []*models.Metric{
+		models.NewMetric("cpu.usage", 3, "device-001").WithTimestamp(base.Add(2*time.Second)).WithTag("core", "0"),
+		models.NewMetric("cpu.usage", 1, "device-001").WithTimestamp(base).WithTag("core", "0"),
+		models.NewMetric("cpu.usage", 9, "device-001").WithTimestamp(base).WithTag("core", "1"),
+		models.NewMetric("cpu.usage", 2, "device-001").WithTimestamp(base.Add(time.Second)).WithTag("core", "0"),
+	}
+
+	data, _, err := BuildRemoteWrite(metrics)
+	if err != nil {
+		t.Fatalf("BuildRemoteWrite failed: %v", err)
+	}
+	series, err := DecodeRemoteWrite(CompressSnappy(data))
+	if err != nil {
+		t.Fatalf("DecodeRemoteWrite failed: %v", err)
+	}
+	if len(series) != 2 {
+		t.Fatalf("Expected 2 series, got %d", len(series))
+	}
+
+	for _, ts := range series {
+		if labelMap(ts.Labels)["core"] != "0" {
+			continue
+		}
+		if len(ts.Samples) != 3 {
+			t.Fatalf("Expected 3 samples for core 0, got %d", len(ts.Samples))
+		}
+		for i, want := range []float64{1, 2, 3} {
+			if ts.Samples[i].Value != want {
+				t.Errorf("Sample %d: expected %v, got %v (samples must be in timestamp order)", i, want, ts.Samples[i].Value)
+			}
+		}
+	}
+}
+
+func TestBuildRemoteWrite_FiltersStringMetrics(t *testing.T) {
+	metrics := []*models.Metric{
+		models.NewStringMetric("system.hostname", "belabox", "device-001").WithTag("_storage_id", "1"),
+		models.NewMetric("cpu.usage", 50, "device-001").WithTag("_storage_id", "2"),
+	}
+
+	data, ids, err := BuildRemoteWrite(metrics)
+	if err != nil {
+		t.Fatalf("BuildRemoteWrite failed: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != 2 {
+		t.Errorf("Expected included IDs [2], got %v", ids)
+	}
+
+	series, err := DecodeRemoteWrite(CompressSnappy(data))
+	if err != nil {
+		t.Fatalf("DecodeRemoteWrite failed: %v", err)
+	}
+	if len(series) != 1 {
+		t.Fatalf("Expected 1 series, got %d", len(series))
+	}
+}
+
+func TestBuildRemoteWrite_AllStringMetrics(t *testing.T) {
+	metrics := []*models.Metric{
+		models.NewStringMetric("system.hostname", "belabox", "device-001"),
+	}
+
+	data, ids, err := BuildRemoteWrite(metrics)
+	if err != nil {
+		t.Fatalf("BuildRemoteWrite failed: %v", err)
+	}
+	if len(data) != 0 || len(ids) != 0 {
+		t.Errorf("Expected empty output, got %d bytes and %d IDs", len(data), len(ids))
+	}
+}
+
+func TestSanitizeLabelName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"interface", "interface"},
+		{"mount.point", "mount_point"},
+		{"disk-name", "disk_name"},
+		{"0core", "_0core"},
+		{"core0", "core0"},
+		{"__meta", "__meta"},
+	}
+
+	for _, tt := range tests {
+		if got := sanitizeLabelName(tt.input); got != tt.expected {
+			t.Errorf("sanitizeLabelName(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestDecodeRemoteWrite_InvalidInput(t *testing.T) {
+	if _, err := DecodeRemoteWrite([]byte("not snappy")); err == nil {
+		t.Error("Expected error for invalid snappy data")
+	}
+
+	// Valid snappy, truncated protobuf (field 1, length 100, no payload)
+	if _, err := DecodeRemoteWrite(CompressSnappy([]byte{0x0a, 100})); err == nil {
+		t.Error("Expected error for truncated protobuf")
+	}
+}
+
+func TestBuildChunksForProtocol_RemoteWrite(t *testing.T) {
+	metrics := make([]*models.Metric, 25)
+	for i := range metrics {
+		metrics[i] = models.NewMetric("cpu.usage", float64(i), "device-001").
+			WithTimestamp(time.UnixMilli(int64(1700000000000 + i)))
+	}
+
+	chunks, err := BuildChunksForProtocol(metrics, 10, ProtocolPrometheusRemoteWrite)
+	if err != nil {
+		t.Fatalf("BuildChunksForProtocol failed: %v", err)
+	}
+	if len(chunks) != 3 {
+		t.Fatalf("Expected 3 chunks, got %d", len(chunks))
+	}
+
+	total := 0
+	for _, chunk := range chunks {
+		if chunk.Protocol != ProtocolPrometheusRemoteWrite {
+			t.Errorf("Expected chunk protocol %s, got %s", ProtocolPrometheusRemoteWrite, chunk.Protocol)
+		}
+		if len(chunk.JSONLData) != 0 {
+			t.Error("remote_write chunks should not carry JSONL data")
+		}
+		series, err := DecodeRemoteWrite(chunk.CompressedData)
+		if err != nil {
+			t.Fatalf("DecodeRemoteWrite failed: %v", err)
+		}
+		for _, ts := range series {
+			total += len(ts.Samples)
+		}
+	}
+	if total != 25 {
+		t.Errorf("Expected 25 samples across chunks, got %d", total)
+	}
+}
+
+func TestBuildChunksForProtocol_Unsupported(t *testing.T) {
+	metrics := []*models.Metric{models.NewMetric("cpu.usage", 1, "device-001")}
+	if _, err := BuildChunksForProtocol(metrics, 10, "graphite"); err == nil {
+		t.Error("Expected error for unsupported protocol")
+	}
+}
+
+// TestUploadRemoteWrite_Success verifies headers and payload of a remote_write upload
+func TestUploadRemoteWrite_Success(t *testing.T) {
+	now := time.Now()
+	metrics := []*models.Metric{
+		models.NewMetric("cpu.temperature", 45.5, "device-001").WithTimestamp(now).WithTag("_storage_id", "1"),
+		models.NewMetric("memory.bytes.used", 1024.0, "device-001").WithTimestamp(now.Add(time.Second)).WithTag("_storage_id", "2"),
+		models.NewStringMetric("system.hostname", "belabox", "device-001").WithTag("_storage_id", "3"),
+	}
+
+	var received []RWTimeSeries
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-protobuf" {
+			t.Errorf("Expected Content-Type application/x-protobuf, got %s", ct)
+		}
+		if ce := r.Header.Get("Content-Encoding"); ce != "snappy" {
+			t.Errorf("Expected Content-Encoding snappy, got %s", ce)
+		}
+		if v := r.Header.Get("X-Prometheus-Remote-Write-Version"); v != "0.1.0" {
+			t.Errorf("Expected X-Prometheus-Remote-Write-Version 0.1.0, got %s", v)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+			t.Errorf("Expected bearer auth, got %q", auth)
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Failed to read body: %v", err)
+		}
+		series, err := DecodeRemoteWrite(body)
+		if err != nil {
+			t.Errorf("Failed to decode remote_write body: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = append(received, series...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	uploader := NewHTTPUploaderWithConfig(HTTPUploaderConfig{
+		URL:       server.URL,
+		Protocol:  ProtocolPrometheusRemoteWrite,
+		DeviceID:  "device-001",
+		AuthToken: "secret",
+	})
+
+	ids, err := uploader.UploadAndGetIDs(context.Background(), metrics)
+	if err != nil {
+		t.Fatalf("UploadAndGetIDs failed: %v", err)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("Expected IDs [1 2], got %v", ids)
+	}
+	if len(received) != 2 {
+		t.Errorf("Expected 2 series received, got %d", len(received))
+	}
+}
+
+// TestUploadRemoteWrite_RateLimitRetry verifies 429 handling is shared with the JSONL uploader
+func TestUploadRemoteWrite_RateLimitRetry(t *testing.T) {
+	metrics := []*models.Metric{models.NewMetric("cpu.usage", 1, "device-001")}
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	uploader := NewHTTPUploaderWithConfig(HTTPUploaderConfig{
+		URL:        server.URL,
+		Protocol:   ProtocolPrometheusRemoteWrite,
+		DeviceID:   "device-001",
+		MaxRetries: intPtr(2),
+		RetryDelay: 10 * time.Millisecond,
+	})
+
+	if err := uploader.Upload(context.Background(), metrics); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", attempts)
+	}
+}
+
+// TestUploadRemoteWrite_NoRetryOn400 verifies rejected samples are not retried
+func TestUploadRemoteWrite_NoRetryOn400(t *testing.T) {
+	metrics := []*models.Metric{models.NewMetric("cpu.usage", 1, "device-001")}
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	uploader := NewHTTPUploaderWithConfig(HTTPUploaderConfig{
+		URL:        server.URL,
+		Protocol:   ProtocolPrometheusRemoteWrite,
+		DeviceID:   "device-001",
+		MaxRetries: intPtr(3),
+		RetryDelay: 10 * time.Millisecond,
+	})
+
+	err := uploader.Upload(context.Background(), metrics)
+	if err == nil {
+		t.Fatal("Expected error for 400 response")
+	}
+	if !strings.Contains(err.Error(), "out of order sample") {
+		t.Errorf("Expected server message in error, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", attempts)
+	}
+	if !IsRejected(err) {
+		t.Errorf("Expected the chunk reported as rejected, got %v", err)
+	}
+}
+
+func TestRejectsChunk(t *testing.T) {
+	tests := []struct {
+		protocol string
+		status   int
+		want     bool
+	}{
+		{ProtocolPrometheusRemoteWrite, http.StatusBadRequest, true},
+		{ProtocolPrometheusRemoteWrite, http.StatusConflict, true},
+		{ProtocolPrometheusRemoteWrite, http.StatusUnauthorized, false},
+		{ProtocolPrometheusRemoteWrite, http.StatusForbidden, false},
+		{ProtocolPrometheusRemoteWrite, http.StatusTooManyRequests, false},
+		{ProtocolPrometheusRemoteWrite, http.StatusInternalServerError, false},
+		{ProtocolVictoriaMetrics, http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		if got := rejectsChunk(tt.protocol, tt.status); got != tt.want {
+			t.Errorf("rejectsChunk(%s, %d) = %v, expected %v", tt.protocol, tt.status, got, tt.want)
+		}
+	}
+}
+
+// TestNewHTTPUploader_RemoteWriteSequential verifies remote_write chunks are never sent in parallel
+func TestNewHTTPUploader_RemoteWriteSequential(t *testing.T) {
+	uploader := NewHTTPUploaderWithConfig(HTTPUploaderConfig{
+		URL:         "http://localhost:9090/api/v1/write",
+		Protocol:    ProtocolPrometheusRemoteWrite,
+		DeviceID:    "device-001",
+		Concurrency: 4,
+	})
+	if uploader.concurrency != 1 {
+		t.Errorf("Expected concurrency 1 for remote_write, got %d", uploader.concurrency)
+	}
+}
+
+func TestNewHTTPUploader_DefaultProtocol(t *testing.T) {
+	uploader := NewHTTPUploader("http://localhost:8428/api/v1/import", "device-001")
+	if uploader.GetProtocol() != ProtocolVictoriaMetrics {
+		t.Errorf("Expected default protocol %s, got %s", ProtocolVictoriaMetrics, uploader.GetProtocol())
+	}
+}
+
+func TestBuildRemoteWrite_Rollups(t *testing.T) {
+	metrics := []*models.Metric{
+		models.NewMetric("memory.usage", 80, "device-001").
+			WithTimestamp(time.UnixMilli(1700000000000)).
+			WithTag(models.TagRollupResolution, "1h").
+			WithTag(models.TagRollupAgg, "max"),
+	}
+
+	data, _, err := BuildRemoteWrite(metrics)
+	if err != nil {
+		t.Fatalf("BuildRemoteWrite failed: %v", err)
+	}
+	series, err := DecodeRemoteWrite(CompressSnappy(data))
+	if err != nil {
+		t.Fatalf("DecodeRemoteWrite failed: %v", err)
+	}
+	if len(series) != 1 {
+		t.Fatalf("Expected 1 series, got %d", len(series))
+	}
+
+	labels := labelMap(series[0].Labels)
+	if labels["__name__"] != "memory_usage:max_1h" {
+		t.Errorf("Expected __name__ memory_usage:max_1h, got %q", labels["__name__"])
+	}
+	if len(labels) != 2 {
+		t.Errorf("Expected only __name__ and device_id, got %v", labels)
+	}
+}
+
+// decodeMetadata extracts the MetricMetadata entries of an uncompressed WriteRequest
+func decodeMetadata(t *testing.T, data []byte) []RWMetadata {
+	t.Helper()
+
+	types := make(map[uint64]models.Kind)
+	for kind, v := range rwMetricTypes {
+		types[v] = kind
+	}
+
+	var metadata []RWMetadata
+	err := walkFields(data, func(field int, wireType int, value []byte, _ uint64) error {
+		if field != 3 || wireType != wireBytes {
+			return nil
+		}
+		var md RWMetadata
+		err := walkFields(value, func(field int, wireType int, value []byte, num uint64) error {
+			switch field {
+			case 1:
+				md.Kind = types[num]
+			case 2:
+				md.Family = string(value)
+			case 5:
+				md.Unit = string(value)
+			}
+			return nil
+		})
+		metadata = append(metadata, md)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to decode metadata: %v", err)
+	}
+	return metadata
+}
+
+func TestBuildRemoteWrite_Metadata(t *testing.T) {
+	ts := time.UnixMilli(1700000000000)
+	metrics := []*models.Metric{
+		models.NewMetric("network.rx_bytes_total", 1, "device-001").AsCounter("bytes").WithTimestamp(ts).WithTag("interface", "eth0"),
+		models.NewMetric("network.rx_bytes_total", 2, "device-001").AsCounter("bytes").WithTimestamp(ts).WithTag("interface", "wwan0"),
+		models.NewMetric("http.requests_in_flight", 3, "device-001").AsGauge("").WithTimestamp(ts),
+	}
+
+	data, _, err := BuildRemoteWrite(metrics)
+	if err != nil {
+		t.Fatalf("BuildRemoteWrite failed: %v", err)
+	}
+
+	// Metadata must not disturb the series
+	series, err := DecodeRemoteWrite(CompressSnappy(data))
+	if err != nil {
+		t.Fatalf("DecodeRemoteWrite failed: %v", err)
+	}
+	if len(series) != 3 {
+		t.Fatalf("Expected 3 series, got %d", len(series))
+	}
+
+	want := []RWMetadata{
+		{Family: "network_rx_bytes", Kind: models.KindCounter, Unit: "bytes"},
+		{Family: "http_requests_in_flight", Kind: models.KindGauge},
+	}
+	got := decodeMetadata(t, data)
+	if len(got) != len(want) {
+		t.Fatalf("Expected one metadata entry per family, got %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Metadata %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -9,8 +9,10 @@ import (
 	"math"
 	"math/rand"
 	"net/http"
+	"net/http/httptrace"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/taniwha3/tidewatch/internal/models"
@@ -28,10 +30,22 @@ type Uploader interface {
 	Close() error
 }
 
-// HTTPUploader implements Uploader using HTTP POST to VictoriaMetrics
+// Meter paces and accounts the bytes an uploader sends (e.g., on a metered link)
+// Methods are called from the upload workers and must be safe for concurrent use.
+type Meter interface {
+	// Wait blocks until n bytes may be sent
+	Wait(ctx context.Context, n int) error
+
+	// Sent records n bytes that were sent
+	Sent(n int)
+}
+
+// HTTPUploader implements Uploader using HTTP POST to VictoriaMetrics or a Prometheus remote_write endpoint
 type HTTPUploader struct {
 	url               string
+	protocol          string
 	deviceID          string
+	labels            map[string]string
 	authToken         string
 	client            *http.Client
 	maxRetries        int
@@ -40,6 +54,9 @@ type HTTPUploader struct {
 	backoffMultiplier float64
 	jitterPercent     int
 	chunkSize         int
+	concurrency       int
+	probeURL          string
+	meter             Meter
 	rng               *rand.Rand // Per-uploader RNG for jitter to prevent thundering herd
 	rngMu             sync.Mutex // Protects rng for concurrent access
 }
@@ -47,15 +64,20 @@ type HTTPUploader struct {
 // HTTPUploaderConfig configures the HTTP uploader
 type HTTPUploaderConfig struct {
 	URL               string
+	Protocol          string // victoriametrics (default) or prometheus_remote_write
 	DeviceID          string
-	AuthToken         string        // Optional bearer token
-	Timeout           time.Duration // Default: 30s
-	MaxRetries        *int          // Default: 3. Use nil for default, &0 for explicitly 0 (no retries)
-	RetryDelay        time.Duration // Base delay for exponential backoff, default: 1s
-	MaxBackoff        time.Duration // Maximum backoff delay, default: 30s
-	BackoffMultiplier float64       // Backoff multiplier for exponential backoff, default: 2.0
-	JitterPercent     *int          // Jitter percentage (0-100), default: 20. Use nil for default, &0 for explicitly 0
-	ChunkSize         int           // Metrics per chunk, default: 50
+	Labels            map[string]string // Static labels added to every series; a metric's own tags take precedence
+	AuthToken         string            // Optional bearer token
+	Timeout           time.Duration     // Default: 30s
+	MaxRetries        *int              // Default: 3. Use nil for default, &0 for explicitly 0 (no retries)
+	RetryDelay        time.Duration     // Base delay for exponential backoff, default: 1s
+	MaxBackoff        time.Duration     // Maximum backoff delay, default: 30s
+	BackoffMultiplier float64           // Backoff multiplier for exponential backoff, default: 2.0
+	JitterPercent     *int              // Jitter percentage (0-100), default: 20. Use nil for default, &0 for explicitly 0
+	ChunkSize         int               // Metrics per chunk, default: 50
+	Concurrency       int               // Chunks uploaded in parallel, default: 1 (always 1 for remote_write)
+	ProbeURL          string            // Cheap endpoint checked by Probe (e.g., VictoriaMetrics /health), optional
+	Meter             Meter             // Paces and accounts every request sent, optional
 }
 
 // NewHTTPUploader creates a new HTTP uploader with default settings
@@ -114,9 +136,27 @@ func NewHTTPUploaderWithConfig(cfg HTTPUploaderConfig) *HTTPUploader {
 		chunkSize = 50
 	}
 
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	protocol := cfg.Protocol
+	if protocol == "" {
+		protocol = ProtocolVictoriaMetrics
+	}
+
+	// Parallel chunks can carry samples of one series out of order, which a remote_write
+	// receiver rejects for good, so remote_write chunks are always sent one at a time
+	if protocol == ProtocolPrometheusRemoteWrite {
+		concurrency = 1
+	}
+
 	return &HTTPUploader{
 		url:               cfg.URL,
+		protocol:          protocol,
 		deviceID:          cfg.DeviceID,
+		labels:            cfg.Labels,
 		authToken:         cfg.AuthToken,
 		maxRetries:        maxRetries,
 		retryDelay:        retryDelay,
@@ -124,51 +164,156 @@ func NewHTTPUploaderWithConfig(cfg HTTPUploaderConfig) *HTTPUploader {
 		backoffMultiplier: backoffMultiplier,
 		jitterPercent:     jitterPercent,
 		chunkSize:         chunkSize,
+		concurrency:       concurrency,
+		probeURL:          cfg.ProbeURL,
+		meter:             cfg.Meter,
 		rng:               rand.New(rand.NewSource(time.Now().UnixNano())),
 		client: &http.Client{
 			Timeout: timeout,
 			Transport: &http.Transport{
 				MaxIdleConns:        10,
-				MaxIdleConnsPerHost: 2,
+				MaxIdleConnsPerHost: max(2, concurrency),
 				IdleConnTimeout:     90 * time.Second,
 			},
 		},
 	}
 }
 
-// Upload sends metrics to VictoriaMetrics with chunking, compression, and retry
+// Upload sends metrics to the remote endpoint with chunking, compression, and retry
 func (u *HTTPUploader) Upload(ctx context.Context, metrics []*models.Metric) error {
 	_, err := u.UploadAndGetIDs(ctx, metrics)
 	return err
 }
 
-// UploadAndGetIDs sends metrics to VictoriaMetrics and returns the storage IDs of metrics actually uploaded
+// UploadAndGetIDs sends metrics to the remote endpoint and returns the storage IDs of metrics actually uploaded
 // String metrics are filtered out and their IDs are NOT included in the returned slice
+// Chunks are uploaded by up to Concurrency workers, each with its own retry and backoff. When a chunk
+// fails, no new chunks are started and the error is returned together with the IDs of every chunk
+// that did upload, so the caller can mark those and retry only the rest.
 func (u *HTTPUploader) UploadAndGetIDs(ctx context.Context, metrics []*models.Metric) ([]int64, error) {
+	return u.UploadChunks(ctx, metrics, nil)
+}
+
+// ChunkFunc is called when a chunk finishes, with its index, the storage IDs it carried and
+// the upload error (nil = uploaded). Chunks that were never attempted are not reported.
+// Calls come from the upload workers and may run concurrently.
+type ChunkFunc func(index int, ids []int64, err error)
+
+// UploadChunks is UploadAndGetIDs with a callback for every chunk as soon as it finishes
+// Callers use it to checkpoint each chunk instead of waiting for the whole batch.
+func (u *HTTPUploader) UploadChunks(ctx context.Context, metrics []*models.Metric, onChunk ChunkFunc) ([]int64, error) {
 	if len(metrics) == 0 {
 		return nil, nil
 	}
 
-	// Build chunks (includes JSONL formatting and gzip compression)
-	chunks, err := BuildChunks(metrics, u.chunkSize)
+	// Build chunks (includes protocol encoding and compression)
+	chunks, err := BuildChunksForProtocol(withLabels(metrics, u.labels), u.chunkSize, u.protocol)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build chunks: %w", err)
 	}
 
-	// Collect all included IDs from chunks
-	var allIncludedIDs []int64
-	for _, chunk := range chunks {
-		allIncludedIDs = append(allIncludedIDs, chunk.IncludedIDs...)
-	}
+	errs := u.uploadChunks(ctx, chunks, onChunk)
 
-	// Upload each chunk with retry
+	// Collect IDs from the chunks that uploaded, in chunk order
+	var uploadedIDs []int64
+	var firstErr error
+	failed := 0
 	for i, chunk := range chunks {
-		if err := u.uploadChunkWithRetry(ctx, chunk, i); err != nil {
-			return nil, fmt.Errorf("failed to upload chunk %d/%d: %w", i+1, len(chunks), err)
+		if errs[i] == nil {
+			uploadedIDs = append(uploadedIDs, chunk.IncludedIDs...)
+			continue
+		}
+		failed++
+		if firstErr == nil {
+			firstErr = fmt.Errorf("failed to upload chunk %d/%d: %w", i+1, len(chunks), errs[i])
 		}
 	}
+	if firstErr != nil && failed > 1 {
+		firstErr = fmt.Errorf("%d of %d chunks not uploaded, first: %w", failed, len(chunks), firstErr)
+	}
 
-	return allIncludedIDs, nil
+	return uploadedIDs, firstErr
+}
+
+// errChunkSkipped marks chunks that were not attempted because an earlier chunk failed
+var errChunkSkipped = errors.New("skipped after an earlier chunk failed")
+
+// uploadChunks uploads chunks with up to u.concurrency workers and returns one error per chunk (nil = uploaded)
+// Once a chunk fails, workers stop taking new chunks so a dead endpoint is not hit with the whole batch.
+// Chunks the receiver rejected (see IsRejected) do not stop the others.
+func (u *HTTPUploader) uploadChunks(ctx context.Context, chunks []*Chunk, onChunk ChunkFunc) []error {
+	errs := make([]error, len(chunks))
+	for i := range errs {
+		errs[i] = errChunkSkipped
+	}
+
+	workers := min(u.concurrency, len(chunks))
+	next := make(chan int)
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				// Each worker writes only the slots of the chunks it took
+				errs[i] = u.uploadChunkWithRetry(ctx, chunks[i], i)
+				if onChunk != nil {
+					onChunk(i, chunks[i].IncludedIDs, errs[i])
+				}
+				// A chunk the receiver rejected says nothing about the endpoint, so the rest still go
+				if errs[i] != nil && !IsRejected(errs[i]) {
+					stopOnce.Do(func() { close(stop) })
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for i := range chunks {
+		select {
+		case next <- i:
+		case <-stop:
+			break dispatch
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	// Chunks never handed to a worker report why
+	if err := ctx.Err(); err != nil {
+		for i := range errs {
+			if errs[i] == errChunkSkipped {
+				errs[i] = err
+			}
+		}
+	}
+	return errs
+}
+
+// withLabels returns copies of metrics with the static labels merged into their tags
+// Tags already on a metric win, so a collector's labels are never overwritten. Stored rows are not changed.
+func withLabels(metrics []*models.Metric, labels map[string]string) []*models.Metric {
+	if len(labels) == 0 {
+		return metrics
+	}
+	labeled := make([]*models.Metric, len(metrics))
+	for i, m := range metrics {
+		c := *m
+		c.Tags = make(map[string]string, len(m.Tags)+len(labels))
+		for k, v := range labels {
+			c.Tags[k] = v
+		}
+		for k, v := range m.Tags {
+			c.Tags[k] = v
+		}
+		labeled[i] = &c
+	}
+	return labeled
 }
 
 // uploadChunkWithRetry uploads a single chunk with exponential backoff retry
@@ -208,7 +353,7 @@ func (u *HTTPUploader) uploadChunkWithRetry(ctx context.Context, chunk *Chunk, c
 	return fmt.Errorf("max retries (%d) exceeded: %w", u.maxRetries, lastErr)
 }
 
-// uploadChunk uploads a single chunk to VictoriaMetrics
+// uploadChunk uploads a single chunk to the remote endpoint
 func (u *HTTPUploader) uploadChunk(ctx context.Context, chunk *Chunk, chunkIndex, attempt int) error {
 	// Create request with compressed data
 	req, err := http.NewRequestWithContext(ctx, "POST", u.url, bytes.NewReader(chunk.CompressedData))
@@ -217,8 +362,14 @@ func (u *HTTPUploader) uploadChunk(ctx context.Context, chunk *Chunk, chunkIndex
 	}
 
 	// Set required headers per engineering review
-	req.Header.Set("Content-Type", "application/x-ndjson") // JSONL / newline-delimited JSON
-	req.Header.Set("Content-Encoding", "gzip")
+	if chunk.Protocol == ProtocolPrometheusRemoteWrite {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		req.Header.Set("Content-Encoding", "snappy")
+		req.Header.Set("X-Prometheus-Remote-Write-Version", RemoteWriteVersion)
+	} else {
+		req.Header.Set("Content-Type", "application/x-ndjson") // JSONL / newline-delimited JSON
+		req.Header.Set("Content-Encoding", "gzip")
+	}
 	req.Header.Set("User-Agent", "tidewatch/1.0")
 	req.Header.Set("X-Device-ID", u.deviceID)
 
@@ -233,7 +384,7 @@ func (u *HTTPUploader) uploadChunk(ctx context.Context, chunk *Chunk, chunkIndex
 	req.Header.Set("X-Attempt", strconv.Itoa(attempt))
 
 	// Send request
-	resp, err := u.client.Do(req)
+	resp, err := u.do(req, len(chunk.CompressedData))
 	if err != nil {
 		return &RetryableError{Err: err}
 	}
@@ -251,6 +402,13 @@ func (u *HTTPUploader) uploadChunk(ctx context.Context, chunk *Chunk, chunkIndex
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 		return nil // Success - entire chunk uploaded
 	}
+	if rejectsChunk(chunk.Protocol, resp.StatusCode) {
+		return &NonRetryableError{
+			StatusCode: resp.StatusCode,
+			Message:    fmt.Sprintf("rejected by receiver: %s", string(respBody)),
+			Rejected:   true,
+		}
+	}
 
 	// Handle specific status codes
 	switch resp.StatusCode {
@@ -282,6 +440,110 @@ func (u *HTTPUploader) uploadChunk(ctx context.Context, chunk *Chunk, chunkIndex
 	}
 }
 
+// rejectsChunk reports whether a receiver's status means it will never accept the chunk
+// remote_write receivers answer samples they refuse for good (out of order, duplicate, too old) with
+// a 4xx: 400 from Prometheus and Mimir, 409 from Thanos receive. Like Prometheus's own remote_write
+// client, such chunks are dropped instead of retried. Auth errors and 429 are not rejections.
+func rejectsChunk(protocol string, status int) bool {
+	return protocol == ProtocolPrometheusRemoteWrite && status >= 400 && status < 500 &&
+		status != http.StatusUnauthorized && status != http.StatusForbidden && status != http.StatusTooManyRequests
+}
+
+// Probe checks that the remote is reachable without building or sending any metrics
+// It GETs ProbeURL once, with the upload auth token and no retries; any status below 500 counts
+// as reachable. Without a ProbeURL it returns nil and the caller's next upload is the probe.
+func (u *HTTPUploader) Probe(ctx context.Context) error {
+	if u.probeURL == "" {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.probeURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create probe request: %w", err)
+	}
+	req.Header.Set("User-Agent", "tidewatch/1.0")
+	req.Header.Set("X-Device-ID", u.deviceID)
+	if u.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+u.authToken)
+	}
+
+	resp, err := u.do(req, 0)
+	if err != nil {
+		return fmt.Errorf("probe failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("probe failed: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// do sends a request with a body of bodySize bytes, paced and accounted by the meter
+// A request that got a response is accounted in full. One that failed after connecting (timeout,
+// connection reset) is accounted for the headers and body bytes written before it failed; only a
+// request that never connected sent nothing billable.
+func (u *HTTPUploader) do(req *http.Request, bodySize int) (*http.Response, error) {
+	if u.meter == nil {
+		return u.client.Do(req)
+	}
+	size := requestSize(req, bodySize)
+	if err := u.meter.Wait(req.Context(), size); err != nil {
+		return nil, err
+	}
+
+	var wroteHeaders atomic.Bool
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		WroteHeaders: func() { wroteHeaders.Store(true) },
+	}))
+	var body *countingBody
+	if req.Body != nil && req.Body != http.NoBody {
+		body = &countingBody{ReadCloser: req.Body}
+		req.Body = body
+	}
+
+	resp, err := u.client.Do(req)
+	if err == nil {
+		u.meter.Sent(size)
+		return resp, nil
+	}
+	written := 0
+	if wroteHeaders.Load() {
+		written = size - bodySize
+	}
+	if body != nil {
+		written += int(body.n.Load())
+	}
+	if written > 0 {
+		u.meter.Sent(written)
+	}
+	return nil, err
+}
+
+// countingBody counts the bytes of a request body the transport has read to send
+type countingBody struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
+
+// requestSize estimates the bytes of an HTTP/1.1 request on the wire: request line, headers and body
+func requestSize(req *http.Request, bodySize int) int {
+	size := len(req.Method) + len(req.URL.RequestURI()) + len(" HTTP/1.1\r\n") + len("Host: \r\n") + len(req.URL.Host)
+	for name, values := range req.Header {
+		for _, v := range values {
+			size += len(name) + len(": \r\n") + len(v)
+		}
+	}
+	return size + len("\r\n") + bodySize
+}
+
 // UploadBatch sends multiple batches of metrics
 func (u *HTTPUploader) UploadBatch(ctx context.Context, batches [][]*models.Metric) error {
 	for _, batch := range batches {
@@ -308,6 +570,11 @@ func (u *HTTPUploader) GetURL() string {
 	return u.url
 }
 
+// GetProtocol returns the configured upload protocol
+func (u *HTTPUploader) GetProtocol() string {
+	return u.protocol
+}
+
 // GetDeviceID returns the configured device ID
 func (u *HTTPUploader) GetDeviceID() string {
 	return u.deviceID
@@ -332,6 +599,7 @@ func (e *RetryableError) Unwrap() error {
 type NonRetryableError struct {
 	StatusCode int
 	Message    string
+	Rejected   bool // The receiver will never accept the chunk, so the caller should drop it
 }
 
 func (e *NonRetryableError) Error() string {
@@ -351,6 +619,13 @@ func (e *RateLimitError) Error() string {
 	return fmt.Sprintf("rate limited (status %d)", e.StatusCode)
 }
 
+// IsRejected reports whether err means the receiver will never accept the chunk
+// Retrying such a chunk would block the destination's queue for good, so callers drop it.
+func IsRejected(err error) bool {
+	var nonRetryable *NonRetryableError
+	return errors.As(err, &nonRetryable) && nonRetryable.Rejected
+}
+
 // isRetryable checks if an error should be retried
 func isRetryable(err error) bool {
 	// Check for explicit non-retryable errors
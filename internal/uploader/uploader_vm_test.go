@@ -4,12 +4,16 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -108,6 +112,60 @@ func TestUploadVM_WithAuth(t *testing.T) {
 	}
 }
 
+// TestUploadVM_StaticLabels verifies device labels are added without overriding metric tags
+func TestUploadVM_StaticLabels(t *testing.T) {
+	now := time.Now()
+	metrics := []*models.Metric{
+		models.NewMetric("cpu.temperature", 45.5, "device-001").WithTimestamp(now),
+		models.NewMetric("network.rx_bytes", 1024, "device-001").WithTimestamp(now).WithTag("site", "depot"),
+	}
+
+	var lines []VMMetric
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("Failed to create gzip reader: %v", err)
+			return
+		}
+		defer reader.Close()
+		body, _ := io.ReadAll(reader)
+		for _, line := range bytes.Split(bytes.TrimSpace(body), []byte("\n")) {
+			var m VMMetric
+			if err := json.Unmarshal(line, &m); err != nil {
+				t.Errorf("Failed to parse line %s: %v", line, err)
+			}
+			lines = append(lines, m)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	uploader := NewHTTPUploaderWithConfig(HTTPUploaderConfig{
+		URL:      server.URL,
+		DeviceID: "device-001",
+		Labels:   map[string]string{"site": "wellington", "vehicle": "van-3"},
+	})
+	if err := uploader.Upload(context.Background(), metrics); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 series, got %d", len(lines))
+	}
+	for _, line := range lines {
+		wantSite := "wellington"
+		if strings.HasPrefix(line.Metric["__name__"], "network_") {
+			wantSite = "depot"
+		}
+		if line.Metric["site"] != wantSite || line.Metric["vehicle"] != "van-3" {
+			t.Errorf("Expected site=%s and vehicle=van-3, got %v", wantSite, line.Metric)
+		}
+	}
+	if len(metrics[0].Tags) != 0 {
+		t.Errorf("Expected the caller's metrics to be left unchanged, got %v", metrics[0].Tags)
+	}
+}
+
 // TestUploadVM_Chunking verifies metrics are split into chunks
 func TestUploadVM_Chunking(t *testing.T) {
 	now := time.Now()
@@ -921,3 +979,183 @@ func TestUploadVM_NegativeBackoffDurations(t *testing.T) {
 		})
 	}
 }
+
+// storedMetrics returns n metrics tagged with storage IDs 1..n, one second apart
+func storedMetrics(n int) []*models.Metric {
+	now := time.Now()
+	metrics := make([]*models.Metric, n)
+	for i := range metrics {
+		metrics[i] = models.NewMetric("cpu.temperature", float64(40+i), "device-001").
+			WithTimestamp(now.Add(time.Duration(i)*time.Second)).
+			WithTag("_storage_id", strconv.Itoa(i+1))
+	}
+	return metrics
+}
+
+// TestUploadVM_ConcurrentChunks verifies chunks are uploaded in parallel and a failed chunk
+// only loses its own IDs
+func TestUploadVM_ConcurrentChunks(t *testing.T) {
+	// Every chunk must be in flight at once before any is answered
+	var arrived sync.WaitGroup
+	arrived.Add(3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived.Done()
+		arrived.Wait()
+		if r.Header.Get("X-Chunk-Index") == "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	uploader := NewHTTPUploaderWithConfig(HTTPUploaderConfig{
+		URL:         server.URL,
+		DeviceID:    "device-001",
+		ChunkSize:   10,
+		Concurrency: 3,
+		MaxRetries:  intPtr(0),
+	})
+
+	ids, err := uploader.UploadAndGetIDs(context.Background(), storedMetrics(30))
+	if err == nil || !strings.Contains(err.Error(), "failed to upload chunk 2/3") {
+		t.Fatalf("Expected chunk 2 to fail, got %v", err)
+	}
+
+	// Chunks 1 and 3 uploaded: IDs 1-10 and 21-30
+	if len(ids) != 20 || ids[0] != 1 || ids[9] != 10 || ids[10] != 21 || ids[19] != 30 {
+		t.Errorf("Expected the IDs of chunks 1 and 3, got %v", ids)
+	}
+}
+
+// TestUploadVM_StopsAfterFailedChunk verifies no new chunks start once one has failed
+func TestUploadVM_StopsAfterFailedChunk(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		if r.Header.Get("X-Chunk-Index") == "1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	uploader := NewHTTPUploaderWithConfig(HTTPUploaderConfig{
+		URL:        server.URL,
+		DeviceID:   "device-001",
+		ChunkSize:  10,
+		MaxRetries: intPtr(0),
+	})
+
+	ids, err := uploader.UploadAndGetIDs(context.Background(), storedMetrics(40))
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if !strings.Contains(err.Error(), "3 of 4 chunks not uploaded") {
+		t.Errorf("Expected the skipped chunks to be counted, got %v", err)
+	}
+	if len(ids) != 10 || ids[0] != 1 || ids[9] != 10 {
+		t.Errorf("Expected only the first chunk's IDs, got %v", ids)
+	}
+	if requests != 2 {
+		t.Errorf("Expected the upload to stop after the failed chunk, got %d requests", requests)
+	}
+}
+
+// countingMeter records what an uploader reports to its meter
+type countingMeter struct {
+	mu     sync.Mutex
+	waited []int
+	sent   []int
+}
+
+func (m *countingMeter) Wait(ctx context.Context, n int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.waited = append(m.waited, n)
+	return nil
+}
+
+func (m *countingMeter) Sent(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, n)
+}
+
+func TestUploadVM_Meter(t *testing.T) {
+	var received atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received.Add(int64(len(body)))
+		if r.Header.Get("X-Attempt") == "0" && r.Header.Get("X-Chunk-Index") == "1" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	meter := &countingMeter{}
+	uploader := NewHTTPUploaderWithConfig(HTTPUploaderConfig{
+		URL:        server.URL,
+		DeviceID:   "device-001",
+		ChunkSize:  10,
+		MaxRetries: intPtr(1),
+		RetryDelay: time.Millisecond,
+		Meter:      meter,
+	})
+
+	if _, err := uploader.UploadAndGetIDs(context.Background(), storedMetrics(20)); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+
+	// Every attempt is paced and accounted, retries included
+	if len(meter.waited) != 3 || len(meter.sent) != 3 {
+		t.Fatalf("Expected 3 requests metered, got %d waits and %d sends", len(meter.waited), len(meter.sent))
+	}
+	total := 0
+	for i, n := range meter.sent {
+		if n != meter.waited[i] {
+			t.Errorf("Request %d: waited for %d bytes but accounted %d", i, meter.waited[i], n)
+		}
+		total += n
+	}
+	// Request lines and headers come on top of the bodies
+	if body := int(received.Load()); total <= body || total > body+3*1024 {
+		t.Errorf("Expected the bodies (%d bytes) plus headers accounted, got %d", body, total)
+	}
+
+	// A request that timed out after it was sent is still accounted
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+	timedOut := NewHTTPUploaderWithConfig(HTTPUploaderConfig{
+		URL:        slow.URL,
+		DeviceID:   "device-001",
+		Timeout:    50 * time.Millisecond,
+		MaxRetries: intPtr(0),
+		Meter:      meter,
+	})
+	meter.waited, meter.sent = nil, nil
+	if _, err := timedOut.UploadAndGetIDs(context.Background(), storedMetrics(5)); err == nil {
+		t.Fatal("Expected the upload to time out")
+	}
+	if len(meter.sent) != 1 || meter.sent[0] != meter.waited[0] {
+		t.Errorf("Expected the timed out request accounted in full (%v), got %v", meter.waited, meter.sent)
+	}
+
+	// A request that never connected sent nothing billable
+	server.Close()
+	uploader.Close()
+	meter.sent = nil
+	uploader.UploadAndGetIDs(context.Background(), storedMetrics(5))
+	if len(meter.sent) != 0 {
+		t.Errorf("Expected failed connections not accounted, got %v", meter.sent)
+	}
+}
@@ -21,7 +21,82 @@ type VMMetric struct {
 	Timestamps []int64           `json:"timestamps"`
 }
 
-// sanitizeMetricName converts metric names to PromQL-safe format
+// MetricName returns the PromQL-safe name a metric is uploaded under
+// Local exposition uses it so scraped series match the uploaded ones
+func MetricName(m *models.Metric) string {
+	return metricName(m)
+}
+
+// metricName derives the PromQL-safe name from the declared kind and unit
+// Rows stored before collectors declared a kind fall back to the name heuristics of sanitizeMetricName
+func metricName(m *models.Metric) string {
+	if m.Kind == models.KindUnknown {
+		return sanitizeMetricName(m.Name)
+	}
+
+	safe := strings.ReplaceAll(m.Name, ".", "_")
+
+	// Type suffixes go last, after the unit (e.g., rx_bytes_total, latency_seconds_bucket)
+	suffix := ""
+	switch m.Kind {
+	case models.KindCounter:
+		safe = strings.TrimSuffix(safe, "_total")
+		suffix = "_total"
+	case models.KindHistogram:
+		for _, s := range histogramSuffixes {
+			if strings.HasSuffix(safe, s) {
+				safe, suffix = strings.TrimSuffix(safe, s), s
+				break
+			}
+		}
+	}
+
+	if m.Unit != "" && !hasUnit(safe, m.Unit) {
+		safe += "_" + m.Unit
+	}
+	return safe + suffix
+}
+
+// histogramSuffixes are the sample suffixes of a histogram family
+var histogramSuffixes = []string{"_bucket", "_sum", "_count"}
+
+// hasUnit reports whether a name already carries the unit as a whole word
+// (e.g., collection_duration_seconds_p95 already has "seconds")
+func hasUnit(name, unit string) bool {
+	return strings.HasSuffix(name, "_"+unit) || strings.Contains(name, "_"+unit+"_") || name == unit
+}
+
+// Family returns the metric family a metric belongs to and its kind, for type metadata
+// Counters drop _total and histogram samples drop _bucket/_sum/_count. Rollup aggregates are
+// gauges whatever the raw kind. Legacy rows are counters when their name ends in _total.
+func Family(m *models.Metric) (string, models.Kind) {
+	name := seriesName(m)
+	if m.IsRollup() {
+		return name, models.KindGauge
+	}
+
+	kind := m.Kind
+	if kind == models.KindUnknown {
+		kind = models.KindGauge
+		if strings.HasSuffix(name, "_total") {
+			kind = models.KindCounter
+		}
+	}
+
+	switch kind {
+	case models.KindCounter:
+		return strings.TrimSuffix(name, "_total"), kind
+	case models.KindHistogram:
+		for _, s := range histogramSuffixes {
+			if strings.HasSuffix(name, s) {
+				return strings.TrimSuffix(name, s), kind
+			}
+		}
+	}
+	return name, kind
+}
+
+// sanitizeMetricName converts legacy metric names without a declared kind to PromQL-safe format
 // Per engineering review: dots -> underscores, add unit suffixes, _total for counters
 func sanitizeMetricName(name string) string {
 	// Replace dots with underscores
@@ -64,7 +139,29 @@ func sanitizeMetricName(name string) string {
 	return safe
 }
 
-// isCounter determines if a metric name represents a counter
+// SeriesName returns the name a metric is uploaded under, including rollup naming
+// Exports use it so their series match the uploaded ones
+func SeriesName(m *models.Metric) string {
+	return seriesName(m)
+}
+
+// seriesName returns the name a metric is uploaded under
+// Rollup aggregates follow the recording rule convention <name>:<agg>_<resolution>
+// (e.g., cpu_usage:avg_5m), so they never mix with the raw series they replace
+func seriesName(m *models.Metric) string {
+	name := metricName(m)
+	if m.IsRollup() {
+		name += ":" + m.Tags[models.TagRollupAgg] + "_" + m.Tags[models.TagRollupResolution]
+	}
+	return name
+}
+
+// isInternalTag reports whether a tag is storage bookkeeping that is never sent as a label
+func isInternalTag(key string) bool {
+	return key == "_storage_id" || key == models.TagRollupAgg || key == models.TagRollupResolution
+}
+
+// isCounter guesses whether a legacy metric name represents a counter
 func isCounter(name string) bool {
 	// Common counter patterns
 	counterKeywords := []string{
@@ -85,6 +182,7 @@ func isCounter(name string) bool {
 
 // BuildVMJSONL converts metrics to VictoriaMetrics JSONL format
 // Each line is a separate JSON object
+// Rollup aggregates are sent as their own series (see seriesName)
 // String metrics (ValueType=1) are filtered out as VictoriaMetrics only accepts numeric values
 // Returns the JSONL data and a slice of storage IDs for metrics that were actually included
 func BuildVMJSONL(metrics []*models.Metric) ([]byte, []int64, error) {
@@ -111,7 +209,7 @@ func BuildVMJSONL(metrics []*models.Metric) ([]byte, []int64, error) {
 		labels := make(map[string]string)
 
 		// Add __name__ (required)
-		labels["__name__"] = sanitizeMetricName(m.Name)
+		labels["__name__"] = seriesName(m)
 
 		// Add device_id
 		if m.DeviceID != "" {
@@ -123,7 +221,7 @@ func BuildVMJSONL(metrics []*models.Metric) ([]byte, []int64, error) {
 			keys := make([]string, 0, len(m.Tags))
 			for k := range m.Tags {
 				// Skip internal storage tags
-				if k == "_storage_id" {
+				if isInternalTag(k) {
 					continue
 				}
 				keys = append(keys, k)
@@ -187,14 +285,25 @@ func CompressGzip(data []byte) ([]byte, error) {
 type Chunk struct {
 	Metrics        []*models.Metric // Original metrics (may include string metrics)
 	IncludedIDs    []int64          // Storage IDs of metrics actually sent (numeric only)
-	JSONLData      []byte
+	Protocol       string           // Upload protocol the chunk was encoded for
+	JSONLData      []byte           // Uncompressed payload (victoriametrics)
+	ProtobufData   []byte           // Uncompressed payload (prometheus_remote_write)
 	CompressedData []byte
 	Size           int // Size in bytes after compression
 }
 
-// BuildChunks splits metrics into chunks and compresses them
+// BuildChunks splits metrics into VictoriaMetrics JSONL chunks and compresses them
 // Per engineering review: 50 metrics per chunk, ~128-256 KB target, hard cap at 256 KB
 func BuildChunks(metrics []*models.Metric, chunkSize int) ([]*Chunk, error) {
+	return BuildChunksForProtocol(metrics, chunkSize, ProtocolVictoriaMetrics)
+}
+
+// BuildChunksForProtocol splits metrics into chunks encoded for the given upload protocol
+// victoriametrics chunks are JSONL + gzip, prometheus_remote_write chunks are protobuf + snappy
+func BuildChunksForProtocol(metrics []*models.Metric, chunkSize int, protocol string) ([]*Chunk, error) {
+	if protocol != ProtocolVictoriaMetrics && protocol != ProtocolPrometheusRemoteWrite {
+		return nil, fmt.Errorf("unsupported upload protocol %q", protocol)
+	}
 	if chunkSize <= 0 {
 		chunkSize = 50 // Default
 	}
@@ -218,22 +327,39 @@ func BuildChunks(metrics []*models.Metric, chunkSize int) ([]*Chunk, error) {
 
 		chunkMetrics := sortedMetrics[i:end]
 
-		// Build JSONL and collect IDs of included metrics
-		jsonlData, includedIDs, err := BuildVMJSONL(chunkMetrics)
-		if err != nil {
-			return nil, fmt.Errorf("failed to build JSONL for chunk: %w", err)
+		// Encode and collect IDs of included metrics
+		chunk := &Chunk{Metrics: chunkMetrics, Protocol: protocol}
+		var payload []byte
+		var err error
+		if protocol == ProtocolPrometheusRemoteWrite {
+			payload, chunk.IncludedIDs, err = BuildRemoteWrite(chunkMetrics)
+			if err != nil {
+				return nil, fmt.Errorf("failed to build remote_write request for chunk: %w", err)
+			}
+			chunk.ProtobufData = payload
+		} else {
+			payload, chunk.IncludedIDs, err = BuildVMJSONL(chunkMetrics)
+			if err != nil {
+				return nil, fmt.Errorf("failed to build JSONL for chunk: %w", err)
+			}
+			chunk.JSONLData = payload
 		}
 
 		// Skip empty chunks (e.g., when all metrics are string-valued)
-		// VictoriaMetrics rejects empty imports, and it wastes bandwidth
-		if len(jsonlData) == 0 {
+		// Both backends reject empty requests, and it wastes bandwidth
+		if len(payload) == 0 {
 			continue
 		}
 
 		// Compress
-		compressed, err := CompressGzip(jsonlData)
-		if err != nil {
-			return nil, fmt.Errorf("failed to compress chunk: %w", err)
+		var compressed []byte
+		if protocol == ProtocolPrometheusRemoteWrite {
+			compressed = CompressSnappy(payload)
+		} else {
+			compressed, err = CompressGzip(payload)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compress chunk: %w", err)
+			}
 		}
 
 		// Check size limit
@@ -252,7 +378,7 @@ func BuildChunks(metrics []*models.Metric, chunkSize int) ([]*Chunk, error) {
 
 			// Recursively process this range with smaller chunk size
 			subMetrics := sortedMetrics[i:end]
-			subChunks, err := BuildChunks(subMetrics, halfSize)
+			subChunks, err := BuildChunksForProtocol(subMetrics, halfSize, protocol)
 			if err != nil {
 				return nil, err
 			}
@@ -260,13 +386,8 @@ func BuildChunks(metrics []*models.Metric, chunkSize int) ([]*Chunk, error) {
 			continue
 		}
 
-		chunk := &Chunk{
-			Metrics:        chunkMetrics,
-			IncludedIDs:    includedIDs,
-			JSONLData:      jsonlData,
-			CompressedData: compressed,
-			Size:           len(compressed),
-		}
+		chunk.CompressedData = compressed
+		chunk.Size = len(compressed)
 
 		chunks = append(chunks, chunk)
 	}
@@ -874,3 +874,119 @@ func TestUploadAndGetIDs_ReturnsOnlyNumericIDs(t *testing.T) {
 		t.Errorf("Expected IDs [10, 12], got %v", uploadedIDs)
 	}
 }
+
+// TestBuildVMJSONL_Rollups verifies rollup aggregates upload as separate <name>:<agg>_<resolution> series
+func TestBuildVMJSONL_Rollups(t *testing.T) {
+	ts := time.UnixMilli(1700000000000)
+	metrics := []*models.Metric{
+		models.NewMetric("cpu.temperature", 41.5, "device-001").WithTimestamp(ts).
+			WithTag("zone", "cpu0").
+			WithTag(models.TagRollupResolution, "5m").
+			WithTag(models.TagRollupAgg, "avg").
+			WithTag("_storage_id", "7"),
+		models.NewMetric("cpu.temperature", 60, "device-001").WithTimestamp(ts).
+			WithTag("zone", "cpu0").
+			WithTag(models.TagRollupResolution, "5m").
+			WithTag(models.TagRollupAgg, "count").
+			WithTag("_storage_id", "8"),
+	}
+
+	result, ids, err := BuildVMJSONL(metrics)
+	if err != nil {
+		t.Fatalf("BuildVMJSONL failed: %v", err)
+	}
+	if len(ids) != 2 {
+		t.Errorf("Expected 2 included IDs, got %v", ids)
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(result), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+
+	wantNames := []string{"cpu_temperature_celsius:avg_5m", "cpu_temperature_celsius:count_5m"}
+	for i, line := range lines {
+		var vmMetric VMMetric
+		if err := json.Unmarshal(line, &vmMetric); err != nil {
+			t.Fatalf("Failed to parse JSON: %v", err)
+		}
+		if vmMetric.Metric["__name__"] != wantNames[i] {
+			t.Errorf("Expected name %s, got %s", wantNames[i], vmMetric.Metric["__name__"])
+		}
+		if vmMetric.Metric["zone"] != "cpu0" {
+			t.Errorf("Expected zone label kept, got %v", vmMetric.Metric)
+		}
+		for _, internal := range []string{models.TagRollupResolution, models.TagRollupAgg, "_storage_id"} {
+			if _, ok := vmMetric.Metric[internal]; ok {
+				t.Errorf("Internal tag %s should not be sent", internal)
+			}
+		}
+	}
+}
+
+// TestMetricName_DeclaredKind verifies declared kinds and units replace the name heuristics
+func TestMetricName_DeclaredKind(t *testing.T) {
+	tests := []struct {
+		metric *models.Metric
+		want   string
+	}{
+		// Counter keywords in a gauge name no longer add _total
+		{models.NewMetric("http.requests_in_flight", 3, "").AsGauge(""), "http_requests_in_flight"},
+		{models.NewMetric("network.rx_errors", 2, "").AsGauge(""), "network_rx_errors"},
+		// Counters get _total after the unit, whether or not the name had it
+		{models.NewMetric("network.rx_errors", 2, "").AsCounter(""), "network_rx_errors_total"},
+		{models.NewMetric("network.rx_bytes_total", 1, "").AsCounter("bytes"), "network_rx_bytes_total"},
+		{models.NewMetric("network.rx", 1, "").AsCounter("bytes"), "network_rx_bytes_total"},
+		// Units are appended once, and not when the name already carries them
+		{models.NewMetric("cpu.temperature", 40, "").AsGauge("celsius"), "cpu_temperature_celsius"},
+		{models.NewMetric("collector.collection_duration_seconds_p95", 1, "").AsGauge("seconds"), "collector_collection_duration_seconds_p95"},
+		// Byte-ish names are left alone without a declared unit
+		{models.NewMetric("modem.bytes_per_frame_ratio", 1, "").AsGauge(""), "modem_bytes_per_frame_ratio"},
+		// Histogram suffixes stay last
+		{models.NewMetric("upload.latency_bucket", 1, "").WithKind(models.KindHistogram).WithUnit("seconds"), "upload_latency_seconds_bucket"},
+		{models.NewMetric("upload.latency_count", 1, "").WithKind(models.KindHistogram).WithUnit("seconds"), "upload_latency_seconds_count"},
+	}
+
+	for _, tt := range tests {
+		if got := MetricName(tt.metric); got != tt.want {
+			t.Errorf("MetricName(%s %s/%s) = %s, want %s", tt.metric.Name, tt.metric.Kind, tt.metric.Unit, got, tt.want)
+		}
+	}
+}
+
+// TestMetricName_LegacyFallback verifies rows without a kind keep their heuristic names
+func TestMetricName_LegacyFallback(t *testing.T) {
+	legacy := models.NewMetric("network.rx_errors", 2, "")
+	if got := MetricName(legacy); got != "network_rx_errors_total" {
+		t.Errorf("Expected heuristic counter name, got %s", got)
+	}
+	if got := MetricName(models.NewMetric("cpu.temperature", 40, "")); got != "cpu_temperature_celsius" {
+		t.Errorf("Expected heuristic unit suffix, got %s", got)
+	}
+}
+
+func TestFamily(t *testing.T) {
+	tests := []struct {
+		metric     *models.Metric
+		wantFamily string
+		wantKind   models.Kind
+	}{
+		{models.NewMetric("network.rx_bytes_total", 1, "").AsCounter("bytes"), "network_rx_bytes", models.KindCounter},
+		{models.NewMetric("http.requests_in_flight", 1, "").AsGauge(""), "http_requests_in_flight", models.KindGauge},
+		{models.NewMetric("upload.latency_sum", 1, "").WithKind(models.KindHistogram).WithUnit("seconds"), "upload_latency_seconds", models.KindHistogram},
+		// Legacy rows: typed from the heuristic name
+		{models.NewMetric("network.tx_packets", 1, ""), "network_tx_packets", models.KindCounter},
+		{models.NewMetric("memory.used_bytes", 1, ""), "memory_used_bytes", models.KindGauge},
+		// Rollups are gauges whatever the raw kind
+		{models.NewMetric("network.rx_bytes_total", 1, "").AsCounter("bytes").
+			WithTag(models.TagRollupResolution, "5m").WithTag(models.TagRollupAgg, "max"),
+			"network_rx_bytes_total:max_5m", models.KindGauge},
+	}
+
+	for _, tt := range tests {
+		family, kind := Family(tt.metric)
+		if family != tt.wantFamily || kind != tt.wantKind {
+			t.Errorf("Family(%s) = %s/%s, want %s/%s", tt.metric.Name, family, kind, tt.wantFamily, tt.wantKind)
+		}
+	}
+}